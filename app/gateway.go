@@ -0,0 +1,9 @@
+//go:build !nogateway
+
+package main
+
+import "public_api_service/publicapi"
+
+func init() {
+	services["gateway"] = publicapi.Run
+}
@@ -0,0 +1,135 @@
+// Command app run the Go services in one process, for local development of the whole stack:
+//
+//	app --service=gateway|user|all
+//	app --service=user migrate [up|status]
+//	app --service=user seed [--users 100]
+//
+// Services are compiled in unless excluded with their build tag (nogateway, nouser). With all, the public API
+// calls the user service usecases directly instead of over HTTP, the listing service stays a separate python process
+// reached on LISTING_SERVICE_URL.
+package main
+
+import (
+	"errors"
+	"flag"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// run of each service compiled into the binary, registered by the service files
+var services = map[string]func(){}
+
+// migrate command of the services keeping a database, args are up or status
+var migrations = map[string]func(args []string){}
+
+// seed command of the services keeping a database, creating fake data
+var seeds = map[string]func(args []string){}
+
+// set when both services are compiled in, see runAll
+var (
+	// newUserService build the user service handler without serving it
+	newUserService func() (handler http.Handler, closeDB func())
+	// useUserServiceInProcess register the inprocess transport the public API then picks unless USER_SERVICE_TRANSPORT says otherwise
+	useUserServiceInProcess func()
+)
+
+func main() {
+	service := flag.String("service", "all", "service to run: "+strings.Join(serviceNames(), ", ")+" or all")
+	userAddr := flag.String("user-addr", ":6001", "with all, also serve the user service on this address for its operator endpoints, empty to keep it in memory only")
+	flag.Parse()
+
+	if flag.Arg(0) == "migrate" {
+		migrate(*service, flag.Args()[1:])
+		return
+	}
+	if flag.Arg(0) == "seed" {
+		seed(*service, flag.Args()[1:])
+		return
+	}
+
+	switch *service {
+	case "all":
+		runAll(*userAddr)
+	case "listing":
+		log.Fatal("the listing service is listing_service.py, run it with python and point LISTING_SERVICE_URL at it")
+	default:
+		run, ok := services[*service]
+		if !ok {
+			log.Fatalf("service %q is not built into this binary, available: %s", *service, strings.Join(serviceNames(), ", "))
+		}
+		run()
+	}
+}
+
+// serve the public API calling the user service in process, a binary built with one service only runs it
+func runAll(userAddr string) {
+	if newUserService == nil || useUserServiceInProcess == nil {
+		for _, run := range services {
+			run()
+		}
+		return
+	}
+
+	handler, closeDB := newUserService()
+	defer closeDB()
+	useUserServiceInProcess()
+
+	if userAddr != "" {
+		srv := &http.Server{Addr: userAddr, Handler: handler}
+		go func() {
+			if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				log.Fatal(err)
+			}
+		}()
+		defer srv.Close()
+	}
+
+	services["gateway"]()
+}
+
+// migrate the database of service, all migrates every service compiled in
+func migrate(service string, args []string) {
+	if service == "all" {
+		for _, name := range serviceNames() {
+			if run, ok := migrations[name]; ok {
+				run(args)
+			}
+		}
+		return
+	}
+
+	run, ok := migrations[service]
+	if !ok {
+		log.Fatalf("service %q has no migrations in this binary", service)
+	}
+	run(args)
+}
+
+// seed the database of service with fake data, all seeds every service compiled in
+func seed(service string, args []string) {
+	if service == "all" {
+		for _, name := range serviceNames() {
+			if run, ok := seeds[name]; ok {
+				run(args)
+			}
+		}
+		return
+	}
+
+	run, ok := seeds[service]
+	if !ok {
+		log.Fatalf("service %q has no seed in this binary", service)
+	}
+	run(args)
+}
+
+func serviceNames() []string {
+	names := make([]string, 0, len(services))
+	for name := range services {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
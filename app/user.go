@@ -0,0 +1,12 @@
+//go:build !nouser
+
+package main
+
+import "user_service/userservice"
+
+func init() {
+	services["user"] = userservice.Run
+	newUserService = userservice.New
+	migrations["user"] = userservice.Migrate
+	seeds["user"] = userservice.Seed
+}
@@ -0,0 +1,1016 @@
+//go:build !nouser && !nogateway
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+
+	"apperror"
+	"events"
+	"public_api_service/publicapi"
+	"user_service/userservice"
+)
+
+func init() {
+	useUserServiceInProcess = func() {
+		publicapi.RegisterUserTransport(inProcessUserClient{})
+	}
+}
+
+// public API client of the user service calling its usecases directly, no HTTP between the two.
+// Errors of the user service are mapped to the public API errors its HTTP client returns for the same status
+type inProcessUserClient struct{}
+
+func (inProcessUserClient) Name() string {
+	return "inprocess"
+}
+
+func (inProcessUserClient) FindUser(ctx context.Context, userID int) (*publicapi.UserResponse, error) {
+	user, err := userservice.FindUser(ctx, userID)
+	if err != nil {
+		if errors.Is(err, apperror.ErrNotFound) {
+			return nil, publicapi.ErrUserNotFound
+		}
+		return nil, err
+	}
+
+	return &publicapi.UserResponse{Result: true, User: publicapi.User(*user)}, nil
+}
+
+func (inProcessUserClient) FindUsers(ctx context.Context, userIDs []int) (*publicapi.UsersResponse, error) {
+	users, err := userservice.FindUsers(ctx, userIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	res := &publicapi.UsersResponse{Result: true, Users: make([]publicapi.User, len(users))}
+	for i, user := range users {
+		res.Users[i] = publicapi.User(user)
+	}
+	return res, nil
+}
+
+func (inProcessUserClient) ListUsers(ctx context.Context, pageNum, pageSize int) (*publicapi.UsersPageResponse, error) {
+	users, pagination, err := userservice.ListUsers(ctx, pageNum, pageSize, "", "")
+	if err != nil {
+		return nil, err
+	}
+
+	res := &publicapi.UsersPageResponse{Result: true, Users: make([]publicapi.User, len(users)), Pagination: publicapi.Pagination(*pagination)}
+	for i, user := range users {
+		res.Users[i] = publicapi.User(user)
+	}
+	return res, nil
+}
+
+func (inProcessUserClient) CreateUser(ctx context.Context, userByte []byte) (*publicapi.UserResponse, error) {
+	var create userservice.UserCreate
+	if err := json.Unmarshal(userByte, &create); err != nil {
+		return nil, err
+	}
+
+	user, err := userservice.CreateUser(ctx, create)
+	if err != nil {
+		if errors.Is(err, apperror.ErrConflict) {
+			return nil, publicapi.ErrUserEmailTaken
+		}
+		return nil, err
+	}
+
+	return &publicapi.UserResponse{Result: true, User: publicapi.User(*user)}, nil
+}
+
+func (inProcessUserClient) UpdateUser(ctx context.Context, userID int, userByte []byte) (*publicapi.UserResponse, error) {
+	var update userservice.UserUpdate
+	if err := json.Unmarshal(userByte, &update); err != nil {
+		return nil, err
+	}
+
+	user, err := userservice.UpdateUser(ctx, userID, update)
+	switch {
+	case errors.Is(err, apperror.ErrNotFound):
+		return nil, publicapi.ErrUserNotFound
+	case errors.Is(err, apperror.ErrValidation):
+		return nil, publicapi.ErrUserUpdateEmpty
+	case errors.Is(err, apperror.ErrConflict):
+		return nil, publicapi.ErrUserEmailTaken
+	case err != nil:
+		return nil, err
+	}
+
+	return &publicapi.UserResponse{Result: true, User: publicapi.User(*user)}, nil
+}
+
+func (inProcessUserClient) DeleteUser(ctx context.Context, userID int, hard bool) error {
+	err := userservice.DeleteUser(ctx, userID, hard)
+	switch {
+	case errors.Is(err, apperror.ErrNotFound):
+		return publicapi.ErrUserNotFound
+	case errors.Is(err, apperror.ErrConflict):
+		return publicapi.ErrUserLegalHold
+	}
+
+	return err
+}
+
+func (inProcessUserClient) SetUserLegalHold(ctx context.Context, userID int, holdByte []byte) error {
+	var hold userservice.LegalHold
+	if err := json.Unmarshal(holdByte, &hold); err != nil {
+		return err
+	}
+
+	if err := userservice.SetLegalHold(ctx, userID, hold, "public api"); err != nil {
+		if errors.Is(err, apperror.ErrNotFound) {
+			return publicapi.ErrUserNotFound
+		}
+		return err
+	}
+	return nil
+}
+
+func (inProcessUserClient) SetUserRole(ctx context.Context, userID int, roleByte []byte) (*publicapi.UserResponse, error) {
+	var role userservice.UserRole
+	if err := json.Unmarshal(roleByte, &role); err != nil {
+		return nil, err
+	}
+
+	user, err := userservice.SetUserRole(ctx, userID, role.Role)
+	if err != nil {
+		if errors.Is(err, apperror.ErrNotFound) {
+			return nil, publicapi.ErrUserNotFound
+		}
+		return nil, err
+	}
+
+	return &publicapi.UserResponse{Result: true, User: publicapi.User(*user)}, nil
+}
+
+func (inProcessUserClient) Login(ctx context.Context, loginByte []byte) (*publicapi.LoginResponse, error) {
+	var login userservice.Login
+	if err := json.Unmarshal(loginByte, &login); err != nil {
+		return nil, err
+	}
+
+	token, expiresAt, err := userservice.LoginUser(ctx, login)
+	if err != nil {
+		if errors.Is(err, userservice.ErrInvalidCredentials) {
+			return nil, publicapi.ErrInvalidCredentials
+		}
+		return nil, err
+	}
+
+	return &publicapi.LoginResponse{Result: true, Token: token, ExpiresAt: expiresAt}, nil
+}
+
+func (inProcessUserClient) FindPolicies(ctx context.Context) (*publicapi.PoliciesResponse, error) {
+	policies, err := userservice.CurrentPolicies(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return &publicapi.PoliciesResponse{Result: true, Policies: toPolicies(policies)}, nil
+}
+
+func (inProcessUserClient) FindUserConsents(ctx context.Context, userID int) (*publicapi.ConsentsResponse, error) {
+	consents, pending, err := userservice.UserConsents(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	res := &publicapi.ConsentsResponse{Result: true, Consents: make([]publicapi.Consent, len(consents)), Pending: toPolicies(pending)}
+	for i, consent := range consents {
+		res.Consents[i] = publicapi.Consent(consent)
+	}
+	return res, nil
+}
+
+func (inProcessUserClient) CreateUserConsent(ctx context.Context, userID int, consentByte []byte) (*publicapi.ConsentResponse, error) {
+	var accept userservice.PolicyVersionCreate
+	if err := json.Unmarshal(consentByte, &accept); err != nil {
+		return nil, err
+	}
+
+	consent, err := userservice.AcceptPolicy(ctx, userID, accept)
+	if err != nil {
+		if errors.Is(err, apperror.ErrValidation) {
+			return nil, publicapi.ErrPolicyVersionInvalid
+		}
+		return nil, err
+	}
+
+	return &publicapi.ConsentResponse{Result: true, Consent: publicapi.Consent(*consent)}, nil
+}
+
+func (inProcessUserClient) FindUserBlocks(ctx context.Context, userID int) (*publicapi.BlocksResponse, error) {
+	blocks, err := userservice.UserBlocks(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	res := &publicapi.BlocksResponse{Result: true, Blocks: make([]publicapi.Block, len(blocks))}
+	for i, block := range blocks {
+		res.Blocks[i] = publicapi.Block(block)
+	}
+	return res, nil
+}
+
+func (inProcessUserClient) CreateUserBlock(ctx context.Context, userID int, blockByte []byte) (*publicapi.BlockResponse, error) {
+	var create userservice.BlockCreate
+	if err := json.Unmarshal(blockByte, &create); err != nil {
+		return nil, err
+	}
+
+	block, err := userservice.BlockUser(ctx, userID, create)
+	switch {
+	case errors.Is(err, apperror.ErrNotFound):
+		return nil, publicapi.ErrUserNotFound
+	case errors.Is(err, apperror.ErrValidation):
+		return nil, publicapi.ErrBlockInvalid
+	case err != nil:
+		return nil, err
+	}
+
+	return &publicapi.BlockResponse{Result: true, Block: publicapi.Block(*block)}, nil
+}
+
+func (inProcessUserClient) DeleteUserBlock(ctx context.Context, userID, blockedUserID int) error {
+	return userservice.UnblockUser(ctx, userID, blockedUserID)
+}
+
+func (inProcessUserClient) FindUserPrivacy(ctx context.Context, userID int) (*publicapi.PrivacyResponse, error) {
+	privacy, err := userservice.UserPrivacy(ctx, userID)
+	if err != nil {
+		if errors.Is(err, apperror.ErrNotFound) {
+			return nil, publicapi.ErrUserNotFound
+		}
+		return nil, err
+	}
+
+	return &publicapi.PrivacyResponse{Result: true, Privacy: publicapi.PrivacySettings(*privacy)}, nil
+}
+
+func (inProcessUserClient) UpdateUserPrivacy(ctx context.Context, userID int, privacyByte []byte) (*publicapi.PrivacyResponse, error) {
+	var update userservice.PrivacyUpdate
+	if err := json.Unmarshal(privacyByte, &update); err != nil {
+		return nil, err
+	}
+
+	privacy, err := userservice.UpdateUserPrivacy(ctx, userID, update)
+	switch {
+	case errors.Is(err, apperror.ErrNotFound):
+		return nil, publicapi.ErrUserNotFound
+	case errors.Is(err, apperror.ErrValidation):
+		return nil, publicapi.ErrPrivacyUpdateEmpty
+	case err != nil:
+		return nil, err
+	}
+
+	return &publicapi.PrivacyResponse{Result: true, Privacy: publicapi.PrivacySettings(*privacy)}, nil
+}
+
+func (inProcessUserClient) FindNotificationPreferences(ctx context.Context, userID int) (*publicapi.NotificationPreferencesResponse, error) {
+	preferences, err := userservice.UserNotificationPreferences(ctx, userID)
+	if err != nil {
+		if errors.Is(err, apperror.ErrNotFound) {
+			return nil, publicapi.ErrUserNotFound
+		}
+		return nil, err
+	}
+
+	return &publicapi.NotificationPreferencesResponse{Result: true, Preferences: publicapi.NotificationPreferences(*preferences)}, nil
+}
+
+func (inProcessUserClient) UpdateNotificationPreferences(ctx context.Context, userID int, preferencesByte []byte) (*publicapi.NotificationPreferencesResponse, error) {
+	var update userservice.NotificationPreferencesUpdate
+	if err := json.Unmarshal(preferencesByte, &update); err != nil {
+		return nil, err
+	}
+
+	preferences, err := userservice.UpdateNotificationPreferences(ctx, userID, update)
+	switch {
+	case errors.Is(err, apperror.ErrNotFound):
+		return nil, publicapi.ErrUserNotFound
+	case errors.Is(err, apperror.ErrValidation):
+		return nil, publicapi.ErrNotificationPreferencesInvalid
+	case err != nil:
+		return nil, err
+	}
+
+	return &publicapi.NotificationPreferencesResponse{Result: true, Preferences: publicapi.NotificationPreferences(*preferences)}, nil
+}
+
+func (inProcessUserClient) FindUserFavorites(ctx context.Context, userID, pageNum, pageSize int) (*publicapi.FavoritesResponse, error) {
+	favorites, pagination, err := userservice.UserFavorites(ctx, userID, pageNum, pageSize)
+	if err != nil {
+		if errors.Is(err, apperror.ErrNotFound) {
+			return nil, publicapi.ErrUserNotFound
+		}
+		return nil, err
+	}
+
+	res := &publicapi.FavoritesResponse{Result: true, Favorites: make([]publicapi.Favorite, len(favorites)), Pagination: publicapi.Pagination(*pagination)}
+	for i, favorite := range favorites {
+		res.Favorites[i] = publicapi.Favorite(favorite)
+	}
+	return res, nil
+}
+
+func (inProcessUserClient) AddUserFavorite(ctx context.Context, userID, listingID int) (*publicapi.FavoriteResponse, error) {
+	favorite, err := userservice.AddFavorite(ctx, userID, listingID)
+	switch {
+	case errors.Is(err, apperror.ErrNotFound):
+		return nil, publicapi.ErrUserNotFound
+	case errors.Is(err, apperror.ErrConflict):
+		return nil, publicapi.ErrFavoriteLimit
+	case err != nil:
+		return nil, err
+	}
+
+	return &publicapi.FavoriteResponse{Result: true, Favorite: publicapi.Favorite(*favorite)}, nil
+}
+
+func (inProcessUserClient) RemoveUserFavorite(ctx context.Context, userID, listingID int) error {
+	err := userservice.RemoveFavorite(ctx, userID, listingID)
+	if errors.Is(err, apperror.ErrNotFound) {
+		return publicapi.ErrFavoriteNotFound
+	}
+	return err
+}
+
+func (inProcessUserClient) FindUserDevices(ctx context.Context, userID int) (*publicapi.PushDevicesResponse, error) {
+	devices, err := userservice.UserDevices(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	res := &publicapi.PushDevicesResponse{Result: true, Devices: make([]publicapi.PushDevice, len(devices))}
+	for i, device := range devices {
+		res.Devices[i] = publicapi.PushDevice(device)
+	}
+	return res, nil
+}
+
+func (inProcessUserClient) RegisterUserDevice(ctx context.Context, userID int, deviceByte []byte) (*publicapi.PushDeviceResponse, error) {
+	var create userservice.PushDeviceCreate
+	if err := json.Unmarshal(deviceByte, &create); err != nil {
+		return nil, err
+	}
+
+	device, err := userservice.RegisterDevice(ctx, userID, create)
+	switch {
+	case errors.Is(err, apperror.ErrNotFound):
+		return nil, publicapi.ErrUserNotFound
+	case errors.Is(err, apperror.ErrConflict):
+		return nil, publicapi.ErrPushDeviceLimit
+	case err != nil:
+		return nil, err
+	}
+
+	return &publicapi.PushDeviceResponse{Result: true, Device: publicapi.PushDevice(*device)}, nil
+}
+
+func (inProcessUserClient) DeleteUserDevice(ctx context.Context, userID, deviceID int) error {
+	err := userservice.DeleteDevice(ctx, userID, deviceID)
+	if errors.Is(err, apperror.ErrNotFound) {
+		return publicapi.ErrPushDeviceNotFound
+	}
+	return err
+}
+
+func (inProcessUserClient) FindPushReceipts(ctx context.Context, userID, deviceID, limit int) (*publicapi.PushReceiptsResponse, error) {
+	receipts, err := userservice.PushReceipts(ctx, userID, deviceID, limit)
+	if err != nil {
+		if errors.Is(err, apperror.ErrNotFound) {
+			return nil, publicapi.ErrPushDeviceNotFound
+		}
+		return nil, err
+	}
+
+	res := &publicapi.PushReceiptsResponse{Result: true, Receipts: make([]publicapi.PushReceipt, len(receipts))}
+	for i, receipt := range receipts {
+		res.Receipts[i] = publicapi.PushReceipt(receipt)
+	}
+	return res, nil
+}
+
+func (inProcessUserClient) RecordPushReceipts(ctx context.Context, receiptsByte []byte) error {
+	var create userservice.PushReceiptsCreate
+	if err := json.Unmarshal(receiptsByte, &create); err != nil {
+		return err
+	}
+
+	return userservice.RecordPushReceipts(ctx, create.Receipts)
+}
+
+func (inProcessUserClient) FindUserInbox(ctx context.Context, userID int, unread bool, pageNum, pageSize int) (*publicapi.InboxNotificationsResponse, error) {
+	notifications, unreadCount, pagination, err := userservice.UserInbox(ctx, userID, unread, pageNum, pageSize)
+	if err != nil {
+		if errors.Is(err, apperror.ErrNotFound) {
+			return nil, publicapi.ErrUserNotFound
+		}
+		return nil, err
+	}
+
+	res := &publicapi.InboxNotificationsResponse{
+		Result:        true,
+		Notifications: make([]publicapi.InboxNotification, len(notifications)),
+		UnreadCount:   unreadCount,
+		Pagination:    publicapi.Pagination(*pagination),
+	}
+	for i, notification := range notifications {
+		res.Notifications[i] = publicapi.InboxNotification(notification)
+	}
+	return res, nil
+}
+
+func (inProcessUserClient) CreateInboxNotification(ctx context.Context, userID int, notificationByte []byte) (*publicapi.InboxNotificationResponse, error) {
+	var create userservice.InboxNotificationCreate
+	if err := json.Unmarshal(notificationByte, &create); err != nil {
+		return nil, err
+	}
+
+	notification, err := userservice.CreateInboxNotification(ctx, userID, create)
+	if err != nil {
+		if errors.Is(err, apperror.ErrNotFound) {
+			return nil, publicapi.ErrUserNotFound
+		}
+		return nil, err
+	}
+
+	return &publicapi.InboxNotificationResponse{Result: true, Notification: publicapi.InboxNotification(*notification)}, nil
+}
+
+func (inProcessUserClient) MarkInboxRead(ctx context.Context, userID int, readByte []byte) (*publicapi.InboxReadResponse, error) {
+	var read userservice.InboxRead
+	if err := json.Unmarshal(readByte, &read); err != nil {
+		return nil, err
+	}
+
+	updated, unreadCount, err := userservice.MarkInboxRead(ctx, userID, read.IDs)
+	if err != nil {
+		return nil, err
+	}
+
+	return &publicapi.InboxReadResponse{Result: true, Updated: updated, UnreadCount: unreadCount}, nil
+}
+
+func (inProcessUserClient) FindBroadcasts(ctx context.Context, limit int) (*publicapi.BroadcastsResponse, error) {
+	broadcasts, err := userservice.Broadcasts(ctx, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	res := &publicapi.BroadcastsResponse{Result: true, Broadcasts: make([]publicapi.Broadcast, len(broadcasts))}
+	for i := range broadcasts {
+		res.Broadcasts[i] = publicBroadcast(&broadcasts[i])
+	}
+	return res, nil
+}
+
+func (inProcessUserClient) CreateBroadcast(ctx context.Context, broadcastByte []byte) (*publicapi.BroadcastResponse, error) {
+	var create userservice.BroadcastCreate
+	if err := json.Unmarshal(broadcastByte, &create); err != nil {
+		return nil, err
+	}
+
+	broadcast, audienceCount, err := userservice.CreateBroadcast(ctx, create)
+	if err != nil {
+		if errors.Is(err, apperror.ErrValidation) {
+			return nil, publicapi.ErrBroadcastInvalid
+		}
+		return nil, err
+	}
+
+	return &publicapi.BroadcastResponse{Result: true, Broadcast: publicBroadcast(broadcast), AudienceCount: audienceCount}, nil
+}
+
+func (inProcessUserClient) FindBroadcast(ctx context.Context, broadcastID int) (*publicapi.BroadcastResponse, error) {
+	broadcast, err := userservice.GetBroadcast(ctx, broadcastID)
+	if err != nil {
+		if errors.Is(err, apperror.ErrNotFound) {
+			return nil, publicapi.ErrBroadcastNotFound
+		}
+		return nil, err
+	}
+
+	return &publicapi.BroadcastResponse{Result: true, Broadcast: publicBroadcast(broadcast)}, nil
+}
+
+func (inProcessUserClient) CancelBroadcast(ctx context.Context, broadcastID int) (*publicapi.BroadcastResponse, error) {
+	broadcast, err := userservice.CancelBroadcast(ctx, broadcastID)
+	switch {
+	case errors.Is(err, apperror.ErrNotFound):
+		return nil, publicapi.ErrBroadcastNotFound
+	case errors.Is(err, apperror.ErrConflict):
+		return nil, publicapi.ErrBroadcastFinished
+	case err != nil:
+		return nil, err
+	}
+
+	return &publicapi.BroadcastResponse{Result: true, Broadcast: publicBroadcast(broadcast)}, nil
+}
+
+func (inProcessUserClient) CountBroadcastAudience(ctx context.Context, audienceByte []byte) (*publicapi.BroadcastAudienceResponse, error) {
+	var audience userservice.BroadcastAudience
+	if err := json.Unmarshal(audienceByte, &audience); err != nil {
+		return nil, err
+	}
+
+	count, err := userservice.BroadcastAudienceCount(ctx, audience)
+	if err != nil {
+		if errors.Is(err, apperror.ErrValidation) {
+			return nil, publicapi.ErrBroadcastInvalid
+		}
+		return nil, err
+	}
+
+	return &publicapi.BroadcastAudienceResponse{Result: true, AudienceCount: count}, nil
+}
+
+func (inProcessUserClient) ClaimBroadcastRecipients(ctx context.Context, limit int) (*publicapi.BroadcastBatchResponse, error) {
+	batch, err := userservice.ClaimBroadcastRecipients(ctx, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	res := &publicapi.BroadcastBatchResponse{Result: true, UserIDs: batch.UserIDs}
+	if batch.Broadcast != nil {
+		broadcast := publicBroadcast(batch.Broadcast)
+		res.Broadcast = &broadcast
+	}
+	return res, nil
+}
+
+func (inProcessUserClient) RecordBroadcastStats(ctx context.Context, broadcastID int, statsByte []byte) error {
+	var stats userservice.BroadcastStats
+	if err := json.Unmarshal(statsByte, &stats); err != nil {
+		return err
+	}
+
+	err := userservice.RecordBroadcastStats(ctx, broadcastID, stats)
+	if errors.Is(err, apperror.ErrNotFound) {
+		return publicapi.ErrBroadcastNotFound
+	}
+	return err
+}
+
+func (inProcessUserClient) RecordEmailEvents(ctx context.Context, eventsByte []byte) (*publicapi.EmailEventsRecordResponse, error) {
+	var create userservice.EmailEventsCreate
+	if err := json.Unmarshal(eventsByte, &create); err != nil {
+		return nil, err
+	}
+
+	suppressed, err := userservice.RecordEmailEvents(ctx, create.Events)
+	if err != nil {
+		return nil, err
+	}
+
+	return &publicapi.EmailEventsRecordResponse{Result: true, Suppressed: suppressed}, nil
+}
+
+func (inProcessUserClient) FindUserEmailEvents(ctx context.Context, userID, limit int) (*publicapi.EmailEventsResponse, error) {
+	emailEvents, err := userservice.UserEmailEvents(ctx, userID, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	res := &publicapi.EmailEventsResponse{Result: true, Events: make([]publicapi.EmailEvent, len(emailEvents))}
+	for i, event := range emailEvents {
+		res.Events[i] = publicapi.EmailEvent(event)
+	}
+	return res, nil
+}
+
+func (inProcessUserClient) FindEmailSuppressions(ctx context.Context, reason string, limit int) (*publicapi.EmailSuppressionsResponse, error) {
+	suppressions, err := userservice.EmailSuppressions(ctx, reason, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	res := &publicapi.EmailSuppressionsResponse{Result: true, Suppressions: make([]publicapi.EmailSuppression, len(suppressions))}
+	for i, suppression := range suppressions {
+		res.Suppressions[i] = publicapi.EmailSuppression(suppression)
+	}
+	return res, nil
+}
+
+func (inProcessUserClient) FindUserEmailSuppression(ctx context.Context, userID int) (*publicapi.EmailSuppressionResponse, error) {
+	suppression, err := userservice.UserEmailSuppression(ctx, userID)
+	if err != nil {
+		if errors.Is(err, apperror.ErrNotFound) {
+			return nil, publicapi.ErrEmailSuppressionNotFound
+		}
+		return nil, err
+	}
+
+	return &publicapi.EmailSuppressionResponse{Result: true, Suppression: publicapi.EmailSuppression(*suppression)}, nil
+}
+
+func (inProcessUserClient) SuppressUserEmail(ctx context.Context, userID int, suppressionByte []byte) (*publicapi.EmailSuppressionResponse, error) {
+	var create userservice.EmailSuppressionCreate
+	if err := json.Unmarshal(suppressionByte, &create); err != nil {
+		return nil, err
+	}
+
+	suppression, err := userservice.SuppressUserEmail(ctx, userID, create)
+	if err != nil {
+		if errors.Is(err, apperror.ErrNotFound) {
+			return nil, publicapi.ErrUserNotFound
+		}
+		return nil, err
+	}
+
+	return &publicapi.EmailSuppressionResponse{Result: true, Suppression: publicapi.EmailSuppression(*suppression)}, nil
+}
+
+func (inProcessUserClient) UnsuppressUserEmail(ctx context.Context, userID int) error {
+	err := userservice.UnsuppressUserEmail(ctx, userID)
+	if errors.Is(err, apperror.ErrNotFound) {
+		return publicapi.ErrEmailSuppressionNotFound
+	}
+	return err
+}
+
+func (inProcessUserClient) RecordAudit(ctx context.Context, entryByte []byte) error {
+	var entry userservice.AuditEntry
+	if err := json.Unmarshal(entryByte, &entry); err != nil {
+		return err
+	}
+
+	_, err := userservice.RecordAudit(ctx, entry)
+	return err
+}
+
+func (inProcessUserClient) FindAuditLog(ctx context.Context, filter publicapi.AuditLogFilter, pageNum, pageSize int) (*publicapi.AuditLogResponse, error) {
+	entries, pagination, err := userservice.AuditLog(ctx, userservice.AuditLogFilter(filter), pageNum, pageSize)
+	if err != nil {
+		return nil, err
+	}
+
+	res := &publicapi.AuditLogResponse{Result: true, Entries: make([]publicapi.AuditEntry, len(entries)), Pagination: publicapi.Pagination(*pagination)}
+	for i, entry := range entries {
+		res.Entries[i] = publicapi.AuditEntry(entry)
+	}
+	return res, nil
+}
+
+func (inProcessUserClient) FindAuditChain(ctx context.Context, afterID int64, limit int) (*publicapi.AuditChainResponse, error) {
+	entries, err := userservice.AuditChain(ctx, afterID, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	res := &publicapi.AuditChainResponse{Result: true, Entries: make([]publicapi.AuditEntry, len(entries))}
+	for i, entry := range entries {
+		res.Entries[i] = publicapi.AuditEntry(entry)
+	}
+	return res, nil
+}
+
+func (inProcessUserClient) VerifyAuditChain(ctx context.Context) (*publicapi.AuditChainVerificationResponse, error) {
+	verification, err := userservice.VerifyAuditChain(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	res := &publicapi.AuditChainVerificationResponse{Result: true, Verification: publicapi.AuditChainVerification{
+		Valid:          verification.Valid,
+		Entries:        verification.Entries,
+		HeadID:         verification.HeadID,
+		HeadHash:       verification.HeadHash,
+		BrokenID:       verification.BrokenID,
+		Anchors:        verification.Anchors,
+		BrokenAnchorID: verification.BrokenAnchorID,
+	}}
+	if verification.LastAnchor != nil {
+		anchor := publicapi.AuditAnchor(*verification.LastAnchor)
+		res.Verification.LastAnchor = &anchor
+	}
+	return res, nil
+}
+
+func (inProcessUserClient) FindNotificationTemplates(ctx context.Context) (*publicapi.NotificationTemplatesResponse, error) {
+	templates, err := userservice.NotificationTemplates(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return publicNotificationTemplates(templates), nil
+}
+
+func (inProcessUserClient) FindNotificationTemplateVersions(ctx context.Context, event, channel, locale string) (*publicapi.NotificationTemplatesResponse, error) {
+	templates, err := userservice.NotificationTemplateVersions(ctx, event, channel, locale)
+	if err != nil {
+		if errors.Is(err, apperror.ErrNotFound) {
+			return nil, publicapi.ErrNotificationTemplateNotFound
+		}
+		return nil, err
+	}
+
+	return publicNotificationTemplates(templates), nil
+}
+
+func (inProcessUserClient) CreateNotificationTemplate(ctx context.Context, templateByte []byte) (*publicapi.NotificationTemplateResponse, error) {
+	var create userservice.NotificationTemplateCreate
+	if err := json.Unmarshal(templateByte, &create); err != nil {
+		return nil, err
+	}
+
+	template, err := userservice.CreateNotificationTemplate(ctx, create)
+	if err != nil {
+		return nil, err
+	}
+
+	return &publicapi.NotificationTemplateResponse{Result: true, Template: publicapi.NotificationTemplate(*template)}, nil
+}
+
+func (inProcessUserClient) DeleteNotificationTemplate(ctx context.Context, event, channel, locale string) error {
+	err := userservice.DeleteNotificationTemplate(ctx, event, channel, locale)
+	if errors.Is(err, apperror.ErrNotFound) {
+		return publicapi.ErrNotificationTemplateNotFound
+	}
+	return err
+}
+
+func (inProcessUserClient) FindContentRules(ctx context.Context) (*publicapi.ContentRulesResponse, error) {
+	rules, err := userservice.ContentRules(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	res := &publicapi.ContentRulesResponse{Result: true, Rules: make([]publicapi.ContentRule, len(rules))}
+	for i, rule := range rules {
+		res.Rules[i] = publicapi.ContentRule(rule)
+	}
+	return res, nil
+}
+
+func (inProcessUserClient) SaveContentRule(ctx context.Context, name string, ruleByte []byte) (*publicapi.ContentRuleResponse, error) {
+	var save userservice.ContentRuleSave
+	if err := json.Unmarshal(ruleByte, &save); err != nil {
+		return nil, err
+	}
+
+	rule, err := userservice.SaveContentRule(ctx, name, save)
+	if err != nil {
+		return nil, err
+	}
+
+	return &publicapi.ContentRuleResponse{Result: true, Rule: publicapi.ContentRule(*rule)}, nil
+}
+
+func (inProcessUserClient) DeleteContentRule(ctx context.Context, name string) error {
+	err := userservice.DeleteContentRule(ctx, name)
+	if errors.Is(err, apperror.ErrNotFound) {
+		return publicapi.ErrContentRuleNotFound
+	}
+	return err
+}
+
+func (inProcessUserClient) FindOutboxEvents(ctx context.Context, filter events.ReplayFilter, afterID int64, limit int) (*publicapi.OutboxEventsResponse, error) {
+	outboxEvents, err := userservice.OutboxEvents(ctx, filter, afterID, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	res := &publicapi.OutboxEventsResponse{Result: true, Events: make([]publicapi.OutboxEvent, len(outboxEvents))}
+	for i, e := range outboxEvents {
+		res.Events[i] = publicapi.OutboxEvent(e)
+	}
+	return res, nil
+}
+
+func (inProcessUserClient) FindDeadLetters(ctx context.Context, source string, pageNum, pageSize int) (*publicapi.DeadLettersResponse, error) {
+	letters, pagination, err := userservice.DeadLetters(ctx, source, pageNum, pageSize)
+	if err != nil {
+		return nil, err
+	}
+
+	res := &publicapi.DeadLettersResponse{Result: true, DeadLetters: make([]publicapi.DeadLetter, len(letters)), Pagination: publicapi.Pagination(*pagination)}
+	for i, letter := range letters {
+		res.DeadLetters[i] = publicapi.DeadLetter(letter)
+	}
+	return res, nil
+}
+
+func (inProcessUserClient) FindDeadLetter(ctx context.Context, id int64) (*publicapi.DeadLetterResponse, error) {
+	letter, err := userservice.GetDeadLetter(ctx, id)
+	return publicDeadLetter(letter, err)
+}
+
+func (inProcessUserClient) CreateDeadLetter(ctx context.Context, letterByte []byte) (*publicapi.DeadLetterResponse, error) {
+	var create userservice.DeadLetterCreate
+	if err := json.Unmarshal(letterByte, &create); err != nil {
+		return nil, err
+	}
+
+	letter, err := userservice.CreateDeadLetter(ctx, create)
+	return publicDeadLetter(letter, err)
+}
+
+func (inProcessUserClient) UpdateDeadLetter(ctx context.Context, id int64, updateByte []byte) (*publicapi.DeadLetterResponse, error) {
+	var update userservice.DeadLetterUpdate
+	if err := json.Unmarshal(updateByte, &update); err != nil {
+		return nil, err
+	}
+
+	letter, err := userservice.UpdateDeadLetter(ctx, id, update)
+	return publicDeadLetter(letter, err)
+}
+
+func (inProcessUserClient) RequeueDeadLetter(ctx context.Context, id int64) (*publicapi.DeadLetterResponse, error) {
+	letter, err := userservice.RequeueDeadLetter(ctx, id)
+	return publicDeadLetter(letter, err)
+}
+
+func (inProcessUserClient) DeleteDeadLetter(ctx context.Context, id int64) error {
+	err := userservice.DeleteDeadLetter(ctx, id)
+	if errors.Is(err, apperror.ErrNotFound) {
+		return publicapi.ErrDeadLetterNotFound
+	}
+	return err
+}
+
+func (inProcessUserClient) FindAdminActions(ctx context.Context, status string, pageNum, pageSize int) (*publicapi.AdminActionsResponse, error) {
+	actions, pagination, err := userservice.AdminActions(ctx, status, pageNum, pageSize)
+	if err != nil {
+		return nil, err
+	}
+
+	res := &publicapi.AdminActionsResponse{Result: true, AdminActions: make([]publicapi.AdminAction, len(actions)), Pagination: publicapi.Pagination(*pagination)}
+	for i, action := range actions {
+		res.AdminActions[i] = publicapi.AdminAction(action)
+	}
+	return res, nil
+}
+
+func (inProcessUserClient) FindAdminAction(ctx context.Context, id int64) (*publicapi.AdminActionResponse, error) {
+	action, err := userservice.GetAdminAction(ctx, id)
+	return publicAdminAction(action, err, nil)
+}
+
+func (inProcessUserClient) CreateAdminAction(ctx context.Context, actionByte []byte) (*publicapi.AdminActionResponse, error) {
+	var create userservice.AdminActionCreate
+	if err := json.Unmarshal(actionByte, &create); err != nil {
+		return nil, err
+	}
+
+	action, err := userservice.CreateAdminAction(ctx, create)
+	return publicAdminAction(action, err, publicapi.ErrAdminActionDuplicate)
+}
+
+func (inProcessUserClient) DecideAdminAction(ctx context.Context, id int64, decisionByte []byte) (*publicapi.AdminActionResponse, error) {
+	var decision userservice.AdminActionDecision
+	if err := json.Unmarshal(decisionByte, &decision); err != nil {
+		return nil, err
+	}
+
+	action, err := userservice.DecideAdminAction(ctx, id, decision)
+	return publicAdminAction(action, err, publicapi.ErrAdminActionNotPending)
+}
+
+func (inProcessUserClient) RecordAdminActionOutcome(ctx context.Context, id int64, outcomeByte []byte) (*publicapi.AdminActionResponse, error) {
+	var outcome userservice.AdminActionOutcome
+	if err := json.Unmarshal(outcomeByte, &outcome); err != nil {
+		return nil, err
+	}
+
+	action, err := userservice.RecordAdminActionOutcome(ctx, id, outcome)
+	return publicAdminAction(action, err, publicapi.ErrAdminActionNotApproved)
+}
+
+// admin action of the user service as the public API one, conflict the public API error of a conflict of the call
+func publicAdminAction(action *userservice.AdminAction, err error, conflict error) (*publicapi.AdminActionResponse, error) {
+	switch {
+	case errors.Is(err, apperror.ErrNotFound):
+		return nil, publicapi.ErrAdminActionNotFound
+	case errors.Is(err, apperror.ErrConflict) && conflict != nil:
+		return nil, conflict
+	case err != nil:
+		return nil, err
+	}
+
+	return &publicapi.AdminActionResponse{Result: true, AdminAction: publicapi.AdminAction(*action)}, nil
+}
+
+// dead letter of the user service as the public API one, its errors as the public API ones
+func publicDeadLetter(letter *userservice.DeadLetter, err error) (*publicapi.DeadLetterResponse, error) {
+	switch {
+	case errors.Is(err, apperror.ErrNotFound):
+		return nil, publicapi.ErrDeadLetterNotFound
+	case errors.Is(err, apperror.ErrValidation):
+		return nil, publicapi.ErrDeadLetterInvalid
+	case errors.Is(err, apperror.ErrConflict):
+		return nil, publicapi.ErrDeadLetterGone
+	case err != nil:
+		return nil, err
+	}
+
+	return &publicapi.DeadLetterResponse{Result: true, DeadLetter: publicapi.DeadLetter(*letter)}, nil
+}
+
+func publicNotificationTemplates(templates []userservice.NotificationTemplate) *publicapi.NotificationTemplatesResponse {
+	res := &publicapi.NotificationTemplatesResponse{Result: true, Templates: make([]publicapi.NotificationTemplate, len(templates))}
+	for i, template := range templates {
+		res.Templates[i] = publicapi.NotificationTemplate(template)
+	}
+	return res
+}
+
+// broadcast of the user service as the public API one, their audiences are distinct types so no plain conversion
+func publicBroadcast(broadcast *userservice.Broadcast) publicapi.Broadcast {
+	return publicapi.Broadcast{
+		ID:          broadcast.ID,
+		Title:       broadcast.Title,
+		Body:        broadcast.Body,
+		Audience:    publicapi.BroadcastAudience(broadcast.Audience),
+		Status:      broadcast.Status,
+		ScheduledAt: broadcast.ScheduledAt,
+		Recipients:  broadcast.Recipients,
+		Sent:        broadcast.Sent,
+		Failed:      broadcast.Failed,
+		Muted:       broadcast.Muted,
+		CreatedAt:   broadcast.CreatedAt,
+		UpdatedAt:   broadcast.UpdatedAt,
+		StartedAt:   broadcast.StartedAt,
+		FinishedAt:  broadcast.FinishedAt,
+	}
+}
+
+func (inProcessUserClient) FindUserWebhooks(ctx context.Context, userID int) (*publicapi.WebhooksResponse, error) {
+	webhooks, err := userservice.UserWebhooks(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	res := &publicapi.WebhooksResponse{Result: true, Webhooks: make([]publicapi.Webhook, len(webhooks))}
+	for i, webhook := range webhooks {
+		res.Webhooks[i] = publicapi.Webhook(webhook)
+	}
+	return res, nil
+}
+
+func (inProcessUserClient) CreateUserWebhook(ctx context.Context, userID int, webhookByte []byte) (*publicapi.WebhookResponse, error) {
+	var create userservice.WebhookCreate
+	if err := json.Unmarshal(webhookByte, &create); err != nil {
+		return nil, err
+	}
+
+	webhook, err := userservice.CreateWebhook(ctx, userID, create)
+	switch {
+	case errors.Is(err, apperror.ErrNotFound):
+		return nil, publicapi.ErrUserNotFound
+	case errors.Is(err, apperror.ErrValidation):
+		return nil, publicapi.ErrWebhookInvalid
+	case errors.Is(err, apperror.ErrConflict):
+		return nil, publicapi.ErrWebhookLimit
+	case err != nil:
+		return nil, err
+	}
+
+	return &publicapi.WebhookResponse{Result: true, Webhook: publicapi.Webhook(*webhook)}, nil
+}
+
+func (inProcessUserClient) DeleteUserWebhook(ctx context.Context, userID, webhookID int) error {
+	err := userservice.DeleteWebhook(ctx, userID, webhookID)
+	if errors.Is(err, apperror.ErrNotFound) {
+		return publicapi.ErrWebhookNotFound
+	}
+	return err
+}
+
+func (inProcessUserClient) FindWebhookDeliveries(ctx context.Context, userID, webhookID int, status string, limit int) (*publicapi.WebhookDeliveriesResponse, error) {
+	deliveries, err := userservice.WebhookDeliveries(ctx, userID, webhookID, status, limit)
+	if err != nil {
+		if errors.Is(err, apperror.ErrNotFound) {
+			return nil, publicapi.ErrWebhookNotFound
+		}
+		return nil, err
+	}
+
+	res := &publicapi.WebhookDeliveriesResponse{Result: true, Deliveries: make([]publicapi.WebhookDelivery, len(deliveries))}
+	for i, delivery := range deliveries {
+		res.Deliveries[i] = publicapi.WebhookDelivery(delivery)
+	}
+	return res, nil
+}
+
+func (inProcessUserClient) PublishWebhookEvent(ctx context.Context, eventByte []byte) error {
+	var event events.Event
+	if err := json.Unmarshal(eventByte, &event); err != nil {
+		return err
+	}
+
+	_, err := userservice.PublishWebhookEvent(ctx, event)
+	return err
+}
+
+func toPolicies(policies []userservice.PolicyVersion) []publicapi.PolicyVersion {
+	res := make([]publicapi.PolicyVersion, len(policies))
+	for i, policy := range policies {
+		res[i] = publicapi.PolicyVersion(policy)
+	}
+	return res
+}
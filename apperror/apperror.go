@@ -0,0 +1,202 @@
+// Package apperror define the error kinds returned by the usecase layers and the JSON envelope
+// {"error": {"code": "...", "message": "..."}} every service answers failures with.
+package apperror
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/go-playground/validator/v10"
+)
+
+// kinds of domain errors, match with errors.Is
+var (
+	ErrNotFound   = errors.New("not found")
+	ErrValidation = errors.New("validation failed")
+	ErrConflict   = errors.New("conflict")
+	ErrUpstream   = errors.New("upstream service failed")
+)
+
+// Error is a domain error of Kind with a Message safe to return to clients, Err is the cause kept for logs
+type Error struct {
+	Kind    error
+	Message string
+	Err     error
+}
+
+func (e *Error) Error() string {
+	if e.Err != nil {
+		return e.Message + ": " + e.Err.Error()
+	}
+	return e.Message
+}
+
+func (e *Error) Unwrap() []error {
+	return []error{e.Kind, e.Err}
+}
+
+func NotFound(message string) *Error {
+	return &Error{Kind: ErrNotFound, Message: message}
+}
+
+func Validation(message string) *Error {
+	return &Error{Kind: ErrValidation, Message: message}
+}
+
+func Conflict(message string) *Error {
+	return &Error{Kind: ErrConflict, Message: message}
+}
+
+// Upstream error of a failed call to another service, cause is not shown to clients
+func Upstream(message string, cause error) *Error {
+	return &Error{Kind: ErrUpstream, Message: message, Err: cause}
+}
+
+// Envelope body of every error response
+type Envelope struct {
+	Error Detail `json:"error"`
+}
+
+type Detail struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+	// invalid fields of a request body, only on 422
+	Fields []FieldError `json:"fields,omitempty"`
+}
+
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// NewDetail error detail with the code of status, for responses carrying more fields than the envelope
+func NewDetail(status int, message string) Detail {
+	return Detail{Code: Code(status), Message: message}
+}
+
+// Status http status of err, 504 when a deadline of the request ran out and 500 when err is not a domain error
+func Status(err error) int {
+	switch {
+	case errors.Is(err, context.DeadlineExceeded):
+		return http.StatusGatewayTimeout
+	case errors.Is(err, ErrNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, ErrValidation):
+		return http.StatusBadRequest
+	case errors.Is(err, ErrConflict):
+		return http.StatusConflict
+	case errors.Is(err, ErrUpstream):
+		return http.StatusBadGateway
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// Code machine readable code of status, e.g. not_found or too_many_requests
+func Code(status int) string {
+	switch status {
+	case http.StatusBadRequest, http.StatusUnprocessableEntity:
+		return "validation_error"
+	case http.StatusNotFound:
+		return "not_found"
+	case http.StatusConflict:
+		return "conflict"
+	case http.StatusBadGateway, http.StatusGatewayTimeout:
+		return "upstream_error"
+	case http.StatusInternalServerError:
+		return "internal_error"
+	}
+
+	text := http.StatusText(status)
+	if text == "" {
+		return "error"
+	}
+	return strings.ReplaceAll(strings.ToLower(strings.ReplaceAll(text, "-", " ")), " ", "_")
+}
+
+// JSON answer status with message in the envelope
+func JSON(c *gin.Context, status int, message string) {
+	c.JSON(status, Envelope{Error: NewDetail(status, message)})
+}
+
+// Abort stop the chain and answer status with message in the envelope, for middlewares
+func Abort(c *gin.Context, status int, message string) {
+	c.AbortWithStatusJSON(status, Envelope{Error: NewDetail(status, message)})
+}
+
+// Respond answer err with the status of its kind, internal errors hide their message
+func Respond(c *gin.Context, err error) {
+	var appErr *Error
+	if !errors.As(err, &appErr) || appErr.Kind == nil {
+		if errors.Is(err, context.DeadlineExceeded) {
+			JSON(c, http.StatusGatewayTimeout, "Request timed out")
+			return
+		}
+		JSON(c, http.StatusInternalServerError, "Internal Server Error")
+		return
+	}
+
+	JSON(c, Status(appErr), appErr.Message)
+}
+
+// RegisterValidators name fields by their json or form tag in validation errors and add the notblank tag,
+// call once before the router serves requests
+func RegisterValidators() {
+	engine, ok := binding.Validator.Engine().(*validator.Validate)
+	if !ok {
+		return
+	}
+
+	engine.RegisterTagNameFunc(func(field reflect.StructField) string {
+		for _, tag := range []string{"json", "form"} {
+			if name, _, _ := strings.Cut(field.Tag.Get(tag), ","); name != "" && name != "-" {
+				return name
+			}
+		}
+		return field.Name
+	})
+	engine.RegisterValidation("notblank", func(fl validator.FieldLevel) bool {
+		return strings.TrimSpace(fl.Field().String()) != ""
+	})
+}
+
+// RespondBinding answer a ShouldBind error, 422 with every invalid field when the body failed
+// its binding tags and 400 when it could not be parsed at all
+func RespondBinding(c *gin.Context, err error) {
+	var invalid validator.ValidationErrors
+	if !errors.As(err, &invalid) {
+		JSON(c, http.StatusBadRequest, "Invalid body request")
+		return
+	}
+
+	detail := NewDetail(http.StatusUnprocessableEntity, "Validation failed")
+	for _, field := range invalid {
+		detail.Fields = append(detail.Fields, FieldError{Field: field.Field(), Message: fieldMessage(field)})
+	}
+	c.JSON(http.StatusUnprocessableEntity, Envelope{Error: detail})
+}
+
+func fieldMessage(field validator.FieldError) string {
+	switch field.Tag() {
+	case "required":
+		return "is required"
+	case "notblank":
+		return "must not be blank"
+	case "oneof":
+		return "must be one of: " + strings.ReplaceAll(field.Param(), " ", ", ")
+	case "gt":
+		return "must be greater than " + field.Param()
+	case "gte", "min":
+		return "must be at least " + field.Param()
+	case "lte", "max":
+		return "must be at most " + field.Param()
+	default:
+		return fmt.Sprintf("is invalid (%s)", field.Tag())
+	}
+}
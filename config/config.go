@@ -0,0 +1,143 @@
+// Package config read service settings from environment variables with defaults,
+// optionally seeded by a flat YAML file set on CONFIG_FILE. Environment variables
+// always win over the file so containers can override single values.
+package config
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+type Config struct {
+	file map[string]string
+}
+
+// Load read the YAML file on CONFIG_FILE when set, keys are matched case insensitive to env var names
+func Load() (*Config, error) {
+	cfg := &Config{file: map[string]string{}}
+
+	path := os.Getenv("CONFIG_FILE")
+	if path == "" {
+		return cfg, nil
+	}
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("config: read %s: %w", path, err)
+	}
+
+	values := map[string]interface{}{}
+	if err := yaml.Unmarshal(content, &values); err != nil {
+		return nil, fmt.Errorf("config: parse %s: %w", path, err)
+	}
+
+	for key, val := range values {
+		if val == nil {
+			continue
+		}
+		// lists are kept comma separated like env vars
+		if items, ok := val.([]interface{}); ok {
+			parts := make([]string, len(items))
+			for i, item := range items {
+				parts[i] = fmt.Sprint(item)
+			}
+			cfg.file[strings.ToUpper(key)] = strings.Join(parts, ",")
+			continue
+		}
+		cfg.file[strings.ToUpper(key)] = fmt.Sprint(val)
+	}
+
+	return cfg, nil
+}
+
+// MustLoad is Load that panics on error, used to initialize package level settings
+func MustLoad() *Config {
+	cfg, err := Load()
+	if err != nil {
+		panic(err)
+	}
+
+	return cfg
+}
+
+// Lookup get raw value from env var first then config file
+func (c *Config) Lookup(key string) (string, bool) {
+	if val, ok := os.LookupEnv(key); ok && val != "" {
+		return val, true
+	}
+
+	val, ok := c.file[key]
+	return val, ok && val != ""
+}
+
+func (c *Config) String(key, def string) string {
+	if val, ok := c.Lookup(key); ok {
+		return val
+	}
+
+	return def
+}
+
+func (c *Config) Int(key string, def int) int {
+	val, ok := c.Lookup(key)
+	if !ok {
+		return def
+	}
+
+	parsed, err := strconv.Atoi(val)
+	if err != nil {
+		panic(fmt.Sprintf("config: invalid int %s=%q", key, val))
+	}
+
+	return parsed
+}
+
+func (c *Config) Bool(key string, def bool) bool {
+	val, ok := c.Lookup(key)
+	if !ok {
+		return def
+	}
+
+	parsed, err := strconv.ParseBool(val)
+	if err != nil {
+		panic(fmt.Sprintf("config: invalid bool %s=%q", key, val))
+	}
+
+	return parsed
+}
+
+func (c *Config) Duration(key string, def time.Duration) time.Duration {
+	val, ok := c.Lookup(key)
+	if !ok {
+		return def
+	}
+
+	parsed, err := time.ParseDuration(val)
+	if err != nil {
+		panic(fmt.Sprintf("config: invalid duration %s=%q", key, val))
+	}
+
+	return parsed
+}
+
+// List split comma separated value, empty when not set
+func (c *Config) List(key string) []string {
+	val, ok := c.Lookup(key)
+	if !ok {
+		return nil
+	}
+
+	var items []string
+	for _, item := range strings.Split(val, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+
+	return items
+}
@@ -0,0 +1,37 @@
+package config
+
+import (
+	"net"
+	"os"
+)
+
+// InContainer report whether the service runs in a container, CONTAINER when set otherwise detected from the
+// files docker and podman create and the variables set by podman, systemd-nspawn and kubernetes
+func (c *Config) InContainer() bool {
+	if _, ok := c.Lookup("CONTAINER"); ok {
+		return c.Bool("CONTAINER", false)
+	}
+
+	for _, path := range []string{"/.dockerenv", "/run/.containerenv"} {
+		if _, err := os.Stat(path); err == nil {
+			return true
+		}
+	}
+
+	return os.Getenv("container") != "" || os.Getenv("KUBERNETES_SERVICE_HOST") != ""
+}
+
+// BindAddress host to listen on, BIND_ADDRESS when set otherwise 0.0.0.0 in a container and every interface outside
+func (c *Config) BindAddress() string {
+	def := ""
+	if c.InContainer() {
+		def = "0.0.0.0"
+	}
+
+	return c.String("BIND_ADDRESS", def)
+}
+
+// ListenAddr address of the http server, port is HTTP_PORT falling back to PORT set by PaaS platforms then defPort
+func (c *Config) ListenAddr(defPort string) string {
+	return net.JoinHostPort(c.BindAddress(), c.String("HTTP_PORT", c.String("PORT", defPort)))
+}
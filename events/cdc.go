@@ -0,0 +1,495 @@
+package events
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+	"time"
+
+	"config"
+)
+
+const (
+	ChangeInsert = "insert"
+	ChangeUpdate = "update"
+	ChangeDelete = "delete"
+)
+
+// Change of one row read from the log of a database. Old is the row before an update or delete and New the row
+// after an insert or update, nil otherwise. Columns are strings, json.Number, bool or nil
+type Change struct {
+	// Position of the change in the log, unique, the id of its event is derived from it
+	Position string
+	// Commit position of the transaction of the change, acknowledged once its event is written
+	Commit string
+	Table  string
+	Op     string
+	Old    map[string]any
+	New    map[string]any
+	// CommittedAt in microseconds, the occurred_at of its event
+	CommittedAt int64
+}
+
+// ChangeSource log of the row changes of a database
+type ChangeSource interface {
+	// Changes up to about limit changes not acknowledged yet, oldest first, whole transactions only
+	Changes(ctx context.Context, limit int) ([]Change, error)
+	// Ack the changes up to the transaction committed at commit, they are not read again
+	Ack(ctx context.Context, commit string) error
+}
+
+// ChangeMapper event of a change, false for a change making no event like the write of another table. The id and
+// occurred_at of the event are set from the change
+type ChangeMapper func(change Change) (Event, bool, error)
+
+// ChangeSink write the events of a batch of changes, to an outbox usually. A batch is read again when its Ack failed,
+// its events keep their ids so a sink skipping the ids it knows writes each event once
+type ChangeSink func(ctx context.Context, events []Event) error
+
+// CDC turn the row changes of a database into events in background, so the writes need no code of their own to
+// publish events. Changes are acknowledged only once their events are written, a failed round is read again
+type CDC struct {
+	// name of the reader in logs and in the ids of its events, the lowercase prefix of its settings
+	name   string
+	source ChangeSource
+	mapper ChangeMapper
+	sink   ChangeSink
+
+	interval  time.Duration
+	batchSize int
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+// NewCDC reading source into sink through mapper with the settings named after prefix
+//
+// <prefix>_INTERVAL wait between reads, 0 disables the reader and changes pile up in the source
+// <prefix>_BATCH_SIZE changes read per round
+func NewCDC(cfg *config.Config, prefix string, source ChangeSource, mapper ChangeMapper, sink ChangeSink) *CDC {
+	return &CDC{
+		name:      strings.ToLower(prefix),
+		source:    source,
+		mapper:    mapper,
+		sink:      sink,
+		interval:  cfg.Duration(prefix+"_INTERVAL", time.Second),
+		batchSize: max(cfg.Int(prefix+"_BATCH_SIZE", 500), 1),
+		stop:      make(chan struct{}),
+		done:      make(chan struct{}),
+	}
+}
+
+// Start reading every <prefix>_INTERVAL until Stop
+func (c *CDC) Start() {
+	if c.interval <= 0 {
+		close(c.done)
+		return
+	}
+
+	go func() {
+		defer close(c.done)
+
+		ticker := time.NewTicker(c.interval)
+		defer ticker.Stop()
+		for {
+			// a full batch means more changes are waiting, go on without waiting for the ticker
+			for c.round(context.Background()) >= c.batchSize {
+				select {
+				case <-c.stop:
+					return
+				default:
+				}
+			}
+
+			select {
+			case <-c.stop:
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// Stop wait for the running round, changes of an unfinished round are read again by the next start
+func (c *CDC) Stop(ctx context.Context) {
+	close(c.stop)
+
+	select {
+	case <-c.done:
+	case <-ctx.Done():
+		slog.WarnContext(ctx, "cdc round still running at shutdown", "cdc", c.name)
+	}
+}
+
+// read, write and acknowledge one batch, returns the count of changes read
+func (c *CDC) round(ctx context.Context) int {
+	changes, err := c.source.Changes(ctx, c.batchSize)
+	if err != nil {
+		slog.ErrorContext(ctx, "cdc error", "cdc", c.name, "error", err)
+		return 0
+	}
+	if len(changes) == 0 {
+		return 0
+	}
+
+	batch, err := c.events(changes)
+	if err != nil {
+		// skipping the change would lose its event, it blocks the reader until the mapper is fixed
+		slog.ErrorContext(ctx, "cdc error", "cdc", c.name, "error", err)
+		return 0
+	}
+
+	if len(batch) > 0 {
+		if err := c.sink(ctx, batch); err != nil {
+			slog.ErrorContext(ctx, "cdc error", "cdc", c.name, "error", err)
+			return 0
+		}
+	}
+
+	if err := c.source.Ack(ctx, changes[len(changes)-1].Commit); err != nil {
+		// the batch is read again, its events keep their ids
+		slog.ErrorContext(ctx, "cdc error", "cdc", c.name, "error", err)
+		return 0
+	}
+
+	return len(changes)
+}
+
+// events of changes, ids derived from the name of the reader and the position of their change
+func (c *CDC) events(changes []Change) ([]Event, error) {
+	var batch []Event
+	for _, change := range changes {
+		event, ok, err := c.mapper(change)
+		if err != nil {
+			return nil, fmt.Errorf("change %s of %s: %w", change.Position, change.Table, err)
+		}
+		if !ok {
+			continue
+		}
+
+		sum := sha256.Sum256([]byte(c.name + "/" + change.Position))
+		event.ID = hex.EncodeToString(sum[:16])
+		if change.CommittedAt > 0 {
+			event.OccurredAt = change.CommittedAt
+		}
+		batch = append(batch, event)
+	}
+	return batch, nil
+}
+
+// ChangeTable DDL of the table the triggers of SQLiteChangeTriggers write to, for the migrations of the database
+const ChangeTable = `CREATE TABLE IF NOT EXISTS row_changes (
+    id INTEGER NOT NULL PRIMARY KEY AUTOINCREMENT,
+    table_name TEXT NOT NULL,
+    op TEXT NOT NULL,
+    old_row TEXT,
+    new_row TEXT,
+    changed_at BIGINT NOT NULL
+)`
+
+// SQLiteChanges ChangeSource over the row_changes table filled by the triggers of SQLiteChangeTriggers. The triggers
+// write in the transaction of the change, so a rolled back write leaves no change
+type SQLiteChanges struct {
+	db *sql.DB
+}
+
+func NewSQLiteChanges(db *sql.DB) *SQLiteChanges {
+	return &SQLiteChanges{db: db}
+}
+
+// SQLiteChangeTriggers statements creating the triggers writing the insert, update and delete of table to
+// row_changes, with only columns so secrets like password hashes stay out of the change table
+func SQLiteChangeTriggers(table string, columns []string) []string {
+	row := func(alias string) string {
+		pairs := make([]string, len(columns))
+		for i, column := range columns {
+			pairs[i] = fmt.Sprintf("'%s', %s.%s", column, alias, column)
+		}
+		return "json_object(" + strings.Join(pairs, ", ") + ")"
+	}
+
+	// unix microseconds, unixepoch('subsec') needs sqlite 3.42
+	now := "CAST((julianday('now') - 2440587.5) * 86400000000 AS INTEGER)"
+	statement := func(op, event, oldRow, newRow string) string {
+		return fmt.Sprintf(`CREATE TRIGGER IF NOT EXISTS row_changes_%[1]s_%[2]s AFTER %[3]s ON %[1]s BEGIN
+    INSERT INTO row_changes (table_name, op, old_row, new_row, changed_at) VALUES ('%[1]s', '%[2]s', %[4]s, %[5]s, %[6]s);
+END`, table, op, event, oldRow, newRow, now)
+	}
+
+	return []string{
+		statement(ChangeInsert, "INSERT", "NULL", row("NEW")),
+		statement(ChangeUpdate, "UPDATE", row("OLD"), row("NEW")),
+		statement(ChangeDelete, "DELETE", row("OLD"), "NULL"),
+	}
+}
+
+// DropSQLiteChangeTriggers statements dropping the triggers of SQLiteChangeTriggers on table, so its changes are
+// no longer captured
+func DropSQLiteChangeTriggers(table string) []string {
+	var statements []string
+	for _, op := range []string{ChangeInsert, ChangeUpdate, ChangeDelete} {
+		statements = append(statements, fmt.Sprintf("DROP TRIGGER IF EXISTS row_changes_%s_%s", table, op))
+	}
+	return statements
+}
+
+// sqlite gives its writes ids in commit order, each change is a transaction of its own for the reader
+func (s *SQLiteChanges) Changes(ctx context.Context, limit int) ([]Change, error) {
+	rows, err := s.db.QueryContext(ctx, "SELECT id, table_name, op, old_row, new_row, changed_at FROM row_changes ORDER BY id LIMIT ?", limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var changes []Change
+	for rows.Next() {
+		var change Change
+		var id int64
+		var oldRow, newRow sql.NullString
+		if err := rows.Scan(&id, &change.Table, &change.Op, &oldRow, &newRow, &change.CommittedAt); err != nil {
+			return nil, err
+		}
+
+		change.Position = strconv.FormatInt(id, 10)
+		change.Commit = change.Position
+		if change.Old, err = decodeRow(oldRow); err != nil {
+			return nil, err
+		}
+		if change.New, err = decodeRow(newRow); err != nil {
+			return nil, err
+		}
+		changes = append(changes, change)
+	}
+	return changes, rows.Err()
+}
+
+// the acknowledged changes are deleted
+func (s *SQLiteChanges) Ack(ctx context.Context, commit string) error {
+	_, err := s.db.ExecContext(ctx, "DELETE FROM row_changes WHERE id <= ?", commit)
+	return err
+}
+
+func decodeRow(row sql.NullString) (map[string]any, error) {
+	if !row.Valid {
+		return nil, nil
+	}
+
+	decoder := json.NewDecoder(strings.NewReader(row.String))
+	decoder.UseNumber()
+	var columns map[string]any
+	err := decoder.Decode(&columns)
+	return columns, err
+}
+
+// PostgresChanges ChangeSource over a logical replication slot of the test_decoding plugin shipped with postgres,
+// read through the SQL functions of logical decoding so no replication connection is needed. Needs wal_level=logical
+// and a role allowed to replicate. Tables need REPLICA IDENTITY FULL for Old to hold the whole row, otherwise it
+// holds the primary key of deletes only. The slot keeps the WAL until acknowledged, one reader uses it at a time
+type PostgresChanges struct {
+	db   *sql.DB
+	slot string
+}
+
+// NewPostgresChanges over slot, created when missing. Changes are captured from the creation of the slot on
+func NewPostgresChanges(ctx context.Context, db *sql.DB, slot string) (*PostgresChanges, error) {
+	var exists bool
+	if err := db.QueryRowContext(ctx, "SELECT EXISTS (SELECT 1 FROM pg_replication_slots WHERE slot_name = $1)", slot).Scan(&exists); err != nil {
+		return nil, err
+	}
+	if !exists {
+		if _, err := db.ExecContext(ctx, "SELECT pg_create_logical_replication_slot($1, 'test_decoding')", slot); err != nil {
+			return nil, fmt.Errorf("create replication slot %s: %w", slot, err)
+		}
+	}
+
+	return &PostgresChanges{db: db, slot: slot}, nil
+}
+
+// changes are peeked, they stay in the slot until Ack
+func (p *PostgresChanges) Changes(ctx context.Context, limit int) ([]Change, error) {
+	rows, err := p.db.QueryContext(ctx, "SELECT lsn::text, data FROM pg_logical_slot_peek_changes($1, NULL, $2, 'include-timestamp', '1', 'include-xids', '0', 'skip-empty-xacts', '1')",
+		p.slot, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var changes, open []Change
+	for rows.Next() {
+		var lsn, data string
+		if err := rows.Scan(&lsn, &data); err != nil {
+			return nil, err
+		}
+
+		switch {
+		case strings.HasPrefix(data, "BEGIN"):
+			open = nil
+		case strings.HasPrefix(data, "COMMIT"):
+			committedAt := commitTime(data)
+			for _, change := range open {
+				change.Commit = lsn
+				change.CommittedAt = committedAt
+				changes = append(changes, change)
+			}
+			open = nil
+		default:
+			change, err := parseTestDecoding(data)
+			if err != nil {
+				return nil, fmt.Errorf("change at %s: %w", lsn, err)
+			}
+			change.Position = lsn
+			open = append(open, change)
+		}
+	}
+	return changes, rows.Err()
+}
+
+// the slot moves past commit, postgres may then recycle the WAL before it
+func (p *PostgresChanges) Ack(ctx context.Context, commit string) error {
+	_, err := p.db.ExecContext(ctx, "SELECT pg_replication_slot_advance($1, $2::pg_lsn)", p.slot, commit)
+	return err
+}
+
+// time of a "COMMIT (at 2026-10-16 10:10:27.208590+00)" line in microseconds, now when it has none
+func commitTime(data string) int64 {
+	_, at, ok := strings.Cut(data, "(at ")
+	if ok {
+		at = strings.TrimSuffix(at, ")")
+		for _, layout := range []string{"2006-01-02 15:04:05.999999-07", "2006-01-02 15:04:05.999999-07:00"} {
+			if t, err := time.Parse(layout, at); err == nil {
+				return t.UnixMicro()
+			}
+		}
+	}
+	return time.Now().UnixMicro()
+}
+
+var errTestDecoding = errors.New("unexpected test_decoding output")
+
+// change of a test_decoding line like
+// table public.users: UPDATE: old-key: id[integer]:1 name[text]:'Ann' new-tuple: id[integer]:1 name[text]:'Anne'
+// Without REPLICA IDENTITY FULL updates have no old-key and deletes only the key columns
+func parseTestDecoding(data string) (Change, error) {
+	var change Change
+
+	rest, ok := strings.CutPrefix(data, "table ")
+	if !ok {
+		return change, fmt.Errorf("%w: %q", errTestDecoding, data)
+	}
+	table, rest, ok := strings.Cut(rest, ": ")
+	if !ok {
+		return change, fmt.Errorf("%w: %q", errTestDecoding, data)
+	}
+	if i := strings.LastIndex(table, "."); i >= 0 {
+		table = table[i+1:]
+	}
+	change.Table = strings.Trim(table, `"`)
+
+	op, rest, _ := strings.Cut(rest, ":")
+	rest = strings.TrimPrefix(rest, " ")
+	switch op {
+	case "INSERT":
+		change.Op = ChangeInsert
+	case "UPDATE":
+		change.Op = ChangeUpdate
+	case "DELETE":
+		change.Op = ChangeDelete
+	default:
+		// TRUNCATE and messages make no change of a row
+		return change, fmt.Errorf("%w: %q", errTestDecoding, data)
+	}
+
+	if rest == "(no-tuple-data)" {
+		return change, nil
+	}
+
+	var oldRow string
+	if after, ok := strings.CutPrefix(rest, "old-key: "); ok {
+		oldRow, rest, ok = strings.Cut(after, " new-tuple: ")
+		if !ok {
+			return change, fmt.Errorf("%w: %q", errTestDecoding, data)
+		}
+	}
+
+	row, err := parseTestDecodingColumns(rest)
+	if err != nil {
+		return change, fmt.Errorf("%w: %q", err, data)
+	}
+	switch change.Op {
+	case ChangeDelete:
+		change.Old = row
+	default:
+		change.New = row
+	}
+	if oldRow != "" {
+		if change.Old, err = parseTestDecodingColumns(oldRow); err != nil {
+			return change, fmt.Errorf("%w: %q", err, data)
+		}
+	}
+	return change, nil
+}
+
+// columns written as name[type]:value, text in single quotes doubled inside it and the others bare
+func parseTestDecodingColumns(s string) (map[string]any, error) {
+	row := map[string]any{}
+	for s != "" {
+		open := strings.IndexByte(s, '[')
+		if open < 1 {
+			return nil, errTestDecoding
+		}
+		name := strings.Trim(s[:open], `"`)
+		closing := strings.Index(s[open:], "]:")
+		if closing < 0 {
+			return nil, errTestDecoding
+		}
+		kind := s[open+1 : open+closing]
+		s = s[open+closing+2:]
+
+		var raw string
+		quoted := strings.HasPrefix(s, "'")
+		if quoted {
+			var b bytes.Buffer
+			i := 1
+			for ; i < len(s); i++ {
+				if s[i] == '\'' {
+					if i+1 < len(s) && s[i+1] == '\'' {
+						b.WriteByte('\'')
+						i++
+						continue
+					}
+					break
+				}
+				b.WriteByte(s[i])
+			}
+			if i >= len(s) {
+				return nil, errTestDecoding
+			}
+			raw, s = b.String(), s[i+1:]
+		} else {
+			raw, s, _ = strings.Cut(s, " ")
+		}
+		s = strings.TrimPrefix(s, " ")
+
+		switch {
+		case quoted:
+			row[name] = raw
+		case raw == "null":
+			row[name] = nil
+		case raw == "unchanged-toast-datum":
+			// large values not changed by an update are not in the log, left out
+		case kind == "boolean":
+			row[name] = raw == "true"
+		default:
+			row[name] = json.Number(raw)
+		}
+	}
+	return row, nil
+}
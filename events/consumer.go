@@ -0,0 +1,409 @@
+package events
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+
+	"config"
+
+	"github.com/nats-io/nats.go"
+)
+
+// Handler process one event for a consumer, an error makes the consumer retry it
+type Handler func(ctx context.Context, event Event) error
+
+// Processed ids of the events each consumer processed, so a redelivered event is skipped: published again by a
+// relay after its lease, by a replay or once its dead letter is requeued
+type Processed interface {
+	// Once run fn unless consumer processed eventID before, and record eventID as processed once fn succeeded.
+	// false when eventID was processed before and fn did not run
+	Once(ctx context.Context, consumer, eventID string, fn func(ctx context.Context) error) (bool, error)
+	// Purge forget the events processed before, they are not delivered again after the outbox retention
+	Purge(ctx context.Context, processedBefore time.Time) (int, error)
+}
+
+const (
+	ConsumeProcessed = "processed"
+	ConsumeDuplicate = "duplicate"
+	ConsumeRetried   = "retried"
+	ConsumeFailed    = "failed"
+)
+
+// ErrConsumerStopped event delivered to a consumer stopping or stopped, it was not processed
+var ErrConsumerStopped = errors.New("consumer stopped")
+
+// Consumer process the events delivered to it once each, the events of one key in the order they were delivered and
+// those of different keys in parallel. A failed event is retried with an exponential backoff while the next events
+// of its key wait, and given up after <prefix>_MAX_ATTEMPTS. Internal subscribers like a read model or an indexer
+// wrap their handler in one
+type Consumer struct {
+	// name of the consumer, the key of its processed events and its replay group
+	name      string
+	processed Processed
+	handler   Handler
+
+	maxAttempts     int
+	retryBackoff    time.Duration
+	maxRetryBackoff time.Duration
+	retention       time.Duration
+
+	// Observe called with the type and result of every delivered event, ConsumeProcessed, ConsumeDuplicate,
+	// ConsumeRetried or ConsumeFailed, to count them. Set before Start
+	Observe func(eventType, result string)
+
+	queues []chan delivery
+	// held by Deliver while queueing, so Stop closes the queues once no event is being queued
+	mu        sync.RWMutex
+	stopped   bool
+	lastPurge time.Time
+	purgeMu   sync.Mutex
+	ctx       context.Context
+	cancel    context.CancelFunc
+	wg        sync.WaitGroup
+}
+
+type delivery struct {
+	event Event
+	done  func(error)
+}
+
+// NewConsumer named name over processed, calling handler for every event not processed yet, with the settings named
+// after prefix
+//
+// <prefix>_WORKERS keys processed in parallel
+// <prefix>_QUEUE_SIZE events waiting per worker before Deliver blocks
+// <prefix>_MAX_ATTEMPTS handler attempts of an event before it is given up
+// <prefix>_RETRY_BACKOFF wait before the first retry, doubled on each attempt up to <prefix>_MAX_RETRY_BACKOFF
+// <prefix>_DEDUP_RETENTION how long processed event ids are kept, longer than the outbox retention so replays are
+// deduped too. 0 keeps them
+func NewConsumer(cfg *config.Config, prefix, name string, processed Processed, handler Handler) *Consumer {
+	ctx, cancel := context.WithCancel(context.Background())
+	c := &Consumer{
+		name:            name,
+		processed:       processed,
+		handler:         handler,
+		maxAttempts:     max(cfg.Int(prefix+"_MAX_ATTEMPTS", 5), 1),
+		retryBackoff:    cfg.Duration(prefix+"_RETRY_BACKOFF", time.Second),
+		maxRetryBackoff: cfg.Duration(prefix+"_MAX_RETRY_BACKOFF", time.Minute),
+		retention:       cfg.Duration(prefix+"_DEDUP_RETENTION", 14*24*time.Hour),
+		ctx:             ctx,
+		cancel:          cancel,
+	}
+
+	queueSize := cfg.Int(prefix+"_QUEUE_SIZE", 100)
+	for i := 0; i < max(cfg.Int(prefix+"_WORKERS", 4), 1); i++ {
+		c.queues = append(c.queues, make(chan delivery, queueSize))
+	}
+	return c
+}
+
+// Start the workers processing the delivered events until Stop
+func (c *Consumer) Start() {
+	for _, queue := range c.queues {
+		c.wg.Add(1)
+		go func() {
+			defer c.wg.Done()
+			for d := range queue {
+				d.done(c.Process(c.ctx, d.event))
+			}
+		}()
+	}
+}
+
+// Deliver queue event on the worker of its key, done is called with nil once it is processed or skipped as a
+// duplicate, with the last error of the handler once out of attempts and ErrConsumerStopped once stopped. Blocks while the queue of the worker is full,
+// so a slow consumer slows its subscription down instead of buffering without bound
+func (c *Consumer) Deliver(event Event, done func(error)) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if c.stopped {
+		done(ErrConsumerStopped)
+		return
+	}
+
+	// events without key have no order to keep
+	key := event.Key
+	if key == "" {
+		key = event.ID
+	}
+	h := fnv.New32a()
+	h.Write([]byte(key))
+
+	select {
+	case c.queues[h.Sum32()%uint32(len(c.queues))] <- delivery{event: event, done: done}:
+	case <-c.ctx.Done():
+		done(ErrConsumerStopped)
+	}
+}
+
+// Stop the workers once the event each is processing is done, the events still queued and delivered from now on are
+// answered with ErrConsumerStopped
+func (c *Consumer) Stop(ctx context.Context) {
+	c.cancel()
+	c.mu.Lock()
+	c.stopped = true
+	c.mu.Unlock()
+	for _, queue := range c.queues {
+		close(queue)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		c.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-ctx.Done():
+		slog.WarnContext(ctx, "consumer still processing at shutdown", "consumer", c.name)
+	}
+}
+
+// Process event on the calling goroutine: skipped when processed before, else handled with retries. Events of
+// one key must not be processed concurrently, Deliver takes care of it
+func (c *Consumer) Process(ctx context.Context, event Event) error {
+	if ctx.Err() != nil {
+		return ErrConsumerStopped
+	}
+	c.purge(ctx)
+
+	for attempts := 1; ; attempts++ {
+		ran, err := c.processed.Once(ctx, c.name, event.ID, func(ctx context.Context) error {
+			return c.handler(ctx, event)
+		})
+		switch {
+		case err == nil && !ran:
+			c.observe(event.Type, ConsumeDuplicate)
+			return nil
+		case err == nil:
+			c.observe(event.Type, ConsumeProcessed)
+			return nil
+		case attempts >= c.maxAttempts:
+			slog.ErrorContext(ctx, "event failed", "consumer", c.name, "error", err, "event_id", event.ID, "event", event.Type, "attempts", attempts)
+			c.observe(event.Type, ConsumeFailed)
+			return err
+		}
+
+		slog.WarnContext(ctx, "event retried", "consumer", c.name, "error", err, "event_id", event.ID, "event", event.Type, "attempts", attempts)
+		c.observe(event.Type, ConsumeRetried)
+		select {
+		case <-time.After(c.backoff(attempts)):
+		case <-ctx.Done():
+			return ErrConsumerStopped
+		}
+	}
+}
+
+// wait before the retry following attempts failed attempts
+func (c *Consumer) backoff(attempts int) time.Duration {
+	wait := c.retryBackoff
+	for i := 1; i < attempts && wait < c.maxRetryBackoff; i++ {
+		wait *= 2
+	}
+	return min(wait, c.maxRetryBackoff)
+}
+
+// forget processed events past <prefix>_DEDUP_RETENTION, at most once an hour over all workers
+func (c *Consumer) purge(ctx context.Context) {
+	if c.retention <= 0 || !c.purgeMu.TryLock() {
+		return
+	}
+	defer c.purgeMu.Unlock()
+	if time.Since(c.lastPurge) < time.Hour {
+		return
+	}
+	c.lastPurge = time.Now()
+
+	n, err := c.processed.Purge(ctx, time.Now().Add(-c.retention))
+	if err != nil {
+		slog.ErrorContext(ctx, "consumer error", "consumer", c.name, "error", err)
+		return
+	}
+	if n > 0 {
+		slog.InfoContext(ctx, "consumer purged", "consumer", c.name, "events", n)
+	}
+}
+
+func (c *Consumer) observe(eventType, result string) {
+	if c.Observe != nil {
+		c.Observe(eventType, result)
+	}
+}
+
+// ProcessedEventsTable DDL of the table of SQLProcessed, for the migrations of the consumer database. Valid on
+// sqlite and postgres
+const ProcessedEventsTable = `CREATE TABLE IF NOT EXISTS processed_events (
+    consumer TEXT NOT NULL,
+    event_id TEXT NOT NULL,
+    processed_at BIGINT NOT NULL,
+    PRIMARY KEY (consumer, event_id)
+)`
+
+// SQLProcessed over the processed_events table of the database of the consumer. The event id is inserted in the
+// transaction fn runs in, so a handler writing to the same database through Tx(ctx) commits its writes and the event
+// id together: an event is processed exactly once. A redelivery arriving while the first is processed waits on the
+// row and is skipped once it committed
+type SQLProcessed struct {
+	db       *sql.DB
+	postgres bool
+}
+
+// NewSQLProcessed over db opened with driver, postgres binds $1, $2... and every other driver ?
+func NewSQLProcessed(db *sql.DB, driver string) *SQLProcessed {
+	return &SQLProcessed{db: db, postgres: driver == "postgres" || driver == "pgx"}
+}
+
+type txKey struct{}
+
+// Tx transaction of the event processed by SQLProcessed, nil outside of it
+func Tx(ctx context.Context) *sql.Tx {
+	tx, _ := ctx.Value(txKey{}).(*sql.Tx)
+	return tx
+}
+
+func (p *SQLProcessed) Once(ctx context.Context, consumer, eventID string, fn func(ctx context.Context) error) (bool, error) {
+	tx, err := p.db.BeginTx(ctx, nil)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.ExecContext(ctx, p.rebind("INSERT INTO processed_events (consumer, event_id, processed_at) VALUES (?, ?, ?) ON CONFLICT (consumer, event_id) DO NOTHING"),
+		consumer, eventID, time.Now().UnixMicro())
+	if err != nil {
+		return false, err
+	}
+	if inserted, err := result.RowsAffected(); err != nil || inserted == 0 {
+		return false, err
+	}
+
+	if err := fn(context.WithValue(ctx, txKey{}, tx)); err != nil {
+		return false, err
+	}
+	return true, tx.Commit()
+}
+
+func (p *SQLProcessed) Purge(ctx context.Context, processedBefore time.Time) (int, error) {
+	result, err := p.db.ExecContext(ctx, p.rebind("DELETE FROM processed_events WHERE processed_at < ?"), processedBefore.UnixMicro())
+	if err != nil {
+		return 0, err
+	}
+	n, err := result.RowsAffected()
+	return int(n), err
+}
+
+// ? placeholders of query as $n for postgres
+func (p *SQLProcessed) rebind(query string) string {
+	if !p.postgres {
+		return query
+	}
+
+	var b strings.Builder
+	n := 0
+	for _, r := range query {
+		if r == '?' {
+			n++
+			fmt.Fprintf(&b, "$%d", n)
+			continue
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// MemoryProcessed in memory, for consumers without database whose handler is idempotent on its own: events are
+// deduped while the process lives
+type MemoryProcessed struct {
+	mu        sync.Mutex
+	processed map[string]time.Time
+}
+
+func NewMemoryProcessed() *MemoryProcessed {
+	return &MemoryProcessed{processed: map[string]time.Time{}}
+}
+
+func (p *MemoryProcessed) Once(ctx context.Context, consumer, eventID string, fn func(ctx context.Context) error) (bool, error) {
+	key := consumer + "\x00" + eventID
+	p.mu.Lock()
+	_, seen := p.processed[key]
+	p.mu.Unlock()
+	if seen {
+		return false, nil
+	}
+
+	if err := fn(ctx); err != nil {
+		return false, err
+	}
+
+	p.mu.Lock()
+	p.processed[key] = time.Now()
+	p.mu.Unlock()
+	return true, nil
+}
+
+func (p *MemoryProcessed) Purge(ctx context.Context, processedBefore time.Time) (int, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	n := 0
+	for key, at := range p.processed {
+		if at.Before(processedBefore) {
+			delete(p.processed, key)
+			n++
+		}
+	}
+	return n, nil
+}
+
+// SubscribeNATS deliver to consumer the events published on EVENTS_NATS_URL, live ones and those replayed to its
+// group, see NewPublisher. Instances of one consumer share its events as a queue group, which spreads the events of
+// a key over them, so run a single instance where the order per key matters. Core NATS does not redeliver, an event
+// out of attempts is logged and dropped
+func SubscribeNATS(cfg *config.Config, consumer *Consumer) (io.Closer, error) {
+	conn, err := nats.Connect(cfg.String("EVENTS_NATS_URL", nats.DefaultURL), nats.Name(consumer.name), nats.MaxReconnects(-1))
+	if err != nil {
+		return nil, err
+	}
+	prefix := cfg.String("EVENTS_NATS_SUBJECT_PREFIX", "events")
+
+	handle := func(msg *nats.Msg) {
+		var event Event
+		if err := json.Unmarshal(msg.Data, &event); err != nil {
+			slog.Error("consumer error", "consumer", consumer.name, "error", err, "subject", msg.Subject)
+			return
+		}
+		event.Key = msg.Header.Get("Event-Key")
+		consumer.Deliver(event, func(err error) {
+			if err != nil {
+				slog.Error("event dropped", "consumer", consumer.name, "error", err, "event_id", event.ID, "event", event.Type)
+			}
+		})
+	}
+
+	for _, subject := range []string{prefix + ".user.*", prefix + ".listing.*", prefix + ".replay." + consumer.name + ".>"} {
+		if _, err := conn.QueueSubscribe(subject, consumer.name, handle); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+	return natsSubscription{conn}, nil
+}
+
+type natsSubscription struct {
+	conn *nats.Conn
+}
+
+// stop receiving events, those received are delivered to the consumer first
+func (s natsSubscription) Close() error {
+	return s.conn.Drain()
+}
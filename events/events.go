@@ -0,0 +1,91 @@
+// Package events deliver the events of user and listing writes to a message broker. Services write each event to
+// an outbox table in the same transaction as the entity it describes, and a Relay publishes the outbox, so an
+// event is never lost while the broker is down and never sent for a write that was rolled back.
+package events
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"strconv"
+	"time"
+)
+
+const (
+	UserCreated    = "user.created"
+	UserUpdated    = "user.updated"
+	UserDeleted    = "user.deleted"
+	ListingCreated = "listing.created"
+	ListingUpdated = "listing.updated"
+	ListingDeleted = "listing.deleted"
+)
+
+// Types of all events, in the order of the docs
+var Types = []string{UserCreated, UserUpdated, UserDeleted, ListingCreated, ListingUpdated, ListingDeleted}
+
+// Event of a write, Data is the user or listing after the write, or only its id once deleted. OccurredAt is in
+// microseconds like created_at. Version is the version of the schema of Data, see SchemaOf, missing from events
+// written before versioning which are of version 1
+type Event struct {
+	ID         string          `json:"id"`
+	Type       string          `json:"type"`
+	Version    int             `json:"version,omitempty"`
+	OccurredAt int64           `json:"occurred_at"`
+	RequestID  string          `json:"request_id,omitempty"`
+	Data       json.RawMessage `json:"data"`
+
+	// Key of the user or listing, e.g. listing:1, brokers keep the events of one key in order. Sent next to the
+	// event, not in it
+	Key string `json:"-"`
+}
+
+// Deleted data of a *.deleted event
+type Deleted struct {
+	ID int `json:"id"`
+}
+
+// New event of eventType about the entity of key, with a fresh id and the current version of its schema
+func New(eventType, key, requestID string, data any) (Event, error) {
+	body, err := json.Marshal(data)
+	if err != nil {
+		return Event{}, err
+	}
+
+	id, err := NewID()
+	if err != nil {
+		return Event{}, err
+	}
+
+	return Event{
+		ID:         id,
+		Type:       eventType,
+		Version:    SchemaVersion(eventType),
+		OccurredAt: time.Now().UnixMicro(),
+		RequestID:  requestID,
+		Data:       body,
+		Key:        key,
+	}, nil
+}
+
+// NewID random event id, 16 bytes as hex
+func NewID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(b), nil
+}
+
+// versioned event, events written before versioning are of version 1
+func versioned(event Event) Event {
+	if event.Version == 0 {
+		event.Version = 1
+	}
+	return event
+}
+
+// Key of the entity of the given kind, user or listing, and id
+func Key(entity string, id int) string {
+	return entity + ":" + strconv.Itoa(id)
+}
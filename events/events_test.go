@@ -0,0 +1,571 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"maps"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"config"
+)
+
+func TestKafkaRESTPublisher(t *testing.T) {
+	tests := []struct {
+		name    string
+		status  int
+		reply   string
+		wantErr bool
+	}{
+		{name: "produced", status: http.StatusOK, reply: `{"offsets": [{"partition": 0, "offset": 12, "error_code": null, "error": null}]}`},
+		{name: "record refused", status: http.StatusOK, reply: `{"offsets": [{"error_code": 50002, "error": "Kafka error"}]}`, wantErr: true},
+		{name: "unknown topic", status: http.StatusNotFound, reply: `{"error_code": 40401, "message": "Topic not found."}`, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got kafkaRecords
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path != "/topics/events" || r.Header.Get("Content-Type") != "application/vnd.kafka.json.v2+json" {
+					t.Errorf("request %s %s, want the v2 json produce of topic events", r.URL.Path, r.Header.Get("Content-Type"))
+				}
+				if err := json.NewDecoder(r.Body).Decode(&got); err != nil {
+					t.Error(err)
+				}
+				w.WriteHeader(tt.status)
+				w.Write([]byte(tt.reply))
+			}))
+			defer server.Close()
+
+			publisher := &kafkaRESTPublisher{url: server.URL + "/topics/events", client: server.Client()}
+			event, err := New(ListingCreated, Key("listing", 1), "", map[string]int64{"id": 1, "price": 9223372036854775807})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			err = publisher.Publish(context.Background(), event)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, want error %t", err, tt.wantErr)
+			}
+
+			if len(got.Records) != 1 || got.Records[0].Key != "listing:1" || got.Records[0].Value.ID != event.ID ||
+				string(got.Records[0].Value.Data) != `{"id":1,"price":9223372036854775807}` {
+				t.Errorf("records = %+v, want one record of listing 1", got.Records)
+			}
+		})
+	}
+}
+
+// outbox in memory recording the outcome of every event
+type memoryOutbox struct {
+	mu        sync.Mutex
+	pending   []Record
+	delivered []string
+	retried   map[string]int
+	dead      []string
+}
+
+func (o *memoryOutbox) Claim(ctx context.Context, limit int, lease time.Duration) ([]Record, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	claimed := o.pending
+	if len(claimed) > limit {
+		claimed = claimed[:limit]
+	}
+	o.pending = o.pending[len(claimed):]
+	return claimed, nil
+}
+
+func (o *memoryOutbox) Delivered(ctx context.Context, id int64) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	o.delivered = append(o.delivered, outboxEventID(id))
+	return nil
+}
+
+func (o *memoryOutbox) Retry(ctx context.Context, id int64, attempts int, next time.Time, lastErr string) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	o.retried[outboxEventID(id)] = attempts
+	return nil
+}
+
+func (o *memoryOutbox) Dead(ctx context.Context, record Record, attempts int, lastErr string) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	o.dead = append(o.dead, outboxEventID(record.ID))
+	return nil
+}
+
+func (o *memoryOutbox) Purge(ctx context.Context, deliveredBefore time.Time) (int, error) {
+	return 0, nil
+}
+
+// event id of outbox id, outbox:<id>
+func outboxEventID(id int64) string {
+	return Key("outbox", int(id))
+}
+
+// publisher failing the events of the keys in fail
+type keyPublisher struct {
+	fail      map[string]bool
+	published []string
+}
+
+func (p *keyPublisher) Publish(ctx context.Context, event Event) error {
+	if p.fail[event.Key] {
+		return errors.New("broker down")
+	}
+	p.published = append(p.published, event.ID)
+	return nil
+}
+
+func (p *keyPublisher) Close() error { return nil }
+
+func TestRelayRound(t *testing.T) {
+	record := func(id int64, key string, attempts int) Record {
+		return Record{ID: id, Attempts: attempts, Event: Event{ID: outboxEventID(id), Type: ListingUpdated, Key: key}}
+	}
+	outbox := &memoryOutbox{
+		retried: map[string]int{},
+		pending: []Record{
+			record(1, "listing:1", 0),
+			record(2, "listing:2", 0),
+			record(3, "listing:1", 0),
+			record(4, "listing:3", 9),
+			record(5, "listing:2", 0),
+		},
+	}
+	publisher := &keyPublisher{fail: map[string]bool{"listing:1": true, "listing:3": true}}
+
+	var results []string
+	relay := &Relay{
+		outbox: outbox, publisher: publisher,
+		batchSize: 10, lease: time.Second, maxAttempts: 10,
+		retryBackoff: time.Second, maxRetryBackoff: time.Minute,
+		Observe: func(eventType, result string) { results = append(results, result) },
+	}
+
+	if n := relay.round(context.Background()); n != 5 {
+		t.Fatalf("claimed %d events, want 5", n)
+	}
+
+	// event 3 waits behind the failed event 1 of the same listing, event 4 ran out of attempts
+	if want := []string{"outbox:2", "outbox:5"}; !slices.Equal(publisher.published, want) || !slices.Equal(outbox.delivered, want) {
+		t.Errorf("published %v, delivered %v, want %v", publisher.published, outbox.delivered, want)
+	}
+	if len(outbox.retried) != 1 || outbox.retried["outbox:1"] != 1 {
+		t.Errorf("retried %v, want event 1 after its first attempt", outbox.retried)
+	}
+	if !slices.Equal(outbox.dead, []string{"outbox:4"}) {
+		t.Errorf("dead %v, want event 4", outbox.dead)
+	}
+	sort.Strings(results)
+	if want := []string{ResultDead, ResultPublished, ResultPublished, ResultRetried}; !slices.Equal(results, want) {
+		t.Errorf("observed %v, want %v", results, want)
+	}
+}
+
+func TestRelayBackoff(t *testing.T) {
+	relay := &Relay{retryBackoff: time.Second, maxRetryBackoff: time.Minute}
+
+	for attempts, want := range map[int]time.Duration{1: time.Second, 2: 2 * time.Second, 6: 32 * time.Second, 7: time.Minute, 40: time.Minute} {
+		if got := relay.backoff(attempts); got != want {
+			t.Errorf("backoff(%d) = %s, want %s", attempts, got, want)
+		}
+	}
+}
+
+func TestFanout(t *testing.T) {
+	broker := &keyPublisher{}
+	webhooks := &keyPublisher{fail: map[string]bool{"listing:2": true}}
+	publisher := Fanout(broker, webhooks)
+
+	if err := publisher.Publish(context.Background(), Event{ID: "e1", Key: "listing:1"}); err != nil {
+		t.Fatal(err)
+	}
+	// a failing publisher fails the event, the others still got it and get it again on the retry
+	if err := publisher.Publish(context.Background(), Event{ID: "e2", Key: "listing:2"}); err == nil {
+		t.Fatal("published, want the error of the failing publisher")
+	}
+
+	if !slices.Equal(broker.published, []string{"e1", "e2"}) || !slices.Equal(webhooks.published, []string{"e1"}) {
+		t.Errorf("published %v and %v, want e1 and e2 then e1", broker.published, webhooks.published)
+	}
+}
+
+// delivered events in memory, filtered like an outbox
+type memoryHistory []Record
+
+func (h memoryHistory) Events(ctx context.Context, filter ReplayFilter, afterID int64, limit int) ([]Record, error) {
+	var page []Record
+	for _, record := range h {
+		if record.ID > afterID && record.Event.OccurredAt >= filter.From && record.Event.OccurredAt < filter.To &&
+			(len(filter.Types) == 0 || slices.Contains(filter.Types, record.Event.Type)) && len(page) < limit {
+			page = append(page, record)
+		}
+	}
+	return page, nil
+}
+
+func TestReplay(t *testing.T) {
+	var history memoryHistory
+	for id := int64(1); id <= replayPageSize+10; id++ {
+		eventType := ListingUpdated
+		if id%2 == 0 {
+			eventType = UserUpdated
+		}
+		history = append(history, Record{ID: id, Event: Event{ID: outboxEventID(id), Type: eventType, OccurredAt: id, Key: Key("listing", int(id%3))}})
+	}
+	filter := ReplayFilter{Types: []string{ListingUpdated}, From: 1, To: replayPageSize + 10}
+
+	dry, err := Replay(context.Background(), history, nil, "search", filter, true)
+	if err != nil || dry.Events != 255 || dry.ByType[ListingUpdated] != 255 || dry.Published != 0 {
+		t.Fatalf("dry run %+v, %v, want 255 listing.updated counted", dry, err)
+	}
+
+	publisher := &keyPublisher{}
+	result, err := Replay(context.Background(), history, publisher, "search", ReplayFilter{From: 1, To: replayPageSize + 11}, false)
+	if err != nil || result.Events != replayPageSize+10 || result.Published != replayPageSize+10 || len(publisher.published) != replayPageSize+10 {
+		t.Fatalf("replay %+v, %v, want every event over two pages", result, err)
+	}
+	if publisher.published[0] != "outbox:1" || publisher.published[replayPageSize] != outboxEventID(replayPageSize+1) {
+		t.Errorf("published %v..., want the events in order", publisher.published[:3])
+	}
+
+	failing := &keyPublisher{fail: map[string]bool{"listing:2": true}}
+	if result, err := Replay(context.Background(), history, failing, "search", filter, false); err == nil || result.Published != 2 {
+		t.Errorf("replay %+v, %v, want it stopped at event 5 of listing 2 after publishing events 1 and 3", result, err)
+	}
+
+	for _, tt := range []struct {
+		group  string
+		filter ReplayFilter
+		want   error
+	}{
+		{"search index", filter, ErrReplayGroup},
+		{"search", ReplayFilter{From: 5, To: 5}, ErrReplayFilter},
+		{"search", ReplayFilter{Types: []string{"listing.sold"}, From: 1, To: 5}, ErrReplayFilter},
+	} {
+		if _, err := Replay(context.Background(), history, nil, tt.group, tt.filter, true); !errors.Is(err, tt.want) {
+			t.Errorf("replay of %q %+v: %v, want %v", tt.group, tt.filter, err, tt.want)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	listing := `{"id": 1, "user_id": 2, "listing_type": "rent", "price": 9223372036854775807, "currency": "SGD", "region": null, "area": 80.5, "created_at": 1, "updated_at": 1}`
+
+	for _, tt := range []struct {
+		name    string
+		event   Event
+		wantErr string
+	}{
+		{"listing", Event{Type: ListingCreated, Version: 1, Data: json.RawMessage(listing)}, ""},
+		{"without version", Event{Type: ListingUpdated, Data: json.RawMessage(listing)}, ""},
+		{"unknown property", Event{Type: UserDeleted, Version: 1, Data: json.RawMessage(`{"id": 1, "reason": "gdpr"}`)}, ""},
+		{"missing property", Event{Type: UserCreated, Version: 1, Data: json.RawMessage(`{"id": 1, "name": "Alice", "created_at": 1, "updated_at": 1}`)}, "data.role is missing"},
+		{"wrong type", Event{Type: ListingDeleted, Version: 1, Data: json.RawMessage(`{"id": "1"}`)}, "data.id is string, want integer"},
+		{"fraction", Event{Type: ListingDeleted, Version: 1, Data: json.RawMessage(`{"id": 1.5}`)}, "data.id is number, want integer"},
+		{"enum", Event{Type: UserUpdated, Version: 1, Data: json.RawMessage(`{"id": 1, "name": "Alice", "role": "root", "created_at": 1, "updated_at": 1}`)}, `data.role is "root", want one of user, admin`},
+		{"unknown version", Event{Type: UserDeleted, Version: 9, Data: json.RawMessage(`{"id": 1}`)}, "no schema of user.deleted version 9"},
+		{"unknown type", Event{Type: "listing.sold", Version: 1, Data: json.RawMessage(`{"id": 1}`)}, "no schema of listing.sold"},
+	} {
+		err := Validate(tt.event)
+		if tt.wantErr == "" && err != nil {
+			t.Errorf("%s: %v, want valid", tt.name, err)
+		}
+		if tt.wantErr != "" && (!errors.Is(err, ErrEventInvalid) || !strings.Contains(err.Error(), tt.wantErr)) {
+			t.Errorf("%s: %v, want %q", tt.name, err, tt.wantErr)
+		}
+	}
+}
+
+func TestCompatible(t *testing.T) {
+	schema := func(doc string) *Schema {
+		var s Schema
+		if err := json.Unmarshal([]byte(doc), &s); err != nil {
+			t.Fatal(err)
+		}
+		return &s
+	}
+	old := schema(`{"type": "object", "required": ["id", "price"], "properties": {"id": {"type": "integer"}, "price": {"type": "number"}, "region": {"type": ["string", "null"]}, "listing_type": {"type": "string", "enum": ["rent", "sale"]}}}`)
+
+	for _, tt := range []struct {
+		name    string
+		next    string
+		wantErr string
+	}{
+		{"same", `{"type": "object", "required": ["id", "price"], "properties": {"id": {"type": "integer"}, "price": {"type": "number"}, "region": {"type": ["string", "null"]}, "listing_type": {"type": "string", "enum": ["rent", "sale"]}}}`, ""},
+		{"added and narrowed", `{"type": "object", "required": ["id", "price", "currency"], "properties": {"id": {"type": "integer"}, "price": {"type": "integer"}, "currency": {"type": "string"}, "region": {"type": "string"}, "listing_type": {"type": "string", "enum": ["rent"]}}}`, ""},
+		{"no longer required", `{"type": "object", "required": ["id"], "properties": {"id": {"type": "integer"}, "price": {"type": "number"}, "region": {"type": ["string", "null"]}, "listing_type": {"type": "string", "enum": ["rent", "sale"]}}}`, "data.price is no longer required"},
+		{"removed", `{"type": "object", "required": ["id", "price"], "properties": {"id": {"type": "integer"}, "price": {"type": "number"}, "listing_type": {"type": "string", "enum": ["rent", "sale"]}}}`, "data.region was removed"},
+		{"type changed", `{"type": "object", "required": ["id", "price"], "properties": {"id": {"type": "string"}, "price": {"type": "number"}, "region": {"type": ["string", "null"]}, "listing_type": {"type": "string", "enum": ["rent", "sale"]}}}`, "data.id may now be string"},
+		{"enum value added", `{"type": "object", "required": ["id", "price"], "properties": {"id": {"type": "integer"}, "price": {"type": "number"}, "region": {"type": ["string", "null"]}, "listing_type": {"type": "string", "enum": ["rent", "sale", "auction"]}}}`, `data.listing_type may now be "auction"`},
+	} {
+		err := Compatible(old, schema(tt.next))
+		if tt.wantErr == "" && err != nil {
+			t.Errorf("%s: %v, want compatible", tt.name, err)
+		}
+		if tt.wantErr != "" && (!errors.Is(err, ErrSchemaIncompatible) || !strings.Contains(err.Error(), tt.wantErr)) {
+			t.Errorf("%s: %v, want %q", tt.name, err, tt.wantErr)
+		}
+	}
+}
+
+// every version of a schema added to schemas/ must keep the consumers of the previous one working
+func TestSchemaVersionsCompatible(t *testing.T) {
+	for _, eventType := range Types {
+		for version := 2; version <= SchemaVersion(eventType); version++ {
+			old, _ := SchemaOf(eventType, version-1)
+			next, _ := SchemaOf(eventType, version)
+			if err := Compatible(old, next); err != nil {
+				t.Errorf("%s v%d: %v", eventType, version, err)
+			}
+		}
+	}
+}
+
+func TestRelayValidate(t *testing.T) {
+	outbox := &memoryOutbox{
+		retried: map[string]int{},
+		pending: []Record{
+			{ID: 1, Event: Event{ID: "outbox:1", Type: ListingDeleted, Data: json.RawMessage(`{"id": 1}`), Key: "listing:1"}},
+			{ID: 2, Event: Event{ID: "outbox:2", Type: ListingDeleted, Version: 1, Data: json.RawMessage(`{"id": "2"}`), Key: "listing:2"}},
+		},
+	}
+	publisher := &versionPublisher{}
+
+	var results []string
+	relay := &Relay{
+		outbox: outbox, publisher: publisher, batchSize: 10, lease: time.Second, maxAttempts: 10, Validate: true,
+		Observe: func(eventType, result string) { results = append(results, result) },
+	}
+	relay.round(context.Background())
+
+	// the event written before versioning is published as version 1, the invalid one is never published
+	if !slices.Equal(publisher.versions, []int{1}) || !slices.Equal(outbox.delivered, []string{"outbox:1"}) {
+		t.Errorf("published versions %v, delivered %v, want event 1 as version 1", publisher.versions, outbox.delivered)
+	}
+	if !slices.Equal(outbox.dead, []string{"outbox:2"}) || !slices.Equal(results, []string{ResultPublished, ResultInvalid}) {
+		t.Errorf("dead %v, observed %v, want event 2 invalid", outbox.dead, results)
+	}
+}
+
+// publisher recording the version of every event
+type versionPublisher struct {
+	versions []int
+}
+
+func (p *versionPublisher) Publish(ctx context.Context, event Event) error {
+	p.versions = append(p.versions, event.Version)
+	return nil
+}
+
+func (p *versionPublisher) Close() error { return nil }
+
+func TestConsumer(t *testing.T) {
+	t.Setenv("INDEXER_WORKERS", "3")
+	t.Setenv("INDEXER_MAX_ATTEMPTS", "3")
+	t.Setenv("INDEXER_RETRY_BACKOFF", "1ms")
+	cfg, err := config.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var (
+		mu       sync.Mutex
+		handled  = map[string][]string{}
+		attempts = map[string]int{}
+		results  = map[string]int{}
+	)
+	consumer := NewConsumer(cfg, "INDEXER", "indexer", NewMemoryProcessed(), func(ctx context.Context, event Event) error {
+		mu.Lock()
+		defer mu.Unlock()
+		attempts[event.ID]++
+		// e2 fails twice then goes through, bad never does
+		if (event.ID == "e2" && attempts[event.ID] < 3) || event.ID == "bad" {
+			return errors.New("index down")
+		}
+		handled[event.Key] = append(handled[event.Key], event.ID)
+		return nil
+	})
+	consumer.Observe = func(eventType, result string) {
+		mu.Lock()
+		results[result]++
+		mu.Unlock()
+	}
+	consumer.Start()
+
+	var wg sync.WaitGroup
+	errs := map[string]error{}
+	deliver := func(id, key string) {
+		wg.Add(1)
+		consumer.Deliver(Event{ID: id, Type: ListingUpdated, Key: key}, func(err error) {
+			mu.Lock()
+			errs[id] = err
+			mu.Unlock()
+			wg.Done()
+		})
+	}
+	// e1 is redelivered, e.g. by a replay
+	for _, e := range [][2]string{{"e1", "listing:1"}, {"e4", "listing:2"}, {"e2", "listing:1"}, {"e5", "listing:2"}, {"e3", "listing:1"}, {"e1", "listing:1"}, {"bad", "listing:3"}} {
+		deliver(e[0], e[1])
+	}
+	wg.Wait()
+
+	if want := []string{"e1", "e2", "e3"}; !slices.Equal(handled["listing:1"], want) {
+		t.Errorf("listing 1 handled %v, want %v in order with e1 once", handled["listing:1"], want)
+	}
+	if want := []string{"e4", "e5"}; !slices.Equal(handled["listing:2"], want) {
+		t.Errorf("listing 2 handled %v, want %v", handled["listing:2"], want)
+	}
+	if errs["e2"] != nil || errs["e1"] != nil || errs["bad"] == nil || attempts["bad"] != 3 {
+		t.Errorf("errors %v after %d attempts of bad, want only bad failed after 3", errs, attempts["bad"])
+	}
+	if want := map[string]int{ConsumeProcessed: 5, ConsumeDuplicate: 1, ConsumeRetried: 4, ConsumeFailed: 1}; !maps.Equal(results, want) {
+		t.Errorf("observed %v, want %v", results, want)
+	}
+
+	consumer.Stop(context.Background())
+	var stopped error
+	consumer.Deliver(Event{ID: "e6", Key: "listing:1"}, func(err error) { stopped = err })
+	if !errors.Is(stopped, ErrConsumerStopped) {
+		t.Errorf("deliver after stop: %v, want ErrConsumerStopped", stopped)
+	}
+}
+
+func TestSQLProcessedRebind(t *testing.T) {
+	query := "DELETE FROM processed_events WHERE consumer = ? AND processed_at < ?"
+	if got := NewSQLProcessed(nil, "postgres").rebind(query); got != "DELETE FROM processed_events WHERE consumer = $1 AND processed_at < $2" {
+		t.Errorf("postgres query %q", got)
+	}
+	if got := NewSQLProcessed(nil, "sqlite3").rebind(query); got != query {
+		t.Errorf("sqlite query %q", got)
+	}
+}
+
+type memoryChanges struct {
+	changes []Change
+	acked   []string
+	ackErr  error
+}
+
+func (m *memoryChanges) Changes(ctx context.Context, limit int) ([]Change, error) {
+	return m.changes[:min(limit, len(m.changes))], nil
+}
+
+func (m *memoryChanges) Ack(ctx context.Context, commit string) error {
+	if m.ackErr != nil {
+		return m.ackErr
+	}
+	m.acked = append(m.acked, commit)
+	for len(m.changes) > 0 && m.changes[0].Commit <= commit {
+		m.changes = m.changes[1:]
+	}
+	return nil
+}
+
+func TestCDCRound(t *testing.T) {
+	cfg, err := config.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	source := &memoryChanges{changes: []Change{
+		{Position: "1", Commit: "1", Table: "users", Op: ChangeInsert, New: map[string]any{"id": json.Number("1")}, CommittedAt: 100},
+		{Position: "2", Commit: "2", Table: "consents", Op: ChangeInsert},
+		{Position: "3", Commit: "3", Table: "users", Op: ChangeDelete, Old: map[string]any{"id": json.Number("1")}, CommittedAt: 300},
+	}}
+	mapper := func(change Change) (Event, bool, error) {
+		if change.Table != "users" {
+			return Event{}, false, nil
+		}
+		row := change.New
+		if row == nil {
+			row = change.Old
+		}
+		event, err := New("user."+change.Op, "user:"+row["id"].(json.Number).String(), "", row)
+		return event, true, err
+	}
+	var written []Event
+	sinkErr := errors.New("outbox down")
+	cdc := NewCDC(cfg, "CDC", source, mapper, func(ctx context.Context, events []Event) error {
+		if sinkErr != nil {
+			return sinkErr
+		}
+		written = append(written, events...)
+		return nil
+	})
+
+	if n := cdc.round(context.Background()); n != 0 || len(source.acked) != 0 {
+		t.Fatalf("round with the sink down read %d and acked %v, want nothing acked", n, source.acked)
+	}
+
+	sinkErr, source.ackErr = nil, errors.New("slot busy")
+	cdc.round(context.Background())
+	first := slices.Clone(written)
+	source.ackErr = nil
+	if n := cdc.round(context.Background()); n != 3 || len(source.changes) != 0 || !slices.Equal(source.acked, []string{"3"}) {
+		t.Fatalf("round read %d and acked %v, want the 3 changes acked at 3", n, source.acked)
+	}
+
+	if len(written) != 4 || written[2].ID != first[0].ID || written[3].ID != first[1].ID || written[0].ID == written[1].ID {
+		t.Fatalf("written %+v, want 2 events written twice with the same ids", written)
+	}
+	if written[0].OccurredAt != 100 || written[1].OccurredAt != 300 || written[1].Key != "user:1" || written[1].Type != "user.delete" {
+		t.Errorf("events %+v, want the time and key of their change", written[:2])
+	}
+}
+
+func TestParseTestDecoding(t *testing.T) {
+	tests := []struct {
+		data    string
+		want    Change
+		wantErr bool
+	}{
+		{
+			data: `table public.users: INSERT: id[integer]:1 name[text]:'Ann O''Neil' deleted_at[bigint]:null legal_hold[integer]:0 role[character varying]:'user'`,
+			want: Change{Table: "users", Op: ChangeInsert, New: map[string]any{"id": json.Number("1"), "name": "Ann O'Neil", "deleted_at": nil, "legal_hold": json.Number("0"), "role": "user"}},
+		},
+		{
+			data: `table public.users: UPDATE: old-key: id[integer]:1 name[text]:'Ann' new-tuple: id[integer]:1 name[text]:'Anne new-tuple: x' bio[text]:unchanged-toast-datum`,
+			want: Change{Table: "users", Op: ChangeUpdate, Old: map[string]any{"id": json.Number("1"), "name": "Ann"}, New: map[string]any{"id": json.Number("1"), "name": "Anne new-tuple: x"}},
+		},
+		{
+			data: `table public."Flags": DELETE: id[bigint]:7 active[boolean]:true`,
+			want: Change{Table: "Flags", Op: ChangeDelete, Old: map[string]any{"id": json.Number("7"), "active": true}},
+		},
+		{data: `table public.users: TRUNCATE: (no-flags)`, wantErr: true},
+		{data: `table public.users: INSERT: name[text]:'unterminated`, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		got, err := parseTestDecoding(tt.data)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: error %v, want error %t", tt.data, err, tt.wantErr)
+			continue
+		}
+		if tt.wantErr {
+			continue
+		}
+		if got.Table != tt.want.Table || got.Op != tt.want.Op || !maps.Equal(got.Old, tt.want.Old) || !maps.Equal(got.New, tt.want.New) {
+			t.Errorf("%s:\n got %+v\nwant %+v", tt.data, got, tt.want)
+		}
+	}
+
+	if got := commitTime("COMMIT (at 2026-10-16 10:10:27.2085+00)"); got != time.Date(2026, 10, 16, 10, 10, 27, 208500000, time.UTC).UnixMicro() {
+		t.Errorf("commit time %d", got)
+	}
+}
@@ -0,0 +1,240 @@
+package events
+
+import (
+	"context"
+	"log/slog"
+	"strings"
+	"time"
+
+	"config"
+)
+
+// Outbox events written by a service in the same transaction as their entity, implemented over its database
+type Outbox interface {
+	// Claim lock up to limit pending events due now for lease, oldest first. An event is not claimed while an
+	// older one of its key waits for a retry or is claimed by another relay, so the events of a key keep their order
+	Claim(ctx context.Context, limit int, lease time.Duration) ([]Record, error)
+	Delivered(ctx context.Context, id int64) error
+	// Retry release the event until next after a failed publish
+	Retry(ctx context.Context, id int64, attempts int, next time.Time, lastErr string) error
+	// Dead keep the event of record as dead letter, it is not published again unless requeued
+	Dead(ctx context.Context, record Record, attempts int, lastErr string) error
+	// Purge delete events delivered before, dead letters are kept
+	Purge(ctx context.Context, deliveredBefore time.Time) (int, error)
+}
+
+// Record event of the outbox with its publish attempts so far
+type Record struct {
+	ID       int64
+	Attempts int
+	Event    Event
+}
+
+const (
+	ResultPublished = "published"
+	ResultRetried   = "retried"
+	ResultDead      = "dead"
+	ResultInvalid   = "invalid"
+)
+
+// Relay publish the events of an outbox in background, an event failing to publish is retried with an exponential
+// backoff and kept as dead letter after <prefix>_MAX_ATTEMPTS. Several relays may share one outbox
+type Relay struct {
+	// name of the relay in logs, the lowercase prefix of its settings
+	name      string
+	outbox    Outbox
+	publisher Publisher
+
+	interval        time.Duration
+	batchSize       int
+	lease           time.Duration
+	maxAttempts     int
+	retryBackoff    time.Duration
+	maxRetryBackoff time.Duration
+	retention       time.Duration
+
+	// Observe called with the type and result of every publish attempt, ResultPublished, ResultRetried,
+	// ResultDead or ResultInvalid, to count them. Set before Start
+	Observe func(eventType, result string)
+	// Validate check every event against its schema before publishing it, an invalid event is kept as dead letter
+	// at once since publishing it again would not fix it. Set before Start
+	Validate bool
+
+	lastPurge time.Time
+	stop      chan struct{}
+	done      chan struct{}
+}
+
+// NewRelay of outbox to publisher with the settings named after prefix, OUTBOX for the event outboxes
+//
+// <prefix>_RELAY_INTERVAL wait between rounds, 0 disables the relay and events stay in the outbox
+// <prefix>_BATCH_SIZE events claimed per round
+// <prefix>_LEASE how long claimed events are left to the relay before another may claim them
+// <prefix>_MAX_ATTEMPTS publish attempts before an event is kept as dead letter
+// <prefix>_RETRY_BACKOFF wait before the first retry, doubled on each attempt up to <prefix>_MAX_RETRY_BACKOFF
+// <prefix>_RETENTION how long delivered events are kept, 0 keeps them
+func NewRelay(cfg *config.Config, prefix string, outbox Outbox, publisher Publisher) *Relay {
+	return &Relay{
+		name:            strings.ToLower(prefix),
+		outbox:          outbox,
+		publisher:       publisher,
+		interval:        cfg.Duration(prefix+"_RELAY_INTERVAL", time.Second),
+		batchSize:       cfg.Int(prefix+"_BATCH_SIZE", 100),
+		lease:           cfg.Duration(prefix+"_LEASE", 30*time.Second),
+		maxAttempts:     cfg.Int(prefix+"_MAX_ATTEMPTS", 10),
+		retryBackoff:    cfg.Duration(prefix+"_RETRY_BACKOFF", time.Second),
+		maxRetryBackoff: cfg.Duration(prefix+"_MAX_RETRY_BACKOFF", 5*time.Minute),
+		retention:       cfg.Duration(prefix+"_RETENTION", 7*24*time.Hour),
+		stop:            make(chan struct{}),
+		done:            make(chan struct{}),
+	}
+}
+
+// Start relay rounds every <prefix>_RELAY_INTERVAL until Stop
+func (r *Relay) Start() {
+	if r.interval <= 0 {
+		close(r.done)
+		return
+	}
+
+	go func() {
+		defer close(r.done)
+
+		ticker := time.NewTicker(r.interval)
+		defer ticker.Stop()
+		for {
+			// a full batch means more events are waiting, go on without waiting for the ticker
+			for r.round(context.Background()) == r.batchSize {
+				select {
+				case <-r.stop:
+					return
+				default:
+				}
+			}
+
+			select {
+			case <-r.stop:
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// Stop wait for the running round then close the publisher, events of an unfinished round are claimed again
+// once their lease ends
+func (r *Relay) Stop(ctx context.Context) {
+	close(r.stop)
+
+	select {
+	case <-r.done:
+	case <-ctx.Done():
+		slog.WarnContext(ctx, "relay round still running at shutdown", "relay", r.name)
+	}
+
+	if err := r.publisher.Close(); err != nil {
+		slog.ErrorContext(ctx, "relay error", "relay", r.name, "error", err)
+	}
+}
+
+// publish one batch, returns the count of events claimed
+func (r *Relay) round(ctx context.Context) int {
+	r.purge(ctx)
+
+	records, err := r.outbox.Claim(ctx, r.batchSize, r.lease)
+	if err != nil {
+		slog.ErrorContext(ctx, "relay error", "relay", r.name, "error", err)
+		return 0
+	}
+
+	// a key failing once is left for this round, its next events wait for its retry
+	failed := map[string]bool{}
+	for _, record := range records {
+		if failed[record.Event.Key] {
+			continue
+		}
+		if !r.publish(ctx, record) {
+			failed[record.Event.Key] = true
+		}
+	}
+
+	return len(records)
+}
+
+// publish record and save the outcome, false when it failed
+func (r *Relay) publish(ctx context.Context, record Record) bool {
+	event := versioned(record.Event)
+
+	if r.Validate {
+		if err := Validate(event); err != nil {
+			slog.ErrorContext(ctx, "event invalid", "relay", r.name, "error", err, "event_id", event.ID, "event", event.Type)
+			if err := r.outbox.Dead(ctx, record, record.Attempts+1, err.Error()); err != nil {
+				slog.ErrorContext(ctx, "relay error", "relay", r.name, "error", err, "event_id", event.ID)
+			}
+			r.observe(event.Type, ResultInvalid)
+			return false
+		}
+	}
+
+	publishCtx, cancel := context.WithTimeout(ctx, r.lease)
+	err := r.publisher.Publish(publishCtx, event)
+	cancel()
+
+	if err == nil {
+		if err := r.outbox.Delivered(ctx, record.ID); err != nil {
+			// published but not marked, the event is published again after its lease, consumers dedupe by id
+			slog.ErrorContext(ctx, "relay error", "relay", r.name, "error", err, "event_id", event.ID)
+		}
+		r.observe(event.Type, ResultPublished)
+		return true
+	}
+
+	attempts := record.Attempts + 1
+	if attempts >= r.maxAttempts {
+		slog.ErrorContext(ctx, "event dead", "relay", r.name, "error", err, "event_id", event.ID, "event", event.Type, "attempts", attempts)
+		if err := r.outbox.Dead(ctx, record, attempts, err.Error()); err != nil {
+			slog.ErrorContext(ctx, "relay error", "relay", r.name, "error", err, "event_id", event.ID)
+		}
+		r.observe(event.Type, ResultDead)
+		return false
+	}
+
+	slog.WarnContext(ctx, "event retried", "relay", r.name, "error", err, "event_id", event.ID, "event", event.Type, "attempts", attempts)
+	if err := r.outbox.Retry(ctx, record.ID, attempts, time.Now().Add(r.backoff(attempts)), err.Error()); err != nil {
+		slog.ErrorContext(ctx, "relay error", "relay", r.name, "error", err, "event_id", event.ID)
+	}
+	r.observe(event.Type, ResultRetried)
+	return false
+}
+
+// wait before the retry following attempts failed attempts
+func (r *Relay) backoff(attempts int) time.Duration {
+	wait := r.retryBackoff
+	for i := 1; i < attempts && wait < r.maxRetryBackoff; i++ {
+		wait *= 2
+	}
+	return min(wait, r.maxRetryBackoff)
+}
+
+// delete delivered events past <prefix>_RETENTION, at most once an hour
+func (r *Relay) purge(ctx context.Context) {
+	if r.retention <= 0 || time.Since(r.lastPurge) < time.Hour {
+		return
+	}
+	r.lastPurge = time.Now()
+
+	n, err := r.outbox.Purge(ctx, time.Now().Add(-r.retention))
+	if err != nil {
+		slog.ErrorContext(ctx, "relay error", "relay", r.name, "error", err)
+		return
+	}
+	if n > 0 {
+		slog.InfoContext(ctx, "relay purged", "relay", r.name, "events", n)
+	}
+}
+
+func (r *Relay) observe(eventType, result string) {
+	if r.Observe != nil {
+		r.Observe(eventType, result)
+	}
+}
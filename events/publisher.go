@@ -0,0 +1,214 @@
+package events
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"config"
+
+	"github.com/nats-io/nats.go"
+)
+
+// Publisher deliver events to a broker, implemented by any broker client
+type Publisher interface {
+	Publish(ctx context.Context, event Event) error
+	Close() error
+}
+
+// NewPublisher of EVENT_PUBLISHER, none, nats or kafka, named client on the broker. transport carries the calls
+// of the kafka publisher, nil for http.DefaultTransport
+//
+// EVENT_PUBLISH_TIMEOUT max duration of one publish
+func NewPublisher(cfg *config.Config, client string, transport http.RoundTripper) (Publisher, error) {
+	return newPublisher(cfg, client, transport, "")
+}
+
+// publisher of EVENT_PUBLISHER, to the subjects or topic of the consumer group replayGroup when set
+func newPublisher(cfg *config.Config, client string, transport http.RoundTripper, replayGroup string) (Publisher, error) {
+	name := cfg.String("EVENT_PUBLISHER", "none")
+	timeout := cfg.Duration("EVENT_PUBLISH_TIMEOUT", 5*time.Second)
+
+	var publisher Publisher
+	switch name {
+	case "none":
+		if replayGroup != "" {
+			return nil, errors.New("EVENT_PUBLISHER none has no broker to replay to")
+		}
+		publisher = noopPublisher{}
+	case "nats":
+		// EVENTS_NATS_URL nats://host:port of the nats server, a comma separated list for a cluster
+		// EVENTS_NATS_SUBJECT_PREFIX events go to <prefix>.<type>, e.g. events.listing.created
+		conn, err := nats.Connect(cfg.String("EVENTS_NATS_URL", nats.DefaultURL),
+			nats.Name(client), nats.Timeout(timeout), nats.MaxReconnects(-1))
+		if err != nil {
+			return nil, err
+		}
+		prefix := cfg.String("EVENTS_NATS_SUBJECT_PREFIX", "events")
+		if replayGroup != "" {
+			prefix += ".replay." + replayGroup
+		}
+		publisher = &natsPublisher{conn: conn, prefix: prefix, replayGroup: replayGroup, timeout: timeout}
+	case "kafka":
+		// EVENTS_KAFKA_REST_URL base url of the Kafka REST proxy, e.g. http://kafka-rest:8082
+		// EVENTS_KAFKA_TOPIC topic of every event, keyed by user or listing so the events of one keep their order
+		restURL := strings.TrimRight(cfg.String("EVENTS_KAFKA_REST_URL", ""), "/")
+		if restURL == "" {
+			return nil, errors.New("EVENTS_KAFKA_REST_URL is required with EVENT_PUBLISHER=kafka")
+		}
+		if transport == nil {
+			transport = http.DefaultTransport
+		}
+		topic := cfg.String("EVENTS_KAFKA_TOPIC", "events")
+		if replayGroup != "" {
+			topic += ".replay." + replayGroup
+		}
+		publisher = &kafkaRESTPublisher{
+			url:    restURL + "/topics/" + topic,
+			client: &http.Client{Timeout: timeout, Transport: transport},
+		}
+	default:
+		return nil, fmt.Errorf("unknown EVENT_PUBLISHER %q, one of: kafka, nats, none", name)
+	}
+
+	if replayGroup == "" {
+		slog.Info("event publisher", "publisher", name)
+	}
+	return publisher, nil
+}
+
+// Fanout publish every event to all publishers, an event is published once all of them took it. A publisher
+// failing makes the relay retry the event on all of them, so they must accept an event twice
+func Fanout(publishers ...Publisher) Publisher {
+	return fanoutPublisher(publishers)
+}
+
+type fanoutPublisher []Publisher
+
+func (p fanoutPublisher) Publish(ctx context.Context, event Event) error {
+	var errs []error
+	for _, publisher := range p {
+		if err := publisher.Publish(ctx, event); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (p fanoutPublisher) Close() error {
+	var errs []error
+	for _, publisher := range p {
+		if err := publisher.Close(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// publisher used without EVENT_PUBLISHER, events are dropped
+type noopPublisher struct{}
+
+func (noopPublisher) Publish(ctx context.Context, event Event) error { return nil }
+
+func (noopPublisher) Close() error { return nil }
+
+// nats publish on <prefix>.<type>, flushed so an event is only delivered once the server got it
+type natsPublisher struct {
+	conn   *nats.Conn
+	prefix string
+	// consumer group of a replay, its messages get their own ids so JetStream does not drop them as duplicates
+	replayGroup string
+	timeout     time.Duration
+}
+
+func (p *natsPublisher) Publish(ctx context.Context, event Event) error {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	msg := nats.NewMsg(p.prefix + "." + event.Type)
+	msg.Data = body
+	msg.Header.Set("Nats-Msg-Id", event.ID)
+	msg.Header.Set("Event-Key", event.Key)
+	if p.replayGroup != "" {
+		msg.Header.Set("Nats-Msg-Id", "replay."+p.replayGroup+"."+event.ID)
+		msg.Header.Set("Event-Replay", p.replayGroup)
+	}
+	if err := p.conn.PublishMsg(msg); err != nil {
+		return err
+	}
+
+	// a message buffered while reconnecting is lost when the process stops, wait for the server to ack it
+	return p.conn.FlushTimeout(p.timeout)
+}
+
+// flush buffered events then close the connection
+func (p *natsPublisher) Close() error {
+	return p.conn.Drain()
+}
+
+// kafka through the REST proxy (v2 API), one record per event keyed by user or listing
+type kafkaRESTPublisher struct {
+	url    string
+	client *http.Client
+}
+
+type kafkaRecords struct {
+	Records []kafkaRecord `json:"records"`
+}
+
+type kafkaRecord struct {
+	Key   string `json:"key"`
+	Value Event  `json:"value"`
+}
+
+func (p *kafkaRESTPublisher) Publish(ctx context.Context, event Event) error {
+	body, err := json.Marshal(kafkaRecords{Records: []kafkaRecord{{Key: event.Key, Value: event}}})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/vnd.kafka.json.v2+json")
+	req.Header.Set("Accept", "application/vnd.kafka.v2+json")
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("kafka rest proxy answered %d", resp.StatusCode)
+	}
+
+	// the proxy answers 200 with an error per record it could not produce
+	var res struct {
+		Offsets []struct {
+			ErrorCode *int   `json:"error_code"`
+			Error     string `json:"error"`
+		} `json:"offsets"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&res); err != nil {
+		return err
+	}
+	for _, offset := range res.Offsets {
+		if offset.ErrorCode != nil {
+			return fmt.Errorf("kafka rest proxy: %s", offset.Error)
+		}
+	}
+
+	return nil
+}
+
+func (p *kafkaRESTPublisher) Close() error { return nil }
@@ -0,0 +1,115 @@
+package events
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"regexp"
+	"slices"
+
+	"config"
+)
+
+// History events kept in an outbox, delivered ones until <prefix>_RETENTION
+type History interface {
+	// Events page of the delivered events matching filter with an outbox id above afterID, oldest first
+	Events(ctx context.Context, filter ReplayFilter, afterID int64, limit int) ([]Record, error)
+}
+
+// ReplayFilter events of Types, every type when empty, that occurred within [From, To) unix microseconds
+type ReplayFilter struct {
+	Types []string `json:"types,omitempty"`
+	From  int64    `json:"from"`
+	To    int64    `json:"to"`
+}
+
+// ReplayResult counts of a replay by type, Published stays 0 on a dry run
+type ReplayResult struct {
+	Group     string         `json:"group"`
+	DryRun    bool           `json:"dry_run"`
+	Events    int            `json:"events"`
+	ByType    map[string]int `json:"by_type"`
+	Published int            `json:"published"`
+}
+
+var (
+	// ErrReplayGroup consumer group name that can not be part of a subject or topic
+	ErrReplayGroup = errors.New("group must be 1 to 64 letters, digits, - or _")
+	// ErrReplayFilter filter without a range or with an unknown type
+	ErrReplayFilter = errors.New("from must be before to and types one of the event types")
+)
+
+var replayGroupPattern = regexp.MustCompile(`^[A-Za-z0-9_-]{1,64}$`)
+
+// events read from the history per page
+const replayPageSize = 500
+
+// Check the filter has a range and known types
+func (f ReplayFilter) Check() error {
+	if f.From < 0 || f.From >= f.To {
+		return ErrReplayFilter
+	}
+	for _, eventType := range f.Types {
+		if !slices.Contains(Types, eventType) {
+			return ErrReplayFilter
+		}
+	}
+	return nil
+}
+
+// NewReplayPublisher of EVENT_PUBLISHER sending to the consumer group only: nats subjects
+// <EVENTS_NATS_SUBJECT_PREFIX>.replay.<group>.<type> and the kafka topic <EVENTS_KAFKA_TOPIC>.replay.<group>, so
+// the consumers already caught up never see the events again
+func NewReplayPublisher(cfg *config.Config, client, group string, transport http.RoundTripper) (Publisher, error) {
+	if !replayGroupPattern.MatchString(group) {
+		return nil, ErrReplayGroup
+	}
+
+	return newPublisher(cfg, client, transport, group)
+}
+
+// Replay publish the events of history matching filter to publisher in their order, or only count them on a dry
+// run where publisher may be nil. A failed publish stops the replay, the result counts the events published
+// before it
+func Replay(ctx context.Context, history History, publisher Publisher, group string, filter ReplayFilter, dryRun bool) (ReplayResult, error) {
+	result := ReplayResult{Group: group, DryRun: dryRun, ByType: map[string]int{}}
+	if !replayGroupPattern.MatchString(group) {
+		return result, ErrReplayGroup
+	}
+	if err := filter.Check(); err != nil {
+		return result, err
+	}
+
+	var afterID int64
+	for {
+		records, err := history.Events(ctx, filter, afterID, replayPageSize)
+		if err != nil {
+			return result, err
+		}
+
+		for _, record := range records {
+			if !dryRun {
+				if err := publisher.Publish(ctx, versioned(record.Event)); err != nil {
+					return result, err
+				}
+				result.Published++
+			}
+			result.Events++
+			result.ByType[record.Event.Type]++
+		}
+
+		if len(records) < replayPageSize {
+			return result, nil
+		}
+		afterID = records[len(records)-1].ID
+	}
+}
+
+// Add the counts of other to the result, for a replay of several outboxes
+func (r *ReplayResult) Add(other ReplayResult) {
+	r.Events += other.Events
+	r.Published += other.Published
+	for eventType, n := range other.ByType {
+		r.ByType[eventType] += n
+	}
+}
@@ -0,0 +1,281 @@
+package events
+
+import (
+	"bytes"
+	"embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"path"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Schema of the data of one version of an event type, in the subset of JSON Schema the registry uses: type,
+// properties, required, items and enum. Properties missing from a schema are allowed, so adding one is compatible
+type Schema struct {
+	Dialect     string             `json:"$schema,omitempty"`
+	ID          string             `json:"$id,omitempty"`
+	Description string             `json:"description,omitempty"`
+	Type        SchemaTypes        `json:"type,omitempty"`
+	Required    []string           `json:"required,omitempty"`
+	Properties  map[string]*Schema `json:"properties,omitempty"`
+	Items       *Schema            `json:"items,omitempty"`
+	Enum        []string           `json:"enum,omitempty"`
+}
+
+// SchemaTypes JSON types a value may have, e.g. string or null. Written as a string when there is one
+type SchemaTypes []string
+
+func (t *SchemaTypes) UnmarshalJSON(b []byte) error {
+	var one string
+	if err := json.Unmarshal(b, &one); err == nil {
+		*t = SchemaTypes{one}
+		return nil
+	}
+	return json.Unmarshal(b, (*[]string)(t))
+}
+
+func (t SchemaTypes) MarshalJSON() ([]byte, error) {
+	if len(t) == 1 {
+		return json.Marshal(t[0])
+	}
+	return json.Marshal([]string(t))
+}
+
+var (
+	// ErrEventInvalid event of an unknown type or version, or with data not matching its schema
+	ErrEventInvalid = errors.New("event does not match its schema")
+	// ErrSchemaIncompatible new version of a schema breaking consumers of the previous one
+	ErrSchemaIncompatible = errors.New("schema not compatible with the previous version")
+)
+
+// schemas/<type>.v<version>.json, every version of every type is kept so consumers can read older events
+//
+//go:embed schemas
+var schemaFiles embed.FS
+
+// versions of the schema of each type, version 1 first
+var schemas = mustLoadSchemas()
+
+func mustLoadSchemas() map[string][]*Schema {
+	entries, err := schemaFiles.ReadDir("schemas")
+	if err != nil {
+		panic(err)
+	}
+
+	byVersion := map[string]map[int]*Schema{}
+	for _, entry := range entries {
+		name := strings.TrimSuffix(entry.Name(), ".json")
+		eventType, version, ok := strings.Cut(name, ".v")
+		n, err := strconv.Atoi(version)
+		if !ok || err != nil || n < 1 || !slices.Contains(Types, eventType) {
+			panic("schema file " + entry.Name() + " is not named <type>.v<version>.json after an event type")
+		}
+
+		body, err := schemaFiles.ReadFile(path.Join("schemas", entry.Name()))
+		if err != nil {
+			panic(err)
+		}
+		var schema Schema
+		decoder := json.NewDecoder(bytes.NewReader(body))
+		decoder.DisallowUnknownFields()
+		if err := decoder.Decode(&schema); err != nil {
+			panic("schema file " + entry.Name() + ": " + err.Error())
+		}
+
+		if byVersion[eventType] == nil {
+			byVersion[eventType] = map[int]*Schema{}
+		}
+		byVersion[eventType][n] = &schema
+	}
+
+	loaded := map[string][]*Schema{}
+	for _, eventType := range Types {
+		for n := 1; n <= len(byVersion[eventType]); n++ {
+			schema, ok := byVersion[eventType][n]
+			if !ok {
+				panic(fmt.Sprintf("schema of %s has no version %d", eventType, n))
+			}
+			loaded[eventType] = append(loaded[eventType], schema)
+		}
+		if len(loaded[eventType]) == 0 {
+			panic("no schema of " + eventType)
+		}
+	}
+	return loaded
+}
+
+// SchemaVersion current version of the schema of eventType, the one of the events published now. 0 for an
+// unknown type
+func SchemaVersion(eventType string) int {
+	return len(schemas[eventType])
+}
+
+// SchemaOf eventType in version, false when either is unknown
+func SchemaOf(eventType string, version int) (*Schema, bool) {
+	versions := schemas[eventType]
+	if version < 1 || version > len(versions) {
+		return nil, false
+	}
+	return versions[version-1], true
+}
+
+// Validate the data of event against the schema of its type and version. Events without version were written
+// before versioning, they are of version 1
+func Validate(event Event) error {
+	version := max(event.Version, 1)
+	schema, ok := SchemaOf(event.Type, version)
+	if !ok {
+		return fmt.Errorf("%w: no schema of %s version %d", ErrEventInvalid, event.Type, version)
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(event.Data))
+	// numbers are kept as written so integers are told apart and never lose precision
+	decoder.UseNumber()
+	var data any
+	if err := decoder.Decode(&data); err != nil {
+		return fmt.Errorf("%w: data: %v", ErrEventInvalid, err)
+	}
+
+	if problems := schema.validate("data", data); len(problems) > 0 {
+		return fmt.Errorf("%w: %s v%d: %s", ErrEventInvalid, event.Type, version, strings.Join(problems, ", "))
+	}
+	return nil
+}
+
+// problems of value at path against the schema
+func (s *Schema) validate(at string, value any) []string {
+	kind := jsonType(value)
+	if len(s.Type) > 0 && !slices.Contains(s.Type, kind) && !(kind == "integer" && slices.Contains(s.Type, "number")) {
+		return []string{fmt.Sprintf("%s is %s, want %s", at, kind, strings.Join(s.Type, " or "))}
+	}
+
+	var problems []string
+	switch value := value.(type) {
+	case string:
+		if len(s.Enum) > 0 && !slices.Contains(s.Enum, value) {
+			problems = append(problems, fmt.Sprintf("%s is %q, want one of %s", at, value, strings.Join(s.Enum, ", ")))
+		}
+	case map[string]any:
+		for _, name := range s.Required {
+			if _, ok := value[name]; !ok {
+				problems = append(problems, at+"."+name+" is missing")
+			}
+		}
+		for _, name := range sortedKeys(s.Properties) {
+			if property, ok := value[name]; ok {
+				problems = append(problems, s.Properties[name].validate(at+"."+name, property)...)
+			}
+		}
+	case []any:
+		if s.Items != nil {
+			for i, item := range value {
+				problems = append(problems, s.Items.validate(fmt.Sprintf("%s[%d]", at, i), item)...)
+			}
+		}
+	}
+	return problems
+}
+
+// JSON Schema type of a value decoded with UseNumber, integer for numbers without fraction
+func jsonType(value any) string {
+	switch value := value.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case string:
+		return "string"
+	case json.Number:
+		if _, err := value.Int64(); err == nil {
+			return "integer"
+		}
+		if f, err := value.Float64(); err == nil && f == math.Trunc(f) && !math.IsInf(f, 0) {
+			return "integer"
+		}
+		return "number"
+	case []any:
+		return "array"
+	default:
+		return "object"
+	}
+}
+
+// Compatible check that consumers reading events of old keep working with events of next: what old requires is
+// still required, no value gets a type or enum value old does not allow. Adding optional or required properties is
+// compatible, removing or loosening one is not
+func Compatible(old, next *Schema) error {
+	if problems := Incompatibilities(old, next); len(problems) > 0 {
+		return fmt.Errorf("%w: %s", ErrSchemaIncompatible, strings.Join(problems, ", "))
+	}
+	return nil
+}
+
+// Incompatibilities of next for the consumers of old, one per property, empty when compatible
+func Incompatibilities(old, next *Schema) []string {
+	return compatible("data", old, next)
+}
+
+func compatible(at string, old, next *Schema) []string {
+	var problems []string
+	// an untyped schema takes any value, a typed one only its types. integer values are numbers too
+	if len(old.Type) > 0 {
+		if len(next.Type) == 0 {
+			problems = append(problems, at+" may now be of any type")
+		}
+		for _, kind := range next.Type {
+			if !slices.Contains(old.Type, kind) && !(kind == "integer" && slices.Contains(old.Type, "number")) {
+				problems = append(problems, fmt.Sprintf("%s may now be %s", at, kind))
+			}
+		}
+	}
+	if len(old.Enum) > 0 {
+		if len(next.Enum) == 0 {
+			problems = append(problems, at+" may now be any value")
+		}
+		for _, value := range next.Enum {
+			if !slices.Contains(old.Enum, value) {
+				problems = append(problems, fmt.Sprintf("%s may now be %q", at, value))
+			}
+		}
+	}
+
+	for _, name := range old.Required {
+		// a removed property is reported once below
+		_, removed := old.Properties[name]
+		if _, kept := next.Properties[name]; kept {
+			removed = false
+		}
+		if !slices.Contains(next.Required, name) && !removed {
+			problems = append(problems, at+"."+name+" is no longer required")
+		}
+	}
+	for _, name := range sortedKeys(old.Properties) {
+		if property, ok := next.Properties[name]; ok {
+			problems = append(problems, compatible(at+"."+name, old.Properties[name], property)...)
+		} else {
+			problems = append(problems, at+"."+name+" was removed")
+		}
+	}
+	if old.Items != nil {
+		if next.Items == nil {
+			problems = append(problems, at+" items may now be of any type")
+		} else {
+			problems = append(problems, compatible(at+"[]", old.Items, next.Items)...)
+		}
+	}
+	return problems
+}
+
+func sortedKeys(properties map[string]*Schema) []string {
+	keys := make([]string, 0, len(properties))
+	for key := range properties {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,492 @@
+package publicapi
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"apperror"
+	"logging"
+
+	"github.com/gin-gonic/gin"
+)
+
+// statuses of an admin action kept by the user service
+const (
+	adminActionPending  = "pending"
+	adminActionApproved = "approved"
+	adminActionRejected = "rejected"
+	adminActionExpired  = "expired"
+	adminActionExecuted = "executed"
+	adminActionFailed   = "failed"
+)
+
+// high risk operation of an admin written by the user service before it runs, run once a second admin approved it.
+// RequestedBy 0 is an operator holding the internal api key
+type AdminAction struct {
+	ID             int64           `json:"id"`
+	Action         string          `json:"action"`
+	Entity         string          `json:"entity"`
+	EntityID       string          `json:"entity_id"`
+	Params         json.RawMessage `json:"params,omitempty"`
+	Reason         string          `json:"reason,omitempty"`
+	Status         string          `json:"status"`
+	RequestedBy    int             `json:"requested_by"`
+	RequestID      string          `json:"request_id,omitempty"`
+	DecidedBy      int             `json:"decided_by,omitempty"`
+	DecisionReason string          `json:"decision_reason,omitempty"`
+	DecidedAt      int64           `json:"decided_at,omitempty"`
+	Result         json.RawMessage `json:"result,omitempty"`
+	Error          string          `json:"error,omitempty"`
+	ExpiresAt      int64           `json:"expires_at"`
+	CreatedAt      int64           `json:"created_at"`
+	UpdatedAt      int64           `json:"updated_at"`
+}
+
+type AdminActionCreate struct {
+	Action      string          `json:"action"`
+	Entity      string          `json:"entity"`
+	EntityID    string          `json:"entity_id"`
+	Params      json.RawMessage `json:"params,omitempty"`
+	Reason      string          `json:"reason,omitempty"`
+	RequestedBy int             `json:"requested_by"`
+	RequestID   string          `json:"request_id,omitempty"`
+	ExpiresAt   int64           `json:"expires_at"`
+}
+
+type AdminActionDecision struct {
+	Status    string `json:"status"`
+	DecidedBy int    `json:"decided_by"`
+	Reason    string `json:"reason,omitempty"`
+}
+
+type AdminActionOutcome struct {
+	Status string          `json:"status"`
+	Result json.RawMessage `json:"result,omitempty"`
+	Error  string          `json:"error,omitempty"`
+}
+
+// reason of an approval or rejection, optional
+type AdminActionReason struct {
+	Reason string `json:"reason" binding:"max=2000"`
+}
+
+type AdminActionsResponse struct {
+	Result       bool          `json:"result"`
+	AdminActions []AdminAction `json:"admin_actions"`
+	Pagination   Pagination    `json:"pagination"`
+}
+
+type AdminActionResponse struct {
+	Result      bool        `json:"result"`
+	AdminAction AdminAction `json:"admin_action"`
+}
+
+// operation run once approved, params as requested
+type adminActionKind struct {
+	run func(ctx context.Context, action *AdminAction) (any, error)
+}
+
+// operations that may wait for approval, named <entity>.<operation>
+var adminActionKinds = map[string]adminActionKind{
+	"listing.purge": {run: runListingPurge},
+	"user.role":     {run: runUserRole},
+	"events.replay": {run: runEventsReplay},
+}
+
+var (
+	// ADMIN_APPROVAL_ACTIONS actions of adminActionKinds run only once a second admin approved them, none to run
+	// every action at once
+	adminApprovalActions = strings.Split(cfg.String("ADMIN_APPROVAL_ACTIONS", "listing.purge,user.role,events.replay"), ",")
+	// ADMIN_ACTION_TTL how long an action waits for approval before it expires
+	adminActionTTL = cfg.Duration("ADMIN_ACTION_TTL", 24*time.Hour)
+)
+
+var (
+	ErrAdminActionNotFound    = apperror.NotFound("Admin action not found")
+	ErrAdminActionDuplicate   = apperror.Conflict("an action of this kind on this entity is already pending")
+	ErrAdminActionNotPending  = apperror.Conflict("admin action is no longer pending, it was decided or expired")
+	ErrAdminActionNotApproved = apperror.Conflict("admin action is not approved or its run is already recorded")
+	errAdminActionPage        = apperror.Validation("page_num must be at least 1 and page_size between 1 and 100, status one of pending, approved, rejected, expired, executed, failed")
+)
+
+// true when action of the caller waits for the approval of a second admin. Operators holding the internal api key
+// are not admins, what they request runs at once like a call of theirs to the user service would
+func approvalRequired(c *gin.Context, action string) bool {
+	if authUserID(c) == 0 {
+		return false
+	}
+	return slices.ContainsFunc(adminApprovalActions, func(item string) bool { return strings.TrimSpace(item) == action })
+}
+
+// =========== INTERFACE HANDLER, HANDLING REQUEST RESPONSE API DEPEND INTERFACE ===========
+
+// admin actions newest first, of one status when set
+func getAdminActionsHandler(c *gin.Context) {
+	pageNum, errNum := strconv.Atoi(c.DefaultQuery("page_num", "1"))
+	pageSize, errSize := strconv.Atoi(c.DefaultQuery("page_size", "50"))
+	if errNum != nil || errSize != nil {
+		apperror.Respond(c, errAdminActionPage)
+		return
+	}
+
+	res, err := getAdminActionsUsecase(c.Request.Context(), c.Query("status"), pageNum, pageSize)
+	if err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"admin_actions": res.AdminActions, "pagination": res.Pagination})
+}
+
+func getAdminActionHandler(c *gin.Context) {
+	id, ok := adminActionID(c)
+	if !ok {
+		return
+	}
+
+	action, err := getAdminActionUsecase(c.Request.Context(), id)
+	if err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"admin_action": action})
+}
+
+// approve a pending action of another admin and run it, answered with the action and the result or error of its run
+func approveAdminActionHandler(c *gin.Context) {
+	decideAdminActionHandler(c, adminActionApproved)
+}
+
+// reject a pending action, the admin who requested it may withdraw it this way
+func rejectAdminActionHandler(c *gin.Context) {
+	decideAdminActionHandler(c, adminActionRejected)
+}
+
+func decideAdminActionHandler(c *gin.Context, status string) {
+	id, ok := adminActionID(c)
+	if !ok {
+		return
+	}
+
+	// decisions are signed by a user, an operator holding the api key is nobody in particular
+	actorID := authUserID(c)
+	if actorID == 0 {
+		apperror.Abort(c, http.StatusForbidden, "Admin actions are decided by an admin user, not with the internal api key")
+		return
+	}
+
+	var body AdminActionReason
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&body); err != nil {
+			slog.ErrorContext(c.Request.Context(), "handler error", "code", "517", "error", err)
+			apperror.RespondBinding(c, err)
+			return
+		}
+	}
+
+	action, err := getAdminActionUsecase(c.Request.Context(), id)
+	if err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+	if status == adminActionApproved && action.RequestedBy == actorID {
+		apperror.Abort(c, http.StatusForbidden, "Admin actions must be approved by another admin than the one who requested them")
+		return
+	}
+
+	action, err = decideAdminActionUsecase(c.Request.Context(), action, AdminActionDecision{Status: status, DecidedBy: actorID, Reason: body.Reason})
+	if err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"admin_action": action})
+}
+
+// id param of the admin action, false once the bad request is answered
+func adminActionID(c *gin.Context) (int64, bool) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "handler error", "code", "518", "error", err)
+		apperror.JSON(c, http.StatusBadRequest, "Invalid admin action ID")
+		return 0, false
+	}
+
+	return id, true
+}
+
+// answer the request of a high risk action with 202 and the pending action instead of running it
+func respondAdminActionPending(c *gin.Context, action *AdminAction) {
+	c.Header("Location", fmt.Sprintf("/public-api/admin/actions/%d", action.ID))
+	c.JSON(http.StatusAccepted, gin.H{"admin_action": action})
+}
+
+// =========== USECASE LAYER, SERVES AS AN INTERMEDIARY BETWEEN THE PRESENTATION LAYER AND THE DATA LAYER ===========
+
+// write action pending approval for ADMIN_ACTION_TTL, nothing runs until a second admin approves it
+func requestAdminActionUsecase(ctx context.Context, actorID int, action, entity, entityID string, params any) (*AdminAction, error) {
+	var paramsJSON json.RawMessage
+	if params != nil {
+		var err error
+		if paramsJSON, err = json.Marshal(params); err != nil {
+			slog.ErrorContext(ctx, "usecase error", "code", "519", "error", err)
+			return nil, err
+		}
+	}
+
+	createJSON, err := json.Marshal(AdminActionCreate{
+		Action:      action,
+		Entity:      entity,
+		EntityID:    entityID,
+		Params:      paramsJSON,
+		RequestedBy: actorID,
+		RequestID:   logging.RequestID(ctx),
+		ExpiresAt:   time.Now().Add(adminActionTTL).UnixMicro(),
+	})
+	if err != nil {
+		slog.ErrorContext(ctx, "usecase error", "code", "519", "error", err)
+		return nil, err
+	}
+
+	res, err := userClient.CreateAdminAction(ctx, createJSON)
+	if err != nil {
+		if errors.Is(err, ErrAdminActionDuplicate) {
+			return nil, err
+		}
+		return nil, apperror.Upstream("Failed to request admin action", err)
+	}
+
+	slog.InfoContext(ctx, "admin action waiting for approval", "admin_action_id", res.AdminAction.ID, "action", action, "entity_id", entityID)
+	return &res.AdminAction, nil
+}
+
+func getAdminActionsUsecase(ctx context.Context, status string, pageNum, pageSize int) (*AdminActionsResponse, error) {
+	statuses := []string{"", adminActionPending, adminActionApproved, adminActionRejected, adminActionExpired, adminActionExecuted, adminActionFailed}
+	if pageNum < 1 || pageSize < 1 || pageSize > 100 || !slices.Contains(statuses, status) {
+		return nil, errAdminActionPage
+	}
+
+	res, err := userClient.FindAdminActions(ctx, status, pageNum, pageSize)
+	if err != nil {
+		if errors.Is(err, errAdminActionPage) {
+			return nil, err
+		}
+		return nil, apperror.Upstream("Failed to get admin actions", err)
+	}
+
+	return res, nil
+}
+
+func getAdminActionUsecase(ctx context.Context, id int64) (*AdminAction, error) {
+	res, err := userClient.FindAdminAction(ctx, id)
+	if err != nil {
+		if errors.Is(err, ErrAdminActionNotFound) {
+			return nil, err
+		}
+		return nil, apperror.Upstream("Failed to get admin action", err)
+	}
+
+	return &res.AdminAction, nil
+}
+
+// record the decision, then run an approved action and record how its run went. The user service only moves a
+// pending action once, so two admins approving at once run it once
+func decideAdminActionUsecase(ctx context.Context, action *AdminAction, decision AdminActionDecision) (*AdminAction, error) {
+	kind, ok := adminActionKinds[action.Action]
+	if !ok && decision.Status == adminActionApproved {
+		return nil, apperror.Conflict(fmt.Sprintf("admin action %s is not supported by this version", action.Action))
+	}
+
+	decisionJSON, err := json.Marshal(decision)
+	if err != nil {
+		slog.ErrorContext(ctx, "usecase error", "code", "520", "error", err)
+		return nil, err
+	}
+
+	res, err := userClient.DecideAdminAction(ctx, action.ID, decisionJSON)
+	if err != nil {
+		if errors.Is(err, ErrAdminActionNotFound) || errors.Is(err, ErrAdminActionNotPending) {
+			return nil, err
+		}
+		return nil, apperror.Upstream("Failed to decide admin action", err)
+	}
+	action = &res.AdminAction
+	if action.Status != adminActionApproved {
+		return action, nil
+	}
+
+	outcome := AdminActionOutcome{Status: adminActionExecuted}
+	result, err := kind.run(ctx, action)
+	if err != nil {
+		slog.ErrorContext(ctx, "usecase error", "code", "521", "error", err, "admin_action_id", action.ID, "action", action.Action)
+		outcome.Status, outcome.Error = adminActionFailed, err.Error()
+	} else if result != nil {
+		if outcome.Result, err = json.Marshal(result); err != nil {
+			slog.ErrorContext(ctx, "usecase error", "code", "521", "error", err, "admin_action_id", action.ID)
+		}
+	}
+
+	// the run happened, record it even when the approver went away
+	outcomeJSON, err := json.Marshal(outcome)
+	if err != nil {
+		slog.ErrorContext(ctx, "usecase error", "code", "522", "error", err)
+		return nil, err
+	}
+	recorded, err := userClient.RecordAdminActionOutcome(context.WithoutCancel(ctx), action.ID, outcomeJSON)
+	if err != nil {
+		slog.ErrorContext(ctx, "usecase error", "code", "522", "error", err, "admin_action_id", action.ID, "status", outcome.Status)
+		action.Status, action.Result, action.Error = outcome.Status, outcome.Result, outcome.Error
+		return action, nil
+	}
+
+	slog.InfoContext(ctx, "admin action run", "admin_action_id", action.ID, "action", action.Action, "status", outcome.Status)
+	return &recorded.AdminAction, nil
+}
+
+// hard delete of the listing of the entity id
+func runListingPurge(ctx context.Context, action *AdminAction) (any, error) {
+	id, err := strconv.Atoi(action.EntityID)
+	if err != nil {
+		return nil, err
+	}
+	return nil, adminDeleteListingUsecase(ctx, id, true)
+}
+
+// role of params to the user of the entity id, as the requester set it
+func runUserRole(ctx context.Context, action *AdminAction) (any, error) {
+	id, err := strconv.Atoi(action.EntityID)
+	if err != nil {
+		return nil, err
+	}
+	var role UserRole
+	if err := json.Unmarshal(action.Params, &role); err != nil {
+		return nil, err
+	}
+	return setUserRoleUsecase(ctx, action.RequestedBy, id, role)
+}
+
+// replay of params
+func runEventsReplay(ctx context.Context, action *AdminAction) (any, error) {
+	var replay EventReplay
+	if err := json.Unmarshal(action.Params, &replay); err != nil {
+		return nil, err
+	}
+	return replayEventsUsecase(ctx, replay)
+}
+
+// =========== REPOSITORY LAYER, ABSTRACTION OVER THE DATA PERSISTENCE (databases, file systems, or external APIs) ===========
+
+// user service api path
+var (
+	apiPathAdminActions       = userServiceURL + "/admin-actions"
+	apiPathAdminAction        = userServiceURL + "/admin-actions/%d"
+	apiPathAdminActionDecide  = userServiceURL + "/admin-actions/%d/decision"
+	apiPathAdminActionOutcome = userServiceURL + "/admin-actions/%d/outcome"
+)
+
+func (httpUserClient) FindAdminActions(ctx context.Context, status string, pageNum, pageSize int) (*AdminActionsResponse, error) {
+	query := url.Values{"page_num": {strconv.Itoa(pageNum)}, "page_size": {strconv.Itoa(pageSize)}}
+	if status != "" {
+		query.Set("status", status)
+	}
+	resp, err := httpGet(ctx, apiPathAdminActions+"?"+query.Encode())
+	if err != nil {
+		slog.ErrorContext(ctx, "service error", "code", "523", "error", err)
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusBadRequest:
+		return nil, errAdminActionPage
+	default:
+		slog.ErrorContext(ctx, "service error", "code", "524", "error", "error fetching admin actions from user service")
+		return nil, errors.New("error fetching admin actions from user service")
+	}
+
+	var actions AdminActionsResponse
+	if err := decodeJSON(resp.Body, &actions); err != nil {
+		slog.ErrorContext(ctx, "service error", "code", "524", "error", err)
+		return nil, err
+	}
+
+	return &actions, nil
+}
+
+func (httpUserClient) FindAdminAction(ctx context.Context, id int64) (*AdminActionResponse, error) {
+	resp, err := httpGet(ctx, fmt.Sprintf(apiPathAdminAction, id))
+	if err != nil {
+		slog.ErrorContext(ctx, "service error", "code", "525", "error", err)
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	return decodeAdminAction(ctx, resp, nil, "526", "error fetching admin action from user service")
+}
+
+func (httpUserClient) CreateAdminAction(ctx context.Context, actionByte []byte) (*AdminActionResponse, error) {
+	resp, err := httpPost(ctx, apiPathAdminActions, "application/json", bytes.NewBuffer(actionByte))
+	if err != nil {
+		slog.ErrorContext(ctx, "service error", "code", "527", "error", err)
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	return decodeAdminAction(ctx, resp, ErrAdminActionDuplicate, "528", "error requesting admin action from user service")
+}
+
+func (httpUserClient) DecideAdminAction(ctx context.Context, id int64, decisionByte []byte) (*AdminActionResponse, error) {
+	resp, err := httpPost(ctx, fmt.Sprintf(apiPathAdminActionDecide, id), "application/json", bytes.NewBuffer(decisionByte))
+	if err != nil {
+		slog.ErrorContext(ctx, "service error", "code", "529", "error", err)
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	return decodeAdminAction(ctx, resp, ErrAdminActionNotPending, "530", "error deciding admin action from user service")
+}
+
+func (httpUserClient) RecordAdminActionOutcome(ctx context.Context, id int64, outcomeByte []byte) (*AdminActionResponse, error) {
+	resp, err := httpPost(ctx, fmt.Sprintf(apiPathAdminActionOutcome, id), "application/json", bytes.NewBuffer(outcomeByte))
+	if err != nil {
+		slog.ErrorContext(ctx, "service error", "code", "531", "error", err)
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	return decodeAdminAction(ctx, resp, ErrAdminActionNotApproved, "532", "error recording admin action outcome from user service")
+}
+
+// admin action answered by the user service, conflict the public API error of a 409 of the call
+func decodeAdminAction(ctx context.Context, resp *http.Response, conflict error, code, message string) (*AdminActionResponse, error) {
+	switch {
+	case resp.StatusCode == http.StatusOK || resp.StatusCode == http.StatusCreated:
+	case resp.StatusCode == http.StatusNotFound:
+		return nil, ErrAdminActionNotFound
+	case resp.StatusCode == http.StatusConflict && conflict != nil:
+		return nil, conflict
+	default:
+		slog.ErrorContext(ctx, "service error", "code", code, "error", message, "status", resp.StatusCode)
+		return nil, errors.New(message)
+	}
+
+	var action AdminActionResponse
+	if err := decodeJSON(resp.Body, &action); err != nil {
+		slog.ErrorContext(ctx, "service error", "code", code, "error", err)
+		return nil, err
+	}
+
+	return &action, nil
+}
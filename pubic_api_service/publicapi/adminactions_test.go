@@ -0,0 +1,200 @@
+package publicapi
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// admin actions kept like the user service does, moving them only from the status it expects
+type adminActionUserClient struct {
+	UserClient
+	actions map[int64]*AdminAction
+	roles   map[int]string
+}
+
+func (c *adminActionUserClient) CreateAdminAction(ctx context.Context, actionByte []byte) (*AdminActionResponse, error) {
+	var create AdminActionCreate
+	if err := json.Unmarshal(actionByte, &create); err != nil {
+		return nil, err
+	}
+	for _, action := range c.actions {
+		if action.Status == adminActionPending && action.Action == create.Action && action.EntityID == create.EntityID {
+			return nil, ErrAdminActionDuplicate
+		}
+	}
+
+	action := &AdminAction{ID: int64(len(c.actions) + 1), Action: create.Action, Entity: create.Entity, EntityID: create.EntityID,
+		Params: create.Params, Status: adminActionPending, RequestedBy: create.RequestedBy, ExpiresAt: create.ExpiresAt}
+	c.actions[action.ID] = action
+	return &AdminActionResponse{Result: true, AdminAction: *action}, nil
+}
+
+func (c *adminActionUserClient) FindAdminAction(ctx context.Context, id int64) (*AdminActionResponse, error) {
+	action, ok := c.actions[id]
+	if !ok {
+		return nil, ErrAdminActionNotFound
+	}
+	return &AdminActionResponse{Result: true, AdminAction: *action}, nil
+}
+
+func (c *adminActionUserClient) DecideAdminAction(ctx context.Context, id int64, decisionByte []byte) (*AdminActionResponse, error) {
+	var decision AdminActionDecision
+	if err := json.Unmarshal(decisionByte, &decision); err != nil {
+		return nil, err
+	}
+	action, ok := c.actions[id]
+	if !ok {
+		return nil, ErrAdminActionNotFound
+	}
+	if action.Status != adminActionPending {
+		return nil, ErrAdminActionNotPending
+	}
+	action.Status, action.DecidedBy, action.DecisionReason = decision.Status, decision.DecidedBy, decision.Reason
+	return &AdminActionResponse{Result: true, AdminAction: *action}, nil
+}
+
+func (c *adminActionUserClient) RecordAdminActionOutcome(ctx context.Context, id int64, outcomeByte []byte) (*AdminActionResponse, error) {
+	var outcome AdminActionOutcome
+	if err := json.Unmarshal(outcomeByte, &outcome); err != nil {
+		return nil, err
+	}
+	action := c.actions[id]
+	if action.Status != adminActionApproved {
+		return nil, ErrAdminActionNotApproved
+	}
+	action.Status, action.Result, action.Error = outcome.Status, outcome.Result, outcome.Error
+	return &AdminActionResponse{Result: true, AdminAction: *action}, nil
+}
+
+func (c *adminActionUserClient) SetUserRole(ctx context.Context, userID int, roleByte []byte) (*UserResponse, error) {
+	var role UserRole
+	if err := json.Unmarshal(roleByte, &role); err != nil {
+		return nil, err
+	}
+	c.roles[userID] = role.Role
+	return &UserResponse{Result: true, User: User{ID: userID, Role: role.Role}}, nil
+}
+
+// admin routes, the X-Actor header of the test request being the authenticated user
+func adminActionRouter() *gin.Engine {
+	router := gin.New()
+	admin := router.Group("/public-api/admin", func(c *gin.Context) {
+		if actor, err := strconv.Atoi(c.GetHeader("X-Actor")); err == nil {
+			c.Set(ctxKeyAuthUserID, actor)
+		}
+	})
+	admin.PUT("/users/:id/role", setUserRoleHandler)
+	admin.GET("/actions/:id", getAdminActionHandler)
+	admin.POST("/actions/:id/approve", approveAdminActionHandler)
+	admin.POST("/actions/:id/reject", rejectAdminActionHandler)
+	return router
+}
+
+func serveAdminAction(router *gin.Engine, method, path string, actor int, body string) (int, AdminAction, http.Header) {
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	if actor != 0 {
+		req.Header.Set("X-Actor", strconv.Itoa(actor))
+	}
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	var res struct {
+		AdminAction AdminAction `json:"admin_action"`
+	}
+	_ = json.Unmarshal(w.Body.Bytes(), &res)
+	return w.Code, res.AdminAction, w.Header()
+}
+
+func TestAdminActionApproval(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	client := &adminActionUserClient{actions: map[int64]*AdminAction{}, roles: map[int]string{3: roleUser}}
+	previousClient, previousCache := userClient, cachedUsers
+	userClient, cachedUsers = client, newUserCache(10, time.Minute)
+	defer func() { userClient, cachedUsers = previousClient, previousCache }()
+	router := adminActionRouter()
+
+	status, action, header := serveAdminAction(router, http.MethodPut, "/public-api/admin/users/3/role", 1, `{"role":"admin"}`)
+	if status != http.StatusAccepted || action.Status != adminActionPending || action.RequestedBy != 1 || header.Get("Location") != "/public-api/admin/actions/1" {
+		t.Fatalf("request: %d %+v %v, want 202 with the pending action", status, action, header)
+	}
+	if client.roles[3] != roleUser {
+		t.Fatalf("role set to %s before approval", client.roles[3])
+	}
+
+	if status, _, _ := serveAdminAction(router, http.MethodPut, "/public-api/admin/users/3/role", 2, `{"role":"agent"}`); status != http.StatusConflict {
+		t.Errorf("second request while pending: %d, want 409", status)
+	}
+	if status, _, _ := serveAdminAction(router, http.MethodPost, "/public-api/admin/actions/1/approve", 1, ""); status != http.StatusForbidden {
+		t.Errorf("approved by the requester: %d, want 403", status)
+	}
+	if status, _, _ := serveAdminAction(router, http.MethodPost, "/public-api/admin/actions/1/approve", 0, ""); status != http.StatusForbidden {
+		t.Errorf("approved with the api key: %d, want 403", status)
+	}
+
+	status, action, _ = serveAdminAction(router, http.MethodPost, "/public-api/admin/actions/1/approve", 2, `{"reason":"promoted"}`)
+	if status != http.StatusOK || action.Status != adminActionExecuted || action.DecidedBy != 2 || action.DecisionReason != "promoted" {
+		t.Fatalf("approve: %d %+v, want 200 with the executed action", status, action)
+	}
+	if client.roles[3] != roleAdmin {
+		t.Errorf("role %s after approval, want admin", client.roles[3])
+	}
+
+	if status, _, _ := serveAdminAction(router, http.MethodPost, "/public-api/admin/actions/1/reject", 2, ""); status != http.StatusConflict {
+		t.Errorf("rejected once run: %d, want 409", status)
+	}
+	if status, _, _ := serveAdminAction(router, http.MethodGet, "/public-api/admin/actions/9", 2, ""); status != http.StatusNotFound {
+		t.Errorf("unknown action: %d, want 404", status)
+	}
+}
+
+func TestAdminActionRejected(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	client := &adminActionUserClient{actions: map[int64]*AdminAction{}, roles: map[int]string{3: roleUser}}
+	previousClient := userClient
+	userClient = client
+	defer func() { userClient = previousClient }()
+	router := adminActionRouter()
+
+	serveAdminAction(router, http.MethodPut, "/public-api/admin/users/3/role", 1, `{"role":"admin"}`)
+
+	// the requester may withdraw their own action
+	status, action, _ := serveAdminAction(router, http.MethodPost, "/public-api/admin/actions/1/reject", 1, "")
+	if status != http.StatusOK || action.Status != adminActionRejected {
+		t.Fatalf("reject: %d %+v, want 200 with the rejected action", status, action)
+	}
+	if status, _, _ := serveAdminAction(router, http.MethodPost, "/public-api/admin/actions/1/approve", 2, ""); status != http.StatusConflict {
+		t.Errorf("approved once rejected: %d, want 409", status)
+	}
+	if client.roles[3] != roleUser {
+		t.Errorf("role %s after rejection, want user", client.roles[3])
+	}
+}
+
+func TestAdminActionNotRequired(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	client := &adminActionUserClient{actions: map[int64]*AdminAction{}, roles: map[int]string{3: roleUser}}
+	previousClient, previousActions, previousCache := userClient, adminApprovalActions, cachedUsers
+	userClient, adminApprovalActions, cachedUsers = client, []string{"listing.purge"}, newUserCache(10, time.Minute)
+	defer func() { userClient, adminApprovalActions, cachedUsers = previousClient, previousActions, previousCache }()
+
+	router := adminActionRouter()
+	status, _, _ := serveAdminAction(router, http.MethodPut, "/public-api/admin/users/3/role", 1, `{"role":"agent"}`)
+	if status != http.StatusOK || client.roles[3] != roleAgent || len(client.actions) != 0 {
+		t.Errorf("role out of ADMIN_APPROVAL_ACTIONS: %d role %s actions %d, want it set at once", status, client.roles[3], len(client.actions))
+	}
+
+	// operators are not admins, the first admins are made by them
+	adminApprovalActions = []string{"user.role"}
+	status, _, _ = serveAdminAction(router, http.MethodPut, "/public-api/admin/users/3/role", 0, `{"role":"admin"}`)
+	if status != http.StatusOK || client.roles[3] != roleAdmin || len(client.actions) != 0 {
+		t.Errorf("role set by an operator: %d role %s actions %d, want it set at once", status, client.roles[3], len(client.actions))
+	}
+}
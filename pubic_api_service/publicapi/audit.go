@@ -0,0 +1,412 @@
+package publicapi
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"apperror"
+	"logging"
+
+	"github.com/gin-gonic/gin"
+)
+
+// write done through the public API recorded by the user service, actor 0 is an operator holding the internal
+// api key or an anonymous caller
+type AuditEntry struct {
+	ID        int64  `json:"id"`
+	ActorID   int    `json:"actor_id"`
+	Action    string `json:"action"`
+	Entity    string `json:"entity"`
+	EntityID  string `json:"entity_id,omitempty"`
+	Detail    string `json:"detail,omitempty"`
+	RequestID string `json:"request_id,omitempty"`
+	// entity before and after the write, secrets redacted
+	Before    json.RawMessage `json:"before,omitempty"`
+	After     json.RawMessage `json:"after,omitempty"`
+	CreatedAt int64           `json:"created_at"`
+	// links of the audit chain set by the user service, see getAuditChainHandler
+	PrevHash string `json:"prev_hash,omitempty"`
+	Hash     string `json:"hash,omitempty"`
+}
+
+// entries of an entity within [From, To) unix microseconds, zero values match every entry
+type AuditLogFilter struct {
+	Entity string `json:"entity,omitempty"`
+	From   int64  `json:"from,omitempty"`
+	To     int64  `json:"to,omitempty"`
+}
+
+type AuditLogResponse struct {
+	Result     bool         `json:"result"`
+	Entries    []AuditEntry `json:"entries"`
+	Pagination Pagination   `json:"pagination"`
+}
+
+var (
+	errAuditPage   = apperror.Validation("page_num must be at least 1 and page_size between 1 and 100")
+	errAuditFilter = apperror.Validation("from and to must be RFC 3339 times or dates like 2006-01-02 with from before to")
+)
+
+// largest before or after json kept in an entry, a larger response is recorded without after
+const maxAuditJSON = 64 << 10
+
+// writes that are not recorded: logins carry a password and return a token, email events are sent by the providers
+var auditSkippedRoutes = map[string]bool{
+	"POST /login":                  true,
+	"POST /email-events/:provider": true,
+}
+
+// keys whose values are replaced in before and after
+var auditRedactedKeys = []string{"password", "token", "secret", "api_key"}
+
+// =========== MIDDLEWARE LAYER, RUN BEFORE INTERFACE HANDLER TO ENRICH OR GUARD THE REQUEST ===========
+
+// state of the entity written by an audited request, set by the usecases through auditBefore
+type auditChange struct {
+	before any
+}
+
+type ctxKeyAuditChange struct{}
+
+// record every create, update and delete that succeeded with the actor, the request id and the entity before and
+// after the write, a failed record is logged and the response is kept
+func auditMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.Request.Method == http.MethodGet || c.Request.Method == http.MethodHead || c.Request.Method == http.MethodOptions {
+			c.Next()
+			return
+		}
+
+		change := &auditChange{}
+		c.Request = c.Request.WithContext(context.WithValue(c.Request.Context(), ctxKeyAuditChange{}, change))
+
+		writer := &auditWriter{ResponseWriter: c.Writer}
+		c.Writer = writer
+		c.Next()
+		c.Writer = writer.ResponseWriter
+
+		// a replayed create was recorded when it was done
+		route := auditRoute(c.FullPath())
+		if route == "" || c.Writer.Status() >= http.StatusBadRequest || auditSkippedRoutes[c.Request.Method+" "+route] ||
+			c.Writer.Header().Get(headerIdempotentReplayed) != "" {
+			return
+		}
+
+		ctx := c.Request.Context()
+		entry := AuditEntry{
+			ActorID:   authUserID(c),
+			Action:    c.Request.Method + " " + route,
+			EntityID:  c.Param("id"),
+			Detail:    c.Request.URL.RawQuery,
+			RequestID: logging.RequestID(ctx),
+		}
+
+		// DELETE /admin/listings/:id on entity listings, PATCH /me/privacy on the user of the token
+		entry.Entity, _, _ = strings.Cut(strings.TrimPrefix(strings.TrimPrefix(route, "/"), "admin/"), "/")
+		if entry.Entity == "me" {
+			entry.Entity, entry.EntityID = "users", strconv.Itoa(entry.ActorID)
+		}
+
+		if change.before != nil {
+			if before, err := json.Marshal(change.before); err == nil {
+				entry.Before = redactAuditJSON(before)
+			}
+		}
+		if !writer.overflow {
+			entry.After = redactAuditJSON(writer.body.Bytes())
+		}
+		if entry.EntityID == "" {
+			entry.EntityID = auditCreatedID(entry.After)
+		}
+
+		if err := recordAuditService(context.WithoutCancel(ctx), entry); err != nil {
+			slog.ErrorContext(ctx, "middleware error", "code", "453", "error", err)
+		}
+	}
+}
+
+// keep a copy of the response body up to maxAuditJSON while writing it through
+type auditWriter struct {
+	gin.ResponseWriter
+	body     bytes.Buffer
+	overflow bool
+}
+
+func (w *auditWriter) Write(b []byte) (int, error) {
+	w.keep(b)
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *auditWriter) WriteString(s string) (int, error) {
+	w.keep([]byte(s))
+	return w.ResponseWriter.WriteString(s)
+}
+
+func (w *auditWriter) keep(b []byte) {
+	if w.overflow || w.body.Len()+len(b) > maxAuditJSON {
+		w.overflow = true
+		return
+	}
+	w.body.Write(b)
+}
+
+// set the entity of an audited request before its write, lookup is only called when ctx is audited so requests
+// that are not pay no extra call. A failed lookup leaves before empty
+func auditBefore(ctx context.Context, lookup func() (any, error)) {
+	change, _ := ctx.Value(ctxKeyAuditChange{}).(*auditChange)
+	if change == nil {
+		return
+	}
+
+	before, err := lookup()
+	if err != nil {
+		slog.WarnContext(ctx, "middleware error", "code", "479", "error", err)
+		return
+	}
+	change.before = before
+}
+
+// lookup of the user id as the before of an audited write
+func auditUserLookup(ctx context.Context, id int) func() (any, error) {
+	return func() (any, error) {
+		res, err := userClient.FindUser(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		return res.User, nil
+	}
+}
+
+// route of a full path without /public-api and its version, /users/:id for /public-api/v1/users/:id
+func auditRoute(fullPath string) string {
+	route, ok := strings.CutPrefix(fullPath, "/public-api")
+	if !ok {
+		return fullPath
+	}
+
+	segment, rest, _ := strings.Cut(strings.TrimPrefix(route, "/"), "/")
+	if apiVersionPattern.MatchString(segment) {
+		return "/" + rest
+	}
+	return route
+}
+
+// json object or array with the values of secret keys replaced, nil for a body that is not json
+func redactAuditJSON(body []byte) json.RawMessage {
+	var value any
+	if err := json.Unmarshal(body, &value); err != nil {
+		return nil
+	}
+	switch value.(type) {
+	case map[string]any, []any:
+	default:
+		return nil
+	}
+
+	redacted, err := json.Marshal(redactAuditValue(value))
+	if err != nil {
+		return nil
+	}
+	return redacted
+}
+
+func redactAuditValue(value any) any {
+	switch v := value.(type) {
+	case map[string]any:
+		for key, field := range v {
+			if isAuditRedactedKey(key) {
+				v[key] = "[REDACTED]"
+				continue
+			}
+			v[key] = redactAuditValue(field)
+		}
+	case []any:
+		for i, item := range v {
+			v[i] = redactAuditValue(item)
+		}
+	}
+	return value
+}
+
+// password, token, access_token, webhook_secret, ...
+func isAuditRedactedKey(key string) bool {
+	key = strings.ToLower(key)
+	for _, redacted := range auditRedactedKeys {
+		if key == redacted || strings.HasSuffix(key, "_"+redacted) {
+			return true
+		}
+	}
+	return false
+}
+
+// id of the entity a create returned, top level or in the envelope object like {"listing": {"id": 5}}
+func auditCreatedID(after json.RawMessage) string {
+	var object map[string]json.RawMessage
+	if err := json.Unmarshal(after, &object); err != nil {
+		return ""
+	}
+
+	if id := auditID(object["id"]); id != "" {
+		return id
+	}
+	for _, field := range object {
+		var nested map[string]json.RawMessage
+		if err := json.Unmarshal(field, &nested); err == nil {
+			if id := auditID(nested["id"]); id != "" {
+				return id
+			}
+		}
+	}
+	return ""
+}
+
+// number or string id as text
+func auditID(raw json.RawMessage) string {
+	var id any
+	if err := json.Unmarshal(raw, &id); err != nil {
+		return ""
+	}
+	switch v := id.(type) {
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case string:
+		return v
+	}
+	return ""
+}
+
+// =========== INTERFACE HANDLER, HANDLING REQUEST RESPONSE API DEPEND INTERFACE ===========
+
+// writes newest first, of one entity within a date range when asked
+func getAuditLogHandler(c *gin.Context) {
+	pageNum, errNum := strconv.Atoi(c.DefaultQuery("page_num", "1"))
+	pageSize, errSize := strconv.Atoi(c.DefaultQuery("page_size", "50"))
+	if errNum != nil || errSize != nil {
+		apperror.Respond(c, errAuditPage)
+		return
+	}
+
+	from, errFrom := parseAuditTime(c.Query("from"), false)
+	to, errTo := parseAuditTime(c.Query("to"), true)
+	if errFrom != nil || errTo != nil {
+		apperror.Respond(c, errAuditFilter)
+		return
+	}
+
+	filter := AuditLogFilter{Entity: c.Query("entity"), From: from, To: to}
+	res, err := getAuditLogUsecase(c.Request.Context(), filter, pageNum, pageSize)
+	if err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"entries": res.Entries, "pagination": res.Pagination})
+}
+
+// unix microseconds of an RFC 3339 time or a date, the end of the day for the date of an exclusive bound, 0 when empty
+func parseAuditTime(value string, end bool) (int64, error) {
+	if value == "" {
+		return 0, nil
+	}
+
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t.UnixMicro(), nil
+	}
+
+	day, err := time.Parse(time.DateOnly, value)
+	if err != nil {
+		return 0, err
+	}
+	if end {
+		day = day.AddDate(0, 0, 1)
+	}
+	return day.UnixMicro(), nil
+}
+
+// =========== USECASE LAYER, SERVES AS AN INTERMEDIARY BETWEEN THE PRESENTATION LAYER AND THE DATA LAYER ===========
+
+func getAuditLogUsecase(ctx context.Context, filter AuditLogFilter, pageNum, pageSize int) (*AuditLogResponse, error) {
+	if pageNum < 1 || pageSize < 1 || pageSize > 100 {
+		return nil, errAuditPage
+	}
+	if filter.To != 0 && filter.From >= filter.To {
+		return nil, errAuditFilter
+	}
+
+	res, err := userClient.FindAuditLog(ctx, filter, pageNum, pageSize)
+	if err != nil {
+		return nil, apperror.Upstream("Failed to get audit log", err)
+	}
+
+	return res, nil
+}
+
+// =========== REPOSITORY LAYER, ABSTRACTION OVER THE DATA PERSISTENCE (databases, file systems, or external APIs) ===========
+
+// user service api path
+var apiPathAuditLog = userServiceURL + "/audit-log"
+
+func recordAuditService(ctx context.Context, entry AuditEntry) error {
+	entryJSON, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+
+	return userClient.RecordAudit(ctx, entryJSON)
+}
+
+func (httpUserClient) RecordAudit(ctx context.Context, entryByte []byte) error {
+	resp, err := httpPost(ctx, apiPathAuditLog, "application/json", bytes.NewBuffer(entryByte))
+	if err != nil {
+		slog.ErrorContext(ctx, "service error", "code", "454", "error", err)
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusCreated {
+		slog.ErrorContext(ctx, "service error", "code", "455", "error", "error recording audit entry from user service")
+		return errors.New("error recording audit entry from user service")
+	}
+
+	return nil
+}
+
+func (httpUserClient) FindAuditLog(ctx context.Context, filter AuditLogFilter, pageNum, pageSize int) (*AuditLogResponse, error) {
+	query := url.Values{"page_num": {strconv.Itoa(pageNum)}, "page_size": {strconv.Itoa(pageSize)}}
+	if filter.Entity != "" {
+		query.Set("entity", filter.Entity)
+	}
+	if filter.From != 0 {
+		query.Set("from", strconv.FormatInt(filter.From, 10))
+	}
+	if filter.To != 0 {
+		query.Set("to", strconv.FormatInt(filter.To, 10))
+	}
+	resp, err := httpGet(ctx, apiPathAuditLog+"?"+query.Encode())
+	if err != nil {
+		slog.ErrorContext(ctx, "service error", "code", "456", "error", err)
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		slog.ErrorContext(ctx, "service error", "code", "457", "error", "error fetching audit log from user service")
+		return nil, errors.New("error fetching audit log from user service")
+	}
+
+	var log AuditLogResponse
+	if err := decodeJSON(resp.Body, &log); err != nil {
+		slog.ErrorContext(ctx, "service error", "code", "457", "error", err)
+		return nil, err
+	}
+
+	return &log, nil
+}
@@ -0,0 +1,99 @@
+package publicapi
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"logging"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestAuditMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	var audit []AuditEntry
+	userClient = roleUserClient{audit: &audit}
+
+	router := gin.New()
+	router.Use(logging.Middleware(), auditMiddleware())
+	v1 := router.Group("/public-api/v1")
+	v1.PATCH("/users/:id", func(c *gin.Context) {
+		auditBefore(c.Request.Context(), func() (any, error) {
+			return map[string]any{"id": 4, "name": "Old", "password": "hunter2"}, nil
+		})
+		c.JSON(http.StatusOK, gin.H{"result": true, "user": gin.H{"id": 4, "name": "New"}})
+	})
+	v1.POST("/webhooks", func(c *gin.Context) {
+		c.JSON(http.StatusCreated, gin.H{"result": true, "webhook": gin.H{"id": 9, "secret": "s3cret", "signing_secret": "x"}})
+	})
+	v1.POST("/login", func(c *gin.Context) { c.JSON(http.StatusOK, gin.H{"token": "jwt"}) })
+	v1.POST("/listings", func(c *gin.Context) { c.JSON(http.StatusBadRequest, gin.H{"error": "bad"}) })
+	v1.GET("/listings", func(c *gin.Context) { c.JSON(http.StatusOK, gin.H{"result": true}) })
+
+	for _, call := range []struct{ method, path string }{
+		{http.MethodPatch, "/public-api/v1/users/4"},
+		{http.MethodPost, "/public-api/v1/webhooks"},
+		{http.MethodPost, "/public-api/v1/login"},
+		{http.MethodPost, "/public-api/v1/listings"},
+		{http.MethodGet, "/public-api/v1/listings"},
+	} {
+		req := httptest.NewRequest(call.method, call.path, nil)
+		req.Header.Set(logging.HeaderRequestID, "req-1")
+		router.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	if len(audit) != 2 {
+		t.Fatalf("audit %+v, want the user update and the webhook create only", audit)
+	}
+
+	update := audit[0]
+	if update.Action != "PATCH /users/:id" || update.Entity != "users" || update.EntityID != "4" || update.RequestID != "req-1" {
+		t.Errorf("update entry %+v", update)
+	}
+	if string(update.Before) != `{"id":4,"name":"Old","password":"[REDACTED]"}` || !strings.Contains(string(update.After), `"name":"New"`) {
+		t.Errorf("update before %s after %s", update.Before, update.After)
+	}
+
+	create := audit[1]
+	var after struct {
+		Webhook map[string]any `json:"webhook"`
+	}
+	if err := json.Unmarshal(create.After, &after); err != nil {
+		t.Fatalf("create after %s: %v", create.After, err)
+	}
+	if create.Entity != "webhooks" || create.EntityID != "9" || create.Before != nil ||
+		after.Webhook["secret"] != "[REDACTED]" || after.Webhook["signing_secret"] != "[REDACTED]" {
+		t.Errorf("create entry %+v after %s", create, create.After)
+	}
+}
+
+func TestParseAuditTime(t *testing.T) {
+	day := time.Date(2026, 10, 16, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		value string
+		end   bool
+		want  int64
+	}{
+		{"", false, 0},
+		{"2026-10-16", false, day.UnixMicro()},
+		{"2026-10-16", true, day.AddDate(0, 0, 1).UnixMicro()},
+		{"2026-10-16T08:00:00+08:00", true, day.UnixMicro()},
+	}
+	for _, tt := range tests {
+		if got, err := parseAuditTime(tt.value, tt.end); err != nil || got != tt.want {
+			t.Errorf("parseAuditTime(%q, %t) = %d, %v, want %d", tt.value, tt.end, got, err, tt.want)
+		}
+	}
+
+	if _, err := getAuditLogUsecase(context.Background(), AuditLogFilter{From: 2, To: 1}, 1, 50); err != errAuditFilter {
+		t.Errorf("from after to: %v, want errAuditFilter", err)
+	}
+	if _, err := parseAuditTime("yesterday", false); err == nil {
+		t.Error("parseAuditTime(yesterday) succeeded")
+	}
+}
@@ -0,0 +1,161 @@
+package publicapi
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"apperror"
+
+	"github.com/gin-gonic/gin"
+)
+
+// hash of the head of the audit chain written out of the user service database, Location tells where
+type AuditAnchor struct {
+	ID        int64  `json:"id"`
+	EntryID   int64  `json:"entry_id"`
+	Hash      string `json:"hash"`
+	Location  string `json:"location"`
+	CreatedAt int64  `json:"created_at"`
+}
+
+// walk of the whole audit chain by the user service, Valid when every entry links to the one before, hashes to its
+// hash and every anchor has the hash of its entry
+type AuditChainVerification struct {
+	Valid          bool         `json:"valid"`
+	Entries        int          `json:"entries"`
+	HeadID         int64        `json:"head_id,omitempty"`
+	HeadHash       string       `json:"head_hash,omitempty"`
+	BrokenID       int64        `json:"broken_id,omitempty"`
+	Anchors        int          `json:"anchors"`
+	BrokenAnchorID int64        `json:"broken_anchor_id,omitempty"`
+	LastAnchor     *AuditAnchor `json:"last_anchor,omitempty"`
+}
+
+type AuditChainResponse struct {
+	Result  bool         `json:"result"`
+	Entries []AuditEntry `json:"entries"`
+}
+
+type AuditChainVerificationResponse struct {
+	Result       bool                   `json:"result"`
+	Verification AuditChainVerification `json:"verification"`
+}
+
+var errAuditChainPage = apperror.Validation("after_id must be at least 0 and limit between 1 and 1000")
+
+// =========== INTERFACE HANDLER, HANDLING REQUEST RESPONSE API DEPEND INTERFACE ===========
+
+// chained audit entries oldest first after after_id, with the hashes an auditor recomputes
+func getAuditChainHandler(c *gin.Context) {
+	afterID, errAfter := strconv.ParseInt(c.DefaultQuery("after_id", "0"), 10, 64)
+	limit, errLimit := strconv.Atoi(c.DefaultQuery("limit", "100"))
+	if errAfter != nil || errLimit != nil {
+		slog.ErrorContext(c.Request.Context(), "handler error", "code", "552", "error", errors.Join(errAfter, errLimit))
+		apperror.Respond(c, errAuditChainPage)
+		return
+	}
+
+	res, err := getAuditChainUsecase(c.Request.Context(), afterID, limit)
+	if err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"entries": res.Entries})
+}
+
+// whole chain and its anchors checked by the user service
+func verifyAuditChainHandler(c *gin.Context) {
+	res, err := verifyAuditChainUsecase(c.Request.Context())
+	if err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"verification": res.Verification})
+}
+
+// =========== USECASE LAYER, SERVES AS AN INTERMEDIARY BETWEEN THE PRESENTATION LAYER AND THE DATA LAYER ===========
+
+func getAuditChainUsecase(ctx context.Context, afterID int64, limit int) (*AuditChainResponse, error) {
+	if afterID < 0 || limit < 1 || limit > 1000 {
+		return nil, errAuditChainPage
+	}
+
+	res, err := userClient.FindAuditChain(ctx, afterID, limit)
+	if err != nil {
+		return nil, apperror.Upstream("Failed to get audit chain", err)
+	}
+
+	return res, nil
+}
+
+func verifyAuditChainUsecase(ctx context.Context) (*AuditChainVerificationResponse, error) {
+	res, err := userClient.VerifyAuditChain(ctx)
+	if err != nil {
+		return nil, apperror.Upstream("Failed to verify audit chain", err)
+	}
+
+	if !res.Verification.Valid {
+		slog.ErrorContext(ctx, "usecase error", "code", "553", "error", "audit chain broken", "broken_id", res.Verification.BrokenID,
+			"broken_anchor_id", res.Verification.BrokenAnchorID)
+	}
+	return res, nil
+}
+
+// =========== REPOSITORY LAYER, ABSTRACTION OVER THE DATA PERSISTENCE (databases, file systems, or external APIs) ===========
+
+// user service api path
+var (
+	apiPathAuditChain       = userServiceURL + "/audit-log/chain"
+	apiPathAuditChainVerify = userServiceURL + "/audit-log/verify"
+)
+
+func (httpUserClient) FindAuditChain(ctx context.Context, afterID int64, limit int) (*AuditChainResponse, error) {
+	query := url.Values{"after_id": {strconv.FormatInt(afterID, 10)}, "limit": {strconv.Itoa(limit)}}
+	resp, err := httpGet(ctx, apiPathAuditChain+"?"+query.Encode())
+	if err != nil {
+		slog.ErrorContext(ctx, "service error", "code", "554", "error", err)
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		slog.ErrorContext(ctx, "service error", "code", "555", "error", "error fetching audit chain from user service")
+		return nil, errors.New("error fetching audit chain from user service")
+	}
+
+	var chain AuditChainResponse
+	if err := decodeJSON(resp.Body, &chain); err != nil {
+		slog.ErrorContext(ctx, "service error", "code", "555", "error", err)
+		return nil, err
+	}
+
+	return &chain, nil
+}
+
+func (httpUserClient) VerifyAuditChain(ctx context.Context) (*AuditChainVerificationResponse, error) {
+	resp, err := httpGet(ctx, apiPathAuditChainVerify)
+	if err != nil {
+		slog.ErrorContext(ctx, "service error", "code", "556", "error", err)
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		slog.ErrorContext(ctx, "service error", "code", "557", "error", "error verifying audit chain from user service")
+		return nil, errors.New("error verifying audit chain from user service")
+	}
+
+	var verification AuditChainVerificationResponse
+	if err := decodeJSON(resp.Body, &verification); err != nil {
+		slog.ErrorContext(ctx, "service error", "code", "557", "error", err)
+		return nil, err
+	}
+
+	return &verification, nil
+}
@@ -0,0 +1,77 @@
+package publicapi
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// users with their role and a chain broken at entry 3
+type auditChainUserClient struct {
+	roleUserClient
+}
+
+func (c auditChainUserClient) VerifyAuditChain(ctx context.Context) (*AuditChainVerificationResponse, error) {
+	return &AuditChainVerificationResponse{Result: true, Verification: AuditChainVerification{Entries: 2, HeadID: 2, HeadHash: "b", BrokenID: 3}}, nil
+}
+
+func TestAuditorMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	previousClient := userClient
+	userClient = auditChainUserClient{roleUserClient{roles: map[int]string{1: roleAdmin, 2: roleAuditor}}}
+	jwtSecret, internalAPIKey = []byte("secret"), "key"
+	defer func() { userClient, jwtSecret, internalAPIKey = previousClient, nil, "" }()
+
+	router := gin.New()
+	auditor := router.Group("/public-api/auditor", auditorMiddleware())
+	auditor.GET("/audit-chain/verify", verifyAuditChainHandler)
+
+	token := func(userID int) string {
+		claims := jwt.RegisteredClaims{Subject: strconv.Itoa(userID), ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour))}
+		signed, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(jwtSecret)
+		if err != nil {
+			t.Fatalf("sign token: %v", err)
+		}
+		return "Bearer " + signed
+	}
+
+	tests := []struct {
+		name   string
+		header map[string]string
+		want   int
+	}{
+		{"auditor", map[string]string{"Authorization": token(2)}, http.StatusOK},
+		// the admins are the ones audited
+		{"admin", map[string]string{"Authorization": token(1)}, http.StatusForbidden},
+		{"no token", nil, http.StatusUnauthorized},
+		{"api key", map[string]string{headerAPIKey: "key"}, http.StatusOK},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, "/public-api/auditor/audit-chain/verify", nil)
+		for key, value := range tt.header {
+			req.Header.Set(key, value)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		if w.Code != tt.want {
+			t.Errorf("%s: status %d, want %d", tt.name, w.Code, tt.want)
+		}
+		if want := `{"verification":{"valid":false,"entries":2,"head_id":2,"head_hash":"b","broken_id":3,"anchors":0}}`; w.Code == http.StatusOK && w.Body.String() != want {
+			t.Errorf("%s: body %s, want %s", tt.name, w.Body.String(), want)
+		}
+	}
+}
+
+func TestGetAuditChainUsecase(t *testing.T) {
+	for _, page := range [][2]int{{-1, 10}, {0, 0}, {0, 1001}} {
+		if _, err := getAuditChainUsecase(context.Background(), int64(page[0]), page[1]); err != errAuditChainPage {
+			t.Errorf("after_id %d limit %d: %v, want %v", page[0], page[1], err, errAuditChainPage)
+		}
+	}
+}
@@ -0,0 +1,181 @@
+package publicapi
+
+import (
+	"bytes"
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"apperror"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const ctxKeyAuthUserID = "auth_user_id"
+
+// JWT_SECRET shared with user service which issue the tokens
+var jwtSecret = []byte(cfg.String("JWT_SECRET", ""))
+
+var ErrInvalidCredentials = errors.New("invalid credentials")
+
+type Login struct {
+	UserID   int    `json:"user_id" binding:"required"`
+	Password string `json:"password" binding:"required"`
+}
+
+type LoginResponse struct {
+	Result    bool   `json:"result"`
+	Token     string `json:"token"`
+	ExpiresAt int64  `json:"expires_at"`
+}
+
+// =========== MIDDLEWARE LAYER, RUN BEFORE INTERFACE HANDLER TO ENRICH OR GUARD THE REQUEST ===========
+
+// reject request without valid bearer token, set authenticated user id on context
+func authMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if authenticate(c) {
+			c.Next()
+		}
+	}
+}
+
+// set the user id of the bearer token on context, false with the request aborted when the token is missing or invalid
+func authenticate(c *gin.Context) bool {
+	header := c.GetHeader("Authorization")
+	tokenString, found := strings.CutPrefix(header, "Bearer ")
+	if !found || tokenString == "" {
+		apperror.Abort(c, http.StatusUnauthorized, "Missing bearer token")
+		return false
+	}
+
+	userID, err := parseToken(tokenString)
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "middleware error", "code", "049", "error", err)
+		apperror.Abort(c, http.StatusUnauthorized, "Invalid token")
+		return false
+	}
+
+	c.Set(ctxKeyAuthUserID, userID)
+	return true
+}
+
+// validate signature and expiry, return user id from subject
+func parseToken(tokenString string) (int, error) {
+	if len(jwtSecret) == 0 {
+		return 0, errors.New("JWT_SECRET is not set")
+	}
+
+	claims := &jwt.RegisteredClaims{}
+	_, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		return jwtSecret, nil
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}), jwt.WithExpirationRequired())
+	if err != nil {
+		return 0, err
+	}
+
+	return strconv.Atoi(claims.Subject)
+}
+
+// get authenticated user id set by authMiddleware
+func authUserID(c *gin.Context) int {
+	return c.GetInt(ctxKeyAuthUserID)
+}
+
+// reject operator request without the internal api key on X-API-Key header, open when no key is set
+func apiKeyMiddleware(key string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if key == "" {
+			c.Next()
+			return
+		}
+
+		if subtle.ConstantTimeCompare([]byte(c.GetHeader(headerAPIKey)), []byte(key)) != 1 {
+			slog.ErrorContext(c.Request.Context(), "middleware error", "code", "108", "error", "invalid api key")
+			apperror.Abort(c, http.StatusUnauthorized, "Invalid API key")
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// =========== INTERFACE HANDLER, HANDLING REQUEST RESPONSE API DEPEND INTERFACE ===========
+
+func loginHandler(c *gin.Context) {
+	var body Login
+	if err := c.ShouldBindJSON(&body); err != nil {
+		slog.ErrorContext(c.Request.Context(), "handler error", "code", "050", "error", err)
+		apperror.RespondBinding(c, err)
+		return
+	}
+
+	res, err := loginUsecase(c.Request.Context(), body)
+	if err != nil {
+		if errors.Is(err, ErrInvalidCredentials) {
+			apperror.JSON(c, http.StatusUnauthorized, "Invalid user ID or password")
+			return
+		}
+		apperror.Respond(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"token": res.Token, "expires_at": res.ExpiresAt})
+}
+
+// =========== USECASE LAYER, SERVES AS AN INTERMEDIARY BETWEEN THE PRESENTATION LAYER AND THE DATA LAYER ===========
+
+func loginUsecase(ctx context.Context, login Login) (*LoginResponse, error) {
+	loginJSON, err := json.Marshal(login)
+	if err != nil {
+		slog.ErrorContext(ctx, "usecase error", "code", "051", "error", err)
+		return nil, err
+	}
+
+	res, err := userClient.Login(ctx, loginJSON)
+	if err != nil {
+		if errors.Is(err, ErrInvalidCredentials) {
+			return nil, err
+		}
+		return nil, apperror.Upstream("Failed to login", err)
+	}
+
+	return res, nil
+}
+
+// =========== REPOSITORY LAYER, ABSTRACTION OVER THE DATA PERSISTENCE (databases, file systems, or external APIs) ===========
+
+// user service api path
+var apiPathUserLogin = userServiceURL + "/login"
+
+func (httpUserClient) Login(ctx context.Context, loginByte []byte) (*LoginResponse, error) {
+	resp, err := httpPost(ctx, apiPathUserLogin, "application/json", bytes.NewBuffer(loginByte))
+	if err != nil {
+		slog.ErrorContext(ctx, "service error", "code", "052", "error", err)
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusUnauthorized {
+		return nil, ErrInvalidCredentials
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		slog.ErrorContext(ctx, "service error", "code", "053", "error", "error login from user service")
+		return nil, errors.New("error login from user service")
+	}
+
+	var login LoginResponse
+	if err := decodeJSON(resp.Body, &login); err != nil {
+		slog.ErrorContext(ctx, "service error", "code", "054", "error", err)
+		return nil, err
+	}
+
+	return &login, nil
+}
@@ -0,0 +1,232 @@
+package publicapi
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+
+	"apperror"
+
+	"github.com/gin-gonic/gin"
+)
+
+// user blocked by another user, blocked users can not contact the user who blocked them
+type Block struct {
+	UserID        int   `json:"user_id"`
+	BlockedUserID int   `json:"blocked_user_id"`
+	CreatedAt     int64 `json:"created_at"`
+}
+
+type BlockCreate struct {
+	BlockedUserID int `json:"blocked_user_id" binding:"required,gt=0"`
+}
+
+type BlockResponse struct {
+	Result bool `json:"result"`
+	Block  Block
+}
+
+type BlocksResponse struct {
+	Result bool `json:"result"`
+	Blocks []Block
+}
+
+var (
+	ErrBlockInvalid = apperror.Validation("users can not block themselves")
+
+	// answered to senders blocked by the recipient, the message does not tell them they are blocked
+	errContactRefused = errors.New("sender is blocked by recipient")
+)
+
+// =========== INTERFACE HANDLER, HANDLING REQUEST RESPONSE API DEPEND INTERFACE ===========
+
+// users blocked by the authenticated user, latest first
+func getBlocksHandler(c *gin.Context) {
+	res, err := getBlocksUsecase(c.Request.Context(), authUserID(c))
+	if err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"blocks": res})
+}
+
+func blockUserHandler(c *gin.Context) {
+	var body BlockCreate
+	if err := c.ShouldBindJSON(&body); err != nil {
+		slog.ErrorContext(c.Request.Context(), "handler error", "code", "225", "error", err)
+		apperror.RespondBinding(c, err)
+		return
+	}
+
+	res, err := blockUserUsecase(c.Request.Context(), authUserID(c), body)
+	if err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"block": res})
+}
+
+func unblockUserHandler(c *gin.Context) {
+	blockedID, err := strconv.Atoi(c.Param("user_id"))
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "handler error", "code", "226", "error", err)
+		apperror.JSON(c, http.StatusBadRequest, "Invalid user ID")
+		return
+	}
+
+	if err := unblockUserUsecase(c.Request.Context(), authUserID(c), blockedID); err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// answer errContactRefused with a generic failure, other errors as their kind
+func respondContactError(c *gin.Context, err error) {
+	if errors.Is(err, errContactRefused) {
+		apperror.JSON(c, http.StatusForbidden, "Request could not be completed")
+		return
+	}
+
+	apperror.Respond(c, err)
+}
+
+// =========== USECASE LAYER, SERVES AS AN INTERMEDIARY BETWEEN THE PRESENTATION LAYER AND THE DATA LAYER ===========
+
+func getBlocksUsecase(ctx context.Context, userID int) ([]Block, error) {
+	res, err := userClient.FindUserBlocks(ctx, userID)
+	if err != nil {
+		return nil, apperror.Upstream("Failed to get blocks", err)
+	}
+
+	return res.Blocks, nil
+}
+
+func blockUserUsecase(ctx context.Context, userID int, block BlockCreate) (*Block, error) {
+	if block.BlockedUserID == userID {
+		return nil, ErrBlockInvalid
+	}
+
+	blockJSON, err := json.Marshal(block)
+	if err != nil {
+		slog.ErrorContext(ctx, "usecase error", "code", "227", "error", err)
+		return nil, err
+	}
+
+	res, err := userClient.CreateUserBlock(ctx, userID, blockJSON)
+	if err != nil {
+		if errors.Is(err, ErrUserNotFound) || errors.Is(err, ErrBlockInvalid) {
+			return nil, err
+		}
+		return nil, apperror.Upstream("Failed to block user", err)
+	}
+
+	return &res.Block, nil
+}
+
+func unblockUserUsecase(ctx context.Context, userID, blockedUserID int) error {
+	if err := userClient.DeleteUserBlock(ctx, userID, blockedUserID); err != nil {
+		return apperror.Upstream("Failed to unblock user", err)
+	}
+
+	return nil
+}
+
+// errContactRefused when recipient blocked sender, for every request reaching another user
+func checkNotBlocked(ctx context.Context, recipientID, senderID int) error {
+	res, err := userClient.FindUserBlocks(ctx, recipientID)
+	if err != nil {
+		return apperror.Upstream("Failed to get blocks", err)
+	}
+
+	for _, block := range res.Blocks {
+		if block.BlockedUserID == senderID {
+			slog.InfoContext(ctx, "contact refused, sender is blocked", "recipient_id", recipientID, "sender_id", senderID)
+			return errContactRefused
+		}
+	}
+
+	return nil
+}
+
+// =========== REPOSITORY LAYER, ABSTRACTION OVER THE DATA PERSISTENCE (databases, file systems, or external APIs) ===========
+
+var (
+	// user service api path
+	apiPathUserBlocks = userServiceURL + "/users/%d/blocks"
+	apiPathUserBlock  = userServiceURL + "/users/%d/blocks/%d"
+)
+
+func (httpUserClient) FindUserBlocks(ctx context.Context, userID int) (*BlocksResponse, error) {
+	resp, err := httpGet(ctx, fmt.Sprintf(apiPathUserBlocks, userID))
+	if err != nil {
+		slog.ErrorContext(ctx, "service error", "code", "228", "error", err)
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		slog.ErrorContext(ctx, "service error", "code", "229", "error", "error fetching blocks from user service")
+		return nil, errors.New("error fetching blocks from user service")
+	}
+
+	var blocks BlocksResponse
+	if err := decodeJSON(resp.Body, &blocks); err != nil {
+		slog.ErrorContext(ctx, "service error", "code", "230", "error", err)
+		return nil, err
+	}
+
+	return &blocks, nil
+}
+
+func (httpUserClient) CreateUserBlock(ctx context.Context, userID int, blockByte []byte) (*BlockResponse, error) {
+	resp, err := httpPost(ctx, fmt.Sprintf(apiPathUserBlocks, userID), "application/json", bytes.NewBuffer(blockByte))
+	if err != nil {
+		slog.ErrorContext(ctx, "service error", "code", "231", "error", err)
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusCreated:
+	case http.StatusNotFound:
+		return nil, ErrUserNotFound
+	case http.StatusBadRequest:
+		return nil, ErrBlockInvalid
+	default:
+		slog.ErrorContext(ctx, "service error", "code", "232", "error", "error creating block from user service")
+		return nil, errors.New("error creating block from user service")
+	}
+
+	var block BlockResponse
+	if err := decodeJSON(resp.Body, &block); err != nil {
+		slog.ErrorContext(ctx, "service error", "code", "233", "error", err)
+		return nil, err
+	}
+
+	return &block, nil
+}
+
+func (httpUserClient) DeleteUserBlock(ctx context.Context, userID, blockedUserID int) error {
+	resp, err := httpDelete(ctx, fmt.Sprintf(apiPathUserBlock, userID, blockedUserID))
+	if err != nil {
+		slog.ErrorContext(ctx, "service error", "code", "234", "error", err)
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		slog.ErrorContext(ctx, "service error", "code", "235", "error", "error deleting block from user service")
+		return errors.New("error deleting block from user service")
+	}
+
+	return nil
+}
@@ -0,0 +1,175 @@
+package publicapi
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// =========== REPOSITORY LAYER, CIRCUIT BREAKER PER DOWNSTREAM HOST ===========
+
+const (
+	breakerClosed   = "closed"
+	breakerOpen     = "open"
+	breakerHalfOpen = "half_open"
+)
+
+var errCircuitOpen = errors.New("circuit open: downstream service unavailable")
+
+// state of one downstream host
+type breaker struct {
+	state    string
+	failures int
+	openedAt time.Time
+	// a half open breaker lets one probe through, the others keep failing fast
+	probing bool
+}
+
+// fail fast for a cool-down period after consecutive failures of a host, calls counted after retries
+type breakerTransport struct {
+	base      http.RoundTripper
+	threshold int
+	cooldown  time.Duration
+
+	mu       sync.Mutex
+	breakers map[string]*breaker
+}
+
+// DOWNSTREAM_BREAKER_THRESHOLD consecutive failed calls opening the breaker, 0 disables it
+// DOWNSTREAM_BREAKER_COOLDOWN duration calls fail fast before a probe call is let through
+func newBreakerTransport(base http.RoundTripper) *breakerTransport {
+	return &breakerTransport{
+		base:      base,
+		threshold: cfg.Int("DOWNSTREAM_BREAKER_THRESHOLD", 5),
+		cooldown:  cfg.Duration("DOWNSTREAM_BREAKER_COOLDOWN", 30*time.Second),
+		breakers:  map[string]*breaker{},
+	}
+}
+
+func (t *breakerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if t.threshold <= 0 {
+		return t.base.RoundTrip(req)
+	}
+
+	host := req.URL.Host
+	if !t.allow(host) {
+		return nil, errCircuitOpen
+	}
+
+	resp, err := t.base.RoundTrip(req)
+	// cancelled by the client or shutdown, says nothing about the host
+	if req.Context().Err() != nil {
+		t.release(host)
+		return resp, err
+	}
+
+	t.record(host, !retryable(resp, err))
+	return resp, err
+}
+
+func (t *breakerTransport) allow(host string) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	b := t.breakers[host]
+	if b == nil {
+		b = &breaker{state: breakerClosed}
+		t.breakers[host] = b
+	}
+
+	switch b.state {
+	case breakerOpen:
+		if time.Since(b.openedAt) < t.cooldown {
+			return false
+		}
+		b.state = breakerHalfOpen
+		b.probing = true
+		slog.Info("circuit breaker half open, probing", "host", host)
+		return true
+	case breakerHalfOpen:
+		if b.probing {
+			return false
+		}
+		b.probing = true
+		return true
+	}
+
+	return true
+}
+
+// let the next call probe again when the probe did not finish
+func (t *breakerTransport) release(host string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.breakers[host].probing = false
+}
+
+func (t *breakerTransport) record(host string, success bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	b := t.breakers[host]
+	b.probing = false
+
+	if success {
+		if b.state != breakerClosed {
+			slog.Info("circuit breaker closed", "host", host)
+		}
+		b.state = breakerClosed
+		b.failures = 0
+		return
+	}
+
+	b.failures++
+	if b.state == breakerHalfOpen || b.failures >= t.threshold {
+		if b.state != breakerOpen {
+			slog.Warn("circuit breaker open", "host", host, "failures", b.failures)
+		}
+		b.state = breakerOpen
+		b.openedAt = time.Now()
+	}
+}
+
+// breaker state of one host for diagnostics
+type BreakerStatus struct {
+	Host     string `json:"host"`
+	State    string `json:"state"`
+	Failures int    `json:"failures"`
+	OpenedAt *int64 `json:"opened_at"`
+}
+
+// snapshot of every host called so far, sorted by host
+func (t *breakerTransport) statuses() []BreakerStatus {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	statuses := []BreakerStatus{}
+	for host, b := range t.breakers {
+		status := BreakerStatus{Host: host, State: b.state, Failures: b.failures}
+		// an open breaker past the cool-down is half open for the next call
+		if b.state == breakerOpen && time.Since(b.openedAt) >= t.cooldown {
+			status.State = breakerHalfOpen
+		}
+		if !b.openedAt.IsZero() {
+			openedAt := b.openedAt.UnixNano() / int64(time.Microsecond)
+			status.OpenedAt = &openedAt
+		}
+		statuses = append(statuses, status)
+	}
+	sort.Slice(statuses, func(i, j int) bool { return statuses[i].Host < statuses[j].Host })
+
+	return statuses
+}
+
+// =========== INTERFACE HANDLER, HANDLING REQUEST RESPONSE API DEPEND INTERFACE ===========
+
+// handler request response circuit breaker state per downstream host
+func getBreakersHandler(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"breakers": downstreamBreaker.statuses()})
+}
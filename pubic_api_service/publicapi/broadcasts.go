@@ -0,0 +1,576 @@
+package publicapi
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"apperror"
+
+	"github.com/gin-gonic/gin"
+)
+
+// users an announcement is sent to, every user when no filter is set and users matching all the filters set otherwise
+type BroadcastAudience struct {
+	UserIDs []int `json:"user_ids,omitempty" binding:"max=10000"`
+	// signed up at or after and before, unix microseconds
+	CreatedAfter  int64 `json:"created_after,omitempty" binding:"min=0"`
+	CreatedBefore int64 `json:"created_before,omitempty" binding:"min=0"`
+	// users with a valid push device of the platform
+	Platform string `json:"platform,omitempty" binding:"omitempty,oneof=fcm apns"`
+}
+
+// announcement of operators kept by the user service, status is scheduled, sending, sent or cancelled. Recipients
+// are the users handed out to the broadcast workers so far, sent, failed and muted the outcome of their notification
+type Broadcast struct {
+	ID          int               `json:"id"`
+	Title       string            `json:"title"`
+	Body        string            `json:"body"`
+	Audience    BroadcastAudience `json:"audience"`
+	Status      string            `json:"status"`
+	ScheduledAt int64             `json:"scheduled_at"`
+	Recipients  int               `json:"recipients"`
+	Sent        int               `json:"sent"`
+	Failed      int               `json:"failed"`
+	Muted       int               `json:"muted"`
+	CreatedAt   int64             `json:"created_at"`
+	UpdatedAt   int64             `json:"updated_at"`
+	StartedAt   *int64            `json:"started_at"`
+	FinishedAt  *int64            `json:"finished_at"`
+}
+
+type BroadcastCreate struct {
+	Title    string            `json:"title" binding:"required,notblank,max=200"`
+	Body     string            `json:"body" binding:"required,notblank,max=2000"`
+	Audience BroadcastAudience `json:"audience"`
+	// unix microseconds, sent right away when zero or past
+	ScheduledAt int64 `json:"scheduled_at" binding:"min=0"`
+}
+
+type BroadcastStats struct {
+	Sent   int `json:"sent"`
+	Failed int `json:"failed"`
+	Muted  int `json:"muted"`
+}
+
+type BroadcastResponse struct {
+	Result        bool `json:"result"`
+	Broadcast     Broadcast
+	AudienceCount int `json:"audience_count"`
+}
+
+type BroadcastsResponse struct {
+	Result     bool `json:"result"`
+	Broadcasts []Broadcast
+}
+
+type BroadcastAudienceResponse struct {
+	Result        bool `json:"result"`
+	AudienceCount int  `json:"audience_count"`
+}
+
+// next recipients of the due broadcast, the broadcast is nil when none is due
+type BroadcastBatchResponse struct {
+	Result    bool `json:"result"`
+	Broadcast *Broadcast
+	UserIDs   []int `json:"user_ids"`
+}
+
+var (
+	ErrBroadcastInvalid  = apperror.Validation("created_after must be before created_before")
+	ErrBroadcastNotFound = apperror.NotFound("Broadcast not found")
+	ErrBroadcastFinished = apperror.Conflict("broadcast already sent or cancelled")
+
+	errBroadcastsLimit = apperror.Validation("limit must be between 1 and 200")
+)
+
+// =========== INTERFACE HANDLER, HANDLING REQUEST RESPONSE API DEPEND INTERFACE ===========
+
+// broadcasts newest first with their delivery statistics
+func getBroadcastsHandler(c *gin.Context) {
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "50"))
+	if err != nil {
+		apperror.Respond(c, errBroadcastsLimit)
+		return
+	}
+
+	res, err := getBroadcastsUsecase(c.Request.Context(), limit)
+	if err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"broadcasts": res})
+}
+
+// schedule an announcement, answered with the number of users its audience has now
+func createBroadcastHandler(c *gin.Context) {
+	var body BroadcastCreate
+	if err := c.ShouldBindJSON(&body); err != nil {
+		slog.ErrorContext(c.Request.Context(), "handler error", "code", "385", "error", err)
+		apperror.RespondBinding(c, err)
+		return
+	}
+
+	res, err := createBroadcastUsecase(c.Request.Context(), body)
+	if err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"broadcast": res.Broadcast, "audience_count": res.AudienceCount})
+}
+
+// number of users of an audience, to preview it before scheduling
+func countBroadcastAudienceHandler(c *gin.Context) {
+	var body BroadcastAudience
+	if err := c.ShouldBindJSON(&body); err != nil {
+		slog.ErrorContext(c.Request.Context(), "handler error", "code", "386", "error", err)
+		apperror.RespondBinding(c, err)
+		return
+	}
+
+	count, err := countBroadcastAudienceUsecase(c.Request.Context(), body)
+	if err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"audience_count": count})
+}
+
+func getBroadcastHandler(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "handler error", "code", "387", "error", err)
+		apperror.JSON(c, http.StatusBadRequest, "Invalid broadcast ID")
+		return
+	}
+
+	res, err := getBroadcastUsecase(c.Request.Context(), id)
+	if err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"broadcast": res})
+}
+
+// cancel a broadcast not sent yet, users already handed out to a worker still get it
+func cancelBroadcastHandler(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "handler error", "code", "388", "error", err)
+		apperror.JSON(c, http.StatusBadRequest, "Invalid broadcast ID")
+		return
+	}
+
+	res, err := cancelBroadcastUsecase(c.Request.Context(), id)
+	if err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"broadcast": res})
+}
+
+// =========== USECASE LAYER, SERVES AS AN INTERMEDIARY BETWEEN THE PRESENTATION LAYER AND THE DATA LAYER ===========
+
+func getBroadcastsUsecase(ctx context.Context, limit int) ([]Broadcast, error) {
+	if limit < 1 || limit > 200 {
+		return nil, errBroadcastsLimit
+	}
+
+	res, err := userClient.FindBroadcasts(ctx, limit)
+	if err != nil {
+		return nil, apperror.Upstream("Failed to get broadcasts", err)
+	}
+
+	return res.Broadcasts, nil
+}
+
+func createBroadcastUsecase(ctx context.Context, body BroadcastCreate) (*BroadcastResponse, error) {
+	if err := validateBroadcastAudience(body.Audience); err != nil {
+		return nil, err
+	}
+
+	broadcastJSON, err := json.Marshal(body)
+	if err != nil {
+		slog.ErrorContext(ctx, "usecase error", "code", "389", "error", err)
+		return nil, err
+	}
+
+	res, err := userClient.CreateBroadcast(ctx, broadcastJSON)
+	if err != nil {
+		if errors.Is(err, ErrBroadcastInvalid) {
+			return nil, err
+		}
+		return nil, apperror.Upstream("Failed to create broadcast", err)
+	}
+
+	return res, nil
+}
+
+func countBroadcastAudienceUsecase(ctx context.Context, audience BroadcastAudience) (int, error) {
+	if err := validateBroadcastAudience(audience); err != nil {
+		return 0, err
+	}
+
+	audienceJSON, err := json.Marshal(audience)
+	if err != nil {
+		slog.ErrorContext(ctx, "usecase error", "code", "389", "error", err)
+		return 0, err
+	}
+
+	res, err := userClient.CountBroadcastAudience(ctx, audienceJSON)
+	if err != nil {
+		if errors.Is(err, ErrBroadcastInvalid) {
+			return 0, err
+		}
+		return 0, apperror.Upstream("Failed to count audience", err)
+	}
+
+	return res.AudienceCount, nil
+}
+
+func validateBroadcastAudience(audience BroadcastAudience) error {
+	if audience.CreatedAfter > 0 && audience.CreatedBefore > 0 && audience.CreatedAfter >= audience.CreatedBefore {
+		return ErrBroadcastInvalid
+	}
+	return nil
+}
+
+func getBroadcastUsecase(ctx context.Context, id int) (*Broadcast, error) {
+	res, err := userClient.FindBroadcast(ctx, id)
+	if err != nil {
+		if errors.Is(err, ErrBroadcastNotFound) {
+			return nil, err
+		}
+		return nil, apperror.Upstream("Failed to get broadcast", err)
+	}
+
+	return &res.Broadcast, nil
+}
+
+func cancelBroadcastUsecase(ctx context.Context, id int) (*Broadcast, error) {
+	res, err := userClient.CancelBroadcast(ctx, id)
+	if err != nil {
+		if errors.Is(err, ErrBroadcastNotFound) || errors.Is(err, ErrBroadcastFinished) {
+			return nil, err
+		}
+		return nil, apperror.Upstream("Failed to cancel broadcast", err)
+	}
+
+	return &res.Broadcast, nil
+}
+
+// =========== WORKER, SEND THE DUE BROADCASTS IN BACKGROUND ===========
+
+const notificationAnnouncement = "announcement"
+
+// BROADCAST_INTERVAL wait between the rounds looking for due broadcasts, 0 disables broadcasts
+// BROADCAST_BATCH_SIZE recipients claimed per call to the user service
+// BROADCAST_RATE notifications sent per second by each instance, 0 unthrottled
+var (
+	broadcastInterval  = cfg.Duration("BROADCAST_INTERVAL", time.Minute)
+	broadcastBatchSize = cfg.Int("BROADCAST_BATCH_SIZE", 100)
+	broadcastRate      = cfg.Int("BROADCAST_RATE", 20)
+
+	broadcastsStop = make(chan struct{})
+	broadcastsDone = make(chan struct{})
+)
+
+// send the due broadcasts every BROADCAST_INTERVAL, the user service hands each recipient out once so several
+// instances share the fan-out without notifying a user twice
+func startBroadcasts() {
+	if broadcastInterval <= 0 {
+		close(broadcastsDone)
+		return
+	}
+
+	go func() {
+		defer close(broadcastsDone)
+
+		ticker := time.NewTicker(broadcastInterval)
+		defer ticker.Stop()
+		for {
+			sendBroadcasts()
+
+			select {
+			case <-broadcastsStop:
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// wait for the running broadcast batch
+func stopBroadcasts(ctx context.Context) {
+	close(broadcastsStop)
+
+	select {
+	case <-broadcastsDone:
+	case <-ctx.Done():
+		slog.ErrorContext(ctx, "worker error", "code", "390", "error", "shutdown timeout, broadcast batch still running")
+	}
+}
+
+// claim recipients until no broadcast is due, each batch is sent at BROADCAST_RATE and its outcome added to the
+// statistics of its broadcast
+func sendBroadcasts() {
+	ctx := context.Background()
+
+	var throttle <-chan time.Time
+	if broadcastRate > 0 {
+		ticker := time.NewTicker(time.Second / time.Duration(broadcastRate))
+		defer ticker.Stop()
+		throttle = ticker.C
+	}
+
+	for {
+		res, err := userClient.ClaimBroadcastRecipients(ctx, broadcastBatchSize)
+		if err != nil {
+			slog.ErrorContext(ctx, "worker error", "code", "391", "error", err)
+			return
+		}
+		if res.Broadcast == nil {
+			return
+		}
+
+		stats := sendBroadcastBatch(ctx, res.Broadcast, res.UserIDs, throttle)
+		if stats != (BroadcastStats{}) {
+			statsJSON, _ := json.Marshal(stats)
+			if err := userClient.RecordBroadcastStats(ctx, res.Broadcast.ID, statsJSON); err != nil {
+				slog.ErrorContext(ctx, "worker error", "code", "392", "error", err, "broadcast_id", res.Broadcast.ID)
+			}
+		}
+		if res.Broadcast.Status == "sent" {
+			slog.InfoContext(ctx, "broadcast sent", "broadcast_id", res.Broadcast.ID, "recipients", res.Broadcast.Recipients)
+		}
+
+		select {
+		case <-broadcastsStop:
+			return
+		default:
+		}
+	}
+}
+
+// notify each user of the batch over the channels they enabled for announcements, waiting on throttle before each
+func sendBroadcastBatch(ctx context.Context, broadcast *Broadcast, userIDs []int, throttle <-chan time.Time) BroadcastStats {
+	var stats BroadcastStats
+	for _, userID := range userIDs {
+		if throttle != nil {
+			<-throttle
+		}
+
+		n := Notification{
+			Event:       notificationAnnouncement,
+			UserID:      userID,
+			BroadcastID: broadcast.ID,
+			Subject:     broadcast.Title,
+			Body:        broadcast.Body,
+			CreatedAt:   time.Now().UnixMicro(),
+		}
+		result := deliverNotification(ctx, n)
+		notificationsTotal.WithLabelValues(n.Event, result).Inc()
+
+		switch result {
+		case "failed":
+			stats.Failed++
+		case "muted":
+			stats.Muted++
+		default:
+			stats.Sent++
+		}
+	}
+	return stats
+}
+
+// =========== REPOSITORY LAYER, ABSTRACTION OVER THE DATA PERSISTENCE (databases, file systems, or external APIs) ===========
+
+var (
+	// user service api path
+	apiPathBroadcasts             = userServiceURL + "/broadcasts"
+	apiPathBroadcast              = userServiceURL + "/broadcasts/%d"
+	apiPathBroadcastAudienceCount = userServiceURL + "/broadcasts/audience-count"
+	apiPathBroadcastClaim         = userServiceURL + "/broadcasts/claim"
+	apiPathBroadcastStats         = userServiceURL + "/broadcasts/%d/stats"
+)
+
+func (httpUserClient) FindBroadcasts(ctx context.Context, limit int) (*BroadcastsResponse, error) {
+	resp, err := httpGet(ctx, apiPathBroadcasts+"?limit="+strconv.Itoa(limit))
+	if err != nil {
+		slog.ErrorContext(ctx, "service error", "code", "393", "error", err)
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		slog.ErrorContext(ctx, "service error", "code", "394", "error", "error fetching broadcasts from user service")
+		return nil, errors.New("error fetching broadcasts from user service")
+	}
+
+	var broadcasts BroadcastsResponse
+	if err := decodeJSON(resp.Body, &broadcasts); err != nil {
+		slog.ErrorContext(ctx, "service error", "code", "394", "error", err)
+		return nil, err
+	}
+
+	return &broadcasts, nil
+}
+
+func (httpUserClient) CreateBroadcast(ctx context.Context, broadcastByte []byte) (*BroadcastResponse, error) {
+	resp, err := httpPost(ctx, apiPathBroadcasts, "application/json", bytes.NewBuffer(broadcastByte))
+	if err != nil {
+		slog.ErrorContext(ctx, "service error", "code", "395", "error", err)
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusCreated:
+	case http.StatusBadRequest:
+		return nil, ErrBroadcastInvalid
+	default:
+		slog.ErrorContext(ctx, "service error", "code", "396", "error", "error creating broadcast from user service")
+		return nil, errors.New("error creating broadcast from user service")
+	}
+
+	var broadcast BroadcastResponse
+	if err := decodeJSON(resp.Body, &broadcast); err != nil {
+		slog.ErrorContext(ctx, "service error", "code", "396", "error", err)
+		return nil, err
+	}
+
+	return &broadcast, nil
+}
+
+func (httpUserClient) FindBroadcast(ctx context.Context, broadcastID int) (*BroadcastResponse, error) {
+	resp, err := httpGet(ctx, fmt.Sprintf(apiPathBroadcast, broadcastID))
+	if err != nil {
+		slog.ErrorContext(ctx, "service error", "code", "397", "error", err)
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		return nil, ErrBroadcastNotFound
+	default:
+		slog.ErrorContext(ctx, "service error", "code", "398", "error", "error fetching broadcast from user service")
+		return nil, errors.New("error fetching broadcast from user service")
+	}
+
+	var broadcast BroadcastResponse
+	if err := decodeJSON(resp.Body, &broadcast); err != nil {
+		slog.ErrorContext(ctx, "service error", "code", "398", "error", err)
+		return nil, err
+	}
+
+	return &broadcast, nil
+}
+
+func (httpUserClient) CancelBroadcast(ctx context.Context, broadcastID int) (*BroadcastResponse, error) {
+	resp, err := httpDelete(ctx, fmt.Sprintf(apiPathBroadcast, broadcastID))
+	if err != nil {
+		slog.ErrorContext(ctx, "service error", "code", "399", "error", err)
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		return nil, ErrBroadcastNotFound
+	case http.StatusConflict:
+		return nil, ErrBroadcastFinished
+	default:
+		slog.ErrorContext(ctx, "service error", "code", "400", "error", "error cancelling broadcast from user service")
+		return nil, errors.New("error cancelling broadcast from user service")
+	}
+
+	var broadcast BroadcastResponse
+	if err := decodeJSON(resp.Body, &broadcast); err != nil {
+		slog.ErrorContext(ctx, "service error", "code", "400", "error", err)
+		return nil, err
+	}
+
+	return &broadcast, nil
+}
+
+func (httpUserClient) CountBroadcastAudience(ctx context.Context, audienceByte []byte) (*BroadcastAudienceResponse, error) {
+	resp, err := httpPost(ctx, apiPathBroadcastAudienceCount, "application/json", bytes.NewBuffer(audienceByte))
+	if err != nil {
+		slog.ErrorContext(ctx, "service error", "code", "401", "error", err)
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusBadRequest:
+		return nil, ErrBroadcastInvalid
+	default:
+		slog.ErrorContext(ctx, "service error", "code", "402", "error", "error counting audience from user service")
+		return nil, errors.New("error counting audience from user service")
+	}
+
+	var count BroadcastAudienceResponse
+	if err := decodeJSON(resp.Body, &count); err != nil {
+		slog.ErrorContext(ctx, "service error", "code", "402", "error", err)
+		return nil, err
+	}
+
+	return &count, nil
+}
+
+func (httpUserClient) ClaimBroadcastRecipients(ctx context.Context, limit int) (*BroadcastBatchResponse, error) {
+	claim, _ := json.Marshal(map[string]int{"limit": limit})
+	resp, err := httpPost(ctx, apiPathBroadcastClaim, "application/json", bytes.NewBuffer(claim))
+	if err != nil {
+		slog.ErrorContext(ctx, "service error", "code", "403", "error", err)
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		slog.ErrorContext(ctx, "service error", "code", "404", "error", "error claiming broadcast recipients from user service")
+		return nil, errors.New("error claiming broadcast recipients from user service")
+	}
+
+	var batch BroadcastBatchResponse
+	if err := decodeJSON(resp.Body, &batch); err != nil {
+		slog.ErrorContext(ctx, "service error", "code", "404", "error", err)
+		return nil, err
+	}
+
+	return &batch, nil
+}
+
+func (httpUserClient) RecordBroadcastStats(ctx context.Context, broadcastID int, statsByte []byte) error {
+	resp, err := httpPost(ctx, fmt.Sprintf(apiPathBroadcastStats, broadcastID), "application/json", bytes.NewBuffer(statsByte))
+	if err != nil {
+		slog.ErrorContext(ctx, "service error", "code", "405", "error", err)
+		return err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return nil
+	case http.StatusNotFound:
+		return ErrBroadcastNotFound
+	default:
+		slog.ErrorContext(ctx, "service error", "code", "406", "error", "error recording broadcast stats from user service")
+		return errors.New("error recording broadcast stats from user service")
+	}
+}
@@ -0,0 +1,77 @@
+package publicapi
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+// user client handing out fixed batches of recipients and keeping the stats recorded
+type broadcastUserClient struct {
+	preferencesUserClient
+	batches *[]BroadcastBatchResponse
+	stats   map[int]BroadcastStats
+}
+
+func (c broadcastUserClient) ClaimBroadcastRecipients(ctx context.Context, limit int) (*BroadcastBatchResponse, error) {
+	if len(*c.batches) == 0 {
+		return &BroadcastBatchResponse{Result: true}, nil
+	}
+
+	batch := (*c.batches)[0]
+	*c.batches = (*c.batches)[1:]
+	return &batch, nil
+}
+
+func (c broadcastUserClient) RecordBroadcastStats(ctx context.Context, broadcastID int, statsByte []byte) error {
+	var stats BroadcastStats
+	if err := json.Unmarshal(statsByte, &stats); err != nil {
+		return err
+	}
+
+	total := c.stats[broadcastID]
+	c.stats[broadcastID] = BroadcastStats{Sent: total.Sent + stats.Sent, Failed: total.Failed + stats.Failed, Muted: total.Muted + stats.Muted}
+	return nil
+}
+
+func TestSendBroadcasts(t *testing.T) {
+	notifications := newNotificationRecorder(t)
+
+	broadcast := &Broadcast{ID: 4, Title: "Maintenance tonight", Body: "Listings are read-only from 22:00 to 23:00", Status: "sending"}
+	sent := *broadcast
+	sent.Status = "sent"
+	batches := []BroadcastBatchResponse{
+		{Result: true, Broadcast: broadcast, UserIDs: []int{1, 2}},
+		{Result: true, Broadcast: &sent, UserIDs: []int{3}},
+	}
+	client := broadcastUserClient{
+		preferencesUserClient: preferencesUserClient{preferences: map[int]map[string]map[string]bool{
+			2: {notificationAnnouncement: {"email": false, "push": false, "in_app": false}},
+			3: {notificationAnnouncement: {"email": true, "push": false, "in_app": true}},
+		}},
+		batches: &batches,
+		stats:   make(map[int]BroadcastStats),
+	}
+	userClient = client
+
+	sendBroadcasts()
+
+	got := notifications()
+	if len(got) != 2 || got[0].UserID != 1 || got[1].UserID != 3 {
+		t.Fatalf("webhook got %+v, want users 1 and 3, user 2 muted announcements", got)
+	}
+	if n := got[1]; n.Event != notificationAnnouncement || n.BroadcastID != 4 || n.Subject != broadcast.Title || n.Body != broadcast.Body ||
+		!reflect.DeepEqual(n.Channels, []string{"email"}) {
+		t.Errorf("notification %+v, want the announcement by email", n)
+	}
+
+	if want := (BroadcastStats{Sent: 2, Muted: 1}); client.stats[4] != want {
+		t.Errorf("stats %+v, want %+v", client.stats[4], want)
+	}
+
+	msg := newPushMessage(context.Background(), got[0], "push")
+	if msg.Title != broadcast.Title || msg.Body != broadcast.Body || msg.Data["broadcast_id"] != "4" {
+		t.Errorf("push message %+v, want the announcement with its broadcast", msg)
+	}
+}
@@ -0,0 +1,155 @@
+package publicapi
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+
+	"apperror"
+
+	"github.com/gin-gonic/gin"
+)
+
+// listings of one bulk create, each one is validated on its own by listing service
+type ListingBulkCreate struct {
+	Listings []Listing `json:"listings" binding:"required,min=1"`
+}
+
+// outcome of one listing of a bulk create, index is its position in the request
+type ListingBulkResult struct {
+	Index   int            `json:"index"`
+	Result  bool           `json:"result"`
+	Listing *ListingCreate `json:"listing,omitempty"`
+	Errors  []string       `json:"errors,omitempty"`
+}
+
+type ListingBulkCreateResponse struct {
+	Result  bool                `json:"result"`
+	Created int                 `json:"created"`
+	Failed  int                 `json:"failed"`
+	Results []ListingBulkResult `json:"results"`
+}
+
+// LISTINGS_BULK_MAX most listings one bulk create may carry, keep it at most the limit of listing service
+var listingsBulkMax = cfg.Int("LISTINGS_BULK_MAX", 500)
+
+// =========== INTERFACE HANDLER, HANDLING REQUEST RESPONSE API DEPEND INTERFACE ===========
+
+// create many listings of the authenticated user at once, valid listings are stored together and invalid ones are
+// reported with their errors, so a partly invalid request still answers 200
+func createListingsBulkHandler(c *gin.Context) {
+	var body ListingBulkCreate
+	if err := c.ShouldBindJSON(&body); err != nil {
+		slog.ErrorContext(c.Request.Context(), "handler error", "code", "218", "error", err)
+		apperror.RespondBinding(c, err)
+		return
+	}
+
+	if len(body.Listings) > listingsBulkMax {
+		apperror.Respond(c, apperror.Validation(fmt.Sprintf("at most %d listings per request", listingsBulkMax)))
+		return
+	}
+
+	units, err := parseAreaUnits(c.Query("units"))
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "handler error", "code", "219", "error", err)
+		apperror.Respond(c, err)
+		return
+	}
+	variant, err := parseMediaVariant(c)
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "handler error", "code", "578", "error", err)
+		apperror.Respond(c, err)
+		return
+	}
+
+	// listings always belong to the authenticated user
+	for i := range body.Listings {
+		listing := &body.Listings[i]
+		if listing.UserID != 0 && listing.UserID != authUserID(c) {
+			apperror.JSON(c, http.StatusForbidden, "Cannot create listing for another user")
+			return
+		}
+		listing.UserID = authUserID(c)
+		listing.Area = areaToCanonical(listing.Area, units)
+	}
+
+	res, err := createListingsBulkUsecase(c.Request.Context(), body)
+	if err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+	for _, result := range res.Results {
+		if result.Listing != nil {
+			transformListingArea(&result.Listing.Area, &result.Listing.AreaUnits, units)
+			transformListingMedia(c.Request.Context(), result.Listing.Images, result.Listing.Media, &result.Listing.VideoURL, variant)
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{"created": res.Created, "failed": res.Failed, "results": res.Results})
+}
+
+// =========== USECASE LAYER, SERVES AS AN INTERMEDIARY BETWEEN THE PRESENTATION LAYER AND THE DATA LAYER ===========
+
+func createListingsBulkUsecase(ctx context.Context, body ListingBulkCreate) (*ListingBulkCreateResponse, error) {
+	for i, listing := range body.Listings {
+		if err := checkContentListing(ctx, listing); err != nil {
+			return nil, apperror.Validation(fmt.Sprintf("listings[%d]: %s", i, err.Error()))
+		}
+	}
+
+	bodyJSON, err := json.Marshal(body)
+	if err != nil {
+		slog.ErrorContext(ctx, "usecase error", "code", "220", "error", err)
+		return nil, err
+	}
+
+	res, err := createListingsBulkService(ctx, bodyJSON)
+	if err != nil {
+		return nil, err
+	}
+
+	if !res.Result {
+		slog.ErrorContext(ctx, "usecase error", "code", "221", "error", "api result failed: failed to create listings")
+		return nil, apperror.Upstream("Failed to create listings", nil)
+	}
+
+	return res, nil
+}
+
+// =========== REPOSITORY LAYER, ABSTRACTION OVER THE DATA PERSISTENCE (databases, file systems, or external APIs) ===========
+
+// listing service api path
+var apiPathListingBulkCreate = listingServiceURL + "/listings/bulk"
+
+func createListingsBulkService(ctx context.Context, bodyByte []byte) (*ListingBulkCreateResponse, error) {
+	defer listingsCache.invalidate(ctx)
+
+	resp, err := httpPost(ctx, apiPathListingBulkCreate, "application/json", bytes.NewReader(bodyByte))
+	if err != nil {
+		slog.ErrorContext(ctx, "service error", "code", "222", "error", err)
+		return nil, apperror.Upstream("Failed to create listings", err)
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusBadRequest:
+		return nil, apperror.Validation(upstreamErrorMessage(resp.Body, "Invalid listings"))
+	default:
+		slog.ErrorContext(ctx, "service error", "code", "223", "error", "error creating listings from listing service")
+		return nil, apperror.Upstream("Failed to create listings", errors.New("error creating listings from listing service"))
+	}
+
+	var listings ListingBulkCreateResponse
+	if err := decodeJSON(resp.Body, &listings); err != nil {
+		slog.ErrorContext(ctx, "service error", "code", "224", "error", err)
+		return nil, apperror.Upstream("Failed to create listings", err)
+	}
+
+	return &listings, nil
+}
@@ -0,0 +1,139 @@
+package publicapi
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"apperror"
+
+	"github.com/gin-gonic/gin"
+)
+
+// event of an iCalendar file, times are unix microseconds
+type calendarEvent struct {
+	// stable across downloads so calendar apps update the event instead of adding a copy
+	UID string
+	// raised on every change of the event, calendar apps keep the copy with the highest one
+	Sequence  int
+	StartsAt  int64
+	EndsAt    int64
+	UpdatedAt int64
+	Summary   string
+	Status    string
+}
+
+const (
+	calendarStatusConfirmed = "CONFIRMED"
+	calendarStatusCancelled = "CANCELLED"
+)
+
+// events of the calendar feed of a user, every source is asked on each download
+var calendarSources = []func(ctx context.Context, userID int) ([]calendarEvent, error){
+	// cancelled viewings stay in the feed so subscribed calendars drop them
+	func(ctx context.Context, userID int) ([]calendarEvent, error) {
+		return viewingCalendarEvents(ctx, userID, "")
+	},
+}
+
+// CALENDAR_REFRESH_INTERVAL how often calendar apps subscribed to the feed are asked to download it again
+var calendarRefreshInterval = cfg.Duration("CALENDAR_REFRESH_INTERVAL", time.Hour)
+
+// =========== INTERFACE HANDLER, HANDLING REQUEST RESPONSE API DEPEND INTERFACE ===========
+
+// calendar feed of the authenticated user, generated on each request
+func getMyCalendarHandler(c *gin.Context) {
+	res, err := getMyCalendarUsecase(c.Request.Context(), authUserID(c))
+	if err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+
+	c.Header("Cache-Control", "private, no-cache")
+	c.Header("Content-Disposition", `inline; filename="calendar.ics"`)
+	c.Data(http.StatusOK, "text/calendar; charset=utf-8", res)
+}
+
+// =========== USECASE LAYER, SERVES AS AN INTERMEDIARY BETWEEN THE PRESENTATION LAYER AND THE DATA LAYER ===========
+
+// upcoming events of every calendar source of the user as one calendar
+func getMyCalendarUsecase(ctx context.Context, userID int) ([]byte, error) {
+	var events []calendarEvent
+	for _, source := range calendarSources {
+		sourceEvents, err := source(ctx, userID)
+		if err != nil {
+			return nil, err
+		}
+		events = append(events, sourceEvents...)
+	}
+
+	return renderCalendar("Calendar", events), nil
+}
+
+// renderCalendar write events ordered by start as an RFC 5545 calendar, times in UTC and lines folded at 75 octets
+func renderCalendar(name string, events []calendarEvent) []byte {
+	sort.SliceStable(events, func(i, j int) bool { return events[i].StartsAt < events[j].StartsAt })
+
+	var b strings.Builder
+	line := func(name, value string) {
+		writeCalendarLine(&b, name+":"+value)
+	}
+
+	line("BEGIN", "VCALENDAR")
+	line("VERSION", "2.0")
+	line("PRODID", "-//simple-microservice//public-api//EN")
+	line("CALSCALE", "GREGORIAN")
+	line("METHOD", "PUBLISH")
+	line("X-WR-CALNAME", escapeCalendarText(name))
+	line("REFRESH-INTERVAL;VALUE=DURATION", calendarDuration(calendarRefreshInterval))
+	line("X-PUBLISHED-TTL", calendarDuration(calendarRefreshInterval))
+	for _, event := range events {
+		line("BEGIN", "VEVENT")
+		line("UID", escapeCalendarText(event.UID))
+		line("SEQUENCE", fmt.Sprint(event.Sequence))
+		line("DTSTAMP", calendarTime(event.UpdatedAt))
+		line("LAST-MODIFIED", calendarTime(event.UpdatedAt))
+		line("DTSTART", calendarTime(event.StartsAt))
+		line("DTEND", calendarTime(event.EndsAt))
+		line("SUMMARY", escapeCalendarText(event.Summary))
+		line("STATUS", event.Status)
+		line("END", "VEVENT")
+	}
+	line("END", "VCALENDAR")
+
+	return []byte(b.String())
+}
+
+func calendarTime(micros int64) string {
+	return time.UnixMicro(micros).UTC().Format("20060102T150405Z")
+}
+
+// duration in whole seconds, e.g. PT3600S
+func calendarDuration(d time.Duration) string {
+	return fmt.Sprintf("PT%dS", int64(d/time.Second))
+}
+
+// escape backslash, semicolon, comma and newline of a TEXT value
+func escapeCalendarText(s string) string {
+	return strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\n", `\n`).Replace(s)
+}
+
+// write a content line ending in CRLF, longer lines continue on lines starting with a space,
+// never splitting a utf-8 sequence
+func writeCalendarLine(b *strings.Builder, s string) {
+	limit := 75
+	for len(s) > limit {
+		cut := limit
+		for cut > 0 && s[cut]&0xC0 == 0x80 {
+			cut--
+		}
+		b.WriteString(s[:cut] + "\r\n ")
+		s = s[cut:]
+		// the leading space counts in the octets of the continuation line
+		limit = 74
+	}
+	b.WriteString(s + "\r\n")
+}
@@ -0,0 +1,157 @@
+package publicapi
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"apperror"
+	"logging"
+
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+)
+
+// =========== REPOSITORY LAYER, SHARED HTTP CLIENT FOR CALLS TO USER AND LISTING SERVICE ===========
+
+// header carrying the shared secret of internal services
+const headerAPIKey = "X-API-Key"
+
+// INTERNAL_API_KEY shared secret sent to user and listing service on every call
+var internalAPIKey = cfg.String("INTERNAL_API_KEY", "")
+
+// DOWNSTREAM_TIMEOUT max duration of one call including retries and reading the response body
+var downstreamTimeout = cfg.Duration("DOWNSTREAM_TIMEOUT", 5*time.Second)
+
+// client used by every repository function calling downstream services
+var httpClient = &http.Client{
+	Timeout: downstreamTimeout,
+	// span per call with the trace context sent in traceparent
+	Transport: otelhttp.NewTransport(&metricsTransport{base: &debugTransport{base: downstreamBreaker}}),
+}
+
+// breaker sees one result per call, after retries of the call are exhausted
+var downstreamBreaker = newBreakerTransport(newRetryTransport(&requestIDTransport{base: &deadlineTransport{base: &apiKeyTransport{base: newDownstreamTransport(), key: internalAPIKey}}}))
+
+// pooled transport reusing keep-alive connections to the few downstream hosts
+func newDownstreamTransport() *http.Transport {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	// DOWNSTREAM_MAX_IDLE_CONNS_PER_HOST idle connections kept open per service
+	transport.MaxIdleConnsPerHost = cfg.Int("DOWNSTREAM_MAX_IDLE_CONNS_PER_HOST", 32)
+	transport.MaxIdleConns = transport.MaxIdleConnsPerHost * 2
+	// DOWNSTREAM_DIAL_TIMEOUT max duration to open a connection
+	transport.DialContext = (&net.Dialer{
+		Timeout:   cfg.Duration("DOWNSTREAM_DIAL_TIMEOUT", 2*time.Second),
+		KeepAlive: 30 * time.Second,
+	}).DialContext
+
+	return transport
+}
+
+// attach api key header on every outgoing request
+type apiKeyTransport struct {
+	base http.RoundTripper
+	key  string
+}
+
+func (t *apiKeyTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if t.key != "" {
+		req = req.Clone(req.Context())
+		req.Header.Set(headerAPIKey, t.key)
+	}
+
+	return t.base.RoundTrip(req)
+}
+
+// forward the request id of ctx so downstream logs of the call share it
+type requestIDTransport struct {
+	base http.RoundTripper
+}
+
+func (t *requestIDTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if id := logging.RequestID(req.Context()); id != "" {
+		req = req.Clone(req.Context())
+		req.Header.Set(logging.HeaderRequestID, id)
+	}
+
+	return t.base.RoundTrip(req)
+}
+
+// send the milliseconds left to ctx, at most DOWNSTREAM_TIMEOUT, so the downstream service stops the call when
+// the caller is no longer waiting for it
+type deadlineTransport struct {
+	base http.RoundTripper
+}
+
+func (t *deadlineTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	left := downstreamTimeout
+	if deadline, ok := req.Context().Deadline(); ok && (left <= 0 || time.Until(deadline) < left) {
+		left = time.Until(deadline)
+	}
+
+	if left > 0 {
+		req = req.Clone(req.Context())
+		req.Header.Set(headerRequestTimeout, strconv.FormatInt(max(left.Milliseconds(), 1), 10))
+	}
+
+	return t.base.RoundTrip(req)
+}
+
+// httpGet, httpPost, httpPostForm and httpDelete are the http.Client helpers bound to ctx, so a cancelled
+// client request or shutdown stops the downstream call too
+func httpGet(ctx context.Context, url string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return httpClient.Do(req)
+}
+
+func httpPost(ctx context.Context, url, contentType string, body io.Reader) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", contentType)
+
+	return httpClient.Do(req)
+}
+
+func httpPostForm(ctx context.Context, url string, form url.Values) (*http.Response, error) {
+	return httpPost(ctx, url, "application/x-www-form-urlencoded", strings.NewReader(form.Encode()))
+}
+
+func httpDelete(ctx context.Context, url string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodDelete, url, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return httpClient.Do(req)
+}
+
+// decodeJSON decode a downstream response body into v keeping numbers exact, values decoded into an interface{}
+// are json.Number instead of float64 which rounds integers above 2^53, and a number out of range of its int
+// field fails the call instead of being stored wrong
+func decodeJSON(body io.Reader, v any) error {
+	decoder := json.NewDecoder(body)
+	decoder.UseNumber()
+	return decoder.Decode(v)
+}
+
+// upstreamErrorMessage message of the error envelope of a downstream response, fallback when the body has none,
+// for failures caused by the client request that are answered with the downstream message
+func upstreamErrorMessage(body io.Reader, fallback string) string {
+	var envelope apperror.Envelope
+	if err := decodeJSON(body, &envelope); err != nil || envelope.Error.Message == "" {
+		return fallback
+	}
+
+	return envelope.Error.Message
+}
@@ -0,0 +1,106 @@
+package publicapi
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestDecodeJSONNumbers(t *testing.T) {
+	tests := []struct {
+		name    string
+		body    string
+		wantID  int
+		price   int
+		wantErr bool
+	}{
+		{name: "small", body: `{"id": 1, "price": 6000}`, wantID: 1, price: 6000},
+		{name: "2^53", body: `{"id": 9007199254740992, "price": 9007199254740992}`, wantID: 9007199254740992, price: 9007199254740992},
+		{name: "2^53 + 1 kept exact", body: `{"id": 9007199254740993, "price": 9007199254740993}`, wantID: 9007199254740993, price: 9007199254740993},
+		{name: "max int64", body: `{"id": 9223372036854775807, "price": 9223372036854775807}`, wantID: 9223372036854775807, price: 9223372036854775807},
+		{name: "min int64", body: `{"id": 1, "price": -9223372036854775808}`, wantID: 1, price: -9223372036854775808},
+		{name: "negative", body: `{"id": -1, "price": -6000}`, wantID: -1, price: -6000},
+		{name: "above max int64", body: `{"id": 9223372036854775808, "price": 1}`, wantErr: true},
+		{name: "below min int64", body: `{"id": 1, "price": -9223372036854775809}`, wantErr: true},
+		{name: "fraction", body: `{"id": 1, "price": 6000.5}`, wantErr: true},
+		{name: "exponent", body: `{"id": 1, "price": 6e3}`, wantErr: true},
+		{name: "string", body: `{"id": "1", "price": 6000}`, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var listing ListingCreate
+			err := decodeJSON(strings.NewReader(tt.body), &listing)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, want error %t", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+
+			if listing.ID != tt.wantID || listing.Price != tt.price {
+				t.Errorf("decoded id %d price %d, want id %d price %d", listing.ID, listing.Price, tt.wantID, tt.price)
+			}
+		})
+	}
+}
+
+func TestDecodeJSONNumbersInInterface(t *testing.T) {
+	tests := []struct {
+		name string
+		raw  string
+	}{
+		{name: "2^53 + 1", raw: "9007199254740993"},
+		{name: "max int64", raw: "9223372036854775807"},
+		{name: "above max int64", raw: "18446744073709551616"},
+		{name: "negative", raw: "-9007199254740993"},
+		{name: "fraction", raw: "80.25"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var v map[string]any
+			if err := decodeJSON(strings.NewReader(`{"price": `+tt.raw+`}`), &v); err != nil {
+				t.Fatal(err)
+			}
+
+			number, ok := v["price"].(json.Number)
+			if !ok {
+				t.Fatalf("price decoded as %T, want json.Number", v["price"])
+			}
+			if number.String() != tt.raw {
+				t.Errorf("price = %s, want %s", number, tt.raw)
+			}
+
+			// encoded again unchanged, as the request rules and transforms do
+			out, err := json.Marshal(v)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if want := `{"price":` + tt.raw + `}`; string(out) != want {
+				t.Errorf("encoded %s, want %s", out, want)
+			}
+		})
+	}
+}
+
+func TestUpstreamErrorMessage(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		want string
+	}{
+		{name: "envelope", body: `{"error": {"code": "conflict", "message": "listing already has an accepted offer"}}`, want: "listing already has an accepted offer"},
+		{name: "empty message", body: `{"error": {"code": "conflict", "message": ""}}`, want: "fallback"},
+		{name: "not json", body: `<html>502</html>`, want: "fallback"},
+		{name: "empty body", body: ``, want: "fallback"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := upstreamErrorMessage(strings.NewReader(tt.body), "fallback"); got != tt.want {
+				t.Errorf("message = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,262 @@
+package publicapi
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+)
+
+// =========== MIDDLEWARE LAYER, RUN BEFORE INTERFACE HANDLER TO ENRICH OR GUARD THE REQUEST ===========
+
+// GZIP_LEVEL compression level of gzip responses from 1 fastest to 9 smallest, 0 sends every response uncompressed
+// GZIP_MIN_SIZE bytes from which a response is compressed, smaller ones gain less than the gzip header costs
+func gzipMiddleware() gin.HandlerFunc {
+	level := cfg.Int("GZIP_LEVEL", 5)
+	if level < gzip.NoCompression || level > gzip.BestCompression {
+		log.Fatalf("invalid GZIP_LEVEL %d, use 0 to 9", level)
+	}
+	minSize := cfg.Int("GZIP_MIN_SIZE", 1024)
+
+	pool := sync.Pool{New: func() any {
+		gz, _ := gzip.NewWriterLevel(nil, level)
+		return gz
+	}}
+
+	return func(c *gin.Context) {
+		if level == gzip.NoCompression {
+			c.Next()
+			return
+		}
+
+		c.Writer.Header().Add("Vary", "Accept-Encoding")
+		// a range of the uncompressed file can not be served compressed
+		if !acceptsGzip(c.GetHeader("Accept-Encoding")) || c.GetHeader("Range") != "" || c.Request.Method == http.MethodHead {
+			c.Next()
+			return
+		}
+
+		w := &gzipWriter{ResponseWriter: c.Writer, minSize: minSize, pool: &pool}
+		c.Writer = w
+		defer w.close()
+
+		c.Next()
+	}
+}
+
+// report whether an Accept-Encoding header takes gzip, the q=0 of a coding refuses it
+func acceptsGzip(header string) bool {
+	for _, part := range strings.Split(header, ",") {
+		coding, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		coding = strings.ToLower(strings.TrimSpace(coding))
+		if coding != "gzip" && coding != "*" {
+			continue
+		}
+
+		q := 1.0
+		if name, value, ok := strings.Cut(strings.TrimSpace(params), "="); ok && strings.TrimSpace(name) == "q" {
+			q, _ = strconv.ParseFloat(strings.TrimSpace(value), 64)
+		}
+		return q > 0
+	}
+	return false
+}
+
+// report whether a response of header is worth compressing, text and json not already encoded. Event streams stay
+// plain so every event reaches the client once written
+func compressible(header http.Header) bool {
+	if header.Get("Content-Encoding") != "" {
+		return false
+	}
+
+	contentType, _, _ := strings.Cut(header.Get("Content-Type"), ";")
+	switch contentType = strings.TrimSpace(contentType); {
+	case contentType == "text/event-stream":
+		return false
+	case strings.HasPrefix(contentType, "text/"), strings.HasSuffix(contentType, "json"), strings.HasSuffix(contentType, "xml"),
+		contentType == "application/javascript", contentType == "image/svg+xml":
+		return true
+	}
+	return false
+}
+
+// hold the response until minSize bytes tell whether to compress it, then write it gzip encoded or as is
+type gzipWriter struct {
+	gin.ResponseWriter
+	minSize int
+	pool    *sync.Pool
+
+	head    bytes.Buffer
+	started bool
+	gz      *gzip.Writer
+}
+
+func (w *gzipWriter) Write(b []byte) (int, error) {
+	if !w.started {
+		w.head.Write(b)
+		if w.head.Len() < w.minSize {
+			return len(b), nil
+		}
+		return len(b), w.start(true)
+	}
+
+	if w.gz != nil {
+		return w.gz.Write(b)
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *gzipWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+// write what is held so far, compressed when worth it and not too small
+func (w *gzipWriter) start(large bool) error {
+	w.started = true
+	if large && compressible(w.Header()) {
+		w.Header().Del("Content-Length")
+		w.Header().Set("Content-Encoding", "gzip")
+		w.gz = w.pool.Get().(*gzip.Writer)
+		w.gz.Reset(w.ResponseWriter)
+	}
+
+	if w.head.Len() == 0 {
+		return nil
+	}
+	var err error
+	if w.gz != nil {
+		_, err = w.gz.Write(w.head.Bytes())
+	} else {
+		_, err = w.ResponseWriter.Write(w.head.Bytes())
+	}
+	w.head.Reset()
+	return err
+}
+
+// a flushed response is sent as far as written, compressed once it reached minSize
+func (w *gzipWriter) Flush() {
+	if !w.started {
+		w.start(w.head.Len() >= w.minSize)
+	}
+	if w.gz != nil {
+		w.gz.Flush()
+	}
+	w.ResponseWriter.Flush()
+}
+
+func (w *gzipWriter) close() {
+	if !w.started {
+		w.start(false)
+	}
+	if w.gz != nil {
+		w.gz.Close()
+		w.pool.Put(w.gz)
+		w.gz = nil
+	}
+}
+
+// ETAG_MAX_SIZE bytes up to which GET responses are held to tag them, larger ones and flushed ones are sent as they
+// are written without ETag. 0 tags no response
+func etagMiddleware() gin.HandlerFunc {
+	maxSize := cfg.Int("ETAG_MAX_SIZE", 4<<20)
+
+	return func(c *gin.Context) {
+		if maxSize <= 0 || c.Request.Method != http.MethodGet {
+			c.Next()
+			return
+		}
+
+		w := &etagWriter{ResponseWriter: c.Writer, maxSize: maxSize}
+		c.Writer = w
+		c.Next()
+
+		if w.streaming {
+			return
+		}
+		w.finish(c.GetHeader("If-None-Match"))
+	}
+}
+
+// hold the response of a GET to tag it with a hash of its body, until it grows past maxSize or is flushed
+type etagWriter struct {
+	gin.ResponseWriter
+	maxSize   int
+	body      bytes.Buffer
+	streaming bool
+}
+
+func (w *etagWriter) Write(b []byte) (int, error) {
+	if !w.streaming && w.body.Len()+len(b) > w.maxSize {
+		if err := w.stream(); err != nil {
+			return 0, err
+		}
+	}
+	if w.streaming {
+		return w.ResponseWriter.Write(b)
+	}
+	return w.body.Write(b)
+}
+
+func (w *etagWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+func (w *etagWriter) Flush() {
+	w.stream()
+	w.ResponseWriter.Flush()
+}
+
+// send what is held and the rest as written, untagged
+func (w *etagWriter) stream() error {
+	if w.streaming {
+		return nil
+	}
+	w.streaming = true
+	_, err := w.ResponseWriter.Write(w.body.Bytes())
+	w.body.Reset()
+	return err
+}
+
+// tag a 200 with the weak ETag of its body unless the handler set one, answer 304 without body when ifNoneMatch
+// holds it. Weak so the tag of the body is also the one of its gzip encoding. A no-store response is never tagged
+func (w *etagWriter) finish(ifNoneMatch string) {
+	header := w.Header()
+	if w.Status() == http.StatusOK && header.Get("ETag") == "" && !strings.Contains(header.Get("Cache-Control"), "no-store") {
+		sum := sha256.Sum256(w.body.Bytes())
+		header.Set("ETag", `W/"`+hex.EncodeToString(sum[:16])+`"`)
+	}
+
+	if etag := header.Get("ETag"); etag != "" && w.Status() == http.StatusOK && etagMatch(ifNoneMatch, etag) {
+		header.Del("Content-Type")
+		header.Del("Content-Length")
+		w.ResponseWriter.WriteHeader(http.StatusNotModified)
+		w.ResponseWriter.WriteHeaderNow()
+		return
+	}
+
+	if w.body.Len() > 0 {
+		w.ResponseWriter.Write(w.body.Bytes())
+	}
+}
+
+// report whether an If-None-Match header holds etag, compared weakly as GET requires
+func etagMatch(ifNoneMatch, etag string) bool {
+	if strings.TrimSpace(ifNoneMatch) == "*" {
+		return true
+	}
+
+	etag = strings.TrimPrefix(etag, "W/")
+	for _, candidate := range strings.Split(ifNoneMatch, ",") {
+		if strings.TrimPrefix(strings.TrimSpace(candidate), "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
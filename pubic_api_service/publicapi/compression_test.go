@@ -0,0 +1,80 @@
+package publicapi
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestGzipAndETagMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	page := strings.Repeat(`{"id": 1, "listing_type": "rent", "price": 6000},`, 100)
+
+	router := gin.New()
+	router.Use(gzipMiddleware(), etagMiddleware())
+	router.GET("/listings", func(c *gin.Context) { c.Data(http.StatusOK, "application/json", []byte(page)) })
+	router.GET("/small", func(c *gin.Context) { c.JSON(http.StatusOK, gin.H{"result": true}) })
+	router.GET("/missing", func(c *gin.Context) { c.JSON(http.StatusNotFound, gin.H{"error": "not found"}) })
+	router.GET("/image", func(c *gin.Context) { c.Data(http.StatusOK, "image/png", []byte(page)) })
+
+	get := func(path string, header map[string]string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		for key, value := range header {
+			req.Header.Set(key, value)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	w := get("/listings", map[string]string{"Accept-Encoding": "gzip, deflate"})
+	if w.Code != http.StatusOK || w.Header().Get("Content-Encoding") != "gzip" || w.Header().Get("Vary") != "Accept-Encoding" {
+		t.Fatalf("listings %d %v, want 200 gzip encoded", w.Code, w.Header())
+	}
+	gz, err := gzip.NewReader(w.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if body, _ := io.ReadAll(gz); string(body) != page {
+		t.Errorf("decompressed body of %d bytes, want the page of %d", len(body), len(page))
+	}
+
+	etag := w.Header().Get("ETag")
+	if !strings.HasPrefix(etag, `W/"`) {
+		t.Fatalf("ETag %q, want a weak tag", etag)
+	}
+	if plain := get("/listings", nil); plain.Header().Get("Content-Encoding") != "" || plain.Body.String() != page || plain.Header().Get("ETag") != etag {
+		t.Errorf("listings without Accept-Encoding %v, want the plain page with the same ETag", plain.Header())
+	}
+
+	w = get("/listings", map[string]string{"Accept-Encoding": "gzip", "If-None-Match": `"other", ` + etag})
+	if w.Code != http.StatusNotModified || w.Body.Len() != 0 || w.Header().Get("ETag") != etag {
+		t.Errorf("conditional get %d with %d bytes, want 304 without body", w.Code, w.Body.Len())
+	}
+
+	for _, tt := range []struct {
+		name   string
+		path   string
+		header map[string]string
+		gzip   bool
+		etag   bool
+	}{
+		{"small body", "/small", map[string]string{"Accept-Encoding": "gzip"}, false, true},
+		{"gzip refused", "/listings", map[string]string{"Accept-Encoding": "gzip;q=0, identity"}, false, true},
+		{"image", "/image", map[string]string{"Accept-Encoding": "gzip"}, false, true},
+		{"error", "/missing", map[string]string{"Accept-Encoding": "gzip", "If-None-Match": "*"}, false, false},
+	} {
+		w := get(tt.path, tt.header)
+		if gzipped := w.Header().Get("Content-Encoding") == "gzip"; gzipped != tt.gzip {
+			t.Errorf("%s: gzip %t, want %t", tt.name, gzipped, tt.gzip)
+		}
+		if tagged := w.Header().Get("ETag") != ""; tagged != tt.etag {
+			t.Errorf("%s: ETag %t, want %t", tt.name, tagged, tt.etag)
+		}
+	}
+}
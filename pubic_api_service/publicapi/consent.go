@@ -0,0 +1,231 @@
+package publicapi
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+
+	"apperror"
+
+	"github.com/gin-gonic/gin"
+)
+
+type PolicyVersion struct {
+	Kind        string `json:"kind"`
+	Version     string `json:"version"`
+	PublishedAt int64  `json:"published_at"`
+}
+
+type PoliciesResponse struct {
+	Result   bool `json:"result"`
+	Policies []PolicyVersion
+}
+
+type ConsentCreate struct {
+	Kind    string `json:"kind" binding:"required"`
+	Version string `json:"version" binding:"required"`
+}
+
+type Consent struct {
+	UserID     int    `json:"user_id"`
+	Kind       string `json:"kind"`
+	Version    string `json:"version"`
+	AcceptedAt int64  `json:"accepted_at"`
+}
+
+type ConsentResponse struct {
+	Result  bool `json:"result"`
+	Consent Consent
+}
+
+type ConsentsResponse struct {
+	Result   bool `json:"result"`
+	Consents []Consent
+	Pending  []PolicyVersion
+}
+
+var ErrPolicyVersionInvalid = apperror.Validation("kind or version is not published")
+
+// =========== MIDDLEWARE LAYER, RUN BEFORE INTERFACE HANDLER TO ENRICH OR GUARD THE REQUEST ===========
+
+// reject writes of users who did not accept the current policy versions, run after authMiddleware
+func consentMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		res, err := getConsentsUsecase(c.Request.Context(), authUserID(c))
+		if err != nil {
+			slog.ErrorContext(c.Request.Context(), "middleware error", "code", "096", "error", err)
+			apperror.Abort(c, http.StatusInternalServerError, "Internal Server Error")
+			return
+		}
+
+		if len(res.Pending) > 0 {
+			c.AbortWithStatusJSON(http.StatusUnavailableForLegalReasons, gin.H{
+				"error":   apperror.NewDetail(http.StatusUnavailableForLegalReasons, "Accept the current terms before continuing"),
+				"pending": res.Pending,
+			})
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// =========== INTERFACE HANDLER, HANDLING REQUEST RESPONSE API DEPEND INTERFACE ===========
+
+func getPoliciesHandler(c *gin.Context) {
+	res, err := getPoliciesUsecase(c.Request.Context())
+	if err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"policies": res})
+}
+
+func getConsentsHandler(c *gin.Context) {
+	res, err := getConsentsUsecase(c.Request.Context(), authUserID(c))
+	if err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"consents": res.Consents, "pending": res.Pending})
+}
+
+func acceptPolicyHandler(c *gin.Context) {
+	var body ConsentCreate
+	if err := c.ShouldBindJSON(&body); err != nil {
+		slog.ErrorContext(c.Request.Context(), "handler error", "code", "097", "error", err)
+		apperror.RespondBinding(c, err)
+		return
+	}
+
+	res, err := acceptPolicyUsecase(c.Request.Context(), authUserID(c), body)
+	if err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"consent": res})
+}
+
+// =========== USECASE LAYER, SERVES AS AN INTERMEDIARY BETWEEN THE PRESENTATION LAYER AND THE DATA LAYER ===========
+
+func getPoliciesUsecase(ctx context.Context) ([]PolicyVersion, error) {
+	res, err := userClient.FindPolicies(ctx)
+	if err != nil {
+		return nil, apperror.Upstream("Failed to get policies", err)
+	}
+
+	return res.Policies, nil
+}
+
+// accepted versions of user and current versions still to accept
+func getConsentsUsecase(ctx context.Context, userID int) (*ConsentsResponse, error) {
+	res, err := userClient.FindUserConsents(ctx, userID)
+	if err != nil {
+		return nil, apperror.Upstream("Failed to get consents", err)
+	}
+
+	return res, nil
+}
+
+func acceptPolicyUsecase(ctx context.Context, userID int, consent ConsentCreate) (*Consent, error) {
+	consentJSON, err := json.Marshal(consent)
+	if err != nil {
+		slog.ErrorContext(ctx, "usecase error", "code", "098", "error", err)
+		return nil, err
+	}
+
+	res, err := userClient.CreateUserConsent(ctx, userID, consentJSON)
+	if err != nil {
+		if errors.Is(err, ErrPolicyVersionInvalid) {
+			return nil, err
+		}
+		return nil, apperror.Upstream("Failed to accept policy", err)
+	}
+
+	return &res.Consent, nil
+}
+
+// =========== REPOSITORY LAYER, ABSTRACTION OVER THE DATA PERSISTENCE (databases, file systems, or external APIs) ===========
+
+var (
+	// user service api path
+	apiPathPolicies     = userServiceURL + "/policies"
+	apiPathUserConsents = userServiceURL + "/users/%d/consents"
+)
+
+func (httpUserClient) FindPolicies(ctx context.Context) (*PoliciesResponse, error) {
+	resp, err := httpGet(ctx, apiPathPolicies)
+	if err != nil {
+		slog.ErrorContext(ctx, "service error", "code", "099", "error", err)
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		slog.ErrorContext(ctx, "service error", "code", "100", "error", "error fetching policies from user service")
+		return nil, errors.New("error fetching policies from user service")
+	}
+
+	var policies PoliciesResponse
+	if err := decodeJSON(resp.Body, &policies); err != nil {
+		slog.ErrorContext(ctx, "service error", "code", "101", "error", err)
+		return nil, err
+	}
+
+	return &policies, nil
+}
+
+func (httpUserClient) FindUserConsents(ctx context.Context, userID int) (*ConsentsResponse, error) {
+	resp, err := httpGet(ctx, fmt.Sprintf(apiPathUserConsents, userID))
+	if err != nil {
+		slog.ErrorContext(ctx, "service error", "code", "102", "error", err)
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		slog.ErrorContext(ctx, "service error", "code", "103", "error", "error fetching consents from user service")
+		return nil, errors.New("error fetching consents from user service")
+	}
+
+	var consents ConsentsResponse
+	if err := decodeJSON(resp.Body, &consents); err != nil {
+		slog.ErrorContext(ctx, "service error", "code", "104", "error", err)
+		return nil, err
+	}
+
+	return &consents, nil
+}
+
+func (httpUserClient) CreateUserConsent(ctx context.Context, userID int, consentByte []byte) (*ConsentResponse, error) {
+	resp, err := httpPost(ctx, fmt.Sprintf(apiPathUserConsents, userID), "application/json", bytes.NewBuffer(consentByte))
+	if err != nil {
+		slog.ErrorContext(ctx, "service error", "code", "105", "error", err)
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusBadRequest {
+		return nil, ErrPolicyVersionInvalid
+	}
+
+	if resp.StatusCode != http.StatusCreated {
+		slog.ErrorContext(ctx, "service error", "code", "106", "error", "error creating consent from user service")
+		return nil, errors.New("error creating consent from user service")
+	}
+
+	var consent ConsentResponse
+	if err := decodeJSON(resp.Body, &consent); err != nil {
+		slog.ErrorContext(ctx, "service error", "code", "107", "error", err)
+		return nil, err
+	}
+
+	return &consent, nil
+}
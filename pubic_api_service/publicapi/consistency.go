@@ -0,0 +1,56 @@
+package publicapi
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"strings"
+
+	"apperror"
+
+	"github.com/gin-gonic/gin"
+)
+
+// request header choosing how fresh reads must be, answered with the level the request was served with
+const headerConsistency = "Consistency"
+
+const (
+	// reads skip the user cache, the listings page cache and the read model and go to the listing and user
+	// services, the caches are still refreshed with what they answer
+	consistencyStrong = "strong"
+	// reads take the caches and the read model when they have the data
+	consistencyEventual = "eventual"
+)
+
+type ctxKeyConsistency struct{}
+
+// true when the request of ctx asked for strong reads
+func strongRead(ctx context.Context) bool {
+	return ctx.Value(ctxKeyConsistency{}) == consistencyStrong
+}
+
+// =========== MIDDLEWARE LAYER, RUN BEFORE INTERFACE HANDLER TO ENRICH OR GUARD THE REQUEST ===========
+
+// set the consistency of the reads of the request from its Consistency header, def when it has none.
+// 400 for another value than strong or eventual
+func consistencyMiddleware(def string) gin.HandlerFunc {
+	if def != consistencyStrong && def != consistencyEventual {
+		log.Fatalf("invalid CONSISTENCY_DEFAULT %q, use %s or %s", def, consistencyStrong, consistencyEventual)
+	}
+
+	return func(c *gin.Context) {
+		consistency := def
+		if val := strings.TrimSpace(c.GetHeader(headerConsistency)); val != "" {
+			consistency = strings.ToLower(val)
+		}
+		if consistency != consistencyStrong && consistency != consistencyEventual {
+			apperror.Abort(c, http.StatusBadRequest, "Consistency must be strong or eventual")
+			return
+		}
+
+		c.Header(headerConsistency, consistency)
+		c.Writer.Header().Add("Vary", headerConsistency)
+		c.Request = c.Request.WithContext(context.WithValue(c.Request.Context(), ctxKeyConsistency{}, consistency))
+		c.Next()
+	}
+}
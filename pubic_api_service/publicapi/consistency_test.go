@@ -0,0 +1,71 @@
+package publicapi
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestConsistencyMiddleware(t *testing.T) {
+	for _, tc := range []struct {
+		def, header string
+		status      int
+		want        string
+	}{
+		{consistencyEventual, "", http.StatusOK, consistencyEventual},
+		{consistencyStrong, "", http.StatusOK, consistencyStrong},
+		{consistencyEventual, "Strong", http.StatusOK, consistencyStrong},
+		{consistencyStrong, "eventual", http.StatusOK, consistencyEventual},
+		{consistencyEventual, "linearizable", http.StatusBadRequest, ""},
+	} {
+		router := gin.New()
+		var strong bool
+		router.GET("/", consistencyMiddleware(tc.def), func(c *gin.Context) {
+			strong = strongRead(c.Request.Context())
+			c.Status(http.StatusOK)
+		})
+
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set(headerConsistency, tc.header)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		if w.Code != tc.status || w.Header().Get(headerConsistency) != tc.want || strong != (tc.want == consistencyStrong) {
+			t.Errorf("default %s header %q: %d %q strong %t, want %d %q", tc.def, tc.header, w.Code, w.Header().Get(headerConsistency), strong, tc.status, tc.want)
+		}
+	}
+}
+
+func TestStrongReadSkipsUserCache(t *testing.T) {
+	client := &cacheUserClient{users: map[int]User{1: {ID: 1, Name: "new"}, 2: {ID: 2, Name: "b"}}}
+
+	previousClient, previousCache := userClient, cachedUsers
+	userClient, cachedUsers = client, newUserCache(10, time.Minute)
+	defer func() { userClient, cachedUsers = previousClient, previousCache }()
+
+	cachedUsers.put(User{ID: 1, Name: "old"})
+	strong := context.WithValue(context.Background(), ctxKeyConsistency{}, consistencyStrong)
+
+	res, err := findUserByIDService(strong, 1)
+	if err != nil || res.User.Name != "new" {
+		t.Fatalf("strong read = %+v, %v, want the user of the user service", res, err)
+	}
+	if user, _ := cachedUsers.get(1); user.Name != "new" {
+		t.Errorf("cached user after strong read = %+v, want it refreshed", user)
+	}
+
+	if _, err := findUsersByIDsService(strong, []int{1, 2}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := findUsersByIDsService(context.Background(), []int{1, 2}); err != nil {
+		t.Fatal(err)
+	}
+	if want := [][]int{{1}, {1, 2}}; !reflect.DeepEqual(client.fetched, want) {
+		t.Errorf("fetched %v, want %v with the eventual read served by the cache", client.fetched, want)
+	}
+}
@@ -0,0 +1,516 @@
+package publicapi
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"apperror"
+
+	"github.com/gin-gonic/gin"
+)
+
+// kinds of content rules and the params each takes
+const (
+	// {"keywords": ["wire transfer", "western union"]}, a keyword or phrase of whole words in any case
+	contentRuleKeywords = "keywords"
+	// {"max": 2}, more links than max
+	contentRuleURLCount = "url_count"
+	// {"min_run": 6}, a character repeated min_run times in a row, like !!!!!! or aaaaaa
+	contentRuleRepeatedChars = "repeated_chars"
+	// {"listing_type": "rent", "region": "sg", "currency": "SGD", "min_price": 500}, a listing priced under min_price,
+	// the fields left out match every listing
+	contentRulePriceFloor = "price_floor"
+)
+
+// what a rule does to the content it matches
+const (
+	contentRuleFlag  = "flag"
+	contentRuleBlock = "block"
+)
+
+// content checked against the rules, the target label of the hits
+const (
+	contentTargetListing      = "listing"
+	contentTargetOfferMessage = "offer_message"
+)
+
+// spam or scam rule kept by the user service, Params is the json of its Kind
+type ContentRule struct {
+	Name      string          `json:"name"`
+	Kind      string          `json:"kind"`
+	Action    string          `json:"action"`
+	Params    json.RawMessage `json:"params"`
+	Enabled   bool            `json:"enabled"`
+	UpdatedBy int             `json:"updated_by"`
+	UpdatedAt int64           `json:"updated_at"`
+}
+
+type ContentRulesResponse struct {
+	Result bool          `json:"result"`
+	Rules  []ContentRule `json:"rules"`
+}
+
+type ContentRuleResponse struct {
+	Result bool        `json:"result"`
+	Rule   ContentRule `json:"rule"`
+}
+
+// rule saved under the name of the path, enabled unless Enabled is false
+type ContentRuleUpdate struct {
+	Kind    string          `json:"kind" binding:"required,oneof=keywords url_count repeated_chars price_floor"`
+	Action  string          `json:"action" binding:"required,oneof=flag block"`
+	Params  json.RawMessage `json:"params" binding:"required"`
+	Enabled *bool           `json:"enabled"`
+}
+
+var (
+	ErrContentRuleNotFound = apperror.NotFound("Content rule not found")
+	errContentRuleName     = apperror.Validation("name must be 1 to 64 lowercase letters, digits, _ or -")
+	// the rule is not named so it can not be worked around
+	errContentBlocked = apperror.Validation("Content looks like spam or a scam and was refused")
+)
+
+var contentRuleName = regexp.MustCompile(`^[a-z0-9_-]{1,64}$`)
+
+// CONTENT_RULE_TTL how long rules fetched from the user service are applied before fetching them again
+var contentRuleTTL = cfg.Duration("CONTENT_RULE_TTL", time.Minute)
+
+// =========== INTERFACE HANDLER, HANDLING REQUEST RESPONSE API DEPEND INTERFACE ===========
+
+// every rule, enabled or not, hits are counted on content_rule_hits_total
+func getContentRulesHandler(c *gin.Context) {
+	res, err := getContentRulesUsecase(c.Request.Context())
+	if err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"rules": res.Rules})
+}
+
+// create or replace a rule, applied from the next fetch of the rules on
+func saveContentRuleHandler(c *gin.Context) {
+	var body ContentRuleUpdate
+	if err := c.ShouldBindJSON(&body); err != nil {
+		slog.ErrorContext(c.Request.Context(), "handler error", "code", "560", "error", err)
+		apperror.RespondBinding(c, err)
+		return
+	}
+
+	saved, err := saveContentRuleUsecase(c.Request.Context(), authUserID(c), c.Param("name"), body)
+	if err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"rule": saved})
+}
+
+func deleteContentRuleHandler(c *gin.Context) {
+	if err := deleteContentRuleUsecase(c.Request.Context(), c.Param("name")); err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// =========== USECASE LAYER, SERVES AS AN INTERMEDIARY BETWEEN THE PRESENTATION LAYER AND THE DATA LAYER ===========
+
+func getContentRulesUsecase(ctx context.Context) (*ContentRulesResponse, error) {
+	res, err := userClient.FindContentRules(ctx)
+	if err != nil {
+		return nil, apperror.Upstream("Failed to get content rules", err)
+	}
+
+	return res, nil
+}
+
+// params are parsed by the kind before the rule is saved, so a rule the checks could not apply is refused
+func saveContentRuleUsecase(ctx context.Context, actorID int, name string, body ContentRuleUpdate) (*ContentRule, error) {
+	if !contentRuleName.MatchString(name) {
+		return nil, errContentRuleName
+	}
+
+	enabled := body.Enabled == nil || *body.Enabled
+	rule := ContentRule{Name: name, Kind: body.Kind, Action: body.Action, Params: body.Params, Enabled: enabled}
+	if _, err := parseContentRule(rule); err != nil {
+		return nil, apperror.Validation("Invalid params: " + err.Error())
+	}
+
+	ruleJSON, err := json.Marshal(map[string]any{
+		"kind": body.Kind, "action": body.Action, "params": body.Params, "enabled": enabled, "updated_by": actorID,
+	})
+	if err != nil {
+		slog.ErrorContext(ctx, "usecase error", "code", "561", "error", err)
+		return nil, err
+	}
+
+	res, err := userClient.SaveContentRule(ctx, name, ruleJSON)
+	if err != nil {
+		return nil, apperror.Upstream("Failed to save content rule", err)
+	}
+
+	contentRules.invalidate()
+	return &res.Rule, nil
+}
+
+func deleteContentRuleUsecase(ctx context.Context, name string) error {
+	if err := userClient.DeleteContentRule(ctx, name); err != nil {
+		if errors.Is(err, ErrContentRuleNotFound) {
+			return err
+		}
+		return apperror.Upstream("Failed to delete content rule", err)
+	}
+
+	contentRules.invalidate()
+	return nil
+}
+
+// check text written by a user against the enabled keyword, link and repeated character rules, errContentBlocked
+// when a block rule matches. Every matching rule is counted, flag rules only log the hit
+func checkContentText(ctx context.Context, target, text string) error {
+	if text == "" {
+		return nil
+	}
+
+	words := contentWords(text)
+	return applyContentRules(ctx, target, func(rule *contentRule) bool {
+		return rule.matchText(text, words)
+	})
+}
+
+// check a listing against the enabled price floor rules, errContentBlocked when a block rule matches
+func checkContentListing(ctx context.Context, listing Listing) error {
+	return applyContentRules(ctx, contentTargetListing, func(rule *contentRule) bool {
+		return rule.matchListing(listing)
+	})
+}
+
+func applyContentRules(ctx context.Context, target string, match func(rule *contentRule) bool) error {
+	var blocked []string
+	for _, rule := range contentRules.get(ctx) {
+		if !match(rule) {
+			continue
+		}
+
+		contentRuleHits.WithLabelValues(rule.name, target, rule.action).Inc()
+		if rule.action == contentRuleBlock {
+			blocked = append(blocked, rule.name)
+			continue
+		}
+		slog.WarnContext(ctx, "content flagged", "rule", rule.name, "target", target)
+	}
+
+	if len(blocked) > 0 {
+		slog.InfoContext(ctx, "content blocked", "rules", blocked, "target", target)
+		return errContentBlocked
+	}
+	return nil
+}
+
+// =========== REPOSITORY LAYER, CONTENT RULES CACHED FROM THE USER SERVICE ===========
+
+// links written out, with a scheme or starting with www.
+var contentURLPattern = regexp.MustCompile(`(?i)\b(?:https?://|www\.)\S+`)
+
+// parsed params of an enabled rule
+type contentRule struct {
+	name   string
+	kind   string
+	action string
+
+	// lowercase words of each keyword
+	keywords [][]string
+	maxURLs  int
+	minRun   int
+	floor    contentPriceFloor
+}
+
+type contentPriceFloor struct {
+	ListingType string `json:"listing_type"`
+	Region      string `json:"region"`
+	Currency    string `json:"currency"`
+	MinPrice    int    `json:"min_price"`
+}
+
+// rule with the params of its kind, an error naming what is wrong with them
+func parseContentRule(rule ContentRule) (*contentRule, error) {
+	parsed := &contentRule{name: rule.Name, kind: rule.Kind, action: rule.Action}
+	if rule.Action != contentRuleFlag && rule.Action != contentRuleBlock {
+		return nil, fmt.Errorf("unknown action %q", rule.Action)
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(rule.Params))
+	decoder.DisallowUnknownFields()
+	switch rule.Kind {
+	case contentRuleKeywords:
+		var params struct {
+			Keywords []string `json:"keywords"`
+		}
+		if err := decoder.Decode(&params); err != nil {
+			return nil, err
+		}
+		for _, keyword := range params.Keywords {
+			if words := contentWords(keyword); len(words) > 0 {
+				parsed.keywords = append(parsed.keywords, words)
+			}
+		}
+		if len(parsed.keywords) == 0 {
+			return nil, errors.New("keywords must have at least one word")
+		}
+	case contentRuleURLCount:
+		var params struct {
+			Max *int `json:"max"`
+		}
+		if err := decoder.Decode(&params); err != nil {
+			return nil, err
+		}
+		if params.Max == nil || *params.Max < 0 {
+			return nil, errors.New("max must be at least 0")
+		}
+		parsed.maxURLs = *params.Max
+	case contentRuleRepeatedChars:
+		var params struct {
+			MinRun int `json:"min_run"`
+		}
+		if err := decoder.Decode(&params); err != nil {
+			return nil, err
+		}
+		if params.MinRun < 2 {
+			return nil, errors.New("min_run must be at least 2")
+		}
+		parsed.minRun = params.MinRun
+	case contentRulePriceFloor:
+		if err := decoder.Decode(&parsed.floor); err != nil {
+			return nil, err
+		}
+		if parsed.floor.MinPrice <= 0 {
+			return nil, errors.New("min_price must be greater than 0")
+		}
+		if t := parsed.floor.ListingType; t != "" && t != "rent" && t != "sale" {
+			return nil, errors.New("listing_type must be rent or sale")
+		}
+		parsed.floor.Currency = strings.ToUpper(parsed.floor.Currency)
+	default:
+		return nil, fmt.Errorf("unknown kind %q", rule.Kind)
+	}
+
+	return parsed, nil
+}
+
+// lowercase runs of letters and digits of text
+func contentWords(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// text rules only, words are the contentWords of text
+func (r *contentRule) matchText(text string, words []string) bool {
+	switch r.kind {
+	case contentRuleKeywords:
+		for _, keyword := range r.keywords {
+			for i := 0; i+len(keyword) <= len(words); i++ {
+				if slices.Equal(words[i:i+len(keyword)], keyword) {
+					return true
+				}
+			}
+		}
+	case contentRuleURLCount:
+		return len(contentURLPattern.FindAllStringIndex(text, r.maxURLs+1)) > r.maxURLs
+	case contentRuleRepeatedChars:
+		run, previous := 0, rune(0)
+		for _, c := range text {
+			if c == previous && !unicode.IsSpace(c) {
+				run++
+			} else {
+				run, previous = 1, c
+			}
+			if run >= r.minRun {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// price floor rules only, a listing without currency is in the listing currency
+func (r *contentRule) matchListing(listing Listing) bool {
+	if r.kind != contentRulePriceFloor {
+		return false
+	}
+
+	currency := listing.Currency
+	if currency == "" {
+		currency = listingCurrency
+	}
+	floor := r.floor
+	return (floor.ListingType == "" || floor.ListingType == listing.ListingType) &&
+		(floor.Region == "" || strings.EqualFold(floor.Region, listing.Region)) &&
+		(floor.Currency == "" || floor.Currency == strings.ToUpper(currency)) &&
+		listing.Price < floor.MinPrice
+}
+
+// rules of the user service, set by Run, none are applied until then
+var contentRules = newContentRulesTable(nil, 0)
+
+// enabled rules of the user service, fetched again once ttl passed. A failed fetch keeps the rules fetched before
+type contentRulesTable struct {
+	load func(ctx context.Context) ([]ContentRule, error)
+	ttl  time.Duration
+
+	mu        sync.Mutex
+	rules     []*contentRule
+	loaded    bool
+	expiresAt time.Time
+}
+
+func newContentRulesTable(load func(ctx context.Context) ([]ContentRule, error), ttl time.Duration) *contentRulesTable {
+	return &contentRulesTable{load: load, ttl: ttl}
+}
+
+func newContentRules() *contentRulesTable {
+	return newContentRulesTable(func(ctx context.Context) ([]ContentRule, error) {
+		res, err := userClient.FindContentRules(ctx)
+		if err != nil {
+			return nil, err
+		}
+		return res.Rules, nil
+	}, contentRuleTTL)
+}
+
+func (t *contentRulesTable) get(ctx context.Context) []*contentRule {
+	if t.load == nil {
+		return nil
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if !t.loaded || !time.Now().Before(t.expiresAt) {
+		t.refresh(ctx)
+	}
+	return t.rules
+}
+
+func (t *contentRulesTable) refresh(ctx context.Context) {
+	// a failed fetch is tried again after ttl whatever happens, so a user service down is not asked per message
+	t.expiresAt = time.Now().Add(t.ttl)
+
+	stored, err := t.load(ctx)
+	if err != nil {
+		slog.WarnContext(ctx, "content rules refresh failed, applying the last rules fetched", "error", err)
+		return
+	}
+
+	rules := make([]*contentRule, 0, len(stored))
+	for _, s := range stored {
+		if !s.Enabled {
+			continue
+		}
+		parsed, err := parseContentRule(s)
+		if err != nil {
+			slog.ErrorContext(ctx, "service error", "code", "562", "error", err, "rule", s.Name, "kind", s.Kind)
+			continue
+		}
+		rules = append(rules, parsed)
+	}
+	t.rules, t.loaded = rules, true
+}
+
+// fetch the rules again on the next get, after a rule was saved or deleted through this instance
+func (t *contentRulesTable) invalidate() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.expiresAt = time.Time{}
+}
+
+var (
+	// user service api path
+	apiPathContentRules = userServiceURL + "/content-rules"
+	apiPathContentRule  = userServiceURL + "/content-rules/%s"
+)
+
+func (httpUserClient) FindContentRules(ctx context.Context) (*ContentRulesResponse, error) {
+	resp, err := httpGet(ctx, apiPathContentRules)
+	if err != nil {
+		slog.ErrorContext(ctx, "service error", "code", "563", "error", err)
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		slog.ErrorContext(ctx, "service error", "code", "564", "error", "error fetching content rules from user service")
+		return nil, errors.New("error fetching content rules from user service")
+	}
+
+	var rules ContentRulesResponse
+	if err := decodeJSON(resp.Body, &rules); err != nil {
+		slog.ErrorContext(ctx, "service error", "code", "564", "error", err)
+		return nil, err
+	}
+
+	return &rules, nil
+}
+
+func (httpUserClient) SaveContentRule(ctx context.Context, name string, ruleByte []byte) (*ContentRuleResponse, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, fmt.Sprintf(apiPathContentRule, url.PathEscape(name)), bytes.NewBuffer(ruleByte))
+	if err != nil {
+		slog.ErrorContext(ctx, "service error", "code", "565", "error", err)
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		slog.ErrorContext(ctx, "service error", "code", "565", "error", err)
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		slog.ErrorContext(ctx, "service error", "code", "566", "error", "error saving content rule from user service")
+		return nil, errors.New("error saving content rule from user service")
+	}
+
+	var saved ContentRuleResponse
+	if err := decodeJSON(resp.Body, &saved); err != nil {
+		slog.ErrorContext(ctx, "service error", "code", "566", "error", err)
+		return nil, err
+	}
+
+	return &saved, nil
+}
+
+func (httpUserClient) DeleteContentRule(ctx context.Context, name string) error {
+	resp, err := httpDelete(ctx, fmt.Sprintf(apiPathContentRule, url.PathEscape(name)))
+	if err != nil {
+		slog.ErrorContext(ctx, "service error", "code", "567", "error", err)
+		return err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return nil
+	case http.StatusNotFound:
+		return ErrContentRuleNotFound
+	default:
+		slog.ErrorContext(ctx, "service error", "code", "568", "error", "error deleting content rule from user service")
+		return errors.New("error deleting content rule from user service")
+	}
+}
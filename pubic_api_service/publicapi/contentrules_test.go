@@ -0,0 +1,111 @@
+package publicapi
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// content_rule_hits_total of rule, target and action registered by this process
+func contentRuleHitCount(t *testing.T, rule, target, action string) float64 {
+	t.Helper()
+	families, err := prometheus.DefaultGatherer.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{"rule": rule, "target": target, "action": action}
+	for _, family := range families {
+		if family.GetName() != "content_rule_hits_total" {
+			continue
+		}
+	metrics:
+		for _, metric := range family.GetMetric() {
+			for _, label := range metric.GetLabel() {
+				if value, ok := want[label.GetName()]; ok && value != label.GetValue() {
+					continue metrics
+				}
+			}
+			return metric.GetCounter().GetValue()
+		}
+	}
+	return 0
+}
+
+func TestCheckContent(t *testing.T) {
+	ctx := context.Background()
+	defer func() { contentRules = newContentRulesTable(nil, 0) }()
+
+	contentRules = newContentRulesTable(func(ctx context.Context) ([]ContentRule, error) {
+		return []ContentRule{
+			{Name: "wire", Kind: contentRuleKeywords, Action: contentRuleBlock, Params: json.RawMessage(`{"keywords":["Wire Transfer","deposit first"]}`), Enabled: true},
+			{Name: "links", Kind: contentRuleURLCount, Action: contentRuleFlag, Params: json.RawMessage(`{"max":1}`), Enabled: true},
+			{Name: "shouting", Kind: contentRuleRepeatedChars, Action: contentRuleBlock, Params: json.RawMessage(`{"min_run":5}`), Enabled: true},
+			{Name: "cheap-rent", Kind: contentRulePriceFloor, Action: contentRuleBlock, Params: json.RawMessage(`{"listing_type":"rent","min_price":300}`), Enabled: true},
+			{Name: "off", Kind: contentRuleKeywords, Action: contentRuleBlock, Params: json.RawMessage(`{"keywords":["hello"]}`)},
+			// saved by hand with params the checks can not apply, skipped
+			{Name: "broken", Kind: contentRuleURLCount, Action: contentRuleBlock, Params: json.RawMessage(`{"max":"two"}`), Enabled: true},
+		}, nil
+	}, time.Hour)
+
+	texts := []struct {
+		text    string
+		blocked bool
+	}{
+		{"Hello, is the unit still available?", false},
+		{"Please WIRE-transfer the deposit", true},
+		{"wire transferring is not a phrase match", false},
+		{"see https://a.example and www.b.example", false},
+		{"Great deal!!!!!", true},
+		{"Great deal!!!! ok", false},
+	}
+	for _, tt := range texts {
+		err := checkContentText(ctx, contentTargetOfferMessage, tt.text)
+		if blocked := errors.Is(err, errContentBlocked); blocked != tt.blocked {
+			t.Errorf("%q: blocked %v, want %v", tt.text, blocked, tt.blocked)
+		}
+	}
+	if hits := contentRuleHitCount(t, "links", contentTargetOfferMessage, contentRuleFlag); hits != 1 {
+		t.Errorf("links hits %v, want 1 for the flagged message", hits)
+	}
+
+	listings := []struct {
+		listing Listing
+		blocked bool
+	}{
+		{Listing{ListingType: "rent", Price: 100}, true},
+		{Listing{ListingType: "rent", Price: 300}, false},
+		{Listing{ListingType: "sale", Price: 100}, false},
+	}
+	for _, tt := range listings {
+		if blocked := errors.Is(checkContentListing(ctx, tt.listing), errContentBlocked); blocked != tt.blocked {
+			t.Errorf("%+v: blocked %v, want %v", tt.listing, blocked, tt.blocked)
+		}
+	}
+}
+
+func TestParseContentRule(t *testing.T) {
+	tests := []struct {
+		kind   string
+		params string
+		valid  bool
+	}{
+		{contentRuleKeywords, `{"keywords":["western union"]}`, true},
+		{contentRuleKeywords, `{"keywords":["!!!"]}`, false},
+		{contentRuleURLCount, `{"max":0}`, true},
+		{contentRuleURLCount, `{}`, false},
+		{contentRuleRepeatedChars, `{"min_run":1}`, false},
+		{contentRulePriceFloor, `{"region":"sg","currency":"sgd","min_price":500}`, true},
+		{contentRulePriceFloor, `{"listing_type":"lease","min_price":500}`, false},
+		{contentRulePriceFloor, `{"min_price":500,"max_price":1}`, false},
+	}
+	for _, tt := range tests {
+		_, err := parseContentRule(ContentRule{Name: "r", Kind: tt.kind, Action: contentRuleFlag, Params: json.RawMessage(tt.params)})
+		if valid := err == nil; valid != tt.valid {
+			t.Errorf("%s %s: %v, want valid %v", tt.kind, tt.params, err, tt.valid)
+		}
+	}
+}
@@ -0,0 +1,148 @@
+package publicapi
+
+import (
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"apperror"
+	"logging"
+
+	"github.com/gin-gonic/gin"
+)
+
+// =========== MIDDLEWARE LAYER, CORS AND SECURITY HEADERS FOR BROWSER CLIENTS ===========
+
+type corsPolicy struct {
+	// exact origins, * for any, or https://*.example.com for every subdomain
+	origins          []string
+	methods          string
+	headers          string
+	exposedHeaders   string
+	allowCredentials bool
+	maxAge           string
+}
+
+// CORS_ALLOWED_ORIGINS comma separated origins allowed to call the API from a browser, * for any origin or
+// https://*.example.com for every subdomain, empty disables CORS
+// CORS_ALLOWED_METHODS, CORS_ALLOWED_HEADERS and CORS_EXPOSED_HEADERS comma separated, default to what the API uses
+// CORS_ALLOW_CREDENTIALS let browsers send cookies and authorization, not allowed with *
+// CORS_MAX_AGE how long browsers cache a preflight answer
+func corsPolicyFromConfig() *corsPolicy {
+	origins := cfg.List("CORS_ALLOWED_ORIGINS")
+	if len(origins) == 0 {
+		return nil
+	}
+
+	policy := &corsPolicy{
+		origins:          origins,
+		methods:          listOrDefault("CORS_ALLOWED_METHODS", "GET, POST, PUT, PATCH, DELETE"),
+		headers:          listOrDefault("CORS_ALLOWED_HEADERS", "Authorization, Content-Type, Idempotency-Key, Last-Event-ID, "+headerConsistency+", "+apiVersionHeader+", "+logging.HeaderRequestID),
+		exposedHeaders:   listOrDefault("CORS_EXPOSED_HEADERS", "Location, Retry-After, RateLimit-Limit, RateLimit-Remaining, RateLimit-Reset, "+headerIdempotentReplayed+", "+headerConsistency+", "+headerReadRegion+", "+headerReadStaleness+", "+apiVersionHeader+", "+logging.HeaderRequestID),
+		allowCredentials: cfg.Bool("CORS_ALLOW_CREDENTIALS", false),
+		maxAge:           strconv.Itoa(int(cfg.Duration("CORS_MAX_AGE", 10*time.Minute) / time.Second)),
+	}
+
+	for _, origin := range origins {
+		if origin == "*" && policy.allowCredentials {
+			log.Fatal("CORS_ALLOW_CREDENTIALS can not be used with CORS_ALLOWED_ORIGINS *")
+		}
+	}
+
+	return policy
+}
+
+func listOrDefault(key, def string) string {
+	if items := cfg.List(key); len(items) > 0 {
+		return strings.Join(items, ", ")
+	}
+
+	return def
+}
+
+func (p *corsPolicy) allows(origin string) bool {
+	for _, allowed := range p.origins {
+		if allowed == "*" || strings.EqualFold(allowed, origin) {
+			return true
+		}
+
+		if scheme, domain, ok := strings.Cut(allowed, "://*."); ok {
+			rest, ok := strings.CutPrefix(strings.ToLower(origin), strings.ToLower(scheme)+"://")
+			if ok && strings.HasSuffix(rest, "."+strings.ToLower(domain)) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// answer preflights and add CORS headers for allowed origins, before rate limiting so preflights are not counted,
+// requests of other origins are served without CORS headers and blocked by the browser
+func corsMiddleware(policy *corsPolicy) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		origin := c.GetHeader("Origin")
+		if policy == nil || origin == "" {
+			c.Next()
+			return
+		}
+
+		// responses differ per origin, caches must not mix them
+		c.Writer.Header().Add("Vary", "Origin")
+
+		preflight := c.Request.Method == http.MethodOptions && c.GetHeader("Access-Control-Request-Method") != ""
+		if !policy.allows(origin) {
+			if preflight {
+				apperror.Abort(c, http.StatusForbidden, "Origin not allowed")
+				return
+			}
+			c.Next()
+			return
+		}
+
+		c.Header("Access-Control-Allow-Origin", origin)
+		if policy.allowCredentials {
+			c.Header("Access-Control-Allow-Credentials", "true")
+		}
+
+		if preflight {
+			c.Header("Access-Control-Allow-Methods", policy.methods)
+			c.Header("Access-Control-Allow-Headers", policy.headers)
+			c.Header("Access-Control-Max-Age", policy.maxAge)
+			c.AbortWithStatus(http.StatusNoContent)
+			return
+		}
+
+		c.Header("Access-Control-Expose-Headers", policy.exposedHeaders)
+		c.Next()
+	}
+}
+
+// SECURITY_FRAME_OPTIONS X-Frame-Options of every response, DENY or SAMEORIGIN
+// SECURITY_HSTS_MAX_AGE Strict-Transport-Security max age, only when every client reaches the API over https,
+// 0 sends none
+func securityHeadersMiddleware() gin.HandlerFunc {
+	frameOptions := strings.ToUpper(cfg.String("SECURITY_FRAME_OPTIONS", "DENY"))
+	if frameOptions != "DENY" && frameOptions != "SAMEORIGIN" {
+		log.Fatalf("invalid SECURITY_FRAME_OPTIONS %q, use DENY or SAMEORIGIN", frameOptions)
+	}
+
+	hsts := ""
+	if maxAge := cfg.Duration("SECURITY_HSTS_MAX_AGE", 0); maxAge > 0 {
+		hsts = "max-age=" + strconv.Itoa(int(maxAge/time.Second)) + "; includeSubDomains"
+	}
+
+	return func(c *gin.Context) {
+		header := c.Writer.Header()
+		header.Set("X-Content-Type-Options", "nosniff")
+		header.Set("X-Frame-Options", frameOptions)
+		header.Set("Referrer-Policy", "no-referrer")
+		if hsts != "" {
+			header.Set("Strict-Transport-Security", hsts)
+		}
+
+		c.Next()
+	}
+}
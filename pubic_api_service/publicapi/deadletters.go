@@ -0,0 +1,432 @@
+package publicapi
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"apperror"
+	"events"
+
+	"github.com/gin-gonic/gin"
+)
+
+// queue of the listing service outbox in the dead letters, requeued through its outbox endpoints
+const deadLetterListingEvents = "listing_events"
+
+// event or webhook delivery out of attempts kept by the user service, source is user_events, webhook_deliveries or
+// listing_events and source id the id of the event in that queue
+type DeadLetter struct {
+	ID        int64        `json:"id"`
+	Source    string       `json:"source"`
+	SourceID  int64        `json:"source_id"`
+	EventKey  string       `json:"event_key"`
+	Event     events.Event `json:"event"`
+	Attempts  int          `json:"attempts"`
+	LastError string       `json:"last_error"`
+	CreatedAt int64        `json:"created_at"`
+	UpdatedAt int64        `json:"updated_at"`
+}
+
+// dead letter of the listing service outbox recorded by its relay
+type DeadLetterCreate struct {
+	Source    string       `json:"source"`
+	SourceID  int64        `json:"source_id"`
+	EventKey  string       `json:"event_key"`
+	Event     events.Event `json:"event"`
+	Attempts  int          `json:"attempts"`
+	LastError string       `json:"last_error"`
+}
+
+// event replacing the one of a dead letter, its id stays the same
+type DeadLetterUpdate struct {
+	Event events.Event `json:"event"`
+}
+
+type DeadLettersResponse struct {
+	Result      bool         `json:"result"`
+	DeadLetters []DeadLetter `json:"dead_letters"`
+	Pagination  Pagination   `json:"pagination"`
+}
+
+type DeadLetterResponse struct {
+	Result     bool       `json:"result"`
+	DeadLetter DeadLetter `json:"dead_letter"`
+}
+
+var (
+	ErrDeadLetterNotFound = apperror.NotFound("Dead letter not found")
+	ErrDeadLetterInvalid  = apperror.Validation("event id must be the id of the dead letter, type a known event type and data a json value")
+	ErrDeadLetterGone     = apperror.Conflict("event of the dead letter no longer in its queue")
+	errDeadLetterPage     = apperror.Validation("page_num must be at least 1 and page_size between 1 and 100, source one of user_events, webhook_deliveries, listing_events")
+)
+
+// =========== INTERFACE HANDLER, HANDLING REQUEST RESPONSE API DEPEND INTERFACE ===========
+
+// dead letters newest first, of one source when set
+func getDeadLettersHandler(c *gin.Context) {
+	pageNum, errNum := strconv.Atoi(c.DefaultQuery("page_num", "1"))
+	pageSize, errSize := strconv.Atoi(c.DefaultQuery("page_size", "50"))
+	if errNum != nil || errSize != nil {
+		apperror.Respond(c, errDeadLetterPage)
+		return
+	}
+
+	res, err := getDeadLettersUsecase(c.Request.Context(), c.Query("source"), pageNum, pageSize)
+	if err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"dead_letters": res.DeadLetters, "pagination": res.Pagination})
+}
+
+// dead letter with its payload
+func getDeadLetterHandler(c *gin.Context) {
+	id, ok := deadLetterID(c)
+	if !ok {
+		return
+	}
+
+	letter, err := getDeadLetterUsecase(c.Request.Context(), id)
+	if err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"dead_letter": letter})
+}
+
+// replace the event of a dead letter before requeueing it, e.g. to fix the data its consumers rejected
+func updateDeadLetterHandler(c *gin.Context) {
+	id, ok := deadLetterID(c)
+	if !ok {
+		return
+	}
+
+	var body DeadLetterUpdate
+	if err := c.ShouldBindJSON(&body); err != nil {
+		slog.ErrorContext(c.Request.Context(), "handler error", "code", "486", "error", err)
+		apperror.RespondBinding(c, err)
+		return
+	}
+
+	letter, err := updateDeadLetterUsecase(c.Request.Context(), id, body)
+	if err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"dead_letter": letter})
+}
+
+// put the event of a dead letter back in its queue with fresh attempts, the dead letter is removed
+func requeueDeadLetterHandler(c *gin.Context) {
+	id, ok := deadLetterID(c)
+	if !ok {
+		return
+	}
+
+	letter, err := requeueDeadLetterUsecase(c.Request.Context(), id)
+	if err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"dead_letter": letter})
+}
+
+// discard a dead letter, its event is never published
+func deleteDeadLetterHandler(c *gin.Context) {
+	id, ok := deadLetterID(c)
+	if !ok {
+		return
+	}
+
+	if err := deleteDeadLetterUsecase(c.Request.Context(), id); err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// id param of the dead letter, false once the bad request is answered
+func deadLetterID(c *gin.Context) (int64, bool) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "handler error", "code", "487", "error", err)
+		apperror.JSON(c, http.StatusBadRequest, "Invalid dead letter ID")
+		return 0, false
+	}
+
+	return id, true
+}
+
+// =========== USECASE LAYER, SERVES AS AN INTERMEDIARY BETWEEN THE PRESENTATION LAYER AND THE DATA LAYER ===========
+
+func getDeadLettersUsecase(ctx context.Context, source string, pageNum, pageSize int) (*DeadLettersResponse, error) {
+	if pageNum < 1 || pageSize < 1 || pageSize > 100 {
+		return nil, errDeadLetterPage
+	}
+
+	res, err := userClient.FindDeadLetters(ctx, source, pageNum, pageSize)
+	if err != nil {
+		if errors.Is(err, apperror.ErrValidation) {
+			return nil, errDeadLetterPage
+		}
+		return nil, apperror.Upstream("Failed to get dead letters", err)
+	}
+
+	return res, nil
+}
+
+func getDeadLetterUsecase(ctx context.Context, id int64) (*DeadLetter, error) {
+	res, err := userClient.FindDeadLetter(ctx, id)
+	if err != nil {
+		if errors.Is(err, ErrDeadLetterNotFound) {
+			return nil, err
+		}
+		return nil, apperror.Upstream("Failed to get dead letter", err)
+	}
+
+	return &res.DeadLetter, nil
+}
+
+func updateDeadLetterUsecase(ctx context.Context, id int64, update DeadLetterUpdate) (*DeadLetter, error) {
+	auditBefore(ctx, func() (any, error) { return getDeadLetterUsecase(ctx, id) })
+
+	updateJSON, err := json.Marshal(update)
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := userClient.UpdateDeadLetter(ctx, id, updateJSON)
+	if err != nil {
+		if errors.Is(err, ErrDeadLetterNotFound) || errors.Is(err, ErrDeadLetterInvalid) {
+			return nil, err
+		}
+		return nil, apperror.Upstream("Failed to update dead letter", err)
+	}
+
+	return &res.DeadLetter, nil
+}
+
+// the user service requeues its own queues, an event of the listing service outbox is set pending there then its
+// dead letter is removed. A failed removal leaves the dead letter of an event published again, discard it then
+func requeueDeadLetterUsecase(ctx context.Context, id int64) (*DeadLetter, error) {
+	letter, err := getDeadLetterUsecase(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	auditBefore(ctx, func() (any, error) { return letter, nil })
+
+	if letter.Source != deadLetterListingEvents {
+		res, err := userClient.RequeueDeadLetter(ctx, id)
+		if err != nil {
+			if errors.Is(err, ErrDeadLetterNotFound) || errors.Is(err, ErrDeadLetterGone) {
+				return nil, err
+			}
+			return nil, apperror.Upstream("Failed to requeue dead letter", err)
+		}
+		return &res.DeadLetter, nil
+	}
+
+	if err := (listingOutbox{}).Requeue(ctx, letter.SourceID, letter.Event); err != nil {
+		if errors.Is(err, ErrDeadLetterGone) {
+			return nil, err
+		}
+		return nil, apperror.Upstream("Failed to requeue listing event", err)
+	}
+
+	if err := userClient.DeleteDeadLetter(ctx, id); err != nil && !errors.Is(err, ErrDeadLetterNotFound) {
+		slog.ErrorContext(ctx, "usecase error", "code", "488", "error", err, "dead_letter_id", id)
+		return nil, apperror.Upstream("Listing event requeued but its dead letter was kept", err)
+	}
+
+	slog.InfoContext(ctx, "dead letter requeued", "dead_letter_id", id, "source", letter.Source, "event_id", letter.Event.ID)
+	return letter, nil
+}
+
+func deleteDeadLetterUsecase(ctx context.Context, id int64) error {
+	auditBefore(ctx, func() (any, error) { return getDeadLetterUsecase(ctx, id) })
+
+	if err := userClient.DeleteDeadLetter(ctx, id); err != nil {
+		if errors.Is(err, ErrDeadLetterNotFound) {
+			return err
+		}
+		return apperror.Upstream("Failed to discard dead letter", err)
+	}
+
+	return nil
+}
+
+// =========== REPOSITORY LAYER, ABSTRACTION OVER THE DATA PERSISTENCE (databases, file systems, or external APIs) ===========
+
+// set the dead event id of the listing service outbox pending now with no attempts made and event as its payload
+func (o listingOutbox) Requeue(ctx context.Context, id int64, event events.Event) error {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	err = o.update(ctx, id, url.Values{
+		"status":          {"pending"},
+		"attempts":        {"0"},
+		"next_attempt_at": {strconv.FormatInt(time.Now().UnixMicro(), 10)},
+		"payload":         {string(payload)},
+	})
+	if errors.Is(err, errOutboxEventNotFound) {
+		return ErrDeadLetterGone
+	}
+	return err
+}
+
+// user service api path
+var (
+	apiPathDeadLetters       = userServiceURL + "/dead-letters"
+	apiPathDeadLetter        = userServiceURL + "/dead-letters/%d"
+	apiPathDeadLetterRequeue = userServiceURL + "/dead-letters/%d/requeue"
+)
+
+func (httpUserClient) FindDeadLetters(ctx context.Context, source string, pageNum, pageSize int) (*DeadLettersResponse, error) {
+	query := url.Values{"page_num": {strconv.Itoa(pageNum)}, "page_size": {strconv.Itoa(pageSize)}}
+	if source != "" {
+		query.Set("source", source)
+	}
+	resp, err := httpGet(ctx, apiPathDeadLetters+"?"+query.Encode())
+	if err != nil {
+		slog.ErrorContext(ctx, "service error", "code", "489", "error", err)
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusBadRequest:
+		return nil, errDeadLetterPage
+	default:
+		slog.ErrorContext(ctx, "service error", "code", "490", "error", "error fetching dead letters from user service")
+		return nil, errors.New("error fetching dead letters from user service")
+	}
+
+	var letters DeadLettersResponse
+	if err := decodeJSON(resp.Body, &letters); err != nil {
+		slog.ErrorContext(ctx, "service error", "code", "490", "error", err)
+		return nil, err
+	}
+
+	return &letters, nil
+}
+
+func (httpUserClient) FindDeadLetter(ctx context.Context, id int64) (*DeadLetterResponse, error) {
+	resp, err := httpGet(ctx, fmt.Sprintf(apiPathDeadLetter, id))
+	if err != nil {
+		slog.ErrorContext(ctx, "service error", "code", "491", "error", err)
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	return decodeDeadLetter(ctx, resp, "492", "error fetching dead letter from user service")
+}
+
+func (httpUserClient) CreateDeadLetter(ctx context.Context, letterByte []byte) (*DeadLetterResponse, error) {
+	resp, err := httpPost(ctx, apiPathDeadLetters, "application/json", bytes.NewBuffer(letterByte))
+	if err != nil {
+		slog.ErrorContext(ctx, "service error", "code", "493", "error", err)
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusCreated {
+		slog.ErrorContext(ctx, "service error", "code", "494", "error", "error recording dead letter from user service")
+		return nil, errors.New("error recording dead letter from user service")
+	}
+
+	var letter DeadLetterResponse
+	if err := decodeJSON(resp.Body, &letter); err != nil {
+		slog.ErrorContext(ctx, "service error", "code", "494", "error", err)
+		return nil, err
+	}
+
+	return &letter, nil
+}
+
+func (httpUserClient) UpdateDeadLetter(ctx context.Context, id int64, updateByte []byte) (*DeadLetterResponse, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, fmt.Sprintf(apiPathDeadLetter, id), bytes.NewBuffer(updateByte))
+	if err != nil {
+		slog.ErrorContext(ctx, "service error", "code", "495", "error", err)
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		slog.ErrorContext(ctx, "service error", "code", "495", "error", err)
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	return decodeDeadLetter(ctx, resp, "496", "error updating dead letter from user service")
+}
+
+func (httpUserClient) RequeueDeadLetter(ctx context.Context, id int64) (*DeadLetterResponse, error) {
+	resp, err := httpPost(ctx, fmt.Sprintf(apiPathDeadLetterRequeue, id), "application/json", nil)
+	if err != nil {
+		slog.ErrorContext(ctx, "service error", "code", "497", "error", err)
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	return decodeDeadLetter(ctx, resp, "498", "error requeueing dead letter from user service")
+}
+
+func (httpUserClient) DeleteDeadLetter(ctx context.Context, id int64) error {
+	resp, err := httpDelete(ctx, fmt.Sprintf(apiPathDeadLetter, id))
+	if err != nil {
+		slog.ErrorContext(ctx, "service error", "code", "499", "error", err)
+		return err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return nil
+	case http.StatusNotFound:
+		return ErrDeadLetterNotFound
+	default:
+		slog.ErrorContext(ctx, "service error", "code", "500", "error", "error discarding dead letter from user service")
+		return errors.New("error discarding dead letter from user service")
+	}
+}
+
+// dead letter answered by the user service, its errors as the public API ones
+func decodeDeadLetter(ctx context.Context, resp *http.Response, code, message string) (*DeadLetterResponse, error) {
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		return nil, ErrDeadLetterNotFound
+	case http.StatusBadRequest:
+		return nil, ErrDeadLetterInvalid
+	case http.StatusConflict:
+		return nil, ErrDeadLetterGone
+	default:
+		slog.ErrorContext(ctx, "service error", "code", code, "error", message)
+		return nil, errors.New(message)
+	}
+
+	var letter DeadLetterResponse
+	if err := decodeJSON(resp.Body, &letter); err != nil {
+		slog.ErrorContext(ctx, "service error", "code", code, "error", err)
+		return nil, err
+	}
+
+	return &letter, nil
+}
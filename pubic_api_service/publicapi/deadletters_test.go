@@ -0,0 +1,106 @@
+package publicapi
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"events"
+)
+
+// dead letters of the user service by id, requeued ones are removed like the user service does
+type deadLetterUserClient struct {
+	UserClient
+	letters map[int64]*DeadLetter
+}
+
+func (c deadLetterUserClient) CreateDeadLetter(ctx context.Context, letterByte []byte) (*DeadLetterResponse, error) {
+	var create DeadLetterCreate
+	if err := json.Unmarshal(letterByte, &create); err != nil {
+		return nil, err
+	}
+
+	letter := DeadLetter{ID: int64(len(c.letters) + 1), Source: create.Source, SourceID: create.SourceID, EventKey: create.EventKey,
+		Event: create.Event, Attempts: create.Attempts, LastError: create.LastError}
+	c.letters[letter.ID] = &letter
+	return &DeadLetterResponse{Result: true, DeadLetter: letter}, nil
+}
+
+func (c deadLetterUserClient) FindDeadLetter(ctx context.Context, id int64) (*DeadLetterResponse, error) {
+	letter, ok := c.letters[id]
+	if !ok {
+		return nil, ErrDeadLetterNotFound
+	}
+	return &DeadLetterResponse{Result: true, DeadLetter: *letter}, nil
+}
+
+func (c deadLetterUserClient) RequeueDeadLetter(ctx context.Context, id int64) (*DeadLetterResponse, error) {
+	res, err := c.FindDeadLetter(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	delete(c.letters, id)
+	return res, nil
+}
+
+func (c deadLetterUserClient) DeleteDeadLetter(ctx context.Context, id int64) error {
+	if _, ok := c.letters[id]; !ok {
+		return ErrDeadLetterNotFound
+	}
+	delete(c.letters, id)
+	return nil
+}
+
+func TestRequeueDeadLetterUsecase(t *testing.T) {
+	var requeued []url.Values
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		if r.Method != http.MethodPut || r.URL.Path != "/outbox/4" {
+			// event 5 is no longer dead in the listing outbox
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		requeued = append(requeued, r.PostForm)
+		w.Write([]byte(`{"result": true}`))
+	}))
+	defer server.Close()
+
+	previousEvent := apiPathOutboxEvent
+	apiPathOutboxEvent = server.URL + "/outbox/%d"
+	defer func() { apiPathOutboxEvent = previousEvent }()
+
+	event := events.Event{ID: "e1", Type: events.ListingUpdated, OccurredAt: 1, Data: json.RawMessage(`{"id":7}`)}
+	letters := deadLetterUserClient{letters: map[int64]*DeadLetter{
+		1: {ID: 1, Source: deadLetterListingEvents, SourceID: 4, EventKey: "listing:7", Event: event, Attempts: 10},
+		2: {ID: 2, Source: "user_events", SourceID: 9, EventKey: "user:3", Event: events.Event{ID: "e2", Type: events.UserUpdated}},
+		3: {ID: 3, Source: deadLetterListingEvents, SourceID: 5, EventKey: "listing:8", Event: event},
+	}}
+	userClient = letters
+	ctx := context.Background()
+
+	if _, err := requeueDeadLetterUsecase(ctx, 1); err != nil {
+		t.Fatal(err)
+	}
+	if len(requeued) != 1 || requeued[0].Get("status") != "pending" || requeued[0].Get("attempts") != "0" ||
+		requeued[0].Get("payload") != `{"id":"e1","type":"listing.updated","occurred_at":1,"data":{"id":7}}` {
+		t.Errorf("listing outbox updates %v, want event 4 pending with its payload", requeued)
+	}
+
+	if _, err := requeueDeadLetterUsecase(ctx, 2); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := requeueDeadLetterUsecase(ctx, 3); !errors.Is(err, ErrDeadLetterGone) {
+		t.Errorf("requeue of an event no longer dead: %v, want ErrDeadLetterGone", err)
+	}
+	if _, err := requeueDeadLetterUsecase(ctx, 4); !errors.Is(err, ErrDeadLetterNotFound) {
+		t.Errorf("requeue of an unknown dead letter: %v, want ErrDeadLetterNotFound", err)
+	}
+
+	if len(letters.letters) != 1 || letters.letters[3] == nil {
+		t.Errorf("dead letters left %v, want the one of event 5 kept", letters.letters)
+	}
+}
@@ -0,0 +1,186 @@
+package publicapi
+
+import (
+	"bytes"
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// =========== DEBUG INTROSPECTION, UPSTREAM CALLS OF A REQUEST RETURNED IN THE RESPONSE ===========
+
+const headerDebug = "X-Debug"
+
+// DEBUG_RESPONSE_ENABLED honor X-Debug: true, the caller must also send X-API-Key when INTERNAL_API_KEY is set
+var debugResponseEnabled = cfg.Bool("DEBUG_RESPONSE_ENABLED", false)
+
+// DEBUG_RESPONSE_FIELD name of the field added to json object responses
+var debugResponseField = cfg.String("DEBUG_RESPONSE_FIELD", "_debug")
+
+// one call to the listing or user service
+type UpstreamCall struct {
+	Method    string  `json:"method"`
+	URL       string  `json:"url"`
+	Status    int     `json:"status"`
+	LatencyMs float64 `json:"latency_ms"`
+	Retries   int     `json:"retries"`
+	CacheHit  bool    `json:"cache_hit"`
+	Error     string  `json:"error,omitempty"`
+}
+
+type DebugInfo struct {
+	TotalCalls int            `json:"total_calls"`
+	Calls      []UpstreamCall `json:"calls"`
+}
+
+// upstream calls of one request, appended concurrently by aggregation goroutines
+type debugTrace struct {
+	mu    sync.Mutex
+	calls []*UpstreamCall
+}
+
+type ctxKeyDebugTrace struct{}
+type ctxKeyUpstreamCall struct{}
+
+func (t *debugTrace) info() DebugInfo {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	info := DebugInfo{TotalCalls: len(t.calls), Calls: make([]UpstreamCall, 0, len(t.calls))}
+	for _, call := range t.calls {
+		info.Calls = append(info.Calls, *call)
+	}
+	return info
+}
+
+// count a retry on the call of ctx, no-op when the request is not debugged
+func recordRetry(ctx context.Context) {
+	trace, _ := ctx.Value(ctxKeyDebugTrace{}).(*debugTrace)
+	call, _ := ctx.Value(ctxKeyUpstreamCall{}).(*UpstreamCall)
+	if trace == nil || call == nil {
+		return
+	}
+
+	trace.mu.Lock()
+	call.Retries++
+	trace.mu.Unlock()
+}
+
+// record a lookup served from a cache instead of an upstream call, no-op when the request is not debugged
+func recordCacheHit(ctx context.Context, method, url string) {
+	trace, _ := ctx.Value(ctxKeyDebugTrace{}).(*debugTrace)
+	if trace == nil {
+		return
+	}
+
+	trace.mu.Lock()
+	trace.calls = append(trace.calls, &UpstreamCall{Method: method, URL: url, Status: http.StatusOK, CacheHit: true})
+	trace.mu.Unlock()
+}
+
+// =========== MIDDLEWARE LAYER, RUN BEFORE INTERFACE HANDLER TO ENRICH OR GUARD THE REQUEST ===========
+
+// collect upstream calls of requests sent with X-Debug: true and add them to the json response
+func debugMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !debugResponseEnabled || !strings.EqualFold(c.GetHeader(headerDebug), "true") {
+			c.Next()
+			return
+		}
+
+		if internalAPIKey != "" && subtle.ConstantTimeCompare([]byte(c.GetHeader(headerAPIKey)), []byte(internalAPIKey)) != 1 {
+			// not an operator, serve the request without debug info
+			c.Next()
+			return
+		}
+
+		trace := &debugTrace{}
+		c.Request = c.Request.WithContext(context.WithValue(c.Request.Context(), ctxKeyDebugTrace{}, trace))
+
+		writer := &debugWriter{ResponseWriter: c.Writer}
+		c.Writer = writer
+		c.Next()
+		c.Writer = writer.ResponseWriter
+
+		// body length changes with the added field
+		writer.Header().Del("Content-Length")
+		writer.ResponseWriter.Write(withDebugField(writer.body.Bytes(), trace.info()))
+	}
+}
+
+// buffer the response so the debug field can be added once the handler is done
+type debugWriter struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+func (w *debugWriter) Write(b []byte) (int, error) {
+	return w.body.Write(b)
+}
+
+func (w *debugWriter) WriteString(s string) (int, error) {
+	return w.body.WriteString(s)
+}
+
+// add the debug field to a json object body, other bodies are returned untouched
+func withDebugField(body []byte, info DebugInfo) []byte {
+	var object map[string]json.RawMessage
+	if err := json.Unmarshal(body, &object); err != nil || object == nil {
+		return body
+	}
+
+	raw, err := json.Marshal(info)
+	if err != nil {
+		return body
+	}
+	object[debugResponseField] = raw
+
+	out, err := json.Marshal(object)
+	if err != nil {
+		return body
+	}
+	return out
+}
+
+// =========== REPOSITORY LAYER, SHARED HTTP CLIENT FOR CALLS TO USER AND LISTING SERVICE ===========
+
+// record every call made for a debugged request, outside the breaker so retries of the call are counted on it
+type debugTransport struct {
+	base http.RoundTripper
+}
+
+func (t *debugTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	trace, _ := req.Context().Value(ctxKeyDebugTrace{}).(*debugTrace)
+	if trace == nil {
+		return t.base.RoundTrip(req)
+	}
+
+	call := &UpstreamCall{Method: req.Method, URL: req.URL.String()}
+	trace.mu.Lock()
+	trace.calls = append(trace.calls, call)
+	trace.mu.Unlock()
+
+	start := time.Now()
+	resp, err := t.base.RoundTrip(req.WithContext(context.WithValue(req.Context(), ctxKeyUpstreamCall{}, call)))
+
+	trace.mu.Lock()
+	defer trace.mu.Unlock()
+	call.LatencyMs = float64(time.Since(start).Microseconds()) / 1000
+	switch {
+	case err == nil:
+		call.Status = resp.StatusCode
+	case errors.Is(err, errCircuitOpen):
+		call.Error = "circuit_open"
+	default:
+		call.Error = err.Error()
+	}
+
+	return resp, err
+}
@@ -0,0 +1,318 @@
+package publicapi
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"apperror"
+
+	"github.com/gin-gonic/gin"
+)
+
+// device of a user receiving push notifications, platform is fcm or apns
+type PushDevice struct {
+	ID        int    `json:"id"`
+	UserID    int    `json:"user_id"`
+	Platform  string `json:"platform"`
+	Token     string `json:"token"`
+	CreatedAt int64  `json:"created_at"`
+	UpdatedAt int64  `json:"updated_at"`
+	// set once the platform rejected the token, the device is no longer pushed to
+	InvalidatedAt *int64 `json:"invalidated_at"`
+	InvalidReason string `json:"invalid_reason,omitempty"`
+}
+
+type PushDeviceCreate struct {
+	Platform string `json:"platform" binding:"required,oneof=fcm apns"`
+	Token    string `json:"token" binding:"required,notblank,max=4096"`
+}
+
+// outcome of a push sent to a device, status is delivered, failed or invalid
+type PushReceipt struct {
+	ID        int64  `json:"id"`
+	DeviceID  int    `json:"device_id"`
+	Event     string `json:"event"`
+	Status    string `json:"status"`
+	Error     string `json:"error,omitempty"`
+	CreatedAt int64  `json:"created_at"`
+}
+
+type PushDeviceResponse struct {
+	Result bool `json:"result"`
+	Device PushDevice
+}
+
+type PushDevicesResponse struct {
+	Result  bool `json:"result"`
+	Devices []PushDevice
+}
+
+type PushReceiptsResponse struct {
+	Result   bool `json:"result"`
+	Receipts []PushReceipt
+}
+
+var (
+	ErrPushDeviceInvalid  = apperror.Validation("platform must be fcm or apns and token set")
+	ErrPushDeviceNotFound = apperror.NotFound("Device not found")
+	ErrPushDeviceLimit    = apperror.Conflict("device limit reached, delete a device first")
+
+	errPushReceiptsLimit = apperror.Validation("limit must be between 1 and 200")
+)
+
+// =========== INTERFACE HANDLER, HANDLING REQUEST RESPONSE API DEPEND INTERFACE ===========
+
+// devices of the authenticated user, invalidated ones included
+func getDevicesHandler(c *gin.Context) {
+	res, err := getDevicesUsecase(c.Request.Context(), authUserID(c))
+	if err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"devices": res})
+}
+
+// register the device of an app, apps register on every start so a refreshed token replaces nothing and a token
+// rejected before is tried again
+func registerDeviceHandler(c *gin.Context) {
+	var body PushDeviceCreate
+	if err := c.ShouldBindJSON(&body); err != nil {
+		slog.ErrorContext(c.Request.Context(), "handler error", "code", "343", "error", err)
+		apperror.RespondBinding(c, err)
+		return
+	}
+
+	res, err := registerDeviceUsecase(c.Request.Context(), authUserID(c), body)
+	if err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"device": res})
+}
+
+// delete a device of the authenticated user, on logout of the app
+func deleteDeviceHandler(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "handler error", "code", "344", "error", err)
+		apperror.JSON(c, http.StatusBadRequest, "Invalid device ID")
+		return
+	}
+
+	if err := deleteDeviceUsecase(c.Request.Context(), authUserID(c), id); err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// latest pushes sent to a device of the authenticated user, ?limit= 50 by default
+func getPushReceiptsHandler(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "handler error", "code", "345", "error", err)
+		apperror.JSON(c, http.StatusBadRequest, "Invalid device ID")
+		return
+	}
+
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "50"))
+	if err != nil {
+		apperror.Respond(c, errPushReceiptsLimit)
+		return
+	}
+
+	res, err := getPushReceiptsUsecase(c.Request.Context(), authUserID(c), id, limit)
+	if err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"receipts": res})
+}
+
+// =========== USECASE LAYER, SERVES AS AN INTERMEDIARY BETWEEN THE PRESENTATION LAYER AND THE DATA LAYER ===========
+
+func getDevicesUsecase(ctx context.Context, userID int) ([]PushDevice, error) {
+	res, err := userClient.FindUserDevices(ctx, userID)
+	if err != nil {
+		return nil, apperror.Upstream("Failed to get devices", err)
+	}
+
+	return res.Devices, nil
+}
+
+func registerDeviceUsecase(ctx context.Context, userID int, device PushDeviceCreate) (*PushDevice, error) {
+	deviceJSON, err := json.Marshal(device)
+	if err != nil {
+		slog.ErrorContext(ctx, "usecase error", "code", "346", "error", err)
+		return nil, err
+	}
+
+	res, err := userClient.RegisterUserDevice(ctx, userID, deviceJSON)
+	if err != nil {
+		if errors.Is(err, ErrUserNotFound) || errors.Is(err, ErrPushDeviceInvalid) || errors.Is(err, ErrPushDeviceLimit) {
+			return nil, err
+		}
+		return nil, apperror.Upstream("Failed to register device", err)
+	}
+
+	return &res.Device, nil
+}
+
+func deleteDeviceUsecase(ctx context.Context, userID, deviceID int) error {
+	if err := userClient.DeleteUserDevice(ctx, userID, deviceID); err != nil {
+		if errors.Is(err, ErrPushDeviceNotFound) {
+			return err
+		}
+		return apperror.Upstream("Failed to delete device", err)
+	}
+
+	return nil
+}
+
+func getPushReceiptsUsecase(ctx context.Context, userID, deviceID, limit int) ([]PushReceipt, error) {
+	if limit < 1 || limit > 200 {
+		return nil, errPushReceiptsLimit
+	}
+
+	res, err := userClient.FindPushReceipts(ctx, userID, deviceID, limit)
+	if err != nil {
+		if errors.Is(err, ErrPushDeviceNotFound) {
+			return nil, err
+		}
+		return nil, apperror.Upstream("Failed to get push receipts", err)
+	}
+
+	return res.Receipts, nil
+}
+
+// =========== REPOSITORY LAYER, ABSTRACTION OVER THE DATA PERSISTENCE (databases, file systems, or external APIs) ===========
+
+var (
+	// user service api path
+	apiPathUserDevices  = userServiceURL + "/users/%d/devices"
+	apiPathUserDevice   = userServiceURL + "/users/%d/devices/%d"
+	apiPathPushReceipts = userServiceURL + "/users/%d/devices/%d/receipts"
+	apiPathPushRecord   = userServiceURL + "/push-receipts"
+)
+
+func (httpUserClient) FindUserDevices(ctx context.Context, userID int) (*PushDevicesResponse, error) {
+	resp, err := httpGet(ctx, fmt.Sprintf(apiPathUserDevices, userID))
+	if err != nil {
+		slog.ErrorContext(ctx, "service error", "code", "347", "error", err)
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		slog.ErrorContext(ctx, "service error", "code", "348", "error", "error fetching devices from user service")
+		return nil, errors.New("error fetching devices from user service")
+	}
+
+	var devices PushDevicesResponse
+	if err := decodeJSON(resp.Body, &devices); err != nil {
+		slog.ErrorContext(ctx, "service error", "code", "349", "error", err)
+		return nil, err
+	}
+
+	return &devices, nil
+}
+
+func (httpUserClient) RegisterUserDevice(ctx context.Context, userID int, deviceByte []byte) (*PushDeviceResponse, error) {
+	resp, err := httpPost(ctx, fmt.Sprintf(apiPathUserDevices, userID), "application/json", bytes.NewBuffer(deviceByte))
+	if err != nil {
+		slog.ErrorContext(ctx, "service error", "code", "350", "error", err)
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusCreated:
+	case http.StatusNotFound:
+		return nil, ErrUserNotFound
+	case http.StatusBadRequest:
+		return nil, ErrPushDeviceInvalid
+	case http.StatusConflict:
+		return nil, ErrPushDeviceLimit
+	default:
+		slog.ErrorContext(ctx, "service error", "code", "351", "error", "error registering device from user service")
+		return nil, errors.New("error registering device from user service")
+	}
+
+	var device PushDeviceResponse
+	if err := decodeJSON(resp.Body, &device); err != nil {
+		slog.ErrorContext(ctx, "service error", "code", "352", "error", err)
+		return nil, err
+	}
+
+	return &device, nil
+}
+
+func (httpUserClient) DeleteUserDevice(ctx context.Context, userID, deviceID int) error {
+	resp, err := httpDelete(ctx, fmt.Sprintf(apiPathUserDevice, userID, deviceID))
+	if err != nil {
+		slog.ErrorContext(ctx, "service error", "code", "353", "error", err)
+		return err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return nil
+	case http.StatusNotFound:
+		return ErrPushDeviceNotFound
+	default:
+		slog.ErrorContext(ctx, "service error", "code", "354", "error", "error deleting device from user service")
+		return errors.New("error deleting device from user service")
+	}
+}
+
+func (httpUserClient) FindPushReceipts(ctx context.Context, userID, deviceID, limit int) (*PushReceiptsResponse, error) {
+	query := url.Values{"limit": {strconv.Itoa(limit)}}
+	resp, err := httpGet(ctx, fmt.Sprintf(apiPathPushReceipts, userID, deviceID)+"?"+query.Encode())
+	if err != nil {
+		slog.ErrorContext(ctx, "service error", "code", "355", "error", err)
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		return nil, ErrPushDeviceNotFound
+	default:
+		slog.ErrorContext(ctx, "service error", "code", "356", "error", "error fetching push receipts from user service")
+		return nil, errors.New("error fetching push receipts from user service")
+	}
+
+	var receipts PushReceiptsResponse
+	if err := decodeJSON(resp.Body, &receipts); err != nil {
+		slog.ErrorContext(ctx, "service error", "code", "357", "error", err)
+		return nil, err
+	}
+
+	return &receipts, nil
+}
+
+func (httpUserClient) RecordPushReceipts(ctx context.Context, receiptsByte []byte) error {
+	resp, err := httpPost(ctx, apiPathPushRecord, "application/json", bytes.NewBuffer(receiptsByte))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("user service answered %d to the push receipts", resp.StatusCode)
+	}
+	return nil
+}
@@ -0,0 +1,570 @@
+package publicapi
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	"apperror"
+
+	"github.com/gin-gonic/gin"
+)
+
+// search of a user whose new listings are sent in the digest, empty filters match every listing
+type SavedSearch struct {
+	ID          int    `json:"id"`
+	UserID      int    `json:"user_id"`
+	Name        string `json:"name"`
+	ListingType string `json:"listing_type,omitempty"`
+	Region      string `json:"region,omitempty"`
+	MinPrice    *int   `json:"min_price"`
+	MaxPrice    *int   `json:"max_price"`
+	CreatedAt   int64  `json:"created_at"`
+}
+
+type SavedSearchCreate struct {
+	Name        string `json:"name" binding:"required,max=100"`
+	ListingType string `json:"listing_type" binding:"omitempty,oneof=rent sale"`
+	Region      string `json:"region" binding:"max=200"`
+	MinPrice    *int   `json:"min_price" binding:"omitempty,gt=0"`
+	MaxPrice    *int   `json:"max_price" binding:"omitempty,gt=0"`
+}
+
+// how often a user gets the digest of the saved searches, never once unsubscribed
+type DigestSettings struct {
+	UserID       int    `json:"user_id"`
+	Frequency    string `json:"frequency"`
+	NextDigestAt *int64 `json:"next_digest_at"`
+	LastDigestAt *int64 `json:"last_digest_at"`
+	UpdatedAt    int64  `json:"updated_at"`
+}
+
+type DigestSettingsUpdate struct {
+	Frequency string `json:"frequency" binding:"required,oneof=daily weekly never"`
+}
+
+// digest of a user claimed from the listing service, the listings of each search were created after Since
+type Digest struct {
+	UserID           int            `json:"user_id"`
+	Frequency        string         `json:"frequency"`
+	Since            int64          `json:"since"`
+	UnsubscribeToken string         `json:"unsubscribe_token"`
+	Searches         []DigestSearch `json:"searches"`
+}
+
+type DigestSearch struct {
+	SavedSearch
+	// newest new listings, at most DIGEST_MAX_LISTINGS of the listing service
+	Listings []ListingCreate `json:"listings"`
+	// count of all new listings of the search
+	Total int `json:"total"`
+}
+
+type SavedSearchResponse struct {
+	Result      bool        `json:"result"`
+	SavedSearch SavedSearch `json:"saved_search"`
+}
+
+type SavedSearchesResponse struct {
+	Result        bool          `json:"result"`
+	SavedSearches []SavedSearch `json:"saved_searches"`
+}
+
+type DigestSettingsResponse struct {
+	Result bool           `json:"result"`
+	Digest DigestSettings `json:"digest"`
+}
+
+type DigestsResponse struct {
+	Result  bool     `json:"result"`
+	Digests []Digest `json:"digests"`
+}
+
+var (
+	errSavedSearchNotFound = apperror.NotFound("Saved search not found")
+	errSavedSearchPrice    = apperror.Validation("min_price must be at most max_price")
+	errUnsubscribeNotFound = apperror.NotFound("Unsubscribe link not found")
+)
+
+// =========== INTERFACE HANDLER, HANDLING REQUEST RESPONSE API DEPEND INTERFACE ===========
+
+// saved searches of the authenticated user, oldest first
+func getSavedSearchesHandler(c *gin.Context) {
+	res, err := getSavedSearchesUsecase(c.Request.Context(), authUserID(c))
+	if err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"saved_searches": res})
+}
+
+func createSavedSearchHandler(c *gin.Context) {
+	var body SavedSearchCreate
+	if err := c.ShouldBindJSON(&body); err != nil {
+		slog.ErrorContext(c.Request.Context(), "handler error", "code", "296", "error", err)
+		apperror.RespondBinding(c, err)
+		return
+	}
+
+	res, err := createSavedSearchUsecase(c.Request.Context(), authUserID(c), body)
+	if err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"saved_search": res})
+}
+
+func deleteSavedSearchHandler(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "handler error", "code", "297", "error", err)
+		apperror.JSON(c, http.StatusBadRequest, "Invalid saved search ID")
+		return
+	}
+
+	if err := deleteSavedSearchUsecase(c.Request.Context(), authUserID(c), id); err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+func getMyDigestHandler(c *gin.Context) {
+	res, err := getDigestSettingsUsecase(c.Request.Context(), authUserID(c))
+	if err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"digest": res})
+}
+
+func updateMyDigestHandler(c *gin.Context) {
+	var body DigestSettingsUpdate
+	if err := c.ShouldBindJSON(&body); err != nil {
+		slog.ErrorContext(c.Request.Context(), "handler error", "code", "298", "error", err)
+		apperror.RespondBinding(c, err)
+		return
+	}
+
+	res, err := updateDigestSettingsUsecase(c.Request.Context(), authUserID(c), body.Frequency)
+	if err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"digest": res})
+}
+
+// unsubscribe link of the digests, no login needed as the token identifies the user. POST is the one-click
+// unsubscribe of mail clients, see the List-Unsubscribe-Post header
+func unsubscribeDigestHandler(c *gin.Context) {
+	res, err := unsubscribeDigestUsecase(c.Request.Context(), c.Query("token"))
+	if err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"digest": res})
+}
+
+// =========== USECASE LAYER, SERVES AS AN INTERMEDIARY BETWEEN THE PRESENTATION LAYER AND THE DATA LAYER ===========
+
+func getSavedSearchesUsecase(ctx context.Context, userID int) ([]SavedSearch, error) {
+	res, err := getSavedSearchesService(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	return res.SavedSearches, nil
+}
+
+func createSavedSearchUsecase(ctx context.Context, userID int, search SavedSearchCreate) (*SavedSearch, error) {
+	if search.MinPrice != nil && search.MaxPrice != nil && *search.MinPrice > *search.MaxPrice {
+		return nil, errSavedSearchPrice
+	}
+
+	form := url.Values{
+		"user_id":      {strconv.Itoa(userID)},
+		"name":         {search.Name},
+		"listing_type": {search.ListingType},
+		"region":       {search.Region},
+	}
+	if search.MinPrice != nil {
+		form.Set("min_price", strconv.Itoa(*search.MinPrice))
+	}
+	if search.MaxPrice != nil {
+		form.Set("max_price", strconv.Itoa(*search.MaxPrice))
+	}
+
+	res, err := createSavedSearchService(ctx, form)
+	if err != nil {
+		return nil, err
+	}
+
+	return &res.SavedSearch, nil
+}
+
+func deleteSavedSearchUsecase(ctx context.Context, userID, searchID int) error {
+	return deleteSavedSearchService(ctx, userID, searchID)
+}
+
+func getDigestSettingsUsecase(ctx context.Context, userID int) (*DigestSettings, error) {
+	res, err := getDigestSettingsService(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &res.Digest, nil
+}
+
+func updateDigestSettingsUsecase(ctx context.Context, userID int, frequency string) (*DigestSettings, error) {
+	res, err := updateDigestSettingsService(ctx, userID, frequency)
+	if err != nil {
+		return nil, err
+	}
+
+	slog.InfoContext(ctx, "digest frequency changed", "user_id", userID, "frequency", frequency)
+	return &res.Digest, nil
+}
+
+func unsubscribeDigestUsecase(ctx context.Context, token string) (*DigestSettings, error) {
+	if token == "" || len(token) > 200 {
+		return nil, errUnsubscribeNotFound
+	}
+
+	res, err := unsubscribeDigestService(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+
+	slog.InfoContext(ctx, "digest unsubscribed", "user_id", res.Digest.UserID)
+	return &res.Digest, nil
+}
+
+// =========== WORKER, SEND THE DIGESTS OF THE SAVED SEARCHES IN BACKGROUND ===========
+
+const notificationListingDigest = "listing_digest"
+
+// DIGEST_INTERVAL wait between the rounds looking for due digests, 0 disables digests
+// DIGEST_BATCH_SIZE digests claimed per call to the listing service
+// DIGEST_UNSUBSCRIBE_URL link in each digest to stop them, {token} is replaced by the token of the user
+// DIGEST_TEMPLATE_PATH text/template file of the digests replacing the built-in one, its first line is the subject
+var (
+	digestInterval       = cfg.Duration("DIGEST_INTERVAL", time.Hour)
+	digestBatchSize      = cfg.Int("DIGEST_BATCH_SIZE", 100)
+	digestUnsubscribeURL = cfg.String("DIGEST_UNSUBSCRIBE_URL", shareLinkBaseURL+"/public-api/digests/unsubscribe?token={token}")
+	digestTemplatePath   = cfg.String("DIGEST_TEMPLATE_PATH", "")
+
+	digestsStop = make(chan struct{})
+	digestsDone = make(chan struct{})
+)
+
+// built-in digest, the first line is the subject and the rest the body
+const defaultDigestTemplate = `{{.NewListings}} new listing{{if ne .NewListings 1}}s{{end}} for your saved searches
+Hi, here is what was listed {{if eq .Frequency "daily"}}today{{else}}this week{{end}} on {{.SiteName}}.
+{{range .Searches}}{{if .Total}}
+{{.Name}}: {{.Total}} new
+{{range .Listings}}- {{listingTitle .}}
+  {{listingURL .}}
+{{end}}{{if gt .Total (len .Listings)}}  and {{sub .Total (len .Listings)}} more
+{{end}}{{end}}{{end}}
+Change how often you get this email in your settings, or unsubscribe: {{.UnsubscribeURL}}
+`
+
+// data of the digest template
+type digestView struct {
+	Digest
+	NewListings    int
+	UnsubscribeURL string
+	SiteName       string
+}
+
+var digestTemplate = template.Must(newDigestTemplate(defaultDigestTemplate))
+
+func newDigestTemplate(text string) (*template.Template, error) {
+	return template.New("digest").Funcs(template.FuncMap{
+		"listingURL": func(listing ListingCreate) string {
+			return absoluteURL(strings.ReplaceAll(listingPageURL, "{id}", strconv.Itoa(listing.ID)), shareLinkBaseURL)
+		},
+		"listingTitle": func(listing ListingCreate) string {
+			return listingPreview(&listing, shareLinkBaseURL).Title
+		},
+		"sub": func(a, b int) int { return a - b },
+	}).Parse(text)
+}
+
+// send the digests due every DIGEST_INTERVAL, the listing service hands each digest out once so several instances
+// never send it twice
+func startDigests() {
+	if digestTemplatePath != "" {
+		text, err := os.ReadFile(digestTemplatePath)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if digestTemplate, err = newDigestTemplate(string(text)); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	if digestInterval <= 0 {
+		close(digestsDone)
+		return
+	}
+
+	go func() {
+		defer close(digestsDone)
+
+		ticker := time.NewTicker(digestInterval)
+		defer ticker.Stop()
+		for {
+			sendDigests()
+
+			select {
+			case <-digestsStop:
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// wait for the running digest round
+func stopDigests(ctx context.Context) {
+	close(digestsStop)
+
+	select {
+	case <-digestsDone:
+	case <-ctx.Done():
+		slog.ErrorContext(ctx, "worker error", "code", "299", "error", "shutdown timeout, digest round still running")
+	}
+}
+
+// claim due digests until a batch comes back short, digests without new listings are skipped
+func sendDigests() {
+	ctx := context.Background()
+
+	for {
+		res, err := claimDigestsService(ctx, digestBatchSize)
+		if err != nil {
+			return
+		}
+
+		for i := range res.Digests {
+			n, err := newDigestNotification(&res.Digests[i])
+			if err != nil {
+				slog.ErrorContext(ctx, "worker error", "code", "300", "error", err, "user_id", res.Digests[i].UserID)
+				continue
+			}
+			if n != nil {
+				notify(ctx, *n)
+			}
+		}
+
+		select {
+		case <-digestsStop:
+			return
+		default:
+		}
+		if len(res.Digests) < digestBatchSize {
+			return
+		}
+	}
+}
+
+// digest rendered with the template, nil when no search has new listings
+func newDigestNotification(digest *Digest) (*Notification, error) {
+	view := digestView{
+		Digest:         *digest,
+		UnsubscribeURL: strings.ReplaceAll(digestUnsubscribeURL, "{token}", url.QueryEscape(digest.UnsubscribeToken)),
+		SiteName:       ogSiteName,
+	}
+	for _, search := range digest.Searches {
+		view.NewListings += search.Total
+	}
+	if view.NewListings == 0 {
+		return nil, nil
+	}
+
+	var text strings.Builder
+	if err := digestTemplate.Execute(&text, view); err != nil {
+		return nil, err
+	}
+	subject, body, _ := strings.Cut(text.String(), "\n")
+
+	return &Notification{
+		Event:          notificationListingDigest,
+		UserID:         digest.UserID,
+		Status:         digest.Frequency,
+		Subject:        strings.TrimSpace(subject),
+		Body:           strings.TrimLeft(body, "\n"),
+		UnsubscribeURL: view.UnsubscribeURL,
+	}, nil
+}
+
+// =========== REPOSITORY LAYER, ABSTRACTION OVER THE DATA PERSISTENCE (databases, file systems, or external APIs) ===========
+
+var (
+	// listing service api path
+	apiPathSavedSearches     = listingServiceURL + "/saved-searches"
+	apiPathSavedSearch       = listingServiceURL + "/saved-searches/%d"
+	apiPathDigest            = listingServiceURL + "/digests/%d"
+	apiPathDigestClaim       = listingServiceURL + "/digests/claim"
+	apiPathDigestUnsubscribe = listingServiceURL + "/digests/unsubscribe"
+)
+
+func getSavedSearchesService(ctx context.Context, userID int) (*SavedSearchesResponse, error) {
+	resp, err := httpGet(ctx, apiPathSavedSearches+"?user_id="+strconv.Itoa(userID))
+	if err != nil {
+		slog.ErrorContext(ctx, "service error", "code", "301", "error", err)
+		return nil, apperror.Upstream("Failed to get saved searches", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		slog.ErrorContext(ctx, "service error", "code", "302", "error", "error fetching saved searches from listing service")
+		return nil, apperror.Upstream("Failed to get saved searches", errors.New("error fetching saved searches from listing service"))
+	}
+
+	var searches SavedSearchesResponse
+	if err := decodeJSON(resp.Body, &searches); err != nil {
+		slog.ErrorContext(ctx, "service error", "code", "303", "error", err)
+		return nil, apperror.Upstream("Failed to get saved searches", err)
+	}
+
+	return &searches, nil
+}
+
+func createSavedSearchService(ctx context.Context, form url.Values) (*SavedSearchResponse, error) {
+	resp, err := httpPostForm(ctx, apiPathSavedSearches, form)
+	if err != nil {
+		slog.ErrorContext(ctx, "service error", "code", "304", "error", err)
+		return nil, apperror.Upstream("Failed to create saved search", err)
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusCreated:
+	case http.StatusBadRequest:
+		return nil, apperror.Validation(upstreamErrorMessage(resp.Body, "Invalid saved search"))
+	case http.StatusConflict:
+		return nil, apperror.Conflict(upstreamErrorMessage(resp.Body, "Saved search limit reached"))
+	default:
+		slog.ErrorContext(ctx, "service error", "code", "305", "error", "error creating saved search from listing service")
+		return nil, apperror.Upstream("Failed to create saved search", errors.New("error creating saved search from listing service"))
+	}
+
+	var search SavedSearchResponse
+	if err := decodeJSON(resp.Body, &search); err != nil {
+		slog.ErrorContext(ctx, "service error", "code", "306", "error", err)
+		return nil, apperror.Upstream("Failed to create saved search", err)
+	}
+
+	return &search, nil
+}
+
+// searches of other users are not found
+func deleteSavedSearchService(ctx context.Context, userID, searchID int) error {
+	resp, err := httpDelete(ctx, fmt.Sprintf(apiPathSavedSearch, searchID)+"?user_id="+strconv.Itoa(userID))
+	if err != nil {
+		slog.ErrorContext(ctx, "service error", "code", "307", "error", err)
+		return apperror.Upstream("Failed to delete saved search", err)
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return nil
+	case http.StatusNotFound:
+		return errSavedSearchNotFound
+	default:
+		slog.ErrorContext(ctx, "service error", "code", "308", "error", "error deleting saved search from listing service")
+		return apperror.Upstream("Failed to delete saved search", errors.New("error deleting saved search from listing service"))
+	}
+}
+
+func getDigestSettingsService(ctx context.Context, userID int) (*DigestSettingsResponse, error) {
+	resp, err := httpGet(ctx, fmt.Sprintf(apiPathDigest, userID))
+	if err != nil {
+		slog.ErrorContext(ctx, "service error", "code", "309", "error", err)
+		return nil, apperror.Upstream("Failed to get digest settings", err)
+	}
+	defer resp.Body.Close()
+
+	return decodeDigestSettings(ctx, resp, "Failed to get digest settings")
+}
+
+func updateDigestSettingsService(ctx context.Context, userID int, frequency string) (*DigestSettingsResponse, error) {
+	resp, err := httpPostForm(ctx, fmt.Sprintf(apiPathDigest, userID), url.Values{"frequency": {frequency}})
+	if err != nil {
+		slog.ErrorContext(ctx, "service error", "code", "310", "error", err)
+		return nil, apperror.Upstream("Failed to update digest settings", err)
+	}
+	defer resp.Body.Close()
+
+	return decodeDigestSettings(ctx, resp, "Failed to update digest settings")
+}
+
+func unsubscribeDigestService(ctx context.Context, token string) (*DigestSettingsResponse, error) {
+	resp, err := httpPostForm(ctx, apiPathDigestUnsubscribe, url.Values{"token": {token}})
+	if err != nil {
+		slog.ErrorContext(ctx, "service error", "code", "311", "error", err)
+		return nil, apperror.Upstream("Failed to unsubscribe", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, errUnsubscribeNotFound
+	}
+	return decodeDigestSettings(ctx, resp, "Failed to unsubscribe")
+}
+
+func decodeDigestSettings(ctx context.Context, resp *http.Response, message string) (*DigestSettingsResponse, error) {
+	if resp.StatusCode != http.StatusOK {
+		slog.ErrorContext(ctx, "service error", "code", "312", "error", fmt.Sprintf("listing service answered %d to a digest call", resp.StatusCode))
+		return nil, apperror.Upstream(message, fmt.Errorf("listing service answered %d", resp.StatusCode))
+	}
+
+	var settings DigestSettingsResponse
+	if err := decodeJSON(resp.Body, &settings); err != nil {
+		slog.ErrorContext(ctx, "service error", "code", "313", "error", err)
+		return nil, apperror.Upstream(message, err)
+	}
+
+	return &settings, nil
+}
+
+// claim up to limit due digests, each is handed out once
+func claimDigestsService(ctx context.Context, limit int) (*DigestsResponse, error) {
+	resp, err := httpPostForm(ctx, apiPathDigestClaim, url.Values{"limit": {strconv.Itoa(limit)}})
+	if err != nil {
+		slog.ErrorContext(ctx, "service error", "code", "314", "error", err)
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		slog.ErrorContext(ctx, "service error", "code", "315", "error", "error claiming digests from listing service")
+		return nil, errors.New("error claiming digests from listing service")
+	}
+
+	var digests DigestsResponse
+	if err := decodeJSON(resp.Body, &digests); err != nil {
+		slog.ErrorContext(ctx, "service error", "code", "316", "error", err)
+		return nil, err
+	}
+
+	return &digests, nil
+}
@@ -0,0 +1,61 @@
+package publicapi
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestDigestNotification(t *testing.T) {
+	previousPage, previousUnsubscribe := listingPageURL, digestUnsubscribeURL
+	listingPageURL, digestUnsubscribeURL = "https://99.co/listings/{id}", "https://99.co/unsubscribe?token={token}"
+	defer func() { listingPageURL, digestUnsubscribeURL = previousPage, previousUnsubscribe }()
+
+	digest := &Digest{
+		UserID:           3,
+		Frequency:        "weekly",
+		UnsubscribeToken: "a+b",
+		Searches: []DigestSearch{
+			{
+				SavedSearch: SavedSearch{Name: "Bishan rentals"},
+				Listings: []ListingCreate{
+					{ID: 7, ListingType: "rent", Price: 3500, Region: "Bishan"},
+					{ID: 9, ListingType: "rent", Price: 4200, Region: "Bishan"},
+				},
+				Total: 5,
+			},
+			{SavedSearch: SavedSearch{Name: "Condos for sale"}},
+		},
+	}
+
+	n, err := newDigestNotification(digest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n.Event != notificationListingDigest || n.UserID != 3 || n.Subject != "5 new listings for your saved searches" {
+		t.Fatalf("notification %+v", n)
+	}
+	if n.UnsubscribeURL != "https://99.co/unsubscribe?token=a%2Bb" {
+		t.Errorf("unsubscribe url %q", n.UnsubscribeURL)
+	}
+	for _, want := range []string{
+		"this week",
+		"Bishan rentals: 5 new",
+		"- For rent: SGD 3,500/month in Bishan\n  https://99.co/listings/7",
+		"and 3 more",
+		n.UnsubscribeURL,
+	} {
+		if !strings.Contains(n.Body, want) {
+			t.Errorf("body misses %q:\n%s", want, n.Body)
+		}
+	}
+	// searches without new listings are left out
+	if strings.Contains(n.Body, "Condos for sale") {
+		t.Errorf("body lists a search without new listings:\n%s", n.Body)
+	}
+
+	// nothing new, nothing sent
+	digest.Searches = digest.Searches[1:]
+	if n, err := newDigestNotification(digest); err != nil || n != nil {
+		t.Errorf("notification %+v, %v for a digest without new listings, want none", n, err)
+	}
+}
@@ -0,0 +1,687 @@
+package publicapi
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"apperror"
+
+	"github.com/gin-gonic/gin"
+)
+
+// outcome of a notification email reported by the email provider, type is delivered, soft_bounce, hard_bounce or
+// complaint. The user service suppresses the address of a user on a hard bounce, a complaint or repeated soft bounces
+type EmailEvent struct {
+	ID         int64  `json:"id"`
+	UserID     int    `json:"user_id"`
+	Type       string `json:"type"`
+	Provider   string `json:"provider"`
+	Address    string `json:"address,omitempty"`
+	MessageID  string `json:"message_id,omitempty"`
+	Detail     string `json:"detail,omitempty"`
+	OccurredAt int64  `json:"occurred_at"`
+	CreatedAt  int64  `json:"created_at"`
+}
+
+// user no longer sent notification emails, reason is hard_bounce, soft_bounce, complaint or manual
+type EmailSuppression struct {
+	UserID    int    `json:"user_id"`
+	Address   string `json:"address,omitempty"`
+	Reason    string `json:"reason"`
+	Detail    string `json:"detail,omitempty"`
+	CreatedAt int64  `json:"created_at"`
+}
+
+// suppression added by an operator, for an address the user asked not to be emailed at
+type EmailSuppressionCreate struct {
+	Address string `json:"address" binding:"max=320"`
+	Detail  string `json:"detail" binding:"max=1000"`
+}
+
+type EmailEventsRecordResponse struct {
+	Result     bool  `json:"result"`
+	Suppressed []int `json:"suppressed"`
+}
+
+type EmailEventsResponse struct {
+	Result bool `json:"result"`
+	Events []EmailEvent
+}
+
+type EmailSuppressionsResponse struct {
+	Result       bool `json:"result"`
+	Suppressions []EmailSuppression
+}
+
+type EmailSuppressionResponse struct {
+	Result      bool `json:"result"`
+	Suppression EmailSuppression
+}
+
+var (
+	ErrEmailSuppressionNotFound = apperror.NotFound("Email suppression not found")
+
+	errEmailEventsLimit       = apperror.Validation("limit must be between 1 and 200")
+	errEmailSuppressionReason = apperror.Validation("reason must be one of hard_bounce, soft_bounce, complaint, manual")
+	errEmailProviderNotFound  = apperror.NotFound("Email provider not found")
+	errEmailWebhookInvalid    = apperror.Validation("Invalid email webhook payload")
+	errEmailWebhookSignature  = errors.New("email webhook signature invalid")
+)
+
+// =========== INTERFACE HANDLER, HANDLING REQUEST RESPONSE API DEPEND INTERFACE ===========
+
+// delivery events posted by the email provider of :provider, authenticated by the signature of the provider
+func receiveEmailEventsHandler(c *gin.Context) {
+	provider, ok := emailProviders[c.Param("provider")]
+	if !ok {
+		apperror.Respond(c, errEmailProviderNotFound)
+		return
+	}
+
+	// EMAIL_WEBHOOK_MAX_BODY max size of a webhook payload in bytes
+	body, err := io.ReadAll(http.MaxBytesReader(c.Writer, c.Request.Body, int64(cfg.Int("EMAIL_WEBHOOK_MAX_BODY", 1<<20))))
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "handler error", "code", "417", "error", err)
+		apperror.Respond(c, errEmailWebhookInvalid)
+		return
+	}
+
+	emailEvents, err := provider.Parse(c.Request.Header, body)
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "handler error", "code", "418", "error", err, "provider", c.Param("provider"))
+		if errors.Is(err, errEmailWebhookSignature) {
+			apperror.JSON(c, http.StatusUnauthorized, "Invalid signature")
+			return
+		}
+		apperror.Respond(c, errEmailWebhookInvalid)
+		return
+	}
+
+	suppressed, err := recordEmailEventsUsecase(c.Request.Context(), c.Param("provider"), emailEvents)
+	if err != nil {
+		// the provider retries a webhook it could not deliver
+		apperror.Respond(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"received": len(emailEvents), "suppressed": suppressed})
+}
+
+// latest delivery events of the emails of a user
+func getUserEmailEventsHandler(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "handler error", "code", "419", "error", err)
+		apperror.JSON(c, http.StatusBadRequest, "Invalid user ID")
+		return
+	}
+
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "50"))
+	if err != nil {
+		apperror.Respond(c, errEmailEventsLimit)
+		return
+	}
+
+	res, err := getUserEmailEventsUsecase(c.Request.Context(), id, limit)
+	if err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"events": res})
+}
+
+// suppression list newest first, ?reason= keeps the suppressions of one reason
+func getEmailSuppressionsHandler(c *gin.Context) {
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "50"))
+	if err != nil {
+		apperror.Respond(c, errEmailEventsLimit)
+		return
+	}
+
+	res, err := getEmailSuppressionsUsecase(c.Request.Context(), c.Query("reason"), limit)
+	if err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"suppressions": res})
+}
+
+func getUserEmailSuppressionHandler(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "handler error", "code", "420", "error", err)
+		apperror.JSON(c, http.StatusBadRequest, "Invalid user ID")
+		return
+	}
+
+	res, err := getUserEmailSuppressionUsecase(c.Request.Context(), id)
+	if err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"suppression": res})
+}
+
+// stop emailing a user by hand, replacing the suppression the user has
+func suppressUserEmailHandler(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "handler error", "code", "421", "error", err)
+		apperror.JSON(c, http.StatusBadRequest, "Invalid user ID")
+		return
+	}
+
+	var body EmailSuppressionCreate
+	if err := c.ShouldBindJSON(&body); err != nil {
+		slog.ErrorContext(c.Request.Context(), "handler error", "code", "422", "error", err)
+		apperror.RespondBinding(c, err)
+		return
+	}
+
+	res, err := suppressUserEmailUsecase(c.Request.Context(), id, body)
+	if err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"suppression": res})
+}
+
+// email a user again, once the address was fixed or the complaint withdrawn
+func unsuppressUserEmailHandler(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "handler error", "code", "423", "error", err)
+		apperror.JSON(c, http.StatusBadRequest, "Invalid user ID")
+		return
+	}
+
+	if err := unsuppressUserEmailUsecase(c.Request.Context(), id); err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// =========== USECASE LAYER, SERVES AS AN INTERMEDIARY BETWEEN THE PRESENTATION LAYER AND THE DATA LAYER ===========
+
+// send the events of a webhook to the user service, returns the users suppressed by them
+func recordEmailEventsUsecase(ctx context.Context, provider string, emailEvents []EmailEvent) ([]int, error) {
+	for _, event := range emailEvents {
+		emailEventsTotal.WithLabelValues(provider, event.Type).Inc()
+	}
+	if len(emailEvents) == 0 {
+		return []int{}, nil
+	}
+
+	eventsJSON, err := json.Marshal(map[string][]EmailEvent{"events": emailEvents})
+	if err != nil {
+		slog.ErrorContext(ctx, "usecase error", "code", "424", "error", err)
+		return nil, err
+	}
+
+	res, err := userClient.RecordEmailEvents(ctx, eventsJSON)
+	if err != nil {
+		return nil, apperror.Upstream("Failed to record email events", err)
+	}
+
+	return res.Suppressed, nil
+}
+
+func getUserEmailEventsUsecase(ctx context.Context, userID, limit int) ([]EmailEvent, error) {
+	if limit < 1 || limit > 200 {
+		return nil, errEmailEventsLimit
+	}
+
+	res, err := userClient.FindUserEmailEvents(ctx, userID, limit)
+	if err != nil {
+		return nil, apperror.Upstream("Failed to get email events", err)
+	}
+
+	return res.Events, nil
+}
+
+func getEmailSuppressionsUsecase(ctx context.Context, reason string, limit int) ([]EmailSuppression, error) {
+	if limit < 1 || limit > 200 {
+		return nil, errEmailEventsLimit
+	}
+	switch reason {
+	case "", "hard_bounce", "soft_bounce", "complaint", "manual":
+	default:
+		return nil, errEmailSuppressionReason
+	}
+
+	res, err := userClient.FindEmailSuppressions(ctx, reason, limit)
+	if err != nil {
+		return nil, apperror.Upstream("Failed to get email suppressions", err)
+	}
+
+	return res.Suppressions, nil
+}
+
+func getUserEmailSuppressionUsecase(ctx context.Context, userID int) (*EmailSuppression, error) {
+	res, err := userClient.FindUserEmailSuppression(ctx, userID)
+	if err != nil {
+		if errors.Is(err, ErrEmailSuppressionNotFound) {
+			return nil, err
+		}
+		return nil, apperror.Upstream("Failed to get email suppression", err)
+	}
+
+	return &res.Suppression, nil
+}
+
+func suppressUserEmailUsecase(ctx context.Context, userID int, body EmailSuppressionCreate) (*EmailSuppression, error) {
+	suppressionJSON, err := json.Marshal(body)
+	if err != nil {
+		slog.ErrorContext(ctx, "usecase error", "code", "424", "error", err)
+		return nil, err
+	}
+
+	res, err := userClient.SuppressUserEmail(ctx, userID, suppressionJSON)
+	if err != nil {
+		if errors.Is(err, ErrUserNotFound) {
+			return nil, err
+		}
+		return nil, apperror.Upstream("Failed to suppress email", err)
+	}
+
+	return &res.Suppression, nil
+}
+
+func unsuppressUserEmailUsecase(ctx context.Context, userID int) error {
+	if err := userClient.UnsuppressUserEmail(ctx, userID); err != nil {
+		if errors.Is(err, ErrEmailSuppressionNotFound) {
+			return err
+		}
+		return apperror.Upstream("Failed to remove email suppression", err)
+	}
+
+	return nil
+}
+
+// =========== REPOSITORY LAYER, DELIVERY EVENTS OF THE EMAIL PROVIDERS ===========
+
+// emailProvider read the delivery events of a webhook call of its provider, the error wraps errEmailWebhookSignature
+// when the call is not signed by the provider. Events of emails not tagged with a user_id are left out, the receiver of
+// NOTIFICATION_WEBHOOK_URL tags each email it sends with the user_id of its notification
+type emailProvider interface {
+	Parse(header http.Header, body []byte) ([]EmailEvent, error)
+}
+
+// provider name of the webhook path to provider of the configured providers, set by Run
+var emailProviders = map[string]emailProvider{}
+
+// providers configured, exit on a key that can not be loaded
+func newEmailProviders() map[string]emailProvider {
+	providers := map[string]emailProvider{}
+
+	// EMAIL_SENDGRID_WEBHOOK_PUBLIC_KEY verification key of the signed event webhook of sendgrid, empty disables it
+	if key := cfg.String("EMAIL_SENDGRID_WEBHOOK_PUBLIC_KEY", ""); key != "" {
+		provider, err := newSendGridProvider(key)
+		if err != nil {
+			log.Fatalf("EMAIL_SENDGRID_WEBHOOK_PUBLIC_KEY: %v", err)
+		}
+		providers["sendgrid"] = provider
+	}
+
+	// EMAIL_MAILGUN_WEBHOOK_SIGNING_KEY http webhook signing key of the mailgun account, empty disables it
+	if key := cfg.String("EMAIL_MAILGUN_WEBHOOK_SIGNING_KEY", ""); key != "" {
+		providers["mailgun"] = mailgunProvider{signingKey: []byte(key)}
+	}
+
+	for name := range providers {
+		slog.Info("email provider webhook enabled", "provider", name)
+	}
+	return providers
+}
+
+// event webhook of sendgrid, signed with ecdsa over the timestamp header followed by the body
+type sendGridProvider struct {
+	publicKey *ecdsa.PublicKey
+}
+
+func newSendGridProvider(key string) (*sendGridProvider, error) {
+	der, err := base64.StdEncoding.DecodeString(key)
+	if err != nil {
+		return nil, err
+	}
+	parsed, err := x509.ParsePKIXPublicKey(der)
+	if err != nil {
+		return nil, err
+	}
+	publicKey, ok := parsed.(*ecdsa.PublicKey)
+	if !ok {
+		return nil, errors.New("not an ecdsa public key")
+	}
+	return &sendGridProvider{publicKey: publicKey}, nil
+}
+
+// event of the sendgrid webhook, custom args of the email like user_id are fields of the event
+type sendGridEvent struct {
+	Email     string          `json:"email"`
+	Timestamp int64           `json:"timestamp"`
+	Event     string          `json:"event"`
+	Type      string          `json:"type"`
+	Reason    string          `json:"reason"`
+	MessageID string          `json:"sg_message_id"`
+	UserID    json.RawMessage `json:"user_id"`
+}
+
+func (p *sendGridProvider) Parse(header http.Header, body []byte) ([]EmailEvent, error) {
+	signature, err := base64.StdEncoding.DecodeString(header.Get("X-Twilio-Email-Event-Webhook-Signature"))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", errEmailWebhookSignature, err)
+	}
+	digest := sha256.Sum256(append([]byte(header.Get("X-Twilio-Email-Event-Webhook-Timestamp")), body...))
+	if !ecdsa.VerifyASN1(p.publicKey, digest[:], signature) {
+		return nil, errEmailWebhookSignature
+	}
+
+	var payload []sendGridEvent
+	if err := json.Unmarshal(body, &payload); err != nil {
+		return nil, err
+	}
+
+	var emailEvents []EmailEvent
+	for _, event := range payload {
+		var eventType string
+		switch {
+		case event.Event == "delivered":
+			eventType = "delivered"
+		// blocked is a bounce of the receiving server refusing the email for now
+		case event.Event == "bounce" && event.Type == "blocked":
+			eventType = "soft_bounce"
+		case event.Event == "bounce":
+			eventType = "hard_bounce"
+		case event.Event == "spamreport":
+			eventType = "complaint"
+		default:
+			// processed, deferred, opens and clicks say nothing about the address
+			continue
+		}
+
+		userID, err := strconv.Atoi(strings.Trim(string(event.UserID), `"`))
+		if err != nil || userID <= 0 {
+			continue
+		}
+		emailEvents = append(emailEvents, EmailEvent{
+			UserID:     userID,
+			Type:       eventType,
+			Provider:   "sendgrid",
+			Address:    event.Email,
+			MessageID:  event.MessageID,
+			Detail:     emailEventDetail(event.Reason),
+			OccurredAt: event.Timestamp * 1e6,
+		})
+	}
+	return emailEvents, nil
+}
+
+// webhooks of mailgun, one event per call signed with hmac over the timestamp and token of its signature
+type mailgunProvider struct {
+	signingKey []byte
+}
+
+type mailgunPayload struct {
+	Signature struct {
+		Timestamp string `json:"timestamp"`
+		Token     string `json:"token"`
+		Signature string `json:"signature"`
+	} `json:"signature"`
+	EventData struct {
+		Event     string  `json:"event"`
+		Severity  string  `json:"severity"`
+		Recipient string  `json:"recipient"`
+		Timestamp float64 `json:"timestamp"`
+		Reason    string  `json:"reason"`
+		Message   struct {
+			Headers struct {
+				MessageID string `json:"message-id"`
+			} `json:"headers"`
+		} `json:"message"`
+		DeliveryStatus struct {
+			Description string `json:"description"`
+			Message     string `json:"message"`
+		} `json:"delivery-status"`
+		UserVariables map[string]any `json:"user-variables"`
+	} `json:"event-data"`
+}
+
+func (p mailgunProvider) Parse(header http.Header, body []byte) ([]EmailEvent, error) {
+	var payload mailgunPayload
+	if err := json.Unmarshal(body, &payload); err != nil {
+		return nil, err
+	}
+
+	signature, err := hex.DecodeString(payload.Signature.Signature)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", errEmailWebhookSignature, err)
+	}
+	if !hmac.Equal(hmacSHA256(p.signingKey, payload.Signature.Timestamp+payload.Signature.Token), signature) {
+		return nil, errEmailWebhookSignature
+	}
+
+	event := payload.EventData
+	var eventType string
+	switch {
+	case event.Event == "delivered":
+		eventType = "delivered"
+	case event.Event == "failed" && event.Severity == "temporary":
+		eventType = "soft_bounce"
+	case event.Event == "failed":
+		eventType = "hard_bounce"
+	case event.Event == "complained":
+		eventType = "complaint"
+	default:
+		return nil, nil
+	}
+
+	userID, err := strconv.Atoi(fmt.Sprint(event.UserVariables["user_id"]))
+	if err != nil || userID <= 0 {
+		return nil, nil
+	}
+
+	detail := event.DeliveryStatus.Description
+	if detail == "" {
+		detail = event.DeliveryStatus.Message
+	}
+	if detail == "" {
+		detail = event.Reason
+	}
+	return []EmailEvent{{
+		UserID:     userID,
+		Type:       eventType,
+		Provider:   "mailgun",
+		Address:    event.Recipient,
+		MessageID:  event.Message.Headers.MessageID,
+		Detail:     emailEventDetail(detail),
+		OccurredAt: int64(event.Timestamp * 1e6),
+	}}, nil
+}
+
+// detail cut to the 1000 characters the user service keeps
+func emailEventDetail(detail string) string {
+	if runes := []rune(detail); len(runes) > 1000 {
+		return string(runes[:1000])
+	}
+	return detail
+}
+
+// =========== REPOSITORY LAYER, ABSTRACTION OVER THE DATA PERSISTENCE (databases, file systems, or external APIs) ===========
+
+var (
+	// user service api path
+	apiPathEmailEvents          = userServiceURL + "/email-events"
+	apiPathUserEmailEvents      = userServiceURL + "/users/%d/email-events?limit=%d"
+	apiPathEmailSuppressions    = userServiceURL + "/email-suppressions"
+	apiPathUserEmailSuppression = userServiceURL + "/users/%d/email-suppression"
+)
+
+func (httpUserClient) RecordEmailEvents(ctx context.Context, eventsByte []byte) (*EmailEventsRecordResponse, error) {
+	resp, err := httpPost(ctx, apiPathEmailEvents, "application/json", bytes.NewBuffer(eventsByte))
+	if err != nil {
+		slog.ErrorContext(ctx, "service error", "code", "425", "error", err)
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		slog.ErrorContext(ctx, "service error", "code", "426", "error", "error recording email events from user service")
+		return nil, errors.New("error recording email events from user service")
+	}
+
+	var recorded EmailEventsRecordResponse
+	if err := decodeJSON(resp.Body, &recorded); err != nil {
+		slog.ErrorContext(ctx, "service error", "code", "426", "error", err)
+		return nil, err
+	}
+
+	return &recorded, nil
+}
+
+func (httpUserClient) FindUserEmailEvents(ctx context.Context, userID, limit int) (*EmailEventsResponse, error) {
+	resp, err := httpGet(ctx, fmt.Sprintf(apiPathUserEmailEvents, userID, limit))
+	if err != nil {
+		slog.ErrorContext(ctx, "service error", "code", "427", "error", err)
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		slog.ErrorContext(ctx, "service error", "code", "428", "error", "error fetching email events from user service")
+		return nil, errors.New("error fetching email events from user service")
+	}
+
+	var emailEvents EmailEventsResponse
+	if err := decodeJSON(resp.Body, &emailEvents); err != nil {
+		slog.ErrorContext(ctx, "service error", "code", "428", "error", err)
+		return nil, err
+	}
+
+	return &emailEvents, nil
+}
+
+func (httpUserClient) FindEmailSuppressions(ctx context.Context, reason string, limit int) (*EmailSuppressionsResponse, error) {
+	query := url.Values{"limit": {strconv.Itoa(limit)}}
+	if reason != "" {
+		query.Set("reason", reason)
+	}
+	resp, err := httpGet(ctx, apiPathEmailSuppressions+"?"+query.Encode())
+	if err != nil {
+		slog.ErrorContext(ctx, "service error", "code", "429", "error", err)
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		slog.ErrorContext(ctx, "service error", "code", "430", "error", "error fetching email suppressions from user service")
+		return nil, errors.New("error fetching email suppressions from user service")
+	}
+
+	var suppressions EmailSuppressionsResponse
+	if err := decodeJSON(resp.Body, &suppressions); err != nil {
+		slog.ErrorContext(ctx, "service error", "code", "430", "error", err)
+		return nil, err
+	}
+
+	return &suppressions, nil
+}
+
+func (httpUserClient) FindUserEmailSuppression(ctx context.Context, userID int) (*EmailSuppressionResponse, error) {
+	resp, err := httpGet(ctx, fmt.Sprintf(apiPathUserEmailSuppression, userID))
+	if err != nil {
+		slog.ErrorContext(ctx, "service error", "code", "431", "error", err)
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		return nil, ErrEmailSuppressionNotFound
+	default:
+		slog.ErrorContext(ctx, "service error", "code", "432", "error", "error fetching email suppression from user service")
+		return nil, errors.New("error fetching email suppression from user service")
+	}
+
+	var suppression EmailSuppressionResponse
+	if err := decodeJSON(resp.Body, &suppression); err != nil {
+		slog.ErrorContext(ctx, "service error", "code", "432", "error", err)
+		return nil, err
+	}
+
+	return &suppression, nil
+}
+
+func (httpUserClient) SuppressUserEmail(ctx context.Context, userID int, suppressionByte []byte) (*EmailSuppressionResponse, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, fmt.Sprintf(apiPathUserEmailSuppression, userID), bytes.NewBuffer(suppressionByte))
+	if err != nil {
+		slog.ErrorContext(ctx, "service error", "code", "433", "error", err)
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		slog.ErrorContext(ctx, "service error", "code", "433", "error", err)
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		return nil, ErrUserNotFound
+	default:
+		slog.ErrorContext(ctx, "service error", "code", "434", "error", "error suppressing email from user service")
+		return nil, errors.New("error suppressing email from user service")
+	}
+
+	var suppression EmailSuppressionResponse
+	if err := decodeJSON(resp.Body, &suppression); err != nil {
+		slog.ErrorContext(ctx, "service error", "code", "434", "error", err)
+		return nil, err
+	}
+
+	return &suppression, nil
+}
+
+func (httpUserClient) UnsuppressUserEmail(ctx context.Context, userID int) error {
+	resp, err := httpDelete(ctx, fmt.Sprintf(apiPathUserEmailSuppression, userID))
+	if err != nil {
+		slog.ErrorContext(ctx, "service error", "code", "435", "error", err)
+		return err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return nil
+	case http.StatusNotFound:
+		return ErrEmailSuppressionNotFound
+	default:
+		slog.ErrorContext(ctx, "service error", "code", "436", "error", "error removing email suppression from user service")
+		return errors.New("error removing email suppression from user service")
+	}
+}
@@ -0,0 +1,130 @@
+package publicapi
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+func TestSendGridProvider(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	provider, err := newSendGridProvider(base64.StdEncoding.EncodeToString(der))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	body := []byte(`[
+		{"email": "a@example.com", "timestamp": 1700000000, "event": "delivered", "sg_message_id": "m1", "user_id": "1"},
+		{"email": "b@example.com", "timestamp": 1700000001, "event": "bounce", "type": "bounce", "reason": "550 no such user", "user_id": "2"},
+		{"email": "c@example.com", "timestamp": 1700000002, "event": "bounce", "type": "blocked", "user_id": 3},
+		{"email": "d@example.com", "timestamp": 1700000003, "event": "spamreport", "user_id": "4"},
+		{"email": "e@example.com", "timestamp": 1700000004, "event": "open", "user_id": "5"},
+		{"email": "f@example.com", "timestamp": 1700000005, "event": "bounce", "type": "bounce"}
+	]`)
+	header := http.Header{"X-Twilio-Email-Event-Webhook-Timestamp": {"1700000010"}}
+	digest := sha256.Sum256(append([]byte("1700000010"), body...))
+	signature, err := ecdsa.SignASN1(rand.Reader, key, digest[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	header.Set("X-Twilio-Email-Event-Webhook-Signature", base64.StdEncoding.EncodeToString(signature))
+
+	got, err := provider.Parse(header, body)
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	want := []EmailEvent{
+		{UserID: 1, Type: "delivered", Provider: "sendgrid", Address: "a@example.com", MessageID: "m1", OccurredAt: 1700000000e6},
+		{UserID: 2, Type: "hard_bounce", Provider: "sendgrid", Address: "b@example.com", Detail: "550 no such user", OccurredAt: 1700000001e6},
+		{UserID: 3, Type: "soft_bounce", Provider: "sendgrid", Address: "c@example.com", OccurredAt: 1700000002e6},
+		{UserID: 4, Type: "complaint", Provider: "sendgrid", Address: "d@example.com", OccurredAt: 1700000003e6},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("events %+v\nwant %+v, opens and emails without a user left out", got, want)
+	}
+
+	header.Set("X-Twilio-Email-Event-Webhook-Timestamp", "1700000011")
+	if _, err := provider.Parse(header, body); !errors.Is(err, errEmailWebhookSignature) {
+		t.Errorf("parse with another timestamp: %v, want errEmailWebhookSignature", err)
+	}
+}
+
+func TestMailgunProvider(t *testing.T) {
+	provider := mailgunProvider{signingKey: []byte("key")}
+	sign := func(event string) []byte {
+		mac := hmac.New(sha256.New, []byte("key"))
+		mac.Write([]byte("1700000010token"))
+		return []byte(`{"signature": {"timestamp": "1700000010", "token": "token", "signature": "` + hex.EncodeToString(mac.Sum(nil)) + `"},
+			"event-data": ` + event + `}`)
+	}
+
+	got, err := provider.Parse(nil, sign(`{"event": "failed", "severity": "temporary", "recipient": "a@example.com", "timestamp": 1700000000.5,
+		"message": {"headers": {"message-id": "m1"}}, "delivery-status": {"description": "mailbox full"}, "user-variables": {"user_id": "7"}}`))
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	want := []EmailEvent{{UserID: 7, Type: "soft_bounce", Provider: "mailgun", Address: "a@example.com", MessageID: "m1", Detail: "mailbox full", OccurredAt: 1700000000500000}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("events %+v, want %+v", got, want)
+	}
+
+	if got, err := provider.Parse(nil, sign(`{"event": "opened", "user-variables": {"user_id": "7"}}`)); err != nil || len(got) != 0 {
+		t.Errorf("parse of an open: %+v, %v, want no event", got, err)
+	}
+
+	forged := []byte(`{"signature": {"timestamp": "1700000010", "token": "token", "signature": "00"}, "event-data": {"event": "complained"}}`)
+	if _, err := provider.Parse(nil, forged); !errors.Is(err, errEmailWebhookSignature) {
+		t.Errorf("parse of a forged call: %v, want errEmailWebhookSignature", err)
+	}
+}
+
+// user client answering users of suppressed with their email suppressed
+type suppressedUserClient struct {
+	preferencesUserClient
+	suppressed map[int]bool
+}
+
+func (c suppressedUserClient) FindNotificationPreferences(ctx context.Context, userID int) (*NotificationPreferencesResponse, error) {
+	res, err := c.preferencesUserClient.FindNotificationPreferences(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	res.Preferences.EmailSuppressed = c.suppressed[userID]
+	return res, nil
+}
+
+func TestNotifyEmailSuppressed(t *testing.T) {
+	notifications := newNotificationRecorder(t)
+	userClient = suppressedUserClient{
+		preferencesUserClient: preferencesUserClient{preferences: map[int]map[string]map[string]bool{
+			2: {notificationOfferReceived: {"email": true, "push": false, "in_app": false}},
+		}},
+		suppressed: map[int]bool{1: true, 2: true},
+	}
+
+	for _, userID := range []int{1, 2} {
+		notify(context.Background(), Notification{Event: notificationOfferReceived, UserID: userID, ListingID: 5})
+	}
+
+	got := notifications()
+	if len(got) != 1 || got[0].UserID != 1 || !reflect.DeepEqual(got[0].Channels, []string{"push"}) {
+		t.Fatalf("notified %+v, want user 1 by push only, user 2 had only email left", got)
+	}
+}
@@ -0,0 +1,102 @@
+package publicapi
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"sync"
+)
+
+// =========== USECASE LAYER, CONCURRENT USER ENRICHMENT OF LISTINGS ===========
+
+var (
+	// USER_FETCH_BATCH_SIZE ids per batch call, user service accept max 100
+	userFetchBatchSize = cfg.Int("USER_FETCH_BATCH_SIZE", 100)
+	// USER_FETCH_CONCURRENCY max batch calls in flight at the same time
+	userFetchConcurrency = cfg.Int("USER_FETCH_CONCURRENCY", 4)
+)
+
+// fetch users by ids in batches on a bounded worker pool, the first failed batch cancel the rest
+func fetchUsersByIDs(ctx context.Context, userIDs []int) (map[int]User, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	batchSize := userFetchBatchSize
+	if batchSize < 1 || batchSize > 100 {
+		batchSize = 100
+	}
+
+	var batches [][]int
+	for start := 0; start < len(userIDs); start += batchSize {
+		end := start + batchSize
+		if end > len(userIDs) {
+			end = len(userIDs)
+		}
+		batches = append(batches, userIDs[start:end])
+	}
+
+	workers := userFetchConcurrency
+	if workers < 1 {
+		workers = 1
+	}
+	if workers > len(batches) {
+		workers = len(batches)
+	}
+
+	var (
+		mu       sync.Mutex
+		wg       sync.WaitGroup
+		firstErr error
+		users    = make(map[int]User, len(userIDs))
+		queue    = make(chan []int)
+	)
+
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for batch := range queue {
+				res, err := findUsersByIDsService(ctx, batch)
+				if err == nil && !res.Result {
+					slog.ErrorContext(ctx, "usecase error", "code", "047", "error", "api result failed: failed to get users")
+					err = errors.New("api result failed: failed to get users")
+				}
+
+				mu.Lock()
+				if err != nil {
+					if firstErr == nil {
+						firstErr = err
+						cancel()
+					}
+				} else {
+					for _, user := range res.Users {
+						users[user.ID] = user
+					}
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+
+	// stop queueing batches once a worker failed
+feed:
+	for _, batch := range batches {
+		select {
+		case queue <- batch:
+		case <-ctx.Done():
+			break feed
+		}
+	}
+	close(queue)
+	wg.Wait()
+
+	if firstErr != nil {
+		return nil, firstErr
+	}
+
+	if err := ctx.Err(); err != nil && !errors.Is(err, context.Canceled) {
+		return nil, err
+	}
+
+	return users, nil
+}
@@ -0,0 +1,219 @@
+package publicapi
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"events"
+
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+)
+
+// =========== REPOSITORY LAYER, RELAY OF THE LISTING SERVICE OUTBOX TO THE MESSAGE BROKER ===========
+
+// the listing service writes the events of listing writes to its outbox, python has no broker client so the public
+// API publishes them. The user service relays its own outbox
+var listingOutboxRelay *events.Relay
+
+// relay the listing outbox to EVENT_PUBLISHER and the webhooks, see events.NewRelay for its OUTBOX_ settings
+func startListingOutboxRelay() {
+	publisher, err := events.NewPublisher(cfg, cfg.String("OTEL_SERVICE_NAME", "public-api"), otelhttp.NewTransport(http.DefaultTransport))
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	listingOutboxRelay = events.NewRelay(cfg, "OUTBOX", listingOutbox{}, events.Fanout(publisher, webhookEventPublisher{}))
+	listingOutboxRelay.Observe = func(eventType, result string) {
+		eventsPublished.WithLabelValues(eventType, result).Inc()
+	}
+	// an event not matching its schema is kept as dead letter instead of breaking consumers
+	listingOutboxRelay.Validate = true
+	listingOutboxRelay.Start()
+}
+
+// wait for the running relay round then close the publisher
+func stopListingOutboxRelay(ctx context.Context) {
+	listingOutboxRelay.Stop(ctx)
+}
+
+var (
+	// listing service api path
+	apiPathOutbox      = listingServiceURL + "/outbox"
+	apiPathOutboxClaim = listingServiceURL + "/outbox/claim"
+	apiPathOutboxEvent = listingServiceURL + "/outbox/%d"
+)
+
+// outbox event as the listing service returns it
+type OutboxEvent struct {
+	ID       int64        `json:"id"`
+	Attempts int          `json:"attempts"`
+	EventKey string       `json:"event_key"`
+	Event    events.Event `json:"event"`
+}
+
+type OutboxEventsResponse struct {
+	Result bool          `json:"result"`
+	Events []OutboxEvent `json:"events"`
+}
+
+// records of outboxEvents with the key sent next to the event
+func outboxRecords(outboxEvents []OutboxEvent) []events.Record {
+	records := make([]events.Record, len(outboxEvents))
+	for i, e := range outboxEvents {
+		e.Event.Key = e.EventKey
+		records[i] = events.Record{ID: e.ID, Attempts: e.Attempts, Event: e.Event}
+	}
+	return records
+}
+
+// query of a page of the delivered events of an outbox, the same for the listing and the user service
+func outboxEventsQuery(filter events.ReplayFilter, afterID int64, limit int) url.Values {
+	query := url.Values{
+		"occurred_from": {strconv.FormatInt(filter.From, 10)},
+		"occurred_to":   {strconv.FormatInt(filter.To, 10)},
+		"after_id":      {strconv.FormatInt(afterID, 10)},
+		"limit":         {strconv.Itoa(limit)},
+	}
+	if len(filter.Types) > 0 {
+		query.Set("types", strings.Join(filter.Types, ","))
+	}
+	return query
+}
+
+// events.Outbox and events.History over the outbox endpoints of the listing service
+type listingOutbox struct{}
+
+func (listingOutbox) Claim(ctx context.Context, limit int, lease time.Duration) ([]events.Record, error) {
+	form := url.Values{
+		"limit":    {strconv.Itoa(limit)},
+		"lease_ms": {strconv.FormatInt(lease.Milliseconds(), 10)},
+	}
+	resp, err := httpPostForm(ctx, apiPathOutboxClaim, form)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("listing service answered %d to the outbox claim", resp.StatusCode)
+	}
+
+	var res OutboxEventsResponse
+	if err := decodeJSON(resp.Body, &res); err != nil {
+		return nil, err
+	}
+
+	return outboxRecords(res.Events), nil
+}
+
+func (o listingOutbox) Delivered(ctx context.Context, id int64) error {
+	return o.update(ctx, id, url.Values{"status": {"delivered"}})
+}
+
+func (o listingOutbox) Retry(ctx context.Context, id int64, attempts int, next time.Time, lastErr string) error {
+	return o.update(ctx, id, url.Values{
+		"status":          {"pending"},
+		"attempts":        {strconv.Itoa(attempts)},
+		"next_attempt_at": {strconv.FormatInt(next.UnixMicro(), 10)},
+		"error":           {lastErr},
+	})
+}
+
+// the event stays dead in the listing outbox, the user service keeps its dead letter for the admins
+func (o listingOutbox) Dead(ctx context.Context, record events.Record, attempts int, lastErr string) error {
+	err := o.update(ctx, record.ID, url.Values{
+		"status":   {"dead"},
+		"attempts": {strconv.Itoa(attempts)},
+		"error":    {lastErr},
+	})
+	if err != nil {
+		return err
+	}
+
+	letterJSON, err := json.Marshal(DeadLetterCreate{
+		Source:    deadLetterListingEvents,
+		SourceID:  record.ID,
+		EventKey:  record.Event.Key,
+		Event:     record.Event,
+		Attempts:  attempts,
+		LastError: lastErr,
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = userClient.CreateDeadLetter(ctx, letterJSON)
+	return err
+}
+
+var errOutboxEventNotFound = errors.New("event not in the listing outbox")
+
+func (listingOutbox) update(ctx context.Context, id int64, form url.Values) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, fmt.Sprintf(apiPathOutboxEvent, id), strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return nil
+	case http.StatusNotFound:
+		return fmt.Errorf("%w: %d", errOutboxEventNotFound, id)
+	default:
+		return fmt.Errorf("listing service answered %d to the outbox update of %d", resp.StatusCode, id)
+	}
+}
+
+func (listingOutbox) Purge(ctx context.Context, deliveredBefore time.Time) (int, error) {
+	resp, err := httpDelete(ctx, apiPathOutbox+"?delivered_before="+strconv.FormatInt(deliveredBefore.UnixMicro(), 10))
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return 0, errors.New("error purging the outbox of the listing service")
+	}
+
+	var res struct {
+		Deleted int `json:"deleted"`
+	}
+	if err := decodeJSON(resp.Body, &res); err != nil {
+		return 0, err
+	}
+	return res.Deleted, nil
+}
+
+func (listingOutbox) Events(ctx context.Context, filter events.ReplayFilter, afterID int64, limit int) ([]events.Record, error) {
+	resp, err := httpGet(ctx, apiPathOutbox+"?"+outboxEventsQuery(filter, afterID, limit).Encode())
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("listing service answered %d to the outbox events", resp.StatusCode)
+	}
+
+	var res OutboxEventsResponse
+	if err := decodeJSON(resp.Body, &res); err != nil {
+		return nil, err
+	}
+
+	return outboxRecords(res.Events), nil
+}
@@ -0,0 +1,93 @@
+package publicapi
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestListingOutbox(t *testing.T) {
+	var updates []url.Values
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == http.MethodPost && r.URL.Path == "/outbox/claim":
+			if r.PostFormValue("limit") != "10" || r.PostFormValue("lease_ms") != "30000" {
+				t.Errorf("claim %v, want limit 10 and lease_ms 30000", r.PostForm)
+			}
+			w.Write([]byte(`{"result": true, "events": [{"id": 4, "attempts": 2, "event_key": "listing:7",
+				"event": {"id": "e1", "type": "listing.updated", "occurred_at": 1, "data": {"id": 7}}}]}`))
+		case r.Method == http.MethodPut && r.URL.Path == "/outbox/4":
+			r.ParseForm()
+			updates = append(updates, r.PostForm)
+			w.Write([]byte(`{"result": true}`))
+		case r.Method == http.MethodDelete && r.URL.Path == "/outbox":
+			if r.URL.Query().Get("delivered_before") != "5000000" {
+				t.Errorf("purge %v, want delivered_before 5000000", r.URL.Query())
+			}
+			w.Write([]byte(`{"result": true, "deleted": 3}`))
+		default:
+			t.Errorf("unexpected request %s %s", r.Method, r.URL.Path)
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	previousOutbox, previousClaim, previousEvent := apiPathOutbox, apiPathOutboxClaim, apiPathOutboxEvent
+	apiPathOutbox, apiPathOutboxClaim, apiPathOutboxEvent = server.URL+"/outbox", server.URL+"/outbox/claim", server.URL+"/outbox/%d"
+	defer func() {
+		apiPathOutbox, apiPathOutboxClaim, apiPathOutboxEvent = previousOutbox, previousClaim, previousEvent
+	}()
+
+	letters := deadLetterUserClient{letters: map[int64]*DeadLetter{}}
+	userClient = letters
+
+	ctx := context.Background()
+	outbox := listingOutbox{}
+
+	records, err := outbox.Claim(ctx, 10, 30*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 1 || records[0].ID != 4 || records[0].Attempts != 2 ||
+		records[0].Event.Key != "listing:7" || records[0].Event.Type != "listing.updated" {
+		t.Fatalf("claimed %+v, want event 4 of listing:7", records)
+	}
+
+	if err := outbox.Delivered(ctx, 4); err != nil {
+		t.Fatal(err)
+	}
+	if err := outbox.Retry(ctx, 4, 3, time.UnixMicro(9000000), "broker down"); err != nil {
+		t.Fatal(err)
+	}
+	if err := outbox.Dead(ctx, records[0], 10, "broker down"); err != nil {
+		t.Fatal(err)
+	}
+	want := []url.Values{
+		{"status": {"delivered"}},
+		{"status": {"pending"}, "attempts": {"3"}, "next_attempt_at": {"9000000"}, "error": {"broker down"}},
+		{"status": {"dead"}, "attempts": {"10"}, "error": {"broker down"}},
+	}
+	if len(updates) != len(want) {
+		t.Fatalf("%d updates, want %d", len(updates), len(want))
+	}
+	for i := range want {
+		if updates[i].Encode() != want[i].Encode() {
+			t.Errorf("update %d = %v, want %v", i, updates[i], want[i])
+		}
+	}
+	if letter := letters.letters[1]; letter == nil || letter.Source != deadLetterListingEvents || letter.SourceID != 4 ||
+		letter.EventKey != "listing:7" || letter.Attempts != 10 || letter.Event.ID != "e1" {
+		t.Errorf("dead letter %+v, want event 4 of listing:7 out of 10 attempts", letter)
+	}
+
+	deleted, err := outbox.Purge(ctx, time.UnixMicro(5000000))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if deleted != 3 {
+		t.Errorf("purged %d events, want 3", deleted)
+	}
+}
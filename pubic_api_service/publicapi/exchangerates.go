@@ -0,0 +1,244 @@
+package publicapi
+
+import (
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"log/slog"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"apperror"
+
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+)
+
+// rates of the currencies against base, one unit of base buys Rates[code] of code
+type ExchangeRates struct {
+	Base      string
+	Rates     map[string]float64
+	FetchedAt time.Time
+}
+
+// listing price in the currency asked with convert_to
+type ConvertedPrice struct {
+	Amount   int    `json:"amount"`
+	Currency string `json:"currency"`
+	// units of currency one unit of the listing currency buys
+	Rate float64 `json:"rate"`
+}
+
+var (
+	errInvalidConvertTo = apperror.Validation("invalid convert_to param, must be an ISO 4217 code with an exchange rate")
+	// upstream for the client, no rates were ever fetched from the provider
+	errExchangeRatesUnavailable = apperror.Upstream("Exchange rates unavailable", nil)
+)
+
+// =========== USECASE LAYER ===========
+
+// set ConvertedPrice of listings in the currency to, listings in a currency without a rate are left without one
+func convertListingPrices(ctx context.Context, listings []Listing, to string) (*ExchangeRates, error) {
+	to = strings.ToUpper(to)
+	if len(to) != 3 {
+		return nil, errInvalidConvertTo
+	}
+
+	rates, err := exchangeRates.get(ctx)
+	if err != nil {
+		slog.ErrorContext(ctx, "usecase error", "code", "443", "error", err)
+		return nil, errExchangeRatesUnavailable
+	}
+	if _, ok := rates.Rates[to]; !ok {
+		return nil, errInvalidConvertTo
+	}
+
+	for i := range listings {
+		currency := listings[i].Currency
+		if currency == "" {
+			currency = listingCurrency
+		}
+		if converted, ok := rates.convert(listings[i].Price, currency, to); ok {
+			listings[i].ConvertedPrice = converted
+		}
+	}
+	return rates, nil
+}
+
+// amount of from in to, false when either currency has no rate or the result does not fit an int
+func (r *ExchangeRates) convert(amount int, from, to string) (*ConvertedPrice, bool) {
+	fromRate, ok := r.Rates[from]
+	if !ok || fromRate <= 0 {
+		return nil, false
+	}
+	toRate, ok := r.Rates[to]
+	if !ok {
+		return nil, false
+	}
+
+	rate := toRate / fromRate
+	converted := math.Round(float64(amount) * rate)
+	if converted >= math.MaxInt64 {
+		return nil, false
+	}
+	return &ConvertedPrice{Amount: int(converted), Currency: to, Rate: math.Round(rate*1e6) / 1e6}, true
+}
+
+// =========== REPOSITORY LAYER, RATES TABLE CACHED FROM THE RATE PROVIDER ===========
+
+// EXCHANGE_RATE_PROVIDER source of the rates converting listing prices, static or ecb
+// EXCHANGE_RATE_TTL how long fetched rates are used before the provider is asked again
+var exchangeRates = newRatesTable(newExchangeRateProvider(cfg.String("EXCHANGE_RATE_PROVIDER", "static")), cfg.Duration("EXCHANGE_RATE_TTL", time.Hour))
+
+// how long a failed fetch waits before the next one, the last rates fetched are served meanwhile
+const exchangeRateRetryAfter = time.Minute
+
+// source of exchange rates, Rates is called at most once per ttl of the table
+type ExchangeRateProvider interface {
+	Rates(ctx context.Context) (*ExchangeRates, error)
+}
+
+// rates of the provider kept for ttl, rates of a failed refresh are the last ones fetched until the provider is back
+type ratesTable struct {
+	provider ExchangeRateProvider
+	ttl      time.Duration
+
+	mu        sync.Mutex
+	rates     *ExchangeRates
+	expiresAt time.Time
+}
+
+func newRatesTable(provider ExchangeRateProvider, ttl time.Duration) *ratesTable {
+	return &ratesTable{provider: provider, ttl: ttl}
+}
+
+// rates of the table, fetched when expired, error only when the provider never answered
+func (t *ratesTable) get(ctx context.Context) (*ExchangeRates, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.rates != nil && time.Now().Before(t.expiresAt) {
+		return t.rates, nil
+	}
+
+	rates, err := t.provider.Rates(ctx)
+	if err != nil {
+		if t.rates == nil {
+			return nil, err
+		}
+		slog.WarnContext(ctx, "exchange rates refresh failed, serving stale rates", "error", err, "fetched_at", t.rates.FetchedAt)
+		t.expiresAt = time.Now().Add(exchangeRateRetryAfter)
+		return t.rates, nil
+	}
+
+	// base converts to itself whether or not the provider lists it
+	rates.Rates[rates.Base] = 1
+	t.rates, t.expiresAt = rates, time.Now().Add(t.ttl)
+	return rates, nil
+}
+
+// provider of name, exit on an unknown name or rates that can not be parsed
+func newExchangeRateProvider(name string) ExchangeRateProvider {
+	switch name {
+	case "static":
+		// EXCHANGE_RATES rates against EXCHANGE_RATE_BASE as CODE=rate,... e.g. USD=0.74,EUR=0.68
+		// EXCHANGE_RATE_BASE ISO 4217 code EXCHANGE_RATES are against
+		provider, err := newStaticRateProvider(cfg.String("EXCHANGE_RATE_BASE", listingCurrency), cfg.String("EXCHANGE_RATES", ""))
+		if err != nil {
+			log.Fatalf("EXCHANGE_RATES: %v", err)
+		}
+		return provider
+	case "ecb":
+		// EXCHANGE_RATE_ECB_URL daily reference rates of the european central bank, against EUR
+		return ecbRateProvider{url: cfg.String("EXCHANGE_RATE_ECB_URL", "https://www.ecb.europa.eu/stats/eurofxref/eurofxref-daily.xml")}
+	default:
+		log.Fatalf("EXCHANGE_RATE_PROVIDER %q is not static or ecb", name)
+		return nil
+	}
+}
+
+// rates set in the config, for deployments without access to a rate provider
+type staticRateProvider struct {
+	rates ExchangeRates
+}
+
+func newStaticRateProvider(base, spec string) (*staticRateProvider, error) {
+	provider := &staticRateProvider{rates: ExchangeRates{Base: strings.ToUpper(base), Rates: map[string]float64{}}}
+	for _, pair := range strings.Split(spec, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		code, value, ok := strings.Cut(pair, "=")
+		rate, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+		if !ok || err != nil || rate <= 0 {
+			return nil, fmt.Errorf("invalid rate %q, want CODE=rate with a rate greater than 0", pair)
+		}
+		provider.rates.Rates[strings.ToUpper(strings.TrimSpace(code))] = rate
+	}
+	return provider, nil
+}
+
+func (p *staticRateProvider) Rates(ctx context.Context) (*ExchangeRates, error) {
+	rates := &ExchangeRates{Base: p.rates.Base, Rates: make(map[string]float64, len(p.rates.Rates)+1), FetchedAt: time.Now()}
+	for code, rate := range p.rates.Rates {
+		rates.Rates[code] = rate
+	}
+	return rates, nil
+}
+
+// EXCHANGE_RATE_TIMEOUT max duration of one call to the rate provider
+var exchangeRateClient = &http.Client{
+	Timeout:   cfg.Duration("EXCHANGE_RATE_TIMEOUT", 5*time.Second),
+	Transport: otelhttp.NewTransport(http.DefaultTransport),
+}
+
+// daily euro foreign exchange reference rates published by the european central bank
+type ecbRateProvider struct {
+	url string
+}
+
+func (p ecbRateProvider) Rates(ctx context.Context) (*ExchangeRates, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, p.url, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := exchangeRateClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("ecb rates: unexpected status %d", resp.StatusCode)
+	}
+
+	// <Cube><Cube time="..."><Cube currency="USD" rate="1.08"/>...</Cube></Cube>
+	var doc struct {
+		Rates []struct {
+			Currency string  `xml:"currency,attr"`
+			Rate     float64 `xml:"rate,attr"`
+		} `xml:"Cube>Cube>Cube"`
+	}
+	if err := xml.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&doc); err != nil {
+		return nil, fmt.Errorf("ecb rates: %w", err)
+	}
+	if len(doc.Rates) == 0 {
+		return nil, errors.New("ecb rates: no rates in the response")
+	}
+
+	rates := &ExchangeRates{Base: "EUR", Rates: map[string]float64{}, FetchedAt: time.Now()}
+	for _, rate := range doc.Rates {
+		if rate.Rate > 0 {
+			rates.Rates[rate.Currency] = rate.Rate
+		}
+	}
+	return rates, nil
+}
@@ -0,0 +1,94 @@
+package publicapi
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+// provider answering with rates once, then failing
+type flakyRateProvider struct {
+	calls int
+}
+
+func (p *flakyRateProvider) Rates(ctx context.Context) (*ExchangeRates, error) {
+	p.calls++
+	if p.calls > 1 {
+		return nil, errors.New("provider down")
+	}
+	return &ExchangeRates{Base: "SGD", Rates: map[string]float64{"USD": 0.75, "EUR": 0.5}}, nil
+}
+
+func TestConvertListingPrices(t *testing.T) {
+	provider := &flakyRateProvider{}
+	exchangeRates = newRatesTable(provider, 0)
+
+	listings := []Listing{
+		{ID: 1, Price: 1000, Currency: "SGD"},
+		{ID: 2, Price: 300, Currency: "EUR"},
+		{ID: 3, Price: 500},
+		{ID: 4, Price: 100, Currency: "JPY"},
+	}
+	if _, err := convertListingPrices(context.Background(), listings, "usd"); err != nil {
+		t.Fatalf("convert: %v", err)
+	}
+
+	want := []*ConvertedPrice{
+		{Amount: 750, Currency: "USD", Rate: 0.75},
+		{Amount: 450, Currency: "USD", Rate: 1.5},
+		{Amount: 375, Currency: "USD", Rate: 0.75},
+		nil,
+	}
+	for i, listing := range listings {
+		if !reflect.DeepEqual(listing.ConvertedPrice, want[i]) {
+			t.Errorf("listing %d converted to %+v, want %+v", listing.ID, listing.ConvertedPrice, want[i])
+		}
+	}
+
+	// expired table keeps the rates it has while the provider is down
+	if _, err := convertListingPrices(context.Background(), listings, "SGD"); err != nil {
+		t.Fatalf("convert with the provider down: %v", err)
+	}
+	if provider.calls != 2 {
+		t.Errorf("provider called %d times, want 2", provider.calls)
+	}
+	if got := listings[1].ConvertedPrice; got == nil || got.Amount != 600 {
+		t.Errorf("EUR listing converted to %+v, want 600 SGD from the stale rates", got)
+	}
+
+	if _, err := convertListingPrices(context.Background(), listings, "XXX"); !errors.Is(err, errInvalidConvertTo) {
+		t.Errorf("convert to a currency without a rate: %v, want errInvalidConvertTo", err)
+	}
+
+	exchangeRates = newRatesTable(&flakyRateProvider{calls: 1}, 0)
+	if _, err := convertListingPrices(context.Background(), listings, "USD"); !errors.Is(err, errExchangeRatesUnavailable) {
+		t.Errorf("convert without rates: %v, want errExchangeRatesUnavailable", err)
+	}
+}
+
+func TestECBRateProvider(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`<?xml version="1.0" encoding="UTF-8"?>
+<gesmes:Envelope xmlns:gesmes="http://www.gesmes.org/xml/2002-08-01" xmlns="http://www.ecb.int/vocabulary/2002-08-01/eurofxref">
+	<gesmes:subject>Reference rates</gesmes:subject>
+	<Cube>
+		<Cube time="2026-10-15">
+			<Cube currency="USD" rate="1.0812"/>
+			<Cube currency="SGD" rate="1.4503"/>
+		</Cube>
+	</Cube>
+</gesmes:Envelope>`))
+	}))
+	defer server.Close()
+
+	rates, err := ecbRateProvider{url: server.URL}.Rates(context.Background())
+	if err != nil {
+		t.Fatalf("rates: %v", err)
+	}
+	if want := map[string]float64{"USD": 1.0812, "SGD": 1.4503}; rates.Base != "EUR" || !reflect.DeepEqual(rates.Rates, want) {
+		t.Errorf("rates %s %v, want EUR %v", rates.Base, rates.Rates, want)
+	}
+}
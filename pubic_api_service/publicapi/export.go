@@ -0,0 +1,239 @@
+package publicapi
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"apperror"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	exportFormatCSV    = "csv"
+	exportFormatNDJSON = "ndjson"
+
+	// listings asked from the listing service per page of an export
+	exportPageSize = 100
+)
+
+var errExportFormatInvalid = apperror.Validation("invalid format, supported values: csv, ndjson")
+
+// columns of a csv export, user_name is joined from the user service
+var exportCSVHeader = []string{"id", "user_id", "user_name", "listing_type", "price", "currency", "region", "area", "area_units", "video_url", "quality_score", "created_at", "updated_at"}
+
+// =========== INTERFACE HANDLER, HANDLING REQUEST RESPONSE API DEPEND INTERFACE ===========
+
+// stream every listing matching the user_id and region filters as csv or ndjson, oldest first. The response is
+// chunked and flushed per page, a failure before the first page is answered with the error envelope, a failure
+// after it cuts the connection so the client can not take a partial export for a complete one
+func exportListingsHandler(c *gin.Context) {
+	format := c.DefaultQuery("format", exportFormatCSV)
+	if format != exportFormatCSV && format != exportFormatNDJSON {
+		apperror.Respond(c, errExportFormatInvalid)
+		return
+	}
+
+	units, err := parseAreaUnits(c.Query("units"))
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "handler error", "code", "239", "error", err)
+		apperror.Respond(c, err)
+		return
+	}
+	variant, err := parseMediaVariant(c)
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "handler error", "code", "579", "error", err)
+		apperror.Respond(c, err)
+		return
+	}
+
+	userID := c.Query("user_id")
+	if _, err := strconv.Atoi(userID); userID != "" && err != nil {
+		apperror.JSON(c, http.StatusBadRequest, "Invalid user_id param")
+		return
+	}
+
+	var w listingExportWriter
+	started := false
+	err = exportListingsUsecase(c.Request.Context(), userID, c.Query("region"), func(listings []Listing) error {
+		if !started {
+			started = true
+			w = startListingExport(c, format)
+		}
+
+		for i := range listings {
+			transformListingArea(&listings[i].Area, &listings[i].AreaUnits, units)
+			transformListingMedia(c.Request.Context(), listings[i].Images, listings[i].Media, &listings[i].VideoURL, variant)
+			if err := w.write(&listings[i]); err != nil {
+				return err
+			}
+		}
+
+		if err := w.flush(); err != nil {
+			return err
+		}
+		c.Writer.Flush()
+		return nil
+	})
+	if err != nil {
+		if !started {
+			apperror.Respond(c, err)
+			return
+		}
+
+		slog.ErrorContext(c.Request.Context(), "handler error", "code", "240", "error", err)
+		abortStream(c)
+	}
+}
+
+// write the headers of an export in format, the body follows in chunks
+func startListingExport(c *gin.Context, format string) listingExportWriter {
+	c.Header("Cache-Control", "no-store")
+	c.Header("Content-Disposition", `attachment; filename="listings.`+format+`"`)
+
+	if format == exportFormatNDJSON {
+		c.Header("Content-Type", "application/x-ndjson")
+		c.Status(http.StatusOK)
+		return &ndjsonListingWriter{encoder: json.NewEncoder(c.Writer)}
+	}
+
+	c.Header("Content-Type", "text/csv; charset=utf-8")
+	c.Status(http.StatusOK)
+	w := &csvListingWriter{w: csv.NewWriter(c.Writer)}
+	w.w.Write(exportCSVHeader)
+	return w
+}
+
+// close the connection without ending the chunked body, clients report the download as failed
+func abortStream(c *gin.Context) {
+	conn, _, err := c.Writer.Hijack()
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "handler error", "code", "242", "error", err)
+		return
+	}
+	conn.Close()
+}
+
+type listingExportWriter interface {
+	write(listing *Listing) error
+	flush() error
+}
+
+type csvListingWriter struct {
+	w *csv.Writer
+}
+
+func (w *csvListingWriter) write(listing *Listing) error {
+	return w.w.Write([]string{
+		strconv.Itoa(listing.ID),
+		strconv.Itoa(listing.UserID),
+		csvText(listing.User.Name),
+		listing.ListingType,
+		strconv.Itoa(listing.Price),
+		listing.Currency,
+		csvText(listing.Region),
+		formatExportArea(listing.Area),
+		listing.AreaUnits,
+		listing.VideoURL,
+		strconv.Itoa(listing.QualityScore),
+		strconv.FormatInt(listing.CreatedAt, 10),
+		strconv.FormatInt(listing.UpdatedAt, 10),
+	})
+}
+
+func (w *csvListingWriter) flush() error {
+	w.w.Flush()
+	return w.w.Error()
+}
+
+type ndjsonListingWriter struct {
+	encoder *json.Encoder
+}
+
+// one listing per line, encoder ends every value with a newline
+func (w *ndjsonListingWriter) write(listing *Listing) error {
+	return w.encoder.Encode(listing)
+}
+
+func (w *ndjsonListingWriter) flush() error {
+	return nil
+}
+
+// user entered text starting like a formula is prefixed with ' so spreadsheets show it instead of running it
+func csvText(s string) string {
+	if s != "" && strings.ContainsRune("=+-@\t\r", rune(s[0])) {
+		return "'" + s
+	}
+
+	return s
+}
+
+// empty for listings without area
+func formatExportArea(area float64) string {
+	if area == 0 {
+		return ""
+	}
+
+	return strconv.FormatFloat(area, 'f', -1, 64)
+}
+
+// =========== USECASE LAYER, SERVES AS AN INTERMEDIARY BETWEEN THE PRESENTATION LAYER AND THE DATA LAYER ===========
+
+// call each with every page of listings joined with their users, oldest first, until the last page or an error.
+// Listings created while exporting are included when they land on a page not read yet
+func exportListingsUsecase(ctx context.Context, userID, region string, each func(listings []Listing) error) error {
+	for page := 1; ; page++ {
+		// straight from the listing service, the export wants fresh pages and would only fill the page cache
+		res, err := fetchListingsService(ctx, userID, region, page, exportPageSize, "created_at", "asc")
+		if err != nil {
+			return apperror.Upstream("Failed to get listings", err)
+		}
+		if !res.Result {
+			slog.ErrorContext(ctx, "usecase error", "code", "241", "error", "api result failed: failed to get listings")
+			return apperror.Upstream("Failed to get listings", nil)
+		}
+
+		listings, err := joinListingUsers(ctx, res.Listings)
+		if err != nil {
+			return err
+		}
+
+		if len(listings) > 0 || page == 1 {
+			if err := each(listings); err != nil {
+				return err
+			}
+		}
+
+		if !res.Pagination.HasNext || len(res.Listings) == 0 {
+			return nil
+		}
+	}
+}
+
+// listings with their user, users deleted since keep an empty user
+func joinListingUsers(ctx context.Context, listings []Listing) ([]Listing, error) {
+	var userIDs []int
+	seen := map[int]bool{}
+	for _, listing := range listings {
+		if !seen[listing.UserID] {
+			seen[listing.UserID] = true
+			userIDs = append(userIDs, listing.UserID)
+		}
+	}
+
+	users, err := fetchUsersByIDs(ctx, userIDs)
+	if err != nil {
+		return nil, apperror.Upstream("Failed to get users", err)
+	}
+
+	for i := range listings {
+		listings[i].User = users[listings[i].UserID]
+	}
+
+	return listings, nil
+}
@@ -0,0 +1,359 @@
+package publicapi
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+
+	"apperror"
+
+	"github.com/gin-gonic/gin"
+)
+
+// listing saved by a user, kept by the user service
+type Favorite struct {
+	UserID    int   `json:"user_id"`
+	ListingID int   `json:"listing_id"`
+	CreatedAt int64 `json:"created_at"`
+}
+
+type FavoriteResponse struct {
+	Result   bool `json:"result"`
+	Favorite Favorite
+}
+
+type FavoritesResponse struct {
+	Result     bool `json:"result"`
+	Favorites  []Favorite
+	Pagination Pagination `json:"pagination"`
+}
+
+// favorite with its listing, nil once the listing was deleted
+type FavoriteListing struct {
+	ListingID int            `json:"listing_id"`
+	CreatedAt int64          `json:"created_at"`
+	Listing   *ListingCreate `json:"listing"`
+}
+
+var (
+	ErrFavoriteNotFound = apperror.NotFound("Favorite not found")
+	ErrFavoriteLimit    = apperror.Conflict("favorite limit reached, remove a favorite first")
+
+	errFavoritesPage = apperror.Validation("page_num must be at least 1 and page_size between 1 and 50")
+)
+
+// LISTING_FETCH_CONCURRENCY max listing calls in flight at the same time when enriching favorites
+var listingFetchConcurrency = cfg.Int("LISTING_FETCH_CONCURRENCY", 4)
+
+// =========== INTERFACE HANDLER, HANDLING REQUEST RESPONSE API DEPEND INTERFACE ===========
+
+// favorites of the user newest first with their listings, users only see their own
+func getFavoritesHandler(c *gin.Context) {
+	id, ok := favoritesUserID(c)
+	if !ok {
+		return
+	}
+
+	pageNum, errNum := strconv.Atoi(c.DefaultQuery("page_num", "1"))
+	pageSize, errSize := strconv.Atoi(c.DefaultQuery("page_size", "20"))
+	if errNum != nil || errSize != nil {
+		apperror.Respond(c, errFavoritesPage)
+		return
+	}
+
+	variant, err := parseMediaVariant(c)
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "handler error", "code", "584", "error", err)
+		apperror.Respond(c, err)
+		return
+	}
+
+	res, pagination, err := getFavoritesUsecase(c.Request.Context(), id, pageNum, pageSize)
+	if err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+	for _, favorite := range res {
+		if favorite.Listing != nil {
+			transformListingMedia(c.Request.Context(), favorite.Listing.Images, favorite.Listing.Media, &favorite.Listing.VideoURL, variant)
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{"favorites": res, "pagination": pagination})
+}
+
+// save a listing, saving it again keeps the first save time
+func addFavoriteHandler(c *gin.Context) {
+	id, ok := favoritesUserID(c)
+	if !ok {
+		return
+	}
+
+	listingID, err := strconv.Atoi(c.Param("listing_id"))
+	if err != nil || listingID < 1 {
+		slog.ErrorContext(c.Request.Context(), "handler error", "code", "329", "error", "Invalid listing ID")
+		apperror.JSON(c, http.StatusBadRequest, "Invalid listing ID")
+		return
+	}
+
+	res, err := addFavoriteUsecase(c.Request.Context(), id, listingID)
+	if err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"favorite": res})
+}
+
+func removeFavoriteHandler(c *gin.Context) {
+	id, ok := favoritesUserID(c)
+	if !ok {
+		return
+	}
+
+	listingID, err := strconv.Atoi(c.Param("listing_id"))
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "handler error", "code", "330", "error", "Invalid listing ID")
+		apperror.JSON(c, http.StatusBadRequest, "Invalid listing ID")
+		return
+	}
+
+	if err := removeFavoriteUsecase(c.Request.Context(), id, listingID); err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// user id of the path, answering 400 or 403 when it is invalid or another user
+func favoritesUserID(c *gin.Context) (int, bool) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "handler error", "code", "331", "error", err)
+		apperror.JSON(c, http.StatusBadRequest, "Invalid user ID")
+		return 0, false
+	}
+
+	// favorites are private, users only see and change their own
+	if id != authUserID(c) {
+		apperror.JSON(c, http.StatusForbidden, "Cannot access favorites of another user")
+		return 0, false
+	}
+
+	return id, true
+}
+
+// =========== USECASE LAYER, SERVES AS AN INTERMEDIARY BETWEEN THE PRESENTATION LAYER AND THE DATA LAYER ===========
+
+func getFavoritesUsecase(ctx context.Context, userID, pageNum, pageSize int) ([]FavoriteListing, *Pagination, error) {
+	if pageNum < 1 || pageSize < 1 || pageSize > 50 {
+		return nil, nil, errFavoritesPage
+	}
+
+	res, err := userClient.FindUserFavorites(ctx, userID, pageNum, pageSize)
+	if err != nil {
+		if errors.Is(err, ErrUserNotFound) {
+			return nil, nil, err
+		}
+		return nil, nil, apperror.Upstream("Failed to get favorites", err)
+	}
+
+	listingIDs := make([]int, len(res.Favorites))
+	for i, favorite := range res.Favorites {
+		listingIDs[i] = favorite.ListingID
+	}
+	listings, err := fetchListingsByIDs(ctx, listingIDs)
+	if err != nil {
+		return nil, nil, apperror.Upstream("Failed to get listings", err)
+	}
+
+	favorites := make([]FavoriteListing, len(res.Favorites))
+	for i, favorite := range res.Favorites {
+		favorites[i] = FavoriteListing{ListingID: favorite.ListingID, CreatedAt: favorite.CreatedAt}
+		if listing, ok := listings[favorite.ListingID]; ok {
+			favorites[i].Listing = &listing
+		}
+	}
+
+	return favorites, &res.Pagination, nil
+}
+
+// only existing listings can be saved
+func addFavoriteUsecase(ctx context.Context, userID, listingID int) (*Favorite, error) {
+	if _, err := findListingByIDService(ctx, listingID); err != nil {
+		if errors.Is(err, errListingNotFound) {
+			return nil, err
+		}
+		return nil, apperror.Upstream("Failed to get listing", err)
+	}
+
+	res, err := userClient.AddUserFavorite(ctx, userID, listingID)
+	if err != nil {
+		if errors.Is(err, ErrUserNotFound) || errors.Is(err, ErrFavoriteLimit) {
+			return nil, err
+		}
+		return nil, apperror.Upstream("Failed to add favorite", err)
+	}
+
+	return &res.Favorite, nil
+}
+
+// deleted listings can still be removed
+func removeFavoriteUsecase(ctx context.Context, userID, listingID int) error {
+	if err := userClient.RemoveUserFavorite(ctx, userID, listingID); err != nil {
+		if errors.Is(err, ErrFavoriteNotFound) {
+			return err
+		}
+		return apperror.Upstream("Failed to remove favorite", err)
+	}
+
+	return nil
+}
+
+// fetch listings by ids on a bounded worker pool, deleted listings are left out and the first other error cancel the rest
+func fetchListingsByIDs(ctx context.Context, listingIDs []int) (map[int]ListingCreate, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	workers := min(max(listingFetchConcurrency, 1), len(listingIDs))
+
+	var (
+		mu       sync.Mutex
+		wg       sync.WaitGroup
+		firstErr error
+		listings = make(map[int]ListingCreate, len(listingIDs))
+		queue    = make(chan int)
+	)
+
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for id := range queue {
+				res, err := findListingByIDService(ctx, id)
+
+				mu.Lock()
+				switch {
+				case errors.Is(err, errListingNotFound):
+				case err != nil:
+					if firstErr == nil {
+						firstErr = err
+						cancel()
+					}
+				default:
+					listings[id] = res.Listing
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+
+feed:
+	for _, id := range listingIDs {
+		select {
+		case queue <- id:
+		case <-ctx.Done():
+			break feed
+		}
+	}
+	close(queue)
+	wg.Wait()
+
+	if firstErr != nil {
+		return nil, firstErr
+	}
+
+	if err := ctx.Err(); err != nil && !errors.Is(err, context.Canceled) {
+		return nil, err
+	}
+
+	return listings, nil
+}
+
+// =========== REPOSITORY LAYER, ABSTRACTION OVER THE DATA PERSISTENCE (databases, file systems, or external APIs) ===========
+
+var (
+	// user service api path
+	apiPathUserFavorites = userServiceURL + "/users/%d/favorites"
+	apiPathUserFavorite  = userServiceURL + "/users/%d/favorites/%d"
+)
+
+func (httpUserClient) FindUserFavorites(ctx context.Context, userID, pageNum, pageSize int) (*FavoritesResponse, error) {
+	query := url.Values{"page_num": {strconv.Itoa(pageNum)}, "page_size": {strconv.Itoa(pageSize)}}
+	resp, err := httpGet(ctx, fmt.Sprintf(apiPathUserFavorites, userID)+"?"+query.Encode())
+	if err != nil {
+		slog.ErrorContext(ctx, "service error", "code", "332", "error", err)
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		return nil, ErrUserNotFound
+	default:
+		slog.ErrorContext(ctx, "service error", "code", "333", "error", "error fetching favorites from user service")
+		return nil, errors.New("error fetching favorites from user service")
+	}
+
+	var favorites FavoritesResponse
+	if err := decodeJSON(resp.Body, &favorites); err != nil {
+		slog.ErrorContext(ctx, "service error", "code", "334", "error", err)
+		return nil, err
+	}
+
+	return &favorites, nil
+}
+
+func (httpUserClient) AddUserFavorite(ctx context.Context, userID, listingID int) (*FavoriteResponse, error) {
+	resp, err := httpPost(ctx, fmt.Sprintf(apiPathUserFavorite, userID, listingID), "application/json", nil)
+	if err != nil {
+		slog.ErrorContext(ctx, "service error", "code", "335", "error", err)
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusCreated:
+	case http.StatusNotFound:
+		return nil, ErrUserNotFound
+	case http.StatusConflict:
+		return nil, ErrFavoriteLimit
+	default:
+		slog.ErrorContext(ctx, "service error", "code", "336", "error", "error adding favorite from user service")
+		return nil, errors.New("error adding favorite from user service")
+	}
+
+	var favorite FavoriteResponse
+	if err := decodeJSON(resp.Body, &favorite); err != nil {
+		slog.ErrorContext(ctx, "service error", "code", "337", "error", err)
+		return nil, err
+	}
+
+	return &favorite, nil
+}
+
+func (httpUserClient) RemoveUserFavorite(ctx context.Context, userID, listingID int) error {
+	resp, err := httpDelete(ctx, fmt.Sprintf(apiPathUserFavorite, userID, listingID))
+	if err != nil {
+		slog.ErrorContext(ctx, "service error", "code", "338", "error", err)
+		return err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return nil
+	case http.StatusNotFound:
+		return ErrFavoriteNotFound
+	default:
+		slog.ErrorContext(ctx, "service error", "code", "339", "error", "error removing favorite from user service")
+		return errors.New("error removing favorite from user service")
+	}
+}
@@ -0,0 +1,93 @@
+package publicapi
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+// user client answering one page of favorites of user 1
+type favoritesUserClient struct {
+	UserClient
+	favorites []Favorite
+}
+
+func (c favoritesUserClient) FindUserFavorites(ctx context.Context, userID, pageNum, pageSize int) (*FavoritesResponse, error) {
+	if userID != 1 {
+		return nil, ErrUserNotFound
+	}
+
+	return &FavoritesResponse{
+		Result:     true,
+		Favorites:  c.favorites,
+		Pagination: Pagination{PageNum: pageNum, PageSize: pageSize, TotalItems: len(c.favorites), TotalPages: 1},
+	}, nil
+}
+
+// listing client knowing listings, other ids were deleted
+type favoritesListingClient struct {
+	ListingClient
+	listings map[int]ListingCreate
+	failing  int
+}
+
+func (c favoritesListingClient) FindListing(ctx context.Context, listingID int) (*ListingDetailResponse, error) {
+	if listingID == c.failing {
+		return nil, errors.New("listing service down")
+	}
+	listing, ok := c.listings[listingID]
+	if !ok {
+		return nil, errListingNotFound
+	}
+
+	return &ListingDetailResponse{Result: true, Listing: listing}, nil
+}
+
+func TestGetFavoritesUsecase(t *testing.T) {
+	previousUsers, previousListings := userClient, listingClient
+	defer func() { userClient, listingClient = previousUsers, previousListings }()
+
+	userClient = favoritesUserClient{favorites: []Favorite{
+		{UserID: 1, ListingID: 9, CreatedAt: 3},
+		{UserID: 1, ListingID: 8, CreatedAt: 2},
+		{UserID: 1, ListingID: 7, CreatedAt: 1},
+	}}
+	listings := favoritesListingClient{listings: map[int]ListingCreate{
+		7: {ID: 7, ListingType: "rent", Price: 3500},
+		9: {ID: 9, ListingType: "sale", Price: 900000},
+	}}
+	listingClient = listings
+
+	ctx := context.Background()
+	favorites, pagination, err := getFavoritesUsecase(ctx, 1, 1, 20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pagination.TotalItems != 3 {
+		t.Errorf("pagination %+v, want 3 items", pagination)
+	}
+
+	// newest first as the user service returns them, the deleted listing 8 is kept without its listing
+	if len(favorites) != 3 || favorites[0].ListingID != 9 || favorites[1].ListingID != 8 || favorites[2].ListingID != 7 {
+		t.Fatalf("favorites %+v, want listings 9, 8, 7", favorites)
+	}
+	if favorites[0].Listing == nil || favorites[0].Listing.Price != 900000 || favorites[2].Listing == nil || favorites[2].Listing.Price != 3500 {
+		t.Errorf("favorites %+v, want listings 9 and 7 enriched", favorites)
+	}
+	if favorites[1].Listing != nil {
+		t.Errorf("deleted listing 8 enriched with %+v", favorites[1].Listing)
+	}
+
+	listings.failing = 7
+	listingClient = listings
+	if _, _, err := getFavoritesUsecase(ctx, 1, 1, 20); err == nil {
+		t.Error("listing service failure answered without error")
+	}
+
+	if _, _, err := getFavoritesUsecase(ctx, 1, 1, 51); !errors.Is(err, errFavoritesPage) {
+		t.Errorf("page of 51: %v, want errFavoritesPage", err)
+	}
+	if _, err := addFavoriteUsecase(ctx, 1, 8); !errors.Is(err, errListingNotFound) {
+		t.Errorf("saving deleted listing: %v, want errListingNotFound", err)
+	}
+}
@@ -0,0 +1,1065 @@
+package publicapi
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math"
+	"net/http"
+	"reflect"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"apperror"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GRAPHQL_MAX_DEPTH deepest nesting of fields in a query, the root fields are at depth 1
+var graphqlMaxDepth = cfg.Int("GRAPHQL_MAX_DEPTH", 8)
+
+// GRAPHQL_FETCH_CONCURRENCY max listing service calls in flight when fetching the listings of several users
+var graphqlFetchConcurrency = cfg.Int("GRAPHQL_FETCH_CONCURRENCY", 4)
+
+// most ids of users and most listings of a page a field may ask for
+const graphqlMaxPageSize = 100
+
+// schema of POST /public-api/graphql, listings and users as a graph, field names as in the REST envelopes
+const graphqlSchema = `type Query {
+  listing(id: Int!): Listing
+  listings(page_num: Int = 1, page_size: Int = 10, user_id: Int, region: String, sort_by: String, sort_dir: String): ListingPage
+  user(id: Int!): User
+  users(ids: [Int!]!): [User]
+}
+
+type Listing {
+  id: Int
+  user_id: Int
+  listing_type: String
+  price: Int
+  currency: String
+  region: String
+  area: Float
+  video_url: String
+  images(w: Int, h: Int): [Image]
+  quality_score: Int
+  created_at: Int
+  updated_at: Int
+  user: User
+}
+
+type Image {
+  id: Int
+  url: String
+  content_type: String
+  width: Int
+  height: Int
+  position: Int
+  is_primary: Boolean
+}
+
+type User {
+  id: Int
+  name: String
+  created_at: Int
+  updated_at: Int
+  listings(page_num: Int = 1, page_size: Int = 10, sort_by: String, sort_dir: String): ListingPage
+}
+
+type ListingPage {
+  listings: [Listing]
+  pagination: Pagination
+}
+
+type Pagination {
+  page_num: Int
+  page_size: Int
+  total_items: Int
+  total_pages: Int
+  has_next: Boolean
+}
+`
+
+type gqlFieldDef struct {
+	// type reference, [User] for lists
+	typ string
+	// argument name to type reference and default value
+	args map[string]gqlArgDef
+}
+
+type gqlArgDef struct {
+	typ string
+	def any
+}
+
+var gqlPageArgs = map[string]gqlArgDef{
+	"page_num":  {typ: "Int", def: 1},
+	"page_size": {typ: "Int", def: 10},
+	"sort_by":   {typ: "String"},
+	"sort_dir":  {typ: "String"},
+}
+
+// fields of every object type of graphqlSchema
+var gqlTypes = map[string]map[string]gqlFieldDef{
+	"Query": {
+		"listing":  {typ: "Listing", args: map[string]gqlArgDef{"id": {typ: "Int!"}}},
+		"listings": {typ: "ListingPage", args: withArgs(gqlPageArgs, map[string]gqlArgDef{"user_id": {typ: "Int"}, "region": {typ: "String"}})},
+		"user":     {typ: "User", args: map[string]gqlArgDef{"id": {typ: "Int!"}}},
+		"users":    {typ: "[User]", args: map[string]gqlArgDef{"ids": {typ: "[Int!]!"}}},
+	},
+	"Listing": {
+		"id": {typ: "Int"}, "user_id": {typ: "Int"}, "listing_type": {typ: "String"}, "price": {typ: "Int"},
+		"currency": {typ: "String"}, "region": {typ: "String"}, "area": {typ: "Float"}, "video_url": {typ: "String"},
+		"images": {typ: "[Image]", args: map[string]gqlArgDef{"w": {typ: "Int"}, "h": {typ: "Int"}}}, "quality_score": {typ: "Int"}, "created_at": {typ: "Int"}, "updated_at": {typ: "Int"},
+		"user": {typ: "User"},
+	},
+	"Image": {
+		"id": {typ: "Int"}, "url": {typ: "String"}, "content_type": {typ: "String"}, "width": {typ: "Int"},
+		"height": {typ: "Int"}, "position": {typ: "Int"}, "is_primary": {typ: "Boolean"},
+	},
+	"User": {
+		"id": {typ: "Int"}, "name": {typ: "String"}, "created_at": {typ: "Int"}, "updated_at": {typ: "Int"},
+		"listings": {typ: "ListingPage", args: gqlPageArgs},
+	},
+	"ListingPage": {
+		"listings": {typ: "[Listing]"}, "pagination": {typ: "Pagination"},
+	},
+	"Pagination": {
+		"page_num": {typ: "Int"}, "page_size": {typ: "Int"}, "total_items": {typ: "Int"}, "total_pages": {typ: "Int"},
+		"has_next": {typ: "Boolean"},
+	},
+}
+
+func withArgs(base, extra map[string]gqlArgDef) map[string]gqlArgDef {
+	args := make(map[string]gqlArgDef, len(base)+len(extra))
+	for name, arg := range base {
+		args[name] = arg
+	}
+	for name, arg := range extra {
+		args[name] = arg
+	}
+	return args
+}
+
+var gqlScalars = map[string]bool{"Int": true, "Float": true, "String": true, "Boolean": true}
+
+// named type of a type reference, User of [User!]!
+func gqlNamedType(typ string) string {
+	return strings.Trim(typ, "[]!")
+}
+
+type graphqlRequest struct {
+	Query         string         `json:"query"`
+	OperationName string         `json:"operationName"`
+	Variables     map[string]any `json:"variables"`
+}
+
+// =========== INTERFACE HANDLER, HANDLING REQUEST RESPONSE API DEPEND INTERFACE ===========
+
+// run the query of the body, 400 with errors when it can not run, 200 with data and the errors of the fields that
+// failed otherwise
+func graphqlHandler(c *gin.Context) {
+	var req graphqlRequest
+	if err := c.ShouldBindJSON(&req); err != nil || strings.TrimSpace(req.Query) == "" {
+		slog.ErrorContext(c.Request.Context(), "handler error", "code", "515", "error", err)
+		c.JSON(http.StatusBadRequest, gin.H{"errors": []gqlError{{Message: "body must be a JSON object with a query"}}})
+		return
+	}
+
+	data, errs, ok := executeGraphQLUsecase(c.Request.Context(), req)
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"errors": errs})
+		return
+	}
+
+	response := gin.H{"data": data}
+	if len(errs) > 0 {
+		response["errors"] = errs
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// graphqlSchema as SDL, for client code generators
+func getGraphQLSchemaHandler(c *gin.Context) {
+	c.Data(http.StatusOK, "text/plain; charset=utf-8", []byte(graphqlSchema))
+}
+
+// =========== USECASE LAYER, SERVES AS AN INTERMEDIARY BETWEEN THE PRESENTATION LAYER AND THE DATA LAYER ===========
+
+// data of the query of req with the errors of the fields that failed, ok false with the errors when the query is
+// invalid and nothing ran
+func executeGraphQLUsecase(ctx context.Context, req graphqlRequest) (*gqlObject, []gqlError, bool) {
+	doc, err := parseGraphQL(req.Query)
+	if err != nil {
+		return nil, []gqlError{*asGQLError(err)}, false
+	}
+
+	operation, err := selectOperation(doc, req.OperationName)
+	if err != nil {
+		return nil, []gqlError{*asGQLError(err)}, false
+	}
+
+	planner := &gqlPlanner{doc: doc, visiting: map[string]bool{}, declared: map[string]bool{}}
+	for _, def := range operation.variables {
+		planner.declared[def.name] = true
+	}
+	if planner.variables, err = coerceVariables(operation.variables, req.Variables); err != nil {
+		return nil, []gqlError{*asGQLError(err)}, false
+	}
+	var plan []*gqlPlan
+	planner.collect("Query", operation.selections, &plan, 1)
+	if len(planner.errors) > 0 {
+		return nil, planner.errors, false
+	}
+
+	executor := &gqlExecutor{}
+	data := executor.resolve(ctx, "Query", []any{nil}, [][]any{nil}, plan)[0]
+	return data, executor.errors, true
+}
+
+func asGQLError(err error) *gqlError {
+	var gqlErr *gqlError
+	if errors.As(err, &gqlErr) {
+		return gqlErr
+	}
+	return &gqlError{Message: err.Error()}
+}
+
+// operation of doc to run, the one named name or the only one
+func selectOperation(doc *gqlDocument, name string) (*gqlOperation, error) {
+	var operation *gqlOperation
+	for _, candidate := range doc.operations {
+		if name == "" && len(doc.operations) > 1 {
+			return nil, &gqlError{Message: "Must provide operationName when the document has several operations"}
+		}
+		if name == "" || candidate.name == name {
+			operation = candidate
+			break
+		}
+	}
+	if operation == nil {
+		return nil, &gqlError{Message: fmt.Sprintf("Unknown operation named %q", name)}
+	}
+	if operation.kind != "query" {
+		return nil, &gqlError{Message: "Only query operations are supported, writes go through the REST API"}
+	}
+	return operation, nil
+}
+
+// values of the variables of the operation from those of the request, with their defaults
+func coerceVariables(defs []gqlVariableDef, values map[string]any) (map[string]any, error) {
+	coerced := make(map[string]any, len(defs))
+	for _, def := range defs {
+		if !gqlScalars[gqlNamedType(def.typ)] {
+			return nil, &gqlError{Message: fmt.Sprintf("Variable $%s of type %s is not an input type", def.name, def.typ)}
+		}
+
+		value, ok := values[def.name]
+		if !ok && def.hasDef {
+			value, ok = def.def, true
+		}
+		if !ok && strings.HasSuffix(def.typ, "!") {
+			return nil, &gqlError{Message: fmt.Sprintf("Variable $%s of required type %s was not provided", def.name, def.typ)}
+		}
+		if !ok {
+			continue
+		}
+
+		val, err := coerceInput(value, def.typ, nil)
+		if err != nil {
+			return nil, &gqlError{Message: fmt.Sprintf("Variable $%s got invalid value: %s", def.name, err)}
+		}
+		coerced[def.name] = val
+	}
+	return coerced, nil
+}
+
+// value as an input of type typ, variables of value taken from variables
+func coerceInput(value any, typ string, variables map[string]any) (any, error) {
+	if name, ok := value.(gqlVariable); ok {
+		val, ok := variables[string(name)]
+		if !ok {
+			if strings.HasSuffix(typ, "!") {
+				return nil, fmt.Errorf("variable $%s is not provided", name)
+			}
+			return nil, nil
+		}
+		value = val
+	}
+
+	if value == nil {
+		if strings.HasSuffix(typ, "!") {
+			return nil, fmt.Errorf("expected non-null %s, found null", typ)
+		}
+		return nil, nil
+	}
+	typ = strings.TrimSuffix(typ, "!")
+
+	if strings.HasPrefix(typ, "[") {
+		inner := typ[1 : len(typ)-1]
+		items, ok := value.([]any)
+		if !ok {
+			// a single value is a list of one
+			items = []any{value}
+		}
+		list := make([]any, len(items))
+		for i, item := range items {
+			val, err := coerceInput(item, inner, variables)
+			if err != nil {
+				return nil, err
+			}
+			list[i] = val
+		}
+		return list, nil
+	}
+
+	switch typ {
+	case "Int":
+		switch v := value.(type) {
+		case int:
+			if v >= math.MinInt32 && v <= math.MaxInt32 {
+				return v, nil
+			}
+		case float64:
+			// variables decoded from json
+			if v == math.Trunc(v) && v >= math.MinInt32 && v <= math.MaxInt32 {
+				return int(v), nil
+			}
+		}
+	case "Float":
+		switch v := value.(type) {
+		case int:
+			return float64(v), nil
+		case float64:
+			return v, nil
+		}
+	case "String":
+		if v, ok := value.(string); ok {
+			return v, nil
+		}
+	case "Boolean":
+		if v, ok := value.(bool); ok {
+			return v, nil
+		}
+	}
+	return nil, fmt.Errorf("expected %s, found %v", typ, gqlPrintValue(value))
+}
+
+func gqlPrintValue(value any) string {
+	switch v := value.(type) {
+	case string:
+		return strconv.Quote(v)
+	case gqlEnum:
+		return string(v)
+	}
+	body, _ := json.Marshal(value)
+	return string(body)
+}
+
+// field to resolve, under the key it is answered with
+type gqlPlan struct {
+	key  string
+	name string
+	args map[string]any
+	// of object fields
+	typ      string
+	fields   []*gqlPlan
+	location gqlLocation
+}
+
+// turn selections into plans checked against the schema, with fragments spread, directives applied, fields of the
+// same key merged and arguments coerced
+type gqlPlanner struct {
+	doc       *gqlDocument
+	variables map[string]any
+	errors    []gqlError
+	// variables of the operation, using another one is an error
+	declared map[string]bool
+	// fragments being spread, a fragment spreading itself is an error
+	visiting map[string]bool
+}
+
+// first variable of value the operation does not declare
+func (p *gqlPlanner) undeclared(value any) string {
+	switch v := value.(type) {
+	case gqlVariable:
+		if !p.declared[string(v)] {
+			return string(v)
+		}
+	case []any:
+		for _, item := range v {
+			if name := p.undeclared(item); name != "" {
+				return name
+			}
+		}
+	case map[string]any:
+		for _, item := range v {
+			if name := p.undeclared(item); name != "" {
+				return name
+			}
+		}
+	}
+	return ""
+}
+
+func (p *gqlPlanner) fail(location gqlLocation, format string, args ...any) {
+	p.errors = append(p.errors, gqlError{Message: fmt.Sprintf(format, args...), Locations: []gqlLocation{location}})
+}
+
+// plans of the selections on typ added to plans, depth of the selections
+func (p *gqlPlanner) collect(typ string, selections []gqlSelection, plans *[]*gqlPlan, depth int) {
+	for _, selection := range selections {
+		if !p.included(selection) {
+			continue
+		}
+
+		switch {
+		case selection.spread != "":
+			fragment, ok := p.doc.fragments[selection.spread]
+			if !ok {
+				p.fail(selection.location, "Unknown fragment %q", selection.spread)
+				continue
+			}
+			if p.visiting[fragment.name] {
+				p.fail(selection.location, "Cannot spread fragment %q within itself", fragment.name)
+				continue
+			}
+			if fragment.typeCondition != typ {
+				p.fail(selection.location, "Fragment %q cannot be spread here as objects of type %q can never be of type %q", fragment.name, typ, fragment.typeCondition)
+				continue
+			}
+			p.visiting[fragment.name] = true
+			p.collect(typ, fragment.selections, plans, depth)
+			delete(p.visiting, fragment.name)
+		case selection.field == nil:
+			if selection.typeCondition != "" && selection.typeCondition != typ {
+				p.fail(selection.location, "Fragment cannot be spread here as objects of type %q can never be of type %q", typ, selection.typeCondition)
+				continue
+			}
+			p.collect(typ, selection.selections, plans, depth)
+		default:
+			p.collectField(typ, selection, plans, depth)
+		}
+	}
+}
+
+// false for selections skipped by @skip or @include
+func (p *gqlPlanner) included(selection gqlSelection) bool {
+	for _, directive := range selection.directives {
+		if directive.name != "skip" && directive.name != "include" {
+			p.fail(selection.location, "Unknown directive @%s", directive.name)
+			return false
+		}
+		if len(directive.args) != 1 || directive.args[0].name != "if" {
+			p.fail(selection.location, "Directive @%s takes the argument if", directive.name)
+			return false
+		}
+		if name := p.undeclared(directive.args[0].value); name != "" {
+			p.fail(selection.location, "Variable $%s is not defined", name)
+			return false
+		}
+		val, err := coerceInput(directive.args[0].value, "Boolean!", p.variables)
+		if err != nil {
+			p.fail(selection.location, "Argument if of @%s: %s", directive.name, err)
+			return false
+		}
+		if val.(bool) == (directive.name == "skip") {
+			return false
+		}
+	}
+	return true
+}
+
+func (p *gqlPlanner) collectField(typ string, selection gqlSelection, plans *[]*gqlPlan, depth int) {
+	field := selection.field
+	if depth > graphqlMaxDepth {
+		p.fail(selection.location, "Query is nested deeper than %d fields", graphqlMaxDepth)
+		return
+	}
+
+	plan := &gqlPlan{key: field.alias, name: field.name, location: selection.location}
+	if field.name == "__typename" {
+		if len(field.args) > 0 || len(field.selections) > 0 {
+			p.fail(selection.location, "Field \"__typename\" takes no arguments or subfields")
+			return
+		}
+	} else {
+		def, ok := gqlTypes[typ][field.name]
+		if !ok {
+			p.fail(selection.location, "Cannot query field %q on type %q", field.name, typ)
+			return
+		}
+
+		plan.args = map[string]any{}
+		for _, arg := range field.args {
+			argDef, ok := def.args[arg.name]
+			if !ok {
+				p.fail(selection.location, "Unknown argument %q on field \"%s.%s\"", arg.name, typ, field.name)
+				continue
+			}
+			if name := p.undeclared(arg.value); name != "" {
+				p.fail(selection.location, "Variable $%s is not defined", name)
+				continue
+			}
+			val, err := coerceInput(arg.value, argDef.typ, p.variables)
+			if err != nil {
+				p.fail(selection.location, "Argument %q of field \"%s.%s\": %s", arg.name, typ, field.name, err)
+				continue
+			}
+			if val != nil {
+				plan.args[arg.name] = val
+			}
+		}
+		for name, argDef := range def.args {
+			if _, ok := plan.args[name]; ok {
+				continue
+			}
+			if argDef.def != nil {
+				plan.args[name] = argDef.def
+			} else if strings.HasSuffix(argDef.typ, "!") {
+				p.fail(selection.location, "Field \"%s.%s\" argument %q of type %s is required", typ, field.name, name, argDef.typ)
+			}
+		}
+
+		named := gqlNamedType(def.typ)
+		switch {
+		case gqlScalars[named] && len(field.selections) > 0:
+			p.fail(selection.location, "Field %q must not have a selection since type %q has no subfields", field.name, def.typ)
+			return
+		case !gqlScalars[named] && len(field.selections) == 0:
+			p.fail(selection.location, "Field %q of type %q must have a selection of subfields", field.name, def.typ)
+			return
+		case !gqlScalars[named]:
+			plan.typ = named
+		}
+	}
+
+	// fields of the same key are answered once, so they must be the same field
+	for _, existing := range *plans {
+		if existing.key != plan.key {
+			continue
+		}
+		if existing.name != plan.name || !reflect.DeepEqual(existing.args, plan.args) {
+			p.fail(selection.location, "Fields %q conflict because they are different fields or have different arguments, use aliases", plan.key)
+			return
+		}
+		p.collect(plan.typ, field.selections, &existing.fields, depth+1)
+		return
+	}
+
+	p.collect(plan.typ, field.selections, &plan.fields, depth+1)
+	*plans = append(*plans, plan)
+}
+
+// object of a graphql response, its fields in the order of the query
+type gqlObject []gqlEntry
+
+type gqlEntry struct {
+	key   string
+	value any
+}
+
+func (o gqlObject) MarshalJSON() ([]byte, error) {
+	var b bytes.Buffer
+	b.WriteByte('{')
+	for i, entry := range o {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		key, _ := json.Marshal(entry.key)
+		b.Write(key)
+		b.WriteByte(':')
+		value, err := json.Marshal(entry.value)
+		if err != nil {
+			return nil, err
+		}
+		b.Write(value)
+	}
+	b.WriteByte('}')
+	return b.Bytes(), nil
+}
+
+// page of listings of the listing service, of a listings field
+type gqlListingPage struct {
+	listings   []Listing
+	pagination Pagination
+}
+
+// resolve plans one level at a time: the objects of a type are resolved together, so a field of a level is one
+// call whatever the number of objects having it, like a dataloader would batch them
+type gqlExecutor struct {
+	errors []gqlError
+}
+
+// a field failed for the objects at paths, their value is null
+func (e *gqlExecutor) fail(ctx context.Context, plan *gqlPlan, paths [][]any, err error) {
+	slog.ErrorContext(ctx, "usecase error", "code", "516", "error", err, "field", plan.name)
+
+	// messages of domain errors are safe for clients
+	message := "Failed to resolve " + plan.name
+	var appErr *apperror.Error
+	if errors.As(err, &appErr) {
+		message = appErr.Message
+	}
+	for _, path := range paths {
+		e.errors = append(e.errors, gqlError{Message: message, Locations: []gqlLocation{plan.location}, Path: gqlPath(path, plan.key)})
+	}
+}
+
+func gqlPath(path []any, key any) []any {
+	return append(append(make([]any, 0, len(path)+1), path...), key)
+}
+
+// objects of typ with the fields of plans, nil objects are null
+func (e *gqlExecutor) resolve(ctx context.Context, typ string, objects []any, paths [][]any, plans []*gqlPlan) []*gqlObject {
+	results := make([]*gqlObject, len(objects))
+	var live []any
+	var livePaths [][]any
+	var index []int
+	for i, object := range objects {
+		if object == nil && typ != "Query" {
+			continue
+		}
+		results[i] = &gqlObject{}
+		live = append(live, object)
+		livePaths = append(livePaths, paths[i])
+		index = append(index, i)
+	}
+	if len(live) == 0 {
+		return results
+	}
+
+	for _, plan := range plans {
+		values, err := e.field(ctx, typ, plan, live, livePaths)
+		if err != nil {
+			e.fail(ctx, plan, livePaths, err)
+			values = make([]any, len(live))
+		}
+		for i, value := range values {
+			*results[index[i]] = append(*results[index[i]], gqlEntry{plan.key, value})
+		}
+	}
+	return results
+}
+
+// value of the field of plan for each of objects
+func (e *gqlExecutor) field(ctx context.Context, typ string, plan *gqlPlan, objects []any, paths [][]any) ([]any, error) {
+	values := make([]any, len(objects))
+	if plan.name == "__typename" {
+		for i := range values {
+			values[i] = typ
+		}
+		return values, nil
+	}
+
+	switch typ {
+	case "Query":
+		return e.queryField(ctx, plan, paths[0])
+	case "Listing":
+		if plan.name == "user" {
+			return e.listingUsers(ctx, plan, objects, paths)
+		}
+		if plan.name == "images" {
+			return e.listingImages(ctx, plan, objects, paths)
+		}
+		if plan.name == "video_url" {
+			expires := mediaURLExpiry(time.Now())
+			for i, object := range objects {
+				if videoURL := object.(*Listing).VideoURL; videoURL != "" {
+					values[i] = signMediaURL(ctx, videoURL, expires)
+				} else {
+					values[i] = nil
+				}
+			}
+			return values, nil
+		}
+		for i, object := range objects {
+			values[i] = listingField(object.(*Listing), plan.name)
+		}
+	case "Image":
+		for i, object := range objects {
+			values[i] = imageField(object.(*Media), plan.name)
+		}
+	case "User":
+		if plan.name == "listings" {
+			return e.userListings(ctx, plan, objects, paths)
+		}
+		for i, object := range objects {
+			values[i] = userField(object.(*User), plan.name)
+		}
+	case "ListingPage":
+		if plan.name == "pagination" {
+			pages := make([]any, len(objects))
+			for i, object := range objects {
+				pages[i] = &object.(*gqlListingPage).pagination
+			}
+			return objectValues(e.resolve(ctx, "Pagination", pages, fieldPaths(paths, plan.key), plan.fields)), nil
+		}
+		return e.pageListings(ctx, plan, objects, paths)
+	case "Pagination":
+		for i, object := range objects {
+			values[i] = paginationField(object.(*Pagination), plan.name)
+		}
+	}
+	return values, nil
+}
+
+func fieldPaths(paths [][]any, key string) [][]any {
+	out := make([][]any, len(paths))
+	for i, path := range paths {
+		out[i] = gqlPath(path, key)
+	}
+	return out
+}
+
+func objectValues(objects []*gqlObject) []any {
+	values := make([]any, len(objects))
+	for i, object := range objects {
+		if object != nil {
+			values[i] = object
+		}
+	}
+	return values
+}
+
+// root fields, each resolved on its own
+func (e *gqlExecutor) queryField(ctx context.Context, plan *gqlPlan, path []any) ([]any, error) {
+	fieldPath := [][]any{gqlPath(path, plan.key)}
+
+	switch plan.name {
+	case "listing":
+		listing, _, err := readListingUsecase(ctx, plan.args["id"].(int))
+		if errors.Is(err, errListingNotFound) {
+			return []any{nil}, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		return objectValues(e.resolve(ctx, "Listing", []any{listing}, fieldPath, plan.fields)), nil
+	case "listings":
+		pageNum, pageSize := plan.args["page_num"].(int), plan.args["page_size"].(int)
+		if err := checkGraphQLPage(pageNum, pageSize); err != nil {
+			return nil, err
+		}
+		sortBy, _ := plan.args["sort_by"].(string)
+		sortDir, _ := plan.args["sort_dir"].(string)
+		if (sortBy != "" && !listingSortColumns[sortBy]) || (sortDir != "" && sortDir != "asc" && sortDir != "desc") {
+			return nil, errInvalidSort
+		}
+		var userID string
+		if id, ok := plan.args["user_id"].(int); ok {
+			userID = strconv.Itoa(id)
+		}
+		region, _ := plan.args["region"].(string)
+
+		res, err := findListingsService(ctx, userID, region, pageNum, pageSize, sortBy, sortDir)
+		if err != nil {
+			return nil, err
+		}
+		page := &gqlListingPage{listings: res.Listings, pagination: res.Pagination}
+		return objectValues(e.resolve(ctx, "ListingPage", []any{page}, fieldPath, plan.fields)), nil
+	case "user":
+		res, err := findUserByIDService(ctx, plan.args["id"].(int))
+		if errors.Is(err, ErrUserNotFound) {
+			return []any{nil}, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		return objectValues(e.resolve(ctx, "User", []any{&res.User}, fieldPath, plan.fields)), nil
+	case "users":
+		ids := plan.args["ids"].([]any)
+		if len(ids) > graphqlMaxPageSize {
+			return nil, errGraphQLIDs
+		}
+		userIDs := make([]int, len(ids))
+		for i, id := range ids {
+			userIDs[i] = id.(int)
+		}
+		users, err := fetchUsersByIDs(ctx, uniqueInts(userIDs))
+		if err != nil {
+			return nil, err
+		}
+
+		objects := make([]any, len(userIDs))
+		paths := make([][]any, len(userIDs))
+		for i, id := range userIDs {
+			if user, ok := users[id]; ok {
+				objects[i] = &user
+			}
+			paths[i] = gqlPath(fieldPath[0], i)
+		}
+		return []any{objectValues(e.resolve(ctx, "User", objects, paths, plan.fields))}, nil
+	}
+	return []any{nil}, nil
+}
+
+var (
+	errGraphQLPage = apperror.Validation("page_num must be at least 1 and page_size 1 to 100")
+	errGraphQLIDs  = apperror.Validation(fmt.Sprintf("ids must have at most %d ids", graphqlMaxPageSize))
+)
+
+func checkGraphQLPage(pageNum, pageSize int) error {
+	if pageNum < 1 || pageSize < 1 || pageSize > graphqlMaxPageSize {
+		return errGraphQLPage
+	}
+	return nil
+}
+
+// users of the listings in one batch, a user that is deleted or missing keeps only its id as in get listings
+func (e *gqlExecutor) listingUsers(ctx context.Context, plan *gqlPlan, objects []any, paths [][]any) ([]any, error) {
+	userIDs := make([]int, len(objects))
+	for i, object := range objects {
+		userIDs[i] = object.(*Listing).UserID
+	}
+
+	users, err := fetchUsersByIDs(ctx, uniqueInts(userIDs))
+	if err != nil {
+		return nil, err
+	}
+
+	owners := make([]any, len(objects))
+	for i, id := range userIDs {
+		user, ok := users[id]
+		if !ok {
+			user = User{ID: id}
+		}
+		owners[i] = &user
+	}
+	return objectValues(e.resolve(ctx, "User", owners, fieldPaths(paths, plan.key), plan.fields)), nil
+}
+
+// photos of the listings, as images of get listings
+// images at the w and h args, copied so every selection of images gets its own urls
+func (e *gqlExecutor) listingImages(ctx context.Context, plan *gqlPlan, objects []any, paths [][]any) ([]any, error) {
+	var variant mediaVariant
+	variant.width, _ = plan.args["w"].(int)
+	variant.height, _ = plan.args["h"].(int)
+	if variant.width < 0 || variant.height < 0 {
+		return nil, errMediaVariant
+	}
+
+	expires := mediaURLExpiry(time.Now())
+	values := make([]any, len(objects))
+	for i, object := range objects {
+		images := slices.Clone(object.(*Listing).Images)
+		items := make([]any, len(images))
+		itemPaths := make([][]any, len(images))
+		for j := range images {
+			transformMedia(ctx, &images[j], variant, expires)
+			items[j] = &images[j]
+			itemPaths[j] = gqlPath(gqlPath(paths[i], plan.key), j)
+		}
+		values[i] = objectValues(e.resolve(ctx, "Image", items, itemPaths, plan.fields))
+	}
+	return values, nil
+}
+
+// one page of listings per user, fetched GRAPHQL_FETCH_CONCURRENCY at a time. The listings of every page are then
+// resolved together
+func (e *gqlExecutor) userListings(ctx context.Context, plan *gqlPlan, objects []any, paths [][]any) ([]any, error) {
+	pageNum, pageSize := plan.args["page_num"].(int), plan.args["page_size"].(int)
+	if err := checkGraphQLPage(pageNum, pageSize); err != nil {
+		return nil, err
+	}
+	sortBy, _ := plan.args["sort_by"].(string)
+	sortDir, _ := plan.args["sort_dir"].(string)
+	if (sortBy != "" && !listingSortColumns[sortBy]) || (sortDir != "" && sortDir != "asc" && sortDir != "desc") {
+		return nil, errInvalidSort
+	}
+
+	userIDs := make([]int, len(objects))
+	for i, object := range objects {
+		userIDs[i] = object.(*User).ID
+	}
+	unique := uniqueInts(userIDs)
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var (
+		mu       sync.Mutex
+		wg       sync.WaitGroup
+		firstErr error
+		pages    = make(map[int]*gqlListingPage, len(unique))
+		queue    = make(chan int)
+	)
+	for i := 0; i < min(max(graphqlFetchConcurrency, 1), len(unique)); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for id := range queue {
+				res, err := findListingsService(ctx, strconv.Itoa(id), "", pageNum, pageSize, sortBy, sortDir)
+
+				mu.Lock()
+				if err != nil && firstErr == nil {
+					firstErr = err
+					cancel()
+				}
+				if err == nil {
+					pages[id] = &gqlListingPage{listings: res.Listings, pagination: res.Pagination}
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+
+	// stop queueing users once a fetch failed
+feed:
+	for _, id := range unique {
+		select {
+		case queue <- id:
+		case <-ctx.Done():
+			break feed
+		}
+	}
+	close(queue)
+	wg.Wait()
+
+	if firstErr != nil {
+		return nil, firstErr
+	}
+
+	items := make([]any, len(objects))
+	for i, id := range userIDs {
+		items[i] = pages[id]
+	}
+	return objectValues(e.resolve(ctx, "ListingPage", items, fieldPaths(paths, plan.key), plan.fields)), nil
+}
+
+// listings of every page resolved at once, so their users are fetched in one batch
+func (e *gqlExecutor) pageListings(ctx context.Context, plan *gqlPlan, objects []any, paths [][]any) ([]any, error) {
+	var listings []any
+	var listingPaths [][]any
+	for i, object := range objects {
+		page := object.(*gqlListingPage)
+		for j := range page.listings {
+			listings = append(listings, &page.listings[j])
+			listingPaths = append(listingPaths, gqlPath(gqlPath(paths[i], plan.key), j))
+		}
+	}
+	resolved := objectValues(e.resolve(ctx, "Listing", listings, listingPaths, plan.fields))
+
+	values := make([]any, len(objects))
+	for i, object := range objects {
+		n := len(object.(*gqlListingPage).listings)
+		values[i] = resolved[:n:n]
+		resolved = resolved[n:]
+	}
+	return values, nil
+}
+
+func listingField(listing *Listing, name string) any {
+	switch name {
+	case "id":
+		return listing.ID
+	case "user_id":
+		return listing.UserID
+	case "listing_type":
+		return listing.ListingType
+	case "price":
+		return listing.Price
+	case "currency":
+		return listing.Currency
+	case "region":
+		return nullString(listing.Region)
+	case "area":
+		if listing.Area == 0 {
+			return nil
+		}
+		return listing.Area
+	case "video_url":
+		return nullString(listing.VideoURL)
+	case "quality_score":
+		return listing.QualityScore
+	case "created_at":
+		return listing.CreatedAt
+	case "updated_at":
+		return listing.UpdatedAt
+	}
+	return nil
+}
+
+func imageField(image *Media, name string) any {
+	switch name {
+	case "id":
+		return image.ID
+	case "url":
+		return image.URL
+	case "content_type":
+		return image.ContentType
+	case "width":
+		return image.Width
+	case "height":
+		return image.Height
+	case "position":
+		return image.Position
+	case "is_primary":
+		return image.IsPrimary
+	}
+	return nil
+}
+
+// deleted users keep only their id
+func userField(user *User, name string) any {
+	if name == "id" {
+		return user.ID
+	}
+	if user.CreatedAt == 0 {
+		return nil
+	}
+
+	switch name {
+	case "name":
+		return user.Name
+	case "created_at":
+		return user.CreatedAt
+	case "updated_at":
+		return user.UpdatedAt
+	}
+	return nil
+}
+
+func paginationField(pagination *Pagination, name string) any {
+	switch name {
+	case "page_num":
+		return pagination.PageNum
+	case "page_size":
+		return pagination.PageSize
+	case "total_items":
+		return pagination.TotalItems
+	case "total_pages":
+		return pagination.TotalPages
+	case "has_next":
+		return pagination.HasNext
+	}
+	return nil
+}
+
+func nullString(value string) any {
+	if value == "" {
+		return nil
+	}
+	return value
+}
+
+// ids without duplicates, in ascending order
+func uniqueInts(ids []int) []int {
+	seen := make(map[int]bool, len(ids))
+	var unique []int
+	for _, id := range ids {
+		if !seen[id] {
+			seen[id] = true
+			unique = append(unique, id)
+		}
+	}
+	sort.Ints(unique)
+	return unique
+}
@@ -0,0 +1,187 @@
+package publicapi
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// listings of users, recording the users whose listings were fetched
+type graphqlListingClient struct {
+	ListingClient
+	mu       sync.Mutex
+	listings []Listing
+	calls    []string
+}
+
+func (c *graphqlListingClient) FetchListings(ctx context.Context, userID, region string, pageNum, pageSize int, sortBy, sortDir string) (*ListingsResponse, error) {
+	c.mu.Lock()
+	c.calls = append(c.calls, userID)
+	c.mu.Unlock()
+
+	res := &ListingsResponse{Result: true, Listings: []Listing{}}
+	for _, listing := range c.listings {
+		if userID == "" || strconv.Itoa(listing.UserID) == userID {
+			res.Listings = append(res.Listings, listing)
+		}
+	}
+	res.Pagination = Pagination{PageNum: pageNum, PageSize: pageSize, TotalItems: len(res.Listings), TotalPages: 1}
+	return res, nil
+}
+
+func serveGraphQL(t *testing.T, body string) (int, map[string]any) {
+	t.Helper()
+	router := gin.New()
+	router.POST("/public-api/graphql", graphqlHandler)
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/public-api/graphql", strings.NewReader(body)))
+
+	var res map[string]any
+	if err := json.Unmarshal(w.Body.Bytes(), &res); err != nil {
+		t.Fatalf("body %s: %v", w.Body, err)
+	}
+	return w.Code, res
+}
+
+func TestGraphQLBatching(t *testing.T) {
+	users := &cacheUserClient{users: map[int]User{1: {ID: 1, Name: "Alice", CreatedAt: 1}, 2: {ID: 2, Name: "Bob", CreatedAt: 1}}}
+	listings := &graphqlListingClient{listings: []Listing{
+		{ID: 10, UserID: 1, ListingType: "rent", Price: 100},
+		{ID: 11, UserID: 2, ListingType: "sale", Price: 200},
+		{ID: 12, UserID: 1, ListingType: "sale", Price: 300},
+	}}
+
+	previousUsers, previousListings, previousCache := userClient, listingClient, cachedUsers
+	userClient, listingClient, cachedUsers = users, listings, newUserCache(10, time.Minute)
+	defer func() { userClient, listingClient, cachedUsers = previousUsers, previousListings, previousCache }()
+
+	query := `query Owners($size: Int) {
+		listings(page_size: $size) {
+			listings { id ...owner }
+			pagination { total_items }
+		}
+	}
+	fragment owner on Listing { user { name listings { listings { id price } } } }`
+	body, _ := json.Marshal(graphqlRequest{Query: query, Variables: map[string]any{"size": 20}})
+	status, res := serveGraphQL(t, string(body))
+	if status != http.StatusOK || res["errors"] != nil {
+		t.Fatalf("status %d %v", status, res)
+	}
+
+	got, _ := json.Marshal(res["data"])
+	want := `{"listings":{"listings":[` +
+		`{"id":10,"user":{"listings":{"listings":[{"id":10,"price":100},{"id":12,"price":300}]},"name":"Alice"}},` +
+		`{"id":11,"user":{"listings":{"listings":[{"id":11,"price":200}]},"name":"Bob"}},` +
+		`{"id":12,"user":{"listings":{"listings":[{"id":10,"price":100},{"id":12,"price":300}]},"name":"Alice"}}` +
+		`],"pagination":{"total_items":3}}}`
+	if string(got) != want {
+		t.Errorf("data %s\nwant %s", got, want)
+	}
+
+	if want := [][]int{{1, 2}}; !reflect.DeepEqual(users.fetched, want) {
+		t.Errorf("users fetched %v, want one batch %v", users.fetched, want)
+	}
+	sort.Strings(listings.calls)
+	if want := []string{"", "1", "2"}; !reflect.DeepEqual(listings.calls, want) {
+		t.Errorf("listings fetched for %q, want one page per distinct user %q", listings.calls, want)
+	}
+}
+
+func TestGraphQLOrderedFields(t *testing.T) {
+	previousUsers, previousCache := userClient, cachedUsers
+	userClient, cachedUsers = &cacheUserClient{users: map[int]User{2: {ID: 2, Name: "Bob", CreatedAt: 1}}}, newUserCache(10, time.Minute)
+	defer func() { userClient, cachedUsers = previousUsers, previousCache }()
+
+	status, res := serveGraphQL(t, `{"query":"{ people: users(ids: [2, 3]) { name __typename id } }"}`)
+	if status != http.StatusOK {
+		t.Fatalf("status %d %v", status, res)
+	}
+	data, _ := json.Marshal(res["data"])
+	if want := `{"people":[{"__typename":"User","id":2,"name":"Bob"},null]}`; string(data) != want {
+		t.Errorf("data %s, want %s", data, want)
+	}
+
+	// the order of the query is kept in the body
+	ordered, _, _ := executeGraphQLUsecase(context.Background(), graphqlRequest{Query: "{ users(ids: 2) { name __typename id } }"})
+	got, _ := json.Marshal(ordered)
+	if want := `{"users":[{"name":"Bob","__typename":"User","id":2}]}`; string(got) != want {
+		t.Errorf("ordered data %s, want %s", got, want)
+	}
+}
+
+func TestGraphQLInvalidQueries(t *testing.T) {
+	for _, tc := range []struct {
+		body, want string
+	}{
+		{`{}`, "body must be a JSON object with a query"},
+		{`{"query":"{ listings { "}`, "Syntax Error"},
+		{`{"query":"mutation { listings { pagination { page_num } } }"}`, "Only query operations are supported"},
+		{`{"query":"query A { user(id: 1) { id } } query B { user(id: 2) { id } }"}`, "Must provide operationName"},
+		{`{"query":"{ user(id: 1) { email } }"}`, "Cannot query field \"email\" on type \"User\""},
+		{`{"query":"{ user { id } }"}`, "argument \"id\" of type Int! is required"},
+		{`{"query":"{ user(id: \"1\") { id } }"}`, "expected Int"},
+		{`{"query":"{ user(id: 1) }"}`, "must have a selection of subfields"},
+		{`{"query":"{ user(id: 1) { id { x } } }"}`, "must not have a selection"},
+		{`{"query":"{ user(id: $id) { id } }"}`, "Variable $id is not defined"},
+		{`{"query":"query($id: Int!) { user(id: $id) { id } }"}`, "Variable $id of required type Int! was not provided"},
+		{`{"query":"{ a: user(id: 1) { id } a: user(id: 2) { id } }"}`, "Fields \"a\" conflict"},
+		{`{"query":"{ user(id: 1) { ...f } } fragment f on User { ...f }"}`, "Cannot spread fragment \"f\" within itself"},
+		{`{"query":"{ user(id: 1) { ...f } } fragment f on Listing { id }"}`, "can never be of type \"Listing\""},
+		{`{"query":"{ user(id: 1) { id @defer } }"}`, "Unknown directive @defer"},
+		{`{"query":"{ user(id: 1) { listings { listings { user { listings { listings { user { listings { listings { id } } } } } } } } } }"}`, "nested deeper than 8"},
+	} {
+		status, res := serveGraphQL(t, tc.body)
+		errs, _ := res["errors"].([]any)
+		var message string
+		if len(errs) > 0 {
+			message, _ = errs[0].(map[string]any)["message"].(string)
+		}
+		if status != http.StatusBadRequest || res["data"] != nil || !strings.Contains(message, tc.want) {
+			t.Errorf("%s: %d %v, want 400 with %q", tc.body, status, res, tc.want)
+		}
+	}
+}
+
+func TestGraphQLDirectives(t *testing.T) {
+	previousUsers, previousCache := userClient, cachedUsers
+	userClient, cachedUsers = &cacheUserClient{users: map[int]User{1: {ID: 1, Name: "Alice", CreatedAt: 1}}}, newUserCache(10, time.Minute)
+	defer func() { userClient, cachedUsers = previousUsers, previousCache }()
+
+	body, _ := json.Marshal(graphqlRequest{
+		Query:     `query($brief: Boolean!) { user(id: 1) { id name @skip(if: $brief) ... @include(if: $brief) { created_at } } }`,
+		Variables: map[string]any{"brief": true},
+	})
+	_, res := serveGraphQL(t, string(body))
+	data, _ := json.Marshal(res["data"])
+	if want := `{"user":{"created_at":1,"id":1}}`; string(data) != want {
+		t.Errorf("data %s, want %s", data, want)
+	}
+}
+
+func TestGraphQLFieldErrors(t *testing.T) {
+	previousUsers, previousListings, previousCache := userClient, listingClient, cachedUsers
+	userClient, cachedUsers = &cacheUserClient{users: map[int]User{1: {ID: 1, Name: "Alice", CreatedAt: 1}}}, newUserCache(10, time.Minute)
+	listingClient = &graphqlListingClient{}
+	defer func() { userClient, listingClient, cachedUsers = previousUsers, previousListings, previousCache }()
+
+	status, res := serveGraphQL(t, `{"query":"{ user(id: 1) { name listings(page_size: 500) { pagination { page_num } } } }"}`)
+	if status != http.StatusOK {
+		t.Fatalf("status %d %v", status, res)
+	}
+	body, _ := json.Marshal(res)
+	want := `{"data":{"user":{"listings":null,"name":"Alice"}},"errors":[{"locations":[{"column":22,"line":1}],"message":"page_num must be at least 1 and page_size 1 to 100","path":["user","listings"]}]}`
+	if string(body) != want {
+		t.Errorf("body %s\nwant %s", body, want)
+	}
+}
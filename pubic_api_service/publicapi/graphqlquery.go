@@ -0,0 +1,613 @@
+package publicapi
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// =========== INTERFACE HANDLER, GRAPHQL QUERY DOCUMENTS ===========
+
+// query document of a graphql request, executable definitions only
+type gqlDocument struct {
+	operations []*gqlOperation
+	fragments  map[string]*gqlFragment
+}
+
+type gqlOperation struct {
+	// query, mutation or subscription
+	kind       string
+	name       string
+	variables  []gqlVariableDef
+	selections []gqlSelection
+}
+
+type gqlVariableDef struct {
+	name string
+	// type reference as written, e.g. [Int!]!
+	typ    string
+	def    any
+	hasDef bool
+}
+
+type gqlFragment struct {
+	name          string
+	typeCondition string
+	selections    []gqlSelection
+}
+
+// field, fragment spread or inline fragment
+type gqlSelection struct {
+	field *gqlFieldNode
+	// name of the spread fragment
+	spread string
+	// type condition and selections of an inline fragment
+	typeCondition string
+	selections    []gqlSelection
+	directives    []gqlArgumentsNode
+	location      gqlLocation
+}
+
+type gqlFieldNode struct {
+	alias      string
+	name       string
+	args       []gqlArgument
+	selections []gqlSelection
+}
+
+// directive, or any other name with arguments
+type gqlArgumentsNode struct {
+	name string
+	args []gqlArgument
+}
+
+type gqlArgument struct {
+	name  string
+	value any
+}
+
+// value of an argument naming a variable of the operation
+type gqlVariable string
+
+// enum value of an argument, an unquoted name
+type gqlEnum string
+
+// error of a graphql response, with the position in the query it is about or the path of the field it failed
+type gqlError struct {
+	Message   string        `json:"message"`
+	Locations []gqlLocation `json:"locations,omitempty"`
+	Path      []any         `json:"path,omitempty"`
+}
+
+type gqlLocation struct {
+	Line   int `json:"line"`
+	Column int `json:"column"`
+}
+
+func (e *gqlError) Error() string {
+	return e.Message
+}
+
+const (
+	gqlTokenEOF = iota
+	gqlTokenPunct
+	gqlTokenName
+	gqlTokenInt
+	gqlTokenFloat
+	gqlTokenString
+)
+
+type gqlToken struct {
+	kind     int
+	value    string
+	location gqlLocation
+}
+
+// tokens of src, commas, white space and comments left out
+func gqlTokenize(src string) ([]gqlToken, error) {
+	var tokens []gqlToken
+	line, lineStart := 1, 0
+
+	for pos := 0; pos < len(src); {
+		location := gqlLocation{Line: line, Column: pos - lineStart + 1}
+		ch := src[pos]
+		switch {
+		case ch == '\n':
+			pos++
+			line, lineStart = line+1, pos
+		case ch == ' ' || ch == '\t' || ch == '\r' || ch == ',':
+			pos++
+		case strings.HasPrefix(src[pos:], "\ufeff"):
+			pos += len("\ufeff")
+		case ch == '#':
+			for pos < len(src) && src[pos] != '\n' {
+				pos++
+			}
+		case strings.HasPrefix(src[pos:], "..."):
+			tokens = append(tokens, gqlToken{gqlTokenPunct, "...", location})
+			pos += 3
+		case strings.IndexByte("!$&():=@[]{}|", ch) >= 0:
+			tokens = append(tokens, gqlToken{gqlTokenPunct, string(ch), location})
+			pos++
+		case ch == '_' || isLetter(ch):
+			start := pos
+			for pos < len(src) && (src[pos] == '_' || isLetter(src[pos]) || isDigit(src[pos])) {
+				pos++
+			}
+			tokens = append(tokens, gqlToken{gqlTokenName, src[start:pos], location})
+		case ch == '-' || isDigit(ch):
+			start, kind := pos, gqlTokenInt
+			if ch == '-' {
+				pos++
+			}
+			digits := pos
+			for pos < len(src) && isDigit(src[pos]) {
+				pos++
+			}
+			if pos == digits {
+				return nil, gqlSyntaxError(location, "Invalid number, expected digit")
+			}
+			if pos < len(src) && src[pos] == '.' {
+				kind = gqlTokenFloat
+				pos++
+				for pos < len(src) && isDigit(src[pos]) {
+					pos++
+				}
+			}
+			if pos < len(src) && (src[pos] == 'e' || src[pos] == 'E') {
+				kind = gqlTokenFloat
+				pos++
+				if pos < len(src) && (src[pos] == '+' || src[pos] == '-') {
+					pos++
+				}
+				for pos < len(src) && isDigit(src[pos]) {
+					pos++
+				}
+			}
+			tokens = append(tokens, gqlToken{kind, src[start:pos], location})
+		case strings.HasPrefix(src[pos:], `"""`):
+			end := strings.Index(src[pos+3:], `"""`)
+			if end < 0 {
+				return nil, gqlSyntaxError(location, "Unterminated string")
+			}
+			raw := src[pos+3 : pos+3+end]
+			line += strings.Count(raw, "\n")
+			if i := strings.LastIndexByte(raw, '\n'); i >= 0 {
+				lineStart = pos + 3 + i + 1
+			}
+			tokens = append(tokens, gqlToken{gqlTokenString, strings.TrimSpace(raw), location})
+			pos += 3 + end + 3
+		case ch == '"':
+			value, n, err := gqlUnquote(src[pos:])
+			if err != nil {
+				return nil, gqlSyntaxError(location, err.Error())
+			}
+			tokens = append(tokens, gqlToken{gqlTokenString, value, location})
+			pos += n
+		default:
+			r, _ := utf8.DecodeRuneInString(src[pos:])
+			return nil, gqlSyntaxError(location, fmt.Sprintf("Unexpected character %q", r))
+		}
+	}
+
+	return append(tokens, gqlToken{kind: gqlTokenEOF, location: gqlLocation{Line: line, Column: len(src) - lineStart + 1}}), nil
+}
+
+// value of the quoted string at the start of src and its length with the quotes
+func gqlUnquote(src string) (string, int, error) {
+	var b strings.Builder
+	for pos := 1; pos < len(src); {
+		switch ch := src[pos]; {
+		case ch == '"':
+			return b.String(), pos + 1, nil
+		case ch == '\n' || ch == '\r':
+			return "", 0, fmt.Errorf("Unterminated string")
+		case ch == '\\' && pos+1 < len(src):
+			escape := src[pos+1]
+			if escape == 'u' {
+				if pos+6 > len(src) {
+					return "", 0, fmt.Errorf("Invalid unicode escape")
+				}
+				code, err := strconv.ParseUint(src[pos+2:pos+6], 16, 16)
+				if err != nil {
+					return "", 0, fmt.Errorf("Invalid unicode escape")
+				}
+				b.WriteRune(rune(code))
+				pos += 6
+				continue
+			}
+			replacement, ok := map[byte]string{'"': `"`, '\\': `\`, '/': "/", 'b': "\b", 'f': "\f", 'n': "\n", 'r': "\r", 't': "\t"}[escape]
+			if !ok {
+				return "", 0, fmt.Errorf("Invalid escape \\%c", escape)
+			}
+			b.WriteString(replacement)
+			pos += 2
+		default:
+			b.WriteByte(ch)
+			pos++
+		}
+	}
+	return "", 0, fmt.Errorf("Unterminated string")
+}
+
+func isLetter(ch byte) bool {
+	return ch >= 'a' && ch <= 'z' || ch >= 'A' && ch <= 'Z'
+}
+
+func isDigit(ch byte) bool {
+	return ch >= '0' && ch <= '9'
+}
+
+func gqlSyntaxError(location gqlLocation, message string) *gqlError {
+	return &gqlError{Message: "Syntax Error: " + message, Locations: []gqlLocation{location}}
+}
+
+type gqlParser struct {
+	tokens []gqlToken
+	pos    int
+}
+
+// parse the query document src
+func parseGraphQL(src string) (*gqlDocument, error) {
+	tokens, err := gqlTokenize(src)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &gqlParser{tokens: tokens}
+	doc := &gqlDocument{fragments: map[string]*gqlFragment{}}
+	for p.peek().kind != gqlTokenEOF {
+		token := p.peek()
+		switch {
+		case token.kind == gqlTokenPunct && token.value == "{":
+			selections, err := p.selectionSet()
+			if err != nil {
+				return nil, err
+			}
+			doc.operations = append(doc.operations, &gqlOperation{kind: "query", selections: selections})
+		case token.kind == gqlTokenName && (token.value == "query" || token.value == "mutation" || token.value == "subscription"):
+			operation, err := p.operation()
+			if err != nil {
+				return nil, err
+			}
+			doc.operations = append(doc.operations, operation)
+		case token.kind == gqlTokenName && token.value == "fragment":
+			fragment, err := p.fragment()
+			if err != nil {
+				return nil, err
+			}
+			if _, ok := doc.fragments[fragment.name]; ok {
+				return nil, &gqlError{Message: fmt.Sprintf("There can be only one fragment named %q", fragment.name), Locations: []gqlLocation{token.location}}
+			}
+			doc.fragments[fragment.name] = fragment
+		default:
+			return nil, p.unexpected()
+		}
+	}
+
+	if len(doc.operations) == 0 {
+		return nil, &gqlError{Message: "Document has no operation"}
+	}
+	return doc, nil
+}
+
+func (p *gqlParser) peek() gqlToken {
+	return p.tokens[p.pos]
+}
+
+func (p *gqlParser) next() gqlToken {
+	token := p.tokens[p.pos]
+	if token.kind != gqlTokenEOF {
+		p.pos++
+	}
+	return token
+}
+
+// skip the punctuator punct when it comes next
+func (p *gqlParser) skip(punct string) bool {
+	if token := p.peek(); token.kind == gqlTokenPunct && token.value == punct {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *gqlParser) expect(punct string) error {
+	if !p.skip(punct) {
+		return p.unexpected()
+	}
+	return nil
+}
+
+func (p *gqlParser) name() (string, error) {
+	if p.peek().kind != gqlTokenName {
+		return "", p.unexpected()
+	}
+	return p.next().value, nil
+}
+
+func (p *gqlParser) unexpected() error {
+	token := p.peek()
+	if token.kind == gqlTokenEOF {
+		return gqlSyntaxError(token.location, "Unexpected <EOF>")
+	}
+	return gqlSyntaxError(token.location, fmt.Sprintf("Unexpected %q", token.value))
+}
+
+func (p *gqlParser) operation() (*gqlOperation, error) {
+	operation := &gqlOperation{kind: p.next().value}
+	if p.peek().kind == gqlTokenName {
+		operation.name = p.next().value
+	}
+
+	if p.skip("(") {
+		for !p.skip(")") {
+			if err := p.expect("$"); err != nil {
+				return nil, err
+			}
+			name, err := p.name()
+			if err != nil {
+				return nil, err
+			}
+			if err := p.expect(":"); err != nil {
+				return nil, err
+			}
+			typ, err := p.typeRef()
+			if err != nil {
+				return nil, err
+			}
+			variable := gqlVariableDef{name: name, typ: typ}
+			if p.skip("=") {
+				if variable.def, err = p.value(true); err != nil {
+					return nil, err
+				}
+				variable.hasDef = true
+			}
+			operation.variables = append(operation.variables, variable)
+		}
+	}
+
+	if _, err := p.directives(); err != nil {
+		return nil, err
+	}
+	selections, err := p.selectionSet()
+	if err != nil {
+		return nil, err
+	}
+	operation.selections = selections
+	return operation, nil
+}
+
+func (p *gqlParser) fragment() (*gqlFragment, error) {
+	p.next()
+	name, err := p.name()
+	if err != nil {
+		return nil, err
+	}
+	if name == "on" {
+		return nil, p.unexpected()
+	}
+	if on, err := p.name(); err != nil || on != "on" {
+		return nil, gqlSyntaxError(p.tokens[p.pos-1].location, "Expected \"on\"")
+	}
+	typeCondition, err := p.name()
+	if err != nil {
+		return nil, err
+	}
+	if _, err := p.directives(); err != nil {
+		return nil, err
+	}
+	selections, err := p.selectionSet()
+	if err != nil {
+		return nil, err
+	}
+	return &gqlFragment{name: name, typeCondition: typeCondition, selections: selections}, nil
+}
+
+// type reference as written, [Int!]!
+func (p *gqlParser) typeRef() (string, error) {
+	var typ string
+	if p.skip("[") {
+		inner, err := p.typeRef()
+		if err != nil {
+			return "", err
+		}
+		if err := p.expect("]"); err != nil {
+			return "", err
+		}
+		typ = "[" + inner + "]"
+	} else {
+		name, err := p.name()
+		if err != nil {
+			return "", err
+		}
+		typ = name
+	}
+
+	if p.skip("!") {
+		typ += "!"
+	}
+	return typ, nil
+}
+
+func (p *gqlParser) selectionSet() ([]gqlSelection, error) {
+	if err := p.expect("{"); err != nil {
+		return nil, err
+	}
+
+	var selections []gqlSelection
+	for !p.skip("}") {
+		selection, err := p.selection()
+		if err != nil {
+			return nil, err
+		}
+		selections = append(selections, selection)
+	}
+	if len(selections) == 0 {
+		return nil, gqlSyntaxError(p.tokens[p.pos-1].location, "Expected Name, found \"}\"")
+	}
+	return selections, nil
+}
+
+func (p *gqlParser) selection() (gqlSelection, error) {
+	location := p.peek().location
+	if p.skip("...") {
+		selection := gqlSelection{location: location}
+		if token := p.peek(); token.kind == gqlTokenName && token.value != "on" {
+			selection.spread = p.next().value
+			directives, err := p.directives()
+			selection.directives = directives
+			return selection, err
+		}
+
+		if token := p.peek(); token.kind == gqlTokenName && token.value == "on" {
+			p.next()
+			typeCondition, err := p.name()
+			if err != nil {
+				return selection, err
+			}
+			selection.typeCondition = typeCondition
+		}
+		directives, err := p.directives()
+		if err != nil {
+			return selection, err
+		}
+		selection.directives = directives
+		selection.selections, err = p.selectionSet()
+		return selection, err
+	}
+
+	name, err := p.name()
+	if err != nil {
+		return gqlSelection{}, err
+	}
+	field := &gqlFieldNode{alias: name, name: name}
+	if p.skip(":") {
+		if field.name, err = p.name(); err != nil {
+			return gqlSelection{}, err
+		}
+	}
+	if field.args, err = p.arguments(); err != nil {
+		return gqlSelection{}, err
+	}
+	directives, err := p.directives()
+	if err != nil {
+		return gqlSelection{}, err
+	}
+	if token := p.peek(); token.kind == gqlTokenPunct && token.value == "{" {
+		if field.selections, err = p.selectionSet(); err != nil {
+			return gqlSelection{}, err
+		}
+	}
+	return gqlSelection{field: field, directives: directives, location: location}, nil
+}
+
+func (p *gqlParser) arguments() ([]gqlArgument, error) {
+	if !p.skip("(") {
+		return nil, nil
+	}
+
+	var args []gqlArgument
+	for !p.skip(")") {
+		name, err := p.name()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expect(":"); err != nil {
+			return nil, err
+		}
+		value, err := p.value(false)
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, gqlArgument{name: name, value: value})
+	}
+	return args, nil
+}
+
+func (p *gqlParser) directives() ([]gqlArgumentsNode, error) {
+	var directives []gqlArgumentsNode
+	for p.skip("@") {
+		name, err := p.name()
+		if err != nil {
+			return nil, err
+		}
+		args, err := p.arguments()
+		if err != nil {
+			return nil, err
+		}
+		directives = append(directives, gqlArgumentsNode{name: name, args: args})
+	}
+	return directives, nil
+}
+
+// literal or variable, constant values of variable defaults may not name variables
+func (p *gqlParser) value(constant bool) (any, error) {
+	token := p.next()
+	switch token.kind {
+	case gqlTokenInt:
+		value, err := strconv.Atoi(token.value)
+		if err != nil {
+			return nil, gqlSyntaxError(token.location, fmt.Sprintf("Int %s out of range", token.value))
+		}
+		return value, nil
+	case gqlTokenFloat:
+		value, err := strconv.ParseFloat(token.value, 64)
+		if err != nil {
+			return nil, gqlSyntaxError(token.location, fmt.Sprintf("Invalid Float %s", token.value))
+		}
+		return value, nil
+	case gqlTokenString:
+		return token.value, nil
+	case gqlTokenName:
+		switch token.value {
+		case "true":
+			return true, nil
+		case "false":
+			return false, nil
+		case "null":
+			return nil, nil
+		}
+		return gqlEnum(token.value), nil
+	case gqlTokenPunct:
+		switch token.value {
+		case "$":
+			if constant {
+				break
+			}
+			name, err := p.name()
+			return gqlVariable(name), err
+		case "[":
+			list := []any{}
+			for !p.skip("]") {
+				item, err := p.value(constant)
+				if err != nil {
+					return nil, err
+				}
+				list = append(list, item)
+			}
+			return list, nil
+		case "{":
+			object := map[string]any{}
+			for !p.skip("}") {
+				name, err := p.name()
+				if err != nil {
+					return nil, err
+				}
+				if err := p.expect(":"); err != nil {
+					return nil, err
+				}
+				if object[name], err = p.value(constant); err != nil {
+					return nil, err
+				}
+			}
+			return object, nil
+		}
+	}
+
+	if token.kind != gqlTokenEOF {
+		p.pos--
+	}
+	return nil, p.unexpected()
+}
@@ -0,0 +1,902 @@
+package publicapi
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"sync"
+
+	"events"
+	"rpc"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+)
+
+// =========== REPOSITORY LAYER, CLIENT OF THE USER SERVICE OVER GRPC ===========
+
+// USER_SERVICE_GRPC_ADDR host:port of the user service grpc server, see GRPC_PORT of the user service
+var userServiceGRPCAddr = cfg.String("USER_SERVICE_GRPC_ADDR", "localhost:7001")
+
+// messages of the user service grpc methods, bodies are sent as they are so the user service validates them
+type (
+	grpcUserIDRequest struct {
+		UserID int `json:"user_id"`
+	}
+	grpcUserIDsRequest struct {
+		UserIDs []int `json:"user_ids"`
+	}
+	grpcUpdateUserRequest struct {
+		UserID int             `json:"user_id"`
+		Update json.RawMessage `json:"update"`
+	}
+	grpcUsersPageRequest struct {
+		PageNum  int `json:"page_num"`
+		PageSize int `json:"page_size"`
+	}
+	grpcSetUserRoleRequest struct {
+		UserID int             `json:"user_id"`
+		Role   json.RawMessage `json:"role"`
+	}
+	grpcSetLegalHoldRequest struct {
+		UserID    int             `json:"user_id"`
+		LegalHold json.RawMessage `json:"legal_hold"`
+	}
+	grpcDeleteUserRequest struct {
+		UserID int  `json:"user_id"`
+		Hard   bool `json:"hard"`
+	}
+	grpcAcceptPolicyRequest struct {
+		UserID int             `json:"user_id"`
+		Accept json.RawMessage `json:"accept"`
+	}
+	grpcBlockUserRequest struct {
+		UserID int             `json:"user_id"`
+		Block  json.RawMessage `json:"block"`
+	}
+	grpcUnblockUserRequest struct {
+		UserID        int `json:"user_id"`
+		BlockedUserID int `json:"blocked_user_id"`
+	}
+	grpcUpdatePrivacyRequest struct {
+		UserID int             `json:"user_id"`
+		Update json.RawMessage `json:"update"`
+	}
+	grpcUpdateNotificationPreferencesRequest struct {
+		UserID int             `json:"user_id"`
+		Update json.RawMessage `json:"update"`
+	}
+	grpcUserFavoritesRequest struct {
+		UserID   int `json:"user_id"`
+		PageNum  int `json:"page_num"`
+		PageSize int `json:"page_size"`
+	}
+	grpcFavoriteRequest struct {
+		UserID    int `json:"user_id"`
+		ListingID int `json:"listing_id"`
+	}
+	grpcRegisterDeviceRequest struct {
+		UserID int             `json:"user_id"`
+		Device json.RawMessage `json:"device"`
+	}
+	grpcDeviceRequest struct {
+		UserID   int `json:"user_id"`
+		DeviceID int `json:"device_id"`
+	}
+	grpcPushReceiptsRequest struct {
+		UserID   int `json:"user_id"`
+		DeviceID int `json:"device_id"`
+		Limit    int `json:"limit"`
+	}
+	grpcUserInboxRequest struct {
+		UserID   int  `json:"user_id"`
+		Unread   bool `json:"unread"`
+		PageNum  int  `json:"page_num"`
+		PageSize int  `json:"page_size"`
+	}
+	grpcCreateInboxNotificationRequest struct {
+		UserID       int             `json:"user_id"`
+		Notification json.RawMessage `json:"notification"`
+	}
+	grpcMarkInboxReadRequest struct {
+		UserID int             `json:"user_id"`
+		Read   json.RawMessage `json:"read"`
+	}
+	grpcBroadcastsRequest struct {
+		Limit int `json:"limit"`
+	}
+	grpcBroadcastRequest struct {
+		BroadcastID int `json:"broadcast_id"`
+	}
+	grpcBroadcastStatsRequest struct {
+		BroadcastID int             `json:"broadcast_id"`
+		Stats       json.RawMessage `json:"stats"`
+	}
+	grpcUserEmailEventsRequest struct {
+		UserID int `json:"user_id"`
+		Limit  int `json:"limit"`
+	}
+	grpcEmailSuppressionsRequest struct {
+		Reason string `json:"reason"`
+		Limit  int    `json:"limit"`
+	}
+	grpcNotificationTemplateRequest struct {
+		Event   string `json:"event"`
+		Channel string `json:"channel"`
+		Locale  string `json:"locale"`
+	}
+	grpcSaveContentRuleRequest struct {
+		Name string          `json:"name"`
+		Rule json.RawMessage `json:"rule"`
+	}
+	grpcContentRuleRequest struct {
+		Name string `json:"name"`
+	}
+	grpcOutboxEventsRequest struct {
+		Filter  events.ReplayFilter `json:"filter"`
+		AfterID int64               `json:"after_id"`
+		Limit   int                 `json:"limit"`
+	}
+	grpcDeadLettersRequest struct {
+		Source   string `json:"source"`
+		PageNum  int    `json:"page_num"`
+		PageSize int    `json:"page_size"`
+	}
+	grpcDeadLetterRequest struct {
+		ID int64 `json:"id"`
+	}
+	grpcUpdateDeadLetterRequest struct {
+		ID     int64           `json:"id"`
+		Update json.RawMessage `json:"update"`
+	}
+	grpcAdminActionsRequest struct {
+		Status   string `json:"status"`
+		PageNum  int    `json:"page_num"`
+		PageSize int    `json:"page_size"`
+	}
+	grpcAdminActionRequest struct {
+		ID int64 `json:"id"`
+	}
+	grpcDecideAdminActionRequest struct {
+		ID       int64           `json:"id"`
+		Decision json.RawMessage `json:"decision"`
+	}
+	grpcAdminActionOutcomeRequest struct {
+		ID      int64           `json:"id"`
+		Outcome json.RawMessage `json:"outcome"`
+	}
+	grpcAuditChainRequest struct {
+		AfterID int64 `json:"after_id"`
+		Limit   int   `json:"limit"`
+	}
+	grpcAuditLogRequest struct {
+		Filter   AuditLogFilter `json:"filter"`
+		PageNum  int            `json:"page_num"`
+		PageSize int            `json:"page_size"`
+	}
+	grpcSuppressUserEmailRequest struct {
+		UserID      int             `json:"user_id"`
+		Suppression json.RawMessage `json:"suppression"`
+	}
+	grpcCreateWebhookRequest struct {
+		UserID  int             `json:"user_id"`
+		Webhook json.RawMessage `json:"webhook"`
+	}
+	grpcWebhookRequest struct {
+		UserID    int `json:"user_id"`
+		WebhookID int `json:"webhook_id"`
+	}
+	grpcWebhookDeliveriesRequest struct {
+		UserID    int    `json:"user_id"`
+		WebhookID int    `json:"webhook_id"`
+		Status    string `json:"status"`
+		Limit     int    `json:"limit"`
+	}
+	grpcEmpty struct{}
+)
+
+// connection to a grpc server of the services, sending JSON messages with the internal api key
+func dialGRPC(addr string) (*grpc.ClientConn, error) {
+	return grpc.NewClient(addr,
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithDefaultCallOptions(grpc.CallContentSubtype(rpc.CodecName)),
+		grpc.WithChainUnaryInterceptor(rpc.ClientInterceptor(internalAPIKey)),
+	)
+}
+
+// user service over grpc with JSON messages, the connection is made on the first call and shared by all calls
+type grpcUserClient struct {
+	once sync.Once
+	conn *grpc.ClientConn
+	err  error
+}
+
+func (*grpcUserClient) Name() string {
+	return "grpc"
+}
+
+// invoke method of the user service, answers with code are returned as known, other failures are logged with logCode
+func (c *grpcUserClient) invoke(ctx context.Context, method string, req, reply any, logCode string, known map[codes.Code]error) error {
+	c.once.Do(func() {
+		c.conn, c.err = dialGRPC(userServiceGRPCAddr)
+	})
+	if c.err != nil {
+		slog.ErrorContext(ctx, "service error", "code", logCode, "error", c.err)
+		return c.err
+	}
+
+	err := c.conn.Invoke(ctx, "/users.UserService/"+method, req, reply)
+	if err == nil {
+		return nil
+	}
+	if knownErr, ok := known[status.Code(err)]; ok {
+		return knownErr
+	}
+
+	// answered with 504 like an http call running out of time
+	if status.Code(err) == codes.DeadlineExceeded {
+		err = fmt.Errorf("%w: %w", context.DeadlineExceeded, err)
+	}
+
+	slog.ErrorContext(ctx, "service error", "code", logCode, "error", err)
+	return fmt.Errorf("error calling %s of user service: %w", method, err)
+}
+
+func (c *grpcUserClient) FindUser(ctx context.Context, userID int) (*UserResponse, error) {
+	var user User
+	if err := c.invoke(ctx, "FindUser", grpcUserIDRequest{UserID: userID}, &user, "148", map[codes.Code]error{codes.NotFound: ErrUserNotFound}); err != nil {
+		return nil, err
+	}
+
+	return &UserResponse{Result: true, User: user}, nil
+}
+
+func (c *grpcUserClient) FindUsers(ctx context.Context, userIDs []int) (*UsersResponse, error) {
+	res := &UsersResponse{Result: true}
+	if err := c.invoke(ctx, "FindUsers", grpcUserIDsRequest{UserIDs: userIDs}, res, "149", nil); err != nil {
+		return nil, err
+	}
+
+	return res, nil
+}
+
+func (c *grpcUserClient) ListUsers(ctx context.Context, pageNum, pageSize int) (*UsersPageResponse, error) {
+	res := &UsersPageResponse{Result: true}
+	if err := c.invoke(ctx, "ListUsers", grpcUsersPageRequest{PageNum: pageNum, PageSize: pageSize}, res, "458", nil); err != nil {
+		return nil, err
+	}
+
+	return res, nil
+}
+
+func (c *grpcUserClient) CreateUser(ctx context.Context, userByte []byte) (*UserResponse, error) {
+	var user User
+	err := c.invoke(ctx, "CreateUser", json.RawMessage(userByte), &user, "150", map[codes.Code]error{codes.FailedPrecondition: ErrUserEmailTaken})
+	if err != nil {
+		return nil, err
+	}
+
+	return &UserResponse{Result: true, User: user}, nil
+}
+
+func (c *grpcUserClient) UpdateUser(ctx context.Context, userID int, userByte []byte) (*UserResponse, error) {
+	var user User
+	err := c.invoke(ctx, "UpdateUser", grpcUpdateUserRequest{UserID: userID, Update: userByte}, &user, "151", map[codes.Code]error{
+		codes.NotFound:           ErrUserNotFound,
+		codes.InvalidArgument:    ErrUserUpdateEmpty,
+		codes.FailedPrecondition: ErrUserEmailTaken,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &UserResponse{Result: true, User: user}, nil
+}
+
+func (c *grpcUserClient) DeleteUser(ctx context.Context, userID int, hard bool) error {
+	return c.invoke(ctx, "DeleteUser", grpcDeleteUserRequest{UserID: userID, Hard: hard}, &grpcEmpty{}, "152", map[codes.Code]error{
+		codes.NotFound:           ErrUserNotFound,
+		codes.FailedPrecondition: ErrUserLegalHold,
+	})
+}
+
+func (c *grpcUserClient) SetUserLegalHold(ctx context.Context, userID int, holdByte []byte) error {
+	return c.invoke(ctx, "SetLegalHold", grpcSetLegalHoldRequest{UserID: userID, LegalHold: holdByte}, &grpcEmpty{}, "551", map[codes.Code]error{
+		codes.NotFound: ErrUserNotFound,
+	})
+}
+
+func (c *grpcUserClient) SetUserRole(ctx context.Context, userID int, roleByte []byte) (*UserResponse, error) {
+	var user User
+	err := c.invoke(ctx, "SetUserRole", grpcSetUserRoleRequest{UserID: userID, Role: roleByte}, &user, "459", map[codes.Code]error{
+		codes.NotFound: ErrUserNotFound,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &UserResponse{Result: true, User: user}, nil
+}
+
+func (c *grpcUserClient) Login(ctx context.Context, loginByte []byte) (*LoginResponse, error) {
+	res := &LoginResponse{Result: true}
+	if err := c.invoke(ctx, "Login", json.RawMessage(loginByte), res, "153", map[codes.Code]error{codes.Unauthenticated: ErrInvalidCredentials}); err != nil {
+		return nil, err
+	}
+
+	return res, nil
+}
+
+func (c *grpcUserClient) FindPolicies(ctx context.Context) (*PoliciesResponse, error) {
+	res := &PoliciesResponse{Result: true}
+	if err := c.invoke(ctx, "CurrentPolicies", grpcEmpty{}, res, "154", nil); err != nil {
+		return nil, err
+	}
+
+	return res, nil
+}
+
+func (c *grpcUserClient) FindUserConsents(ctx context.Context, userID int) (*ConsentsResponse, error) {
+	res := &ConsentsResponse{Result: true}
+	if err := c.invoke(ctx, "UserConsents", grpcUserIDRequest{UserID: userID}, res, "155", nil); err != nil {
+		return nil, err
+	}
+
+	return res, nil
+}
+
+func (c *grpcUserClient) CreateUserConsent(ctx context.Context, userID int, consentByte []byte) (*ConsentResponse, error) {
+	var consent Consent
+	err := c.invoke(ctx, "AcceptPolicy", grpcAcceptPolicyRequest{UserID: userID, Accept: consentByte}, &consent, "156", map[codes.Code]error{
+		codes.InvalidArgument: ErrPolicyVersionInvalid,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &ConsentResponse{Result: true, Consent: consent}, nil
+}
+
+func (c *grpcUserClient) FindUserBlocks(ctx context.Context, userID int) (*BlocksResponse, error) {
+	res := &BlocksResponse{Result: true}
+	if err := c.invoke(ctx, "UserBlocks", grpcUserIDRequest{UserID: userID}, res, "236", nil); err != nil {
+		return nil, err
+	}
+
+	return res, nil
+}
+
+func (c *grpcUserClient) CreateUserBlock(ctx context.Context, userID int, blockByte []byte) (*BlockResponse, error) {
+	var block Block
+	err := c.invoke(ctx, "BlockUser", grpcBlockUserRequest{UserID: userID, Block: blockByte}, &block, "237", map[codes.Code]error{
+		codes.NotFound:        ErrUserNotFound,
+		codes.InvalidArgument: ErrBlockInvalid,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &BlockResponse{Result: true, Block: block}, nil
+}
+
+func (c *grpcUserClient) DeleteUserBlock(ctx context.Context, userID, blockedUserID int) error {
+	return c.invoke(ctx, "UnblockUser", grpcUnblockUserRequest{UserID: userID, BlockedUserID: blockedUserID}, &grpcEmpty{}, "238", nil)
+}
+
+func (c *grpcUserClient) FindUserPrivacy(ctx context.Context, userID int) (*PrivacyResponse, error) {
+	var privacy PrivacySettings
+	if err := c.invoke(ctx, "UserPrivacy", grpcUserIDRequest{UserID: userID}, &privacy, "253", map[codes.Code]error{codes.NotFound: ErrUserNotFound}); err != nil {
+		return nil, err
+	}
+
+	return &PrivacyResponse{Result: true, Privacy: privacy}, nil
+}
+
+func (c *grpcUserClient) UpdateUserPrivacy(ctx context.Context, userID int, privacyByte []byte) (*PrivacyResponse, error) {
+	var privacy PrivacySettings
+	err := c.invoke(ctx, "UpdateUserPrivacy", grpcUpdatePrivacyRequest{UserID: userID, Update: privacyByte}, &privacy, "254", map[codes.Code]error{
+		codes.NotFound:        ErrUserNotFound,
+		codes.InvalidArgument: ErrPrivacyUpdateEmpty,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &PrivacyResponse{Result: true, Privacy: privacy}, nil
+}
+
+func (c *grpcUserClient) FindNotificationPreferences(ctx context.Context, userID int) (*NotificationPreferencesResponse, error) {
+	var preferences NotificationPreferences
+	if err := c.invoke(ctx, "NotificationPreferences", grpcUserIDRequest{UserID: userID}, &preferences, "326", map[codes.Code]error{codes.NotFound: ErrUserNotFound}); err != nil {
+		return nil, err
+	}
+
+	return &NotificationPreferencesResponse{Result: true, Preferences: preferences}, nil
+}
+
+func (c *grpcUserClient) UpdateNotificationPreferences(ctx context.Context, userID int, preferencesByte []byte) (*NotificationPreferencesResponse, error) {
+	var preferences NotificationPreferences
+	req := grpcUpdateNotificationPreferencesRequest{UserID: userID, Update: preferencesByte}
+	err := c.invoke(ctx, "UpdateNotificationPreferences", req, &preferences, "327", map[codes.Code]error{
+		codes.NotFound:        ErrUserNotFound,
+		codes.InvalidArgument: ErrNotificationPreferencesInvalid,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &NotificationPreferencesResponse{Result: true, Preferences: preferences}, nil
+}
+
+func (c *grpcUserClient) FindUserFavorites(ctx context.Context, userID, pageNum, pageSize int) (*FavoritesResponse, error) {
+	res := &FavoritesResponse{Result: true}
+	req := grpcUserFavoritesRequest{UserID: userID, PageNum: pageNum, PageSize: pageSize}
+	if err := c.invoke(ctx, "UserFavorites", req, res, "340", map[codes.Code]error{codes.NotFound: ErrUserNotFound}); err != nil {
+		return nil, err
+	}
+
+	return res, nil
+}
+
+func (c *grpcUserClient) AddUserFavorite(ctx context.Context, userID, listingID int) (*FavoriteResponse, error) {
+	var favorite Favorite
+	err := c.invoke(ctx, "AddFavorite", grpcFavoriteRequest{UserID: userID, ListingID: listingID}, &favorite, "341", map[codes.Code]error{
+		codes.NotFound:           ErrUserNotFound,
+		codes.FailedPrecondition: ErrFavoriteLimit,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &FavoriteResponse{Result: true, Favorite: favorite}, nil
+}
+
+func (c *grpcUserClient) RemoveUserFavorite(ctx context.Context, userID, listingID int) error {
+	return c.invoke(ctx, "RemoveFavorite", grpcFavoriteRequest{UserID: userID, ListingID: listingID}, &grpcEmpty{}, "342",
+		map[codes.Code]error{codes.NotFound: ErrFavoriteNotFound})
+}
+
+func (c *grpcUserClient) FindUserDevices(ctx context.Context, userID int) (*PushDevicesResponse, error) {
+	res := &PushDevicesResponse{Result: true}
+	if err := c.invoke(ctx, "UserDevices", grpcUserIDRequest{UserID: userID}, res, "358", nil); err != nil {
+		return nil, err
+	}
+
+	return res, nil
+}
+
+func (c *grpcUserClient) RegisterUserDevice(ctx context.Context, userID int, deviceByte []byte) (*PushDeviceResponse, error) {
+	var device PushDevice
+	err := c.invoke(ctx, "RegisterDevice", grpcRegisterDeviceRequest{UserID: userID, Device: deviceByte}, &device, "359", map[codes.Code]error{
+		codes.NotFound:           ErrUserNotFound,
+		codes.InvalidArgument:    ErrPushDeviceInvalid,
+		codes.FailedPrecondition: ErrPushDeviceLimit,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &PushDeviceResponse{Result: true, Device: device}, nil
+}
+
+func (c *grpcUserClient) DeleteUserDevice(ctx context.Context, userID, deviceID int) error {
+	return c.invoke(ctx, "DeleteDevice", grpcDeviceRequest{UserID: userID, DeviceID: deviceID}, &grpcEmpty{}, "360",
+		map[codes.Code]error{codes.NotFound: ErrPushDeviceNotFound})
+}
+
+func (c *grpcUserClient) FindPushReceipts(ctx context.Context, userID, deviceID, limit int) (*PushReceiptsResponse, error) {
+	res := &PushReceiptsResponse{Result: true}
+	req := grpcPushReceiptsRequest{UserID: userID, DeviceID: deviceID, Limit: limit}
+	if err := c.invoke(ctx, "PushReceipts", req, res, "361", map[codes.Code]error{codes.NotFound: ErrPushDeviceNotFound}); err != nil {
+		return nil, err
+	}
+
+	return res, nil
+}
+
+func (c *grpcUserClient) RecordPushReceipts(ctx context.Context, receiptsByte []byte) error {
+	return c.invoke(ctx, "RecordPushReceipts", json.RawMessage(receiptsByte), &grpcEmpty{}, "362", nil)
+}
+
+func (c *grpcUserClient) FindUserInbox(ctx context.Context, userID int, unread bool, pageNum, pageSize int) (*InboxNotificationsResponse, error) {
+	res := &InboxNotificationsResponse{Result: true}
+	req := grpcUserInboxRequest{UserID: userID, Unread: unread, PageNum: pageNum, PageSize: pageSize}
+	if err := c.invoke(ctx, "UserInbox", req, res, "377", map[codes.Code]error{codes.NotFound: ErrUserNotFound}); err != nil {
+		return nil, err
+	}
+
+	return res, nil
+}
+
+func (c *grpcUserClient) CreateInboxNotification(ctx context.Context, userID int, notificationByte []byte) (*InboxNotificationResponse, error) {
+	var notification InboxNotification
+	req := grpcCreateInboxNotificationRequest{UserID: userID, Notification: notificationByte}
+	if err := c.invoke(ctx, "CreateInboxNotification", req, &notification, "378", map[codes.Code]error{codes.NotFound: ErrUserNotFound}); err != nil {
+		return nil, err
+	}
+
+	return &InboxNotificationResponse{Result: true, Notification: notification}, nil
+}
+
+func (c *grpcUserClient) MarkInboxRead(ctx context.Context, userID int, readByte []byte) (*InboxReadResponse, error) {
+	res := &InboxReadResponse{Result: true}
+	if err := c.invoke(ctx, "MarkInboxRead", grpcMarkInboxReadRequest{UserID: userID, Read: readByte}, res, "379", nil); err != nil {
+		return nil, err
+	}
+
+	return res, nil
+}
+
+func (c *grpcUserClient) FindBroadcasts(ctx context.Context, limit int) (*BroadcastsResponse, error) {
+	res := &BroadcastsResponse{Result: true}
+	if err := c.invoke(ctx, "Broadcasts", grpcBroadcastsRequest{Limit: limit}, res, "407", nil); err != nil {
+		return nil, err
+	}
+
+	return res, nil
+}
+
+func (c *grpcUserClient) CreateBroadcast(ctx context.Context, broadcastByte []byte) (*BroadcastResponse, error) {
+	res := &BroadcastResponse{Result: true}
+	if err := c.invoke(ctx, "CreateBroadcast", json.RawMessage(broadcastByte), res, "408", map[codes.Code]error{codes.InvalidArgument: ErrBroadcastInvalid}); err != nil {
+		return nil, err
+	}
+
+	return res, nil
+}
+
+func (c *grpcUserClient) FindBroadcast(ctx context.Context, broadcastID int) (*BroadcastResponse, error) {
+	var broadcast Broadcast
+	if err := c.invoke(ctx, "Broadcast", grpcBroadcastRequest{BroadcastID: broadcastID}, &broadcast, "409", map[codes.Code]error{codes.NotFound: ErrBroadcastNotFound}); err != nil {
+		return nil, err
+	}
+
+	return &BroadcastResponse{Result: true, Broadcast: broadcast}, nil
+}
+
+func (c *grpcUserClient) CancelBroadcast(ctx context.Context, broadcastID int) (*BroadcastResponse, error) {
+	var broadcast Broadcast
+	err := c.invoke(ctx, "CancelBroadcast", grpcBroadcastRequest{BroadcastID: broadcastID}, &broadcast, "410", map[codes.Code]error{
+		codes.NotFound:           ErrBroadcastNotFound,
+		codes.FailedPrecondition: ErrBroadcastFinished,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &BroadcastResponse{Result: true, Broadcast: broadcast}, nil
+}
+
+func (c *grpcUserClient) CountBroadcastAudience(ctx context.Context, audienceByte []byte) (*BroadcastAudienceResponse, error) {
+	res := &BroadcastAudienceResponse{Result: true}
+	if err := c.invoke(ctx, "BroadcastAudienceCount", json.RawMessage(audienceByte), res, "411", map[codes.Code]error{codes.InvalidArgument: ErrBroadcastInvalid}); err != nil {
+		return nil, err
+	}
+
+	return res, nil
+}
+
+func (c *grpcUserClient) ClaimBroadcastRecipients(ctx context.Context, limit int) (*BroadcastBatchResponse, error) {
+	res := &BroadcastBatchResponse{Result: true}
+	if err := c.invoke(ctx, "ClaimBroadcastRecipients", grpcBroadcastsRequest{Limit: limit}, res, "412", nil); err != nil {
+		return nil, err
+	}
+
+	return res, nil
+}
+
+func (c *grpcUserClient) RecordBroadcastStats(ctx context.Context, broadcastID int, statsByte []byte) error {
+	return c.invoke(ctx, "RecordBroadcastStats", grpcBroadcastStatsRequest{BroadcastID: broadcastID, Stats: statsByte}, &grpcEmpty{}, "413",
+		map[codes.Code]error{codes.NotFound: ErrBroadcastNotFound})
+}
+
+func (c *grpcUserClient) RecordEmailEvents(ctx context.Context, eventsByte []byte) (*EmailEventsRecordResponse, error) {
+	res := &EmailEventsRecordResponse{Result: true}
+	if err := c.invoke(ctx, "RecordEmailEvents", json.RawMessage(eventsByte), res, "437", nil); err != nil {
+		return nil, err
+	}
+
+	return res, nil
+}
+
+func (c *grpcUserClient) FindUserEmailEvents(ctx context.Context, userID, limit int) (*EmailEventsResponse, error) {
+	res := &EmailEventsResponse{Result: true}
+	if err := c.invoke(ctx, "UserEmailEvents", grpcUserEmailEventsRequest{UserID: userID, Limit: limit}, res, "438", nil); err != nil {
+		return nil, err
+	}
+
+	return res, nil
+}
+
+func (c *grpcUserClient) FindEmailSuppressions(ctx context.Context, reason string, limit int) (*EmailSuppressionsResponse, error) {
+	res := &EmailSuppressionsResponse{Result: true}
+	if err := c.invoke(ctx, "EmailSuppressions", grpcEmailSuppressionsRequest{Reason: reason, Limit: limit}, res, "439", nil); err != nil {
+		return nil, err
+	}
+
+	return res, nil
+}
+
+func (c *grpcUserClient) FindUserEmailSuppression(ctx context.Context, userID int) (*EmailSuppressionResponse, error) {
+	var suppression EmailSuppression
+	if err := c.invoke(ctx, "UserEmailSuppression", grpcUserIDRequest{UserID: userID}, &suppression, "440", map[codes.Code]error{codes.NotFound: ErrEmailSuppressionNotFound}); err != nil {
+		return nil, err
+	}
+
+	return &EmailSuppressionResponse{Result: true, Suppression: suppression}, nil
+}
+
+func (c *grpcUserClient) SuppressUserEmail(ctx context.Context, userID int, suppressionByte []byte) (*EmailSuppressionResponse, error) {
+	var suppression EmailSuppression
+	err := c.invoke(ctx, "SuppressUserEmail", grpcSuppressUserEmailRequest{UserID: userID, Suppression: suppressionByte}, &suppression, "441",
+		map[codes.Code]error{codes.NotFound: ErrUserNotFound})
+	if err != nil {
+		return nil, err
+	}
+
+	return &EmailSuppressionResponse{Result: true, Suppression: suppression}, nil
+}
+
+func (c *grpcUserClient) UnsuppressUserEmail(ctx context.Context, userID int) error {
+	return c.invoke(ctx, "UnsuppressUserEmail", grpcUserIDRequest{UserID: userID}, &grpcEmpty{}, "442",
+		map[codes.Code]error{codes.NotFound: ErrEmailSuppressionNotFound})
+}
+
+func (c *grpcUserClient) RecordAudit(ctx context.Context, entryByte []byte) error {
+	return c.invoke(ctx, "RecordAudit", json.RawMessage(entryByte), &AuditEntry{}, "460", nil)
+}
+
+func (c *grpcUserClient) FindAuditLog(ctx context.Context, filter AuditLogFilter, pageNum, pageSize int) (*AuditLogResponse, error) {
+	res := &AuditLogResponse{Result: true}
+	if err := c.invoke(ctx, "AuditLog", grpcAuditLogRequest{Filter: filter, PageNum: pageNum, PageSize: pageSize}, res, "461", nil); err != nil {
+		return nil, err
+	}
+
+	return res, nil
+}
+
+func (c *grpcUserClient) FindAuditChain(ctx context.Context, afterID int64, limit int) (*AuditChainResponse, error) {
+	res := &AuditChainResponse{Result: true}
+	if err := c.invoke(ctx, "AuditChain", grpcAuditChainRequest{AfterID: afterID, Limit: limit}, res, "558", nil); err != nil {
+		return nil, err
+	}
+
+	return res, nil
+}
+
+func (c *grpcUserClient) VerifyAuditChain(ctx context.Context) (*AuditChainVerificationResponse, error) {
+	res := &AuditChainVerificationResponse{Result: true}
+	if err := c.invoke(ctx, "VerifyAuditChain", grpcEmpty{}, &res.Verification, "559", nil); err != nil {
+		return nil, err
+	}
+
+	return res, nil
+}
+
+func (c *grpcUserClient) FindNotificationTemplates(ctx context.Context) (*NotificationTemplatesResponse, error) {
+	res := &NotificationTemplatesResponse{Result: true}
+	if err := c.invoke(ctx, "NotificationTemplates", grpcEmpty{}, res, "475", nil); err != nil {
+		return nil, err
+	}
+
+	return res, nil
+}
+
+func (c *grpcUserClient) FindNotificationTemplateVersions(ctx context.Context, event, channel, locale string) (*NotificationTemplatesResponse, error) {
+	res := &NotificationTemplatesResponse{Result: true}
+	req := grpcNotificationTemplateRequest{Event: event, Channel: channel, Locale: locale}
+	if err := c.invoke(ctx, "NotificationTemplateVersions", req, res, "476", map[codes.Code]error{codes.NotFound: ErrNotificationTemplateNotFound}); err != nil {
+		return nil, err
+	}
+
+	return res, nil
+}
+
+func (c *grpcUserClient) CreateNotificationTemplate(ctx context.Context, templateByte []byte) (*NotificationTemplateResponse, error) {
+	var template NotificationTemplate
+	if err := c.invoke(ctx, "CreateNotificationTemplate", json.RawMessage(templateByte), &template, "477", nil); err != nil {
+		return nil, err
+	}
+
+	return &NotificationTemplateResponse{Result: true, Template: template}, nil
+}
+
+func (c *grpcUserClient) DeleteNotificationTemplate(ctx context.Context, event, channel, locale string) error {
+	req := grpcNotificationTemplateRequest{Event: event, Channel: channel, Locale: locale}
+	return c.invoke(ctx, "DeleteNotificationTemplate", req, &grpcEmpty{}, "478",
+		map[codes.Code]error{codes.NotFound: ErrNotificationTemplateNotFound})
+}
+
+func (c *grpcUserClient) FindContentRules(ctx context.Context) (*ContentRulesResponse, error) {
+	res := &ContentRulesResponse{Result: true}
+	if err := c.invoke(ctx, "ContentRules", grpcEmpty{}, res, "569", nil); err != nil {
+		return nil, err
+	}
+
+	return res, nil
+}
+
+func (c *grpcUserClient) SaveContentRule(ctx context.Context, name string, ruleByte []byte) (*ContentRuleResponse, error) {
+	var rule ContentRule
+	if err := c.invoke(ctx, "SaveContentRule", grpcSaveContentRuleRequest{Name: name, Rule: ruleByte}, &rule, "570", nil); err != nil {
+		return nil, err
+	}
+
+	return &ContentRuleResponse{Result: true, Rule: rule}, nil
+}
+
+func (c *grpcUserClient) DeleteContentRule(ctx context.Context, name string) error {
+	return c.invoke(ctx, "DeleteContentRule", grpcContentRuleRequest{Name: name}, &grpcEmpty{}, "571",
+		map[codes.Code]error{codes.NotFound: ErrContentRuleNotFound})
+}
+
+func (c *grpcUserClient) FindOutboxEvents(ctx context.Context, filter events.ReplayFilter, afterID int64, limit int) (*OutboxEventsResponse, error) {
+	res := &OutboxEventsResponse{Result: true}
+	req := grpcOutboxEventsRequest{Filter: filter, AfterID: afterID, Limit: limit}
+	if err := c.invoke(ctx, "OutboxEvents", req, res, "485", nil); err != nil {
+		return nil, err
+	}
+
+	return res, nil
+}
+
+func (c *grpcUserClient) FindDeadLetters(ctx context.Context, source string, pageNum, pageSize int) (*DeadLettersResponse, error) {
+	res := &DeadLettersResponse{Result: true}
+	req := grpcDeadLettersRequest{Source: source, PageNum: pageNum, PageSize: pageSize}
+	if err := c.invoke(ctx, "DeadLetters", req, res, "501", map[codes.Code]error{codes.InvalidArgument: errDeadLetterPage}); err != nil {
+		return nil, err
+	}
+
+	return res, nil
+}
+
+func (c *grpcUserClient) FindDeadLetter(ctx context.Context, id int64) (*DeadLetterResponse, error) {
+	var letter DeadLetter
+	if err := c.invoke(ctx, "DeadLetter", grpcDeadLetterRequest{ID: id}, &letter, "502", map[codes.Code]error{codes.NotFound: ErrDeadLetterNotFound}); err != nil {
+		return nil, err
+	}
+
+	return &DeadLetterResponse{Result: true, DeadLetter: letter}, nil
+}
+
+func (c *grpcUserClient) CreateDeadLetter(ctx context.Context, letterByte []byte) (*DeadLetterResponse, error) {
+	var letter DeadLetter
+	if err := c.invoke(ctx, "CreateDeadLetter", json.RawMessage(letterByte), &letter, "503", nil); err != nil {
+		return nil, err
+	}
+
+	return &DeadLetterResponse{Result: true, DeadLetter: letter}, nil
+}
+
+func (c *grpcUserClient) UpdateDeadLetter(ctx context.Context, id int64, updateByte []byte) (*DeadLetterResponse, error) {
+	var letter DeadLetter
+	err := c.invoke(ctx, "UpdateDeadLetter", grpcUpdateDeadLetterRequest{ID: id, Update: updateByte}, &letter, "504", map[codes.Code]error{
+		codes.NotFound:        ErrDeadLetterNotFound,
+		codes.InvalidArgument: ErrDeadLetterInvalid,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &DeadLetterResponse{Result: true, DeadLetter: letter}, nil
+}
+
+func (c *grpcUserClient) RequeueDeadLetter(ctx context.Context, id int64) (*DeadLetterResponse, error) {
+	var letter DeadLetter
+	err := c.invoke(ctx, "RequeueDeadLetter", grpcDeadLetterRequest{ID: id}, &letter, "505", map[codes.Code]error{
+		codes.NotFound:           ErrDeadLetterNotFound,
+		codes.FailedPrecondition: ErrDeadLetterGone,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &DeadLetterResponse{Result: true, DeadLetter: letter}, nil
+}
+
+func (c *grpcUserClient) DeleteDeadLetter(ctx context.Context, id int64) error {
+	return c.invoke(ctx, "DeleteDeadLetter", grpcDeadLetterRequest{ID: id}, &grpcEmpty{}, "506",
+		map[codes.Code]error{codes.NotFound: ErrDeadLetterNotFound})
+}
+
+func (c *grpcUserClient) FindAdminActions(ctx context.Context, status string, pageNum, pageSize int) (*AdminActionsResponse, error) {
+	res := &AdminActionsResponse{Result: true}
+	req := grpcAdminActionsRequest{Status: status, PageNum: pageNum, PageSize: pageSize}
+	if err := c.invoke(ctx, "AdminActions", req, res, "533", map[codes.Code]error{codes.InvalidArgument: errAdminActionPage}); err != nil {
+		return nil, err
+	}
+
+	return res, nil
+}
+
+func (c *grpcUserClient) FindAdminAction(ctx context.Context, id int64) (*AdminActionResponse, error) {
+	var action AdminAction
+	if err := c.invoke(ctx, "AdminAction", grpcAdminActionRequest{ID: id}, &action, "534", map[codes.Code]error{codes.NotFound: ErrAdminActionNotFound}); err != nil {
+		return nil, err
+	}
+
+	return &AdminActionResponse{Result: true, AdminAction: action}, nil
+}
+
+func (c *grpcUserClient) CreateAdminAction(ctx context.Context, actionByte []byte) (*AdminActionResponse, error) {
+	var action AdminAction
+	err := c.invoke(ctx, "CreateAdminAction", json.RawMessage(actionByte), &action, "535", map[codes.Code]error{
+		codes.FailedPrecondition: ErrAdminActionDuplicate,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &AdminActionResponse{Result: true, AdminAction: action}, nil
+}
+
+func (c *grpcUserClient) DecideAdminAction(ctx context.Context, id int64, decisionByte []byte) (*AdminActionResponse, error) {
+	var action AdminAction
+	err := c.invoke(ctx, "DecideAdminAction", grpcDecideAdminActionRequest{ID: id, Decision: decisionByte}, &action, "536", map[codes.Code]error{
+		codes.NotFound:           ErrAdminActionNotFound,
+		codes.FailedPrecondition: ErrAdminActionNotPending,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &AdminActionResponse{Result: true, AdminAction: action}, nil
+}
+
+func (c *grpcUserClient) RecordAdminActionOutcome(ctx context.Context, id int64, outcomeByte []byte) (*AdminActionResponse, error) {
+	var action AdminAction
+	err := c.invoke(ctx, "RecordAdminActionOutcome", grpcAdminActionOutcomeRequest{ID: id, Outcome: outcomeByte}, &action, "537", map[codes.Code]error{
+		codes.NotFound:           ErrAdminActionNotFound,
+		codes.FailedPrecondition: ErrAdminActionNotApproved,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &AdminActionResponse{Result: true, AdminAction: action}, nil
+}
+
+func (c *grpcUserClient) FindUserWebhooks(ctx context.Context, userID int) (*WebhooksResponse, error) {
+	res := &WebhooksResponse{Result: true}
+	if err := c.invoke(ctx, "UserWebhooks", grpcUserIDRequest{UserID: userID}, res, "291", nil); err != nil {
+		return nil, err
+	}
+
+	return res, nil
+}
+
+func (c *grpcUserClient) CreateUserWebhook(ctx context.Context, userID int, webhookByte []byte) (*WebhookResponse, error) {
+	var webhook Webhook
+	err := c.invoke(ctx, "CreateWebhook", grpcCreateWebhookRequest{UserID: userID, Webhook: webhookByte}, &webhook, "292", map[codes.Code]error{
+		codes.NotFound:           ErrUserNotFound,
+		codes.InvalidArgument:    ErrWebhookInvalid,
+		codes.FailedPrecondition: ErrWebhookLimit,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &WebhookResponse{Result: true, Webhook: webhook}, nil
+}
+
+func (c *grpcUserClient) DeleteUserWebhook(ctx context.Context, userID, webhookID int) error {
+	return c.invoke(ctx, "DeleteWebhook", grpcWebhookRequest{UserID: userID, WebhookID: webhookID}, &grpcEmpty{}, "293",
+		map[codes.Code]error{codes.NotFound: ErrWebhookNotFound})
+}
+
+func (c *grpcUserClient) FindWebhookDeliveries(ctx context.Context, userID, webhookID int, status string, limit int) (*WebhookDeliveriesResponse, error) {
+	res := &WebhookDeliveriesResponse{Result: true}
+	req := grpcWebhookDeliveriesRequest{UserID: userID, WebhookID: webhookID, Status: status, Limit: limit}
+	if err := c.invoke(ctx, "WebhookDeliveries", req, res, "294", map[codes.Code]error{codes.NotFound: ErrWebhookNotFound}); err != nil {
+		return nil, err
+	}
+
+	return res, nil
+}
+
+func (c *grpcUserClient) PublishWebhookEvent(ctx context.Context, eventByte []byte) error {
+	return c.invoke(ctx, "PublishWebhookEvent", json.RawMessage(eventByte), &grpcEmpty{}, "295", nil)
+}
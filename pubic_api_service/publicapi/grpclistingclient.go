@@ -0,0 +1,160 @@
+package publicapi
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// =========== REPOSITORY LAYER, CLIENT OF THE LISTING SERVICE OVER GRPC ===========
+
+// LISTING_SERVICE_GRPC_ADDR host:port of the listing service grpc server, see GRPC_PORT of the listing service
+var listingServiceGRPCAddr = cfg.String("LISTING_SERVICE_GRPC_ADDR", "localhost:7000")
+
+// messages of the listing service grpc methods, see rpc/proto/listings.proto
+type (
+	grpcListListingsRequest struct {
+		PageNum  int    `json:"page_num"`
+		PageSize int    `json:"page_size"`
+		UserID   int    `json:"user_id"`
+		Region   string `json:"region"`
+		SortBy   string `json:"sort_by"`
+		SortDir  string `json:"sort_dir"`
+	}
+	grpcListingIDRequest struct {
+		ListingID int `json:"listing_id"`
+	}
+	grpcCreateListingRequest struct {
+		UserID         int     `json:"user_id"`
+		ListingType    string  `json:"listing_type"`
+		Price          int     `json:"price"`
+		Currency       string  `json:"currency"`
+		Region         string  `json:"region"`
+		Area           float64 `json:"area"`
+		IdempotencyKey string  `json:"idempotency_key"`
+	}
+	grpcUpdateListingRequest struct {
+		ListingID   int     `json:"listing_id"`
+		ListingType string  `json:"listing_type"`
+		Price       int     `json:"price"`
+		Currency    string  `json:"currency"`
+		Area        float64 `json:"area"`
+	}
+	grpcDeleteListingRequest struct {
+		ListingID int  `json:"listing_id"`
+		Hard      bool `json:"hard"`
+	}
+)
+
+// listing service over grpc with JSON messages, the connection is made on the first call and shared by all calls
+type grpcListingClient struct {
+	once sync.Once
+	conn *grpc.ClientConn
+	err  error
+}
+
+// LISTING_SERVICE_GRPC_TIMEOUT max duration of one call, default DOWNSTREAM_TIMEOUT
+var listingServiceGRPCTimeout = cfg.Duration("LISTING_SERVICE_GRPC_TIMEOUT", cfg.Duration("DOWNSTREAM_TIMEOUT", 5*time.Second))
+
+// invoke method of the listing service, answers with code are returned as known, other failures are logged with logCode
+func (c *grpcListingClient) invoke(ctx context.Context, method string, req, reply any, logCode string, known map[codes.Code]error) error {
+	c.once.Do(func() {
+		c.conn, c.err = dialGRPC(listingServiceGRPCAddr)
+	})
+	if c.err != nil {
+		slog.ErrorContext(ctx, "service error", "code", logCode, "error", c.err)
+		return c.err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, listingServiceGRPCTimeout)
+	defer cancel()
+
+	start := time.Now()
+	err := c.conn.Invoke(ctx, "/listings.ListingService/"+method, req, reply)
+	downstreamRequestDuration.WithLabelValues(listingServiceGRPCAddr, method, status.Code(err).String()).Observe(time.Since(start).Seconds())
+	if err == nil {
+		return nil
+	}
+	if knownErr, ok := known[status.Code(err)]; ok {
+		return knownErr
+	}
+
+	// answered with 504 like an http call running out of time
+	if status.Code(err) == codes.DeadlineExceeded {
+		err = fmt.Errorf("%w: %w", context.DeadlineExceeded, err)
+	}
+
+	slog.ErrorContext(ctx, "service error", "code", logCode, "error", err)
+	return fmt.Errorf("error calling %s of listing service: %w", method, err)
+}
+
+func (c *grpcListingClient) FetchListings(ctx context.Context, userID, region string, pageNum, pageSize int, sortBy, sortDir string) (*ListingsResponse, error) {
+	req := grpcListListingsRequest{PageNum: pageNum, PageSize: pageSize, Region: region, SortBy: sortBy, SortDir: sortDir}
+	if userID != "" {
+		id, err := strconv.Atoi(userID)
+		if err != nil {
+			slog.ErrorContext(ctx, "service error", "code", "179", "error", err)
+			return nil, err
+		}
+		req.UserID = id
+	}
+
+	res := &ListingsResponse{Result: true}
+	if err := c.invoke(ctx, "ListListings", req, res, "180", nil); err != nil {
+		return nil, err
+	}
+
+	return res, nil
+}
+
+func (c *grpcListingClient) CreateListing(ctx context.Context, listingByte []byte) (*ListingCreateResponse, error) {
+	var req grpcCreateListingRequest
+	if err := json.Unmarshal(listingByte, &req); err != nil {
+		slog.ErrorContext(ctx, "service error", "code", "181", "error", err)
+		return nil, err
+	}
+	// listing service keeps the key unique per user, so a retried create returns the first listing
+	req.IdempotencyKey = idempotencyKey(ctx)
+
+	res := &ListingCreateResponse{Result: true}
+	if err := c.invoke(ctx, "CreateListing", req, res, "182", nil); err != nil {
+		return nil, err
+	}
+
+	return res, nil
+}
+
+func (c *grpcListingClient) FindListing(ctx context.Context, listingID int) (*ListingDetailResponse, error) {
+	res := &ListingDetailResponse{Result: true}
+	if err := c.invoke(ctx, "GetListing", grpcListingIDRequest{ListingID: listingID}, res, "183", map[codes.Code]error{codes.NotFound: errListingNotFound}); err != nil {
+		return nil, err
+	}
+
+	return res, nil
+}
+
+func (c *grpcListingClient) UpdateListing(ctx context.Context, listingID int, update ListingUpdate) (*ListingDetailResponse, error) {
+	req := grpcUpdateListingRequest{ListingID: listingID, ListingType: update.ListingType, Price: update.Price, Currency: update.Currency, Area: update.Area}
+
+	res := &ListingDetailResponse{Result: true}
+	if err := c.invoke(ctx, "UpdateListing", req, res, "184", map[codes.Code]error{codes.NotFound: errListingNotFound}); err != nil {
+		return nil, err
+	}
+
+	return res, nil
+}
+
+func (c *grpcListingClient) DeleteListing(ctx context.Context, listingID int, hard bool) error {
+	return c.invoke(ctx, "DeleteListing", grpcDeleteListingRequest{ListingID: listingID, Hard: hard}, &grpcEmpty{}, "185", map[codes.Code]error{
+		codes.NotFound:           errListingNotFound,
+		codes.FailedPrecondition: errListingLegalHold,
+	})
+}
@@ -0,0 +1,291 @@
+package publicapi
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"apperror"
+
+	"github.com/gin-gonic/gin"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// client chosen key making a retried create return the first response instead of creating twice
+const headerIdempotencyKey = "Idempotency-Key"
+
+// set on responses replayed from the store
+const headerIdempotentReplayed = "Idempotent-Replayed"
+
+// response headers kept with the stored response
+var idempotentHeaders = []string{"Content-Type", "Location"}
+
+// response stored for an idempotency key, fingerprint is the hash of the request body the key was first used with
+type IdempotentResponse struct {
+	Fingerprint string              `json:"fingerprint"`
+	Status      int                 `json:"status"`
+	Header      map[string][]string `json:"header"`
+	Body        []byte              `json:"body"`
+}
+
+type ctxKeyIdempotencyKey struct{}
+
+// idempotency key of the request of ctx, empty when the client sent none
+func idempotencyKey(ctx context.Context) string {
+	key, _ := ctx.Value(ctxKeyIdempotencyKey{}).(string)
+	return key
+}
+
+// =========== MIDDLEWARE LAYER, RUN BEFORE INTERFACE HANDLER TO ENRICH OR GUARD THE REQUEST ===========
+
+// replay the stored response of a repeated Idempotency-Key within ttl, run after authMiddleware
+// so keys are scoped to the user, requests without the header are served as usual
+func idempotencyMiddleware(store IdempotencyStore, ttl time.Duration) gin.HandlerFunc {
+	// keys whose first request is still being served
+	var (
+		inFlight   = map[string]bool{}
+		inFlightMu sync.Mutex
+	)
+
+	return func(c *gin.Context) {
+		key := c.GetHeader(headerIdempotencyKey)
+		if key == "" {
+			c.Next()
+			return
+		}
+		if len(key) > 255 {
+			apperror.Abort(c, http.StatusBadRequest, "Idempotency-Key must be at most 255 characters")
+			return
+		}
+
+		body, err := io.ReadAll(c.Request.Body)
+		if err != nil {
+			slog.ErrorContext(c.Request.Context(), "middleware error", "code", "144", "error", err)
+			apperror.Abort(c, http.StatusBadRequest, "Invalid body request")
+			return
+		}
+		c.Request.Body = io.NopCloser(bytes.NewReader(body))
+		sum := sha256.Sum256(body)
+		fingerprint := hex.EncodeToString(sum[:])
+
+		// keys are scoped per user, or per client ip on public routes such as signup
+		owner := strconv.Itoa(authUserID(c))
+		if authUserID(c) == 0 {
+			owner = "ip:" + clientIP(c)
+		}
+		storeKey := fmt.Sprintf("%s %s %s %s", owner, c.Request.Method, c.FullPath(), key)
+
+		inFlightMu.Lock()
+		if inFlight[storeKey] {
+			inFlightMu.Unlock()
+			apperror.Abort(c, http.StatusConflict, "A request with this Idempotency-Key is in progress")
+			return
+		}
+		inFlight[storeKey] = true
+		inFlightMu.Unlock()
+		defer func() {
+			inFlightMu.Lock()
+			delete(inFlight, storeKey)
+			inFlightMu.Unlock()
+		}()
+
+		stored, err := store.Get(c.Request.Context(), storeKey)
+		if err != nil {
+			// listing service rejects duplicate keys too, so serve the request rather than fail it
+			slog.ErrorContext(c.Request.Context(), "middleware error", "code", "145", "error", err)
+		}
+		if stored != nil {
+			if stored.Fingerprint != fingerprint {
+				apperror.Abort(c, http.StatusUnprocessableEntity, "Idempotency-Key was already used with a different request body")
+				return
+			}
+
+			for name, values := range stored.Header {
+				c.Writer.Header()[name] = values
+			}
+			c.Header(headerIdempotentReplayed, "true")
+			c.Writer.WriteHeader(stored.Status)
+			c.Writer.Write(stored.Body)
+			c.Abort()
+			return
+		}
+
+		c.Request = c.Request.WithContext(context.WithValue(c.Request.Context(), ctxKeyIdempotencyKey{}, key))
+		writer := &idempotencyWriter{ResponseWriter: c.Writer}
+		c.Writer = writer
+		c.Next()
+		c.Writer = writer.ResponseWriter
+
+		// server errors are not final, a retry with the same key runs the request again
+		if c.Writer.Status() >= http.StatusInternalServerError {
+			return
+		}
+
+		resp := &IdempotentResponse{Fingerprint: fingerprint, Status: c.Writer.Status(), Header: map[string][]string{}, Body: writer.body.Bytes()}
+		for _, name := range idempotentHeaders {
+			if values := c.Writer.Header().Values(name); len(values) > 0 {
+				resp.Header[name] = values
+			}
+		}
+		if err := store.Put(c.Request.Context(), storeKey, resp, ttl); err != nil {
+			slog.ErrorContext(c.Request.Context(), "middleware error", "code", "146", "error", err)
+		}
+	}
+}
+
+// copy the response body while it is written to the client
+type idempotencyWriter struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+func (w *idempotencyWriter) Write(b []byte) (int, error) {
+	w.body.Write(b)
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *idempotencyWriter) WriteString(s string) (int, error) {
+	w.body.WriteString(s)
+	return w.ResponseWriter.WriteString(s)
+}
+
+// =========== REPOSITORY LAYER, ABSTRACTION OVER THE DATA PERSISTENCE (databases, file systems, or external APIs) ===========
+
+// keep responses of idempotency keys, implemented by any storage backend
+type IdempotencyStore interface {
+	// Get stored response of key, nil when none or expired
+	Get(ctx context.Context, key string) (*IdempotentResponse, error)
+	// Put keep resp for key until ttl elapsed
+	Put(ctx context.Context, key string, resp *IdempotentResponse, ttl time.Duration) error
+}
+
+// IDEMPOTENCY_STORE select storage backend, memory is lost on restart and not shared between instances
+// IDEMPOTENCY_DB_PATH sqlite file of the sqlite backend
+func newIdempotencyStore() IdempotencyStore {
+	switch name := cfg.String("IDEMPOTENCY_STORE", "memory"); name {
+	case "memory":
+		return newMemoryIdempotencyStore()
+	case "sqlite":
+		store, err := newSQLiteIdempotencyStore(cfg.String("IDEMPOTENCY_DB_PATH", "idempotency.db"))
+		if err != nil {
+			log.Fatal(err)
+		}
+		return store
+	default:
+		log.Fatalf("invalid IDEMPOTENCY_STORE %q", name)
+		return nil
+	}
+}
+
+type memoryIdempotencyEntry struct {
+	resp      *IdempotentResponse
+	expiresAt time.Time
+}
+
+type memoryIdempotencyStore struct {
+	mu      sync.Mutex
+	entries map[string]memoryIdempotencyEntry
+	swept   time.Time
+}
+
+func newMemoryIdempotencyStore() *memoryIdempotencyStore {
+	return &memoryIdempotencyStore{entries: map[string]memoryIdempotencyEntry{}}
+}
+
+func (s *memoryIdempotencyStore) Get(ctx context.Context, key string) (*IdempotentResponse, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entry, ok := s.entries[key]
+	if !ok || !time.Now().Before(entry.expiresAt) {
+		return nil, nil
+	}
+
+	return entry.resp, nil
+}
+
+func (s *memoryIdempotencyStore) Put(ctx context.Context, key string, resp *IdempotentResponse, ttl time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	// drop expired entries at most once per minute
+	if now.Sub(s.swept) >= time.Minute {
+		s.swept = now
+		for k, entry := range s.entries {
+			if !now.Before(entry.expiresAt) {
+				delete(s.entries, k)
+			}
+		}
+	}
+
+	s.entries[key] = memoryIdempotencyEntry{resp: resp, expiresAt: now.Add(ttl)}
+	return nil
+}
+
+// responses kept in a sqlite file, survive restarts of the public API
+type sqliteIdempotencyStore struct {
+	db *sql.DB
+}
+
+func newSQLiteIdempotencyStore(path string) (*sqliteIdempotencyStore, error) {
+	db, err := sql.Open("sqlite3", path)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = db.Exec(`CREATE TABLE IF NOT EXISTS idempotency_keys (
+		key TEXT NOT NULL PRIMARY KEY,
+		response TEXT NOT NULL,
+		expires_at INTEGER NOT NULL
+	)`)
+	if err != nil {
+		return nil, err
+	}
+
+	return &sqliteIdempotencyStore{db: db}, nil
+}
+
+func (s *sqliteIdempotencyStore) Get(ctx context.Context, key string) (*IdempotentResponse, error) {
+	var raw string
+	err := s.db.QueryRowContext(ctx, "SELECT response FROM idempotency_keys WHERE key=? AND expires_at>?", key, time.Now().UnixMicro()).Scan(&raw)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var resp IdempotentResponse
+	if err := json.Unmarshal([]byte(raw), &resp); err != nil {
+		return nil, err
+	}
+
+	return &resp, nil
+}
+
+func (s *sqliteIdempotencyStore) Put(ctx context.Context, key string, resp *IdempotentResponse, ttl time.Duration) error {
+	raw, err := json.Marshal(resp)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	if _, err := s.db.ExecContext(ctx, "DELETE FROM idempotency_keys WHERE expires_at<=?", now.UnixMicro()); err != nil {
+		return err
+	}
+	_, err = s.db.ExecContext(ctx, "INSERT OR REPLACE INTO idempotency_keys (key, response, expires_at) VALUES (?, ?, ?)",
+		key, string(raw), now.Add(ttl).UnixMicro())
+	return err
+}
@@ -0,0 +1,209 @@
+package publicapi
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// router creating one resource per request through the idempotency middleware, the user is taken from X-User-ID
+// as authMiddleware would set it and the client ip from X-Client-IP as clientIPMiddleware would
+func newIdempotencyRouter(store IdempotencyStore, status int) (*gin.Engine, *int) {
+	gin.SetMode(gin.TestMode)
+
+	created := 0
+	router := gin.New()
+	router.POST("/listings", func(c *gin.Context) {
+		if user := c.GetHeader("X-User-ID"); user != "" {
+			var id int
+			fmt.Sscan(user, &id)
+			c.Set(ctxKeyAuthUserID, id)
+		}
+		c.Set(ctxKeyClientIP, c.GetHeader("X-Client-IP"))
+	}, idempotencyMiddleware(store, time.Hour), func(c *gin.Context) {
+		created++
+		c.Header("Location", fmt.Sprintf("/listings/%d", created))
+		c.JSON(status, gin.H{"id": created, "key": idempotencyKey(c.Request.Context())})
+	})
+
+	return router, &created
+}
+
+func postIdempotent(router *gin.Engine, key, body string, header map[string]string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "/listings", strings.NewReader(body))
+	if key != "" {
+		req.Header.Set(headerIdempotencyKey, key)
+	}
+	for name, value := range header {
+		req.Header.Set(name, value)
+	}
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func TestIdempotencyMiddleware(t *testing.T) {
+	user1 := map[string]string{"X-User-ID": "1"}
+	user2 := map[string]string{"X-User-ID": "2"}
+
+	t.Run("repeat is replayed", func(t *testing.T) {
+		router, created := newIdempotencyRouter(newMemoryIdempotencyStore(), http.StatusCreated)
+
+		first := postIdempotent(router, "k1", `{"price": 6000}`, user1)
+		second := postIdempotent(router, "k1", `{"price": 6000}`, user1)
+
+		if *created != 1 {
+			t.Errorf("created %d times, want 1", *created)
+		}
+		if second.Code != http.StatusCreated || second.Body.String() != first.Body.String() {
+			t.Errorf("replay = %d %s, want %d %s", second.Code, second.Body, first.Code, first.Body)
+		}
+		if second.Header().Get(headerIdempotentReplayed) != "true" || first.Header().Get(headerIdempotentReplayed) != "" {
+			t.Errorf("%s = %q then %q, want only the replay marked", headerIdempotentReplayed,
+				first.Header().Get(headerIdempotentReplayed), second.Header().Get(headerIdempotentReplayed))
+		}
+		if got := second.Header().Get("Location"); got != "/listings/1" {
+			t.Errorf("Location of replay = %q, want /listings/1", got)
+		}
+		if !strings.Contains(first.Body.String(), `"key":"k1"`) {
+			t.Errorf("handler did not see the key in its context: %s", first.Body)
+		}
+	})
+
+	t.Run("other body with the same key", func(t *testing.T) {
+		router, created := newIdempotencyRouter(newMemoryIdempotencyStore(), http.StatusCreated)
+
+		postIdempotent(router, "k1", `{"price": 6000}`, user1)
+		w := postIdempotent(router, "k1", `{"price": 7000}`, user1)
+
+		if w.Code != http.StatusUnprocessableEntity || *created != 1 {
+			t.Errorf("status = %d after %d creates, want %d after 1", w.Code, *created, http.StatusUnprocessableEntity)
+		}
+	})
+
+	t.Run("keys are scoped per user", func(t *testing.T) {
+		router, created := newIdempotencyRouter(newMemoryIdempotencyStore(), http.StatusCreated)
+
+		postIdempotent(router, "k1", `{"price": 6000}`, user1)
+		w := postIdempotent(router, "k1", `{"price": 6000}`, user2)
+
+		if *created != 2 || w.Header().Get(headerIdempotentReplayed) != "" {
+			t.Errorf("created %d times, want the key of user 1 not replayed to user 2", *created)
+		}
+	})
+
+	t.Run("anonymous keys are scoped per client ip", func(t *testing.T) {
+		router, created := newIdempotencyRouter(newMemoryIdempotencyStore(), http.StatusCreated)
+
+		postIdempotent(router, "k1", `{"name": "a"}`, map[string]string{"X-Client-IP": "203.0.113.1"})
+		postIdempotent(router, "k1", `{"name": "a"}`, map[string]string{"X-Client-IP": "203.0.113.2"})
+		w := postIdempotent(router, "k1", `{"name": "a"}`, map[string]string{"X-Client-IP": "203.0.113.1"})
+
+		if *created != 2 || w.Header().Get(headerIdempotentReplayed) != "true" {
+			t.Errorf("created %d times, want 2 with the repeat of the first ip replayed", *created)
+		}
+	})
+
+	t.Run("server errors are not stored", func(t *testing.T) {
+		router, created := newIdempotencyRouter(newMemoryIdempotencyStore(), http.StatusBadGateway)
+
+		postIdempotent(router, "k1", `{"price": 6000}`, user1)
+		postIdempotent(router, "k1", `{"price": 6000}`, user1)
+
+		if *created != 2 {
+			t.Errorf("created %d times, want the retry of a 502 to run again", *created)
+		}
+	})
+
+	t.Run("client errors are stored", func(t *testing.T) {
+		router, created := newIdempotencyRouter(newMemoryIdempotencyStore(), http.StatusBadRequest)
+
+		postIdempotent(router, "k1", `{"price": -1}`, user1)
+		w := postIdempotent(router, "k1", `{"price": -1}`, user1)
+
+		if *created != 1 || w.Code != http.StatusBadRequest {
+			t.Errorf("created %d times with status %d, want the 400 replayed", *created, w.Code)
+		}
+	})
+
+	t.Run("without key", func(t *testing.T) {
+		router, created := newIdempotencyRouter(newMemoryIdempotencyStore(), http.StatusCreated)
+
+		postIdempotent(router, "", `{"price": 6000}`, user1)
+		postIdempotent(router, "", `{"price": 6000}`, user1)
+
+		if *created != 2 {
+			t.Errorf("created %d times, want 2", *created)
+		}
+	})
+
+	t.Run("key too long", func(t *testing.T) {
+		router, created := newIdempotencyRouter(newMemoryIdempotencyStore(), http.StatusCreated)
+
+		if w := postIdempotent(router, strings.Repeat("k", 255), `{}`, user1); w.Code != http.StatusCreated {
+			t.Errorf("255 character key: status = %d, want %d", w.Code, http.StatusCreated)
+		}
+		if w := postIdempotent(router, strings.Repeat("k", 256), `{}`, user1); w.Code != http.StatusBadRequest {
+			t.Errorf("256 character key: status = %d, want %d", w.Code, http.StatusBadRequest)
+		}
+		if *created != 1 {
+			t.Errorf("created %d times, want 1", *created)
+		}
+	})
+}
+
+func TestIdempotencyStores(t *testing.T) {
+	sqliteStore, err := newSQLiteIdempotencyStore(filepath.Join(t.TempDir(), "idempotency.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stores := map[string]IdempotencyStore{
+		"memory": newMemoryIdempotencyStore(),
+		"sqlite": sqliteStore,
+	}
+
+	for name, store := range stores {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+
+			if got, err := store.Get(ctx, "missing"); got != nil || err != nil {
+				t.Errorf("Get missing = %v, %v, want nil", got, err)
+			}
+
+			resp := &IdempotentResponse{
+				Fingerprint: "abc",
+				Status:      http.StatusCreated,
+				Header:      map[string][]string{"Location": {"/listings/1"}},
+				Body:        []byte(`{"id": 1}`),
+			}
+			if err := store.Put(ctx, "kept", resp, time.Hour); err != nil {
+				t.Fatal(err)
+			}
+			if err := store.Put(ctx, "expired", resp, -time.Second); err != nil {
+				t.Fatal(err)
+			}
+
+			got, err := store.Get(ctx, "kept")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got == nil || got.Fingerprint != "abc" || got.Status != http.StatusCreated ||
+				got.Header["Location"][0] != "/listings/1" || string(got.Body) != `{"id": 1}` {
+				t.Errorf("Get kept = %+v, want %+v", got, resp)
+			}
+
+			if got, err := store.Get(ctx, "expired"); got != nil || err != nil {
+				t.Errorf("Get expired = %v, %v, want nil", got, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,278 @@
+package publicapi
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"log"
+	"slices"
+	"strconv"
+	"strings"
+
+	"apperror"
+
+	"golang.org/x/image/draw"
+	_ "golang.org/x/image/webp"
+)
+
+var (
+	// MEDIA_IMAGE_MAX_DIMENSION longest side of stored images in pixels, larger ones are scaled down
+	imageMaxDimension = cfg.Int("MEDIA_IMAGE_MAX_DIMENSION", 2560)
+	// MEDIA_IMAGE_MAX_PIXELS largest image accepted for decoding, so a small file can not expand into a huge bitmap
+	imageMaxPixels = cfg.Int("MEDIA_IMAGE_MAX_PIXELS", 50_000_000)
+	// MEDIA_IMAGE_JPEG_QUALITY quality of re-encoded jpeg images, 1 to 100
+	imageJPEGQuality = cfg.Int("MEDIA_IMAGE_JPEG_QUALITY", 85)
+	// MEDIA_THUMBNAIL_WIDTHS comma separated widths in pixels of the thumbnails generated for uploaded images, none for
+	// none. Only the widths under the one of the image are generated
+	imageThumbnailWidths = parseThumbnailWidths(cfg.String("MEDIA_THUMBNAIL_WIDTHS", "320,640,1280"))
+)
+
+var (
+	errImageInvalid  = apperror.Validation("invalid image, the file could not be decoded")
+	errImageTooLarge = apperror.Validation("image has too many pixels")
+)
+
+// image re-encoded by normalizeImage with the content type and extension it is stored with
+type normalizedImage struct {
+	data          []byte
+	contentType   string
+	ext           string
+	width, height int
+	// decoded image the thumbnails are scaled from
+	img image.Image
+}
+
+// thumbnail of a normalized image, encoded as the image is
+type imageThumbnail struct {
+	width int
+	data  []byte
+}
+
+// =========== USECASE LAYER, SERVES AS AN INTERMEDIARY BETWEEN THE PRESENTATION LAYER AND THE DATA LAYER ===========
+
+// decode an uploaded image and encode it again without metadata, so EXIF and GPS tags never reach the stored file,
+// turned upright by its EXIF orientation and scaled down to imageMaxDimension. Jpeg stays jpeg, png stays png and
+// webp becomes jpeg, or png when it has transparency
+func normalizeImage(r io.Reader, contentType string) (*normalizedImage, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, errImageInvalid
+	}
+	if config.Width*config.Height > imageMaxPixels {
+		return nil, errImageTooLarge
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, errImageInvalid
+	}
+
+	orientation := 1
+	if contentType == "image/jpeg" {
+		orientation = jpegOrientation(data)
+	}
+	img = orientImage(scaleImage(img, imageMaxDimension), orientation)
+
+	var out bytes.Buffer
+	if contentType == "image/png" || (contentType == "image/webp" && !isOpaque(img)) {
+		if err := png.Encode(&out, img); err != nil {
+			return nil, err
+		}
+		return &normalizedImage{data: out.Bytes(), contentType: "image/png", ext: ".png", width: img.Bounds().Dx(), height: img.Bounds().Dy(), img: img}, nil
+	}
+
+	if err := jpeg.Encode(&out, img, &jpeg.Options{Quality: imageJPEGQuality}); err != nil {
+		return nil, err
+	}
+	return &normalizedImage{data: out.Bytes(), contentType: "image/jpeg", ext: ".jpg", width: img.Bounds().Dx(), height: img.Bounds().Dy(), img: img}, nil
+}
+
+// thumbnails of normalized at each of MEDIA_THUMBNAIL_WIDTHS under its width, narrowest first, the height keeps the
+// aspect ratio
+func thumbnailImages(normalized *normalizedImage) ([]imageThumbnail, error) {
+	var thumbnails []imageThumbnail
+	for _, width := range imageThumbnailWidths {
+		if width >= normalized.width {
+			break
+		}
+
+		height := max(1, normalized.height*width/normalized.width)
+		dst := image.NewNRGBA(image.Rect(0, 0, width, height))
+		draw.CatmullRom.Scale(dst, dst.Bounds(), normalized.img, normalized.img.Bounds(), draw.Src, nil)
+
+		var out bytes.Buffer
+		var err error
+		if normalized.contentType == "image/png" {
+			err = png.Encode(&out, dst)
+		} else {
+			err = jpeg.Encode(&out, dst, &jpeg.Options{Quality: imageJPEGQuality})
+		}
+		if err != nil {
+			return nil, err
+		}
+		thumbnails = append(thumbnails, imageThumbnail{width: width, data: out.Bytes()})
+	}
+
+	return thumbnails, nil
+}
+
+// sorted distinct positive widths of a comma separated list, none for no thumbnails
+func parseThumbnailWidths(value string) []int {
+	if value == "none" {
+		return nil
+	}
+
+	var widths []int
+	for _, item := range strings.Split(value, ",") {
+		width, err := strconv.Atoi(strings.TrimSpace(item))
+		if err != nil || width <= 0 {
+			log.Fatalf("invalid MEDIA_THUMBNAIL_WIDTHS %q, comma separated widths in pixels or none", value)
+		}
+		widths = append(widths, width)
+	}
+	slices.Sort(widths)
+	return slices.Compact(widths)
+}
+
+// scale img down so its longest side is at most limit, smaller images are returned as they are
+func scaleImage(img image.Image, limit int) image.Image {
+	bounds := img.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	if limit <= 0 || (width <= limit && height <= limit) {
+		return img
+	}
+
+	if width >= height {
+		width, height = limit, max(1, height*limit/width)
+	} else {
+		width, height = max(1, width*limit/height), limit
+	}
+
+	dst := image.NewNRGBA(image.Rect(0, 0, width, height))
+	draw.CatmullRom.Scale(dst, dst.Bounds(), img, bounds, draw.Src, nil)
+	return dst
+}
+
+// turn img upright for EXIF orientation 2 to 8, flipped and rotated as the camera recorded it
+func orientImage(img image.Image, orientation int) image.Image {
+	if orientation < 2 || orientation > 8 {
+		return img
+	}
+
+	bounds := img.Bounds()
+	w, h := bounds.Dx(), bounds.Dy()
+
+	// orientations 5 to 8 swap width and height
+	dstW, dstH := w, h
+	if orientation >= 5 {
+		dstW, dstH = h, w
+	}
+
+	dst := image.NewNRGBA(image.Rect(0, 0, dstW, dstH))
+	for y := 0; y < dstH; y++ {
+		for x := 0; x < dstW; x++ {
+			var sx, sy int
+			switch orientation {
+			case 2: // mirrored
+				sx, sy = w-1-x, y
+			case 3: // rotated 180
+				sx, sy = w-1-x, h-1-y
+			case 4: // mirrored vertically
+				sx, sy = x, h-1-y
+			case 5: // transposed
+				sx, sy = y, x
+			case 6: // rotated 90 clockwise to be upright
+				sx, sy = y, h-1-x
+			case 7: // transversed
+				sx, sy = w-1-y, h-1-x
+			case 8: // rotated 90 counter clockwise to be upright
+				sx, sy = w-1-y, x
+			}
+			dst.Set(x, y, img.At(bounds.Min.X+sx, bounds.Min.Y+sy))
+		}
+	}
+
+	return dst
+}
+
+// report whether every pixel of img is fully opaque
+func isOpaque(img image.Image) bool {
+	if opaque, ok := img.(interface{ Opaque() bool }); ok {
+		return opaque.Opaque()
+	}
+
+	return true
+}
+
+// orientation tag of the EXIF segment of a jpeg, 1 (upright) when there is none
+func jpegOrientation(data []byte) int {
+	if len(data) < 2 || data[0] != 0xFF || data[1] != 0xD8 {
+		return 1
+	}
+
+	// walk the marker segments up to the start of the image data
+	for pos := 2; pos+4 <= len(data); {
+		if data[pos] != 0xFF {
+			return 1
+		}
+		marker := data[pos+1]
+		length := int(binary.BigEndian.Uint16(data[pos+2:]))
+		if marker == 0xDA || length < 2 || pos+2+length > len(data) {
+			return 1
+		}
+
+		segment := data[pos+4 : pos+2+length]
+		if marker == 0xE1 && bytes.HasPrefix(segment, []byte("Exif\x00\x00")) {
+			return exifOrientation(segment[6:])
+		}
+		pos += 2 + length
+	}
+
+	return 1
+}
+
+// orientation tag 0x0112 of the first IFD of a TIFF structure
+func exifOrientation(tiff []byte) int {
+	if len(tiff) < 8 {
+		return 1
+	}
+
+	var order binary.ByteOrder
+	switch string(tiff[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return 1
+	}
+
+	ifd := int(order.Uint32(tiff[4:]))
+	if ifd < 8 || ifd+2 > len(tiff) {
+		return 1
+	}
+
+	entries := int(order.Uint16(tiff[ifd:]))
+	for i := 0; i < entries; i++ {
+		entry := ifd + 2 + i*12
+		if entry+12 > len(tiff) {
+			return 1
+		}
+		if order.Uint16(tiff[entry:]) == 0x0112 {
+			if orientation := int(order.Uint16(tiff[entry+8:])); orientation >= 1 && orientation <= 8 {
+				return orientation
+			}
+			return 1
+		}
+	}
+
+	return 1
+}
@@ -0,0 +1,222 @@
+package publicapi
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"testing"
+)
+
+// jpeg of width x height with an EXIF segment carrying orientation and a GPS latitude ref tag
+func jpegWithOrientation(t *testing.T, width, height, orientation int, order binary.ByteOrder) []byte {
+	t.Helper()
+
+	var encoded bytes.Buffer
+	if err := jpeg.Encode(&encoded, image.NewRGBA(image.Rect(0, 0, width, height)), nil); err != nil {
+		t.Fatal(err)
+	}
+
+	// TIFF header and one IFD with orientation and GPSLatitudeRef
+	tiff := make([]byte, 8+2+2*12+4)
+	if order == binary.LittleEndian {
+		copy(tiff, "II")
+	} else {
+		copy(tiff, "MM")
+	}
+	order.PutUint16(tiff[2:], 42)
+	order.PutUint32(tiff[4:], 8)
+	order.PutUint16(tiff[8:], 2)
+	order.PutUint16(tiff[10:], 0x0001)
+	order.PutUint16(tiff[12:], 2)
+	order.PutUint32(tiff[14:], 2)
+	copy(tiff[18:], "N")
+	order.PutUint16(tiff[22:], 0x0112)
+	order.PutUint16(tiff[24:], 3)
+	order.PutUint32(tiff[26:], 1)
+	order.PutUint16(tiff[30:], uint16(orientation))
+
+	segment := append([]byte("Exif\x00\x00"), tiff...)
+	app1 := []byte{0xFF, 0xE1, 0, 0}
+	binary.BigEndian.PutUint16(app1[2:], uint16(len(segment)+2))
+
+	data := encoded.Bytes()
+	out := append([]byte{}, data[:2]...)
+	out = append(out, app1...)
+	out = append(out, segment...)
+	return append(out, data[2:]...)
+}
+
+func TestJPEGOrientation(t *testing.T) {
+	tests := []struct {
+		name string
+		data func(t *testing.T) []byte
+		want int
+	}{
+		{name: "little endian", data: func(t *testing.T) []byte { return jpegWithOrientation(t, 4, 2, 6, binary.LittleEndian) }, want: 6},
+		{name: "big endian", data: func(t *testing.T) []byte { return jpegWithOrientation(t, 4, 2, 8, binary.BigEndian) }, want: 8},
+		{name: "out of range tag", data: func(t *testing.T) []byte { return jpegWithOrientation(t, 4, 2, 9, binary.BigEndian) }, want: 1},
+		{name: "no exif", data: func(t *testing.T) []byte {
+			var buf bytes.Buffer
+			jpeg.Encode(&buf, image.NewRGBA(image.Rect(0, 0, 2, 2)), nil)
+			return buf.Bytes()
+		}, want: 1},
+		{name: "not a jpeg", data: func(t *testing.T) []byte { return []byte("GIF89a") }, want: 1},
+		{name: "truncated segment", data: func(t *testing.T) []byte { return []byte{0xFF, 0xD8, 0xFF, 0xE1, 0x10, 0x00, 'E'} }, want: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := jpegOrientation(tt.data(t)); got != tt.want {
+				t.Errorf("jpegOrientation = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestOrientImage(t *testing.T) {
+	// 2x1 image, red on the left and blue on the right
+	red := color.NRGBA{R: 255, A: 255}
+	blue := color.NRGBA{B: 255, A: 255}
+	src := image.NewNRGBA(image.Rect(0, 0, 2, 1))
+	src.Set(0, 0, red)
+	src.Set(1, 0, blue)
+
+	tests := []struct {
+		orientation int
+		// size and pixel at the origin of the upright image
+		width, height int
+		origin        color.NRGBA
+	}{
+		{orientation: 1, width: 2, height: 1, origin: red},
+		{orientation: 2, width: 2, height: 1, origin: blue},
+		{orientation: 3, width: 2, height: 1, origin: blue},
+		{orientation: 4, width: 2, height: 1, origin: red},
+		{orientation: 5, width: 1, height: 2, origin: red},
+		{orientation: 6, width: 1, height: 2, origin: red},
+		{orientation: 7, width: 1, height: 2, origin: blue},
+		{orientation: 8, width: 1, height: 2, origin: blue},
+	}
+
+	for _, tt := range tests {
+		got := orientImage(src, tt.orientation)
+		if got.Bounds().Dx() != tt.width || got.Bounds().Dy() != tt.height {
+			t.Errorf("orientation %d: size = %v, want %dx%d", tt.orientation, got.Bounds().Size(), tt.width, tt.height)
+			continue
+		}
+		if c := color.NRGBAModel.Convert(got.At(0, 0)); c != tt.origin {
+			t.Errorf("orientation %d: origin = %v, want %v", tt.orientation, c, tt.origin)
+		}
+	}
+}
+
+func TestScaleImage(t *testing.T) {
+	tests := []struct {
+		name          string
+		width, height int
+		limit         int
+		wantW, wantH  int
+	}{
+		{name: "smaller than limit", width: 100, height: 50, limit: 200, wantW: 100, wantH: 50},
+		{name: "at limit", width: 200, height: 50, limit: 200, wantW: 200, wantH: 50},
+		{name: "landscape", width: 400, height: 100, limit: 200, wantW: 200, wantH: 50},
+		{name: "portrait", width: 100, height: 400, limit: 200, wantW: 50, wantH: 200},
+		{name: "thin side kept at one pixel", width: 1000, height: 1, limit: 10, wantW: 10, wantH: 1},
+		{name: "no limit", width: 400, height: 100, limit: 0, wantW: 400, wantH: 100},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := scaleImage(image.NewNRGBA(image.Rect(0, 0, tt.width, tt.height)), tt.limit).Bounds()
+			if got.Dx() != tt.wantW || got.Dy() != tt.wantH {
+				t.Errorf("size = %dx%d, want %dx%d", got.Dx(), got.Dy(), tt.wantW, tt.wantH)
+			}
+		})
+	}
+}
+
+func TestNormalizeImage(t *testing.T) {
+	t.Run("jpeg loses exif and is turned upright", func(t *testing.T) {
+		data := jpegWithOrientation(t, 40, 20, 6, binary.BigEndian)
+
+		got, err := normalizeImage(bytes.NewReader(data), "image/jpeg")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.contentType != "image/jpeg" || got.ext != ".jpg" {
+			t.Errorf("stored as %s %s, want image/jpeg .jpg", got.contentType, got.ext)
+		}
+		if bytes.Contains(got.data, []byte("Exif")) {
+			t.Error("normalized jpeg still has an EXIF segment")
+		}
+
+		config, err := jpeg.DecodeConfig(bytes.NewReader(got.data))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if config.Width != 20 || config.Height != 40 {
+			t.Errorf("size = %dx%d, want 20x40", config.Width, config.Height)
+		}
+	})
+
+	t.Run("png stays png", func(t *testing.T) {
+		var buf bytes.Buffer
+		png.Encode(&buf, image.NewNRGBA(image.Rect(0, 0, 3, 3)))
+
+		got, err := normalizeImage(&buf, "image/png")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.contentType != "image/png" || got.ext != ".png" {
+			t.Errorf("stored as %s %s, want image/png .png", got.contentType, got.ext)
+		}
+	})
+
+	t.Run("too many pixels", func(t *testing.T) {
+		previous := imageMaxPixels
+		imageMaxPixels = 100
+		defer func() { imageMaxPixels = previous }()
+
+		var buf bytes.Buffer
+		png.Encode(&buf, image.NewGray(image.Rect(0, 0, 10, 11)))
+
+		if _, err := normalizeImage(&buf, "image/png"); err != errImageTooLarge {
+			t.Errorf("err = %v, want %v", err, errImageTooLarge)
+		}
+	})
+
+	t.Run("corrupt image", func(t *testing.T) {
+		if _, err := normalizeImage(bytes.NewReader([]byte{0xFF, 0xD8, 0xFF}), "image/jpeg"); err != errImageInvalid {
+			t.Errorf("err = %v, want %v", err, errImageInvalid)
+		}
+	})
+}
+
+func TestThumbnailImages(t *testing.T) {
+	var buf bytes.Buffer
+	png.Encode(&buf, image.NewNRGBA(image.Rect(0, 0, 800, 400)))
+	normalized, err := normalizeImage(&buf, "image/png")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// widths at or above the image are skipped, the image itself serves them
+	thumbnails, err := thumbnailImages(normalized)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(thumbnails) != 2 {
+		t.Fatalf("got %d thumbnails, want 320 and 640", len(thumbnails))
+	}
+	for i, want := range []int{320, 640} {
+		config, err := png.DecodeConfig(bytes.NewReader(thumbnails[i].data))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if thumbnails[i].width != want || config.Width != want || config.Height != want/2 {
+			t.Errorf("thumbnail %d is %dx%d at width %d, want %dx%d", i, config.Width, config.Height, thumbnails[i].width, want, want/2)
+		}
+	}
+}
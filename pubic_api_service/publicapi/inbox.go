@@ -0,0 +1,256 @@
+package publicapi
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"apperror"
+
+	"github.com/gin-gonic/gin"
+)
+
+// notification of the in-app channel kept in the inbox of a user, read_at is nil until the user read it
+type InboxNotification struct {
+	ID        int64             `json:"id"`
+	UserID    int               `json:"user_id"`
+	Event     string            `json:"event"`
+	Title     string            `json:"title"`
+	Body      string            `json:"body"`
+	Data      map[string]string `json:"data"`
+	ReadAt    *int64            `json:"read_at"`
+	CreatedAt int64             `json:"created_at"`
+}
+
+type InboxNotificationCreate struct {
+	Event string            `json:"event"`
+	Title string            `json:"title"`
+	Body  string            `json:"body"`
+	Data  map[string]string `json:"data"`
+}
+
+// notifications to mark read, every unread notification when ids is empty
+type InboxRead struct {
+	IDs []int64 `json:"ids" binding:"max=100"`
+}
+
+type InboxNotificationResponse struct {
+	Result       bool `json:"result"`
+	Notification InboxNotification
+}
+
+type InboxNotificationsResponse struct {
+	Result        bool `json:"result"`
+	Notifications []InboxNotification
+	UnreadCount   int        `json:"unread_count"`
+	Pagination    Pagination `json:"pagination"`
+}
+
+type InboxReadResponse struct {
+	Result      bool `json:"result"`
+	Updated     int  `json:"updated"`
+	UnreadCount int  `json:"unread_count"`
+}
+
+var errInboxPage = apperror.Validation("page_num must be at least 1 and page_size between 1 and 50")
+
+// =========== INTERFACE HANDLER, HANDLING REQUEST RESPONSE API DEPEND INTERFACE ===========
+
+// inbox of the authenticated user newest first with the count of unread notifications for the bell icon,
+// ?unread=true for the unread ones only
+func getMyNotificationsHandler(c *gin.Context) {
+	pageNum, errNum := strconv.Atoi(c.DefaultQuery("page_num", "1"))
+	pageSize, errSize := strconv.Atoi(c.DefaultQuery("page_size", "20"))
+	if errNum != nil || errSize != nil {
+		apperror.Respond(c, errInboxPage)
+		return
+	}
+
+	unread, err := strconv.ParseBool(c.DefaultQuery("unread", "false"))
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "handler error", "code", "365", "error", err)
+		apperror.JSON(c, http.StatusBadRequest, "unread must be true or false")
+		return
+	}
+
+	res, err := getMyNotificationsUsecase(c.Request.Context(), authUserID(c), unread, pageNum, pageSize)
+	if err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"notifications": res.Notifications, "unread_count": res.UnreadCount, "pagination": res.Pagination})
+}
+
+// mark the notifications of ids read, every unread notification of the user without a body or ids
+func markNotificationsReadHandler(c *gin.Context) {
+	var body InboxRead
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&body); err != nil {
+			slog.ErrorContext(c.Request.Context(), "handler error", "code", "366", "error", err)
+			apperror.RespondBinding(c, err)
+			return
+		}
+	}
+
+	res, err := markNotificationsReadUsecase(c.Request.Context(), authUserID(c), body)
+	if err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"updated": res.Updated, "unread_count": res.UnreadCount})
+}
+
+// mark one notification read, when the user opens it
+func markNotificationReadHandler(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil || id < 1 {
+		slog.ErrorContext(c.Request.Context(), "handler error", "code", "367", "error", "Invalid notification ID")
+		apperror.JSON(c, http.StatusBadRequest, "Invalid notification ID")
+		return
+	}
+
+	res, err := markNotificationsReadUsecase(c.Request.Context(), authUserID(c), InboxRead{IDs: []int64{id}})
+	if err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"updated": res.Updated, "unread_count": res.UnreadCount})
+}
+
+// =========== USECASE LAYER, SERVES AS AN INTERMEDIARY BETWEEN THE PRESENTATION LAYER AND THE DATA LAYER ===========
+
+func getMyNotificationsUsecase(ctx context.Context, userID int, unread bool, pageNum, pageSize int) (*InboxNotificationsResponse, error) {
+	if pageNum < 1 || pageSize < 1 || pageSize > 50 {
+		return nil, errInboxPage
+	}
+
+	res, err := userClient.FindUserInbox(ctx, userID, unread, pageNum, pageSize)
+	if err != nil {
+		if errors.Is(err, ErrUserNotFound) {
+			return nil, err
+		}
+		return nil, apperror.Upstream("Failed to get notifications", err)
+	}
+
+	return res, nil
+}
+
+// ids of other users are ignored, marking a notification read again changes nothing
+func markNotificationsReadUsecase(ctx context.Context, userID int, read InboxRead) (*InboxReadResponse, error) {
+	readJSON, err := json.Marshal(read)
+	if err != nil {
+		slog.ErrorContext(ctx, "usecase error", "code", "368", "error", err)
+		return nil, err
+	}
+
+	res, err := userClient.MarkInboxRead(ctx, userID, readJSON)
+	if err != nil {
+		return nil, apperror.Upstream("Failed to mark notifications read", err)
+	}
+
+	return res, nil
+}
+
+// =========== REPOSITORY LAYER, ABSTRACTION OVER THE DATA PERSISTENCE (databases, file systems, or external APIs) ===========
+
+// keep n in the inbox of its user, rendered with the in_app template of its event
+func storeInboxNotification(ctx context.Context, n Notification) error {
+	msg := newPushMessage(ctx, n, "in_app")
+	notificationJSON, err := json.Marshal(InboxNotificationCreate{Event: n.Event, Title: msg.Title, Body: msg.Body, Data: msg.Data})
+	if err != nil {
+		return err
+	}
+
+	_, err = userClient.CreateInboxNotification(ctx, n.UserID, notificationJSON)
+	return err
+}
+
+var (
+	// user service api path
+	apiPathUserInbox     = userServiceURL + "/users/%d/inbox"
+	apiPathUserInboxRead = userServiceURL + "/users/%d/inbox/read"
+)
+
+func (httpUserClient) FindUserInbox(ctx context.Context, userID int, unread bool, pageNum, pageSize int) (*InboxNotificationsResponse, error) {
+	query := url.Values{"unread": {strconv.FormatBool(unread)}, "page_num": {strconv.Itoa(pageNum)}, "page_size": {strconv.Itoa(pageSize)}}
+	resp, err := httpGet(ctx, fmt.Sprintf(apiPathUserInbox, userID)+"?"+query.Encode())
+	if err != nil {
+		slog.ErrorContext(ctx, "service error", "code", "369", "error", err)
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		return nil, ErrUserNotFound
+	default:
+		slog.ErrorContext(ctx, "service error", "code", "370", "error", "error fetching inbox from user service")
+		return nil, errors.New("error fetching inbox from user service")
+	}
+
+	var inbox InboxNotificationsResponse
+	if err := decodeJSON(resp.Body, &inbox); err != nil {
+		slog.ErrorContext(ctx, "service error", "code", "371", "error", err)
+		return nil, err
+	}
+
+	return &inbox, nil
+}
+
+func (httpUserClient) CreateInboxNotification(ctx context.Context, userID int, notificationByte []byte) (*InboxNotificationResponse, error) {
+	resp, err := httpPost(ctx, fmt.Sprintf(apiPathUserInbox, userID), "application/json", bytes.NewBuffer(notificationByte))
+	if err != nil {
+		slog.ErrorContext(ctx, "service error", "code", "372", "error", err)
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusCreated:
+	case http.StatusNotFound:
+		return nil, ErrUserNotFound
+	default:
+		slog.ErrorContext(ctx, "service error", "code", "373", "error", "error creating inbox notification from user service")
+		return nil, errors.New("error creating inbox notification from user service")
+	}
+
+	var notification InboxNotificationResponse
+	if err := decodeJSON(resp.Body, &notification); err != nil {
+		slog.ErrorContext(ctx, "service error", "code", "374", "error", err)
+		return nil, err
+	}
+
+	return &notification, nil
+}
+
+func (httpUserClient) MarkInboxRead(ctx context.Context, userID int, readByte []byte) (*InboxReadResponse, error) {
+	resp, err := httpPost(ctx, fmt.Sprintf(apiPathUserInboxRead, userID), "application/json", bytes.NewBuffer(readByte))
+	if err != nil {
+		slog.ErrorContext(ctx, "service error", "code", "375", "error", err)
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		slog.ErrorContext(ctx, "service error", "code", "376", "error", "error marking inbox read from user service")
+		return nil, errors.New("error marking inbox read from user service")
+	}
+
+	var read InboxReadResponse
+	if err := decodeJSON(resp.Body, &read); err != nil {
+		slog.ErrorContext(ctx, "service error", "code", "376", "error", err)
+		return nil, err
+	}
+
+	return &read, nil
+}
@@ -0,0 +1,118 @@
+package publicapi
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+// user client keeping the inbox notifications created and the ids marked read
+type inboxUserClient struct {
+	preferencesUserClient
+
+	mu      *sync.Mutex
+	created *[]InboxNotificationCreate
+	read    *[]InboxRead
+}
+
+func (c inboxUserClient) CreateInboxNotification(ctx context.Context, userID int, notificationByte []byte) (*InboxNotificationResponse, error) {
+	var create InboxNotificationCreate
+	if err := json.Unmarshal(notificationByte, &create); err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	*c.created = append(*c.created, create)
+	return &InboxNotificationResponse{Result: true}, nil
+}
+
+func (c inboxUserClient) MarkInboxRead(ctx context.Context, userID int, readByte []byte) (*InboxReadResponse, error) {
+	var read InboxRead
+	if err := json.Unmarshal(readByte, &read); err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	*c.read = append(*c.read, read)
+	return &InboxReadResponse{Result: true, Updated: len(read.IDs), UnreadCount: 3}, nil
+}
+
+func newInboxUserClient(preferences map[int]map[string]map[string]bool) (inboxUserClient, *[]InboxNotificationCreate, *[]InboxRead) {
+	var created []InboxNotificationCreate
+	var read []InboxRead
+	client := inboxUserClient{preferencesUserClient: preferencesUserClient{preferences: preferences}, mu: &sync.Mutex{}, created: &created, read: &read}
+	return client, &created, &read
+}
+
+func TestNotifyInbox(t *testing.T) {
+	notifications := newNotificationRecorder(t)
+	client, created, _ := newInboxUserClient(map[int]map[string]map[string]bool{
+		1: {notificationOfferAccepted: {"email": false, "push": false, "in_app": true}},
+		2: {notificationOfferAccepted: {"email": true, "push": false, "in_app": false}},
+	})
+	userClient = client
+
+	for _, userID := range []int{1, 2} {
+		notify(context.Background(), Notification{Event: notificationOfferAccepted, UserID: userID, ListingID: 5, OfferID: 7, Amount: 1000})
+	}
+
+	got := notifications()
+	if len(got) != 1 || got[0].UserID != 2 {
+		t.Fatalf("webhook got %+v, want user 2 only, user 1 only enabled in-app", got)
+	}
+
+	want := []InboxNotificationCreate{{
+		Event: notificationOfferAccepted,
+		Title: "Offer accepted",
+		Body:  "Your offer of " + listingCurrency + " 1,000 was accepted",
+		Data:  map[string]string{"event": notificationOfferAccepted, "listing_id": "5", "offer_id": "7"},
+	}}
+	if !reflect.DeepEqual(*created, want) {
+		t.Errorf("inbox got %+v, want %+v", *created, want)
+	}
+}
+
+func TestMarkNotificationsRead(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	previous := userClient
+	t.Cleanup(func() { userClient = previous })
+	client, _, read := newInboxUserClient(nil)
+	userClient = client
+
+	router := gin.New()
+	router.Use(func(c *gin.Context) { c.Set(ctxKeyAuthUserID, 1) })
+	router.POST("/me/notifications/read", markNotificationsReadHandler)
+	router.POST("/me/notifications/:id/read", markNotificationReadHandler)
+
+	for _, tt := range []struct {
+		path, body string
+		wantStatus int
+	}{
+		{"/me/notifications/read", "", http.StatusOK},
+		{"/me/notifications/read", `{"ids": [4, 5]}`, http.StatusOK},
+		{"/me/notifications/9/read", "", http.StatusOK},
+		{"/me/notifications/x/read", "", http.StatusBadRequest},
+		{"/me/notifications/read", `{"ids": "all"}`, http.StatusBadRequest},
+	} {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, tt.path, strings.NewReader(tt.body)))
+		if w.Code != tt.wantStatus {
+			t.Errorf("POST %s %s = %d %s, want %d", tt.path, tt.body, w.Code, w.Body, tt.wantStatus)
+		}
+	}
+
+	want := []InboxRead{{}, {IDs: []int64{4, 5}}, {IDs: []int64{9}}}
+	if !reflect.DeepEqual(*read, want) {
+		t.Errorf("marked read %+v, want %+v", *read, want)
+	}
+}
@@ -0,0 +1,504 @@
+package publicapi
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"apperror"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	jobQueued    = "queued"
+	jobRunning   = "running"
+	jobSucceeded = "succeeded"
+	jobFailed    = "failed"
+	jobCancelled = "cancelled"
+)
+
+// long running operation of a user, run by the job workers
+type Job struct {
+	ID         string          `json:"id"`
+	Kind       string          `json:"kind"`
+	Status     string          `json:"status"`
+	UserID     int             `json:"user_id"`
+	Params     json.RawMessage `json:"params,omitempty"`
+	Progress   JobProgress     `json:"progress"`
+	Result     json.RawMessage `json:"result,omitempty"`
+	Errors     []string        `json:"errors"`
+	CreatedAt  int64           `json:"created_at"`
+	UpdatedAt  int64           `json:"updated_at"`
+	FinishedAt int64           `json:"finished_at,omitempty"`
+}
+
+// items processed so far, total is 0 until known
+type JobProgress struct {
+	Done  int `json:"done"`
+	Total int `json:"total"`
+}
+
+type JobCreate struct {
+	Kind   string          `json:"kind" binding:"required"`
+	Params json.RawMessage `json:"params"`
+}
+
+// run one job, report progress as it goes, item errors are collected without failing the whole job
+// a runner stops when ctx is done and returns the result so far with the error
+type jobRunner func(ctx context.Context, job *Job, progress func(done, total int)) (result interface{}, itemErrors []string, err error)
+
+// operations available on the jobs api
+var jobKinds = map[string]jobRunner{
+	"export_listings": exportListingsJob,
+}
+
+var (
+	errJobNotFound    = apperror.NotFound("Job not found")
+	errJobKindInvalid = apperror.Validation("invalid kind, supported values: export_listings")
+	errJobQueueFull   = errors.New("job queue is full, try again later")
+	errJobShutdown    = errors.New("service shutting down, start the job again")
+	errJobCancelled   = errors.New("job cancelled")
+	errJobFinished    = apperror.Conflict("job already finished")
+)
+
+// JOBS_DIR directory keeping one json file per job
+// JOB_WORKERS jobs running at the same time
+// JOB_QUEUE_SIZE jobs waiting to run before new ones are rejected
+// JOB_RETENTION how long finished jobs stay readable before cleanup
+var (
+	jobsDir      = cfg.String("JOBS_DIR", "jobs")
+	jobRetention = cfg.Duration("JOB_RETENTION", 7*24*time.Hour)
+	jobQueue     = make(chan string, cfg.Int("JOB_QUEUE_SIZE", 100))
+
+	// serialize file access between handlers and workers
+	jobsMu sync.Mutex
+
+	jobWorkers sync.WaitGroup
+	// closed on shutdown so workers stop taking jobs
+	jobWorkersStop = make(chan struct{})
+	// cancel running jobs when shutdown timeout is reached
+	jobWorkersCtx, cancelJobWorkers = context.WithCancel(context.Background())
+	// cancel of every running job by id, also guards status changes racing with a cancel
+	runningJobs   = map[string]context.CancelCauseFunc{}
+	runningJobsMu sync.Mutex
+)
+
+// =========== INTERFACE HANDLER, HANDLING REQUEST RESPONSE API DEPEND INTERFACE ===========
+
+func createJobHandler(c *gin.Context) {
+	var body JobCreate
+	if err := c.ShouldBindJSON(&body); err != nil {
+		slog.ErrorContext(c.Request.Context(), "handler error", "code", "122", "error", err)
+		apperror.RespondBinding(c, err)
+		return
+	}
+
+	job, err := createJobUsecase(authUserID(c), body)
+	if err != nil {
+		if errors.Is(err, errJobQueueFull) {
+			apperror.JSON(c, http.StatusServiceUnavailable, err.Error())
+			return
+		}
+		apperror.Respond(c, err)
+		return
+	}
+
+	c.Header("Location", "/public-api/"+apiVersionOf(c)+"/jobs/"+job.ID)
+	c.JSON(http.StatusAccepted, gin.H{"job": job})
+}
+
+// handler request response status of a job of the authenticated user
+func getJobHandler(c *gin.Context) {
+	job, err := getJobUsecase(c.Param("id"), authUserID(c))
+	if err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"job": job})
+}
+
+// handler request response cancel a job of the authenticated user, 202 while a running job is stopping
+func cancelJobHandler(c *gin.Context) {
+	job, err := cancelJobUsecase(c.Param("id"), authUserID(c))
+	if err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+
+	if job.Status == jobRunning {
+		c.JSON(http.StatusAccepted, gin.H{"job": job})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"job": job})
+}
+
+// =========== USECASE LAYER, SERVES AS AN INTERMEDIARY BETWEEN THE PRESENTATION LAYER AND THE DATA LAYER ===========
+
+func createJobUsecase(userID int, create JobCreate) (*Job, error) {
+	if _, ok := jobKinds[create.Kind]; !ok {
+		return nil, errJobKindInvalid
+	}
+
+	id, err := newTrackingID()
+	if err != nil {
+		slog.Error("usecase error", "code", "123", "error", err)
+		return nil, err
+	}
+
+	now := time.Now().UnixNano() / int64(time.Microsecond)
+	job := &Job{ID: id, Kind: create.Kind, Status: jobQueued, UserID: userID, Params: create.Params, Errors: []string{}, CreatedAt: now, UpdatedAt: now}
+	if err := saveJob(job); err != nil {
+		return nil, errors.New("storage error: create job error")
+	}
+
+	select {
+	case jobQueue <- job.ID:
+	default:
+		job.Status = jobFailed
+		job.Errors = append(job.Errors, errJobQueueFull.Error())
+		job.FinishedAt = now
+		saveJob(job)
+		return nil, errJobQueueFull
+	}
+
+	return job, nil
+}
+
+// jobs of other users are reported as not found
+func getJobUsecase(id string, userID int) (*Job, error) {
+	job, err := findJob(id)
+	if err != nil {
+		return nil, err
+	}
+
+	if job.UserID != userID {
+		return nil, errJobNotFound
+	}
+
+	return job, nil
+}
+
+// queued jobs are cancelled right away, running jobs are asked to stop and report cancelled once they do
+func cancelJobUsecase(id string, userID int) (*Job, error) {
+	runningJobsMu.Lock()
+	defer runningJobsMu.Unlock()
+
+	job, err := getJobUsecase(id, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	switch job.Status {
+	case jobQueued:
+		job.Status = jobCancelled
+		job.UpdatedAt = time.Now().UnixNano() / int64(time.Microsecond)
+		job.FinishedAt = job.UpdatedAt
+		if err := saveJob(job); err != nil {
+			return nil, errors.New("storage error: cancel job error")
+		}
+	case jobRunning:
+		if cancel, ok := runningJobs[id]; ok {
+			cancel(errJobCancelled)
+		}
+	default:
+		return nil, errJobFinished
+	}
+
+	return job, nil
+}
+
+// every listing of the job owner, on cancel the listings of the pages read so far are kept
+func exportListingsJob(ctx context.Context, job *Job, progress func(done, total int)) (interface{}, []string, error) {
+	const pageSize = 100
+	userID := strconv.Itoa(job.UserID)
+
+	listings := []Listing{}
+	for page := 1; ; page++ {
+		// straight from the listing service, the export wants fresh pages and would only fill the page cache
+		res, err := fetchListingsService(ctx, userID, "", page, pageSize, "created_at", "asc")
+		if err != nil {
+			return gin.H{"listings": listings}, nil, err
+		}
+
+		listings = append(listings, res.Listings...)
+		progress(len(listings), res.Pagination.TotalItems)
+
+		if !res.Pagination.HasNext || len(res.Listings) == 0 {
+			break
+		}
+	}
+
+	return gin.H{"listings": listings}, nil, nil
+}
+
+// run one job and store every state change
+func runJobUsecase(ctx context.Context, id string) {
+	// queued to running under runningJobsMu so a cancel in between is never lost
+	runningJobsMu.Lock()
+	job, err := findJob(id)
+	if err != nil || job.Status != jobQueued {
+		runningJobsMu.Unlock()
+		return
+	}
+
+	job.Status = jobRunning
+	job.UpdatedAt = time.Now().UnixNano() / int64(time.Microsecond)
+	if err := saveJob(job); err != nil {
+		runningJobsMu.Unlock()
+		return
+	}
+
+	ctx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+	runningJobs[id] = cancel
+	runningJobsMu.Unlock()
+
+	defer func() {
+		runningJobsMu.Lock()
+		delete(runningJobs, id)
+		runningJobsMu.Unlock()
+	}()
+
+	progress := func(done, total int) {
+		job.Progress = JobProgress{Done: done, Total: total}
+		job.UpdatedAt = time.Now().UnixNano() / int64(time.Microsecond)
+		saveJob(job)
+	}
+
+	result, itemErrors, err := jobKinds[job.Kind](ctx, job, progress)
+
+	job.Errors = append(job.Errors, itemErrors...)
+	job.Status = jobSucceeded
+	switch {
+	case err != nil && errors.Is(context.Cause(ctx), errJobCancelled):
+		// keep what was done before the cancel, progress tells how much of the total it is
+		slog.Info("job cancelled", "job_id", job.ID, "done", job.Progress.Done, "total", job.Progress.Total)
+		job.Status = jobCancelled
+	case err != nil:
+		if ctx.Err() != nil {
+			err = errJobShutdown
+		}
+		slog.ErrorContext(ctx, "worker error", "code", "124", "error", err, "job_id", job.ID)
+		job.Status = jobFailed
+		job.Errors = append(job.Errors, err.Error())
+	}
+
+	if result != nil {
+		if job.Result, err = json.Marshal(result); err != nil {
+			slog.ErrorContext(ctx, "worker error", "code", "125", "error", err)
+			job.Status = jobFailed
+			job.Errors = append(job.Errors, "storing result failed")
+		}
+	}
+	job.UpdatedAt = time.Now().UnixNano() / int64(time.Microsecond)
+	job.FinishedAt = job.UpdatedAt
+	saveJob(job)
+}
+
+// =========== REPOSITORY LAYER, ABSTRACTION OVER THE DATA PERSISTENCE (databases, file systems, or external APIs) ===========
+
+// write to a temp file then rename so a crash never leaves a half written job
+func saveJob(job *Job) error {
+	jobsMu.Lock()
+	defer jobsMu.Unlock()
+
+	data, err := json.Marshal(job)
+	if err != nil {
+		slog.Error("service error", "code", "126", "error", err)
+		return err
+	}
+
+	if err := os.MkdirAll(jobsDir, 0o755); err != nil {
+		slog.Error("service error", "code", "127", "error", err)
+		return err
+	}
+
+	path := filepath.Join(jobsDir, job.ID+".json")
+	if err := os.WriteFile(path+".tmp", data, 0o600); err != nil {
+		slog.Error("service error", "code", "128", "error", err)
+		return err
+	}
+
+	if err := os.Rename(path+".tmp", path); err != nil {
+		slog.Error("service error", "code", "129", "error", err)
+		return err
+	}
+
+	return nil
+}
+
+func findJob(id string) (*Job, error) {
+	// ids are hex, anything else can not name a job file
+	if _, err := hex.DecodeString(id); err != nil || id == "" {
+		return nil, errJobNotFound
+	}
+
+	jobsMu.Lock()
+	defer jobsMu.Unlock()
+
+	data, err := os.ReadFile(filepath.Join(jobsDir, id+".json"))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, errJobNotFound
+		}
+		slog.Error("service error", "code", "130", "error", err)
+		return nil, err
+	}
+
+	var job Job
+	if err := json.Unmarshal(data, &job); err != nil {
+		slog.Error("service error", "code", "131", "error", err)
+		return nil, err
+	}
+
+	return &job, nil
+}
+
+// every stored job, unreadable files are skipped
+func findJobs() ([]*Job, error) {
+	entries, err := os.ReadDir(jobsDir)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		slog.Error("service error", "code", "132", "error", err)
+		return nil, err
+	}
+
+	jobs := []*Job{}
+	for _, entry := range entries {
+		id, ok := strings.CutSuffix(entry.Name(), ".json")
+		if !ok {
+			continue
+		}
+
+		job, err := findJob(id)
+		if err != nil {
+			continue
+		}
+		jobs = append(jobs, job)
+	}
+
+	return jobs, nil
+}
+
+func deleteJob(id string) error {
+	jobsMu.Lock()
+	defer jobsMu.Unlock()
+
+	if err := os.Remove(filepath.Join(jobsDir, id+".json")); err != nil && !errors.Is(err, os.ErrNotExist) {
+		slog.Error("service error", "code", "133", "error", err)
+		return err
+	}
+
+	return nil
+}
+
+// =========== WORKER, RUN QUEUED JOBS IN BACKGROUND ===========
+
+func startJobWorkers() {
+	recoverJobs()
+
+	for i := 0; i < cfg.Int("JOB_WORKERS", 1); i++ {
+		jobWorkers.Add(1)
+		go func() {
+			defer jobWorkers.Done()
+			for {
+				select {
+				case <-jobWorkersStop:
+					return
+				case id := <-jobQueue:
+					runJobUsecase(jobWorkersCtx, id)
+				}
+			}
+		}()
+	}
+
+	// remove finished jobs past JOB_RETENTION
+	jobWorkers.Add(1)
+	go func() {
+		defer jobWorkers.Done()
+		ticker := time.NewTicker(time.Hour)
+		defer ticker.Stop()
+		for {
+			cleanupJobs()
+			select {
+			case <-jobWorkersStop:
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// queue jobs left queued by the previous run, jobs it was running are failed since their progress is lost
+func recoverJobs() {
+	jobs, err := findJobs()
+	if err != nil {
+		return
+	}
+
+	for _, job := range jobs {
+		switch job.Status {
+		case jobQueued:
+			select {
+			case jobQueue <- job.ID:
+				continue
+			default:
+			}
+		case jobRunning:
+		default:
+			continue
+		}
+
+		job.Status = jobFailed
+		job.Errors = append(job.Errors, errJobShutdown.Error())
+		job.UpdatedAt = time.Now().UnixNano() / int64(time.Microsecond)
+		job.FinishedAt = job.UpdatedAt
+		saveJob(job)
+	}
+}
+
+func cleanupJobs() {
+	jobs, err := findJobs()
+	if err != nil {
+		return
+	}
+
+	for _, job := range jobs {
+		if job.FinishedAt != 0 && time.Since(time.UnixMicro(job.FinishedAt)) > jobRetention {
+			deleteJob(job.ID)
+		}
+	}
+}
+
+// let running jobs finish within the shutdown timeout, queued jobs stay on disk for the next start
+func stopJobWorkers(ctx context.Context) {
+	close(jobWorkersStop)
+
+	done := make(chan struct{})
+	go func() {
+		jobWorkers.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-ctx.Done():
+		slog.ErrorContext(ctx, "worker error", "code", "134", "error", "shutdown timeout, cancel running jobs")
+		cancelJobWorkers()
+		<-done
+	}
+}
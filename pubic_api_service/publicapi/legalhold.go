@@ -0,0 +1,175 @@
+package publicapi
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"apperror"
+
+	"github.com/gin-gonic/gin"
+)
+
+// hold set by an admin on a user or listing kept for a legal case, held ones are refused a hard delete
+type LegalHold struct {
+	LegalHold *bool  `json:"legal_hold" binding:"required"`
+	Reason    string `json:"reason" binding:"max=500"`
+}
+
+// =========== INTERFACE HANDLER, HANDLING REQUEST RESPONSE API DEPEND INTERFACE ===========
+
+// the change is in the audit log with the admin, the entity before it and the hold and reason as after
+func setUserLegalHoldHandler(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "handler error", "code", "542", "error", err)
+		apperror.JSON(c, http.StatusBadRequest, "Invalid user ID")
+		return
+	}
+
+	var body LegalHold
+	if err := c.ShouldBindJSON(&body); err != nil {
+		slog.ErrorContext(c.Request.Context(), "handler error", "code", "543", "error", err)
+		apperror.RespondBinding(c, err)
+		return
+	}
+
+	if err := setUserLegalHoldUsecase(c.Request.Context(), id, body); err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"legal_hold": *body.LegalHold, "reason": body.Reason})
+}
+
+func setListingLegalHoldHandler(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "handler error", "code", "544", "error", err)
+		apperror.JSON(c, http.StatusBadRequest, "Invalid listing ID")
+		return
+	}
+
+	var body LegalHold
+	if err := c.ShouldBindJSON(&body); err != nil {
+		slog.ErrorContext(c.Request.Context(), "handler error", "code", "545", "error", err)
+		apperror.RespondBinding(c, err)
+		return
+	}
+
+	if err := setListingLegalHoldUsecase(c.Request.Context(), id, body); err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"legal_hold": *body.LegalHold, "reason": body.Reason})
+}
+
+// =========== USECASE LAYER, SERVES AS AN INTERMEDIARY BETWEEN THE PRESENTATION LAYER AND THE DATA LAYER ===========
+
+func setUserLegalHoldUsecase(ctx context.Context, userID int, hold LegalHold) error {
+	holdJSON, err := json.Marshal(hold)
+	if err != nil {
+		slog.ErrorContext(ctx, "usecase error", "code", "546", "error", err)
+		return err
+	}
+
+	auditBefore(ctx, auditUserLookup(ctx, userID))
+	if err := userClient.SetUserLegalHold(ctx, userID, holdJSON); err != nil {
+		if errors.Is(err, ErrUserNotFound) {
+			return err
+		}
+		return apperror.Upstream("Failed to set legal hold", err)
+	}
+
+	return nil
+}
+
+func setListingLegalHoldUsecase(ctx context.Context, listingID int, hold LegalHold) error {
+	auditBefore(ctx, func() (any, error) {
+		listing, err := findListingByIDService(ctx, listingID)
+		if err != nil {
+			return nil, err
+		}
+		return listing.Listing, nil
+	})
+	if err := setListingLegalHoldService(ctx, listingID, hold); err != nil {
+		if errors.Is(err, errListingNotFound) {
+			return err
+		}
+		return apperror.Upstream("Failed to set legal hold", err)
+	}
+
+	return nil
+}
+
+// =========== REPOSITORY LAYER, ABSTRACTION OVER THE DATA PERSISTENCE (databases, file systems, or external APIs) ===========
+
+var (
+	// user service api path
+	apiPathUserLegalHold = userServiceURL + "/users/%d/legal-hold"
+	// listing service api path
+	apiPathListingLegalHold = listingServiceURL + "/listings/%d/legal-hold"
+)
+
+func (httpUserClient) SetUserLegalHold(ctx context.Context, userID int, holdByte []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, fmt.Sprintf(apiPathUserLegalHold, userID), bytes.NewReader(holdByte))
+	if err != nil {
+		slog.ErrorContext(ctx, "service error", "code", "547", "error", err)
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		slog.ErrorContext(ctx, "service error", "code", "547", "error", err)
+		return err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return nil
+	case http.StatusNotFound:
+		return ErrUserNotFound
+	default:
+		slog.ErrorContext(ctx, "service error", "code", "548", "error", "error setting legal hold from user service")
+		return errors.New("error setting legal hold from user service")
+	}
+}
+
+func setListingLegalHoldService(ctx context.Context, listingID int, hold LegalHold) error {
+	defer listingsCache.invalidate(ctx)
+
+	form := url.Values{"legal_hold": {strconv.FormatBool(*hold.LegalHold)}, "reason": {hold.Reason}}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, fmt.Sprintf(apiPathListingLegalHold, listingID), strings.NewReader(form.Encode()))
+	if err != nil {
+		slog.ErrorContext(ctx, "service error", "code", "549", "error", err)
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		slog.ErrorContext(ctx, "service error", "code", "549", "error", err)
+		return err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return nil
+	case http.StatusNotFound:
+		return errListingNotFound
+	default:
+		slog.ErrorContext(ctx, "service error", "code", "550", "error", "error setting legal hold from listing service")
+		return errors.New("error setting legal hold from listing service")
+	}
+}
@@ -0,0 +1,77 @@
+package publicapi
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+// holds set on the users of roleUserClient
+type legalHoldUserClient struct {
+	roleUserClient
+	holds map[int]LegalHold
+}
+
+func (c legalHoldUserClient) SetUserLegalHold(ctx context.Context, userID int, holdByte []byte) error {
+	if _, ok := c.roles[userID]; !ok {
+		return ErrUserNotFound
+	}
+	var hold LegalHold
+	if err := json.Unmarshal(holdByte, &hold); err != nil {
+		return err
+	}
+	c.holds[userID] = hold
+	return nil
+}
+
+func TestSetUserLegalHold(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	var audit []AuditEntry
+	client := legalHoldUserClient{roleUserClient: roleUserClient{roles: map[int]string{1: roleAdmin, 3: roleUser}, audit: &audit}, holds: map[int]LegalHold{}}
+	previous := userClient
+	userClient = client
+	defer func() { userClient = previous }()
+
+	router := gin.New()
+	router.Use(auditMiddleware())
+	admin := router.Group("/public-api/admin", func(c *gin.Context) { c.Set(ctxKeyAuthUserID, 1) })
+	admin.PUT("/users/:id/legal-hold", setUserLegalHoldHandler)
+
+	serve := func(path, body string) int {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodPut, path, strings.NewReader(body)))
+		return w.Code
+	}
+
+	if status := serve("/public-api/admin/users/3/legal-hold", `{"legal_hold":true,"reason":"case 42"}`); status != http.StatusOK {
+		t.Fatalf("set hold: %d, want 200", status)
+	}
+	if hold := client.holds[3]; hold.LegalHold == nil || !*hold.LegalHold || hold.Reason != "case 42" {
+		t.Errorf("hold %+v, want held for case 42", hold)
+	}
+
+	// the audit log has who changed the hold, the user before it and the hold after it
+	if len(audit) != 1 {
+		t.Fatalf("audit %+v, want one entry", audit)
+	}
+	entry := audit[0]
+	if entry.ActorID != 1 || entry.Action != "PUT /admin/users/:id/legal-hold" || entry.Entity != "users" || entry.EntityID != "3" ||
+		string(entry.Before) != `{"created_at":0,"id":3,"name":"","role":"user","updated_at":0}` || string(entry.After) != `{"legal_hold":true,"reason":"case 42"}` {
+		t.Errorf("audit entry %+v", entry)
+	}
+
+	if status := serve("/public-api/admin/users/3/legal-hold", `{"reason":"no hold"}`); status != http.StatusUnprocessableEntity {
+		t.Errorf("legal_hold missing: %d, want 422", status)
+	}
+	if status := serve("/public-api/admin/users/9/legal-hold", `{"legal_hold":false}`); status != http.StatusNotFound {
+		t.Errorf("unknown user: %d, want 404", status)
+	}
+	if len(audit) != 1 {
+		t.Errorf("failed changes recorded: %+v", audit[1:])
+	}
+}
@@ -0,0 +1,148 @@
+package publicapi
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// =========== REPOSITORY LAYER, REDIS CACHE OF LISTINGS PAGES ===========
+
+// LISTINGS_CACHE_REDIS_URL redis://[:password@]host:port[/db] caching listings pages, empty disables the cache
+// LISTINGS_CACHE_TTL how long a cached page is served, also bounds staleness when an invalidation fails
+// LISTINGS_CACHE_TIMEOUT max duration of one redis command, a slow or down redis is skipped
+var listingsCache = newListingsCache(
+	cfg.String("LISTINGS_CACHE_REDIS_URL", ""),
+	cfg.Duration("LISTINGS_CACHE_TTL", 30*time.Second),
+	cfg.Duration("LISTINGS_CACHE_TIMEOUT", 100*time.Millisecond),
+)
+
+// pages are stored under the current generation, a write through the public API starts a new generation so
+// every page cached before it is no longer read and expires on its ttl
+const (
+	listingsCacheGenerationKey = "public-api:listings:generation"
+	listingsCachePageKey       = "public-api:listings:page:%s:%s"
+)
+
+type listingsPageCache struct {
+	redis *redisClient
+	ttl   time.Duration
+}
+
+func newListingsCache(redisURL string, ttl, timeout time.Duration) *listingsPageCache {
+	if redisURL == "" || ttl <= 0 {
+		return &listingsPageCache{}
+	}
+
+	client, err := newRedisClient(redisURL, timeout)
+	if err != nil {
+		log.Fatal(err)
+	}
+	return &listingsPageCache{redis: client, ttl: ttl}
+}
+
+func (c *listingsPageCache) enabled() bool {
+	return c.redis != nil
+}
+
+// key of the page fetched with url under the current generation, empty when redis failed
+func (c *listingsPageCache) key(ctx context.Context, url string) string {
+	generation, err := c.redis.Get(ctx, listingsCacheGenerationKey)
+	switch {
+	case errors.Is(err, errRedisNil):
+		generation = "0"
+	case err != nil:
+		slog.WarnContext(ctx, "listings cache unavailable", "error", err)
+		listingsCacheRequests.WithLabelValues("error").Inc()
+		return ""
+	}
+
+	sum := sha256.Sum256([]byte(url))
+	return fmt.Sprintf(listingsCachePageKey, generation, hex.EncodeToString(sum[:]))
+}
+
+// get page fetched with url, false when missing or redis failed
+func (c *listingsPageCache) get(ctx context.Context, key string) (*ListingsResponse, bool) {
+	value, err := c.redis.Get(ctx, key)
+	if err != nil {
+		if !errors.Is(err, errRedisNil) {
+			slog.WarnContext(ctx, "listings cache unavailable", "error", err)
+			listingsCacheRequests.WithLabelValues("error").Inc()
+			return nil, false
+		}
+		listingsCacheRequests.WithLabelValues("miss").Inc()
+		return nil, false
+	}
+
+	var page ListingsResponse
+	if err := decodeJSON(strings.NewReader(value), &page); err != nil {
+		slog.WarnContext(ctx, "listings cache entry invalid", "error", err)
+		listingsCacheRequests.WithLabelValues("miss").Inc()
+		return nil, false
+	}
+
+	listingsCacheRequests.WithLabelValues("hit").Inc()
+	return &page, true
+}
+
+func (c *listingsPageCache) put(ctx context.Context, key string, page *ListingsResponse) {
+	value, err := json.Marshal(page)
+	if err != nil {
+		return
+	}
+
+	if err := c.redis.Set(ctx, key, string(value), c.ttl); err != nil {
+		slog.WarnContext(ctx, "listings cache unavailable", "error", err)
+		listingsCacheRequests.WithLabelValues("error").Inc()
+	}
+}
+
+// invalidate drop every cached page, called after each listing write through the public API even when it failed
+// as the write may have been applied anyway
+func (c *listingsPageCache) invalidate(ctx context.Context) {
+	if !c.enabled() {
+		return
+	}
+
+	// the write is done, invalidate even when the client went away
+	ctx = context.WithoutCancel(ctx)
+	if _, err := c.redis.Incr(ctx, listingsCacheGenerationKey); err != nil {
+		slog.ErrorContext(ctx, "service error", "code", "157", "error", err)
+	}
+}
+
+// listings page from the cache when possible, fetched from the listing service and cached otherwise. Strong reads
+// are fetched and refresh the cache
+func findListingsService(ctx context.Context, userID, region string, pageNum, pageSize int, sortBy, sortDir string) (*ListingsResponse, error) {
+	if !listingsCache.enabled() {
+		return fetchListingsService(ctx, userID, region, pageNum, pageSize, sortBy, sortDir)
+	}
+
+	url := listingsPageURL(userID, region, pageNum, pageSize, sortBy, sortDir)
+	key := listingsCache.key(ctx, url)
+	if key == "" {
+		return fetchListingsService(ctx, userID, region, pageNum, pageSize, sortBy, sortDir)
+	}
+	if page, ok := listingsCache.get(ctx, key); ok && !strongRead(ctx) {
+		recordCacheHit(ctx, http.MethodGet, url)
+		return page, nil
+	}
+
+	res, err := fetchListingsService(ctx, userID, region, pageNum, pageSize, sortBy, sortDir)
+	if err != nil {
+		return nil, err
+	}
+	if res.Result {
+		listingsCache.put(ctx, key, res)
+	}
+
+	return res, nil
+}
@@ -0,0 +1,101 @@
+package publicapi
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// listing client serving one page of listings and counting the fetches
+type cacheListingClient struct {
+	ListingClient
+	fetches int
+	err     error
+}
+
+func (c *cacheListingClient) FetchListings(ctx context.Context, userID, region string, pageNum, pageSize int, sortBy, sortDir string) (*ListingsResponse, error) {
+	c.fetches++
+	if c.err != nil {
+		return nil, c.err
+	}
+	return &ListingsResponse{
+		Result:     true,
+		Listings:   []Listing{{ID: 9007199254740993, UserID: 1, ListingType: "rent", Price: 9223372036854775807}},
+		Pagination: Pagination{PageNum: pageNum, PageSize: pageSize, TotalItems: 1, TotalPages: 1},
+	}, nil
+}
+
+func (c *cacheListingClient) UpdateListing(ctx context.Context, listingID int, update ListingUpdate) (*ListingDetailResponse, error) {
+	return nil, c.err
+}
+
+func TestListingsPageCache(t *testing.T) {
+	server := newFakeRedis(t)
+	client := &cacheListingClient{}
+
+	previousClient, previousCache := listingClient, listingsCache
+	listingClient = client
+	listingsCache = newListingsCache("redis://"+server.listener.Addr().String(), time.Minute, time.Second)
+	defer func() { listingClient, listingsCache = previousClient, previousCache }()
+
+	ctx := context.Background()
+	fetch := func() *ListingsResponse {
+		t.Helper()
+		res, err := findListingsService(ctx, "", "", 1, 10, "created_at", "desc")
+		if err != nil {
+			t.Fatal(err)
+		}
+		return res
+	}
+
+	first := fetch()
+	cached := fetch()
+	if client.fetches != 1 {
+		t.Fatalf("fetched %d times, want the second page served by the cache", client.fetches)
+	}
+	// ids and prices above 2^53 survive the round trip through redis
+	if cached.Listings[0].ID != first.Listings[0].ID || cached.Listings[0].Price != first.Listings[0].Price {
+		t.Errorf("cached listing = %+v, want %+v", cached.Listings[0], first.Listings[0])
+	}
+
+	if _, err := findListingsService(ctx, "", "", 2, 10, "created_at", "desc"); err != nil {
+		t.Fatal(err)
+	}
+	if client.fetches != 2 {
+		t.Errorf("fetched %d times, want another page fetched", client.fetches)
+	}
+
+	// a failed write may have been applied, the cache is invalidated anyway
+	client.err = errors.New("connection reset")
+	if _, err := updateListingService(ctx, 1, ListingUpdate{}); err == nil {
+		t.Fatal("update error lost")
+	}
+	client.err = nil
+	fetch()
+	if client.fetches != 3 {
+		t.Errorf("fetched %d times, want the page fetched again after a write", client.fetches)
+	}
+}
+
+func TestListingsPageCacheRedisDown(t *testing.T) {
+	server := newFakeRedis(t)
+	client := &cacheListingClient{}
+
+	previousClient, previousCache := listingClient, listingsCache
+	listingClient = client
+	listingsCache = newListingsCache("redis://"+server.listener.Addr().String(), time.Minute, time.Second)
+	defer func() { listingClient, listingsCache = previousClient, previousCache }()
+
+	server.listener.Close()
+	server.dropConnections()
+
+	for i := 0; i < 2; i++ {
+		if _, err := findListingsService(context.Background(), "", "", 1, 10, "created_at", "desc"); err != nil {
+			t.Fatalf("err = %v, want the page served from the listing service", err)
+		}
+	}
+	if client.fetches != 2 {
+		t.Errorf("fetched %d times, want every request fetched", client.fetches)
+	}
+}
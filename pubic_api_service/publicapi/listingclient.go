@@ -0,0 +1,43 @@
+package publicapi
+
+import (
+	"context"
+	"log"
+	"log/slog"
+)
+
+// =========== REPOSITORY LAYER, CLIENT OF THE LISTING SERVICE ===========
+
+// ListingClient calls of the public API to the listing service handled by both transports, errors the usecases
+// act on are errListingNotFound and errListingLegalHold. Media, video and offer calls always use HTTP
+type ListingClient interface {
+	FetchListings(ctx context.Context, userID, region string, pageNum, pageSize int, sortBy, sortDir string) (*ListingsResponse, error)
+	CreateListing(ctx context.Context, listingByte []byte) (*ListingCreateResponse, error)
+	FindListing(ctx context.Context, listingID int) (*ListingDetailResponse, error)
+	UpdateListing(ctx context.Context, listingID int, update ListingUpdate) (*ListingDetailResponse, error)
+	DeleteListing(ctx context.Context, listingID int, hard bool) error
+}
+
+// client used by the repository functions, the transport of LISTING_SERVICE_TRANSPORT once Run started
+var listingClient ListingClient = httpListingClient{}
+
+// listing service over HTTP with the shared client, so retries, breaker, metrics and the api key apply
+type httpListingClient struct{}
+
+// LISTING_SERVICE_TRANSPORT http or grpc, grpc calls the listing service on LISTING_SERVICE_GRPC_ADDR
+func newListingClient() ListingClient {
+	name := cfg.String("LISTING_SERVICE_TRANSPORT", "http")
+
+	var client ListingClient
+	switch name {
+	case "http":
+		client = httpListingClient{}
+	case "grpc":
+		client = &grpcListingClient{}
+	default:
+		log.Fatalf("unknown LISTING_SERVICE_TRANSPORT %q, one of: grpc, http", name)
+	}
+
+	slog.Info("listing service transport", "transport", name)
+	return client
+}
@@ -0,0 +1,367 @@
+package publicapi
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"apperror"
+	"events"
+
+	"github.com/gin-gonic/gin"
+)
+
+// event types of the listing stream
+const (
+	listingStreamCreated = "listing.created"
+	// sent instead of the missed listings when more were created since Last-Event-ID than are replayed
+	listingStreamReset = "reset"
+)
+
+var (
+	// LISTING_STREAM_POLL_INTERVAL wait between two reads of the delivered listing events, 0 disables the stream
+	listingStreamPollInterval = cfg.Duration("LISTING_STREAM_POLL_INTERVAL", time.Second)
+	// LISTING_STREAM_HEARTBEAT wait between two comments keeping idle connections open through proxies
+	listingStreamHeartbeat = cfg.Duration("LISTING_STREAM_HEARTBEAT", 15*time.Second)
+	// LISTING_STREAM_REPLAY_LIMIT listings created since Last-Event-ID sent on reconnect, more are a reset
+	listingStreamReplayLimit = cfg.Int("LISTING_STREAM_REPLAY_LIMIT", 100)
+	// LISTING_STREAM_MAX_CLIENTS connections open at the same time per instance
+	listingStreamMaxClients = cfg.Int("LISTING_STREAM_MAX_CLIENTS", 1000)
+)
+
+var (
+	errListingStreamDisabled = errors.New("listing stream is disabled")
+	errListingStreamFull     = errors.New("listing stream clients at LISTING_STREAM_MAX_CLIENTS")
+	errLastEventID           = apperror.Validation("Last-Event-ID must be the id of an event of the stream")
+)
+
+// listingStream nil while LISTING_STREAM_POLL_INTERVAL is 0
+var listingStream *listingStreamHub
+
+// =========== INTERFACE HANDLER, HANDLING REQUEST RESPONSE API DEPEND INTERFACE ===========
+
+// server-sent events of the listings created, each with the id of its event in the listing outbox. A client
+// reconnecting with Last-Event-ID, or last_event_id for clients that can not set it, gets those it missed first
+func streamListingsHandler(c *gin.Context) {
+	lastEventID := c.GetHeader("Last-Event-ID")
+	if lastEventID == "" {
+		lastEventID = c.Query("last_event_id")
+	}
+	var lastID int64
+	if lastEventID != "" {
+		var err error
+		if lastID, err = strconv.ParseInt(lastEventID, 10, 64); err != nil || lastID < 0 {
+			slog.ErrorContext(c.Request.Context(), "handler error", "code", "538", "error", err, "last_event_id", lastEventID)
+			apperror.Respond(c, errLastEventID)
+			return
+		}
+	}
+
+	sub, missed, err := streamListingsUsecase(c.Request.Context(), lastID)
+	if err != nil {
+		switch {
+		case errors.Is(err, errListingStreamDisabled):
+			apperror.JSON(c, http.StatusServiceUnavailable, "Listing stream is disabled, poll GET /public-api/listings instead")
+		case errors.Is(err, errListingStreamFull):
+			c.Header("Retry-After", strconv.Itoa(int(listingStreamHeartbeat.Seconds())))
+			apperror.JSON(c, http.StatusServiceUnavailable, "Too many listing stream clients, try again later")
+		default:
+			apperror.Respond(c, err)
+		}
+		return
+	}
+	defer listingStream.unsubscribe(sub)
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-store")
+	// nginx would hold the events in its buffer
+	c.Header("X-Accel-Buffering", "no")
+	c.Status(http.StatusOK)
+
+	w := c.Writer
+	// browsers reconnect after retry milliseconds with the Last-Event-ID of the last event they got
+	fmt.Fprint(w, "retry: 3000\n\n")
+	for _, event := range missed {
+		if writeListingStreamEvent(w, event) != nil {
+			return
+		}
+	}
+	w.Flush()
+
+	sent := lastID
+	if len(missed) > 0 {
+		sent = missed[len(missed)-1].id
+	}
+
+	heartbeat := time.NewTicker(listingStreamHeartbeat)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case <-c.Request.Context().Done():
+			return
+		case event, ok := <-sub.events:
+			if !ok {
+				// dropped for falling behind or shutting down, the client comes back with Last-Event-ID
+				return
+			}
+			if event.id <= sent {
+				continue
+			}
+			if writeListingStreamEvent(w, event) != nil {
+				return
+			}
+			sent = event.id
+		case <-heartbeat.C:
+			if _, err := fmt.Fprint(w, ": heartbeat\n\n"); err != nil {
+				return
+			}
+		}
+		w.Flush()
+	}
+}
+
+func writeListingStreamEvent(w gin.ResponseWriter, event listingStreamEvent) error {
+	_, err := fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", event.id, event.name, event.data)
+	return err
+}
+
+// =========== USECASE LAYER, SERVES AS AN INTERMEDIARY BETWEEN THE PRESENTATION LAYER AND THE DATA LAYER ===========
+
+// subscription to the listings created from now on, and the listings created after lastID up to now when set.
+// More than LISTING_STREAM_REPLAY_LIMIT missed listings are one reset event with the id to continue from
+func streamListingsUsecase(ctx context.Context, lastID int64) (*listingStreamSubscription, []listingStreamEvent, error) {
+	if listingStream == nil {
+		return nil, nil, errListingStreamDisabled
+	}
+
+	sub, ok := listingStream.subscribe()
+	if !ok {
+		return nil, nil, errListingStreamFull
+	}
+	if lastID == 0 || lastID >= sub.since {
+		return sub, nil, nil
+	}
+
+	missed, err := listingStream.missed(ctx, lastID, sub.since, listingStreamReplayLimit+1)
+	if err != nil {
+		listingStream.unsubscribe(sub)
+		return nil, nil, apperror.Upstream("Failed to get the listings created since Last-Event-ID", err)
+	}
+	if len(missed) > listingStreamReplayLimit {
+		return sub, []listingStreamEvent{{id: sub.since, name: listingStreamReset, data: json.RawMessage("{}")}}, nil
+	}
+
+	return sub, missed, nil
+}
+
+// =========== REPOSITORY LAYER, LISTINGS CREATED AS THE LISTING OUTBOX DELIVERED THEM ===========
+
+// listing of a listing.created event, id the one of the event in the listing outbox
+type listingStreamEvent struct {
+	id   int64
+	name string
+	data json.RawMessage
+}
+
+// channel of the events of one client, closed when it falls behind or the stream stops
+type listingStreamSubscription struct {
+	events chan listingStreamEvent
+	// id of the last event read before the subscription, later ones come on events
+	since int64
+}
+
+// listingStreamHub read the listing.created events the relay delivered from the listing outbox, once for every
+// client of the instance. Reading the outbox instead of the relay sees the events relayed by every instance
+type listingStreamHub struct {
+	history events.History
+	// occurred_at from which events are read, events are ordered by their id in the outbox
+	from int64
+
+	mu      sync.Mutex
+	cursor  int64
+	clients map[*listingStreamSubscription]struct{}
+	closed  bool
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+func newListingStreamHub(history events.History, from time.Time) *listingStreamHub {
+	return &listingStreamHub{
+		history: history,
+		from:    from.UnixMicro(),
+		clients: map[*listingStreamSubscription]struct{}{},
+		stop:    make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+}
+
+// poll the listing outbox every LISTING_STREAM_POLL_INTERVAL, listings created up to a minute before the start are
+// sent to the clients connected then
+func startListingStream() {
+	if listingStreamPollInterval <= 0 {
+		return
+	}
+
+	listingStream = newListingStreamHub(listingOutbox{}, time.Now().Add(-time.Minute))
+	go listingStream.run(listingStreamPollInterval)
+}
+
+// end the streams of the clients so the server does not wait for them, run when shutdown starts
+func closeListingStreams() {
+	if listingStream != nil {
+		listingStream.close()
+	}
+}
+
+// wait for the running read of the listing outbox
+func stopListingStream(ctx context.Context) {
+	if listingStream == nil {
+		return
+	}
+
+	listingStream.close()
+	select {
+	case <-listingStream.done:
+	case <-ctx.Done():
+		slog.ErrorContext(ctx, "worker error", "code", "539", "error", "shutdown timeout, listing stream poll still running")
+	}
+}
+
+func (h *listingStreamHub) run(interval time.Duration) {
+	defer close(h.done)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		ctx, cancel := context.WithTimeout(context.Background(), interval*5)
+		if err := h.poll(ctx); err != nil {
+			slog.ErrorContext(ctx, "worker error", "code", "540", "error", err)
+		}
+		cancel()
+
+		select {
+		case <-h.stop:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// send the events delivered since the last poll to every client, a client whose buffer is full is dropped
+func (h *listingStreamHub) poll(ctx context.Context) error {
+	h.mu.Lock()
+	cursor := h.cursor
+	h.mu.Unlock()
+
+	for {
+		records, err := h.history.Events(ctx, h.filter(), cursor, 500)
+		if err != nil {
+			return err
+		}
+		if len(records) == 0 {
+			return nil
+		}
+
+		h.mu.Lock()
+		for _, record := range records {
+			event := listingStreamEvent{id: record.ID, name: listingStreamCreated, data: record.Event.Data}
+			for sub := range h.clients {
+				select {
+				case sub.events <- event:
+				default:
+					delete(h.clients, sub)
+					close(sub.events)
+				}
+			}
+		}
+		cursor = records[len(records)-1].ID
+		h.cursor = cursor
+		listingStreamClients.Set(float64(len(h.clients)))
+		h.mu.Unlock()
+
+		if len(records) < 500 {
+			return nil
+		}
+	}
+}
+
+// delivered listing.created events from the start of the hub on, to the end of time
+func (h *listingStreamHub) filter() events.ReplayFilter {
+	return events.ReplayFilter{Types: []string{listingStreamCreated}, From: h.from, To: time.Now().Add(time.Minute).UnixMicro()}
+}
+
+// subscription of a new client, false when LISTING_STREAM_MAX_CLIENTS are connected or the stream stopped
+func (h *listingStreamHub) subscribe() (*listingStreamSubscription, bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.closed || len(h.clients) >= listingStreamMaxClients {
+		return nil, false
+	}
+
+	sub := &listingStreamSubscription{events: make(chan listingStreamEvent, 64), since: h.cursor}
+	h.clients[sub] = struct{}{}
+	listingStreamClients.Set(float64(len(h.clients)))
+	return sub, true
+}
+
+func (h *listingStreamHub) unsubscribe(sub *listingStreamSubscription) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if _, ok := h.clients[sub]; ok {
+		delete(h.clients, sub)
+		close(sub.events)
+	}
+	listingStreamClients.Set(float64(len(h.clients)))
+}
+
+// events after afterID up to and including untilID, at most limit. Read from the first delivered event kept, an
+// id older than OUTBOX_RETENTION gets those still kept
+func (h *listingStreamHub) missed(ctx context.Context, afterID, untilID int64, limit int) ([]listingStreamEvent, error) {
+	filter := h.filter()
+	filter.From = 0
+
+	var missed []listingStreamEvent
+	for {
+		want := min(limit-len(missed), 500)
+		records, err := h.history.Events(ctx, filter, afterID, want)
+		if err != nil {
+			return nil, err
+		}
+		for _, record := range records {
+			if record.ID > untilID {
+				return missed, nil
+			}
+			missed = append(missed, listingStreamEvent{id: record.ID, name: listingStreamCreated, data: record.Event.Data})
+		}
+		if len(records) < want || len(missed) >= limit {
+			return missed, nil
+		}
+		afterID = records[len(records)-1].ID
+	}
+}
+
+// stop polling and end the streams of every client
+func (h *listingStreamHub) close() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.closed {
+		return
+	}
+	h.closed = true
+	close(h.stop)
+	for sub := range h.clients {
+		delete(h.clients, sub)
+		close(sub.events)
+	}
+	listingStreamClients.Set(0)
+}
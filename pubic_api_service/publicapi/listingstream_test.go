@@ -0,0 +1,225 @@
+package publicapi
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"events"
+
+	"github.com/gin-gonic/gin"
+)
+
+// delivered listing events of the outbox, records are added as the test goes
+type listingStreamHistory struct {
+	mu      sync.Mutex
+	records []events.Record
+}
+
+func (h *listingStreamHistory) add(id int64) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	event := events.Event{ID: fmt.Sprint(id), Type: listingStreamCreated, OccurredAt: time.Now().UnixMicro(), Data: []byte(fmt.Sprintf(`{"id":%d}`, id))}
+	h.records = append(h.records, events.Record{ID: id, Event: event})
+}
+
+func (h *listingStreamHistory) Events(ctx context.Context, filter events.ReplayFilter, afterID int64, limit int) ([]events.Record, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return readModelHistory(h.records).Events(ctx, filter, afterID, limit)
+}
+
+// hub over history polled by the test, served by a server closed with the test
+func newTestListingStream(t *testing.T, history *listingStreamHistory) *httptest.Server {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+
+	previous := listingStream
+	listingStream = newListingStreamHub(history, time.Now().Add(-time.Minute))
+	router := gin.New()
+	router.Use(gzipMiddleware(), etagMiddleware())
+	router.GET("/public-api/listings/stream", streamListingsHandler)
+	srv := httptest.NewServer(router)
+	t.Cleanup(func() {
+		listingStream.close()
+		srv.Close()
+		listingStream = previous
+	})
+	return srv
+}
+
+// lines of events read from the stream until want events came, comments and blank lines skipped
+func readListingStream(t *testing.T, body *bufio.Reader, want int) []string {
+	t.Helper()
+	var lines []string
+	for events := 0; events < want; {
+		line, err := body.ReadString('\n')
+		if err != nil {
+			t.Fatalf("read stream after %q: %v", lines, err)
+		}
+		line = strings.TrimSuffix(line, "\n")
+		switch {
+		case line == "" || strings.HasPrefix(line, ":") || strings.HasPrefix(line, "retry:"):
+		case strings.HasPrefix(line, "data:"):
+			lines = append(lines, line)
+			events++
+		default:
+			lines = append(lines, line)
+		}
+	}
+	return lines
+}
+
+func openListingStream(t *testing.T, srv *httptest.Server, lastEventID string) (*http.Response, *bufio.Reader) {
+	t.Helper()
+	req, _ := http.NewRequest(http.MethodGet, srv.URL+"/public-api/listings/stream", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	if lastEventID != "" {
+		req.Header.Set("Last-Event-ID", lastEventID)
+	}
+	resp, err := srv.Client().Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { resp.Body.Close() })
+	return resp, bufio.NewReader(resp.Body)
+}
+
+// wait until the hub has n clients
+func waitListingStreamClients(t *testing.T, n int) {
+	t.Helper()
+	for deadline := time.Now().Add(time.Second); ; time.Sleep(5 * time.Millisecond) {
+		listingStream.mu.Lock()
+		clients := len(listingStream.clients)
+		listingStream.mu.Unlock()
+		if clients == n {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("%d stream clients, want %d", clients, n)
+		}
+	}
+}
+
+func TestListingStreamLive(t *testing.T) {
+	history := &listingStreamHistory{}
+	history.add(1)
+	srv := newTestListingStream(t, history)
+	if err := listingStream.poll(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	resp, body := openListingStream(t, srv, "")
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Type") != "text/event-stream" || resp.Header.Get("Content-Encoding") != "" {
+		t.Fatalf("status %d headers %v, want a plain event stream", resp.StatusCode, resp.Header)
+	}
+	waitListingStreamClients(t, 1)
+
+	// listings created before the connection are not sent again
+	history.add(2)
+	history.add(3)
+	if err := listingStream.poll(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	got := readListingStream(t, body, 2)
+	want := []string{"id: 2", "event: listing.created", `data: {"id":2}`, "id: 3", "event: listing.created", `data: {"id":3}`}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("stream %q, want %q", got, want)
+	}
+
+	// shutting down ends the stream instead of waiting for the client
+	listingStream.close()
+	if _, err := io.ReadAll(body); err != nil {
+		t.Errorf("stream after close: %v", err)
+	}
+}
+
+func TestListingStreamLastEventID(t *testing.T) {
+	history := &listingStreamHistory{}
+	for id := int64(1); id <= 4; id++ {
+		history.add(id)
+	}
+	srv := newTestListingStream(t, history)
+	if err := listingStream.poll(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	_, body := openListingStream(t, srv, "2")
+	waitListingStreamClients(t, 1)
+	history.add(5)
+	if err := listingStream.poll(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	got := readListingStream(t, body, 3)
+	want := []string{"id: 3", "event: listing.created", `data: {"id":3}`, "id: 4", "event: listing.created", `data: {"id":4}`, "id: 5", "event: listing.created", `data: {"id":5}`}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("stream %q, want %q", got, want)
+	}
+}
+
+func TestListingStreamReset(t *testing.T) {
+	previousLimit := listingStreamReplayLimit
+	listingStreamReplayLimit = 2
+	defer func() { listingStreamReplayLimit = previousLimit }()
+
+	history := &listingStreamHistory{}
+	for id := int64(1); id <= 4; id++ {
+		history.add(id)
+	}
+	srv := newTestListingStream(t, history)
+	if err := listingStream.poll(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	_, body := openListingStream(t, srv, "1")
+	got := readListingStream(t, body, 1)
+	if want := []string{"id: 4", "event: reset", "data: {}"}; fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("stream %q, want %q", got, want)
+	}
+
+	resp, _ := openListingStream(t, srv, "nope")
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("invalid Last-Event-ID: %d, want 400", resp.StatusCode)
+	}
+}
+
+func TestListingStreamSlowClient(t *testing.T) {
+	hub := newListingStreamHub(&listingStreamHistory{}, time.Now())
+	sub, ok := hub.subscribe()
+	if !ok {
+		t.Fatal("subscribe refused")
+	}
+
+	history := hub.history.(*listingStreamHistory)
+	for id := int64(1); id <= int64(cap(sub.events))+1; id++ {
+		history.add(id)
+	}
+	if err := hub.poll(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	// a client behind by more than its buffer is dropped and reconnects with Last-Event-ID
+	received := 0
+	for range sub.events {
+		received++
+	}
+	if received != cap(sub.events) || len(hub.clients) != 0 {
+		t.Errorf("received %d with %d clients left, want the buffer of %d then the client dropped", received, len(hub.clients), cap(sub.events))
+	}
+	hub.unsubscribe(sub)
+
+	previousMax := listingStreamMaxClients
+	listingStreamMaxClients = 0
+	defer func() { listingStreamMaxClients = previousMax }()
+	if _, ok := hub.subscribe(); ok {
+		t.Error("subscribed past LISTING_STREAM_MAX_CLIENTS")
+	}
+}
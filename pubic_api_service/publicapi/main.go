@@ -0,0 +1,1458 @@
+// Package publicapi is the public API layer in front of the listing and user services, served on its own
+// by the public_api_service binary or together with the user service in the combined binary of the app module.
+package publicapi
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"apperror"
+	"config"
+	"logging"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"go.opentelemetry.io/contrib/instrumentation/github.com/gin-gonic/gin/otelgin"
+)
+
+type ListingsResponse struct {
+	Result     bool `json:"result"`
+	Listings   []Listing
+	Pagination Pagination `json:"pagination"`
+}
+
+// page position of a list response so clients can render pagers
+type Pagination struct {
+	PageNum    int  `json:"page_num"`
+	PageSize   int  `json:"page_size"`
+	TotalItems int  `json:"total_items"`
+	TotalPages int  `json:"total_pages"`
+	HasNext    bool `json:"has_next"`
+}
+
+type Listing struct {
+	ID          int           `json:"id"`
+	UserID      int           `json:"user_id"`
+	ListingType string        `json:"listing_type" binding:"required,oneof=rent sale"`
+	Price       int           `json:"price" binding:"gt=0"`
+	Currency    string        `json:"currency,omitempty" binding:"omitempty,iso4217"`
+	Region      string        `json:"region,omitempty"`
+	Area        float64       `json:"area,omitempty" binding:"gte=0"`
+	AreaUnits   string        `json:"area_units,omitempty"`
+	VideoURL    string        `json:"video_url,omitempty"`
+	Media       *ListingMedia `json:"media,omitempty"`
+	// photos ordered by position, the same as media.photos
+	Images []Media `json:"images"`
+	// completeness score 0-100 computed by listing service
+	QualityScore int   `json:"quality_score"`
+	CreatedAt    int64 `json:"created_at"`
+	UpdatedAt    int64 `json:"updated_at"`
+	User         User  `json:"user"`
+	// price in the convert_to currency of GET /public-api/listings
+	ConvertedPrice *ConvertedPrice `json:"converted_price,omitempty"`
+}
+
+type ListingCreateResponse struct {
+	Result  bool `json:"result"`
+	Listing ListingCreate
+}
+
+type ListingCreate struct {
+	ID          int           `json:"id"`
+	UserID      int           `json:"user_id"`
+	ListingType string        `json:"listing_type"`
+	Price       int           `json:"price"`
+	Currency    string        `json:"currency,omitempty"`
+	Region      string        `json:"region,omitempty"`
+	Area        float64       `json:"area,omitempty"`
+	AreaUnits   string        `json:"area_units,omitempty"`
+	VideoURL    string        `json:"video_url,omitempty"`
+	Media       *ListingMedia `json:"media,omitempty"`
+	// photos ordered by position, the same as media.photos
+	Images []Media `json:"images"`
+	// completeness score 0-100 computed by listing service
+	QualityScore int   `json:"quality_score"`
+	CreatedAt    int64 `json:"created_at"`
+	UpdatedAt    int64 `json:"updated_at"`
+}
+
+type ListingDetailResponse struct {
+	Result  bool `json:"result"`
+	Listing ListingCreate
+}
+
+type ListingUpdate struct {
+	ListingType string  `json:"listing_type" binding:"omitempty,oneof=rent sale"`
+	Price       int     `json:"price" binding:"gte=0"`
+	Currency    string  `json:"currency" binding:"omitempty,iso4217"`
+	Area        float64 `json:"area" binding:"gte=0"`
+}
+
+type UserCreate struct {
+	Name     string `json:"name" binding:"required,notblank"`
+	Email    string `json:"email,omitempty" binding:"omitempty,email,max=320"`
+	Password string `json:"password"`
+}
+
+// partial update, nil fields keep their current value
+type UserUpdate struct {
+	Name     *string `json:"name,omitempty" binding:"omitempty,notblank"`
+	Email    *string `json:"email,omitempty" binding:"omitempty,email,max=320"`
+	Password *string `json:"password,omitempty" binding:"omitempty,notblank"`
+}
+
+type UsersResponse struct {
+	Result bool `json:"result"`
+	Users  []User
+}
+
+type UserResponse struct {
+	Result bool `json:"result"`
+	User   User
+}
+
+type User struct {
+	ID   int    `json:"id"`
+	Name string `json:"name"`
+	Role string `json:"role"`
+	// only for admins and the user, listings and public users leave it out
+	Email     string `json:"email,omitempty"`
+	CreatedAt int64  `json:"created_at"`
+	UpdatedAt int64  `json:"updated_at"`
+}
+
+// service settings from env vars and optional CONFIG_FILE
+var cfg = config.MustLoad()
+
+// INTERFACE LAYER, FACILITATING COMMUNICATION BETWEEN DIFFERENT COMPONENTS IN THE SYSTEM
+func routeRest(router *gin.Engine) {
+	// IDEMPOTENCY_TTL how long a create response is replayed for a repeated Idempotency-Key
+	idempotency := idempotencyMiddleware(newIdempotencyStore(), cfg.Duration("IDEMPOTENCY_TTL", 24*time.Hour))
+
+	// every version under /public-api/<version>, unversioned paths are routed to one by negotiateAPIVersion
+	for _, version := range apiVersions {
+		version.routes(router.Group("/public-api/"+version.name, apiVersionMiddleware(version.name)), idempotency)
+	}
+
+	// media files only on the urls signed in responses, when MEDIA_URL_SIGNER checks them
+	media := router.Group("/public-api/media", signedMediaMiddleware())
+	media.Static("/videos", videoPlaybackDir)
+	for _, rule := range mediaKinds {
+		media.Static("/"+rule.dir, filepath.Join(mediaDir, rule.dir))
+	}
+	router.GET("/s/:code", resolveShareLinkHandler)
+	router.GET("/public-api/diagnostics/breakers", apiKeyMiddleware(internalAPIKey), getBreakersHandler)
+	router.GET("/public-api/audit", adminMiddleware(), getAuditLogHandler)
+	router.GET("/metrics", apiKeyMiddleware(internalAPIKey), gin.WrapH(promhttp.Handler()))
+
+	// listings and users as a graph, reads only
+	router.POST("/public-api/graphql", graphqlHandler)
+	router.GET("/public-api/graphql/schema", getGraphQLSchemaHandler)
+
+	// delivery events of the email providers, signed by the provider
+	router.POST("/public-api/email-events/:provider", receiveEmailEventsHandler)
+
+	// operations of admins or of operators holding the internal api key
+	admin := router.Group("/public-api/admin", adminMiddleware())
+	admin.GET("/users", getAdminUsersHandler)
+	admin.PUT("/users/:id/role", setUserRoleHandler)
+	admin.PUT("/users/:id/legal-hold", setUserLegalHoldHandler)
+	admin.DELETE("/listings/:id", adminDeleteListingHandler)
+	admin.PUT("/listings/:id/legal-hold", setListingLegalHoldHandler)
+	admin.GET("/audit", getAuditLogHandler)
+	admin.POST("/events/replay", replayEventsHandler)
+	admin.GET("/actions", getAdminActionsHandler)
+	admin.GET("/actions/:id", getAdminActionHandler)
+	admin.POST("/actions/:id/approve", approveAdminActionHandler)
+	admin.POST("/actions/:id/reject", rejectAdminActionHandler)
+	admin.GET("/dead-letters", getDeadLettersHandler)
+	admin.GET("/dead-letters/:id", getDeadLetterHandler)
+	admin.PUT("/dead-letters/:id", updateDeadLetterHandler)
+	admin.DELETE("/dead-letters/:id", deleteDeadLetterHandler)
+	admin.POST("/dead-letters/:id/requeue", requeueDeadLetterHandler)
+	admin.GET("/notification-templates", getNotificationTemplatesHandler)
+	admin.POST("/notification-templates/preview", previewNotificationTemplateHandler)
+	admin.GET("/notification-templates/:event/:channel/:locale", getNotificationTemplateVersionsHandler)
+	admin.PUT("/notification-templates/:event/:channel/:locale", saveNotificationTemplateHandler)
+	admin.DELETE("/notification-templates/:event/:channel/:locale", deleteNotificationTemplateHandler)
+	admin.GET("/content-rules", getContentRulesHandler)
+	admin.PUT("/content-rules/:name", saveContentRuleHandler)
+	admin.DELETE("/content-rules/:name", deleteContentRuleHandler)
+	admin.GET("/broadcasts", getBroadcastsHandler)
+	admin.POST("/broadcasts", createBroadcastHandler)
+	admin.POST("/broadcasts/audience-count", countBroadcastAudienceHandler)
+	admin.GET("/broadcasts/:id", getBroadcastHandler)
+	admin.DELETE("/broadcasts/:id", cancelBroadcastHandler)
+	admin.GET("/email-suppressions", getEmailSuppressionsHandler)
+	admin.GET("/users/:id/email-suppression", getUserEmailSuppressionHandler)
+	admin.PUT("/users/:id/email-suppression", suppressUserEmailHandler)
+	admin.DELETE("/users/:id/email-suppression", unsuppressUserEmailHandler)
+	admin.GET("/users/:id/email-events", getUserEmailEventsHandler)
+
+	// tamper evident audit log, for auditors or operators holding the internal api key
+	auditor := router.Group("/public-api/auditor", auditorMiddleware())
+	auditor.GET("/audit-chain", getAuditChainHandler)
+	auditor.GET("/audit-chain/verify", verifyAuditChainHandler)
+}
+
+// routes of v1, the envelopes served before the API was versioned
+func routeV1(r *gin.RouterGroup, idempotency gin.HandlerFunc) {
+	r.GET("/listings", getListingsHandler)
+	r.POST("/listings", authMiddleware(), consentMiddleware(), idempotency, createListingHandler)
+	r.GET("/listings/export", authMiddleware(), exportListingsHandler)
+	r.GET("/listings/stream", streamListingsHandler)
+	r.GET("/listings/:id", readRegionMiddleware(), getListingHandler)
+	r.POST("/listings/bulk", authMiddleware(), consentMiddleware(), idempotency, createListingsBulkHandler)
+	r.PUT("/listings/:id", authMiddleware(), consentMiddleware(), updateListingHandler)
+	r.DELETE("/listings/:id", authMiddleware(), consentMiddleware(), deleteListingHandler)
+	r.POST("/listings/:id/videos", authMiddleware(), consentMiddleware(), uploadListingVideoHandler)
+	r.GET("/listings/:id/videos/:video_id", getListingVideoHandler)
+	r.POST("/listings/:id/media", authMiddleware(), consentMiddleware(), uploadListingMediaHandler)
+	r.POST("/listings/:id/images", authMiddleware(), consentMiddleware(), uploadListingImageHandler)
+	r.PUT("/listings/:id/media/:media_id/primary", authMiddleware(), consentMiddleware(), setPrimaryListingMediaHandler)
+	r.PATCH("/listings/:id/images/order", authMiddleware(), consentMiddleware(), reorderListingImagesHandler)
+	r.POST("/listings/:id/offers", authMiddleware(), consentMiddleware(), createListingOfferHandler)
+	r.GET("/listings/:id/offers", authMiddleware(), getListingOffersHandler)
+	r.GET("/listings/:id/offers/:offer_id", authMiddleware(), getListingOfferHandler)
+	r.POST("/listings/:id/offers/:offer_id/:action", authMiddleware(), consentMiddleware(), actListingOfferHandler)
+	r.POST("/listings/:id/share-link", authMiddleware(), consentMiddleware(), createShareLinkHandler)
+	r.GET("/listings/:id/share-links", authMiddleware(), getShareLinksHandler)
+	r.GET("/listings/:id/qr.png", authMiddleware(), getListingQRCodeHandler)
+	r.GET("/listings/:id/og", getListingPreviewHandler)
+	r.GET("/listings/:id/price-history", getListingPriceHistoryHandler)
+	r.GET("/listings/:id/viewing-slots", getViewingSlotsHandler)
+	r.POST("/listings/:id/viewing-slots", authMiddleware(), consentMiddleware(), createViewingSlotHandler)
+	r.DELETE("/listings/:id/viewing-slots/:slot_id", authMiddleware(), cancelViewingSlotHandler)
+	r.POST("/listings/:id/viewing-slots/:slot_id/bookings", authMiddleware(), consentMiddleware(), bookViewingHandler)
+	r.GET("/listings/:id/viewings", authMiddleware(), getListingViewingsHandler)
+	r.GET("/viewings", authMiddleware(), getViewingsHandler)
+	r.GET("/viewings.ics", authMiddleware(), getViewingsCalendarHandler)
+	r.DELETE("/viewings/:id", authMiddleware(), cancelViewingHandler)
+	r.GET("/me/calendar.ics", authMiddleware(), getMyCalendarHandler)
+	r.GET("/me/privacy", authMiddleware(), getMyPrivacyHandler)
+	r.PATCH("/me/privacy", authMiddleware(), updateMyPrivacyHandler)
+	r.GET("/me/notification-preferences", authMiddleware(), getMyNotificationPreferencesHandler)
+	r.PUT("/me/notification-preferences", authMiddleware(), updateMyNotificationPreferencesHandler)
+	r.GET("/me/notifications", authMiddleware(), getMyNotificationsHandler)
+	r.POST("/me/notifications/read", authMiddleware(), markNotificationsReadHandler)
+	r.POST("/me/notifications/:id/read", authMiddleware(), markNotificationReadHandler)
+	r.GET("/me/digest", authMiddleware(), getMyDigestHandler)
+	r.PUT("/me/digest", authMiddleware(), updateMyDigestHandler)
+	r.GET("/saved-searches", authMiddleware(), getSavedSearchesHandler)
+	r.POST("/saved-searches", authMiddleware(), consentMiddleware(), createSavedSearchHandler)
+	r.DELETE("/saved-searches/:id", authMiddleware(), deleteSavedSearchHandler)
+	r.GET("/digests/unsubscribe", unsubscribeDigestHandler)
+	r.POST("/digests/unsubscribe", unsubscribeDigestHandler)
+	r.GET("/users", getUsersHandler)
+	r.POST("/users", rateLimitMiddleware(signupLimiter), idempotency, createUserHandler)
+	r.POST("/login", loginHandler)
+	r.GET("/policies", getPoliciesHandler)
+	r.GET("/events/schemas", getEventSchemasHandler)
+	r.GET("/events/schemas/:type/:version", getEventSchemaHandler)
+	r.POST("/events/schemas/:type/compatibility", checkEventSchemaHandler)
+	r.GET("/consents", authMiddleware(), getConsentsHandler)
+	r.POST("/consents", authMiddleware(), acceptPolicyHandler)
+	r.GET("/blocks", authMiddleware(), getBlocksHandler)
+	r.POST("/blocks", authMiddleware(), blockUserHandler)
+	r.DELETE("/blocks/:user_id", authMiddleware(), unblockUserHandler)
+	r.GET("/devices", authMiddleware(), getDevicesHandler)
+	r.POST("/devices", authMiddleware(), registerDeviceHandler)
+	r.DELETE("/devices/:id", authMiddleware(), deleteDeviceHandler)
+	r.GET("/devices/:id/receipts", authMiddleware(), getPushReceiptsHandler)
+	r.GET("/webhooks", authMiddleware(), getWebhooksHandler)
+	r.POST("/webhooks", authMiddleware(), consentMiddleware(), createWebhookHandler)
+	r.DELETE("/webhooks/:id", authMiddleware(), deleteWebhookHandler)
+	r.GET("/webhooks/:id/deliveries", authMiddleware(), getWebhookDeliveriesHandler)
+	r.PATCH("/users/:id", authMiddleware(), consentMiddleware(), updateUserHandler)
+	r.GET("/users/:id", getUserHandler)
+	r.GET("/users/:id/profile", getUserProfileHandler)
+	r.GET("/users/:id/favorites", authMiddleware(), getFavoritesHandler)
+	r.POST("/users/:id/favorites/:listing_id", authMiddleware(), consentMiddleware(), addFavoriteHandler)
+	r.DELETE("/users/:id/favorites/:listing_id", authMiddleware(), removeFavoriteHandler)
+	r.DELETE("/users/:id", authMiddleware(), deleteUserHandler)
+	r.GET("/writes/:id", authMiddleware(), getQueuedWriteHandler)
+	r.POST("/jobs", authMiddleware(), createJobHandler)
+	r.GET("/jobs/:id", authMiddleware(), getJobHandler)
+	r.DELETE("/jobs/:id", authMiddleware(), cancelJobHandler)
+}
+
+// Run start the public API on BIND_ADDRESS and HTTP_PORT until SIGINT/SIGTERM
+func Run() {
+	// LOG_LEVEL debug/info/warn/error, default info
+	slog.SetDefault(logging.New(cfg.String("OTEL_SERVICE_NAME", "public-api"), cfg.String("LOG_LEVEL", "info")))
+
+	stopTracing := initTracing()
+	defer stopTracing()
+
+	// call the user service over the transport of USER_SERVICE_TRANSPORT
+	userClient = newUserClient()
+
+	// call the listing service over the transport of LISTING_SERVICE_TRANSPORT
+	listingClient = newListingClient()
+
+	// scan uploads with the engine of MEDIA_SCANNER
+	fileScanner = newFileScanner()
+
+	// store uploaded media in the backend of MEDIA_STORAGE
+	mediaStorage = newMediaStorage()
+
+	// sign the media urls of responses with the signer of MEDIA_URL_SIGNER
+	mediaURLSigner = newMediaURLSigner()
+
+	// push notifications through the platforms of PUSH_FCM_CREDENTIALS_FILE and PUSH_APNS_KEY_FILE
+	pushSenders = newPushSenders()
+	emailProviders = newEmailProviders()
+
+	// render notifications with the templates of the user service, fetched every NOTIFICATION_TEMPLATE_TTL
+	notificationTemplates = newNotificationTemplates()
+
+	// check listings and offer messages against the spam and scam rules of the user service, fetched every CONTENT_RULE_TTL
+	contentRules = newContentRules()
+
+	// publish the events of the listing service outbox to the broker of EVENT_PUBLISHER
+	startListingOutboxRelay()
+
+	// keep the read model of READ_REGION from the events of the listing and user services
+	startReadModel()
+
+	// stream the listings created to the clients of GET /listings/stream
+	startListingStream()
+
+	router := newRouter()
+
+	// start a span per request, continuing the trace of the caller
+	router.Use(otelgin.Middleware(cfg.String("OTEL_SERVICE_NAME", "public-api")))
+
+	// measure every request including rejected ones
+	router.Use(metricsMiddleware())
+
+	// REQUEST_TIMEOUT max duration of a request, LONG_REQUEST_TIMEOUT of uploads and exports
+	router.Use(deadlineMiddleware(cfg.Duration("REQUEST_TIMEOUT", 30*time.Second), cfg.Duration("LONG_REQUEST_TIMEOUT", 10*time.Minute)))
+
+	// nosniff, frame options and referrer policy on every response
+	router.Use(securityHeadersMiddleware())
+
+	// let browser clients of CORS_ALLOWED_ORIGINS call the API
+	router.Use(corsMiddleware(corsPolicyFromConfig()))
+
+	// gzip responses for clients accepting it and answer unchanged GET responses with 304
+	router.Use(gzipMiddleware(), etagMiddleware())
+
+	// set client ip and geo info for every request
+	router.Use(clientIPMiddlewareFromConfig())
+
+	// limit requests per client ip
+	router.Use(rateLimitMiddleware(newRateLimiterFromConfig()))
+
+	// list upstream calls in the response of X-Debug requests
+	router.Use(debugMiddleware())
+
+	// CONSISTENCY_DEFAULT strong or eventual reads of requests without the Consistency header
+	router.Use(consistencyMiddleware(cfg.String("CONSISTENCY_DEFAULT", consistencyEventual)))
+
+	// apply defaults and normalization rules to request bodies before handlers bind them
+	router.Use(requestRulesMiddleware(loadRequestRules()))
+
+	// record every write in the audit log of the user service
+	router.Use(auditMiddleware())
+
+	// set rest route
+	routeRest(router)
+
+	// transcode uploaded videos in background
+	startVideoWorkers(newTranscoder())
+
+	// replay creates queued while a backend was down
+	startWriteReplayer()
+
+	// run exports and other long running jobs
+	startJobWorkers()
+
+	// remind visitors and owners of upcoming viewings
+	startViewingReminders()
+
+	// send the digests of new listings matching saved searches
+	startDigests()
+
+	// fan announcements out to their audience
+	startBroadcasts()
+
+	addr := cfg.ListenAddr("6002")
+	slog.Info("starting public API layer", "addr", addr, "container", cfg.InContainer())
+	srv := &http.Server{Addr: addr, Handler: negotiateAPIVersion(router)}
+	// listing streams last as long as their clients, shutdown would wait for them
+	srv.RegisterOnShutdown(closeListingStreams)
+	serve(srv)
+}
+
+// run server until SIGINT/SIGTERM then let in-flight requests, transcodes, write replays, jobs, viewing reminders,
+// digests, broadcasts, notifications, the outbox relay, the read model and the listing stream finish
+// within SHUTDOWN_TIMEOUT
+func serve(srv *http.Server) {
+	go func() {
+		if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Fatal(err)
+		}
+	}()
+
+	quit := make(chan os.Signal, 1)
+	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
+	<-quit
+	slog.Info("shutting down public API layer")
+
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.Duration("SHUTDOWN_TIMEOUT", 10*time.Second))
+	defer cancel()
+
+	if err := srv.Shutdown(ctx); err != nil {
+		slog.ErrorContext(ctx, "main error", "code", "095", "error", err)
+	}
+
+	stopVideoWorkers(ctx)
+	stopWriteReplayer(ctx)
+	stopJobWorkers(ctx)
+	stopViewingReminders(ctx)
+	stopDigests(ctx)
+	stopBroadcasts(ctx)
+	stopNotifications(ctx)
+	stopListingOutboxRelay(ctx)
+	stopReadModel(ctx)
+	stopListingStream(ctx)
+}
+
+// set gin engine with mode, trusted proxies and fallback handlers
+func newRouter() *gin.Engine {
+	// GIN_MODE release/debug/test, default debug, release in a container
+	defaultMode := gin.DebugMode
+	if cfg.InContainer() {
+		defaultMode = gin.ReleaseMode
+	}
+	mode := cfg.String("GIN_MODE", defaultMode)
+	switch mode {
+	case gin.ReleaseMode, gin.DebugMode, gin.TestMode:
+	default:
+		log.Fatalf("invalid GIN_MODE %q", mode)
+	}
+	gin.SetMode(mode)
+
+	// json field names and custom tags in request validation errors
+	apperror.RegisterValidators()
+
+	router := gin.New()
+	// json access log with request id, and panics logged as json too
+	router.Use(logging.Recovery(), logging.Middleware())
+
+	// TRUSTED_PROXIES comma separated ip or cidr, empty trust no proxy so client ip is the remote address
+	if err := router.SetTrustedProxies(cfg.List("TRUSTED_PROXIES")); err != nil {
+		log.Fatal(err)
+	}
+
+	// return standard error envelope instead of gin default
+	router.HandleMethodNotAllowed = true
+	router.NoRoute(noRouteHandler)
+	router.NoMethod(noMethodHandler)
+
+	return router
+}
+
+// =========== INTERFACE HANDLER, HANDLING REQUEST RESPONSE API DEPEND INTERFACE ===========
+
+// GEO_DEFAULT_SEARCH=true default listings search region to client geo region
+var geoDefaultSearch = cfg.Bool("GEO_DEFAULT_SEARCH", false)
+
+// handler response unknown route
+func noRouteHandler(c *gin.Context) {
+	if respondUnknownAPIVersion(c) {
+		return
+	}
+
+	apperror.JSON(c, http.StatusNotFound, "Not Found")
+}
+
+// handler response route exist with other method
+func noMethodHandler(c *gin.Context) {
+	apperror.JSON(c, http.StatusMethodNotAllowed, "Method Not Allowed")
+}
+
+func getListingsHandler(c *gin.Context) {
+	pageNum, err := strconv.Atoi(c.DefaultQuery("page_num", "1"))
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "handler error", "code", "020", "error", err)
+		apperror.JSON(c, http.StatusBadRequest, "Invalid page_num param")
+		return
+	}
+
+	pageSize, err := strconv.Atoi(c.DefaultQuery("page_size", "10"))
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "handler error", "code", "019", "error", err)
+		apperror.JSON(c, http.StatusBadRequest, "Invalid page_size param")
+		return
+	}
+
+	// default region to client geo when no region filter is given, opt out with geo_default=false
+	region := c.Query("region")
+	defaultRegion := ""
+	if region == "" && geoDefaultSearch && c.Query("geo_default") != "false" {
+		if geo := clientGeo(c); geo != nil && geo.Region != "" {
+			region = geo.Region
+			defaultRegion = geo.Region
+		}
+	}
+
+	units, err := parseAreaUnits(c.Query("units"))
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "handler error", "code", "040", "error", err)
+		apperror.Respond(c, err)
+		return
+	}
+	variant, err := parseMediaVariant(c)
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "handler error", "code", "574", "error", err)
+		apperror.Respond(c, err)
+		return
+	}
+
+	userID := c.Query("user_id")
+	res, pagination, err := getListingsUsecase(c.Request.Context(), userID, region, pageNum, pageSize, c.Query("sort_by"), c.Query("sort_dir"))
+	if err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+
+	for i := range res {
+		transformListingArea(&res[i].Area, &res[i].AreaUnits, units)
+		transformListingMedia(c.Request.Context(), res[i].Images, res[i].Media, &res[i].VideoURL, variant)
+	}
+
+	response := gin.H{"result": true, "listings": res, "pagination": pagination}
+	// prices in one currency whatever the currency of each listing, for buyers comparing across markets
+	if convertTo := c.Query("convert_to"); convertTo != "" {
+		rates, err := convertListingPrices(c.Request.Context(), res, convertTo)
+		if err != nil {
+			apperror.Respond(c, err)
+			return
+		}
+		response["rates_fetched_at"] = rates.FetchedAt.UnixMicro()
+	}
+	if defaultRegion != "" {
+		response["default_region"] = defaultRegion
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+func getListingHandler(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "handler error", "code", "507", "error", err)
+		apperror.JSON(c, http.StatusBadRequest, "Invalid listing ID")
+		return
+	}
+
+	units, err := parseAreaUnits(c.Query("units"))
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "handler error", "code", "508", "error", err)
+		apperror.Respond(c, err)
+		return
+	}
+	variant, err := parseMediaVariant(c)
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "handler error", "code", "575", "error", err)
+		apperror.Respond(c, err)
+		return
+	}
+
+	res, staleness, err := readListingUsecase(c.Request.Context(), id)
+	if err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+	if staleness != nil {
+		c.Header(headerReadRegion, readModel.region)
+		c.Header(headerReadStaleness, strconv.FormatInt(staleness.Milliseconds(), 10))
+	}
+	transformListingArea(&res.Area, &res.AreaUnits, units)
+	transformListingMedia(c.Request.Context(), res.Images, res.Media, &res.VideoURL, variant)
+
+	listing := []Listing{*res}
+	response := gin.H{"result": true}
+	// converted the same way as a page of get listings
+	if convertTo := c.Query("convert_to"); convertTo != "" {
+		rates, err := convertListingPrices(c.Request.Context(), listing, convertTo)
+		if err != nil {
+			apperror.Respond(c, err)
+			return
+		}
+		response["rates_fetched_at"] = rates.FetchedAt.UnixMicro()
+	}
+	response["listing"] = listing[0]
+
+	c.JSON(http.StatusOK, response)
+}
+
+func createListingHandler(c *gin.Context) {
+	var body Listing
+	if err := c.ShouldBindJSON(&body); err != nil {
+		slog.ErrorContext(c.Request.Context(), "handler error", "code", "018", "error", err)
+		apperror.RespondBinding(c, err)
+		return
+	}
+
+	// listing always belongs to the authenticated user
+	if body.UserID != 0 && body.UserID != authUserID(c) {
+		apperror.JSON(c, http.StatusForbidden, "Cannot create listing for another user")
+		return
+	}
+	body.UserID = authUserID(c)
+
+	units, err := parseAreaUnits(c.Query("units"))
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "handler error", "code", "041", "error", err)
+		apperror.Respond(c, err)
+		return
+	}
+	variant, err := parseMediaVariant(c)
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "handler error", "code", "576", "error", err)
+		apperror.Respond(c, err)
+		return
+	}
+	body.Area = areaToCanonical(body.Area, units)
+
+	res, err := createListingUsecase(c.Request.Context(), body)
+	if err != nil {
+		if writeBehind && errors.Is(err, errBackendUnavailable) {
+			queueWriteHandler(c, writeKindListing, body, "")
+			return
+		}
+		apperror.Respond(c, err)
+		return
+	}
+	transformListingArea(&res.Area, &res.AreaUnits, units)
+	transformListingMedia(c.Request.Context(), res.Images, res.Media, &res.VideoURL, variant)
+
+	c.JSON(http.StatusCreated, gin.H{"listing": res})
+}
+
+func updateListingHandler(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "handler error", "code", "021", "error", err)
+		apperror.JSON(c, http.StatusBadRequest, "Invalid listing ID")
+		return
+	}
+
+	var body ListingUpdate
+	if err := c.ShouldBindJSON(&body); err != nil {
+		slog.ErrorContext(c.Request.Context(), "handler error", "code", "022", "error", err)
+		apperror.RespondBinding(c, err)
+		return
+	}
+
+	units, err := parseAreaUnits(c.Query("units"))
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "handler error", "code", "042", "error", err)
+		apperror.Respond(c, err)
+		return
+	}
+	variant, err := parseMediaVariant(c)
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "handler error", "code", "577", "error", err)
+		apperror.Respond(c, err)
+		return
+	}
+	body.Area = areaToCanonical(body.Area, units)
+
+	res, err := updateListingUsecase(c.Request.Context(), id, authUserID(c), body)
+	if err != nil {
+		if errors.Is(err, errListingNotOwned) {
+			apperror.JSON(c, http.StatusForbidden, "Listing does not belong to user")
+			return
+		}
+		apperror.Respond(c, err)
+		return
+	}
+	transformListingArea(&res.Area, &res.AreaUnits, units)
+	transformListingMedia(c.Request.Context(), res.Images, res.Media, &res.VideoURL, variant)
+
+	c.JSON(http.StatusOK, gin.H{"listing": res})
+}
+
+func deleteListingHandler(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "handler error", "code", "032", "error", err)
+		apperror.JSON(c, http.StatusBadRequest, "Invalid listing ID")
+		return
+	}
+
+	// soft delete unless hard=true
+	hard := c.Query("hard") == "true"
+	if err := deleteListingUsecase(c.Request.Context(), id, authUserID(c), hard); err != nil {
+		if errors.Is(err, errListingNotOwned) {
+			apperror.JSON(c, http.StatusForbidden, "Listing does not belong to user")
+			return
+		}
+		apperror.Respond(c, err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+func createUserHandler(c *gin.Context) {
+	var body UserCreate
+	if err := c.ShouldBindJSON(&body); err != nil {
+		slog.ErrorContext(c.Request.Context(), "handler error", "code", "017", "error", err)
+		apperror.RespondBinding(c, err)
+		return
+	}
+
+	res, err := createUserUsecase(c.Request.Context(), body, requestLocale(c))
+	if err != nil {
+		if writeBehind && errors.Is(err, errBackendUnavailable) {
+			queueWriteHandler(c, writeKindUser, body, requestLocale(c))
+			return
+		}
+		apperror.Respond(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"user": res})
+}
+
+func updateUserHandler(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "handler error", "code", "137", "error", err)
+		apperror.JSON(c, http.StatusBadRequest, "Invalid user ID")
+		return
+	}
+
+	// users only update themselves
+	if id != authUserID(c) {
+		apperror.JSON(c, http.StatusForbidden, "Cannot update another user")
+		return
+	}
+
+	var body UserUpdate
+	if err := c.ShouldBindJSON(&body); err != nil {
+		slog.ErrorContext(c.Request.Context(), "handler error", "code", "138", "error", err)
+		apperror.RespondBinding(c, err)
+		return
+	}
+
+	res, err := updateUserUsecase(c.Request.Context(), id, body, requestLocale(c))
+	if err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"user": res})
+}
+
+func deleteUserHandler(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "handler error", "code", "033", "error", err)
+		apperror.JSON(c, http.StatusBadRequest, "Invalid user ID")
+		return
+	}
+
+	// users only delete themselves, operators delete others on the user service
+	if id != authUserID(c) {
+		apperror.JSON(c, http.StatusForbidden, "Cannot delete another user")
+		return
+	}
+
+	// soft delete unless hard=true
+	hard := c.Query("hard") == "true"
+	if err := deleteUserUsecase(c.Request.Context(), id, hard); err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// =========== USECASE LAYER, SERVES AS AN INTERMEDIARY BETWEEN THE PRESENTATION LAYER AND THE DATA LAYER ===========
+
+func getListingsUsecase(ctx context.Context, userId, region string, pageNum, pageSize int, sortBy, sortDir string) ([]Listing, *Pagination, error) {
+	// only whitelisted columns are forwarded, empty keep the listing service default
+	if (sortBy != "" && !listingSortColumns[sortBy]) || (sortDir != "" && sortDir != "asc" && sortDir != "desc") {
+		return nil, nil, errInvalidSort
+	}
+
+	res, err := findListingsService(ctx, userId, region, pageNum, pageSize, sortBy, sortDir)
+	if err != nil {
+		return nil, nil, apperror.Upstream("Failed to get listings", err)
+	}
+
+	if !res.Result {
+		slog.ErrorContext(ctx, "usecase error", "code", "016", "error", "api result failed: failed to get listings")
+		return nil, nil, apperror.Upstream("Failed to get listings", nil)
+	}
+
+	// fetch every unique user of the page in batches and join in memory
+	var userIDs []int
+	seen := map[int]bool{}
+	for _, val := range res.Listings {
+		if !seen[val.UserID] {
+			seen[val.UserID] = true
+			userIDs = append(userIDs, val.UserID)
+		}
+	}
+
+	users, err := fetchUsersByIDs(ctx, userIDs)
+	if err != nil {
+		return nil, nil, apperror.Upstream("Failed to get users", err)
+	}
+
+	var listings []Listing
+	for _, val := range res.Listings {
+		// soft deleted users are not returned, their listings keep only the user id
+		user, ok := users[val.UserID]
+		if !ok {
+			slog.WarnContext(ctx, "usecase error", "code", "043", "error", "user of listing not found", "user_id", val.UserID)
+			user = User{ID: val.UserID}
+		}
+
+		listings = append(listings, Listing{
+			ID:           val.ID,
+			UserID:       val.UserID,
+			ListingType:  val.ListingType,
+			Price:        val.Price,
+			Currency:     val.Currency,
+			Region:       val.Region,
+			Area:         val.Area,
+			VideoURL:     val.VideoURL,
+			Media:        val.Media,
+			Images:       val.Images,
+			QualityScore: val.QualityScore,
+			CreatedAt:    val.CreatedAt,
+			UpdatedAt:    val.UpdatedAt,
+			User: User{
+				ID:        user.ID,
+				Name:      user.Name,
+				CreatedAt: user.CreatedAt,
+				UpdatedAt: user.UpdatedAt,
+			},
+		})
+	}
+
+	return listings, &res.Pagination, nil
+}
+
+// listing with its user, a soft deleted user keeps only the user id as in get listings
+func getListingUsecase(ctx context.Context, listingID int) (*Listing, error) {
+	res, err := findListingByIDService(ctx, listingID)
+	if err != nil {
+		if errors.Is(err, errListingNotFound) {
+			return nil, err
+		}
+		return nil, apperror.Upstream("Failed to get listing", err)
+	}
+
+	users, err := fetchUsersByIDs(ctx, []int{res.Listing.UserID})
+	if err != nil {
+		return nil, apperror.Upstream("Failed to get users", err)
+	}
+	user, ok := users[res.Listing.UserID]
+	if !ok {
+		slog.WarnContext(ctx, "usecase error", "code", "509", "error", "user of listing not found", "user_id", res.Listing.UserID)
+		user = User{ID: res.Listing.UserID}
+	}
+
+	val := res.Listing
+	return &Listing{
+		ID:           val.ID,
+		UserID:       val.UserID,
+		ListingType:  val.ListingType,
+		Price:        val.Price,
+		Currency:     val.Currency,
+		Region:       val.Region,
+		Area:         val.Area,
+		VideoURL:     val.VideoURL,
+		Media:        val.Media,
+		Images:       val.Images,
+		QualityScore: val.QualityScore,
+		CreatedAt:    val.CreatedAt,
+		UpdatedAt:    val.UpdatedAt,
+		User: User{
+			ID:        user.ID,
+			Name:      user.Name,
+			CreatedAt: user.CreatedAt,
+			UpdatedAt: user.UpdatedAt,
+		},
+	}, nil
+}
+
+func createListingUsecase(ctx context.Context, listing Listing) (*ListingCreate, error) {
+	if err := checkContentListing(ctx, listing); err != nil {
+		return nil, err
+	}
+
+	listingJSON, err := json.Marshal(listing)
+	if err != nil {
+		slog.ErrorContext(ctx, "usecase error", "code", "015", "error", err)
+		return nil, err
+	}
+
+	res, err := createListingService(ctx, listingJSON)
+	if err != nil {
+		if isBackendUnavailable(err) {
+			return nil, errBackendUnavailable
+		}
+		return nil, apperror.Upstream("Failed to create listing", err)
+	}
+
+	if !res.Result {
+		slog.ErrorContext(ctx, "usecase error", "code", "014", "error", "api result failed: failed to create listings")
+		return nil, apperror.Upstream("Failed to create listing", nil)
+	}
+
+	return &res.Listing, nil
+}
+
+var (
+	errListingNotFound  = apperror.NotFound("Listing not found")
+	errListingNotOwned  = errors.New("listing does not belong to user")
+	errListingLegalHold = apperror.Conflict("Listing is under legal hold")
+	ErrUserNotFound     = apperror.NotFound("User not found")
+	ErrUserLegalHold    = apperror.Conflict("User is under legal hold")
+	ErrUserUpdateEmpty  = apperror.Validation("nothing to update, set name, email or password")
+	ErrUserEmailTaken   = apperror.Conflict("Email is already used by another user")
+	errInvalidSort      = apperror.Validation("invalid sort param, sort_by supported values: price, created_at, updated_at, sort_dir supported values: asc, desc")
+)
+
+// columns listings can be sorted by
+var listingSortColumns = map[string]bool{"price": true, "created_at": true, "updated_at": true}
+
+func updateListingUsecase(ctx context.Context, id, userID int, update ListingUpdate) (*ListingCreate, error) {
+	// make sure listing belongs to requesting user before forwarding
+	listing, err := findOwnedListing(ctx, id, userID)
+	if err != nil {
+		if errors.Is(err, errListingNotOwned) {
+			slog.ErrorContext(ctx, "usecase error", "code", "023", "error", err)
+		}
+		return nil, err
+	}
+	auditBefore(ctx, func() (any, error) { return listing, nil })
+
+	// checked as the listing will be once updated
+	updated := Listing{ListingType: listing.ListingType, Price: listing.Price, Currency: listing.Currency, Region: listing.Region}
+	if update.ListingType != "" {
+		updated.ListingType = update.ListingType
+	}
+	if update.Price != 0 {
+		updated.Price = update.Price
+	}
+	if update.Currency != "" {
+		updated.Currency = update.Currency
+	}
+	if err := checkContentListing(ctx, updated); err != nil {
+		return nil, err
+	}
+
+	res, err := updateListingService(ctx, id, update)
+	if err != nil {
+		if errors.Is(err, errListingNotFound) {
+			return nil, err
+		}
+		return nil, apperror.Upstream("Failed to update listing", err)
+	}
+
+	if !res.Result {
+		slog.ErrorContext(ctx, "usecase error", "code", "024", "error", "api result failed: failed to update listing")
+		return nil, apperror.Upstream("Failed to update listing", nil)
+	}
+
+	return &res.Listing, nil
+}
+
+func deleteListingUsecase(ctx context.Context, id, userID int, hard bool) error {
+	listing, err := findOwnedListing(ctx, id, userID)
+	if err != nil {
+		return err
+	}
+	auditBefore(ctx, func() (any, error) { return listing, nil })
+
+	if err := deleteListingService(ctx, id, hard); err != nil {
+		if errors.Is(err, errListingNotFound) || errors.Is(err, errListingLegalHold) {
+			return err
+		}
+		return apperror.Upstream("Failed to delete listing", err)
+	}
+
+	return nil
+}
+
+func createUserUsecase(ctx context.Context, user UserCreate, locale string) (*User, error) {
+	user.Name = maskProfanity("user name", user.Name, locale)
+
+	userJSON, err := json.Marshal(user)
+	if err != nil {
+		slog.ErrorContext(ctx, "usecase error", "code", "013", "error", err)
+		return nil, err
+	}
+
+	res, err := createUserService(ctx, userJSON)
+	if err != nil {
+		if isBackendUnavailable(err) {
+			return nil, errBackendUnavailable
+		}
+		if errors.Is(err, ErrUserEmailTaken) {
+			return nil, err
+		}
+		return nil, apperror.Upstream("Failed to create user", err)
+	}
+
+	return &res.User, nil
+}
+
+func updateUserUsecase(ctx context.Context, id int, update UserUpdate, locale string) (*User, error) {
+	if update.Name == nil && update.Email == nil && update.Password == nil {
+		return nil, ErrUserUpdateEmpty
+	}
+
+	if update.Name != nil {
+		name := maskProfanity("user name", *update.Name, locale)
+		update.Name = &name
+	}
+
+	userJSON, err := json.Marshal(update)
+	if err != nil {
+		slog.ErrorContext(ctx, "usecase error", "code", "139", "error", err)
+		return nil, err
+	}
+
+	auditBefore(ctx, auditUserLookup(ctx, id))
+
+	res, err := updateUserService(ctx, id, userJSON)
+	if err != nil {
+		if errors.Is(err, ErrUserNotFound) || errors.Is(err, apperror.ErrValidation) || errors.Is(err, ErrUserEmailTaken) {
+			return nil, err
+		}
+		return nil, apperror.Upstream("Failed to update user", err)
+	}
+
+	return &res.User, nil
+}
+
+func deleteUserUsecase(ctx context.Context, id int, hard bool) error {
+	auditBefore(ctx, auditUserLookup(ctx, id))
+	if err := deleteUserService(ctx, id, hard); err != nil {
+		if errors.Is(err, ErrUserNotFound) || errors.Is(err, ErrUserLegalHold) {
+			return err
+		}
+		return apperror.Upstream("Failed to delete user", err)
+	}
+
+	return nil
+}
+
+// =========== REPOSITORY LAYER, ABSTRACTION OVER THE DATA PERSISTENCE (databases, file systems, or external APIs) ===========
+
+var (
+	// downstream service base url
+	listingServiceURL = strings.TrimRight(cfg.String("LISTING_SERVICE_URL", "http://localhost:6000"), "/")
+	userServiceURL    = strings.TrimRight(cfg.String("USER_SERVICE_URL", "http://localhost:6001"), "/")
+
+	// listing service api path
+	apiPathListingGetList = listingServiceURL + "/listings"
+	apiPathListingCreate  = listingServiceURL + "/listings"
+	apiPathListingDetail  = listingServiceURL + "/listings/%d"
+	apiPathListingDelete  = listingServiceURL + "/listings/%d?hard=%t"
+
+	// user service api path
+	apiPathUserGetDetail = userServiceURL + "/users/%d"
+	apiPathUserGetBatch  = userServiceURL + "/users?ids=%s"
+	apiPathUserCreate    = userServiceURL + "/users"
+	apiPathUserDelete    = userServiceURL + "/users/%d?hard=%t"
+	apiPathUserUpdate    = userServiceURL + "/users/%d"
+)
+
+func listingsPageURL(userID, region string, pageNum, pageSize int, sortBy, sortDir string) string {
+	query := url.Values{
+		"page_num":  {strconv.Itoa(pageNum)},
+		"page_size": {strconv.Itoa(pageSize)},
+		"user_id":   {userID},
+		"region":    {region},
+		"sort_by":   {sortBy},
+		"sort_dir":  {sortDir},
+	}
+	return apiPathListingGetList + "?" + query.Encode()
+}
+
+func fetchListingsService(ctx context.Context, userID, region string, pageNum, pageSize int, sortBy, sortDir string) (*ListingsResponse, error) {
+	return listingClient.FetchListings(ctx, userID, region, pageNum, pageSize, sortBy, sortDir)
+}
+
+func createListingService(ctx context.Context, listingByte []byte) (*ListingCreateResponse, error) {
+	defer listingsCache.invalidate(ctx)
+
+	return listingClient.CreateListing(ctx, listingByte)
+}
+
+func findListingByIDService(ctx context.Context, listingID int) (*ListingDetailResponse, error) {
+	return listingClient.FindListing(ctx, listingID)
+}
+
+func updateListingService(ctx context.Context, listingID int, update ListingUpdate) (*ListingDetailResponse, error) {
+	defer listingsCache.invalidate(ctx)
+
+	return listingClient.UpdateListing(ctx, listingID, update)
+}
+
+func deleteListingService(ctx context.Context, listingID int, hard bool) error {
+	defer listingsCache.invalidate(ctx)
+
+	return listingClient.DeleteListing(ctx, listingID, hard)
+}
+
+func (httpListingClient) FetchListings(ctx context.Context, userID, region string, pageNum, pageSize int, sortBy, sortDir string) (*ListingsResponse, error) {
+	// Call Listing Service to get listings
+	resp, err := httpGet(ctx, listingsPageURL(userID, region, pageNum, pageSize, sortBy, sortDir))
+	if err != nil {
+		slog.ErrorContext(ctx, "service error", "code", "001", "error", err)
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		slog.ErrorContext(ctx, "service error", "code", "002", "error", "error fetching listings from listing service")
+		return nil, errors.New("error fetching listings from listing service")
+	}
+
+	var listings ListingsResponse
+	if err := decodeJSON(resp.Body, &listings); err != nil {
+		slog.ErrorContext(ctx, "service error", "code", "003", "error", err)
+		return nil, err
+	}
+
+	return &listings, err
+}
+
+func (httpListingClient) CreateListing(ctx context.Context, listingByte []byte) (*ListingCreateResponse, error) {
+	var listing ListingCreate
+	if err := json.Unmarshal(listingByte, &listing); err != nil {
+		slog.ErrorContext(ctx, "service error", "code", "253", "error", err)
+		return nil, err
+	}
+
+	// listing service reads the fields of a create as form arguments
+	form := url.Values{
+		"user_id":      {strconv.Itoa(listing.UserID)},
+		"listing_type": {listing.ListingType},
+		"price":        {strconv.Itoa(listing.Price)},
+	}
+	if listing.Currency != "" {
+		form.Set("currency", listing.Currency)
+	}
+	if listing.Region != "" {
+		form.Set("region", listing.Region)
+	}
+	if listing.Area != 0 {
+		form.Set("area", strconv.FormatFloat(listing.Area, 'f', -1, 64))
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, apiPathListingCreate, strings.NewReader(form.Encode()))
+	if err != nil {
+		slog.ErrorContext(ctx, "service error", "code", "147", "error", err)
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	// listing service keeps the key unique per user, so a retried create returns the first listing
+	if key := idempotencyKey(ctx); key != "" {
+		req.Header.Set(headerIdempotencyKey, key)
+	}
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		slog.ErrorContext(ctx, "service error", "code", "004", "error", err)
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		slog.ErrorContext(ctx, "service error", "code", "005", "error", "error creating listing from listing service")
+		return nil, errors.New("error creating listing from listing service")
+	}
+
+	var created ListingCreateResponse
+	if err := decodeJSON(resp.Body, &created); err != nil {
+		slog.ErrorContext(ctx, "service error", "code", "006", "error", err)
+		return nil, err
+	}
+
+	return &created, nil
+}
+
+func (httpListingClient) FindListing(ctx context.Context, listingID int) (*ListingDetailResponse, error) {
+	resp, err := httpGet(ctx, fmt.Sprintf(apiPathListingDetail, listingID))
+	if err != nil {
+		slog.ErrorContext(ctx, "service error", "code", "025", "error", err)
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, errListingNotFound
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		slog.ErrorContext(ctx, "service error", "code", "026", "error", "error fetching listing from listing service")
+		return nil, errors.New("error fetching listing from listing service")
+	}
+
+	var listing ListingDetailResponse
+	if err := decodeJSON(resp.Body, &listing); err != nil {
+		slog.ErrorContext(ctx, "service error", "code", "027", "error", err)
+		return nil, err
+	}
+
+	return &listing, nil
+}
+
+func (httpListingClient) UpdateListing(ctx context.Context, listingID int, update ListingUpdate) (*ListingDetailResponse, error) {
+	form := url.Values{}
+	if update.ListingType != "" {
+		form.Set("listing_type", update.ListingType)
+	}
+	if update.Price != 0 {
+		form.Set("price", strconv.Itoa(update.Price))
+	}
+	if update.Currency != "" {
+		form.Set("currency", update.Currency)
+	}
+	if update.Area != 0 {
+		form.Set("area", strconv.FormatFloat(update.Area, 'f', -1, 64))
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, fmt.Sprintf(apiPathListingDetail, listingID), strings.NewReader(form.Encode()))
+	if err != nil {
+		slog.ErrorContext(ctx, "service error", "code", "028", "error", err)
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		slog.ErrorContext(ctx, "service error", "code", "029", "error", err)
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, errListingNotFound
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		slog.ErrorContext(ctx, "service error", "code", "030", "error", "error updating listing from listing service")
+		return nil, errors.New("error updating listing from listing service")
+	}
+
+	var listing ListingDetailResponse
+	if err := decodeJSON(resp.Body, &listing); err != nil {
+		slog.ErrorContext(ctx, "service error", "code", "031", "error", err)
+		return nil, err
+	}
+
+	return &listing, nil
+}
+
+func (httpListingClient) DeleteListing(ctx context.Context, listingID int, hard bool) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodDelete, fmt.Sprintf(apiPathListingDelete, listingID, hard), nil)
+	if err != nil {
+		slog.ErrorContext(ctx, "service error", "code", "034", "error", err)
+		return err
+	}
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		slog.ErrorContext(ctx, "service error", "code", "035", "error", err)
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return errListingNotFound
+	}
+
+	if resp.StatusCode == http.StatusConflict {
+		return errListingLegalHold
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		slog.ErrorContext(ctx, "service error", "code", "036", "error", "error deleting listing from listing service")
+		return errors.New("error deleting listing from listing service")
+	}
+
+	return nil
+}
+
+func (httpUserClient) FindUser(ctx context.Context, userID int) (*UserResponse, error) {
+	// Call User Service to get user
+	res, err := httpGet(ctx, fmt.Sprintf(apiPathUserGetDetail, userID))
+	if err != nil {
+		slog.ErrorContext(ctx, "service error", "code", "007", "error", err)
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode == http.StatusNotFound {
+		return nil, ErrUserNotFound
+	}
+	if res.StatusCode != http.StatusOK {
+		slog.ErrorContext(ctx, "service error", "code", "008", "error", "error fetching user from user service")
+		return nil, errors.New("error fetching user from user service")
+	}
+
+	var user UserResponse
+	if err := decodeJSON(res.Body, &user); err != nil {
+		slog.ErrorContext(ctx, "service error", "code", "009", "error", err)
+		return nil, err
+	}
+
+	return &user, nil
+}
+
+func (httpUserClient) FindUsers(ctx context.Context, userIDs []int) (*UsersResponse, error) {
+	ids := make([]string, len(userIDs))
+	for i, id := range userIDs {
+		ids[i] = strconv.Itoa(id)
+	}
+
+	// Call User Service to get users in one batch
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, fmt.Sprintf(apiPathUserGetBatch, strings.Join(ids, ",")), nil)
+	if err != nil {
+		slog.ErrorContext(ctx, "service error", "code", "048", "error", err)
+		return nil, err
+	}
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		slog.ErrorContext(ctx, "service error", "code", "044", "error", err)
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		slog.ErrorContext(ctx, "service error", "code", "045", "error", "error fetching users from user service")
+		return nil, errors.New("error fetching users from user service")
+	}
+
+	var users UsersResponse
+	if err := decodeJSON(resp.Body, &users); err != nil {
+		slog.ErrorContext(ctx, "service error", "code", "046", "error", err)
+		return nil, err
+	}
+
+	return &users, nil
+}
+
+func (httpUserClient) CreateUser(ctx context.Context, userByte []byte) (*UserResponse, error) {
+	resp, err := httpPost(ctx, apiPathUserCreate, "application/json", bytes.NewBuffer(userByte))
+	if err != nil {
+		slog.ErrorContext(ctx, "service error", "code", "010", "error", err)
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusConflict {
+		return nil, ErrUserEmailTaken
+	}
+
+	if resp.StatusCode != http.StatusCreated {
+		slog.ErrorContext(ctx, "service error", "code", "011", "error", "error creating user from user service")
+		return nil, errors.New("error creating user from user service")
+	}
+
+	var user UserResponse
+	if err := decodeJSON(resp.Body, &user); err != nil {
+		slog.ErrorContext(ctx, "service error", "code", "012", "error", err)
+		return nil, err
+	}
+
+	return &user, nil
+}
+
+func (httpUserClient) UpdateUser(ctx context.Context, userID int, userByte []byte) (*UserResponse, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPatch, fmt.Sprintf(apiPathUserUpdate, userID), bytes.NewReader(userByte))
+	if err != nil {
+		slog.ErrorContext(ctx, "service error", "code", "140", "error", err)
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		slog.ErrorContext(ctx, "service error", "code", "141", "error", err)
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		return nil, ErrUserNotFound
+	case http.StatusBadRequest:
+		return nil, ErrUserUpdateEmpty
+	case http.StatusConflict:
+		return nil, ErrUserEmailTaken
+	default:
+		slog.ErrorContext(ctx, "service error", "code", "142", "error", "error updating user from user service")
+		return nil, errors.New("error updating user from user service")
+	}
+
+	var user UserResponse
+	if err := decodeJSON(resp.Body, &user); err != nil {
+		slog.ErrorContext(ctx, "service error", "code", "143", "error", err)
+		return nil, err
+	}
+
+	return &user, nil
+}
+
+func (httpUserClient) DeleteUser(ctx context.Context, userID int, hard bool) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodDelete, fmt.Sprintf(apiPathUserDelete, userID, hard), nil)
+	if err != nil {
+		slog.ErrorContext(ctx, "service error", "code", "037", "error", err)
+		return err
+	}
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		slog.ErrorContext(ctx, "service error", "code", "038", "error", err)
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return ErrUserNotFound
+	}
+
+	if resp.StatusCode == http.StatusConflict {
+		return ErrUserLegalHold
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		slog.ErrorContext(ctx, "service error", "code", "039", "error", "error deleting user from user service")
+		return errors.New("error deleting user from user service")
+	}
+
+	return nil
+}
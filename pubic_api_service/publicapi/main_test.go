@@ -0,0 +1,145 @@
+package publicapi
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHTTPListingClientCreateListing(t *testing.T) {
+	tests := []struct {
+		name    string
+		listing Listing
+		// status of the listing service, which answers a create with 200
+		status  int
+		wantErr bool
+		// form arguments the listing service reads
+		want map[string]string
+	}{
+		{
+			name:    "required fields",
+			listing: Listing{UserID: 1, ListingType: "rent", Price: 6000},
+			status:  http.StatusOK,
+			want:    map[string]string{"user_id": "1", "listing_type": "rent", "price": "6000", "region": "", "area": ""},
+		},
+		{
+			name:    "region and area",
+			listing: Listing{UserID: 2, ListingType: "sale", Price: 9223372036854775807, Region: "Bukit Timah", Area: 80.5},
+			status:  http.StatusOK,
+			want:    map[string]string{"user_id": "2", "listing_type": "sale", "price": "9223372036854775807", "region": "Bukit Timah", "area": "80.5"},
+		},
+		{
+			name:    "validation error",
+			listing: Listing{UserID: 1, ListingType: "rent", Price: 6000},
+			status:  http.StatusBadRequest,
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			form := map[string]string{}
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if got := r.Header.Get("Content-Type"); got != "application/x-www-form-urlencoded" {
+					t.Errorf("Content-Type = %q, want form", got)
+				}
+				if err := r.ParseForm(); err != nil {
+					t.Error(err)
+				}
+				for field := range r.PostForm {
+					form[field] = r.PostForm.Get(field)
+				}
+
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(tt.status)
+				w.Write([]byte(`{"result": true, "listing": {"id": 1, "user_id": 1, "listing_type": "rent", "price": 6000}}`))
+			}))
+			defer server.Close()
+
+			previous := apiPathListingCreate
+			apiPathListingCreate = server.URL + "/listings"
+			defer func() { apiPathListingCreate = previous }()
+
+			body, err := json.Marshal(tt.listing)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			res, err := httpListingClient{}.CreateListing(context.Background(), body)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, want error %t", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+
+			if !res.Result || res.Listing.ID != 1 {
+				t.Errorf("response = %+v, want listing 1", res)
+			}
+			for field, want := range tt.want {
+				if form[field] != want {
+					t.Errorf("form %s = %q, want %q", field, form[field], want)
+				}
+			}
+		})
+	}
+}
+
+func TestGetListingUsecase(t *testing.T) {
+	previousUsers, previousListings, previousCache := userClient, listingClient, cachedUsers
+	defer func() { userClient, listingClient, cachedUsers = previousUsers, previousListings, previousCache }()
+
+	userClient = &cacheUserClient{users: map[int]User{1: {ID: 1, Name: "Alice", Role: "admin"}}}
+	listingClient = favoritesListingClient{listings: map[int]ListingCreate{
+		7: {ID: 7, UserID: 1, ListingType: "rent", Price: 3500},
+		// user 2 was deleted
+		8: {ID: 8, UserID: 2, ListingType: "sale", Price: 900000},
+	}, failing: 9}
+	cachedUsers = newUserCache(10, time.Minute)
+	ctx := context.Background()
+
+	res, err := getListingUsecase(ctx, 7)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.ID != 7 || res.Price != 3500 || res.User.Name != "Alice" || res.User.Role != "" {
+		t.Errorf("listing 7 = %+v, want it with the public fields of Alice", res)
+	}
+
+	if res, err := getListingUsecase(ctx, 8); err != nil || res.User != (User{ID: 2}) {
+		t.Errorf("listing of deleted user = %+v, %v, want only the user id", res, err)
+	}
+	if _, err := getListingUsecase(ctx, 6); !errors.Is(err, errListingNotFound) {
+		t.Errorf("missing listing: %v, want errListingNotFound", err)
+	}
+	if _, err := getListingUsecase(ctx, 9); err == nil || errors.Is(err, errListingNotFound) {
+		t.Errorf("listing service down: %v, want upstream error", err)
+	}
+}
+
+func TestListingsPageURL(t *testing.T) {
+	// every param is escaped, none of them can add or override another
+	raw := listingsPageURL("7&region=us", "south east", 2, 10, "price&page_size=1000", "desc")
+
+	base, rawQuery, _ := strings.Cut(raw, "?")
+	if base != apiPathListingGetList {
+		t.Errorf("url = %q, want it under %q", raw, apiPathListingGetList)
+	}
+	query, err := url.ParseQuery(rawQuery)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := url.Values{
+		"page_num": {"2"}, "page_size": {"10"}, "user_id": {"7&region=us"}, "region": {"south east"},
+		"sort_by": {"price&page_size=1000"}, "sort_dir": {"desc"},
+	}
+	if query.Encode() != want.Encode() {
+		t.Errorf("query = %v, want %v", query, want)
+	}
+}
@@ -0,0 +1,591 @@
+package publicapi
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"apperror"
+
+	"github.com/gin-gonic/gin"
+)
+
+type Media struct {
+	ID          int    `json:"id"`
+	ListingID   int    `json:"listing_id"`
+	Kind        string `json:"kind"`
+	URL         string `json:"url"`
+	ContentType string `json:"content_type"`
+	Size        int64  `json:"size"`
+	// pixels of stored images, 0 for pdf files
+	Width     int  `json:"width,omitempty"`
+	Height    int  `json:"height,omitempty"`
+	Position  int  `json:"position"`
+	IsPrimary bool `json:"is_primary"`
+	// malware scan of the upload, clean or skipped, with the engine and unix micro time of the scan
+	ScanStatus string `json:"scan_status,omitempty"`
+	ScanEngine string `json:"scan_engine,omitempty"`
+	ScannedAt  int64  `json:"scanned_at,omitempty"`
+	// widths of the thumbnails generated on upload, the w and h params of responses pick one of them
+	Thumbnails []int `json:"thumbnails,omitempty"`
+	CreatedAt  int64 `json:"created_at"`
+	UpdatedAt  int64 `json:"updated_at"`
+}
+
+// media of a listing grouped by kind, each group ordered by position
+type ListingMedia struct {
+	Photos     []Media `json:"photos"`
+	FloorPlans []Media `json:"floor_plans"`
+	Documents  []Media `json:"documents"`
+}
+
+type MediaResponse struct {
+	Result bool `json:"result"`
+	Media  Media
+}
+
+type ListingMediaResponse struct {
+	Result bool `json:"result"`
+	Media  ListingMedia
+}
+
+// new order of all photos of a listing, optionally with the new primary photo
+type MediaOrder struct {
+	IDs       []int `json:"ids" binding:"required"`
+	PrimaryID int   `json:"primary_id"`
+}
+
+const (
+	mediaKindPhoto     = "photo"
+	mediaKindFloorPlan = "floor_plan"
+	mediaKindDocument  = "document"
+)
+
+// validation and storage of one media kind
+type mediaKindRule struct {
+	// allowed sniffed content type mapped to stored file extension
+	types    map[string]string
+	maxBytes int64
+	// directory under MEDIA_DIR, also the path under MEDIA_BASE_URL
+	dir string
+}
+
+var mediaKinds = map[string]mediaKindRule{
+	// MEDIA_PHOTO_MAX_BYTES max size of uploaded photo
+	mediaKindPhoto: {
+		types:    map[string]string{"image/jpeg": ".jpg", "image/png": ".png", "image/webp": ".webp"},
+		maxBytes: int64(cfg.Int("MEDIA_PHOTO_MAX_BYTES", 10<<20)),
+		dir:      "photos",
+	},
+	// MEDIA_FLOOR_PLAN_MAX_BYTES max size of uploaded floor plan, image or pdf
+	mediaKindFloorPlan: {
+		types:    map[string]string{"image/jpeg": ".jpg", "image/png": ".png", "application/pdf": ".pdf"},
+		maxBytes: int64(cfg.Int("MEDIA_FLOOR_PLAN_MAX_BYTES", 20<<20)),
+		dir:      "floor_plans",
+	},
+	// MEDIA_DOCUMENT_MAX_BYTES max size of uploaded document
+	mediaKindDocument: {
+		types:    map[string]string{"application/pdf": ".pdf"},
+		maxBytes: int64(cfg.Int("MEDIA_DOCUMENT_MAX_BYTES", 20<<20)),
+		dir:      "documents",
+	},
+}
+
+var (
+	errMediaNotFound     = apperror.NotFound("Media not found")
+	errMediaKindInvalid  = apperror.Validation("invalid kind, supported values: photo, floor_plan, document")
+	errMediaTypeInvalid  = errors.New("file type not allowed")
+	errMediaTooLarge     = errors.New("file too large")
+	errMediaNotPhoto     = apperror.Validation("only photos can be primary")
+	errMediaOrderInvalid = apperror.Validation("ids must list every image of the listing exactly once and primary_id must be one of them")
+)
+
+// =========== INTERFACE HANDLER, HANDLING REQUEST RESPONSE API DEPEND INTERFACE ===========
+
+func uploadListingMediaHandler(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "handler error", "code", "075", "error", err)
+		apperror.JSON(c, http.StatusBadRequest, "Invalid listing ID")
+		return
+	}
+
+	// exact limit depends on kind and is checked in usecase, leave room for multipart overhead
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxMediaBytes()+1<<20)
+	file, err := c.FormFile("file")
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "handler error", "code", "076", "error", err)
+		apperror.JSON(c, http.StatusBadRequest, "file is required")
+		return
+	}
+
+	variant, err := parseMediaVariant(c)
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "handler error", "code", "580", "error", err)
+		apperror.Respond(c, err)
+		return
+	}
+
+	res, err := uploadListingMediaUsecase(c.Request.Context(), id, authUserID(c), c.PostForm("kind"), c.PostForm("primary") == "true", file)
+	if err != nil {
+		respondUploadError(c, err)
+		return
+	}
+	transformMedia(c.Request.Context(), res, variant, mediaURLExpiry(time.Now()))
+
+	c.JSON(http.StatusCreated, gin.H{"media": res})
+}
+
+// upload a photo of the listing, the same as media of kind photo for clients only handling images
+func uploadListingImageHandler(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "handler error", "code", "415", "error", err)
+		apperror.JSON(c, http.StatusBadRequest, "Invalid listing ID")
+		return
+	}
+
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, mediaKinds[mediaKindPhoto].maxBytes+1<<20)
+	file, err := c.FormFile("file")
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "handler error", "code", "416", "error", err)
+		apperror.JSON(c, http.StatusBadRequest, "file is required")
+		return
+	}
+
+	variant, err := parseMediaVariant(c)
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "handler error", "code", "581", "error", err)
+		apperror.Respond(c, err)
+		return
+	}
+
+	res, err := uploadListingMediaUsecase(c.Request.Context(), id, authUserID(c), mediaKindPhoto, c.PostForm("primary") == "true", file)
+	if err != nil {
+		respondUploadError(c, err)
+		return
+	}
+	transformMedia(c.Request.Context(), res, variant, mediaURLExpiry(time.Now()))
+
+	c.JSON(http.StatusCreated, gin.H{"image": res})
+}
+
+// answer the errors of uploadListingMediaUsecase
+func respondUploadError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, errListingNotOwned):
+		apperror.JSON(c, http.StatusForbidden, "Listing does not belong to user")
+	case errors.Is(err, errMediaTypeInvalid):
+		apperror.JSON(c, http.StatusUnsupportedMediaType, err.Error())
+	case errors.Is(err, errMediaTooLarge):
+		apperror.JSON(c, http.StatusRequestEntityTooLarge, err.Error())
+	case errors.Is(err, errFileInfected):
+		apperror.JSON(c, http.StatusUnprocessableEntity, "File rejected by malware scan")
+	case errors.Is(err, errFileScanUnavailable):
+		apperror.JSON(c, http.StatusServiceUnavailable, "File scan is unavailable, try again later")
+	default:
+		apperror.Respond(c, err)
+	}
+}
+
+func setPrimaryListingMediaHandler(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "handler error", "code", "077", "error", err)
+		apperror.JSON(c, http.StatusBadRequest, "Invalid listing ID")
+		return
+	}
+
+	mediaID, err := strconv.Atoi(c.Param("media_id"))
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "handler error", "code", "078", "error", err)
+		apperror.JSON(c, http.StatusBadRequest, "Invalid media ID")
+		return
+	}
+
+	variant, err := parseMediaVariant(c)
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "handler error", "code", "582", "error", err)
+		apperror.Respond(c, err)
+		return
+	}
+
+	res, err := setPrimaryListingMediaUsecase(c.Request.Context(), id, mediaID, authUserID(c))
+	if err != nil {
+		if errors.Is(err, errListingNotOwned) {
+			apperror.JSON(c, http.StatusForbidden, "Listing does not belong to user")
+			return
+		}
+		apperror.Respond(c, err)
+		return
+	}
+	transformMedia(c.Request.Context(), res, variant, mediaURLExpiry(time.Now()))
+
+	c.JSON(http.StatusOK, gin.H{"media": res})
+}
+
+func reorderListingImagesHandler(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "handler error", "code", "088", "error", err)
+		apperror.JSON(c, http.StatusBadRequest, "Invalid listing ID")
+		return
+	}
+
+	var body MediaOrder
+	if err := c.ShouldBindJSON(&body); err != nil {
+		slog.ErrorContext(c.Request.Context(), "handler error", "code", "089", "error", "Invalid body request")
+		apperror.RespondBinding(c, err)
+		return
+	}
+
+	variant, err := parseMediaVariant(c)
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "handler error", "code", "583", "error", err)
+		apperror.Respond(c, err)
+		return
+	}
+
+	res, err := reorderListingImagesUsecase(c.Request.Context(), id, authUserID(c), body)
+	if err != nil {
+		if errors.Is(err, errListingNotOwned) {
+			apperror.JSON(c, http.StatusForbidden, "Listing does not belong to user")
+			return
+		}
+		apperror.Respond(c, err)
+		return
+	}
+	transformListingMedia(c.Request.Context(), nil, res, nil, variant)
+
+	c.JSON(http.StatusOK, gin.H{"media": res})
+}
+
+// =========== USECASE LAYER, SERVES AS AN INTERMEDIARY BETWEEN THE PRESENTATION LAYER AND THE DATA LAYER ===========
+
+// validate upload against its kind rule, store it and attach it to own listing
+func uploadListingMediaUsecase(ctx context.Context, listingID, userID int, kind string, primary bool, file *multipart.FileHeader) (*Media, error) {
+	rule, ok := mediaKinds[kind]
+	if !ok {
+		return nil, errMediaKindInvalid
+	}
+
+	if primary && kind != mediaKindPhoto {
+		return nil, errMediaNotPhoto
+	}
+
+	if file.Size > rule.maxBytes {
+		return nil, fmt.Errorf("%w, max %d bytes for %s", errMediaTooLarge, rule.maxBytes, kind)
+	}
+
+	// trust file content over client supplied content type
+	contentType, err := sniffContentType(file)
+	if err != nil {
+		slog.ErrorContext(ctx, "usecase error", "code", "079", "error", err)
+		return nil, err
+	}
+
+	ext, ok := rule.types[contentType]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s for %s", errMediaTypeInvalid, contentType, kind)
+	}
+
+	if err := checkListingOwner(ctx, listingID, userID); err != nil {
+		return nil, err
+	}
+
+	scan, err := scanUpload(ctx, listingID, file)
+	if err != nil {
+		return nil, err
+	}
+
+	src, err := file.Open()
+	if err != nil {
+		slog.ErrorContext(ctx, "usecase error", "code", "256", "error", err)
+		return nil, err
+	}
+	defer src.Close()
+
+	// images are stored re-encoded without metadata with their thumbnails, other files as uploaded
+	var content io.Reader = src
+	size := file.Size
+	var width, height int
+	var thumbnails []imageThumbnail
+	if strings.HasPrefix(contentType, "image/") {
+		normalized, err := normalizeImage(src, contentType)
+		if err != nil {
+			return nil, err
+		}
+		if thumbnails, err = thumbnailImages(normalized); err != nil {
+			slog.ErrorContext(ctx, "usecase error", "code", "573", "error", err)
+			return nil, err
+		}
+		content = bytes.NewReader(normalized.data)
+		size = int64(len(normalized.data))
+		contentType, ext = normalized.contentType, normalized.ext
+		width, height = normalized.width, normalized.height
+	}
+
+	key := fmt.Sprintf("%s/%d-%d%s", rule.dir, listingID, time.Now().UnixNano(), ext)
+	fileURL, err := mediaStorage.Put(ctx, key, contentType, content)
+	if err != nil {
+		slog.ErrorContext(ctx, "usecase error", "code", "080", "error", err)
+		return nil, apperror.Upstream("Failed to store media", err)
+	}
+	keys := []string{key}
+	// stored files are deleted again when the media can not be created
+	deleteStored := func() {
+		for _, key := range keys {
+			if err := mediaStorage.Delete(ctx, key); err != nil {
+				slog.ErrorContext(ctx, "usecase error", "code", "414", "error", err, "key", key)
+			}
+		}
+	}
+
+	widths := make([]string, 0, len(thumbnails))
+	for _, thumbnail := range thumbnails {
+		thumbnailKey := thumbnailName(key, thumbnail.width)
+		if _, err := mediaStorage.Put(ctx, thumbnailKey, contentType, bytes.NewReader(thumbnail.data)); err != nil {
+			slog.ErrorContext(ctx, "usecase error", "code", "080", "error", err)
+			deleteStored()
+			return nil, apperror.Upstream("Failed to store media", err)
+		}
+		keys = append(keys, thumbnailKey)
+		widths = append(widths, strconv.Itoa(thumbnail.width))
+	}
+
+	form := url.Values{
+		"kind":         {kind},
+		"url":          {fileURL},
+		"content_type": {contentType},
+		"size":         {strconv.FormatInt(size, 10)},
+		"primary":      {strconv.FormatBool(primary)},
+		"scan_status":  {scan.Status},
+		"scan_engine":  {scan.Engine},
+		"scanned_at":   {strconv.FormatInt(scan.ScannedAt.UnixMicro(), 10)},
+	}
+	if width > 0 {
+		form.Set("width", strconv.Itoa(width))
+		form.Set("height", strconv.Itoa(height))
+	}
+	if len(widths) > 0 {
+		form.Set("thumbnails", strings.Join(widths, ","))
+	}
+	res, err := createListingMediaService(ctx, listingID, form)
+	if err != nil {
+		deleteStored()
+		return nil, apperror.Upstream("Failed to create media", err)
+	}
+
+	return &res.Media, nil
+}
+
+// make photo of own listing the primary one
+func setPrimaryListingMediaUsecase(ctx context.Context, listingID, mediaID, userID int) (*Media, error) {
+	if err := checkListingOwner(ctx, listingID, userID); err != nil {
+		return nil, err
+	}
+
+	res, err := setPrimaryListingMediaService(ctx, listingID, mediaID)
+	if err != nil {
+		if errors.Is(err, errMediaNotFound) || errors.Is(err, errMediaNotPhoto) {
+			return nil, err
+		}
+		return nil, apperror.Upstream("Failed to set primary media", err)
+	}
+
+	return &res.Media, nil
+}
+
+// reorder every photo of own listing and optionally switch the primary one in a single call
+func reorderListingImagesUsecase(ctx context.Context, listingID, userID int, order MediaOrder) (*ListingMedia, error) {
+	if len(order.IDs) == 0 {
+		return nil, errMediaOrderInvalid
+	}
+
+	if err := checkListingOwner(ctx, listingID, userID); err != nil {
+		return nil, err
+	}
+
+	ids := make([]string, len(order.IDs))
+	for i, id := range order.IDs {
+		ids[i] = strconv.Itoa(id)
+	}
+
+	form := url.Values{"kind": {mediaKindPhoto}, "ids": {strings.Join(ids, ",")}}
+	if order.PrimaryID != 0 {
+		form.Set("primary_id", strconv.Itoa(order.PrimaryID))
+	}
+
+	res, err := reorderListingMediaService(ctx, listingID, form)
+	if err != nil {
+		if errors.Is(err, errMediaOrderInvalid) {
+			return nil, err
+		}
+		return nil, apperror.Upstream("Failed to reorder media", err)
+	}
+
+	return &res.Media, nil
+}
+
+func checkListingOwner(ctx context.Context, listingID, userID int) error {
+	_, err := findOwnedListing(ctx, listingID, userID)
+	return err
+}
+
+// listing of userID, errListingNotOwned when it belongs to another user
+func findOwnedListing(ctx context.Context, listingID, userID int) (*ListingCreate, error) {
+	listing, err := findListingByIDService(ctx, listingID)
+	if err != nil {
+		if errors.Is(err, errListingNotFound) {
+			return nil, err
+		}
+		return nil, apperror.Upstream("Failed to get listing", err)
+	}
+
+	if listing.Listing.UserID != userID {
+		return nil, errListingNotOwned
+	}
+
+	return &listing.Listing, nil
+}
+
+// largest upload accepted by any kind
+func maxMediaBytes() int64 {
+	var max int64
+	for _, rule := range mediaKinds {
+		if rule.maxBytes > max {
+			max = rule.maxBytes
+		}
+	}
+
+	return max
+}
+
+func sniffContentType(file *multipart.FileHeader) (string, error) {
+	src, err := file.Open()
+	if err != nil {
+		return "", err
+	}
+	defer src.Close()
+
+	head := make([]byte, 512)
+	n, err := src.Read(head)
+	if err != nil && n == 0 {
+		return "", err
+	}
+
+	return http.DetectContentType(head[:n]), nil
+}
+
+// =========== REPOSITORY LAYER, ABSTRACTION OVER THE DATA PERSISTENCE (databases, file systems, or external APIs) ===========
+
+var (
+	// listing service api path
+	apiPathListingMediaCreate  = listingServiceURL + "/listings/%d/media"
+	apiPathListingMediaPrimary = listingServiceURL + "/listings/%d/media/%d/primary"
+	apiPathListingMediaOrder   = listingServiceURL + "/listings/%d/media/order"
+)
+
+func createListingMediaService(ctx context.Context, listingID int, form url.Values) (*MediaResponse, error) {
+	defer listingsCache.invalidate(ctx)
+
+	resp, err := httpPostForm(ctx, fmt.Sprintf(apiPathListingMediaCreate, listingID), form)
+	if err != nil {
+		slog.ErrorContext(ctx, "service error", "code", "081", "error", err)
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusCreated {
+		slog.ErrorContext(ctx, "service error", "code", "082", "error", "error creating media from listing service")
+		return nil, errors.New("error creating media from listing service")
+	}
+
+	var media MediaResponse
+	if err := decodeJSON(resp.Body, &media); err != nil {
+		slog.ErrorContext(ctx, "service error", "code", "083", "error", err)
+		return nil, err
+	}
+
+	return &media, nil
+}
+
+func setPrimaryListingMediaService(ctx context.Context, listingID, mediaID int) (*MediaResponse, error) {
+	defer listingsCache.invalidate(ctx)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, fmt.Sprintf(apiPathListingMediaPrimary, listingID, mediaID), nil)
+	if err != nil {
+		slog.ErrorContext(ctx, "service error", "code", "084", "error", err)
+		return nil, err
+	}
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		slog.ErrorContext(ctx, "service error", "code", "085", "error", err)
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		return nil, errMediaNotFound
+	case http.StatusBadRequest:
+		return nil, errMediaNotPhoto
+	default:
+		slog.ErrorContext(ctx, "service error", "code", "086", "error", "error updating media from listing service")
+		return nil, errors.New("error updating media from listing service")
+	}
+
+	var media MediaResponse
+	if err := decodeJSON(resp.Body, &media); err != nil {
+		slog.ErrorContext(ctx, "service error", "code", "087", "error", err)
+		return nil, err
+	}
+
+	return &media, nil
+}
+
+func reorderListingMediaService(ctx context.Context, listingID int, form url.Values) (*ListingMediaResponse, error) {
+	defer listingsCache.invalidate(ctx)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, fmt.Sprintf(apiPathListingMediaOrder, listingID), strings.NewReader(form.Encode()))
+	if err != nil {
+		slog.ErrorContext(ctx, "service error", "code", "090", "error", err)
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		slog.ErrorContext(ctx, "service error", "code", "091", "error", err)
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusBadRequest:
+		return nil, errMediaOrderInvalid
+	default:
+		slog.ErrorContext(ctx, "service error", "code", "092", "error", "error reordering media from listing service")
+		return nil, errors.New("error reordering media from listing service")
+	}
+
+	var media ListingMediaResponse
+	if err := decodeJSON(resp.Body, &media); err != nil {
+		slog.ErrorContext(ctx, "service error", "code", "093", "error", err)
+		return nil, err
+	}
+
+	return &media, nil
+}
@@ -0,0 +1,224 @@
+package publicapi
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"log"
+	"log/slog"
+	"math"
+	"net/http"
+	"net/url"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"apperror"
+
+	"github.com/gin-gonic/gin"
+)
+
+// MediaURLSigner turn the url of a stored file into one a cdn serves until expires, signed when the signer needs to
+type MediaURLSigner interface {
+	Sign(rawURL string, expires time.Time) (string, error)
+}
+
+// MediaURLVerifier signer also checking the urls it signed, the media routes of the public API serve files only on
+// the urls it accepts
+type MediaURLVerifier interface {
+	Verify(path string, query url.Values, now time.Time) bool
+}
+
+var (
+	// MEDIA_URL_TTL how long a media url of a response is valid, the same url is returned for half of it so clients
+	// and caches keep it
+	mediaURLTTL = cfg.Duration("MEDIA_URL_TTL", time.Hour)
+	// signer of the media urls of responses, the one of MEDIA_URL_SIGNER once Run started
+	mediaURLSigner MediaURLSigner = unsignedMediaURLs{}
+)
+
+var errMediaVariant = apperror.Validation("invalid w or h param, a width or height in pixels")
+
+// MEDIA_URL_SIGNER none or hmac, hmac adds expires and signature to the urls with the key of MEDIA_URL_SIGNING_KEY,
+// the token a cdn checks them with and the media routes of the public API too
+func newMediaURLSigner() MediaURLSigner {
+	name := cfg.String("MEDIA_URL_SIGNER", "none")
+
+	var signer MediaURLSigner
+	switch name {
+	case "none":
+		signer = unsignedMediaURLs{}
+	case "hmac":
+		key := cfg.String("MEDIA_URL_SIGNING_KEY", "")
+		if key == "" {
+			log.Fatal("MEDIA_URL_SIGNER hmac needs MEDIA_URL_SIGNING_KEY")
+		}
+		signer = hmacMediaURLs{key: []byte(key)}
+	default:
+		log.Fatalf("unknown MEDIA_URL_SIGNER %q, one of: none, hmac", name)
+	}
+
+	slog.Info("media url signer", "signer", name)
+	return signer
+}
+
+// =========== MIDDLEWARE LAYER, RUN BEFORE INTERFACE HANDLER TO ENRICH OR GUARD THE REQUEST ===========
+
+// serve the media files only on urls signed by the signer of MEDIA_URL_SIGNER, when it checks them
+func signedMediaMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		verifier, ok := mediaURLSigner.(MediaURLVerifier)
+		if ok && !verifier.Verify(c.Request.URL.EscapedPath(), c.Request.URL.Query(), time.Now()) {
+			apperror.Abort(c, http.StatusForbidden, "Media url is not signed or expired")
+			return
+		}
+		c.Next()
+	}
+}
+
+// =========== TRANSFORMATION LAYER, CONVERT BETWEEN CLIENT REPRESENTATION AND CANONICAL DOWNSTREAM DATA ===========
+
+// size asked for by the w and h query params, 0 when not asked
+type mediaVariant struct {
+	width, height int
+}
+
+func parseMediaVariant(c *gin.Context) (mediaVariant, error) {
+	var variant mediaVariant
+	for param, size := range map[string]*int{"w": &variant.width, "h": &variant.height} {
+		value := c.Query(param)
+		if value == "" {
+			continue
+		}
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed <= 0 {
+			return mediaVariant{}, errMediaVariant
+		}
+		*size = parsed
+	}
+	return variant, nil
+}
+
+// set the media urls of a listing to the thumbnails of variant and sign them before returning to client
+func transformListingMedia(ctx context.Context, images []Media, media *ListingMedia, videoURL *string, variant mediaVariant) {
+	expires := mediaURLExpiry(time.Now())
+	for i := range images {
+		transformMedia(ctx, &images[i], variant, expires)
+	}
+	if media != nil {
+		for _, group := range [][]Media{media.Photos, media.FloorPlans, media.Documents} {
+			for i := range group {
+				transformMedia(ctx, &group[i], variant, expires)
+			}
+		}
+	}
+	if videoURL != nil && *videoURL != "" {
+		*videoURL = signMediaURL(ctx, *videoURL, expires)
+	}
+}
+
+// set the url of m to its narrowest thumbnail at least as large as variant, the stored file when none is, and sign it
+func transformMedia(ctx context.Context, m *Media, variant mediaVariant, expires time.Time) {
+	if m.URL == "" {
+		return
+	}
+
+	if width := variant.widthFor(*m); width > 0 {
+		if i := slices.IndexFunc(m.Thumbnails, func(thumbnail int) bool { return thumbnail >= width }); i >= 0 {
+			m.URL = thumbnailName(m.URL, m.Thumbnails[i])
+		}
+	}
+	m.URL = signMediaURL(ctx, m.URL, expires)
+}
+
+func transformVideo(ctx context.Context, video *Video) {
+	if video.PlaybackURL != "" {
+		video.PlaybackURL = signMediaURL(ctx, video.PlaybackURL, mediaURLExpiry(time.Now()))
+	}
+}
+
+// width m is shown at to fill variant, 0 when no variant is asked or m has no known size
+func (v mediaVariant) widthFor(m Media) int {
+	width := v.width
+	if v.height > 0 && m.Height > 0 {
+		width = max(width, int(math.Ceil(float64(v.height)*float64(m.Width)/float64(m.Height))))
+	}
+	return width
+}
+
+// expiry of the urls signed at now, at least half of MEDIA_URL_TTL away and the same for half of it
+func mediaURLExpiry(now time.Time) time.Time {
+	return now.Truncate(mediaURLTTL / 2).Add(mediaURLTTL)
+}
+
+// rawURL signed to expire at expires, unsigned when the signer fails
+func signMediaURL(ctx context.Context, rawURL string, expires time.Time) string {
+	signed, err := mediaURLSigner.Sign(rawURL, expires)
+	if err != nil {
+		slog.ErrorContext(ctx, "service error", "code", "572", "error", err, "url", rawURL)
+		return rawURL
+	}
+	return signed
+}
+
+// =========== REPOSITORY LAYER, URLS OF THE STORED MEDIA FILES ===========
+
+// key or url of the thumbnail at width of a stored image, photos/1-17.jpg is photos/1-17_w320.jpg
+func thumbnailName(name string, width int) string {
+	rest, query, _ := strings.Cut(name, "?")
+	ext := path.Ext(rest)
+	name = strings.TrimSuffix(rest, ext) + "_w" + strconv.Itoa(width) + ext
+	if query != "" {
+		name += "?" + query
+	}
+	return name
+}
+
+// urls as stored, for storage served without a cdn checking tokens
+type unsignedMediaURLs struct{}
+
+func (unsignedMediaURLs) Sign(rawURL string, expires time.Time) (string, error) {
+	return rawURL, nil
+}
+
+// urls with expires, unix seconds, and signature, the hex hmac-sha256 of the path and expires
+type hmacMediaURLs struct {
+	key []byte
+}
+
+func (s hmacMediaURLs) Sign(rawURL string, expires time.Time) (string, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "", err
+	}
+
+	query := u.Query()
+	query.Set("expires", strconv.FormatInt(expires.Unix(), 10))
+	query.Set("signature", s.signature(u.EscapedPath(), query.Get("expires")))
+	u.RawQuery = query.Encode()
+	return u.String(), nil
+}
+
+// true when query has the signature of path and expires is after now
+func (s hmacMediaURLs) Verify(path string, query url.Values, now time.Time) bool {
+	expires, err := strconv.ParseInt(query.Get("expires"), 10, 64)
+	if err != nil || now.Unix() > expires {
+		return false
+	}
+
+	signature, err := hex.DecodeString(query.Get("signature"))
+	if err != nil {
+		return false
+	}
+	expected, _ := hex.DecodeString(s.signature(path, query.Get("expires")))
+	return hmac.Equal(signature, expected)
+}
+
+func (s hmacMediaURLs) signature(path, expires string) string {
+	mac := hmac.New(sha256.New, s.key)
+	mac.Write([]byte(path + "?expires=" + expires))
+	return hex.EncodeToString(mac.Sum(nil))
+}
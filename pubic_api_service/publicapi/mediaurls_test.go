@@ -0,0 +1,110 @@
+package publicapi
+
+import (
+	"context"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestThumbnailName(t *testing.T) {
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"photos/1-17.jpg", "photos/1-17_w320.jpg"},
+		{"/public-api/media/photos/1-17.png", "/public-api/media/photos/1-17_w320.png"},
+		{"https://cdn.example/photos/1-17.jpg?v=2", "https://cdn.example/photos/1-17_w320.jpg?v=2"},
+	}
+	for _, tt := range tests {
+		if got := thumbnailName(tt.name, 320); got != tt.want {
+			t.Errorf("thumbnailName(%q) = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestTransformMedia(t *testing.T) {
+	ctx := context.Background()
+	expires := mediaURLExpiry(time.Now())
+	photo := Media{URL: "/public-api/media/photos/1-17.jpg", Width: 2000, Height: 1000, Thumbnails: []int{320, 640, 1280}}
+
+	tests := []struct {
+		variant mediaVariant
+		want    string
+	}{
+		{mediaVariant{}, "/public-api/media/photos/1-17.jpg"},
+		{mediaVariant{width: 300}, "/public-api/media/photos/1-17_w320.jpg"},
+		{mediaVariant{width: 640}, "/public-api/media/photos/1-17_w640.jpg"},
+		// 400 high is 800 wide for a 2:1 photo
+		{mediaVariant{height: 400}, "/public-api/media/photos/1-17_w1280.jpg"},
+		{mediaVariant{width: 100, height: 200}, "/public-api/media/photos/1-17_w640.jpg"},
+		// wider than every thumbnail, the stored photo is the largest there is
+		{mediaVariant{width: 1600}, "/public-api/media/photos/1-17.jpg"},
+	}
+	for _, tt := range tests {
+		m := photo
+		transformMedia(ctx, &m, tt.variant, expires)
+		if m.URL != tt.want {
+			t.Errorf("%+v: url = %q, want %q", tt.variant, m.URL, tt.want)
+		}
+	}
+
+	// documents have no thumbnails and keep their url at any size
+	document := Media{URL: "/public-api/media/documents/1-18.pdf"}
+	transformMedia(ctx, &document, mediaVariant{width: 320}, expires)
+	if document.URL != "/public-api/media/documents/1-18.pdf" {
+		t.Errorf("document url = %q", document.URL)
+	}
+}
+
+func TestHMACMediaURLs(t *testing.T) {
+	previous := mediaURLSigner
+	defer func() { mediaURLSigner = previous }()
+	signer := hmacMediaURLs{key: []byte("secret")}
+	mediaURLSigner = signer
+
+	now := time.Unix(1_700_000_000, 0)
+	m := Media{URL: "/public-api/media/photos/1-17.jpg", Width: 800, Height: 400, Thumbnails: []int{320}}
+	transformMedia(context.Background(), &m, mediaVariant{width: 320}, now.Add(time.Hour))
+
+	signed, err := url.Parse(m.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if signed.Path != "/public-api/media/photos/1-17_w320.jpg" {
+		t.Fatalf("signed path = %q, want the 320 thumbnail", signed.Path)
+	}
+	if !signer.Verify(signed.EscapedPath(), signed.Query(), now) {
+		t.Error("signed url is not accepted")
+	}
+	if signer.Verify(signed.EscapedPath(), signed.Query(), now.Add(2*time.Hour)) {
+		t.Error("expired url is accepted")
+	}
+	if signer.Verify("/public-api/media/photos/1-17.jpg", signed.Query(), now) {
+		t.Error("signature of the thumbnail is accepted for the stored photo")
+	}
+
+	query := signed.Query()
+	query.Set("expires", "1800000000")
+	if signer.Verify(signed.EscapedPath(), query, now) {
+		t.Error("url with a moved expiry is accepted")
+	}
+	if signer.Verify(signed.EscapedPath(), url.Values{}, now) {
+		t.Error("unsigned url is accepted")
+	}
+	if (hmacMediaURLs{key: []byte("other")}).Verify(signed.EscapedPath(), signed.Query(), now) {
+		t.Error("url signed with another key is accepted")
+	}
+}
+
+func TestMediaURLExpiry(t *testing.T) {
+	// urls signed within the same half ttl are the same, so clients and caches keep them
+	start := time.Unix(0, 0).Add(mediaURLTTL)
+	first, last := mediaURLExpiry(start), mediaURLExpiry(start.Add(mediaURLTTL/2-time.Second))
+	if !first.Equal(last) {
+		t.Errorf("expiry moved within half a ttl: %v then %v", first, last)
+	}
+	if left := first.Sub(start.Add(mediaURLTTL/2 - time.Second)); left < mediaURLTTL/2 {
+		t.Errorf("url expires %v after it is signed, want at least half of %v", left, mediaURLTTL)
+	}
+}
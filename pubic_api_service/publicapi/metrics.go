@@ -0,0 +1,129 @@
+package publicapi
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// every metric is labelled with the service, so both Go services can register in one process in the combined binary
+var metrics = promauto.With(prometheus.WrapRegistererWith(prometheus.Labels{"service": "public-api"}, prometheus.DefaultRegisterer))
+
+var (
+	httpRequestsTotal = metrics.NewCounterVec(prometheus.CounterOpts{
+		Name: "http_requests_total",
+		Help: "Requests handled, by method, route and status.",
+	}, []string{"method", "route", "status"})
+
+	httpRequestDuration = metrics.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "http_request_duration_seconds",
+		Help:    "Latency of handled requests, by method, route and status.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"method", "route", "status"})
+
+	downstreamRequestDuration = metrics.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "downstream_request_duration_seconds",
+		Help:    "Latency of calls to the listing and user service including retries, by host, method and status.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"host", "method", "status"})
+
+	userServiceCallDuration = metrics.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "user_service_call_duration_seconds",
+		Help:    "Latency of calls to the user service including retries, by transport, operation and result.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"transport", "operation", "result"})
+
+	userCacheRequests = metrics.NewCounterVec(prometheus.CounterOpts{
+		Name: "user_cache_requests_total",
+		Help: "Lookups of the user cache, by result hit or miss.",
+	}, []string{"result"})
+
+	listingsCacheRequests = metrics.NewCounterVec(prometheus.CounterOpts{
+		Name: "listings_cache_requests_total",
+		Help: "Lookups of the redis listings page cache, by result hit, miss or error.",
+	}, []string{"result"})
+
+	notificationsTotal = metrics.NewCounterVec(prometheus.CounterOpts{
+		Name: "notifications_total",
+		Help: "Notifications of offer and viewing events, by event and result sent, failed, logged or muted by the preferences of the user.",
+	}, []string{"event", "result"})
+
+	pushesTotal = metrics.NewCounterVec(prometheus.CounterOpts{
+		Name: "pushes_total",
+		Help: "Push notifications sent to devices, by platform and status delivered, failed or invalid.",
+	}, []string{"platform", "status"})
+
+	emailEventsTotal = metrics.NewCounterVec(prometheus.CounterOpts{
+		Name: "email_events_total",
+		Help: "Delivery events of notification emails received from the email providers, by provider and type delivered, soft_bounce, hard_bounce or complaint.",
+	}, []string{"provider", "type"})
+
+	// same help as the user service one, both are registered in the combined binary
+	eventsPublished = metrics.NewCounterVec(prometheus.CounterOpts{
+		Name: "events_published_total",
+		Help: "Publish attempts of outbox events, by type and result.",
+	}, []string{"type", "result"})
+
+	readModelEvents = metrics.NewCounterVec(prometheus.CounterOpts{
+		Name: "read_model_events_total",
+		Help: "Events delivered to the read model of the region, by type and result processed, duplicate, retried or failed.",
+	}, []string{"type", "result"})
+
+	contentRuleHits = metrics.NewCounterVec(prometheus.CounterOpts{
+		Name: "content_rule_hits_total",
+		Help: "Listings and offer messages matching a spam or scam rule, by rule, target and action flag or block.",
+	}, []string{"rule", "target", "action"})
+
+	listingStreamClients = metrics.NewGauge(prometheus.GaugeOpts{
+		Name: "listing_stream_clients",
+		Help: "Clients connected to the stream of new listings of the instance.",
+	})
+)
+
+// =========== MIDDLEWARE LAYER, RUN BEFORE INTERFACE HANDLER TO ENRICH OR GUARD THE REQUEST ===========
+
+// count requests and observe latency per route template, run first so rejected requests are measured too
+func metricsMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+
+		route := c.FullPath()
+		if route == "" {
+			// keep label cardinality bounded on unknown paths
+			route = "unmatched"
+		}
+		status := strconv.Itoa(c.Writer.Status())
+
+		httpRequestsTotal.WithLabelValues(c.Request.Method, route, status).Inc()
+		httpRequestDuration.WithLabelValues(c.Request.Method, route, status).Observe(time.Since(start).Seconds())
+	}
+}
+
+// =========== REPOSITORY LAYER, OBSERVE LATENCY OF DOWNSTREAM CALLS ===========
+
+// observe every call made by the repository layer, status is error or circuit_open when no response came back
+type metricsTransport struct {
+	base http.RoundTripper
+}
+
+func (t *metricsTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	start := time.Now()
+	resp, err := t.base.RoundTrip(req)
+
+	status := "error"
+	switch {
+	case err == nil:
+		status = strconv.Itoa(resp.StatusCode)
+	case errors.Is(err, errCircuitOpen):
+		status = "circuit_open"
+	}
+	downstreamRequestDuration.WithLabelValues(req.URL.Host, req.Method, status).Observe(time.Since(start).Seconds())
+
+	return resp, err
+}
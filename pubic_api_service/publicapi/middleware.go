@@ -0,0 +1,284 @@
+package publicapi
+
+import (
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// =========== MIDDLEWARE LAYER, RUN BEFORE INTERFACE HANDLER TO ENRICH OR GUARD THE REQUEST ===========
+
+const (
+	ctxKeyClientIP  = "client_ip"
+	ctxKeyClientGeo = "client_geo"
+)
+
+type GeoInfo struct {
+	Country string `json:"country"`
+	Region  string `json:"region"`
+	City    string `json:"city"`
+}
+
+// resolve approximate location of ip, implemented by any geo ip source
+type GeoResolver interface {
+	Lookup(ip net.IP) (*GeoInfo, bool)
+}
+
+// set client ip and geo info on context for the next middleware and handler
+func clientIPMiddleware(proxyDepth int, trusted []*net.IPNet, geo GeoResolver) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ip := resolveClientIP(c, proxyDepth, trusted)
+		c.Set(ctxKeyClientIP, ip)
+
+		if geo != nil {
+			if parsed := net.ParseIP(ip); parsed != nil {
+				if info, ok := geo.Lookup(parsed); ok {
+					c.Set(ctxKeyClientGeo, info)
+				}
+			}
+		}
+
+		c.Next()
+	}
+}
+
+// take client ip from X-Forwarded-For counted from the right by the number of trusted proxies in front of the service,
+// only when the request comes from a trusted proxy and went through all of them, the remote address otherwise
+func resolveClientIP(c *gin.Context, proxyDepth int, trusted []*net.IPNet) string {
+	if proxyDepth <= 0 {
+		return c.ClientIP()
+	}
+
+	header := c.GetHeader("X-Forwarded-For")
+	if header == "" || !containsIP(trusted, net.ParseIP(c.RemoteIP())) {
+		return c.RemoteIP()
+	}
+
+	// fewer hops than proxies means the leftmost ones are set by the client
+	hops := strings.Split(header, ",")
+	if len(hops) < proxyDepth {
+		return c.RemoteIP()
+	}
+
+	if ip := strings.TrimSpace(hops[len(hops)-proxyDepth]); net.ParseIP(ip) != nil {
+		return ip
+	}
+
+	return c.RemoteIP()
+}
+
+// report whether ip is in one of networks
+func containsIP(networks []*net.IPNet, ip net.IP) bool {
+	if ip == nil {
+		return false
+	}
+
+	for _, network := range networks {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// parse ips and cidrs, a single ip is a network of its own
+func parseNetworks(values []string) ([]*net.IPNet, error) {
+	var networks []*net.IPNet
+	for _, value := range values {
+		if !strings.Contains(value, "/") {
+			ip := net.ParseIP(value)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid ip %q", value)
+			}
+			bits := 8 * net.IPv4len
+			if ip.To4() == nil {
+				bits = 8 * net.IPv6len
+			}
+			value = fmt.Sprintf("%s/%d", value, bits)
+		}
+
+		_, network, err := net.ParseCIDR(value)
+		if err != nil {
+			return nil, err
+		}
+		networks = append(networks, network)
+	}
+
+	return networks, nil
+}
+
+// get client ip set by clientIPMiddleware
+func clientIP(c *gin.Context) string {
+	if val, ok := c.Get(ctxKeyClientIP); ok {
+		return val.(string)
+	}
+
+	return c.ClientIP()
+}
+
+// get client geo info set by clientIPMiddleware, nil when unknown
+func clientGeo(c *gin.Context) *GeoInfo {
+	if val, ok := c.Get(ctxKeyClientGeo); ok {
+		return val.(*GeoInfo)
+	}
+
+	return nil
+}
+
+// header of the milliseconds left to the caller, downstream services give up the request with it
+const headerRequestTimeout = "X-Request-Timeout"
+
+// routes streaming their response for as long as there are rows, they get the timeout of uploads
+var longRequestRoutes = []string{"/listings/export"}
+
+// routes streaming events for as long as the client stays, they get no timeout
+var streamRoutes = []string{"/listings/stream"}
+
+// end the context of the request after timeout, or longTimeout for multipart uploads and longRequestRoutes, so
+// the handler, its queries and downstream calls stop with it. Callers sending X-Request-Timeout may only shorten
+// it, 0 disables
+func deadlineMiddleware(timeout, longTimeout time.Duration) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		limit := timeout
+		switch {
+		case matchesRoute(c.FullPath(), streamRoutes):
+			limit = 0
+		case strings.HasPrefix(c.ContentType(), "multipart/") || matchesRoute(c.FullPath(), longRequestRoutes):
+			limit = longTimeout
+		}
+
+		ctx, cancel := requestContext(c.Request.Context(), limit, c.GetHeader(headerRequestTimeout))
+		defer cancel()
+		c.Request = c.Request.WithContext(ctx)
+
+		c.Next()
+	}
+}
+
+func matchesRoute(path string, routes []string) bool {
+	for _, route := range routes {
+		if strings.HasSuffix(path, route) {
+			return true
+		}
+	}
+	return false
+}
+
+// ctx ending after timeout or the milliseconds left of the caller, whichever comes first, 0 disables timeout
+func requestContext(ctx context.Context, timeout time.Duration, callerTimeout string) (context.Context, context.CancelFunc) {
+	if ms, err := strconv.ParseInt(callerTimeout, 10, 64); err == nil && ms > 0 {
+		if left := time.Duration(ms) * time.Millisecond; timeout <= 0 || left < timeout {
+			timeout = left
+		}
+	}
+
+	if timeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, timeout)
+}
+
+// read trusted proxy depth and geo ip source from config
+func clientIPMiddlewareFromConfig() gin.HandlerFunc {
+	depth := cfg.Int("TRUSTED_PROXY_DEPTH", 0)
+	if depth < 0 {
+		log.Fatalf("invalid TRUSTED_PROXY_DEPTH %d", depth)
+	}
+
+	// X-Forwarded-For is only read from the proxies of TRUSTED_PROXIES
+	trusted, err := parseNetworks(cfg.List("TRUSTED_PROXIES"))
+	if err != nil {
+		log.Fatalf("invalid TRUSTED_PROXIES: %v", err)
+	}
+
+	var geo GeoResolver
+	if path := cfg.String("GEOIP_CSV_PATH", ""); path != "" {
+		table, err := loadCIDRGeoTable(path)
+		if err != nil {
+			log.Fatal(err)
+		}
+		geo = table
+	}
+
+	return clientIPMiddleware(depth, trusted, geo)
+}
+
+type cidrGeoEntry struct {
+	network *net.IPNet
+	info    GeoInfo
+}
+
+// geo ip source backed by csv rows of cidr,country,region,city
+type cidrGeoTable struct {
+	entries []cidrGeoEntry
+}
+
+func loadCIDRGeoTable(path string) (*cidrGeoTable, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	reader := csv.NewReader(file)
+	reader.FieldsPerRecord = -1
+	reader.Comment = '#'
+
+	table := &cidrGeoTable{}
+	for {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		_, network, err := net.ParseCIDR(strings.TrimSpace(record[0]))
+		if err != nil {
+			return nil, err
+		}
+
+		entry := cidrGeoEntry{network: network}
+		fields := []*string{&entry.info.Country, &entry.info.Region, &entry.info.City}
+		for i, field := range fields {
+			if i+1 < len(record) {
+				*field = strings.TrimSpace(record[i+1])
+			}
+		}
+		table.entries = append(table.entries, entry)
+	}
+
+	return table, nil
+}
+
+// lookup the most specific network containing ip
+func (t *cidrGeoTable) Lookup(ip net.IP) (*GeoInfo, bool) {
+	var found *GeoInfo
+	bestSize := -1
+	for i := range t.entries {
+		entry := &t.entries[i]
+		if !entry.network.Contains(ip) {
+			continue
+		}
+
+		if size, _ := entry.network.Mask.Size(); size > bestSize {
+			bestSize = size
+			info := entry.info
+			found = &info
+		}
+	}
+
+	return found, found != nil
+}
@@ -0,0 +1,145 @@
+package publicapi
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestResolveClientIP(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	trusted, err := parseNetworks([]string{"10.0.0.0/8", "192.168.1.1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name         string
+		remoteAddr   string
+		forwardedFor string
+		proxyDepth   int
+		want         string
+	}{
+		{name: "no proxy depth", remoteAddr: "203.0.113.7:1234", forwardedFor: "198.51.100.1", want: "203.0.113.7"},
+		{name: "one trusted proxy", remoteAddr: "10.0.0.2:1234", forwardedFor: "198.51.100.1", proxyDepth: 1, want: "198.51.100.1"},
+		{name: "client prepended hops are skipped", remoteAddr: "10.0.0.2:1234", forwardedFor: "1.1.1.1, 198.51.100.1, 10.0.0.3", proxyDepth: 2, want: "198.51.100.1"},
+		{name: "single trusted ip", remoteAddr: "192.168.1.1:1234", forwardedFor: "198.51.100.1", proxyDepth: 1, want: "198.51.100.1"},
+		{name: "untrusted peer", remoteAddr: "203.0.113.7:1234", forwardedFor: "198.51.100.1", proxyDepth: 1, want: "203.0.113.7"},
+		{name: "fewer hops than proxies", remoteAddr: "10.0.0.2:1234", forwardedFor: "198.51.100.1", proxyDepth: 2, want: "10.0.0.2"},
+		{name: "invalid hop", remoteAddr: "10.0.0.2:1234", forwardedFor: "not-an-ip", proxyDepth: 1, want: "10.0.0.2"},
+		{name: "no header", remoteAddr: "10.0.0.2:1234", proxyDepth: 1, want: "10.0.0.2"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// as newRouter without TRUSTED_PROXIES
+			c, router := gin.CreateTestContext(httptest.NewRecorder())
+			if err := router.SetTrustedProxies(nil); err != nil {
+				t.Fatal(err)
+			}
+			c.Request = httptest.NewRequest(http.MethodGet, "/", nil)
+			c.Request.RemoteAddr = tt.remoteAddr
+			if tt.forwardedFor != "" {
+				c.Request.Header.Set("X-Forwarded-For", tt.forwardedFor)
+			}
+
+			if got := resolveClientIP(c, tt.proxyDepth, trusted); got != tt.want {
+				t.Errorf("resolveClientIP = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseNetworks(t *testing.T) {
+	tests := []struct {
+		name    string
+		values  []string
+		ip      string
+		want    bool
+		wantErr bool
+	}{
+		{name: "cidr", values: []string{"10.0.0.0/8"}, ip: "10.1.2.3", want: true},
+		{name: "ipv4 is a /32", values: []string{"10.0.0.1"}, ip: "10.0.0.2", want: false},
+		{name: "ipv6", values: []string{"::1"}, ip: "::1", want: true},
+		{name: "invalid ip", values: []string{"10.0.0"}, wantErr: true},
+		{name: "invalid cidr", values: []string{"10.0.0.0/33"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			networks, err := parseNetworks(tt.values)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, want error %t", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+
+			if got := containsIP(networks, net.ParseIP(tt.ip)); got != tt.want {
+				t.Errorf("containsIP = %t, want %t", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDeadlineMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	deadlines := map[string]time.Duration{}
+	router := gin.New()
+	router.Use(deadlineMiddleware(30*time.Second, 10*time.Minute))
+	record := func(c *gin.Context) {
+		if deadline, ok := c.Request.Context().Deadline(); ok {
+			deadlines[c.Request.URL.Path] = time.Until(deadline)
+		}
+	}
+	router.GET("/public-api/listings", record)
+	router.GET("/public-api/listings/export", record)
+	router.GET("/public-api/listings/stream", record)
+	router.GET("/public-api/users", record)
+
+	for path, callerTimeout := range map[string]string{"/public-api/listings": "", "/public-api/listings/export": "", "/public-api/listings/stream": "", "/public-api/users": "800"} {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		if callerTimeout != "" {
+			req.Header.Set(headerRequestTimeout, callerTimeout)
+		}
+		router.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	for path, want := range map[string]time.Duration{"/public-api/listings": 30 * time.Second, "/public-api/listings/export": 10 * time.Minute, "/public-api/users": 800 * time.Millisecond} {
+		if got := deadlines[path]; got > want || got < want-time.Second {
+			t.Errorf("%s deadline in %v, want %v", path, got, want)
+		}
+	}
+	if got, ok := deadlines["/public-api/listings/stream"]; ok {
+		t.Errorf("stream deadline in %v, want none", got)
+	}
+
+	// downstream calls carry the time left
+	var sent string
+	transport := &deadlineTransport{base: roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		sent = req.Header.Get(headerRequestTimeout)
+		return &http.Response{StatusCode: http.StatusOK, Body: http.NoBody}, nil
+	})}
+	ctx, cancel := context.WithTimeout(context.Background(), 1500*time.Millisecond)
+	defer cancel()
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, "http://listing-service/listings", nil)
+	if _, err := transport.RoundTrip(req); err != nil {
+		t.Fatal(err)
+	}
+	if ms, err := strconv.Atoi(sent); err != nil || ms > 1500 || ms < 1000 {
+		t.Errorf("%s = %q, want the 1.5s left", headerRequestTimeout, sent)
+	}
+}
+
+type roundTripFunc func(req *http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
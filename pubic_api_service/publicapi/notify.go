@@ -0,0 +1,215 @@
+package publicapi
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+)
+
+// =========== REPOSITORY LAYER, NOTIFICATIONS OF OFFER AND VIEWING EVENTS SENT TO A WEBHOOK ===========
+
+const (
+	notificationOfferReceived  = "offer_received"
+	notificationOfferAccepted  = "offer_accepted"
+	notificationOfferRejected  = "offer_rejected"
+	notificationOfferCountered = "offer_countered"
+	notificationOfferWithdrawn = "offer_withdrawn"
+
+	notificationViewingBooked    = "viewing_booked"
+	notificationViewingCancelled = "viewing_cancelled"
+	notificationViewingReminder  = "viewing_reminder"
+)
+
+// events users set notification preferences of and the channels delivering them, the user service keeps the same
+// lists
+var (
+	notificationEvents = []string{
+		notificationOfferReceived, notificationOfferAccepted, notificationOfferRejected, notificationOfferCountered, notificationOfferWithdrawn,
+		notificationViewingBooked, notificationViewingCancelled, notificationViewingReminder,
+		notificationListingDigest, notificationAnnouncement,
+	}
+	notificationChannels = []string{"email", "push", "in_app"}
+)
+
+// event for the user UserID, kept in the inbox for in-app, pushed to devices and delivered by the webhook receiver,
+// offer events set OfferID and Amount, viewing events ViewingID, StartsAt and EndsAt, digests Subject, Body and
+// UnsubscribeURL, announcements BroadcastID, Subject and Body
+type Notification struct {
+	Event     string `json:"event"`
+	UserID    int    `json:"user_id"`
+	ListingID int    `json:"listing_id"`
+	OfferID   int    `json:"offer_id,omitempty"`
+	Amount    int    `json:"amount,omitempty"`
+	ViewingID int    `json:"viewing_id,omitempty"`
+	StartsAt  int64  `json:"starts_at,omitempty"`
+	EndsAt    int64  `json:"ends_at,omitempty"`
+	// broadcast of an announcement
+	BroadcastID int    `json:"broadcast_id,omitempty"`
+	Status      string `json:"status"`
+	// rendered message of a digest, the receiver sends it as it is
+	Subject        string `json:"subject,omitempty"`
+	Body           string `json:"body,omitempty"`
+	UnsubscribeURL string `json:"unsubscribe_url,omitempty"`
+	// channels the user enabled for the event left to the receiver, it delivers over these only
+	Channels  []string `json:"channels"`
+	CreatedAt int64    `json:"created_at"`
+}
+
+// NOTIFICATION_WEBHOOK_URL receive notifications of the channels not delivered by the public API as a json POST,
+// empty only log them
+var notificationWebhookURL = cfg.String("NOTIFICATION_WEBHOOK_URL", "")
+
+// client of the webhook, apart from the downstream client so a slow receiver never opens the listing service breaker
+var notificationClient = &http.Client{
+	// NOTIFICATION_TIMEOUT max duration of one webhook call
+	Timeout:   cfg.Duration("NOTIFICATION_TIMEOUT", 5*time.Second),
+	Transport: otelhttp.NewTransport(http.DefaultTransport),
+}
+
+// notifications being sent, waited on shutdown
+var notificationsInFlight sync.WaitGroup
+
+func newOfferNotification(event string, userID int, offer *Offer) Notification {
+	return Notification{
+		Event:     event,
+		UserID:    userID,
+		ListingID: offer.ListingID,
+		OfferID:   offer.ID,
+		Amount:    offer.Amount,
+		Status:    offer.Status,
+	}
+}
+
+func newViewingNotification(event string, userID int, viewing *Viewing) Notification {
+	return Notification{
+		Event:     event,
+		UserID:    userID,
+		ListingID: viewing.ListingID,
+		ViewingID: viewing.ID,
+		StartsAt:  viewing.StartsAt,
+		EndsAt:    viewing.EndsAt,
+		Status:    viewing.Status,
+	}
+}
+
+// notify send n in background over the channels the user enabled for its event, skipped when the user enabled none,
+// a failed delivery is logged and never fails the request that caused it
+func notify(ctx context.Context, n Notification) {
+	n.CreatedAt = time.Now().UnixNano() / int64(time.Microsecond)
+
+	// keep request id and trace of the request but outlive it
+	ctx = context.WithoutCancel(ctx)
+	notificationsInFlight.Add(1)
+	go func() {
+		defer notificationsInFlight.Done()
+		notificationsTotal.WithLabelValues(n.Event, deliverNotification(ctx, n)).Inc()
+	}()
+}
+
+// deliverNotification keep n in the inbox of its user, push it to the devices of the user when a push platform is
+// configured and send the webhook the other channels, result of the notification for notificationsTotal
+func deliverNotification(ctx context.Context, n Notification) string {
+	channels, err := notificationChannelsOf(ctx, n)
+	if err != nil {
+		slog.ErrorContext(ctx, "service error", "code", "328", "error", err, "event", n.Event, "user_id", n.UserID)
+		return "failed"
+	}
+	if len(channels) == 0 {
+		return "muted"
+	}
+
+	result := "sent"
+	// the inbox is the in-app channel
+	if slices.Contains(channels, "in_app") {
+		if err := storeInboxNotification(ctx, n); err != nil {
+			slog.ErrorContext(ctx, "service error", "code", "380", "error", err, "event", n.Event, "user_id", n.UserID)
+			result = "failed"
+		}
+		channels = withoutChannel(channels, "in_app")
+	}
+
+	// without a push platform the webhook receiver still delivers the push channel
+	if len(pushSenders) > 0 && slices.Contains(channels, "push") {
+		pushNotification(ctx, n)
+		channels = withoutChannel(channels, "push")
+	}
+
+	if len(channels) == 0 {
+		return result
+	}
+
+	if notificationWebhookURL == "" {
+		slog.InfoContext(ctx, "notification", "event", n.Event, "user_id", n.UserID, "listing_id", n.ListingID, "channels", channels)
+		return "logged"
+	}
+
+	// a stored email template sets the subject and body the receiver sends
+	if slices.Contains(channels, "email") {
+		if t := notificationTemplates.get(ctx, n.Event, "email", notificationLocale); t != nil {
+			if subject, body, err := t.render(n); err == nil {
+				n.Subject, n.Body = subject, body
+			} else {
+				slog.ErrorContext(ctx, "service error", "code", "465", "error", err, "event", n.Event, "channel", "email", "version", t.version)
+			}
+		}
+	}
+
+	n.Channels = channels
+	if err := sendNotification(ctx, n); err != nil {
+		slog.ErrorContext(ctx, "service error", "code", "177", "error", err, "event", n.Event, "user_id", n.UserID)
+		return "failed"
+	}
+	return result
+}
+
+func withoutChannel(channels []string, channel string) []string {
+	return slices.DeleteFunc(slices.Clone(channels), func(c string) bool { return c == channel })
+}
+
+func sendNotification(ctx context.Context, n Notification) error {
+	body, err := json.Marshal(n)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, notificationWebhookURL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := notificationClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("notification webhook answered %d", resp.StatusCode)
+	}
+
+	return nil
+}
+
+// wait for notifications being sent, each ends within NOTIFICATION_TIMEOUT
+func stopNotifications(ctx context.Context) {
+	done := make(chan struct{})
+	go func() {
+		notificationsInFlight.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-ctx.Done():
+		slog.ErrorContext(ctx, "worker error", "code", "178", "error", "shutdown timeout, notifications not sent")
+	}
+}
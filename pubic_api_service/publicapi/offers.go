@@ -0,0 +1,446 @@
+package publicapi
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"apperror"
+
+	"github.com/gin-gonic/gin"
+)
+
+// offer of a buyer on a listing, amount is the last proposed price, status pending waits for the owner
+// and countered waits for the buyer
+type Offer struct {
+	ID        int          `json:"id"`
+	ListingID int          `json:"listing_id"`
+	BuyerID   int          `json:"buyer_id"`
+	Amount    int          `json:"amount"`
+	Status    string       `json:"status"`
+	CreatedAt int64        `json:"created_at"`
+	UpdatedAt int64        `json:"updated_at"`
+	History   []OfferEvent `json:"history,omitempty"`
+}
+
+// one step of the negotiation, amount is set on offer and counter
+type OfferEvent struct {
+	ActorID   int     `json:"actor_id"`
+	Action    string  `json:"action"`
+	Amount    *int    `json:"amount"`
+	Message   *string `json:"message"`
+	CreatedAt int64   `json:"created_at"`
+}
+
+type OfferCreate struct {
+	Amount  int    `json:"amount" binding:"required,gt=0"`
+	Message string `json:"message"`
+}
+
+// body of an action on an offer, amount is required to counter
+type OfferAction struct {
+	Amount  int    `json:"amount" binding:"omitempty,gt=0"`
+	Message string `json:"message"`
+}
+
+type OfferResponse struct {
+	Result bool  `json:"result"`
+	Offer  Offer `json:"offer"`
+	// other open offers of the listing rejected by accepting this one
+	ClosedOffers []Offer `json:"closed_offers"`
+}
+
+type OffersResponse struct {
+	Result bool    `json:"result"`
+	Offers []Offer `json:"offers"`
+}
+
+// notification sent to the other party of the offer for each action
+var offerActionEvents = map[string]string{
+	"accept":   notificationOfferAccepted,
+	"reject":   notificationOfferRejected,
+	"counter":  notificationOfferCountered,
+	"withdraw": notificationOfferWithdrawn,
+}
+
+var (
+	errOfferNotFound      = apperror.NotFound("Offer not found")
+	errOfferNotOwned      = errors.New("offer does not belong to user")
+	errOfferActionInvalid = apperror.Validation("invalid action, supported values: accept, reject, counter, withdraw")
+	errOfferAmountMissing = apperror.Validation("amount is required to counter")
+	errOfferOwnListing    = apperror.Validation("Owner can not make an offer on own listing")
+)
+
+// =========== INTERFACE HANDLER, HANDLING REQUEST RESPONSE API DEPEND INTERFACE ===========
+
+func createListingOfferHandler(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "handler error", "code", "158", "error", err)
+		apperror.JSON(c, http.StatusBadRequest, "Invalid listing ID")
+		return
+	}
+
+	var body OfferCreate
+	if err := c.ShouldBindJSON(&body); err != nil {
+		slog.ErrorContext(c.Request.Context(), "handler error", "code", "159", "error", "Invalid body request")
+		apperror.RespondBinding(c, err)
+		return
+	}
+
+	res, err := createListingOfferUsecase(c.Request.Context(), id, authUserID(c), body)
+	if err != nil {
+		respondContactError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"offer": res})
+}
+
+func getListingOffersHandler(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "handler error", "code", "160", "error", err)
+		apperror.JSON(c, http.StatusBadRequest, "Invalid listing ID")
+		return
+	}
+
+	res, err := getListingOffersUsecase(c.Request.Context(), id, authUserID(c))
+	if err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"offers": res})
+}
+
+func getListingOfferHandler(c *gin.Context) {
+	id, offerID, ok := offerParams(c)
+	if !ok {
+		return
+	}
+
+	res, err := getListingOfferUsecase(c.Request.Context(), id, offerID, authUserID(c))
+	if err != nil {
+		if errors.Is(err, errOfferNotOwned) {
+			apperror.JSON(c, http.StatusForbidden, "Offer does not belong to user")
+			return
+		}
+		apperror.Respond(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"offer": res})
+}
+
+func actListingOfferHandler(c *gin.Context) {
+	id, offerID, ok := offerParams(c)
+	if !ok {
+		return
+	}
+
+	// accept, reject and withdraw may come without a body
+	var body OfferAction
+	if err := c.ShouldBindJSON(&body); err != nil && !errors.Is(err, io.EOF) {
+		slog.ErrorContext(c.Request.Context(), "handler error", "code", "161", "error", "Invalid body request")
+		apperror.RespondBinding(c, err)
+		return
+	}
+
+	res, err := actListingOfferUsecase(c.Request.Context(), id, offerID, authUserID(c), c.Param("action"), body)
+	if err != nil {
+		if errors.Is(err, errOfferNotOwned) {
+			apperror.JSON(c, http.StatusForbidden, "Offer does not belong to user")
+			return
+		}
+		apperror.Respond(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"offer": res})
+}
+
+// listing and offer id of the path, answers 400 when one is invalid
+func offerParams(c *gin.Context) (int, int, bool) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "handler error", "code", "162", "error", err)
+		apperror.JSON(c, http.StatusBadRequest, "Invalid listing ID")
+		return 0, 0, false
+	}
+
+	offerID, err := strconv.Atoi(c.Param("offer_id"))
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "handler error", "code", "163", "error", err)
+		apperror.JSON(c, http.StatusBadRequest, "Invalid offer ID")
+		return 0, 0, false
+	}
+
+	return id, offerID, true
+}
+
+// =========== USECASE LAYER, SERVES AS AN INTERMEDIARY BETWEEN THE PRESENTATION LAYER AND THE DATA LAYER ===========
+
+// make an offer on a listing of another user who did not block the buyer and notify the owner
+func createListingOfferUsecase(ctx context.Context, listingID, buyerID int, body OfferCreate) (*Offer, error) {
+	listing, err := findOfferListing(ctx, listingID)
+	if err != nil {
+		return nil, err
+	}
+
+	if listing.UserID == buyerID {
+		return nil, errOfferOwnListing
+	}
+
+	if err := checkNotBlocked(ctx, listing.UserID, buyerID); err != nil {
+		return nil, err
+	}
+
+	if err := checkContentText(ctx, contentTargetOfferMessage, body.Message); err != nil {
+		return nil, err
+	}
+
+	form := url.Values{"buyer_id": {strconv.Itoa(buyerID)}, "amount": {strconv.Itoa(body.Amount)}}
+	if body.Message != "" {
+		form.Set("message", body.Message)
+	}
+	res, err := createListingOfferService(ctx, listingID, form)
+	if err != nil {
+		return nil, err
+	}
+
+	notify(ctx, newOfferNotification(notificationOfferReceived, listing.UserID, &res.Offer))
+
+	return &res.Offer, nil
+}
+
+// every offer of the listing for its owner, only own offers for anyone else
+func getListingOffersUsecase(ctx context.Context, listingID, userID int) ([]Offer, error) {
+	listing, err := findOfferListing(ctx, listingID)
+	if err != nil {
+		return nil, err
+	}
+
+	buyerID := ""
+	if listing.UserID != userID {
+		buyerID = strconv.Itoa(userID)
+	}
+
+	res, err := getListingOffersService(ctx, listingID, buyerID)
+	if err != nil {
+		return nil, apperror.Upstream("Failed to get offers", err)
+	}
+
+	return res.Offers, nil
+}
+
+// offer with its history, for the owner of the listing and the buyer only
+func getListingOfferUsecase(ctx context.Context, listingID, offerID, userID int) (*Offer, error) {
+	listing, err := findOfferListing(ctx, listingID)
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := getListingOfferService(ctx, listingID, offerID)
+	if err != nil {
+		if errors.Is(err, errOfferNotFound) {
+			return nil, err
+		}
+		return nil, apperror.Upstream("Failed to get offer", err)
+	}
+
+	if userID != listing.UserID && userID != res.Offer.BuyerID {
+		return nil, errOfferNotOwned
+	}
+
+	return &res.Offer, nil
+}
+
+// accept, reject, counter or withdraw an offer as its owner or buyer and notify the other party,
+// buyers of the offers closed by an accept are notified of the rejection
+func actListingOfferUsecase(ctx context.Context, listingID, offerID, userID int, action string, body OfferAction) (*Offer, error) {
+	event, ok := offerActionEvents[action]
+	if !ok {
+		return nil, errOfferActionInvalid
+	}
+
+	if action == "counter" && body.Amount == 0 {
+		return nil, errOfferAmountMissing
+	}
+
+	if err := checkContentText(ctx, contentTargetOfferMessage, body.Message); err != nil {
+		return nil, err
+	}
+
+	listing, err := findOfferListing(ctx, listingID)
+	if err != nil {
+		return nil, err
+	}
+
+	form := url.Values{"action": {action}, "actor_id": {strconv.Itoa(userID)}}
+	if action == "counter" {
+		form.Set("amount", strconv.Itoa(body.Amount))
+	}
+	if body.Message != "" {
+		form.Set("message", body.Message)
+	}
+	res, err := updateListingOfferService(ctx, listingID, offerID, form)
+	if err != nil {
+		return nil, err
+	}
+
+	recipient := res.Offer.BuyerID
+	if userID == res.Offer.BuyerID {
+		recipient = listing.UserID
+	}
+	notify(ctx, newOfferNotification(event, recipient, &res.Offer))
+	for i := range res.ClosedOffers {
+		notify(ctx, newOfferNotification(notificationOfferRejected, res.ClosedOffers[i].BuyerID, &res.ClosedOffers[i]))
+	}
+
+	return &res.Offer, nil
+}
+
+func findOfferListing(ctx context.Context, listingID int) (*ListingCreate, error) {
+	res, err := findListingByIDService(ctx, listingID)
+	if err != nil {
+		if errors.Is(err, errListingNotFound) {
+			return nil, err
+		}
+		return nil, apperror.Upstream("Failed to get listing", err)
+	}
+
+	return &res.Listing, nil
+}
+
+// =========== REPOSITORY LAYER, ABSTRACTION OVER THE DATA PERSISTENCE (databases, file systems, or external APIs) ===========
+
+var (
+	// listing service api path
+	apiPathListingOffers = listingServiceURL + "/listings/%d/offers"
+	apiPathListingOffer  = listingServiceURL + "/listings/%d/offers/%d"
+)
+
+func createListingOfferService(ctx context.Context, listingID int, form url.Values) (*OfferResponse, error) {
+	resp, err := httpPostForm(ctx, fmt.Sprintf(apiPathListingOffers, listingID), form)
+	if err != nil {
+		slog.ErrorContext(ctx, "service error", "code", "164", "error", err)
+		return nil, apperror.Upstream("Failed to create offer", err)
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusCreated:
+	case http.StatusNotFound:
+		return nil, errListingNotFound
+	case http.StatusBadRequest:
+		return nil, apperror.Validation(upstreamErrorMessage(resp.Body, "Invalid offer"))
+	case http.StatusConflict:
+		return nil, apperror.Conflict(upstreamErrorMessage(resp.Body, "Listing does not take offers"))
+	default:
+		slog.ErrorContext(ctx, "service error", "code", "165", "error", "error creating offer from listing service")
+		return nil, apperror.Upstream("Failed to create offer", errors.New("error creating offer from listing service"))
+	}
+
+	var offer OfferResponse
+	if err := decodeJSON(resp.Body, &offer); err != nil {
+		slog.ErrorContext(ctx, "service error", "code", "166", "error", err)
+		return nil, apperror.Upstream("Failed to create offer", err)
+	}
+
+	return &offer, nil
+}
+
+// offers of the listing, of buyerID only when not empty
+func getListingOffersService(ctx context.Context, listingID int, buyerID string) (*OffersResponse, error) {
+	resp, err := httpGet(ctx, fmt.Sprintf(apiPathListingOffers, listingID)+"?buyer_id="+url.QueryEscape(buyerID))
+	if err != nil {
+		slog.ErrorContext(ctx, "service error", "code", "167", "error", err)
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		slog.ErrorContext(ctx, "service error", "code", "168", "error", "error fetching offers from listing service")
+		return nil, errors.New("error fetching offers from listing service")
+	}
+
+	var offers OffersResponse
+	if err := decodeJSON(resp.Body, &offers); err != nil {
+		slog.ErrorContext(ctx, "service error", "code", "169", "error", err)
+		return nil, err
+	}
+
+	return &offers, nil
+}
+
+func getListingOfferService(ctx context.Context, listingID, offerID int) (*OfferResponse, error) {
+	resp, err := httpGet(ctx, fmt.Sprintf(apiPathListingOffer, listingID, offerID))
+	if err != nil {
+		slog.ErrorContext(ctx, "service error", "code", "170", "error", err)
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		return nil, errOfferNotFound
+	default:
+		slog.ErrorContext(ctx, "service error", "code", "171", "error", "error fetching offer from listing service")
+		return nil, errors.New("error fetching offer from listing service")
+	}
+
+	var offer OfferResponse
+	if err := decodeJSON(resp.Body, &offer); err != nil {
+		slog.ErrorContext(ctx, "service error", "code", "172", "error", err)
+		return nil, err
+	}
+
+	return &offer, nil
+}
+
+func updateListingOfferService(ctx context.Context, listingID, offerID int, form url.Values) (*OfferResponse, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, fmt.Sprintf(apiPathListingOffer, listingID, offerID), strings.NewReader(form.Encode()))
+	if err != nil {
+		slog.ErrorContext(ctx, "service error", "code", "173", "error", err)
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		slog.ErrorContext(ctx, "service error", "code", "174", "error", err)
+		return nil, apperror.Upstream("Failed to update offer", err)
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		return nil, errOfferNotFound
+	case http.StatusForbidden:
+		return nil, errOfferNotOwned
+	case http.StatusBadRequest:
+		return nil, apperror.Validation(upstreamErrorMessage(resp.Body, "Invalid offer action"))
+	case http.StatusConflict:
+		return nil, apperror.Conflict(upstreamErrorMessage(resp.Body, "Offer can not take this action"))
+	default:
+		slog.ErrorContext(ctx, "service error", "code", "175", "error", "error updating offer from listing service")
+		return nil, apperror.Upstream("Failed to update offer", errors.New("error updating offer from listing service"))
+	}
+
+	var offer OfferResponse
+	if err := decodeJSON(resp.Body, &offer); err != nil {
+		slog.ErrorContext(ctx, "service error", "code", "176", "error", err)
+		return nil, apperror.Upstream("Failed to update offer", err)
+	}
+
+	return &offer, nil
+}
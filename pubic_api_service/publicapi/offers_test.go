@@ -0,0 +1,216 @@
+package publicapi
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"sort"
+	"sync"
+	"testing"
+
+	"apperror"
+)
+
+// listing client answering FindListing with a listing of owner, other calls are not used by the offer usecases
+type offerListingClient struct {
+	ListingClient
+	owner int
+}
+
+func (c offerListingClient) FindListing(ctx context.Context, listingID int) (*ListingDetailResponse, error) {
+	return &ListingDetailResponse{Result: true, Listing: ListingCreate{ID: listingID, UserID: c.owner}}, nil
+}
+
+// webhook receiving notifications, returned sorted by user once every notification was sent,
+// users are on the default preferences unless the test sets userClient after
+func newNotificationRecorder(t *testing.T) func() []Notification {
+	t.Helper()
+
+	previousClient := userClient
+	userClient = preferencesUserClient{}
+	t.Cleanup(func() { userClient = previousClient })
+
+	var (
+		mu       sync.Mutex
+		received []Notification
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var n Notification
+		if err := json.NewDecoder(r.Body).Decode(&n); err != nil {
+			t.Error(err)
+		}
+		mu.Lock()
+		received = append(received, n)
+		mu.Unlock()
+	}))
+	t.Cleanup(server.Close)
+
+	previous := notificationWebhookURL
+	notificationWebhookURL = server.URL
+	t.Cleanup(func() { notificationWebhookURL = previous })
+
+	return func() []Notification {
+		notificationsInFlight.Wait()
+		mu.Lock()
+		defer mu.Unlock()
+
+		sort.Slice(received, func(i, j int) bool { return received[i].UserID < received[j].UserID })
+		return received
+	}
+}
+
+func TestActListingOfferUsecase(t *testing.T) {
+	const (
+		owner = 10
+		buyer = 20
+		other = 30
+	)
+
+	tests := []struct {
+		name   string
+		actor  int
+		action string
+		body   OfferAction
+		// reply of the listing service, which holds the transitions of the offer
+		status int
+		reply  string
+
+		wantForm   url.Values
+		wantErr    error
+		wantNotify []Notification
+	}{
+		{
+			name: "owner accepts and the other open offers are closed", actor: owner, action: "accept",
+			status: http.StatusOK,
+			reply: `{"result": true, "offer": {"id": 1, "listing_id": 5, "buyer_id": 20, "amount": 900, "status": "accepted"},
+				"closed_offers": [{"id": 2, "listing_id": 5, "buyer_id": 30, "amount": 800, "status": "rejected"}]}`,
+			wantForm: url.Values{"action": {"accept"}, "actor_id": {"10"}},
+			wantNotify: []Notification{
+				{Event: notificationOfferAccepted, UserID: buyer, ListingID: 5, OfferID: 1, Amount: 900, Status: "accepted"},
+				{Event: notificationOfferRejected, UserID: other, ListingID: 5, OfferID: 2, Amount: 800, Status: "rejected"},
+			},
+		},
+		{
+			name: "owner counters", actor: owner, action: "counter", body: OfferAction{Amount: 950, Message: "meet halfway"},
+			status:   http.StatusOK,
+			reply:    `{"result": true, "offer": {"id": 1, "listing_id": 5, "buyer_id": 20, "amount": 950, "status": "countered"}}`,
+			wantForm: url.Values{"action": {"counter"}, "actor_id": {"10"}, "amount": {"950"}, "message": {"meet halfway"}},
+			wantNotify: []Notification{
+				{Event: notificationOfferCountered, UserID: buyer, ListingID: 5, OfferID: 1, Amount: 950, Status: "countered"},
+			},
+		},
+		{
+			name: "buyer counters back", actor: buyer, action: "counter", body: OfferAction{Amount: 920},
+			status:   http.StatusOK,
+			reply:    `{"result": true, "offer": {"id": 1, "listing_id": 5, "buyer_id": 20, "amount": 920, "status": "pending"}}`,
+			wantForm: url.Values{"action": {"counter"}, "actor_id": {"20"}, "amount": {"920"}},
+			wantNotify: []Notification{
+				{Event: notificationOfferCountered, UserID: owner, ListingID: 5, OfferID: 1, Amount: 920, Status: "pending"},
+			},
+		},
+		{
+			name: "buyer withdraws", actor: buyer, action: "withdraw",
+			status:   http.StatusOK,
+			reply:    `{"result": true, "offer": {"id": 1, "listing_id": 5, "buyer_id": 20, "amount": 900, "status": "withdrawn"}}`,
+			wantForm: url.Values{"action": {"withdraw"}, "actor_id": {"20"}},
+			wantNotify: []Notification{
+				{Event: notificationOfferWithdrawn, UserID: owner, ListingID: 5, OfferID: 1, Amount: 900, Status: "withdrawn"},
+			},
+		},
+		{
+			name: "transition refused", actor: buyer, action: "accept",
+			status:  http.StatusConflict,
+			reply:   `{"error": {"code": "conflict", "message": "buyer can not accept a pending offer"}}`,
+			wantErr: apperror.ErrConflict,
+		},
+		{
+			name: "not a party of the offer", actor: other, action: "reject",
+			status:  http.StatusForbidden,
+			reply:   `{"error": {"code": "forbidden", "message": "actor is not a party of the offer"}}`,
+			wantErr: errOfferNotOwned,
+		},
+		{
+			name: "offer of another listing", actor: owner, action: "reject",
+			status:  http.StatusNotFound,
+			reply:   `{"error": {"code": "not_found", "message": "offer not found"}}`,
+			wantErr: errOfferNotFound,
+		},
+		{name: "unknown action", actor: owner, action: "approve", wantErr: errOfferActionInvalid},
+		{name: "counter without amount", actor: owner, action: "counter", wantErr: errOfferAmountMissing},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var form url.Values
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.Method != http.MethodPut || r.URL.Path != "/listings/5/offers/1" {
+					t.Errorf("request %s %s, want PUT /listings/5/offers/1", r.Method, r.URL.Path)
+				}
+				r.ParseForm()
+				form = r.PostForm
+
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(tt.status)
+				w.Write([]byte(tt.reply))
+			}))
+			defer server.Close()
+
+			previousPath, previousClient := apiPathListingOffer, listingClient
+			apiPathListingOffer = server.URL + "/listings/%d/offers/%d"
+			listingClient = offerListingClient{owner: owner}
+			defer func() { apiPathListingOffer, listingClient = previousPath, previousClient }()
+
+			notifications := newNotificationRecorder(t)
+
+			offer, err := actListingOfferUsecase(context.Background(), 5, 1, tt.actor, tt.action, tt.body)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("err = %v, want %v", err, tt.wantErr)
+				}
+				if tt.status == 0 && form != nil {
+					t.Error("invalid action was sent to the listing service")
+				}
+				if got := notifications(); len(got) != 0 {
+					t.Errorf("notified %+v on error", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if offer.Status != tt.wantNotify[0].Status {
+				t.Errorf("offer status = %q, want %q", offer.Status, tt.wantNotify[0].Status)
+			}
+			if form.Encode() != tt.wantForm.Encode() {
+				t.Errorf("form = %s, want %s", form.Encode(), tt.wantForm.Encode())
+			}
+
+			got := notifications()
+			if len(got) != len(tt.wantNotify) {
+				t.Fatalf("notified %+v, want %+v", got, tt.wantNotify)
+			}
+			for i := range got {
+				got[i].CreatedAt = 0
+				tt.wantNotify[i].Channels = []string{"email", "push"}
+				if !reflect.DeepEqual(got[i], tt.wantNotify[i]) {
+					t.Errorf("notification %d = %+v, want %+v", i, got[i], tt.wantNotify[i])
+				}
+			}
+		})
+	}
+}
+
+func TestCreateListingOfferOwnListing(t *testing.T) {
+	previous := listingClient
+	listingClient = offerListingClient{owner: 10}
+	defer func() { listingClient = previous }()
+
+	if _, err := createListingOfferUsecase(context.Background(), 5, 10, OfferCreate{Amount: 900}); err != errOfferOwnListing {
+		t.Errorf("err = %v, want %v", err, errOfferOwnListing)
+	}
+}
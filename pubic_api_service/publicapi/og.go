@@ -0,0 +1,223 @@
+package publicapi
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"html/template"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"apperror"
+
+	"github.com/gin-gonic/gin"
+)
+
+// social preview of a listing, the Open Graph and Twitter Card tags chat apps read to unfurl a shared link
+type ListingPreview struct {
+	Title       string `json:"title"`
+	Description string `json:"description"`
+	URL         string `json:"url"`
+	Image       string `json:"image,omitempty"`
+	Price       int    `json:"price"`
+	Currency    string `json:"currency"`
+	// og:* and twitter:* tags in page order, ready to render in a head
+	Meta []PreviewMeta `json:"meta"`
+}
+
+type PreviewMeta struct {
+	Property string `json:"property"`
+	Content  string `json:"content"`
+}
+
+var (
+	// OG_SITE_NAME og:site_name of the previews
+	// LISTING_PRICE_CURRENCY ISO 4217 code of offer amounts and of listings read without a currency
+	ogSiteName      = cfg.String("OG_SITE_NAME", "99.co")
+	listingCurrency = cfg.String("LISTING_PRICE_CURRENCY", "SGD")
+
+	// page of the preview for crawlers, people opening it are sent on to the listing page
+	listingPreviewPage = template.Must(template.New("og").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>{{.Title}}</title>
+<link rel="canonical" href="{{.URL}}">
+{{range .Meta}}<meta property="{{.Property}}" content="{{.Content}}">
+{{end}}<meta http-equiv="refresh" content="0; url={{.URL}}">
+</head>
+<body><a href="{{.URL}}">{{.Title}}</a></body>
+</html>
+`))
+)
+
+// width og:image is picked at, the size link previews show a large image card at
+const ogImageWidth = 1200
+
+// =========== INTERFACE HANDLER, HANDLING REQUEST RESPONSE API DEPEND INTERFACE ===========
+
+// preview as JSON, or as an html page of meta tags for clients accepting text/html
+func getListingPreviewHandler(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "handler error", "code", "274", "error", err)
+		apperror.JSON(c, http.StatusBadRequest, "Invalid listing ID")
+		return
+	}
+
+	res, err := getListingPreviewUsecase(c.Request.Context(), id, publicBaseURL(c))
+	if err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+
+	// crawlers fetch a shared link many times in a row, a changed listing shows up within minutes
+	c.Header("Cache-Control", "public, max-age=300")
+	c.Header("Vary", "Accept")
+
+	if c.NegotiateFormat(gin.MIMEJSON, gin.MIMEHTML) != gin.MIMEHTML {
+		c.JSON(http.StatusOK, gin.H{"preview": res})
+		return
+	}
+
+	var page bytes.Buffer
+	if err := listingPreviewPage.Execute(&page, res); err != nil {
+		slog.ErrorContext(c.Request.Context(), "handler error", "code", "275", "error", err)
+		apperror.JSON(c, http.StatusInternalServerError, "Failed to render preview")
+		return
+	}
+	c.Data(http.StatusOK, "text/html; charset=utf-8", page.Bytes())
+}
+
+// scheme and host the urls of a preview are made absolute with, SHARE_LINK_BASE_URL when set
+func publicBaseURL(c *gin.Context) string {
+	if shareLinkBaseURL != "" {
+		return shareLinkBaseURL
+	}
+
+	scheme := "http"
+	if c.Request.TLS != nil || c.GetHeader("X-Forwarded-Proto") == "https" {
+		scheme = "https"
+	}
+	return scheme + "://" + c.Request.Host
+}
+
+// =========== USECASE LAYER, SERVES AS AN INTERMEDIARY BETWEEN THE PRESENTATION LAYER AND THE DATA LAYER ===========
+
+func getListingPreviewUsecase(ctx context.Context, listingID int, baseURL string) (*ListingPreview, error) {
+	res, err := findListingByIDService(ctx, listingID)
+	if err != nil {
+		if errors.Is(err, errListingNotFound) {
+			return nil, err
+		}
+		return nil, apperror.Upstream("Failed to get listing", err)
+	}
+
+	// og:image at the width link previews show it, signed like the urls of every other response
+	transformListingMedia(ctx, nil, res.Listing.Media, nil, mediaVariant{width: ogImageWidth})
+	return listingPreview(&res.Listing, baseURL), nil
+}
+
+// preview of listing, relative urls are made absolute with baseURL
+func listingPreview(listing *ListingCreate, baseURL string) *ListingPreview {
+	preview := &ListingPreview{
+		URL:      absoluteURL(strings.ReplaceAll(listingPageURL, "{id}", strconv.Itoa(listing.ID)), baseURL),
+		Price:    listing.Price,
+		Currency: listing.Currency,
+	}
+	// listings read before the listing service returned a currency
+	if preview.Currency == "" {
+		preview.Currency = listingCurrency
+	}
+
+	price := preview.Currency + " " + formatThousands(listing.Price)
+	if listing.ListingType == "rent" {
+		preview.Title = "For rent: " + price + "/month"
+	} else {
+		preview.Title = "For sale: " + price
+	}
+
+	var details []string
+	if listing.Region != "" {
+		preview.Title += " in " + listing.Region
+		details = append(details, listing.Region)
+	}
+	if listing.Area > 0 {
+		details = append(details, strconv.FormatFloat(listing.Area, 'f', -1, 64)+" m²")
+	}
+	details = append(details, "Listed on "+ogSiteName)
+	preview.Description = strings.Join(details, " · ")
+
+	if photo := primaryPhoto(listing.Media); photo != nil {
+		preview.Image = absoluteURL(photo.URL, baseURL)
+	}
+
+	card := "summary"
+	preview.Meta = []PreviewMeta{
+		{"og:type", "website"},
+		{"og:site_name", ogSiteName},
+		{"og:title", preview.Title},
+		{"og:description", preview.Description},
+		{"og:url", preview.URL},
+	}
+	if preview.Image != "" {
+		card = "summary_large_image"
+		preview.Meta = append(preview.Meta, PreviewMeta{"og:image", preview.Image})
+	}
+	preview.Meta = append(preview.Meta,
+		PreviewMeta{"og:price:amount", strconv.Itoa(listing.Price)},
+		PreviewMeta{"og:price:currency", preview.Currency},
+		PreviewMeta{"twitter:card", card},
+		PreviewMeta{"twitter:title", preview.Title},
+		PreviewMeta{"twitter:description", preview.Description},
+	)
+	if preview.Image != "" {
+		preview.Meta = append(preview.Meta, PreviewMeta{"twitter:image", preview.Image})
+	}
+
+	return preview
+}
+
+// primary photo of the listing, else its first one, nil without photos
+func primaryPhoto(media *ListingMedia) *Media {
+	if media == nil || len(media.Photos) == 0 {
+		return nil
+	}
+
+	for i := range media.Photos {
+		if media.Photos[i].IsPrimary {
+			return &media.Photos[i]
+		}
+	}
+	return &media.Photos[0]
+}
+
+// u prefixed with baseURL unless it already has a scheme
+func absoluteURL(u, baseURL string) string {
+	if strings.Contains(u, "://") {
+		return u
+	}
+	if !strings.HasPrefix(u, "/") {
+		u = "/" + u
+	}
+	return baseURL + u
+}
+
+// n with comma separated thousands, e.g. 1,200,000
+func formatThousands(n int) string {
+	if n < 0 {
+		return "-" + formatThousands(-n)
+	}
+	s := strconv.Itoa(n)
+
+	var b strings.Builder
+	for i, digit := range s {
+		if i > 0 && (len(s)-i)%3 == 0 {
+			b.WriteByte(',')
+		}
+		b.WriteRune(digit)
+	}
+	return b.String()
+}
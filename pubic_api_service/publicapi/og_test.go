@@ -0,0 +1,66 @@
+package publicapi
+
+import "testing"
+
+func TestListingPreview(t *testing.T) {
+	previous := listingPageURL
+	listingPageURL = "/listings/{id}"
+	defer func() { listingPageURL = previous }()
+
+	listing := &ListingCreate{
+		ID:          7,
+		ListingType: "rent",
+		Price:       12500,
+		Region:      "Bishan",
+		Area:        85.5,
+		Media: &ListingMedia{Photos: []Media{
+			{URL: "/public-api/media/photos/7-1.jpg"},
+			{URL: "/public-api/media/photos/7-2.jpg", IsPrimary: true},
+		}},
+	}
+
+	preview := listingPreview(listing, "https://99.co")
+	if preview.Title != "For rent: SGD 12,500/month in Bishan" {
+		t.Errorf("title %q", preview.Title)
+	}
+	if preview.Description != "Bishan · 85.5 m² · Listed on 99.co" {
+		t.Errorf("description %q", preview.Description)
+	}
+	if preview.URL != "https://99.co/listings/7" {
+		t.Errorf("url %q", preview.URL)
+	}
+	if preview.Image != "https://99.co/public-api/media/photos/7-2.jpg" {
+		t.Errorf("image %q, want the primary photo", preview.Image)
+	}
+
+	tags := map[string]string{}
+	for _, meta := range preview.Meta {
+		tags[meta.Property] = meta.Content
+	}
+	for property, want := range map[string]string{
+		"og:image":            preview.Image,
+		"og:price:amount":     "12500",
+		"og:price:currency":   "SGD",
+		"twitter:card":        "summary_large_image",
+		"twitter:image":       preview.Image,
+		"twitter:title":       preview.Title,
+		"og:url":              preview.URL,
+		"og:site_name":        "99.co",
+		"twitter:description": preview.Description,
+	} {
+		if tags[property] != want {
+			t.Errorf("%s = %q, want %q", property, tags[property], want)
+		}
+	}
+
+	// without photos there is no image and the card is the small one
+	preview = listingPreview(&ListingCreate{ID: 8, ListingType: "sale", Price: 1200000}, "https://99.co")
+	if preview.Title != "For sale: SGD 1,200,000" || preview.Image != "" {
+		t.Errorf("preview %+v, want a sale without image", preview)
+	}
+	for _, meta := range preview.Meta {
+		if meta.Property == "twitter:card" && meta.Content != "summary" {
+			t.Errorf("twitter:card %q, want summary", meta.Content)
+		}
+	}
+}
@@ -0,0 +1,201 @@
+package publicapi
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strings"
+
+	"apperror"
+
+	"github.com/gin-gonic/gin"
+)
+
+// event type to channel to enabled of a user, every event of notificationEvents and channel of notificationChannels is listed
+type NotificationPreferences struct {
+	UserID      int                        `json:"user_id"`
+	Preferences map[string]map[string]bool `json:"preferences"`
+	UpdatedAt   int64                      `json:"updated_at"`
+	// the address of the user bounced or complained, no email is sent whatever the toggles
+	EmailSuppressed bool `json:"email_suppressed"`
+}
+
+// toggles to change, events and channels left out keep their value
+type NotificationPreferencesUpdate struct {
+	Preferences map[string]map[string]bool `json:"preferences" binding:"required"`
+}
+
+type NotificationPreferencesResponse struct {
+	Result      bool `json:"result"`
+	Preferences NotificationPreferences
+}
+
+var ErrNotificationPreferencesInvalid = apperror.Validation("preferences must map events of " + strings.Join(notificationEvents, ", ") +
+	" to channels of " + strings.Join(notificationChannels, ", "))
+
+// =========== INTERFACE HANDLER, HANDLING REQUEST RESPONSE API DEPEND INTERFACE ===========
+
+func getMyNotificationPreferencesHandler(c *gin.Context) {
+	res, err := getNotificationPreferencesUsecase(c.Request.Context(), authUserID(c))
+	if err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"notification_preferences": res})
+}
+
+func updateMyNotificationPreferencesHandler(c *gin.Context) {
+	var body NotificationPreferencesUpdate
+	if err := c.ShouldBindJSON(&body); err != nil {
+		slog.ErrorContext(c.Request.Context(), "handler error", "code", "317", "error", err)
+		apperror.RespondBinding(c, err)
+		return
+	}
+
+	res, err := updateNotificationPreferencesUsecase(c.Request.Context(), authUserID(c), body)
+	if err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"notification_preferences": res})
+}
+
+// =========== USECASE LAYER, SERVES AS AN INTERMEDIARY BETWEEN THE PRESENTATION LAYER AND THE DATA LAYER ===========
+
+func getNotificationPreferencesUsecase(ctx context.Context, userID int) (*NotificationPreferences, error) {
+	res, err := userClient.FindNotificationPreferences(ctx, userID)
+	if err != nil {
+		if errors.Is(err, ErrUserNotFound) {
+			return nil, err
+		}
+		return nil, apperror.Upstream("Failed to get notification preferences", err)
+	}
+
+	return &res.Preferences, nil
+}
+
+func updateNotificationPreferencesUsecase(ctx context.Context, userID int, update NotificationPreferencesUpdate) (*NotificationPreferences, error) {
+	toggles := 0
+	for event, channels := range update.Preferences {
+		if !slices.Contains(notificationEvents, event) {
+			return nil, ErrNotificationPreferencesInvalid
+		}
+		for channel := range channels {
+			if !slices.Contains(notificationChannels, channel) {
+				return nil, ErrNotificationPreferencesInvalid
+			}
+			toggles++
+		}
+	}
+	if toggles == 0 {
+		return nil, ErrNotificationPreferencesInvalid
+	}
+
+	updateJSON, err := json.Marshal(update)
+	if err != nil {
+		slog.ErrorContext(ctx, "usecase error", "code", "318", "error", err)
+		return nil, err
+	}
+
+	res, err := userClient.UpdateNotificationPreferences(ctx, userID, updateJSON)
+	if err != nil {
+		if errors.Is(err, ErrUserNotFound) || errors.Is(err, ErrNotificationPreferencesInvalid) {
+			return nil, err
+		}
+		return nil, apperror.Upstream("Failed to update notification preferences", err)
+	}
+
+	return &res.Preferences, nil
+}
+
+// enabled channels of the event of n for its user, in the order of notificationChannels
+func notificationChannelsOf(ctx context.Context, n Notification) ([]string, error) {
+	res, err := userClient.FindNotificationPreferences(ctx, n.UserID)
+	if err != nil {
+		return nil, err
+	}
+
+	var channels []string
+	for _, channel := range notificationChannels {
+		if channel == "email" && res.Preferences.EmailSuppressed {
+			continue
+		}
+		if res.Preferences.Preferences[n.Event][channel] {
+			channels = append(channels, channel)
+		}
+	}
+	return channels, nil
+}
+
+// =========== REPOSITORY LAYER, ABSTRACTION OVER THE DATA PERSISTENCE (databases, file systems, or external APIs) ===========
+
+// user service api path
+var apiPathUserNotificationPreferences = userServiceURL + "/users/%d/notification-preferences"
+
+func (httpUserClient) FindNotificationPreferences(ctx context.Context, userID int) (*NotificationPreferencesResponse, error) {
+	resp, err := httpGet(ctx, fmt.Sprintf(apiPathUserNotificationPreferences, userID))
+	if err != nil {
+		slog.ErrorContext(ctx, "service error", "code", "319", "error", err)
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		return nil, ErrUserNotFound
+	default:
+		slog.ErrorContext(ctx, "service error", "code", "320", "error", "error fetching notification preferences from user service")
+		return nil, errors.New("error fetching notification preferences from user service")
+	}
+
+	var preferences NotificationPreferencesResponse
+	if err := decodeJSON(resp.Body, &preferences); err != nil {
+		slog.ErrorContext(ctx, "service error", "code", "321", "error", err)
+		return nil, err
+	}
+
+	return &preferences, nil
+}
+
+func (httpUserClient) UpdateNotificationPreferences(ctx context.Context, userID int, preferencesByte []byte) (*NotificationPreferencesResponse, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, fmt.Sprintf(apiPathUserNotificationPreferences, userID), bytes.NewBuffer(preferencesByte))
+	if err != nil {
+		slog.ErrorContext(ctx, "service error", "code", "322", "error", err)
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		slog.ErrorContext(ctx, "service error", "code", "323", "error", err)
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		return nil, ErrUserNotFound
+	case http.StatusBadRequest:
+		return nil, ErrNotificationPreferencesInvalid
+	default:
+		slog.ErrorContext(ctx, "service error", "code", "324", "error", "error updating notification preferences from user service")
+		return nil, errors.New("error updating notification preferences from user service")
+	}
+
+	var preferences NotificationPreferencesResponse
+	if err := decodeJSON(resp.Body, &preferences); err != nil {
+		slog.ErrorContext(ctx, "service error", "code", "325", "error", err)
+		return nil, err
+	}
+
+	return &preferences, nil
+}
@@ -0,0 +1,69 @@
+package publicapi
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+// user client answering the notification preferences of users, everything enabled for users left out
+type preferencesUserClient struct {
+	UserClient
+	preferences map[int]map[string]map[string]bool
+}
+
+func (c preferencesUserClient) FindNotificationPreferences(ctx context.Context, userID int) (*NotificationPreferencesResponse, error) {
+	preferences, ok := c.preferences[userID]
+	if !ok {
+		preferences = make(map[string]map[string]bool)
+		for _, event := range notificationEvents {
+			preferences[event] = map[string]bool{"email": true, "push": true, "in_app": true}
+		}
+	}
+
+	return &NotificationPreferencesResponse{Result: true, Preferences: NotificationPreferences{UserID: userID, Preferences: preferences}}, nil
+}
+
+// notifications kept in the inbox are dropped
+func (preferencesUserClient) CreateInboxNotification(ctx context.Context, userID int, notificationByte []byte) (*InboxNotificationResponse, error) {
+	return &InboxNotificationResponse{Result: true}, nil
+}
+
+func TestNotifyPreferences(t *testing.T) {
+	notifications := newNotificationRecorder(t)
+	userClient = preferencesUserClient{preferences: map[int]map[string]map[string]bool{
+		1: {notificationOfferReceived: {"email": false, "push": false, "in_app": false}},
+		2: {notificationOfferReceived: {"email": true, "push": false, "in_app": true}},
+	}}
+
+	ctx := context.Background()
+	for _, userID := range []int{1, 2, 3} {
+		notify(ctx, Notification{Event: notificationOfferReceived, UserID: userID, ListingID: 5})
+	}
+
+	got := notifications()
+	if len(got) != 2 || got[0].UserID != 2 || got[1].UserID != 3 {
+		t.Fatalf("notified %+v, want users 2 and 3, user 1 muted offers", got)
+	}
+	if !reflect.DeepEqual(got[0].Channels, []string{"email"}) {
+		t.Errorf("channels of user 2 = %v, want [email]", got[0].Channels)
+	}
+	if !reflect.DeepEqual(got[1].Channels, []string{"email", "push"}) {
+		t.Errorf("channels of user 3 = %v, want [email push]", got[1].Channels)
+	}
+}
+
+func TestUpdateNotificationPreferencesInvalid(t *testing.T) {
+	for _, preferences := range []map[string]map[string]bool{
+		{},
+		{notificationOfferReceived: {}},
+		{"listing_sold": {"email": false}},
+		{notificationViewingReminder: {"sms": true}},
+	} {
+		_, err := updateNotificationPreferencesUsecase(context.Background(), 1, NotificationPreferencesUpdate{Preferences: preferences})
+		if !errors.Is(err, ErrNotificationPreferencesInvalid) {
+			t.Errorf("update %v: %v, want ErrNotificationPreferencesInvalid", preferences, err)
+		}
+	}
+}
@@ -0,0 +1,78 @@
+package publicapi
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+
+	"apperror"
+
+	"github.com/gin-gonic/gin"
+)
+
+// price a listing was created or updated with, previous_price is nil for the price it was created with
+type PriceChange struct {
+	Price         int    `json:"price"`
+	Currency      string `json:"currency"`
+	PreviousPrice *int   `json:"previous_price"`
+	ChangedAt     int64  `json:"changed_at"`
+}
+
+type PriceHistoryResponse struct {
+	Result       bool          `json:"result"`
+	PriceHistory []PriceChange `json:"price_history"`
+}
+
+// =========== INTERFACE HANDLER, HANDLING REQUEST RESPONSE API DEPEND INTERFACE ===========
+
+// prices of a listing oldest first, so buyers see whether it dropped over time
+func getListingPriceHistoryHandler(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "handler error", "code", "381", "error", err)
+		apperror.JSON(c, http.StatusBadRequest, "Invalid listing ID")
+		return
+	}
+
+	res, err := getListingPriceHistoryService(c.Request.Context(), id)
+	if err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"price_history": res.PriceHistory})
+}
+
+// =========== REPOSITORY LAYER, ABSTRACTION OVER THE DATA PERSISTENCE (databases, file systems, or external APIs) ===========
+
+// listing service api path
+var apiPathListingPriceHistory = listingServiceURL + "/listings/%d/price-history"
+
+func getListingPriceHistoryService(ctx context.Context, listingID int) (*PriceHistoryResponse, error) {
+	resp, err := httpGet(ctx, fmt.Sprintf(apiPathListingPriceHistory, listingID))
+	if err != nil {
+		slog.ErrorContext(ctx, "service error", "code", "382", "error", err)
+		return nil, apperror.Upstream("Failed to get price history", err)
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		return nil, errListingNotFound
+	default:
+		slog.ErrorContext(ctx, "service error", "code", "383", "error", "error fetching price history from listing service")
+		return nil, apperror.Upstream("Failed to get price history", errors.New("error fetching price history from listing service"))
+	}
+
+	var history PriceHistoryResponse
+	if err := decodeJSON(resp.Body, &history); err != nil {
+		slog.ErrorContext(ctx, "service error", "code", "384", "error", err)
+		return nil, apperror.Upstream("Failed to get price history", err)
+	}
+
+	return &history, nil
+}
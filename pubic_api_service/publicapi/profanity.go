@@ -0,0 +1,97 @@
+package publicapi
+
+import (
+	"log/slog"
+	"strings"
+	"unicode"
+
+	"github.com/gin-gonic/gin"
+)
+
+// =========== USECASE LAYER, MASK PROFANITY IN USER GENERATED TEXT ===========
+
+// word lists per locale, the default locale list is applied on every text
+type profanityFilter struct {
+	words         map[string]map[string]bool
+	defaultLocale string
+}
+
+// PROFANITY_LOCALES comma separated locales, each with a comma separated list on PROFANITY_WORDS_<LOCALE>
+// PROFANITY_DEFAULT_LOCALE locale applied besides the client locale
+var profanity = newProfanityFilterFromConfig()
+
+func newProfanityFilterFromConfig() *profanityFilter {
+	filter := &profanityFilter{
+		words:         map[string]map[string]bool{},
+		defaultLocale: strings.ToLower(cfg.String("PROFANITY_DEFAULT_LOCALE", "en")),
+	}
+
+	for _, locale := range cfg.List("PROFANITY_LOCALES") {
+		locale = strings.ToLower(locale)
+		words := map[string]bool{}
+		for _, word := range cfg.List("PROFANITY_WORDS_" + strings.ToUpper(locale)) {
+			words[strings.ToLower(word)] = true
+		}
+		filter.words[locale] = words
+	}
+
+	return filter
+}
+
+// replace every letter of listed words with * and return the masked words
+func (f *profanityFilter) Mask(text, locale string) (string, []string) {
+	lists := []map[string]bool{f.words[f.defaultLocale]}
+	if locale != f.defaultLocale {
+		lists = append(lists, f.words[locale])
+	}
+
+	runes := []rune(text)
+	var found []string
+	for start := 0; start < len(runes); {
+		if !unicode.IsLetter(runes[start]) {
+			start++
+			continue
+		}
+
+		end := start
+		for end < len(runes) && unicode.IsLetter(runes[end]) {
+			end++
+		}
+
+		word := strings.ToLower(string(runes[start:end]))
+		for _, list := range lists {
+			if list[word] {
+				found = append(found, word)
+				for i := start; i < end; i++ {
+					runes[i] = '*'
+				}
+				break
+			}
+		}
+		start = end
+	}
+
+	return string(runes), found
+}
+
+// mask profanity of one field and log the filtered terms for review
+func maskProfanity(field, text, locale string) string {
+	if locale == "" {
+		locale = profanity.defaultLocale
+	}
+
+	masked, found := profanity.Mask(text, locale)
+	if len(found) > 0 {
+		slog.Info("profanity filtered", "field", field, "locale", locale, "terms", found)
+	}
+
+	return masked
+}
+
+// primary language of the first Accept-Language tag, e.g. id for id-ID,en;q=0.8
+func requestLocale(c *gin.Context) string {
+	tag := strings.Split(c.GetHeader("Accept-Language"), ",")[0]
+	tag = strings.Split(strings.Split(tag, ";")[0], "-")[0]
+
+	return strings.ToLower(strings.TrimSpace(tag))
+}
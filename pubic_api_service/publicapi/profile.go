@@ -0,0 +1,233 @@
+package publicapi
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+
+	"apperror"
+
+	"github.com/gin-gonic/gin"
+)
+
+// what the public profile of a user shows, the name is always public
+type PrivacySettings struct {
+	UserID int `json:"user_id"`
+	// false hides the whole profile
+	ProfileVisible   bool  `json:"profile_visible"`
+	ShowMemberSince  bool  `json:"show_member_since"`
+	ShowListingCount bool  `json:"show_listing_count"`
+	UpdatedAt        int64 `json:"updated_at"`
+}
+
+// unset fields keep their current value
+type PrivacyUpdate struct {
+	ProfileVisible   *bool `json:"profile_visible"`
+	ShowMemberSince  *bool `json:"show_member_since"`
+	ShowListingCount *bool `json:"show_listing_count"`
+}
+
+type PrivacyResponse struct {
+	Result  bool `json:"result"`
+	Privacy PrivacySettings
+}
+
+// public-safe view of a user, fields hidden by the privacy settings are left out
+type Profile struct {
+	ID           int    `json:"id"`
+	Name         string `json:"name"`
+	MemberSince  *int64 `json:"member_since,omitempty"`
+	ListingCount *int   `json:"listing_count,omitempty"`
+}
+
+var ErrPrivacyUpdateEmpty = apperror.Validation("nothing to update, set profile_visible, show_member_since or show_listing_count")
+
+// =========== INTERFACE HANDLER, HANDLING REQUEST RESPONSE API DEPEND INTERFACE ===========
+
+// public profile of any user, 404 when the user hides it so hidden and missing users look the same
+func getUserProfileHandler(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "handler error", "code", "243", "error", err)
+		apperror.JSON(c, http.StatusBadRequest, "Invalid user ID")
+		return
+	}
+
+	res, err := getUserProfileUsecase(c.Request.Context(), id)
+	if err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"profile": res})
+}
+
+func getMyPrivacyHandler(c *gin.Context) {
+	res, err := getPrivacyUsecase(c.Request.Context(), authUserID(c))
+	if err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"privacy": res})
+}
+
+func updateMyPrivacyHandler(c *gin.Context) {
+	var body PrivacyUpdate
+	if err := c.ShouldBindJSON(&body); err != nil {
+		slog.ErrorContext(c.Request.Context(), "handler error", "code", "244", "error", err)
+		apperror.RespondBinding(c, err)
+		return
+	}
+
+	res, err := updatePrivacyUsecase(c.Request.Context(), authUserID(c), body)
+	if err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"privacy": res})
+}
+
+// =========== USECASE LAYER, SERVES AS AN INTERMEDIARY BETWEEN THE PRESENTATION LAYER AND THE DATA LAYER ===========
+
+// name of the user with the fields the user allows to show, the listing count excludes deleted listings
+func getUserProfileUsecase(ctx context.Context, userID int) (*Profile, error) {
+	// privacy first, it answers ErrUserNotFound for missing users on every transport
+	privacy, err := getPrivacyUsecase(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if !privacy.ProfileVisible {
+		return nil, ErrUserNotFound
+	}
+
+	user, err := userClient.FindUser(ctx, userID)
+	if err != nil {
+		if errors.Is(err, ErrUserNotFound) {
+			return nil, err
+		}
+		return nil, apperror.Upstream("Failed to get user", err)
+	}
+
+	profile := &Profile{ID: user.User.ID, Name: user.User.Name}
+	if privacy.ShowMemberSince {
+		profile.MemberSince = &user.User.CreatedAt
+	}
+	if privacy.ShowListingCount {
+		// one listing page is enough, only the total of the pagination is used
+		res, err := fetchListingsService(ctx, strconv.Itoa(userID), "", 1, 1, "", "")
+		if err != nil {
+			return nil, apperror.Upstream("Failed to get listings", err)
+		}
+		profile.ListingCount = &res.Pagination.TotalItems
+	}
+
+	return profile, nil
+}
+
+func getPrivacyUsecase(ctx context.Context, userID int) (*PrivacySettings, error) {
+	res, err := userClient.FindUserPrivacy(ctx, userID)
+	if err != nil {
+		if errors.Is(err, ErrUserNotFound) {
+			return nil, err
+		}
+		return nil, apperror.Upstream("Failed to get privacy settings", err)
+	}
+
+	return &res.Privacy, nil
+}
+
+func updatePrivacyUsecase(ctx context.Context, userID int, update PrivacyUpdate) (*PrivacySettings, error) {
+	if update.ProfileVisible == nil && update.ShowMemberSince == nil && update.ShowListingCount == nil {
+		return nil, ErrPrivacyUpdateEmpty
+	}
+
+	updateJSON, err := json.Marshal(update)
+	if err != nil {
+		slog.ErrorContext(ctx, "usecase error", "code", "245", "error", err)
+		return nil, err
+	}
+
+	res, err := userClient.UpdateUserPrivacy(ctx, userID, updateJSON)
+	if err != nil {
+		if errors.Is(err, ErrUserNotFound) || errors.Is(err, ErrPrivacyUpdateEmpty) {
+			return nil, err
+		}
+		return nil, apperror.Upstream("Failed to update privacy settings", err)
+	}
+
+	return &res.Privacy, nil
+}
+
+// =========== REPOSITORY LAYER, ABSTRACTION OVER THE DATA PERSISTENCE (databases, file systems, or external APIs) ===========
+
+// user service api path
+var apiPathUserPrivacy = userServiceURL + "/users/%d/privacy"
+
+func (httpUserClient) FindUserPrivacy(ctx context.Context, userID int) (*PrivacyResponse, error) {
+	resp, err := httpGet(ctx, fmt.Sprintf(apiPathUserPrivacy, userID))
+	if err != nil {
+		slog.ErrorContext(ctx, "service error", "code", "246", "error", err)
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		return nil, ErrUserNotFound
+	default:
+		slog.ErrorContext(ctx, "service error", "code", "247", "error", "error fetching privacy settings from user service")
+		return nil, errors.New("error fetching privacy settings from user service")
+	}
+
+	var privacy PrivacyResponse
+	if err := decodeJSON(resp.Body, &privacy); err != nil {
+		slog.ErrorContext(ctx, "service error", "code", "248", "error", err)
+		return nil, err
+	}
+
+	return &privacy, nil
+}
+
+func (httpUserClient) UpdateUserPrivacy(ctx context.Context, userID int, privacyByte []byte) (*PrivacyResponse, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPatch, fmt.Sprintf(apiPathUserPrivacy, userID), bytes.NewBuffer(privacyByte))
+	if err != nil {
+		slog.ErrorContext(ctx, "service error", "code", "249", "error", err)
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		slog.ErrorContext(ctx, "service error", "code", "250", "error", err)
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		return nil, ErrUserNotFound
+	case http.StatusBadRequest:
+		return nil, ErrPrivacyUpdateEmpty
+	default:
+		slog.ErrorContext(ctx, "service error", "code", "251", "error", "error updating privacy settings from user service")
+		return nil, errors.New("error updating privacy settings from user service")
+	}
+
+	var privacy PrivacyResponse
+	if err := decodeJSON(resp.Body, &privacy); err != nil {
+		slog.ErrorContext(ctx, "service error", "code", "252", "error", err)
+		return nil, err
+	}
+
+	return &privacy, nil
+}
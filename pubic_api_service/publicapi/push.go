@@ -0,0 +1,404 @@
+package publicapi
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+)
+
+// =========== REPOSITORY LAYER, PUSH NOTIFICATIONS SENT TO THE DEVICES OF A USER THROUGH FCM AND APNS ===========
+
+// message of a notification pushed to the devices of its user
+type pushMessage struct {
+	Title string
+	Body  string
+	// event and ids of the notification, for the app to open the right screen
+	Data map[string]string
+}
+
+// pushSender deliver a message to one device token of its platform, the error wraps errPushTokenInvalid when
+// the platform rejected the token for good
+type pushSender interface {
+	Send(ctx context.Context, token string, msg pushMessage) error
+}
+
+var errPushTokenInvalid = errors.New("push token rejected")
+
+// PUSH_TIMEOUT max duration of one call to fcm or apns
+var pushClient = &http.Client{
+	Timeout:   cfg.Duration("PUSH_TIMEOUT", 5*time.Second),
+	Transport: otelhttp.NewTransport(http.DefaultTransport),
+}
+
+// platform to sender of the configured platforms, set by Run, devices of other platforms are not pushed to
+var pushSenders = map[string]pushSender{}
+
+// senders of the platforms configured, exit on a credential that can not be loaded
+func newPushSenders() map[string]pushSender {
+	senders := map[string]pushSender{}
+
+	// PUSH_FCM_CREDENTIALS_FILE service account json of the firebase project, empty disables fcm
+	if path := cfg.String("PUSH_FCM_CREDENTIALS_FILE", ""); path != "" {
+		sender, err := newFCMSender(path)
+		if err != nil {
+			log.Fatalf("PUSH_FCM_CREDENTIALS_FILE: %v", err)
+		}
+		senders["fcm"] = sender
+	}
+
+	// PUSH_APNS_KEY_FILE .p8 token signing key of the apple developer account, empty disables apns
+	// PUSH_APNS_KEY_ID, PUSH_APNS_TEAM_ID id of the key and of the team owning it
+	// PUSH_APNS_TOPIC bundle id of the app
+	// PUSH_APNS_SANDBOX push through the development environment of apns
+	if path := cfg.String("PUSH_APNS_KEY_FILE", ""); path != "" {
+		endpoint := "https://api.push.apple.com"
+		if cfg.Bool("PUSH_APNS_SANDBOX", false) {
+			endpoint = "https://api.sandbox.push.apple.com"
+		}
+		sender, err := newAPNsSender(path, cfg.String("PUSH_APNS_KEY_ID", ""), cfg.String("PUSH_APNS_TEAM_ID", ""), cfg.String("PUSH_APNS_TOPIC", ""), endpoint)
+		if err != nil {
+			log.Fatalf("PUSH_APNS_KEY_FILE: %v", err)
+		}
+		senders["apns"] = sender
+	}
+
+	for platform := range senders {
+		slog.Info("push platform", "platform", platform)
+	}
+	return senders
+}
+
+// pushNotification send n to every valid device of its user on a configured platform and record a receipt of each,
+// devices whose token was rejected are invalidated by the user service
+func pushNotification(ctx context.Context, n Notification) {
+	res, err := userClient.FindUserDevices(ctx, n.UserID)
+	if err != nil {
+		slog.ErrorContext(ctx, "service error", "code", "363", "error", err, "event", n.Event, "user_id", n.UserID)
+		return
+	}
+
+	msg := newPushMessage(ctx, n, "push")
+	var receipts []PushReceipt
+	for _, device := range res.Devices {
+		sender, ok := pushSenders[device.Platform]
+		if !ok || device.InvalidatedAt != nil {
+			continue
+		}
+
+		receipt := PushReceipt{DeviceID: device.ID, Event: n.Event, Status: "delivered"}
+		if err := sender.Send(ctx, device.Token, msg); err != nil {
+			receipt.Status, receipt.Error = "failed", err.Error()
+			if errors.Is(err, errPushTokenInvalid) {
+				receipt.Status = "invalid"
+			}
+		}
+		pushesTotal.WithLabelValues(device.Platform, receipt.Status).Inc()
+		receipts = append(receipts, receipt)
+	}
+	if len(receipts) == 0 {
+		return
+	}
+
+	receiptsJSON, err := json.Marshal(map[string][]PushReceipt{"receipts": receipts})
+	if err == nil {
+		err = userClient.RecordPushReceipts(ctx, receiptsJSON)
+	}
+	if err != nil {
+		slog.ErrorContext(ctx, "service error", "code", "364", "error", err, "event", n.Event, "user_id", n.UserID)
+	}
+}
+
+// short text of n for the lock screen or the inbox of channel, rendered with the template of its event
+func newPushMessage(ctx context.Context, n Notification, channel string) pushMessage {
+	title, body := renderNotification(ctx, n, channel)
+
+	data := map[string]string{"event": n.Event}
+	for key, id := range map[string]int{"listing_id": n.ListingID, "offer_id": n.OfferID, "viewing_id": n.ViewingID, "broadcast_id": n.BroadcastID} {
+		if id != 0 {
+			data[key] = strconv.Itoa(id)
+		}
+	}
+
+	return pushMessage{Title: title, Body: body, Data: data}
+}
+
+// fcm http v1 api of one firebase project, authorized with oauth tokens of its service account
+type fcmSender struct {
+	// base url of the api, https://fcm.googleapis.com
+	endpoint  string
+	projectID string
+	tokens    *googleTokenSource
+}
+
+func newFCMSender(credentialsPath string) (*fcmSender, error) {
+	content, err := os.ReadFile(credentialsPath)
+	if err != nil {
+		return nil, err
+	}
+
+	var credentials struct {
+		ProjectID   string `json:"project_id"`
+		ClientEmail string `json:"client_email"`
+		PrivateKey  string `json:"private_key"`
+		TokenURI    string `json:"token_uri"`
+	}
+	if err := json.Unmarshal(content, &credentials); err != nil {
+		return nil, err
+	}
+	if credentials.ProjectID == "" || credentials.ClientEmail == "" || credentials.TokenURI == "" {
+		return nil, errors.New("not a service account, project_id, client_email or token_uri missing")
+	}
+
+	key, err := jwt.ParseRSAPrivateKeyFromPEM([]byte(credentials.PrivateKey))
+	if err != nil {
+		return nil, err
+	}
+
+	return &fcmSender{
+		endpoint:  "https://fcm.googleapis.com",
+		projectID: credentials.ProjectID,
+		tokens:    &googleTokenSource{email: credentials.ClientEmail, key: key, tokenURI: credentials.TokenURI},
+	}, nil
+}
+
+func (s *fcmSender) Send(ctx context.Context, token string, msg pushMessage) error {
+	accessToken, err := s.tokens.token(ctx)
+	if err != nil {
+		return err
+	}
+
+	body, err := json.Marshal(map[string]any{
+		"message": map[string]any{
+			"token":        token,
+			"notification": map[string]string{"title": msg.Title, "body": msg.Body},
+			"data":         msg.Data,
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.endpoint+"/v1/projects/"+url.PathEscape(s.projectID)+"/messages:send", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+accessToken)
+
+	resp, err := pushClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusOK {
+		return nil
+	}
+
+	var reply struct {
+		Error struct {
+			Status  string `json:"status"`
+			Message string `json:"message"`
+			Details []struct {
+				ErrorCode string `json:"errorCode"`
+			} `json:"details"`
+		} `json:"error"`
+	}
+	json.NewDecoder(io.LimitReader(resp.Body, 64<<10)).Decode(&reply)
+
+	reason := reply.Error.Status
+	for _, detail := range reply.Error.Details {
+		if detail.ErrorCode != "" {
+			reason = detail.ErrorCode
+		}
+	}
+	// the app was uninstalled or the token belongs to another firebase project
+	if reason == "UNREGISTERED" || reason == "SENDER_ID_MISMATCH" {
+		return fmt.Errorf("%w: fcm %s", errPushTokenInvalid, reason)
+	}
+	return fmt.Errorf("fcm answered %d %s: %s", resp.StatusCode, reason, reply.Error.Message)
+}
+
+// oauth access tokens of a google service account, from a signed jwt assertion and kept until shortly before expiry
+type googleTokenSource struct {
+	email    string
+	key      *rsa.PrivateKey
+	tokenURI string
+
+	mu        sync.Mutex
+	current   string
+	expiresAt time.Time
+}
+
+func (s *googleTokenSource) token(ctx context.Context) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.current != "" && time.Now().Before(s.expiresAt) {
+		return s.current, nil
+	}
+
+	now := time.Now()
+	assertion, err := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims{
+		"iss":   s.email,
+		"scope": "https://www.googleapis.com/auth/firebase.messaging",
+		"aud":   s.tokenURI,
+		"iat":   now.Unix(),
+		"exp":   now.Add(time.Hour).Unix(),
+	}).SignedString(s.key)
+	if err != nil {
+		return "", err
+	}
+
+	form := url.Values{"grant_type": {"urn:ietf:params:oauth:grant-type:jwt-bearer"}, "assertion": {assertion}}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.tokenURI, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := pushClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("google token endpoint answered %d", resp.StatusCode)
+	}
+
+	var reply struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int    `json:"expires_in"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&reply); err != nil {
+		return "", err
+	}
+	if reply.AccessToken == "" {
+		return "", errors.New("google token endpoint answered no access token")
+	}
+
+	// a minute of margin so a token never expires in flight
+	s.current, s.expiresAt = reply.AccessToken, now.Add(time.Duration(reply.ExpiresIn)*time.Second-time.Minute)
+	return s.current, nil
+}
+
+// apns provider api of one app, authorized with jwt signed by the .p8 key
+type apnsSender struct {
+	// base url of the api, production or sandbox
+	endpoint string
+	topic    string
+	keyID    string
+	teamID   string
+	key      *ecdsa.PrivateKey
+
+	mu       sync.Mutex
+	current  string
+	issuedAt time.Time
+}
+
+func newAPNsSender(keyPath, keyID, teamID, topic, endpoint string) (*apnsSender, error) {
+	if keyID == "" || teamID == "" || topic == "" {
+		return nil, errors.New("PUSH_APNS_KEY_ID, PUSH_APNS_TEAM_ID and PUSH_APNS_TOPIC are required")
+	}
+
+	content, err := os.ReadFile(keyPath)
+	if err != nil {
+		return nil, err
+	}
+	key, err := jwt.ParseECPrivateKeyFromPEM(content)
+	if err != nil {
+		return nil, err
+	}
+
+	return &apnsSender{endpoint: endpoint, topic: topic, keyID: keyID, teamID: teamID, key: key}, nil
+}
+
+// provider token, apns wants it refreshed between 20 and 60 minutes
+func (s *apnsSender) token() (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.current != "" && time.Since(s.issuedAt) < 50*time.Minute {
+		return s.current, nil
+	}
+
+	now := time.Now()
+	token := jwt.NewWithClaims(jwt.SigningMethodES256, jwt.MapClaims{"iss": s.teamID, "iat": now.Unix()})
+	token.Header["kid"] = s.keyID
+	signed, err := token.SignedString(s.key)
+	if err != nil {
+		return "", err
+	}
+
+	s.current, s.issuedAt = signed, now
+	return signed, nil
+}
+
+func (s *apnsSender) Send(ctx context.Context, token string, msg pushMessage) error {
+	providerToken, err := s.token()
+	if err != nil {
+		return err
+	}
+
+	payload := map[string]any{
+		"aps": map[string]any{
+			"alert": map[string]string{"title": msg.Title, "body": msg.Body},
+			"sound": "default",
+		},
+	}
+	for key, value := range msg.Data {
+		payload[key] = value
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.endpoint+"/3/device/"+url.PathEscape(token), bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "bearer "+providerToken)
+	req.Header.Set("apns-topic", s.topic)
+	req.Header.Set("apns-push-type", "alert")
+	req.Header.Set("apns-priority", "10")
+
+	resp, err := pushClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusOK {
+		return nil
+	}
+
+	var reply struct {
+		Reason string `json:"reason"`
+	}
+	json.NewDecoder(io.LimitReader(resp.Body, 64<<10)).Decode(&reply)
+
+	// the app was uninstalled, or the token is malformed or of another app
+	if resp.StatusCode == http.StatusGone || reply.Reason == "BadDeviceToken" || reply.Reason == "DeviceTokenNotForTopic" {
+		return fmt.Errorf("%w: apns %s", errPushTokenInvalid, reply.Reason)
+	}
+	return fmt.Errorf("apns answered %d %s", resp.StatusCode, reply.Reason)
+}
@@ -0,0 +1,200 @@
+package publicapi
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sync"
+	"testing"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// user client answering fixed devices and keeping the receipts recorded
+type pushUserClient struct {
+	preferencesUserClient
+	devices []PushDevice
+
+	mu       *sync.Mutex
+	receipts *[]PushReceipt
+}
+
+func (c pushUserClient) FindUserDevices(ctx context.Context, userID int) (*PushDevicesResponse, error) {
+	return &PushDevicesResponse{Result: true, Devices: c.devices}, nil
+}
+
+func (c pushUserClient) RecordPushReceipts(ctx context.Context, receiptsByte []byte) error {
+	var body struct {
+		Receipts []PushReceipt `json:"receipts"`
+	}
+	if err := json.Unmarshal(receiptsByte, &body); err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	*c.receipts = append(*c.receipts, body.Receipts...)
+	return nil
+}
+
+// sender failing the tokens of its map with their error
+type fakePushSender struct {
+	mu   sync.Mutex
+	sent []string
+	errs map[string]error
+}
+
+func (s *fakePushSender) Send(ctx context.Context, token string, msg pushMessage) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sent = append(s.sent, token)
+	return s.errs[token]
+}
+
+func TestNotifyPush(t *testing.T) {
+	notifications := newNotificationRecorder(t)
+
+	invalidatedAt := int64(1)
+	var receipts []PushReceipt
+	userClient = pushUserClient{
+		devices: []PushDevice{
+			{ID: 1, Platform: "fcm", Token: "ok"},
+			{ID: 2, Platform: "fcm", Token: "gone"},
+			{ID: 3, Platform: "fcm", Token: "down"},
+			{ID: 4, Platform: "fcm", Token: "stale", InvalidatedAt: &invalidatedAt},
+			{ID: 5, Platform: "apns", Token: "unconfigured"},
+		},
+		mu:       &sync.Mutex{},
+		receipts: &receipts,
+	}
+
+	sender := &fakePushSender{errs: map[string]error{
+		"gone": errPushTokenInvalid,
+		"down": errors.New("fcm answered 503"),
+	}}
+	previous := pushSenders
+	pushSenders = map[string]pushSender{"fcm": sender}
+	t.Cleanup(func() { pushSenders = previous })
+
+	notify(context.Background(), Notification{Event: notificationOfferReceived, UserID: 1, ListingID: 5, Amount: 1000})
+
+	got := notifications()
+	if len(got) != 1 || !reflect.DeepEqual(got[0].Channels, []string{"email"}) {
+		t.Fatalf("webhook got %+v, want the notification without the push and in-app channels", got)
+	}
+	if !reflect.DeepEqual(sender.sent, []string{"ok", "gone", "down"}) {
+		t.Errorf("pushed to %v, want the valid fcm devices", sender.sent)
+	}
+
+	want := map[int]string{1: "delivered", 2: "invalid", 3: "failed"}
+	if len(receipts) != len(want) {
+		t.Fatalf("receipts %+v, want one per pushed device", receipts)
+	}
+	for _, receipt := range receipts {
+		if receipt.Status != want[receipt.DeviceID] || receipt.Event != notificationOfferReceived {
+			t.Errorf("receipt %+v, want status %s", receipt, want[receipt.DeviceID])
+		}
+	}
+}
+
+func TestFCMSender(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var tokenCalls int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/token":
+			tokenCalls++
+			assertion, err := jwt.Parse(r.FormValue("assertion"), func(*jwt.Token) (any, error) { return &key.PublicKey, nil })
+			if err != nil || !assertion.Valid {
+				t.Errorf("assertion: %v", err)
+			}
+			json.NewEncoder(w).Encode(map[string]any{"access_token": "access", "expires_in": 3600})
+		case "/v1/projects/project/messages:send":
+			if r.Header.Get("Authorization") != "Bearer access" {
+				t.Errorf("authorization %q", r.Header.Get("Authorization"))
+			}
+			var body struct {
+				Message struct {
+					Token string `json:"token"`
+				} `json:"message"`
+			}
+			json.NewDecoder(r.Body).Decode(&body)
+			if body.Message.Token == "gone" {
+				w.WriteHeader(http.StatusNotFound)
+				w.Write([]byte(`{"error":{"status":"NOT_FOUND","details":[{"errorCode":"UNREGISTERED"}]}}`))
+			}
+		default:
+			t.Errorf("unexpected call %s", r.URL.Path)
+		}
+	}))
+	defer server.Close()
+
+	sender := &fcmSender{
+		endpoint:  server.URL,
+		projectID: "project",
+		tokens:    &googleTokenSource{email: "push@project.iam.gserviceaccount.com", key: key, tokenURI: server.URL + "/token"},
+	}
+	msg := newPushMessage(context.Background(), Notification{Event: notificationOfferAccepted, ListingID: 5, OfferID: 7, Amount: 1000}, "push")
+
+	if err := sender.Send(context.Background(), "ok", msg); err != nil {
+		t.Fatalf("send: %v", err)
+	}
+	if err := sender.Send(context.Background(), "gone", msg); !errors.Is(err, errPushTokenInvalid) {
+		t.Errorf("send to an unregistered token: %v, want errPushTokenInvalid", err)
+	}
+	if tokenCalls != 1 {
+		t.Errorf("access token fetched %d times, want 1", tokenCalls)
+	}
+}
+
+func TestAPNsSender(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token, err := jwt.Parse(r.Header.Get("Authorization")[len("bearer "):], func(*jwt.Token) (any, error) { return &key.PublicKey, nil })
+		if err != nil || token.Header["kid"] != "key" {
+			t.Errorf("provider token: %v", err)
+		}
+		if r.Header.Get("apns-topic") != "com.example.app" {
+			t.Errorf("topic %q", r.Header.Get("apns-topic"))
+		}
+
+		switch r.URL.Path {
+		case "/3/device/ok":
+		case "/3/device/gone":
+			w.WriteHeader(http.StatusGone)
+			w.Write([]byte(`{"reason":"Unregistered"}`))
+		default:
+			w.WriteHeader(http.StatusServiceUnavailable)
+			w.Write([]byte(`{"reason":"ServiceUnavailable"}`))
+		}
+	}))
+	defer server.Close()
+
+	sender := &apnsSender{endpoint: server.URL, topic: "com.example.app", keyID: "key", teamID: "team", key: key}
+	msg := newPushMessage(context.Background(), Notification{Event: notificationViewingReminder, ListingID: 5, ViewingID: 3}, "push")
+
+	if err := sender.Send(context.Background(), "ok", msg); err != nil {
+		t.Fatalf("send: %v", err)
+	}
+	if err := sender.Send(context.Background(), "gone", msg); !errors.Is(err, errPushTokenInvalid) {
+		t.Errorf("send to an unregistered token: %v, want errPushTokenInvalid", err)
+	}
+	if err := sender.Send(context.Background(), "down", msg); err == nil || errors.Is(err, errPushTokenInvalid) {
+		t.Errorf("send while apns is down: %v, want a failure keeping the token", err)
+	}
+}
@@ -0,0 +1,171 @@
+package publicapi
+
+import (
+	"container/list"
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+
+	"apperror"
+
+	"github.com/gin-gonic/gin"
+	qrcode "github.com/skip2/go-qrcode"
+)
+
+var (
+	// QR_MAX_SIZE largest width in pixels a client may ask for
+	// QR_CACHE_SIZE generated images kept, least recently used are evicted first, 0 disables the cache
+	qrMaxSize = cfg.Int("QR_MAX_SIZE", 1024)
+	qrCache   = newQRCache(cfg.Int("QR_CACHE_SIZE", 1000))
+
+	// error correction levels by their usual letter, higher levels survive more damage but make denser codes
+	qrLevels = map[string]qrcode.RecoveryLevel{
+		"L": qrcode.Low,
+		"M": qrcode.Medium,
+		"Q": qrcode.High,
+		"H": qrcode.Highest,
+	}
+)
+
+const (
+	qrMinSize     = 64
+	qrDefaultSize = 256
+)
+
+// =========== INTERFACE HANDLER, HANDLING REQUEST RESPONSE API DEPEND INTERFACE ===========
+
+// png of a qr code of the share link of the caller for the listing
+func getListingQRCodeHandler(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "handler error", "code", "272", "error", err)
+		apperror.JSON(c, http.StatusBadRequest, "Invalid listing ID")
+		return
+	}
+
+	size, level, err := qrParams(c.DefaultQuery("size", strconv.Itoa(qrDefaultSize)), c.DefaultQuery("ec", "M"))
+	if err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+
+	res, err := getListingQRCodeUsecase(c.Request.Context(), id, authUserID(c), size, level)
+	if err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+
+	// the code of a user and listing never changes
+	c.Header("Cache-Control", "private, max-age=86400")
+	c.Data(http.StatusOK, "image/png", res)
+}
+
+// =========== USECASE LAYER, SERVES AS AN INTERMEDIARY BETWEEN THE PRESENTATION LAYER AND THE DATA LAYER ===========
+
+// size in pixels and error correction level of the query
+func qrParams(size, level string) (int, string, error) {
+	n, err := strconv.Atoi(size)
+	if err != nil || n < qrMinSize || n > qrMaxSize {
+		return 0, "", apperror.Validation(fmt.Sprintf("size must be between %d and %d", qrMinSize, qrMaxSize))
+	}
+
+	level = strings.ToUpper(level)
+	if _, ok := qrLevels[level]; !ok {
+		return 0, "", apperror.Validation("invalid ec, supported values: L, M, Q, H")
+	}
+
+	return n, level, nil
+}
+
+// qr code of the share link the user gets for the listing with utm_medium qr, the same link is reused by every
+// code of the user so its clicks add up
+func getListingQRCodeUsecase(ctx context.Context, listingID, userID, size int, level string) ([]byte, error) {
+	key := fmt.Sprintf("%d:%d:%d:%s", listingID, userID, size, level)
+	if png, ok := qrCache.get(key); ok {
+		return png, nil
+	}
+
+	form := url.Values{
+		"created_by": {strconv.Itoa(userID)},
+		"utm_medium": {"qr"},
+		"reuse":      {"true"},
+	}
+	res, err := createShareLinkService(ctx, listingID, form)
+	if err != nil {
+		return nil, err
+	}
+
+	png, err := qrcode.Encode(shareLinkURL(res.ShareLink.Code), qrLevels[level], size)
+	if err != nil {
+		slog.ErrorContext(ctx, "usecase error", "code", "273", "error", err)
+		return nil, err
+	}
+	qrCache.put(key, png)
+
+	return png, nil
+}
+
+// =========== REPOSITORY LAYER, CACHE OF GENERATED QR CODES ===========
+
+type qrCacheEntry struct {
+	key string
+	png []byte
+}
+
+// lru of png by listing, user, size and level, entries never expire as the link of a user and listing is kept
+type qrCacheStore struct {
+	size int
+
+	mu      sync.Mutex
+	order   *list.List
+	entries map[string]*list.Element
+}
+
+func newQRCache(size int) *qrCacheStore {
+	return &qrCacheStore{size: size, order: list.New(), entries: map[string]*list.Element{}}
+}
+
+func (c *qrCacheStore) get(key string) ([]byte, bool) {
+	if c.size <= 0 {
+		return nil, false
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	elem, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+
+	c.order.MoveToFront(elem)
+	return elem.Value.(*qrCacheEntry).png, true
+}
+
+// put png of key, evicting the least recently used one when full
+func (c *qrCacheStore) put(key string, png []byte) {
+	if c.size <= 0 {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if elem, ok := c.entries[key]; ok {
+		elem.Value = &qrCacheEntry{key: key, png: png}
+		c.order.MoveToFront(elem)
+		return
+	}
+
+	c.entries[key] = c.order.PushFront(&qrCacheEntry{key: key, png: png})
+	if c.order.Len() > c.size {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*qrCacheEntry).key)
+	}
+}
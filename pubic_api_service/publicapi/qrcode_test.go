@@ -0,0 +1,74 @@
+package publicapi
+
+import (
+	"bytes"
+	"context"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestQRParams(t *testing.T) {
+	tests := []struct {
+		size, level string
+		wantSize    int
+		wantLevel   string
+		wantErr     bool
+	}{
+		{size: "256", level: "M", wantSize: 256, wantLevel: "M"},
+		{size: "64", level: "h", wantSize: 64, wantLevel: "H"},
+		{size: "1024", level: "L", wantSize: 1024, wantLevel: "L"},
+		{size: "63", level: "M", wantErr: true},
+		{size: "1025", level: "M", wantErr: true},
+		{size: "big", level: "M", wantErr: true},
+		{size: "256", level: "X", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		size, level, err := qrParams(tt.size, tt.level)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("qrParams(%s, %s) err = %v, want error %t", tt.size, tt.level, err, tt.wantErr)
+			continue
+		}
+		if size != tt.wantSize || level != tt.wantLevel {
+			t.Errorf("qrParams(%s, %s) = %d, %s, want %d, %s", tt.size, tt.level, size, level, tt.wantSize, tt.wantLevel)
+		}
+	}
+}
+
+func TestListingQRCode(t *testing.T) {
+	calls := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if r.URL.Path != "/listings/7/share-links" || r.PostFormValue("reuse") != "true" ||
+			r.PostFormValue("utm_medium") != "qr" || r.PostFormValue("created_by") != "3" {
+			t.Errorf("request %s %v, want the reused qr link of user 3", r.URL.Path, r.PostForm)
+		}
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(`{"result": true, "share_link": {"id": 1, "code": "x7Kp2QaZ", "listing_id": 7, "created_by": 3}}`))
+	}))
+	defer server.Close()
+
+	previousPath, previousCache := apiPathShareLinks, qrCache
+	apiPathShareLinks, qrCache = server.URL+"/listings/%d/share-links", newQRCache(10)
+	defer func() { apiPathShareLinks, qrCache = previousPath, previousCache }()
+
+	for i := 0; i < 2; i++ {
+		res, err := getListingQRCodeUsecase(context.Background(), 7, 3, 128, "M")
+		if err != nil {
+			t.Fatal(err)
+		}
+		img, err := png.Decode(bytes.NewReader(res))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if bounds := img.Bounds(); bounds.Dx() != 128 || bounds.Dy() != 128 {
+			t.Errorf("image of %v, want 128x128", bounds)
+		}
+	}
+
+	if calls != 1 {
+		t.Errorf("listing service called %d times, want the second code served by the cache", calls)
+	}
+}
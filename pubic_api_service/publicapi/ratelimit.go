@@ -0,0 +1,256 @@
+package publicapi
+
+import (
+	"fmt"
+	"log"
+	"log/slog"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"apperror"
+
+	"github.com/gin-gonic/gin"
+)
+
+// =========== MIDDLEWARE LAYER, RUN BEFORE INTERFACE HANDLER TO ENRICH OR GUARD THE REQUEST ===========
+
+const (
+	rateFixedWindow = "fixed_window"
+	rateTokenBucket = "token_bucket"
+)
+
+// state of one client, start and count of the current window or tokens left in the bucket at updated
+type rateClient struct {
+	start time.Time
+	count int
+
+	tokens  float64
+	updated time.Time
+
+	// first time the client went over the limit, over limit requests pass until graceUntil
+	graceUntil time.Time
+}
+
+// outcome of one request against the limit
+type rateDecision struct {
+	limit     int
+	remaining int
+	reset     time.Time
+	allowed   bool
+	// over the limit but inside the grace period
+	warn       bool
+	graceUntil time.Time
+}
+
+// limit per client ip or authenticated user, clients going over it are only warned during the grace period
+type rateLimiter struct {
+	algorithm string
+	limit     int
+	window    time.Duration
+	// bucket size of token_bucket, refilled at limit tokens per window
+	burst   int
+	grace   time.Duration
+	perUser bool
+
+	mu      sync.Mutex
+	clients map[string]*rateClient
+	swept   time.Time
+}
+
+// RATE_LIMIT_REQUESTS requests per client per RATE_LIMIT_WINDOW, 0 disables the limit
+// RATE_LIMIT_ALGORITHM fixed_window counts requests per window, token_bucket refills RATE_LIMIT_REQUESTS tokens per
+// window evenly into a bucket of RATE_LIMIT_BURST tokens so a client can not spend two windows at their boundary
+// RATE_LIMIT_PER_USER count requests with a valid bearer token per user instead of per client ip
+// RATE_LIMIT_GRACE_PERIOD duration a client going over the limit gets warning headers before 429s begin, 0 enforces right away
+func newRateLimiterFromConfig() *rateLimiter {
+	limiter := &rateLimiter{
+		algorithm: cfg.String("RATE_LIMIT_ALGORITHM", rateFixedWindow),
+		limit:     cfg.Int("RATE_LIMIT_REQUESTS", 0),
+		window:    cfg.Duration("RATE_LIMIT_WINDOW", time.Minute),
+		grace:     cfg.Duration("RATE_LIMIT_GRACE_PERIOD", 0),
+		perUser:   cfg.Bool("RATE_LIMIT_PER_USER", true),
+		clients:   map[string]*rateClient{},
+	}
+	limiter.burst = cfg.Int("RATE_LIMIT_BURST", limiter.limit)
+
+	if limiter.algorithm != rateFixedWindow && limiter.algorithm != rateTokenBucket {
+		log.Fatalf("invalid RATE_LIMIT_ALGORITHM %q, one of: %s, %s", limiter.algorithm, rateFixedWindow, rateTokenBucket)
+	}
+	if limiter.algorithm == rateTokenBucket && limiter.limit > 0 && limiter.burst <= 0 {
+		log.Fatalf("invalid RATE_LIMIT_BURST %d, must be at least 1", limiter.burst)
+	}
+
+	return limiter
+}
+
+// limit of account creation per client ip, signup is public so it is counted apart from RATE_LIMIT_REQUESTS
+// SIGNUP_RATE_LIMIT_REQUESTS accounts created per client ip per SIGNUP_RATE_LIMIT_WINDOW, 0 disables the limit
+var signupLimiter = &rateLimiter{
+	algorithm: rateFixedWindow,
+	limit:     cfg.Int("SIGNUP_RATE_LIMIT_REQUESTS", 5),
+	window:    cfg.Duration("SIGNUP_RATE_LIMIT_WINDOW", time.Hour),
+	clients:   map[string]*rateClient{},
+}
+
+func (l *rateLimiter) take(key string, now time.Time) rateDecision {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.sweep(now)
+
+	client := l.clients[key]
+	if client == nil {
+		client = &rateClient{start: now, tokens: float64(l.burst), updated: now}
+		l.clients[key] = client
+	}
+
+	var decision rateDecision
+	if l.algorithm == rateTokenBucket {
+		decision = l.takeToken(client, now)
+	} else {
+		decision = l.takeWindow(client, now)
+	}
+	if decision.allowed {
+		return decision
+	}
+
+	if l.grace > 0 && client.graceUntil.IsZero() {
+		client.graceUntil = now.Add(l.grace)
+	}
+	decision.graceUntil = client.graceUntil
+	if now.Before(client.graceUntil) {
+		decision.allowed = true
+		decision.warn = true
+	}
+
+	return decision
+}
+
+// count the request in the window of client, reset is the end of the window
+func (l *rateLimiter) takeWindow(client *rateClient, now time.Time) rateDecision {
+	if now.Sub(client.start) >= l.window {
+		client.start = now
+		client.count = 0
+	}
+	client.count++
+
+	decision := rateDecision{limit: l.limit, reset: client.start.Add(l.window)}
+	if client.count <= l.limit {
+		decision.remaining = l.limit - client.count
+		decision.allowed = true
+	}
+	return decision
+}
+
+// take one token of the bucket of client, reset is when the bucket is full again or when the next token comes
+// once it is empty
+func (l *rateLimiter) takeToken(client *rateClient, now time.Time) rateDecision {
+	l.refill(client, now)
+
+	decision := rateDecision{limit: l.burst}
+	if client.tokens >= 1 {
+		client.tokens--
+		decision.allowed = true
+		decision.remaining = int(client.tokens)
+		decision.reset = now.Add(l.refillTime(float64(l.burst) - client.tokens))
+		return decision
+	}
+
+	decision.reset = now.Add(l.refillTime(1 - client.tokens))
+	return decision
+}
+
+// add the tokens earned since the last request of client, up to burst
+func (l *rateLimiter) refill(client *rateClient, now time.Time) {
+	earned := float64(now.Sub(client.updated)) / float64(l.window) * float64(l.limit)
+	client.tokens = math.Min(float64(l.burst), client.tokens+earned)
+	client.updated = now
+}
+
+// time to earn tokens at limit per window
+func (l *rateLimiter) refillTime(tokens float64) time.Duration {
+	return time.Duration(tokens / float64(l.limit) * float64(l.window))
+}
+
+// drop idle clients once per window, clients still in their grace period are kept so it is not restarted
+func (l *rateLimiter) sweep(now time.Time) {
+	if now.Sub(l.swept) < l.window {
+		return
+	}
+	l.swept = now
+
+	for key, client := range l.clients {
+		idle := now.Sub(client.start) >= l.window
+		if l.algorithm == rateTokenBucket {
+			// a full bucket is the same as a new client
+			idle = client.tokens+float64(now.Sub(client.updated))/float64(l.window)*float64(l.limit) >= float64(l.burst)
+		}
+		if idle && !now.Before(client.graceUntil) {
+			delete(l.clients, key)
+		}
+	}
+}
+
+// key of the client of the request, its user when RATE_LIMIT_PER_USER and the bearer token is valid, its ip otherwise
+func (l *rateLimiter) clientKey(c *gin.Context) string {
+	if l.perUser {
+		if token, found := strings.CutPrefix(c.GetHeader("Authorization"), "Bearer "); found && token != "" {
+			if userID, err := parseToken(token); err == nil {
+				return "user:" + strconv.Itoa(userID)
+			}
+		}
+	}
+
+	return "ip:" + clientIP(c)
+}
+
+// limit requests per client ip or user, run after clientIPMiddleware
+func rateLimitMiddleware(limiter *rateLimiter) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if limiter.limit <= 0 {
+			c.Next()
+			return
+		}
+
+		key := limiter.clientKey(c)
+		now := time.Now()
+		decision := limiter.take(key, now)
+		setRateLimitHeaders(c, decision, now)
+
+		if decision.warn {
+			slog.WarnContext(c.Request.Context(), "rate limit exceeded in grace period", "client", key, "route", c.FullPath(), "enforced_from", decision.graceUntil)
+			c.Header("X-RateLimit-Warning", fmt.Sprintf("limit of %d requests per %s exceeded, enforced from %s",
+				limiter.limit, limiter.window, decision.graceUntil.UTC().Format(time.RFC3339)))
+		}
+
+		if !decision.allowed {
+			slog.WarnContext(c.Request.Context(), "middleware error", "code", "109", "error", "rate limit exceeded", "client", key)
+			c.Header("Retry-After", fmt.Sprint(secondsUntil(decision.reset, now)))
+			apperror.Abort(c, http.StatusTooManyRequests, "Too many requests")
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// RateLimit-* headers of the IETF draft so clients can throttle themselves, reset is in seconds
+func setRateLimitHeaders(c *gin.Context, decision rateDecision, now time.Time) {
+	c.Header("RateLimit-Limit", fmt.Sprint(decision.limit))
+	c.Header("RateLimit-Remaining", fmt.Sprint(decision.remaining))
+	c.Header("RateLimit-Reset", fmt.Sprint(secondsUntil(decision.reset, now)))
+}
+
+// whole seconds from now to t rounded up, so waiting that long always reaches t
+func secondsUntil(t, now time.Time) int {
+	d := t.Sub(now)
+	if d <= 0 {
+		return 0
+	}
+
+	return int((d + time.Second - 1) / time.Second)
+}
@@ -0,0 +1,158 @@
+package publicapi
+
+import (
+	"testing"
+	"time"
+)
+
+func newTestRateLimiter(algorithm string, limit, burst int, grace time.Duration) *rateLimiter {
+	return &rateLimiter{
+		algorithm: algorithm,
+		limit:     limit,
+		window:    time.Minute,
+		burst:     burst,
+		grace:     grace,
+		clients:   map[string]*rateClient{},
+	}
+}
+
+func TestRateLimiterTake(t *testing.T) {
+	start := time.Date(2026, 10, 16, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name      string
+		algorithm string
+		burst     int
+		grace     time.Duration
+		// offsets from start of the requests of one client
+		requests []time.Duration
+		// decision of the last request
+		allowed   bool
+		warn      bool
+		remaining int
+	}{
+		{
+			name:      "fixed window under limit",
+			algorithm: rateFixedWindow,
+			requests:  []time.Duration{0, time.Second},
+			allowed:   true,
+			remaining: 1,
+		},
+		{
+			name:      "fixed window at limit",
+			algorithm: rateFixedWindow,
+			requests:  []time.Duration{0, time.Second, 2 * time.Second},
+			allowed:   true,
+			remaining: 0,
+		},
+		{
+			name:      "fixed window over limit",
+			algorithm: rateFixedWindow,
+			requests:  []time.Duration{0, time.Second, 2 * time.Second, 3 * time.Second},
+			allowed:   false,
+		},
+		{
+			name:      "fixed window resets after window",
+			algorithm: rateFixedWindow,
+			requests:  []time.Duration{0, time.Second, 2 * time.Second, time.Minute},
+			allowed:   true,
+			remaining: 2,
+		},
+		{
+			name:      "over limit in grace period",
+			algorithm: rateFixedWindow,
+			grace:     time.Hour,
+			requests:  []time.Duration{0, time.Second, 2 * time.Second, 3 * time.Second},
+			allowed:   true,
+			warn:      true,
+		},
+		{
+			name:      "token bucket empty",
+			algorithm: rateTokenBucket,
+			burst:     2,
+			requests:  []time.Duration{0, 0, 0},
+			allowed:   false,
+		},
+		{
+			name:      "token bucket refilled after one token time",
+			algorithm: rateTokenBucket,
+			burst:     2,
+			requests:  []time.Duration{0, 0, 20 * time.Second},
+			allowed:   true,
+			remaining: 0,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			limiter := newTestRateLimiter(tt.algorithm, 3, tt.burst, tt.grace)
+
+			var decision rateDecision
+			for _, offset := range tt.requests {
+				decision = limiter.take("ip:10.0.0.1", start.Add(offset))
+			}
+
+			if decision.allowed != tt.allowed || decision.warn != tt.warn {
+				t.Fatalf("allowed, warn = %t, %t, want %t, %t", decision.allowed, decision.warn, tt.allowed, tt.warn)
+			}
+			if tt.allowed && !tt.warn && decision.remaining != tt.remaining {
+				t.Errorf("remaining = %d, want %d", decision.remaining, tt.remaining)
+			}
+		})
+	}
+}
+
+func TestRateLimiterSweep(t *testing.T) {
+	start := time.Date(2026, 10, 16, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name  string
+		grace time.Duration
+		// offset of the sweep from the limited requests
+		sweepAt time.Duration
+		kept    bool
+	}{
+		{name: "limited client without grace is dropped when idle", sweepAt: 2 * time.Minute},
+		{name: "client in grace period is kept", grace: time.Hour, sweepAt: 2 * time.Minute, kept: true},
+		{name: "client after grace period is dropped when idle", grace: time.Minute, sweepAt: 2 * time.Minute},
+		{name: "client in current window is kept", sweepAt: 30 * time.Second, kept: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			limiter := newTestRateLimiter(rateFixedWindow, 1, 0, tt.grace)
+			limiter.take("ip:10.0.0.1", start)
+			limiter.take("ip:10.0.0.1", start)
+
+			limiter.swept = time.Time{}
+			limiter.sweep(start.Add(tt.sweepAt))
+
+			if _, kept := limiter.clients["ip:10.0.0.1"]; kept != tt.kept {
+				t.Errorf("kept = %t, want %t", kept, tt.kept)
+			}
+		})
+	}
+}
+
+func TestSecondsUntil(t *testing.T) {
+	now := time.Date(2026, 10, 16, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name string
+		t    time.Time
+		want int
+	}{
+		{name: "past", t: now.Add(-time.Second), want: 0},
+		{name: "now", t: now, want: 0},
+		{name: "part of a second rounds up", t: now.Add(time.Millisecond), want: 1},
+		{name: "whole seconds", t: now.Add(2 * time.Second), want: 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := secondsUntil(tt.t, now); got != tt.want {
+				t.Errorf("secondsUntil = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,504 @@
+package publicapi
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"log/slog"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"events"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	// region of the read model answering, on reads served by it
+	headerReadRegion = "X-Read-Region"
+	// milliseconds the read model answering may be behind the listing and user services, at most
+	// READ_MODEL_MAX_STALENESS
+	headerReadStaleness = "X-Read-Staleness"
+)
+
+// read model of the region of this instance, nil with READ_MODEL=off
+var readModel *listingReadModel
+
+// region names are part of the consumer group of their read model
+var readRegionPattern = regexp.MustCompile(`^[A-Za-z0-9_-]{1,32}$`)
+
+// =========== MIDDLEWARE LAYER, RUN BEFORE INTERFACE HANDLER TO ENRICH OR GUARD THE REQUEST ===========
+
+// send reads to the region nearest the client, by the country of its geo info: READ_REGIONS names the regions,
+// each with the base url READ_REGION_URL_<NAME> of its public API and the countries READ_REGION_COUNTRIES_<NAME>
+// it serves. Clients of the countries of another region than READ_REGION get a 307 to it, with read_region set
+// so the other region serves it whatever its settings. Clients sending read_region are served where they are
+func readRegionMiddleware() gin.HandlerFunc {
+	local := cfg.String("READ_REGION", "")
+	nearest := map[string]string{}
+	for _, name := range cfg.List("READ_REGIONS") {
+		if !readRegionPattern.MatchString(name) {
+			log.Fatalf("invalid region %q in READ_REGIONS", name)
+		}
+		if name == local {
+			continue
+		}
+
+		key := strings.ToUpper(strings.ReplaceAll(name, "-", "_"))
+		baseURL := strings.TrimRight(cfg.String("READ_REGION_URL_"+key, ""), "/")
+		if _, err := url.ParseRequestURI(baseURL); err != nil {
+			log.Fatalf("READ_REGION_URL_%s of region %s is not a url", key, name)
+		}
+		for _, country := range cfg.List("READ_REGION_COUNTRIES_" + key) {
+			nearest[strings.ToUpper(country)] = baseURL + "\x00" + name
+		}
+	}
+
+	return func(c *gin.Context) {
+		geo := clientGeo(c)
+		if len(nearest) == 0 || geo == nil || c.Query("read_region") != "" {
+			c.Next()
+			return
+		}
+
+		region, ok := nearest[strings.ToUpper(geo.Country)]
+		if !ok {
+			c.Next()
+			return
+		}
+
+		baseURL, name, _ := strings.Cut(region, "\x00")
+		query := c.Request.URL.Query()
+		query.Set("read_region", name)
+		c.Redirect(307, baseURL+c.Request.URL.Path+"?"+query.Encode())
+		c.Abort()
+	}
+}
+
+// =========== USECASE LAYER, SERVES AS AN INTERMEDIARY BETWEEN THE PRESENTATION LAYER AND THE DATA LAYER ===========
+
+// listing of GET listing, from the read model of the region while it is within READ_MODEL_MAX_STALENESS and has
+// the listing and its user, from the listing and user services otherwise or for strong reads. Staleness is nil when
+// read from them
+func readListingUsecase(ctx context.Context, listingID int) (*Listing, *time.Duration, error) {
+	if readModel != nil && !strongRead(ctx) {
+		if staleness, fresh := readModel.staleness(); fresh {
+			listing, found, err := readModel.Listing(ctx, listingID)
+			switch {
+			case err != nil:
+				slog.WarnContext(ctx, "usecase error", "code", "513", "error", err, "listing_id", listingID)
+			case found && listing == nil:
+				return nil, &staleness, errListingNotFound
+			case found:
+				return listing, &staleness, nil
+			}
+		}
+	}
+
+	listing, err := getListingUsecase(ctx, listingID)
+	return listing, nil, err
+}
+
+// =========== REPOSITORY LAYER, READ MODEL OF THE LISTINGS WITH THEIR USERS IN THE REGION ===========
+
+// listings with their users as GET listing answers them, kept in the sqlite file of the region from the events of
+// the listing and user services. Every region consumes the events in its own consumer group, so each one is a
+// replica filled asynchronously
+//
+// Conflicts are settled by the last writer: a listing or user is replaced by a version whose updated_at is not
+// older, and a delete leaves a tombstone at the time it occurred that only newer versions replace. Events may then
+// arrive late, twice or out of order across keys
+type listingReadModel struct {
+	db       *sql.DB
+	region   string
+	consumer *events.Consumer
+	// subscription of the consumer to the broker
+	subscription io.Closer
+
+	maxStaleness time.Duration
+	syncInterval time.Duration
+	// unix microseconds as of which every delivered event is applied, 0 until the first sync
+	syncedAt atomic.Int64
+	// sources of the events, the outboxes of the user and listing services
+	histories []events.History
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+// READ_MODEL sqlite keeps the read model of the region READ_REGION in READ_MODEL_DB_PATH from the events of
+// EVENTS_NATS_URL and serves GET listing from it, off reads the listing and user services
+// READ_MODEL_MAX_STALENESS reads go to the listing and user services while the read model is further behind
+// READ_MODEL_SYNC_INTERVAL wait between two checks of the events applied against the outboxes
+// see events.NewConsumer for the READ_MODEL_ settings of the consumer
+func startReadModel() {
+	switch mode := cfg.String("READ_MODEL", "off"); mode {
+	case "off":
+		return
+	case "sqlite":
+	default:
+		log.Fatalf("invalid READ_MODEL %q", mode)
+	}
+
+	region := cfg.String("READ_REGION", "local")
+	if !readRegionPattern.MatchString(region) {
+		log.Fatalf("invalid READ_REGION %q", region)
+	}
+
+	m, err := openListingReadModel(cfg.String("READ_MODEL_DB_PATH", "read_model.db"), region)
+	if err != nil {
+		log.Fatal(err)
+	}
+	m.maxStaleness = cfg.Duration("READ_MODEL_MAX_STALENESS", 30*time.Second)
+	m.syncInterval = cfg.Duration("READ_MODEL_SYNC_INTERVAL", 5*time.Second)
+	m.histories = []events.History{userOutboxHistory{}, listingOutbox{}}
+
+	// applying an event twice changes nothing, the ids in memory only spare the fetch of the listing
+	m.consumer = events.NewConsumer(cfg, "READ_MODEL", "read-model-"+region, events.NewMemoryProcessed(), m.apply)
+	m.consumer.Observe = func(eventType, result string) {
+		readModelEvents.WithLabelValues(eventType, result).Inc()
+	}
+	m.consumer.Start()
+
+	m.subscription, err = events.SubscribeNATS(cfg, m.consumer)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	metrics.NewGaugeFunc(prometheus.GaugeOpts{
+		Name:        "read_model_staleness_seconds",
+		Help:        "How far the read model of the region may be behind the listing and user services, -1 before its first sync.",
+		ConstLabels: prometheus.Labels{"region": region},
+	}, func() float64 {
+		staleness, _ := m.staleness()
+		return staleness.Seconds()
+	})
+
+	go m.run()
+	readModel = m
+}
+
+// stop receiving events, let the consumer finish those received and close the database
+func stopReadModel(ctx context.Context) {
+	if readModel == nil {
+		return
+	}
+
+	readModel.subscription.Close()
+	readModel.consumer.Stop(ctx)
+	close(readModel.stop)
+	<-readModel.done
+	readModel.db.Close()
+}
+
+// read model in the sqlite file of path, created when missing
+func openListingReadModel(path, region string) (*listingReadModel, error) {
+	db, err := sql.Open("sqlite3", "file:"+path+"?_journal_mode=WAL&_busy_timeout=5000&_txlock=immediate")
+	if err != nil {
+		return nil, err
+	}
+
+	for _, statement := range []string{
+		// listing as the listing service returns it, null once deleted
+		`CREATE TABLE IF NOT EXISTS read_listings (
+			id INTEGER NOT NULL PRIMARY KEY,
+			user_id INTEGER NOT NULL,
+			listing TEXT,
+			updated_at INTEGER NOT NULL,
+			deleted INTEGER NOT NULL DEFAULT 0
+		)`,
+		`CREATE TABLE IF NOT EXISTS read_users (
+			id INTEGER NOT NULL PRIMARY KEY,
+			name TEXT NOT NULL,
+			created_at INTEGER NOT NULL,
+			updated_at INTEGER NOT NULL,
+			deleted INTEGER NOT NULL DEFAULT 0
+		)`,
+		// events applied since the last sync, checked against the outboxes
+		`CREATE TABLE IF NOT EXISTS read_events (
+			event_id TEXT NOT NULL PRIMARY KEY,
+			occurred_at INTEGER NOT NULL
+		)`,
+		`CREATE TABLE IF NOT EXISTS read_model_state (
+			name TEXT NOT NULL PRIMARY KEY,
+			value INTEGER NOT NULL
+		)`,
+		// a new read model is in sync as of its creation, older events come with a replay to its group
+		`INSERT INTO read_model_state (name, value) VALUES ('synced_at', ` + strconv.FormatInt(time.Now().UnixMicro(), 10) + `)
+			ON CONFLICT (name) DO NOTHING`,
+	} {
+		if _, err := db.Exec(statement); err != nil {
+			db.Close()
+			return nil, err
+		}
+	}
+
+	return &listingReadModel{db: db, region: region, stop: make(chan struct{}), done: make(chan struct{})}, nil
+}
+
+// staleness of the reads, fresh when within READ_MODEL_MAX_STALENESS. -1s before the first sync
+func (m *listingReadModel) staleness() (time.Duration, bool) {
+	syncedAt := m.syncedAt.Load()
+	if syncedAt == 0 {
+		return -time.Second, false
+	}
+
+	staleness := max(time.Since(time.UnixMicro(syncedAt)), 0)
+	return staleness, staleness <= m.maxStaleness
+}
+
+// Listing with its user, found false when the region has not seen the listing or its user yet so the services
+// have to answer, nil when deleted
+func (m *listingReadModel) Listing(ctx context.Context, listingID int) (*Listing, bool, error) {
+	var (
+		raw            sql.NullString
+		userID         int
+		listingDeleted bool
+		userName       sql.NullString
+		userCreatedAt  sql.NullInt64
+		userUpdatedAt  sql.NullInt64
+		userDeleted    sql.NullBool
+	)
+	err := m.db.QueryRowContext(ctx, `SELECT l.listing, l.user_id, l.deleted, u.name, u.created_at, u.updated_at, u.deleted
+		FROM read_listings l LEFT JOIN read_users u ON u.id = l.user_id WHERE l.id = ?`, listingID).
+		Scan(&raw, &userID, &listingDeleted, &userName, &userCreatedAt, &userUpdatedAt, &userDeleted)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		return nil, false, nil
+	case err != nil:
+		return nil, false, err
+	case listingDeleted:
+		return nil, true, nil
+	case !userDeleted.Valid:
+		return nil, false, nil
+	}
+
+	var val ListingCreate
+	if err := json.Unmarshal([]byte(raw.String), &val); err != nil {
+		return nil, false, err
+	}
+
+	// soft deleted users keep only their id as in get listing
+	user := User{ID: userID}
+	if !userDeleted.Bool {
+		user = User{ID: userID, Name: userName.String, CreatedAt: userCreatedAt.Int64, UpdatedAt: userUpdatedAt.Int64}
+	}
+
+	return &Listing{
+		ID:           val.ID,
+		UserID:       val.UserID,
+		ListingType:  val.ListingType,
+		Price:        val.Price,
+		Currency:     val.Currency,
+		Region:       val.Region,
+		Area:         val.Area,
+		VideoURL:     val.VideoURL,
+		Media:        val.Media,
+		Images:       val.Images,
+		QualityScore: val.QualityScore,
+		CreatedAt:    val.CreatedAt,
+		UpdatedAt:    val.UpdatedAt,
+		User:         user,
+	}, true, nil
+}
+
+// apply event to the read model. Listing events carry no media, the listing is read again from the listing
+// service, as it is now
+func (m *listingReadModel) apply(ctx context.Context, event events.Event) error {
+	var write func(tx *sql.Tx) error
+
+	switch event.Type {
+	case events.UserCreated, events.UserUpdated:
+		var user User
+		if err := json.Unmarshal(event.Data, &user); err != nil {
+			return err
+		}
+		write = func(tx *sql.Tx) error {
+			_, err := tx.ExecContext(ctx, `INSERT INTO read_users (id, name, created_at, updated_at) VALUES (?, ?, ?, ?)
+				ON CONFLICT (id) DO UPDATE SET name = excluded.name, created_at = excluded.created_at, updated_at = excluded.updated_at, deleted = 0
+				WHERE excluded.updated_at > read_users.updated_at OR (excluded.updated_at = read_users.updated_at AND read_users.deleted = 0)`,
+				user.ID, user.Name, user.CreatedAt, user.UpdatedAt)
+			return err
+		}
+	case events.UserDeleted:
+		var deleted events.Deleted
+		if err := json.Unmarshal(event.Data, &deleted); err != nil {
+			return err
+		}
+		write = func(tx *sql.Tx) error {
+			_, err := tx.ExecContext(ctx, `INSERT INTO read_users (id, name, created_at, updated_at, deleted) VALUES (?, '', 0, ?, 1)
+				ON CONFLICT (id) DO UPDATE SET deleted = 1, updated_at = max(read_users.updated_at, excluded.updated_at)`,
+				deleted.ID, event.OccurredAt)
+			return err
+		}
+	case events.ListingCreated, events.ListingUpdated, events.ListingDeleted:
+		var deleted events.Deleted
+		if err := json.Unmarshal(event.Data, &deleted); err != nil {
+			return err
+		}
+
+		var listing *ListingCreate
+		if event.Type != events.ListingDeleted {
+			res, err := findListingByIDService(ctx, deleted.ID)
+			switch {
+			case errors.Is(err, errListingNotFound):
+			case err != nil:
+				return err
+			default:
+				listing = &res.Listing
+			}
+		}
+
+		write = func(tx *sql.Tx) error {
+			if listing == nil {
+				_, err := tx.ExecContext(ctx, `INSERT INTO read_listings (id, user_id, updated_at, deleted) VALUES (?, 0, ?, 1)
+					ON CONFLICT (id) DO UPDATE SET listing = NULL, deleted = 1, updated_at = max(read_listings.updated_at, excluded.updated_at)`,
+					deleted.ID, event.OccurredAt)
+				return err
+			}
+
+			raw, err := json.Marshal(listing)
+			if err != nil {
+				return err
+			}
+			_, err = tx.ExecContext(ctx, `INSERT INTO read_listings (id, user_id, listing, updated_at) VALUES (?, ?, ?, ?)
+				ON CONFLICT (id) DO UPDATE SET user_id = excluded.user_id, listing = excluded.listing, updated_at = excluded.updated_at, deleted = 0
+				WHERE excluded.updated_at > read_listings.updated_at OR (excluded.updated_at = read_listings.updated_at AND read_listings.deleted = 0)`,
+				listing.ID, listing.UserID, string(raw), listing.UpdatedAt)
+			return err
+		}
+	default:
+		return nil
+	}
+
+	tx, err := m.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := write(tx); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, "INSERT INTO read_events (event_id, occurred_at) VALUES (?, ?) ON CONFLICT (event_id) DO NOTHING", event.ID, event.OccurredAt); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// sync every READ_MODEL_SYNC_INTERVAL until stopReadModel
+func (m *listingReadModel) run() {
+	defer close(m.done)
+
+	ticker := time.NewTicker(m.syncInterval)
+	defer ticker.Stop()
+	for {
+		ctx, cancel := context.WithTimeout(context.Background(), m.syncInterval)
+		if err := m.sync(ctx); err != nil {
+			slog.ErrorContext(ctx, "read model error", "code", "514", "error", err, "region", m.region)
+		}
+		cancel()
+
+		select {
+		case <-m.stop:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// sync move syncedAt up to the time of the check when every event delivered since it is applied, or to the
+// earliest event delivered but not applied yet. Events are those the outboxes delivered, an event waiting in an
+// outbox is not counted
+func (m *listingReadModel) sync(ctx context.Context) error {
+	var from int64
+	if err := m.db.QueryRowContext(ctx, "SELECT value FROM read_model_state WHERE name = 'synced_at'").Scan(&from); err != nil {
+		return err
+	}
+
+	checkedAt := time.Now().UnixMicro()
+	syncedAt := checkedAt
+	for _, history := range m.histories {
+		filter := events.ReplayFilter{From: from, To: checkedAt}
+		for afterID := int64(0); ; {
+			records, err := history.Events(ctx, filter, afterID, 500)
+			if err != nil {
+				return err
+			}
+			if len(records) == 0 {
+				break
+			}
+			afterID = records[len(records)-1].ID
+
+			missing, err := m.missing(ctx, records)
+			if err != nil {
+				return err
+			}
+			for _, record := range missing {
+				syncedAt = min(syncedAt, record.Event.OccurredAt)
+			}
+		}
+	}
+
+	tx, err := m.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, "UPDATE read_model_state SET value = ? WHERE name = 'synced_at'", syncedAt); err != nil {
+		return err
+	}
+	// the next sync only checks the events after syncedAt
+	if _, err := tx.ExecContext(ctx, "DELETE FROM read_events WHERE occurred_at < ?", syncedAt); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	m.syncedAt.Store(syncedAt)
+	return nil
+}
+
+// records whose event is not applied yet
+func (m *listingReadModel) missing(ctx context.Context, records []events.Record) ([]events.Record, error) {
+	ids := make([]any, len(records))
+	for i, record := range records {
+		ids[i] = record.Event.ID
+	}
+
+	rows, err := m.db.QueryContext(ctx, "SELECT event_id FROM read_events WHERE event_id IN (?"+strings.Repeat(", ?", len(ids)-1)+")", ids...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	applied := map[string]bool{}
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		applied[id] = true
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	var missing []events.Record
+	for _, record := range records {
+		if !applied[record.Event.ID] {
+			missing = append(missing, record)
+		}
+	}
+	return missing, nil
+}
@@ -0,0 +1,206 @@
+package publicapi
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"events"
+
+	"github.com/gin-gonic/gin"
+)
+
+type readModelListingClient struct {
+	ListingClient
+	listings map[int]ListingCreate
+}
+
+func (c readModelListingClient) FindListing(ctx context.Context, listingID int) (*ListingDetailResponse, error) {
+	listing, ok := c.listings[listingID]
+	if !ok {
+		return nil, errListingNotFound
+	}
+	return &ListingDetailResponse{Result: true, Listing: listing}, nil
+}
+
+type readModelHistory []events.Record
+
+func (h readModelHistory) Events(ctx context.Context, filter events.ReplayFilter, afterID int64, limit int) ([]events.Record, error) {
+	var records []events.Record
+	for _, record := range h {
+		if record.ID > afterID && record.Event.OccurredAt >= filter.From && record.Event.OccurredAt < filter.To && len(records) < limit {
+			records = append(records, record)
+		}
+	}
+	return records, nil
+}
+
+func newTestReadModel(t *testing.T) *listingReadModel {
+	m, err := openListingReadModel(filepath.Join(t.TempDir(), "read_model.db"), "eu")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { m.db.Close() })
+	m.maxStaleness = time.Minute
+	return m
+}
+
+func readModelEvent(t *testing.T, eventType string, occurredAt int64, data any) events.Event {
+	event, err := events.New(eventType, "", "", data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	event.OccurredAt = occurredAt
+	return event
+}
+
+func TestListingReadModelApply(t *testing.T) {
+	previous := listingClient
+	defer func() { listingClient = previous }()
+
+	client := readModelListingClient{listings: map[int]ListingCreate{1: {ID: 1, UserID: 7, ListingType: "rent", Price: 100, UpdatedAt: 20}}}
+	listingClient = client
+	m := newTestReadModel(t)
+	ctx := context.Background()
+
+	apply := func(event events.Event) {
+		t.Helper()
+		if err := m.apply(ctx, event); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	apply(readModelEvent(t, events.ListingCreated, 20, events.Deleted{ID: 1}))
+	if _, found, err := m.Listing(ctx, 1); err != nil || found {
+		t.Errorf("listing without its user: found %v, %v, want the services to answer", found, err)
+	}
+
+	apply(readModelEvent(t, events.UserUpdated, 30, User{ID: 7, Name: "Bob", UpdatedAt: 30}))
+	// an older version arriving late keeps the newer one
+	apply(readModelEvent(t, events.UserCreated, 10, User{ID: 7, Name: "Alice", UpdatedAt: 10}))
+	listing, found, err := m.Listing(ctx, 1)
+	if err != nil || !found || listing.Price != 100 || listing.User.Name != "Bob" {
+		t.Fatalf("listing = %+v, %v, %v, want price 100 by Bob", listing, found, err)
+	}
+
+	// the listing service already answers the version of a later event
+	client.listings[1] = ListingCreate{ID: 1, UserID: 7, ListingType: "rent", Price: 200, UpdatedAt: 40}
+	apply(readModelEvent(t, events.ListingUpdated, 40, events.Deleted{ID: 1}))
+	client.listings[1] = ListingCreate{ID: 1, UserID: 7, ListingType: "rent", Price: 150, UpdatedAt: 35}
+	apply(readModelEvent(t, events.ListingUpdated, 35, events.Deleted{ID: 1}))
+	if listing, _, _ := m.Listing(ctx, 1); listing.Price != 200 {
+		t.Errorf("price after an older update = %d, want 200", listing.Price)
+	}
+
+	apply(readModelEvent(t, events.UserDeleted, 50, events.Deleted{ID: 7}))
+	if listing, _, _ := m.Listing(ctx, 1); listing.User != (User{ID: 7}) {
+		t.Errorf("user of deleted user = %+v, want the id only", listing.User)
+	}
+
+	delete(client.listings, 1)
+	apply(readModelEvent(t, events.ListingDeleted, 60, events.Deleted{ID: 1}))
+	// an update older than the delete does not bring the listing back
+	client.listings[1] = ListingCreate{ID: 1, UserID: 7, ListingType: "rent", Price: 200, UpdatedAt: 40}
+	apply(readModelEvent(t, events.ListingUpdated, 40, events.Deleted{ID: 1}))
+	if listing, found, err := m.Listing(ctx, 1); err != nil || !found || listing != nil {
+		t.Errorf("deleted listing = %+v, %v, %v, want found nil", listing, found, err)
+	}
+
+	readModel = m
+	defer func() { readModel = nil }()
+	m.syncedAt.Store(time.Now().UnixMicro())
+	if _, staleness, err := readListingUsecase(ctx, 1); !errors.Is(err, errListingNotFound) || staleness == nil {
+		t.Errorf("read of deleted listing: %v %v, want errListingNotFound from the read model", staleness, err)
+	}
+}
+
+func TestListingReadModelSync(t *testing.T) {
+	m := newTestReadModel(t)
+	ctx := context.Background()
+
+	if _, fresh := m.staleness(); fresh {
+		t.Error("fresh before the first sync, want stale")
+	}
+
+	var from int64
+	if err := m.db.QueryRow("SELECT value FROM read_model_state WHERE name = 'synced_at'").Scan(&from); err != nil {
+		t.Fatal(err)
+	}
+	applied := readModelEvent(t, events.UserDeleted, from+1, events.Deleted{ID: 1})
+	missed := readModelEvent(t, events.UserDeleted, from+2, events.Deleted{ID: 2})
+	later := readModelEvent(t, events.UserDeleted, from+3, events.Deleted{ID: 3})
+	m.histories = []events.History{readModelHistory{{ID: 1, Event: applied}, {ID: 2, Event: missed}, {ID: 3, Event: later}}}
+	for _, event := range []events.Event{applied, later} {
+		if err := m.apply(ctx, event); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := m.sync(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if got := m.syncedAt.Load(); got != missed.OccurredAt {
+		t.Errorf("synced at %d with an event missing, want %d", got, missed.OccurredAt)
+	}
+
+	if err := m.apply(ctx, missed); err != nil {
+		t.Fatal(err)
+	}
+	before := time.Now().UnixMicro()
+	if err := m.sync(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if got := m.syncedAt.Load(); got < before {
+		t.Errorf("synced at %d with every event applied, want the time of the sync", got)
+	}
+	if _, fresh := m.staleness(); !fresh {
+		t.Error("stale after a complete sync, want fresh")
+	}
+
+	var kept int
+	if err := m.db.QueryRow("SELECT COUNT(*) FROM read_events").Scan(&kept); err != nil || kept != 0 {
+		t.Errorf("events kept after sync = %d, %v, want 0", kept, err)
+	}
+}
+
+func TestReadRegionMiddleware(t *testing.T) {
+	t.Setenv("READ_REGION", "eu")
+	t.Setenv("READ_REGIONS", "eu,us-east")
+	t.Setenv("READ_REGION_URL_EU", "https://eu.example.com")
+	t.Setenv("READ_REGION_COUNTRIES_EU", "DE,FR")
+	t.Setenv("READ_REGION_URL_US_EAST", "https://us.example.com/")
+	t.Setenv("READ_REGION_COUNTRIES_US_EAST", "US,ca")
+
+	router := gin.New()
+	router.Use(func(c *gin.Context) {
+		if country := c.GetHeader("X-Country"); country != "" {
+			c.Set(ctxKeyClientGeo, &GeoInfo{Country: country})
+		}
+	})
+	router.GET("/public-api/listings/:id", readRegionMiddleware(), func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	for _, tc := range []struct {
+		country, query string
+		status         int
+		location       string
+	}{
+		{"CA", "?units=sqm", http.StatusTemporaryRedirect, "https://us.example.com/public-api/listings/1?read_region=us-east&units=sqm"},
+		{"DE", "", http.StatusOK, ""},
+		{"BR", "", http.StatusOK, ""},
+		{"", "", http.StatusOK, ""},
+		{"US", "?read_region=eu", http.StatusOK, ""},
+	} {
+		req := httptest.NewRequest(http.MethodGet, "/public-api/listings/1"+tc.query, nil)
+		req.Header.Set("X-Country", tc.country)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		if w.Code != tc.status || w.Header().Get("Location") != tc.location {
+			t.Errorf("country %q%s: %d %q, want %d %q", tc.country, tc.query, w.Code, w.Header().Get("Location"), tc.status, tc.location)
+		}
+	}
+}
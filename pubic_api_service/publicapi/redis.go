@@ -0,0 +1,265 @@
+package publicapi
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// =========== REPOSITORY LAYER, MINIMAL REDIS CLIENT ===========
+
+// errRedisNil reply of GET on a missing key
+var errRedisNil = errors.New("redis: nil")
+
+// redisClient run single commands over a small pool of connections, enough for GET, SET and INCR of the caches
+type redisClient struct {
+	addr     string
+	password string
+	db       int
+	timeout  time.Duration
+
+	mu   sync.Mutex
+	idle []*redisConn
+}
+
+type redisConn struct {
+	conn net.Conn
+	r    *bufio.Reader
+}
+
+// idle connections kept open, more are dialed under load and closed once done
+const redisMaxIdle = 16
+
+// newRedisClient client of a redis://[:password@]host:port[/db] url, timeout bounds every command
+func newRedisClient(rawURL string, timeout time.Duration) (*redisClient, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme != "redis" || u.Host == "" {
+		return nil, fmt.Errorf("redis url %q: want redis://[:password@]host:port[/db]", rawURL)
+	}
+
+	client := &redisClient{addr: u.Host, timeout: timeout}
+	if _, _, err := net.SplitHostPort(u.Host); err != nil {
+		client.addr = net.JoinHostPort(u.Host, "6379")
+	}
+	if password, ok := u.User.Password(); ok {
+		client.password = password
+	}
+	if db := strings.Trim(u.Path, "/"); db != "" {
+		if client.db, err = strconv.Atoi(db); err != nil {
+			return nil, fmt.Errorf("redis url %q: invalid db %q", rawURL, db)
+		}
+	}
+
+	return client, nil
+}
+
+// do send one command on a pooled connection and read its reply, see readReply. An idle connection closed by
+// redis in the meantime, on restart or idle timeout, is replaced by a new one and the command sent again
+func (c *redisClient) do(ctx context.Context, args ...string) (any, error) {
+	conn, reused, err := c.get(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	reply, err := conn.do(c.deadline(ctx), args...)
+	if reused && isClosedConn(err) {
+		conn.conn.Close()
+		if conn, err = c.dial(ctx); err != nil {
+			return nil, err
+		}
+		reply, err = conn.do(c.deadline(ctx), args...)
+	}
+
+	var replyErr redisError
+	if err != nil && !errors.As(err, &replyErr) {
+		// state of the connection is unknown after an i/o error
+		conn.conn.Close()
+		return nil, err
+	}
+	c.put(conn)
+
+	return reply, err
+}
+
+// report whether err is the peer having closed the connection, the command was then not run
+func isClosedConn(err error) bool {
+	return errors.Is(err, io.EOF) || errors.Is(err, syscall.ECONNRESET) || errors.Is(err, syscall.EPIPE)
+}
+
+func (c *redisClient) deadline(ctx context.Context) time.Time {
+	deadline := time.Now().Add(c.timeout)
+	if ctxDeadline, ok := ctx.Deadline(); ok && ctxDeadline.Before(deadline) {
+		return ctxDeadline
+	}
+	return deadline
+}
+
+// get idle connection, reused true, or dial a new one
+func (c *redisClient) get(ctx context.Context) (*redisConn, bool, error) {
+	c.mu.Lock()
+	if n := len(c.idle); n > 0 {
+		conn := c.idle[n-1]
+		c.idle = c.idle[:n-1]
+		c.mu.Unlock()
+		return conn, true, nil
+	}
+	c.mu.Unlock()
+
+	conn, err := c.dial(ctx)
+	return conn, false, err
+}
+
+// dial a new connection, authenticated and on db
+func (c *redisClient) dial(ctx context.Context) (*redisConn, error) {
+	dialer := net.Dialer{Timeout: c.timeout}
+	netConn, err := dialer.DialContext(ctx, "tcp", c.addr)
+	if err != nil {
+		return nil, err
+	}
+	conn := &redisConn{conn: netConn, r: bufio.NewReader(netConn)}
+
+	if c.password != "" {
+		if _, err := conn.do(c.deadline(ctx), "AUTH", c.password); err != nil {
+			netConn.Close()
+			return nil, err
+		}
+	}
+	if c.db != 0 {
+		if _, err := conn.do(c.deadline(ctx), "SELECT", strconv.Itoa(c.db)); err != nil {
+			netConn.Close()
+			return nil, err
+		}
+	}
+
+	return conn, nil
+}
+
+func (c *redisClient) put(conn *redisConn) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if len(c.idle) >= redisMaxIdle {
+		conn.conn.Close()
+		return
+	}
+	c.idle = append(c.idle, conn)
+}
+
+// Get value of key, errRedisNil when missing
+func (c *redisClient) Get(ctx context.Context, key string) (string, error) {
+	reply, err := c.do(ctx, "GET", key)
+	if err != nil {
+		return "", err
+	}
+	if reply == nil {
+		return "", errRedisNil
+	}
+
+	value, ok := reply.(string)
+	if !ok {
+		return "", fmt.Errorf("redis GET: unexpected reply %T", reply)
+	}
+	return value, nil
+}
+
+// Set key to value expiring after ttl
+func (c *redisClient) Set(ctx context.Context, key, value string, ttl time.Duration) error {
+	_, err := c.do(ctx, "SET", key, value, "PX", strconv.FormatInt(ttl.Milliseconds(), 10))
+	return err
+}
+
+// Incr add one to the counter of key and return it
+func (c *redisClient) Incr(ctx context.Context, key string) (int64, error) {
+	reply, err := c.do(ctx, "INCR", key)
+	if err != nil {
+		return 0, err
+	}
+
+	n, ok := reply.(int64)
+	if !ok {
+		return 0, fmt.Errorf("redis INCR: unexpected reply %T", reply)
+	}
+	return n, nil
+}
+
+// redisError error reply of a command, the connection stays usable
+type redisError string
+
+func (e redisError) Error() string {
+	return "redis: " + string(e)
+}
+
+func (c *redisConn) do(deadline time.Time, args ...string) (any, error) {
+	if err := c.conn.SetDeadline(deadline); err != nil {
+		return nil, err
+	}
+
+	var cmd strings.Builder
+	fmt.Fprintf(&cmd, "*%d\r\n", len(args))
+	for _, arg := range args {
+		fmt.Fprintf(&cmd, "$%d\r\n%s\r\n", len(arg), arg)
+	}
+	if _, err := io.WriteString(c.conn, cmd.String()); err != nil {
+		return nil, err
+	}
+
+	return c.readReply()
+}
+
+// readReply parse one RESP2 reply: simple and bulk strings as string, integers as int64, arrays as []any,
+// nil bulk or array as nil and error replies as redisError
+func (c *redisConn) readReply() (any, error) {
+	line, err := c.r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	if len(line) < 3 || !strings.HasSuffix(line, "\r\n") {
+		return nil, fmt.Errorf("redis: malformed reply %q", line)
+	}
+	kind, body := line[0], line[1:len(line)-2]
+
+	switch kind {
+	case '+':
+		return body, nil
+	case '-':
+		return nil, redisError(body)
+	case ':':
+		return strconv.ParseInt(body, 10, 64)
+	case '$':
+		n, err := strconv.Atoi(body)
+		if err != nil || n < 0 {
+			return nil, err
+		}
+		buf := make([]byte, n+2)
+		if _, err := io.ReadFull(c.r, buf); err != nil {
+			return nil, err
+		}
+		return string(buf[:n]), nil
+	case '*':
+		n, err := strconv.Atoi(body)
+		if err != nil || n < 0 {
+			return nil, err
+		}
+		items := make([]any, n)
+		for i := range items {
+			if items[i], err = c.readReply(); err != nil {
+				return nil, err
+			}
+		}
+		return items, nil
+	default:
+		return nil, fmt.Errorf("redis: unknown reply type %q", kind)
+	}
+}
@@ -0,0 +1,367 @@
+package publicapi
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestRedisReadReply(t *testing.T) {
+	tests := []struct {
+		name    string
+		raw     string
+		want    any
+		wantErr error
+		// any error but a redisError
+		wantIOErr bool
+	}{
+		{name: "simple string", raw: "+OK\r\n", want: "OK"},
+		{name: "error", raw: "-ERR unknown command\r\n", wantErr: redisError("ERR unknown command")},
+		{name: "integer", raw: ":42\r\n", want: int64(42)},
+		{name: "negative integer", raw: ":-1\r\n", want: int64(-1)},
+		{name: "max integer", raw: ":9223372036854775807\r\n", want: int64(9223372036854775807)},
+		{name: "integer overflow", raw: ":9223372036854775808\r\n", wantIOErr: true},
+		{name: "bulk string", raw: "$5\r\nhello\r\n", want: "hello"},
+		{name: "bulk string with crlf", raw: "$7\r\nab\r\ncd\n\r\n", want: "ab\r\ncd\n"},
+		{name: "empty bulk string", raw: "$0\r\n\r\n", want: ""},
+		{name: "nil bulk string", raw: "$-1\r\n", want: nil},
+		{name: "array", raw: "*3\r\n$1\r\na\r\n:2\r\n$-1\r\n", want: []any{"a", int64(2), nil}},
+		{name: "empty array", raw: "*0\r\n", want: []any{}},
+		{name: "nil array", raw: "*-1\r\n", want: nil},
+		{name: "nested array", raw: "*1\r\n*1\r\n+x\r\n", want: []any{[]any{"x"}}},
+		{name: "truncated bulk string", raw: "$5\r\nhel", wantIOErr: true},
+		{name: "truncated array", raw: "*2\r\n+a\r\n", wantIOErr: true},
+		{name: "missing cr", raw: "+OK\n", wantIOErr: true},
+		{name: "unknown type", raw: "!oops\r\n", wantIOErr: true},
+		{name: "invalid bulk length", raw: "$x\r\n", wantIOErr: true},
+		{name: "closed before reply", raw: "", wantIOErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conn := &redisConn{r: bufio.NewReader(strings.NewReader(tt.raw))}
+
+			got, err := conn.readReply()
+			switch {
+			case tt.wantErr != nil:
+				if err != tt.wantErr {
+					t.Fatalf("err = %v, want %v", err, tt.wantErr)
+				}
+			case tt.wantIOErr:
+				var replyErr redisError
+				if err == nil || errors.As(err, &replyErr) {
+					t.Fatalf("err = %v, want a protocol error", err)
+				}
+			default:
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !reflect.DeepEqual(got, tt.want) {
+					t.Errorf("reply = %#v, want %#v", got, tt.want)
+				}
+			}
+		})
+	}
+}
+
+// redis server speaking RESP2 with a map of strings, enough for the commands of redisClient
+type fakeRedis struct {
+	listener net.Listener
+
+	mu       sync.Mutex
+	data     map[string]string
+	commands [][]string
+	conns    []net.Conn
+	dials    int
+}
+
+func newFakeRedis(t *testing.T) *fakeRedis {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := &fakeRedis{listener: listener, data: map[string]string{}}
+	t.Cleanup(func() {
+		listener.Close()
+		server.dropConnections()
+	})
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			server.mu.Lock()
+			server.conns = append(server.conns, conn)
+			server.dials++
+			server.mu.Unlock()
+			go server.serve(conn)
+		}
+	}()
+
+	return server
+}
+
+func (s *fakeRedis) client(t *testing.T, path string) *redisClient {
+	t.Helper()
+
+	client, err := newRedisClient("redis://"+s.listener.Addr().String()+path, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return client
+}
+
+// close every open connection as redis does on restart or idle timeout
+func (s *fakeRedis) dropConnections() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, conn := range s.conns {
+		conn.Close()
+	}
+	s.conns = nil
+}
+
+func (s *fakeRedis) serve(conn net.Conn) {
+	r := bufio.NewReader(conn)
+	for {
+		args, err := readCommand(r)
+		if err != nil {
+			return
+		}
+
+		s.mu.Lock()
+		s.commands = append(s.commands, args)
+		reply := s.reply(args)
+		s.mu.Unlock()
+
+		if _, err := io.WriteString(conn, reply); err != nil {
+			return
+		}
+	}
+}
+
+// command sent as an array of bulk strings
+func readCommand(r *bufio.Reader) ([]string, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	n, err := strconv.Atoi(strings.TrimSuffix(strings.TrimPrefix(line, "*"), "\r\n"))
+	if err != nil {
+		return nil, err
+	}
+
+	args := make([]string, n)
+	for i := range args {
+		if line, err = r.ReadString('\n'); err != nil {
+			return nil, err
+		}
+		size, err := strconv.Atoi(strings.TrimSuffix(strings.TrimPrefix(line, "$"), "\r\n"))
+		if err != nil {
+			return nil, err
+		}
+		buf := make([]byte, size+2)
+		if _, err := io.ReadFull(r, buf); err != nil {
+			return nil, err
+		}
+		args[i] = string(buf[:size])
+	}
+	return args, nil
+}
+
+func (s *fakeRedis) reply(args []string) string {
+	switch strings.ToUpper(args[0]) {
+	case "AUTH":
+		if args[1] != "secret" {
+			return "-WRONGPASS invalid username-password pair\r\n"
+		}
+		return "+OK\r\n"
+	case "SELECT":
+		return "+OK\r\n"
+	case "GET":
+		value, ok := s.data[args[1]]
+		if !ok {
+			return "$-1\r\n"
+		}
+		return fmt.Sprintf("$%d\r\n%s\r\n", len(value), value)
+	case "SET":
+		s.data[args[1]] = args[2]
+		return "+OK\r\n"
+	case "INCR":
+		n, err := strconv.ParseInt(s.data[args[1]], 10, 64)
+		if _, ok := s.data[args[1]]; ok && err != nil {
+			return "-ERR value is not an integer or out of range\r\n"
+		}
+		n++
+		s.data[args[1]] = strconv.FormatInt(n, 10)
+		return fmt.Sprintf(":%d\r\n", n)
+	default:
+		return fmt.Sprintf("-ERR unknown command '%s'\r\n", args[0])
+	}
+}
+
+func (s *fakeRedis) sent() [][]string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([][]string{}, s.commands...)
+}
+
+func (s *fakeRedis) dialed() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.dials
+}
+
+func TestRedisClientCommands(t *testing.T) {
+	server := newFakeRedis(t)
+	client := server.client(t, "")
+	ctx := context.Background()
+
+	if _, err := client.Get(ctx, "missing"); !errors.Is(err, errRedisNil) {
+		t.Errorf("GET missing: err = %v, want %v", err, errRedisNil)
+	}
+
+	if err := client.Set(ctx, "page", "{\"listings\":[]}\r\n", 1500*time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := client.Get(ctx, "page"); err != nil || got != "{\"listings\":[]}\r\n" {
+		t.Errorf("GET page = %q, %v", got, err)
+	}
+
+	for want := int64(1); want <= 2; want++ {
+		if got, err := client.Incr(ctx, "generation"); err != nil || got != want {
+			t.Errorf("INCR = %d, %v, want %d", got, err, want)
+		}
+	}
+
+	// an error reply leaves the connection usable
+	var replyErr redisError
+	if _, err := client.Incr(ctx, "page"); !errors.As(err, &replyErr) {
+		t.Errorf("INCR of a string: err = %v, want a redis error", err)
+	}
+	if got, err := client.Get(ctx, "generation"); err != nil || got != "2" {
+		t.Errorf("GET after error reply = %q, %v", got, err)
+	}
+
+	if server.dialed() != 1 {
+		t.Errorf("dialed %d connections, want 1 reused", server.dialed())
+	}
+
+	wantSet := []string{"SET", "page", "{\"listings\":[]}\r\n", "PX", "1500"}
+	if got := server.sent()[1]; !reflect.DeepEqual(got, wantSet) {
+		t.Errorf("SET sent %q, want %q", got, wantSet)
+	}
+}
+
+func TestRedisClientAuthAndDB(t *testing.T) {
+	server := newFakeRedis(t)
+
+	client := server.client(t, "/3")
+	client.password = "secret"
+	if err := client.Set(context.Background(), "k", "v", time.Second); err != nil {
+		t.Fatal(err)
+	}
+
+	sent := server.sent()
+	want := [][]string{{"AUTH", "secret"}, {"SELECT", "3"}}
+	if len(sent) < 2 || !reflect.DeepEqual(sent[:2], want) {
+		t.Errorf("sent %q, want %q first", sent, want)
+	}
+
+	client.password = "wrong"
+	client.idle = nil
+	var replyErr redisError
+	if err := client.Set(context.Background(), "k", "v", time.Second); !errors.As(err, &replyErr) {
+		t.Errorf("err = %v, want the WRONGPASS reply", err)
+	}
+}
+
+func TestRedisClientReconnect(t *testing.T) {
+	server := newFakeRedis(t)
+	client := server.client(t, "")
+	ctx := context.Background()
+
+	if _, err := client.Incr(ctx, "n"); err != nil {
+		t.Fatal(err)
+	}
+
+	// pooled connection closed by redis, the command goes through on a new one and runs once
+	server.dropConnections()
+	if got, err := client.Incr(ctx, "n"); err != nil || got != 2 {
+		t.Fatalf("INCR after drop = %d, %v, want 2", got, err)
+	}
+	if server.dialed() != 2 {
+		t.Errorf("dialed %d connections, want 2", server.dialed())
+	}
+	if got, err := client.Incr(ctx, "n"); err != nil || got != 3 {
+		t.Errorf("INCR on the new connection = %d, %v, want 3", got, err)
+	}
+}
+
+func TestRedisClientDown(t *testing.T) {
+	server := newFakeRedis(t)
+	client := server.client(t, "")
+	ctx := context.Background()
+
+	if err := client.Set(ctx, "k", "v", time.Second); err != nil {
+		t.Fatal(err)
+	}
+
+	server.listener.Close()
+	server.dropConnections()
+
+	if _, err := client.Get(ctx, "k"); err == nil {
+		t.Fatal("GET with redis down: err = nil, want connection error")
+	}
+	if len(client.idle) != 0 {
+		t.Errorf("%d connections left in the pool, want the broken one closed", len(client.idle))
+	}
+}
+
+func TestNewRedisClient(t *testing.T) {
+	tests := []struct {
+		url      string
+		addr     string
+		password string
+		db       int
+		wantErr  bool
+	}{
+		{url: "redis://localhost:6380", addr: "localhost:6380"},
+		{url: "redis://cache", addr: "cache:6379"},
+		{url: "redis://:secret@cache:6379/2", addr: "cache:6379", password: "secret", db: 2},
+		{url: "rediss://cache:6379", wantErr: true},
+		{url: "redis://cache:6379/x", wantErr: true},
+		{url: "cache:6379", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.url, func(t *testing.T) {
+			client, err := newRedisClient(tt.url, time.Second)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, want error %t", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if client.addr != tt.addr || client.password != tt.password || client.db != tt.db {
+				t.Errorf("client = %s %q db %d, want %s %q db %d", client.addr, client.password, client.db, tt.addr, tt.password, tt.db)
+			}
+		})
+	}
+}
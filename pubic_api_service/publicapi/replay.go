@@ -0,0 +1,171 @@
+package publicapi
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"apperror"
+	"events"
+
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+)
+
+// replay of the delivered events of a time range to one consumer group, e.g. a new search index or read model
+type EventReplay struct {
+	Group string   `json:"group" binding:"required"`
+	Types []string `json:"types"`
+	// from inclusive, to exclusive
+	From   time.Time `json:"from" binding:"required"`
+	To     time.Time `json:"to" binding:"required"`
+	DryRun bool      `json:"dry_run"`
+}
+
+// =========== INTERFACE HANDLER, HANDLING REQUEST RESPONSE API DEPEND INTERFACE ===========
+
+// replay the user and listing events to a consumer group, or count them on a dry run. A replay waits for approval
+// under ADMIN_APPROVAL_ACTIONS
+func replayEventsHandler(c *gin.Context) {
+	var body EventReplay
+	if err := c.ShouldBindJSON(&body); err != nil {
+		slog.ErrorContext(c.Request.Context(), "handler error", "code", "480", "error", err)
+		apperror.RespondBinding(c, err)
+		return
+	}
+
+	if !body.DryRun && approvalRequired(c, "events.replay") {
+		filter := events.ReplayFilter{Types: body.Types, From: body.From.UnixMicro(), To: body.To.UnixMicro()}
+		if err := filter.Check(); err != nil {
+			apperror.Respond(c, apperror.Validation(err.Error()))
+			return
+		}
+		action, err := requestAdminActionUsecase(c.Request.Context(), authUserID(c), "events.replay", "events", body.Group, body)
+		if err != nil {
+			apperror.Respond(c, err)
+			return
+		}
+		respondAdminActionPending(c, action)
+		return
+	}
+
+	result, err := replayEventsUsecase(c.Request.Context(), body)
+	if err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"replay": result})
+}
+
+// =========== USECASE LAYER, SERVES AS AN INTERMEDIARY BETWEEN THE PRESENTATION LAYER AND THE DATA LAYER ===========
+
+// the user outbox then the listing outbox, each of them only when types asks for its events. The events of one
+// user or listing are published in their order
+func replayEventsUsecase(ctx context.Context, body EventReplay) (*events.ReplayResult, error) {
+	filter := events.ReplayFilter{Types: body.Types, From: body.From.UnixMicro(), To: body.To.UnixMicro()}
+	if err := filter.Check(); err != nil {
+		return nil, apperror.Validation(err.Error())
+	}
+
+	var publisher events.Publisher
+	if !body.DryRun {
+		var err error
+		publisher, err = events.NewReplayPublisher(cfg, cfg.String("OTEL_SERVICE_NAME", "public-api"), body.Group, otelhttp.NewTransport(http.DefaultTransport))
+		if err != nil {
+			if errors.Is(err, events.ErrReplayGroup) {
+				return nil, apperror.Validation(err.Error())
+			}
+			slog.ErrorContext(ctx, "usecase error", "code", "481", "error", err)
+			return nil, apperror.Conflict(err.Error())
+		}
+		defer publisher.Close()
+	}
+
+	result := events.ReplayResult{Group: body.Group, DryRun: body.DryRun, ByType: map[string]int{}}
+	for _, source := range []struct {
+		entity  string
+		history events.History
+	}{
+		{"user", userOutboxHistory{}},
+		{"listing", listingOutbox{}},
+	} {
+		sourceFilter, ok := replayFilterOf(filter, source.entity)
+		if !ok {
+			continue
+		}
+
+		replayed, err := events.Replay(ctx, source.history, publisher, body.Group, sourceFilter, body.DryRun)
+		result.Add(replayed)
+		if err != nil {
+			if errors.Is(err, events.ErrReplayGroup) {
+				return nil, apperror.Validation(err.Error())
+			}
+			slog.ErrorContext(ctx, "usecase error", "code", "482", "error", err, "group", body.Group, "published", result.Published)
+			return nil, apperror.Upstream(fmt.Sprintf("Failed to replay events, %d published", result.Published), err)
+		}
+	}
+
+	slog.InfoContext(ctx, "events replayed", "group", body.Group, "dry_run", body.DryRun, "events", result.Events,
+		"from", filter.From, "to", filter.To)
+	return &result, nil
+}
+
+// filter of the events of entity, false when filter asks for types of other entities only
+func replayFilterOf(filter events.ReplayFilter, entity string) (events.ReplayFilter, bool) {
+	if len(filter.Types) == 0 {
+		return filter, true
+	}
+
+	var types []string
+	for _, eventType := range filter.Types {
+		if strings.HasPrefix(eventType, entity+".") {
+			types = append(types, eventType)
+		}
+	}
+	filter.Types = types
+	return filter, len(types) > 0
+}
+
+// =========== REPOSITORY LAYER, ABSTRACTION OVER THE DATA PERSISTENCE (databases, file systems, or external APIs) ===========
+
+// events.History over the outbox of the user service, one call per page
+type userOutboxHistory struct{}
+
+func (userOutboxHistory) Events(ctx context.Context, filter events.ReplayFilter, afterID int64, limit int) ([]events.Record, error) {
+	res, err := userClient.FindOutboxEvents(ctx, filter, afterID, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	return outboxRecords(res.Events), nil
+}
+
+// user service api path
+var apiPathUserOutbox = userServiceURL + "/outbox"
+
+func (httpUserClient) FindOutboxEvents(ctx context.Context, filter events.ReplayFilter, afterID int64, limit int) (*OutboxEventsResponse, error) {
+	resp, err := httpGet(ctx, apiPathUserOutbox+"?"+outboxEventsQuery(filter, afterID, limit).Encode())
+	if err != nil {
+		slog.ErrorContext(ctx, "service error", "code", "483", "error", err)
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		slog.ErrorContext(ctx, "service error", "code", "484", "error", "error fetching outbox events from user service")
+		return nil, errors.New("error fetching outbox events from user service")
+	}
+
+	var res OutboxEventsResponse
+	if err := decodeJSON(resp.Body, &res); err != nil {
+		slog.ErrorContext(ctx, "service error", "code", "484", "error", err)
+		return nil, err
+	}
+
+	return &res, nil
+}
@@ -0,0 +1,68 @@
+package publicapi
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"apperror"
+	"events"
+)
+
+// outbox of the user service with the delivered events in history
+type outboxUserClient struct {
+	UserClient
+	history []OutboxEvent
+}
+
+func (c outboxUserClient) FindOutboxEvents(ctx context.Context, filter events.ReplayFilter, afterID int64, limit int) (*OutboxEventsResponse, error) {
+	res := &OutboxEventsResponse{Result: true, Events: []OutboxEvent{}}
+	for _, e := range c.history {
+		if e.ID > afterID && e.Event.OccurredAt >= filter.From && e.Event.OccurredAt < filter.To && len(res.Events) < limit {
+			res.Events = append(res.Events, e)
+		}
+	}
+	return res, nil
+}
+
+func TestReplayEventsUsecase(t *testing.T) {
+	start := time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC)
+	var history []OutboxEvent
+	for i := 0; i < 3; i++ {
+		occurredAt := start.Add(time.Duration(i) * time.Hour).UnixMicro()
+		history = append(history, OutboxEvent{ID: int64(i + 1), EventKey: "user:1", Event: events.Event{ID: "e", Type: events.UserUpdated, OccurredAt: occurredAt}})
+	}
+	userClient = outboxUserClient{history: history}
+
+	// listing types are left out so the listing service is not called
+	body := EventReplay{Group: "search", Types: []string{events.UserUpdated}, From: start, To: start.Add(2 * time.Hour), DryRun: true}
+	result, err := replayEventsUsecase(context.Background(), body)
+	if err != nil || result.Events != 2 || result.ByType[events.UserUpdated] != 2 || result.Published != 0 {
+		t.Fatalf("dry run %+v, %v, want the 2 user events of the first 2 hours counted", result, err)
+	}
+
+	for name, body := range map[string]EventReplay{
+		"empty range":   {Group: "search", From: start, To: start, DryRun: true},
+		"unknown type":  {Group: "search", Types: []string{"listing.sold"}, From: start, To: start.Add(time.Hour), DryRun: true},
+		"invalid group": {Group: "search index", Types: []string{events.UserUpdated}, From: start, To: start.Add(time.Hour), DryRun: true},
+	} {
+		if _, err := replayEventsUsecase(context.Background(), body); !errors.Is(err, apperror.ErrValidation) {
+			t.Errorf("%s: %v, want a validation error", name, err)
+		}
+	}
+}
+
+func TestReplayFilterOf(t *testing.T) {
+	filter := events.ReplayFilter{Types: []string{events.UserCreated, events.ListingDeleted}, From: 1, To: 2}
+
+	if users, ok := replayFilterOf(filter, "user"); !ok || len(users.Types) != 1 || users.Types[0] != events.UserCreated {
+		t.Errorf("user filter %+v %t, want user.created only", users, ok)
+	}
+	if _, ok := replayFilterOf(events.ReplayFilter{Types: []string{events.UserCreated}, From: 1, To: 2}, "listing"); ok {
+		t.Error("listing filter of user types only, want none")
+	}
+	if all, ok := replayFilterOf(events.ReplayFilter{From: 1, To: 2}, "listing"); !ok || len(all.Types) != 0 {
+		t.Errorf("listing filter %+v %t, want every type", all, ok)
+	}
+}
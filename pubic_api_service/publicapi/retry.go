@@ -0,0 +1,111 @@
+package publicapi
+
+import (
+	"io"
+	"log/slog"
+	"math/rand"
+	"net/http"
+	"time"
+)
+
+// =========== REPOSITORY LAYER, RETRY TRANSIENT FAILURES OF DOWNSTREAM CALLS ===========
+
+// methods safe to send twice, a retried POST could create the same user or listing twice unless it carries an Idempotency-Key
+var idempotentMethods = map[string]bool{
+	http.MethodGet:     true,
+	http.MethodHead:    true,
+	http.MethodOptions: true,
+	http.MethodPut:     true,
+	http.MethodDelete:  true,
+}
+
+// retry idempotent requests on connection errors and 5xx with exponential backoff and full jitter
+type retryTransport struct {
+	base        http.RoundTripper
+	maxAttempts int
+	backoff     time.Duration
+	maxBackoff  time.Duration
+}
+
+// DOWNSTREAM_RETRY_MAX_ATTEMPTS attempts per call including the first one, 1 disables retries
+// DOWNSTREAM_RETRY_BACKOFF base wait before the second attempt, doubled on every next one
+// DOWNSTREAM_RETRY_MAX_BACKOFF upper bound of a single wait
+func newRetryTransport(base http.RoundTripper) *retryTransport {
+	return &retryTransport{
+		base:        base,
+		maxAttempts: cfg.Int("DOWNSTREAM_RETRY_MAX_ATTEMPTS", 3),
+		backoff:     cfg.Duration("DOWNSTREAM_RETRY_BACKOFF", 100*time.Millisecond),
+		maxBackoff:  cfg.Duration("DOWNSTREAM_RETRY_MAX_BACKOFF", time.Second),
+	}
+}
+
+func (t *retryTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if (!idempotentMethods[req.Method] && req.Header.Get(headerIdempotencyKey) == "") || t.maxAttempts <= 1 {
+		return t.base.RoundTrip(req)
+	}
+
+	for attempt := 1; ; attempt++ {
+		resp, err := t.base.RoundTrip(req)
+		if attempt >= t.maxAttempts || !retryable(resp, err) || req.Context().Err() != nil {
+			return resp, err
+		}
+
+		// body of a sent request is consumed, skip retry when it can not be rebuilt
+		if req.Body != nil && req.Body != http.NoBody {
+			if req.GetBody == nil {
+				return resp, err
+			}
+			body, bodyErr := req.GetBody()
+			if bodyErr != nil {
+				return resp, err
+			}
+			req = req.Clone(req.Context())
+			req.Body = body
+		}
+
+		if resp != nil {
+			io.Copy(io.Discard, resp.Body)
+			resp.Body.Close()
+		}
+		recordRetry(req.Context())
+		slog.WarnContext(req.Context(), "downstream attempt failed, retrying", "method", req.Method, "path", req.URL.Path, "attempt", attempt, "status", statusOf(resp), "error", err)
+
+		timer := time.NewTimer(retryWait(t.backoff, t.maxBackoff, attempt))
+		select {
+		case <-req.Context().Done():
+			timer.Stop()
+			return nil, req.Context().Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// full jitter, random wait between 0 and backoff * 2^(attempt-1) capped by maxBackoff
+func retryWait(backoff, maxBackoff time.Duration, attempt int) time.Duration {
+	wait := backoff << (attempt - 1)
+	if wait <= 0 || wait > maxBackoff {
+		wait = maxBackoff
+	}
+	if wait <= 0 {
+		return 0
+	}
+
+	return time.Duration(rand.Int63n(int64(wait) + 1))
+}
+
+// connection errors and 5xx are worth another attempt, 4xx answers are final
+func retryable(resp *http.Response, err error) bool {
+	if err != nil {
+		return true
+	}
+
+	return resp.StatusCode >= http.StatusInternalServerError
+}
+
+func statusOf(resp *http.Response) string {
+	if resp == nil {
+		return "none"
+	}
+
+	return resp.Status
+}
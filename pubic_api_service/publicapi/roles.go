@@ -0,0 +1,306 @@
+package publicapi
+
+import (
+	"bytes"
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+
+	"apperror"
+
+	"github.com/gin-gonic/gin"
+)
+
+// roles of a user kept by the user service, new users are user. Only admins call the admin operations, only auditors
+// read the audit chain, agents are shown as such on their listings
+const (
+	roleUser    = "user"
+	roleAgent   = "agent"
+	roleAdmin   = "admin"
+	roleAuditor = "auditor"
+)
+
+type UserRole struct {
+	Role string `json:"role" binding:"required,oneof=user agent admin auditor"`
+}
+
+// page of every user, for admins
+type UsersPageResponse struct {
+	Result     bool `json:"result"`
+	Users      []User
+	Pagination Pagination `json:"pagination"`
+}
+
+var (
+	errUsersPage = apperror.Validation("page_num must be at least 1 and page_size between 1 and 100")
+	errOwnRole   = apperror.Validation("admins can not change their own role")
+)
+
+// =========== MIDDLEWARE LAYER, RUN BEFORE INTERFACE HANDLER TO ENRICH OR GUARD THE REQUEST ===========
+
+// operators holding the internal api key or users with the admin role, only admins pass when no key is set
+func adminMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if internalAPIKey != "" && subtle.ConstantTimeCompare([]byte(c.GetHeader(headerAPIKey)), []byte(internalAPIKey)) == 1 {
+			c.Next()
+			return
+		}
+
+		if authenticate(c) && authorize(c, roleAdmin) {
+			c.Next()
+		}
+	}
+}
+
+// operators holding the internal api key or users with the auditor role. Admins do not pass, the chain is kept to
+// check what they did
+func auditorMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if internalAPIKey != "" && subtle.ConstantTimeCompare([]byte(c.GetHeader(headerAPIKey)), []byte(internalAPIKey)) == 1 {
+			c.Next()
+			return
+		}
+
+		if authenticate(c) && authorize(c, roleAuditor) {
+			c.Next()
+		}
+	}
+}
+
+// false with the request aborted when the authenticated user has none of roles. The role is read from the user
+// service on every call, never from the cache, so a revoked role stops working at once
+func authorize(c *gin.Context, roles ...string) bool {
+	res, err := userClient.FindUser(c.Request.Context(), authUserID(c))
+	if err != nil {
+		if errors.Is(err, ErrUserNotFound) {
+			apperror.Abort(c, http.StatusForbidden, "User not allowed")
+			return false
+		}
+		slog.ErrorContext(c.Request.Context(), "middleware error", "code", "444", "error", err)
+		apperror.Abort(c, http.StatusBadGateway, "Failed to get user")
+		return false
+	}
+
+	if !slices.Contains(roles, res.User.Role) {
+		slog.WarnContext(c.Request.Context(), "role not allowed", "user_id", res.User.ID, "role", res.User.Role, "path", c.FullPath())
+		apperror.Abort(c, http.StatusForbidden, "User not allowed")
+		return false
+	}
+
+	return true
+}
+
+// =========== INTERFACE HANDLER, HANDLING REQUEST RESPONSE API DEPEND INTERFACE ===========
+
+// every user with their role, newest first
+func getAdminUsersHandler(c *gin.Context) {
+	pageNum, errNum := strconv.Atoi(c.DefaultQuery("page_num", "1"))
+	pageSize, errSize := strconv.Atoi(c.DefaultQuery("page_size", "10"))
+	if errNum != nil || errSize != nil {
+		apperror.Respond(c, errUsersPage)
+		return
+	}
+
+	res, err := getAdminUsersUsecase(c.Request.Context(), pageNum, pageSize)
+	if err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"users": res.Users, "pagination": res.Pagination})
+}
+
+// set the role of a user, waits for approval under ADMIN_APPROVAL_ACTIONS
+func setUserRoleHandler(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "handler error", "code", "445", "error", err)
+		apperror.JSON(c, http.StatusBadRequest, "Invalid user ID")
+		return
+	}
+
+	var body UserRole
+	if err := c.ShouldBindJSON(&body); err != nil {
+		slog.ErrorContext(c.Request.Context(), "handler error", "code", "446", "error", err)
+		apperror.RespondBinding(c, err)
+		return
+	}
+
+	if approvalRequired(c, "user.role") {
+		if authUserID(c) == id {
+			apperror.Respond(c, errOwnRole)
+			return
+		}
+		action, err := requestAdminActionUsecase(c.Request.Context(), authUserID(c), "user.role", "users", strconv.Itoa(id), body)
+		if err != nil {
+			apperror.Respond(c, err)
+			return
+		}
+		respondAdminActionPending(c, action)
+		return
+	}
+
+	user, err := setUserRoleUsecase(c.Request.Context(), authUserID(c), id, body)
+	if err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"user": user})
+}
+
+// delete a listing of any user, soft unless hard=true. A hard delete waits for approval under ADMIN_APPROVAL_ACTIONS
+func adminDeleteListingHandler(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "handler error", "code", "447", "error", err)
+		apperror.JSON(c, http.StatusBadRequest, "Invalid listing ID")
+		return
+	}
+
+	hard := c.Query("hard") == "true"
+	if hard && approvalRequired(c, "listing.purge") {
+		action, err := requestAdminActionUsecase(c.Request.Context(), authUserID(c), "listing.purge", "listings", strconv.Itoa(id), nil)
+		if err != nil {
+			apperror.Respond(c, err)
+			return
+		}
+		respondAdminActionPending(c, action)
+		return
+	}
+
+	if err := adminDeleteListingUsecase(c.Request.Context(), id, hard); err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// =========== USECASE LAYER, SERVES AS AN INTERMEDIARY BETWEEN THE PRESENTATION LAYER AND THE DATA LAYER ===========
+
+func getAdminUsersUsecase(ctx context.Context, pageNum, pageSize int) (*UsersPageResponse, error) {
+	if pageNum < 1 || pageSize < 1 || pageSize > 100 {
+		return nil, errUsersPage
+	}
+
+	res, err := userClient.ListUsers(ctx, pageNum, pageSize)
+	if err != nil {
+		return nil, apperror.Upstream("Failed to get users", err)
+	}
+
+	return res, nil
+}
+
+// an admin keeps their own role, so the last admin can not lock every admin out
+func setUserRoleUsecase(ctx context.Context, actorID, userID int, role UserRole) (*User, error) {
+	if actorID == userID {
+		return nil, errOwnRole
+	}
+
+	roleJSON, err := json.Marshal(role)
+	if err != nil {
+		slog.ErrorContext(ctx, "usecase error", "code", "448", "error", err)
+		return nil, err
+	}
+
+	auditBefore(ctx, auditUserLookup(ctx, userID))
+
+	res, err := userClient.SetUserRole(ctx, userID, roleJSON)
+	// the role shows on the listings of the user, drop the cached one even when the call failed
+	cachedUsers.invalidate(userID)
+	if err != nil {
+		if errors.Is(err, ErrUserNotFound) {
+			return nil, err
+		}
+		return nil, apperror.Upstream("Failed to set user role", err)
+	}
+
+	return &res.User, nil
+}
+
+func adminDeleteListingUsecase(ctx context.Context, id int, hard bool) error {
+	auditBefore(ctx, func() (any, error) {
+		listing, err := findListingByIDService(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		return listing.Listing, nil
+	})
+	if err := deleteListingService(ctx, id, hard); err != nil {
+		if errors.Is(err, errListingNotFound) || errors.Is(err, errListingLegalHold) {
+			return err
+		}
+		return apperror.Upstream("Failed to delete listing", err)
+	}
+
+	return nil
+}
+
+// =========== REPOSITORY LAYER, ABSTRACTION OVER THE DATA PERSISTENCE (databases, file systems, or external APIs) ===========
+
+// user service api path
+var apiPathUserRole = userServiceURL + "/users/%d/role"
+
+func (httpUserClient) ListUsers(ctx context.Context, pageNum, pageSize int) (*UsersPageResponse, error) {
+	query := url.Values{"page_num": {strconv.Itoa(pageNum)}, "page_size": {strconv.Itoa(pageSize)}}
+	resp, err := httpGet(ctx, apiPathUserCreate+"?"+query.Encode())
+	if err != nil {
+		slog.ErrorContext(ctx, "service error", "code", "449", "error", err)
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		slog.ErrorContext(ctx, "service error", "code", "450", "error", "error fetching users from user service")
+		return nil, errors.New("error fetching users from user service")
+	}
+
+	var users UsersPageResponse
+	if err := decodeJSON(resp.Body, &users); err != nil {
+		slog.ErrorContext(ctx, "service error", "code", "450", "error", err)
+		return nil, err
+	}
+
+	return &users, nil
+}
+
+func (httpUserClient) SetUserRole(ctx context.Context, userID int, roleByte []byte) (*UserResponse, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, fmt.Sprintf(apiPathUserRole, userID), bytes.NewBuffer(roleByte))
+	if err != nil {
+		slog.ErrorContext(ctx, "service error", "code", "451", "error", err)
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		slog.ErrorContext(ctx, "service error", "code", "451", "error", err)
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		return nil, ErrUserNotFound
+	default:
+		slog.ErrorContext(ctx, "service error", "code", "452", "error", "error setting user role from user service")
+		return nil, errors.New("error setting user role from user service")
+	}
+
+	var user UserResponse
+	if err := decodeJSON(resp.Body, &user); err != nil {
+		slog.ErrorContext(ctx, "service error", "code", "452", "error", err)
+		return nil, err
+	}
+
+	return &user, nil
+}
@@ -0,0 +1,90 @@
+package publicapi
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// users with their role, audit entries recorded are kept in audit
+type roleUserClient struct {
+	UserClient
+	roles map[int]string
+	audit *[]AuditEntry
+}
+
+func (c roleUserClient) FindUser(ctx context.Context, userID int) (*UserResponse, error) {
+	role, ok := c.roles[userID]
+	if !ok {
+		return nil, ErrUserNotFound
+	}
+	return &UserResponse{Result: true, User: User{ID: userID, Role: role}}, nil
+}
+
+func (c roleUserClient) RecordAudit(ctx context.Context, entryByte []byte) error {
+	var entry AuditEntry
+	if err := json.Unmarshal(entryByte, &entry); err != nil {
+		return err
+	}
+	*c.audit = append(*c.audit, entry)
+	return nil
+}
+
+func TestAdminMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	var audit []AuditEntry
+	userClient = roleUserClient{roles: map[int]string{1: roleAdmin, 2: roleAgent}, audit: &audit}
+	jwtSecret, internalAPIKey = []byte("secret"), "key"
+	defer func() { jwtSecret, internalAPIKey = nil, "" }()
+
+	router := gin.New()
+	router.Use(auditMiddleware())
+	admin := router.Group("/public-api/admin", adminMiddleware())
+	admin.DELETE("/listings/:id", func(c *gin.Context) { c.Status(http.StatusNoContent) })
+
+	token := func(userID int) string {
+		claims := jwt.RegisteredClaims{Subject: strconv.Itoa(userID), ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour))}
+		signed, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(jwtSecret)
+		if err != nil {
+			t.Fatalf("sign token: %v", err)
+		}
+		return "Bearer " + signed
+	}
+
+	tests := []struct {
+		name   string
+		header map[string]string
+		want   int
+	}{
+		{"admin", map[string]string{"Authorization": token(1)}, http.StatusNoContent},
+		{"agent", map[string]string{"Authorization": token(2)}, http.StatusForbidden},
+		{"unknown user", map[string]string{"Authorization": token(3)}, http.StatusForbidden},
+		{"no token", nil, http.StatusUnauthorized},
+		{"api key", map[string]string{headerAPIKey: "key"}, http.StatusNoContent},
+		{"wrong api key", map[string]string{headerAPIKey: "nope"}, http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodDelete, "/public-api/admin/listings/7?hard=true", nil)
+		for key, value := range tt.header {
+			req.Header.Set(key, value)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		if w.Code != tt.want {
+			t.Errorf("%s: status %d, want %d", tt.name, w.Code, tt.want)
+		}
+	}
+
+	want := AuditEntry{ActorID: 1, Action: "DELETE /admin/listings/:id", Entity: "listings", EntityID: "7", Detail: "hard=true"}
+	if len(audit) != 2 || !reflect.DeepEqual(audit[0], want) || audit[1].ActorID != 0 {
+		t.Errorf("audit %+v, want %+v then the same by actor 0", audit, want)
+	}
+}
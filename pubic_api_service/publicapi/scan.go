@@ -0,0 +1,223 @@
+package publicapi
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"log/slog"
+	"mime/multipart"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// ScanResult outcome of scanning one uploaded file, recorded with the media
+type ScanResult struct {
+	// clean, infected or skipped when no scanner is configured
+	Status    string
+	Engine    string
+	Signature string
+	ScannedAt time.Time
+}
+
+const (
+	scanStatusClean    = "clean"
+	scanStatusInfected = "infected"
+	scanStatusSkipped  = "skipped"
+)
+
+// FileScanner checks an upload for malware before it is stored, implemented by any scan engine
+type FileScanner interface {
+	Scan(ctx context.Context, r io.Reader) (ScanResult, error)
+}
+
+var (
+	errFileInfected        = errors.New("file rejected by malware scan")
+	errFileScanUnavailable = errors.New("malware scan unavailable")
+)
+
+var (
+	// scanner of every media and video upload, the one of MEDIA_SCANNER once Run started
+	fileScanner FileScanner = noopScanner{}
+
+	// MEDIA_QUARANTINE_DIR directory infected uploads are moved to, never served
+	mediaQuarantineDir = cfg.String("MEDIA_QUARANTINE_DIR", filepath.Join(mediaDir, "quarantine"))
+)
+
+// MEDIA_SCANNER none or clamav, clamav streams uploads to clamd on CLAMAV_ADDR
+func newFileScanner() FileScanner {
+	name := cfg.String("MEDIA_SCANNER", "none")
+
+	var scanner FileScanner
+	switch name {
+	case "none":
+		scanner = noopScanner{}
+	case "clamav":
+		scanner = &clamdScanner{
+			// CLAMAV_ADDR host:port of clamd
+			addr: cfg.String("CLAMAV_ADDR", "localhost:3310"),
+			// MEDIA_SCAN_TIMEOUT max duration of one scan
+			timeout: cfg.Duration("MEDIA_SCAN_TIMEOUT", 30*time.Second),
+		}
+	default:
+		log.Fatalf("unknown MEDIA_SCANNER %q, one of: clamav, none", name)
+	}
+
+	slog.Info("media scanner", "scanner", name)
+	return scanner
+}
+
+// =========== USECASE LAYER, SERVES AS AN INTERMEDIARY BETWEEN THE PRESENTATION LAYER AND THE DATA LAYER ===========
+
+// scan upload before it is stored, an infected file is kept in the quarantine directory and errFileInfected returned
+func scanUpload(ctx context.Context, listingID int, file *multipart.FileHeader) (ScanResult, error) {
+	src, err := file.Open()
+	if err != nil {
+		return ScanResult{}, err
+	}
+	defer src.Close()
+
+	result, err := fileScanner.Scan(ctx, src)
+	if err != nil {
+		slog.ErrorContext(ctx, "usecase error", "code", "254", "error", err)
+		return ScanResult{}, errFileScanUnavailable
+	}
+
+	if result.Status == scanStatusInfected {
+		path, err := quarantineUpload(listingID, file)
+		if err != nil {
+			slog.ErrorContext(ctx, "usecase error", "code", "255", "error", err)
+		}
+		slog.WarnContext(ctx, "upload quarantined", "listing_id", listingID, "engine", result.Engine,
+			"signature", result.Signature, "path", path)
+		return result, errFileInfected
+	}
+
+	return result, nil
+}
+
+// copy upload to the quarantine directory for inspection
+func quarantineUpload(listingID int, file *multipart.FileHeader) (string, error) {
+	if err := os.MkdirAll(mediaQuarantineDir, 0o700); err != nil {
+		return "", err
+	}
+
+	name := fmt.Sprintf("%d-%d%s", listingID, time.Now().UnixNano(), strings.ToLower(filepath.Ext(file.Filename)))
+	path := filepath.Join(mediaQuarantineDir, name)
+
+	src, err := file.Open()
+	if err != nil {
+		return "", err
+	}
+	defer src.Close()
+
+	dst, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_EXCL, 0o600)
+	if err != nil {
+		return "", err
+	}
+	defer dst.Close()
+
+	if _, err := dst.ReadFrom(src); err != nil {
+		os.Remove(path)
+		return "", err
+	}
+
+	return path, nil
+}
+
+// =========== REPOSITORY LAYER, ABSTRACTION OVER THE DATA PERSISTENCE (databases, file systems, or external APIs) ===========
+
+// scanner used without MEDIA_SCANNER, every upload passes as skipped
+type noopScanner struct{}
+
+func (noopScanner) Scan(ctx context.Context, r io.Reader) (ScanResult, error) {
+	return ScanResult{Status: scanStatusSkipped, Engine: "none", ScannedAt: time.Now()}, nil
+}
+
+// clamd over its INSTREAM command, the file is sent in length prefixed chunks on a new connection per scan
+type clamdScanner struct {
+	addr    string
+	timeout time.Duration
+}
+
+// chunk size of INSTREAM, below the default StreamMaxLength of clamd
+const clamdChunkSize = 64 << 10
+
+func (s *clamdScanner) Scan(ctx context.Context, r io.Reader) (ScanResult, error) {
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", s.addr)
+	if err != nil {
+		return ScanResult{}, err
+	}
+	defer conn.Close()
+
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+
+	// z prefixed commands and replies end with a NUL byte
+	if _, err := conn.Write([]byte("zINSTREAM\x00")); err != nil {
+		return ScanResult{}, err
+	}
+
+	buf := make([]byte, clamdChunkSize)
+	size := make([]byte, 4)
+	for {
+		n, err := r.Read(buf)
+		if n > 0 {
+			binary.BigEndian.PutUint32(size, uint32(n))
+			if _, err := conn.Write(size); err != nil {
+				return ScanResult{}, err
+			}
+			if _, err := conn.Write(buf[:n]); err != nil {
+				return ScanResult{}, err
+			}
+		}
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return ScanResult{}, err
+		}
+	}
+
+	// zero length chunk ends the stream
+	binary.BigEndian.PutUint32(size, 0)
+	if _, err := conn.Write(size); err != nil {
+		return ScanResult{}, err
+	}
+
+	reply, err := bufio.NewReader(conn).ReadString(0)
+	if err != nil {
+		return ScanResult{}, err
+	}
+
+	return parseClamdReply(strings.TrimRight(reply, "\x00"))
+}
+
+// "stream: OK", "stream: <signature> FOUND" or "<message> ERROR"
+func parseClamdReply(reply string) (ScanResult, error) {
+	result := ScanResult{Engine: "clamav", ScannedAt: time.Now()}
+
+	status, found := strings.CutPrefix(reply, "stream: ")
+	switch {
+	case found && status == "OK":
+		result.Status = scanStatusClean
+	case found && strings.HasSuffix(status, " FOUND"):
+		result.Status = scanStatusInfected
+		result.Signature = strings.TrimSuffix(status, " FOUND")
+	default:
+		return ScanResult{}, fmt.Errorf("clamd: %s", reply)
+	}
+
+	return result, nil
+}
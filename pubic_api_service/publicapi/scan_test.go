@@ -0,0 +1,115 @@
+package publicapi
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+// clamd answering one INSTREAM scan per connection with reply, the streamed content is sent on received
+func newClamdStub(t *testing.T, reply string) (string, <-chan []byte) {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	received := make(chan []byte, 1)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		reader := bufio.NewReader(conn)
+		command, err := reader.ReadString(0)
+		if err != nil || command != "zINSTREAM\x00" {
+			t.Errorf("command = %q, want zINSTREAM", command)
+			return
+		}
+
+		var content bytes.Buffer
+		size := make([]byte, 4)
+		for {
+			if _, err := io.ReadFull(reader, size); err != nil {
+				t.Error(err)
+				return
+			}
+			n := binary.BigEndian.Uint32(size)
+			if n == 0 {
+				break
+			}
+			if _, err := io.CopyN(&content, reader, int64(n)); err != nil {
+				t.Error(err)
+				return
+			}
+		}
+		received <- content.Bytes()
+
+		conn.Write([]byte(reply + "\x00"))
+	}()
+
+	return listener.Addr().String(), received
+}
+
+func TestClamdScanner(t *testing.T) {
+	tests := []struct {
+		name      string
+		content   string
+		reply     string
+		status    string
+		signature string
+		wantErr   bool
+	}{
+		{name: "clean", content: "photo", reply: "stream: OK", status: scanStatusClean},
+		{name: "infected", content: "X5O!P%@AP", reply: "stream: Win.Test.EICAR_HDB-1 FOUND", status: scanStatusInfected, signature: "Win.Test.EICAR_HDB-1"},
+		{name: "larger than one chunk", content: strings.Repeat("a", clamdChunkSize*2+1), reply: "stream: OK", status: scanStatusClean},
+		{name: "empty file", reply: "stream: OK", status: scanStatusClean},
+		{name: "clamd error", content: "photo", reply: "INSTREAM size limit exceeded. ERROR", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			addr, received := newClamdStub(t, tt.reply)
+			scanner := &clamdScanner{addr: addr, timeout: 5 * time.Second}
+
+			result, err := scanner.Scan(context.Background(), strings.NewReader(tt.content))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, want error %t", err, tt.wantErr)
+			}
+			if got := <-received; string(got) != tt.content {
+				t.Errorf("clamd received %d bytes, want %d", len(got), len(tt.content))
+			}
+			if tt.wantErr {
+				return
+			}
+
+			if result.Status != tt.status || result.Signature != tt.signature || result.Engine != "clamav" {
+				t.Errorf("result = %+v, want status %q signature %q", result, tt.status, tt.signature)
+			}
+		})
+	}
+}
+
+func TestClamdScannerUnreachable(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := listener.Addr().String()
+	listener.Close()
+
+	scanner := &clamdScanner{addr: addr, timeout: time.Second}
+	if _, err := scanner.Scan(context.Background(), strings.NewReader("photo")); err == nil {
+		t.Error("err = nil, want connection error")
+	}
+}
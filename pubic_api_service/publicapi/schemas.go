@@ -0,0 +1,90 @@
+package publicapi
+
+import (
+	"log/slog"
+	"net/http"
+	"strconv"
+
+	"apperror"
+	"events"
+
+	"github.com/gin-gonic/gin"
+)
+
+// version of the schema of the data of an event type
+type EventSchema struct {
+	Type    string         `json:"type"`
+	Version int            `json:"version"`
+	Current bool           `json:"current"`
+	Schema  *events.Schema `json:"schema"`
+}
+
+// result of checking a candidate schema against the current version of its event type
+type SchemaCompatibility struct {
+	Type       string   `json:"type"`
+	Version    int      `json:"version"`
+	Compatible bool     `json:"compatible"`
+	Problems   []string `json:"problems,omitempty"`
+}
+
+var ErrEventSchemaNotFound = apperror.NotFound("Event schema not found")
+
+// =========== INTERFACE HANDLER, HANDLING REQUEST RESPONSE API DEPEND INTERFACE ===========
+
+// every version of the schema of every event type, for consumers to validate or generate their types
+func getEventSchemasHandler(c *gin.Context) {
+	var schemas []EventSchema
+	for _, eventType := range events.Types {
+		for version := 1; version <= events.SchemaVersion(eventType); version++ {
+			schemas = append(schemas, eventSchema(eventType, version))
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{"schemas": schemas})
+}
+
+// schema of one version of an event type, the bare JSON Schema document
+func getEventSchemaHandler(c *gin.Context) {
+	version, err := strconv.Atoi(c.Param("version"))
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "handler error", "code", "510", "error", err)
+		apperror.Respond(c, ErrEventSchemaNotFound)
+		return
+	}
+
+	schema, ok := events.SchemaOf(c.Param("type"), version)
+	if !ok {
+		apperror.Respond(c, ErrEventSchemaNotFound)
+		return
+	}
+
+	c.JSON(http.StatusOK, schema)
+}
+
+// check whether a candidate next version of the schema of an event type keeps the consumers of the current one
+// working, before its file is added to the registry
+func checkEventSchemaHandler(c *gin.Context) {
+	eventType := c.Param("type")
+	current, ok := events.SchemaOf(eventType, events.SchemaVersion(eventType))
+	if !ok {
+		apperror.Respond(c, ErrEventSchemaNotFound)
+		return
+	}
+
+	var candidate events.Schema
+	if err := c.ShouldBindJSON(&candidate); err != nil {
+		slog.ErrorContext(c.Request.Context(), "handler error", "code", "511", "error", err)
+		apperror.RespondBinding(c, err)
+		return
+	}
+
+	problems := events.Incompatibilities(current, &candidate)
+	result := SchemaCompatibility{Type: eventType, Version: events.SchemaVersion(eventType), Compatible: len(problems) == 0, Problems: problems}
+
+	c.JSON(http.StatusOK, gin.H{"compatibility": result})
+}
+
+func eventSchema(eventType string, version int) EventSchema {
+	schema, _ := events.SchemaOf(eventType, version)
+	return EventSchema{Type: eventType, Version: version, Current: version == events.SchemaVersion(eventType), Schema: schema}
+}
@@ -0,0 +1,54 @@
+package publicapi
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestEventSchemaHandlers(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.GET("/events/schemas", getEventSchemasHandler)
+	router.GET("/events/schemas/:type/:version", getEventSchemaHandler)
+	router.POST("/events/schemas/:type/compatibility", checkEventSchemaHandler)
+
+	serve := func(method, path, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(method, path, strings.NewReader(body)))
+		return w
+	}
+
+	var list struct {
+		Schemas []EventSchema `json:"schemas"`
+	}
+	w := serve(http.MethodGet, "/events/schemas", "")
+	if err := json.Unmarshal(w.Body.Bytes(), &list); err != nil || len(list.Schemas) < 6 || !list.Schemas[0].Current {
+		t.Fatalf("schemas %d %s, want every version of the 6 types", w.Code, w.Body)
+	}
+
+	if w := serve(http.MethodGet, "/events/schemas/listing.created/1", ""); w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"$id":"listing.created.v1"`) {
+		t.Errorf("listing.created v1 %d %s, want the schema document", w.Code, w.Body)
+	}
+	for _, path := range []string{"/events/schemas/listing.created/9", "/events/schemas/listing.sold/1", "/events/schemas/listing.created/v1"} {
+		if w := serve(http.MethodGet, path, ""); w.Code != http.StatusNotFound {
+			t.Errorf("%s %d, want 404", path, w.Code)
+		}
+	}
+
+	var check struct {
+		Compatibility SchemaCompatibility `json:"compatibility"`
+	}
+	w = serve(http.MethodPost, "/events/schemas/user.deleted/compatibility", `{"type": "object", "required": ["id", "deleted_at"], "properties": {"id": {"type": "integer"}, "deleted_at": {"type": "integer"}}}`)
+	if err := json.Unmarshal(w.Body.Bytes(), &check); err != nil || !check.Compatibility.Compatible || check.Compatibility.Version != 1 {
+		t.Errorf("adding a property %d %s, want compatible with version 1", w.Code, w.Body)
+	}
+	w = serve(http.MethodPost, "/events/schemas/user.deleted/compatibility", `{"type": "object", "properties": {"id": {"type": "string"}}}`)
+	if err := json.Unmarshal(w.Body.Bytes(), &check); err != nil || check.Compatibility.Compatible || len(check.Compatibility.Problems) != 2 {
+		t.Errorf("id optional string %d %s, want 2 problems", w.Code, w.Body)
+	}
+}
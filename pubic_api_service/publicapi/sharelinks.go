@@ -0,0 +1,293 @@
+package publicapi
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"apperror"
+
+	"github.com/gin-gonic/gin"
+)
+
+// short code of a listing shared by a user, the utm parameters are added to the listing page it redirects to
+type ShareLink struct {
+	ID            int    `json:"id"`
+	Code          string `json:"code"`
+	URL           string `json:"url"`
+	ListingID     int    `json:"listing_id"`
+	CreatedBy     int    `json:"created_by"`
+	UTMSource     string `json:"utm_source"`
+	UTMMedium     string `json:"utm_medium"`
+	UTMCampaign   string `json:"utm_campaign"`
+	Clicks        int    `json:"clicks"`
+	LastClickedAt *int64 `json:"last_clicked_at"`
+	CreatedAt     int64  `json:"created_at"`
+}
+
+type ShareLinkCreate struct {
+	UTMSource   string `json:"utm_source" binding:"max=200"`
+	UTMMedium   string `json:"utm_medium" binding:"max=200"`
+	UTMCampaign string `json:"utm_campaign" binding:"max=200"`
+}
+
+type ShareLinkResponse struct {
+	Result    bool      `json:"result"`
+	ShareLink ShareLink `json:"share_link"`
+}
+
+type ShareLinksResponse struct {
+	Result     bool        `json:"result"`
+	ShareLinks []ShareLink `json:"share_links"`
+}
+
+var (
+	// SHARE_LINK_BASE_URL prefix of the short urls returned to clients, e.g. https://99.co
+	// LISTING_PAGE_URL page a share link redirects to, {id} is replaced by the listing id
+	shareLinkBaseURL = strings.TrimRight(cfg.String("SHARE_LINK_BASE_URL", ""), "/")
+	listingPageURL   = cfg.String("LISTING_PAGE_URL", "/listings/{id}")
+
+	shareLinkCode = regexp.MustCompile(`^[0-9A-Za-z]{1,32}$`)
+
+	errShareLinkNotFound = apperror.NotFound("Share link not found")
+)
+
+// =========== INTERFACE HANDLER, HANDLING REQUEST RESPONSE API DEPEND INTERFACE ===========
+
+func createShareLinkHandler(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "handler error", "code", "260", "error", err)
+		apperror.JSON(c, http.StatusBadRequest, "Invalid listing ID")
+		return
+	}
+
+	// a link without utm parameters may come without a body
+	var body ShareLinkCreate
+	if err := c.ShouldBindJSON(&body); err != nil && !errors.Is(err, io.EOF) {
+		slog.ErrorContext(c.Request.Context(), "handler error", "code", "261", "error", "Invalid body request")
+		apperror.RespondBinding(c, err)
+		return
+	}
+
+	res, err := createShareLinkUsecase(c.Request.Context(), id, authUserID(c), body)
+	if err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"share_link": res})
+}
+
+func getShareLinksHandler(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "handler error", "code", "262", "error", err)
+		apperror.JSON(c, http.StatusBadRequest, "Invalid listing ID")
+		return
+	}
+
+	res, err := getShareLinksUsecase(c.Request.Context(), id, authUserID(c))
+	if err != nil {
+		if errors.Is(err, errListingNotOwned) {
+			apperror.JSON(c, http.StatusForbidden, "Listing does not belong to user")
+			return
+		}
+		apperror.Respond(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"share_links": res})
+}
+
+// record the click then redirect to the listing page
+func resolveShareLinkHandler(c *gin.Context) {
+	var country string
+	if geo := clientGeo(c); geo != nil {
+		country = geo.Country
+	}
+
+	target, err := resolveShareLinkUsecase(c.Request.Context(), c.Param("code"), c.Request.Referer(), country)
+	if err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+
+	// the page of the listing is the one to index, not the short url
+	c.Header("X-Robots-Tag", "noindex")
+	c.Redirect(http.StatusFound, target)
+}
+
+// =========== USECASE LAYER, SERVES AS AN INTERMEDIARY BETWEEN THE PRESENTATION LAYER AND THE DATA LAYER ===========
+
+// share link of any listing still listed, created by the user
+func createShareLinkUsecase(ctx context.Context, listingID, userID int, body ShareLinkCreate) (*ShareLink, error) {
+	form := url.Values{
+		"created_by":   {strconv.Itoa(userID)},
+		"utm_source":   {body.UTMSource},
+		"utm_medium":   {body.UTMMedium},
+		"utm_campaign": {body.UTMCampaign},
+	}
+	res, err := createShareLinkService(ctx, listingID, form)
+	if err != nil {
+		return nil, err
+	}
+
+	res.ShareLink.URL = shareLinkURL(res.ShareLink.Code)
+	return &res.ShareLink, nil
+}
+
+// share links of a listing of the user with their clicks, newest first
+func getShareLinksUsecase(ctx context.Context, listingID, userID int) ([]ShareLink, error) {
+	if err := checkListingOwner(ctx, listingID, userID); err != nil {
+		return nil, err
+	}
+
+	res, err := getShareLinksService(ctx, listingID)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range res.ShareLinks {
+		res.ShareLinks[i].URL = shareLinkURL(res.ShareLinks[i].Code)
+	}
+	return res.ShareLinks, nil
+}
+
+// url of the listing page of the code after recording the click
+func resolveShareLinkUsecase(ctx context.Context, code, referrer, country string) (string, error) {
+	if !shareLinkCode.MatchString(code) {
+		return "", errShareLinkNotFound
+	}
+
+	form := url.Values{"referrer": {referrer}, "country": {country}}
+	res, err := recordShareLinkClickService(ctx, code, form)
+	if err != nil {
+		return "", err
+	}
+
+	return shareLinkTarget(&res.ShareLink)
+}
+
+func shareLinkURL(code string) string {
+	return shareLinkBaseURL + "/s/" + code
+}
+
+// listing page of LISTING_PAGE_URL with the utm parameters of the link added to its query
+func shareLinkTarget(link *ShareLink) (string, error) {
+	target, err := url.Parse(strings.ReplaceAll(listingPageURL, "{id}", strconv.Itoa(link.ListingID)))
+	if err != nil {
+		return "", apperror.Upstream("Invalid LISTING_PAGE_URL", err)
+	}
+
+	query := target.Query()
+	for name, value := range map[string]string{
+		"utm_source":   link.UTMSource,
+		"utm_medium":   link.UTMMedium,
+		"utm_campaign": link.UTMCampaign,
+	} {
+		if value != "" {
+			query.Set(name, value)
+		}
+	}
+	target.RawQuery = query.Encode()
+
+	return target.String(), nil
+}
+
+// =========== REPOSITORY LAYER, ABSTRACTION OVER THE DATA PERSISTENCE (databases, file systems, or external APIs) ===========
+
+var (
+	// listing service api path
+	apiPathShareLinks      = listingServiceURL + "/listings/%d/share-links"
+	apiPathShareLinkClicks = listingServiceURL + "/share-links/%s/clicks"
+)
+
+func createShareLinkService(ctx context.Context, listingID int, form url.Values) (*ShareLinkResponse, error) {
+	resp, err := httpPostForm(ctx, fmt.Sprintf(apiPathShareLinks, listingID), form)
+	if err != nil {
+		slog.ErrorContext(ctx, "service error", "code", "263", "error", err)
+		return nil, apperror.Upstream("Failed to create share link", err)
+	}
+	defer resp.Body.Close()
+
+	// 200 when reuse returned an existing link
+	switch resp.StatusCode {
+	case http.StatusOK, http.StatusCreated:
+	case http.StatusNotFound:
+		return nil, errListingNotFound
+	case http.StatusBadRequest:
+		return nil, apperror.Validation(upstreamErrorMessage(resp.Body, "Invalid share link"))
+	default:
+		slog.ErrorContext(ctx, "service error", "code", "264", "error", "error creating share link from listing service")
+		return nil, apperror.Upstream("Failed to create share link", errors.New("error creating share link from listing service"))
+	}
+
+	var link ShareLinkResponse
+	if err := decodeJSON(resp.Body, &link); err != nil {
+		slog.ErrorContext(ctx, "service error", "code", "265", "error", err)
+		return nil, apperror.Upstream("Failed to create share link", err)
+	}
+
+	return &link, nil
+}
+
+func getShareLinksService(ctx context.Context, listingID int) (*ShareLinksResponse, error) {
+	resp, err := httpGet(ctx, fmt.Sprintf(apiPathShareLinks, listingID))
+	if err != nil {
+		slog.ErrorContext(ctx, "service error", "code", "266", "error", err)
+		return nil, apperror.Upstream("Failed to get share links", err)
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		return nil, errListingNotFound
+	default:
+		slog.ErrorContext(ctx, "service error", "code", "267", "error", "error fetching share links from listing service")
+		return nil, apperror.Upstream("Failed to get share links", errors.New("error fetching share links from listing service"))
+	}
+
+	var links ShareLinksResponse
+	if err := decodeJSON(resp.Body, &links); err != nil {
+		slog.ErrorContext(ctx, "service error", "code", "268", "error", err)
+		return nil, apperror.Upstream("Failed to get share links", err)
+	}
+
+	return &links, nil
+}
+
+// record a click on the code and return its link, links of deleted listings are not found
+func recordShareLinkClickService(ctx context.Context, code string, form url.Values) (*ShareLinkResponse, error) {
+	resp, err := httpPostForm(ctx, fmt.Sprintf(apiPathShareLinkClicks, url.PathEscape(code)), form)
+	if err != nil {
+		slog.ErrorContext(ctx, "service error", "code", "269", "error", err)
+		return nil, apperror.Upstream("Failed to resolve share link", err)
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusCreated:
+	case http.StatusNotFound:
+		return nil, errShareLinkNotFound
+	default:
+		slog.ErrorContext(ctx, "service error", "code", "270", "error", "error recording share link click from listing service")
+		return nil, apperror.Upstream("Failed to resolve share link", errors.New("error recording share link click from listing service"))
+	}
+
+	var link ShareLinkResponse
+	if err := decodeJSON(resp.Body, &link); err != nil {
+		slog.ErrorContext(ctx, "service error", "code", "271", "error", err)
+		return nil, apperror.Upstream("Failed to resolve share link", err)
+	}
+
+	return &link, nil
+}
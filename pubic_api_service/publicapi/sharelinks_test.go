@@ -0,0 +1,38 @@
+package publicapi
+
+import "testing"
+
+func TestShareLinkTarget(t *testing.T) {
+	previous := listingPageURL
+	defer func() { listingPageURL = previous }()
+
+	tests := []struct {
+		page string
+		link ShareLink
+		want string
+	}{
+		{page: "/listings/{id}", link: ShareLink{ListingID: 7}, want: "/listings/7"},
+		{
+			page: "https://99.co/listings/{id}",
+			link: ShareLink{ListingID: 7, UTMSource: "whatsapp", UTMCampaign: "summer sale"},
+			want: "https://99.co/listings/7?utm_campaign=summer+sale&utm_source=whatsapp",
+		},
+		// a query of the page is kept, the utm parameters of the link win over the page ones
+		{
+			page: "https://99.co/listing?id={id}&utm_medium=web",
+			link: ShareLink{ListingID: 9007199254740993, UTMMedium: "social"},
+			want: "https://99.co/listing?id=9007199254740993&utm_medium=social",
+		},
+	}
+
+	for _, tt := range tests {
+		listingPageURL = tt.page
+		got, err := shareLinkTarget(&tt.link)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != tt.want {
+			t.Errorf("shareLinkTarget(%s, %+v) = %q, want %q", tt.page, tt.link, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,214 @@
+package publicapi
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+)
+
+// =========== REPOSITORY LAYER, STORAGE OF THE UPLOADED MEDIA FILES ===========
+
+// MediaStorage keep uploaded photos, floor plans and documents under a key like photos/1-1700000000.jpg and
+// return the url clients download them from. Videos are transcoded from local files and always stay in MEDIA_DIR
+type MediaStorage interface {
+	Put(ctx context.Context, key, contentType string, body io.Reader) (string, error)
+	Delete(ctx context.Context, key string) error
+}
+
+// storage of media uploads, the backend of MEDIA_STORAGE once Run started
+var mediaStorage MediaStorage = localStorage{dir: mediaDir, baseURL: mediaBaseURL}
+
+// MEDIA_STORAGE local or s3, local keeps files in MEDIA_DIR served under MEDIA_BASE_URL
+func newMediaStorage() MediaStorage {
+	name := cfg.String("MEDIA_STORAGE", "local")
+
+	var storage MediaStorage
+	switch name {
+	case "local":
+		storage = localStorage{dir: mediaDir, baseURL: mediaBaseURL}
+	case "s3":
+		// MEDIA_S3_ENDPOINT base url of the s3 api, https://s3.ap-southeast-1.amazonaws.com or a compatible one like minio
+		// MEDIA_S3_BUCKET bucket of the files, addressed in the path so any compatible endpoint works
+		// MEDIA_S3_REGION region requests are signed for
+		// MEDIA_S3_ACCESS_KEY_ID, MEDIA_S3_SECRET_ACCESS_KEY credentials allowed to put and delete objects of the bucket
+		// MEDIA_S3_PUBLIC_URL prefix of the urls returned to clients, a cdn in front of the bucket, default the bucket url
+		s3 := &s3Storage{
+			endpoint:        strings.TrimRight(cfg.String("MEDIA_S3_ENDPOINT", ""), "/"),
+			bucket:          cfg.String("MEDIA_S3_BUCKET", ""),
+			region:          cfg.String("MEDIA_S3_REGION", "us-east-1"),
+			accessKeyID:     cfg.String("MEDIA_S3_ACCESS_KEY_ID", ""),
+			secretAccessKey: cfg.String("MEDIA_S3_SECRET_ACCESS_KEY", ""),
+		}
+		if s3.endpoint == "" || s3.bucket == "" || s3.accessKeyID == "" || s3.secretAccessKey == "" {
+			log.Fatal("MEDIA_STORAGE s3 needs MEDIA_S3_ENDPOINT, MEDIA_S3_BUCKET, MEDIA_S3_ACCESS_KEY_ID and MEDIA_S3_SECRET_ACCESS_KEY")
+		}
+		s3.publicURL = strings.TrimRight(cfg.String("MEDIA_S3_PUBLIC_URL", s3.endpoint+"/"+s3.bucket), "/")
+		storage = s3
+	default:
+		log.Fatalf("unknown MEDIA_STORAGE %q, one of: local, s3", name)
+	}
+
+	slog.Info("media storage", "storage", name)
+	return storage
+}
+
+// files in a local directory, served by the media routes of the public API
+type localStorage struct {
+	dir     string
+	baseURL string
+}
+
+func (s localStorage) Put(ctx context.Context, key, contentType string, body io.Reader) (string, error) {
+	path := filepath.Join(s.dir, filepath.FromSlash(key))
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return "", err
+	}
+
+	dst, err := os.Create(path)
+	if err != nil {
+		return "", err
+	}
+	defer dst.Close()
+
+	if _, err := dst.ReadFrom(body); err != nil {
+		os.Remove(path)
+		return "", err
+	}
+
+	return s.baseURL + "/" + key, nil
+}
+
+func (s localStorage) Delete(ctx context.Context, key string) error {
+	return os.Remove(filepath.Join(s.dir, filepath.FromSlash(key)))
+}
+
+// MEDIA_S3_TIMEOUT max duration of one call to the s3 api
+var s3Client = &http.Client{
+	Timeout:   cfg.Duration("MEDIA_S3_TIMEOUT", 30*time.Second),
+	Transport: otelhttp.NewTransport(http.DefaultTransport),
+}
+
+// objects of a bucket of an s3 compatible api, requests are signed with aws signature version 4
+type s3Storage struct {
+	endpoint        string
+	bucket          string
+	region          string
+	accessKeyID     string
+	secretAccessKey string
+	publicURL       string
+}
+
+func (s *s3Storage) Put(ctx context.Context, key, contentType string, body io.Reader) (string, error) {
+	// the payload is signed, uploads are small enough to hash in memory
+	data, err := io.ReadAll(body)
+	if err != nil {
+		return "", err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, s.endpoint+"/"+s.bucket+"/"+key, bytes.NewReader(data))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", contentType)
+	if err := s.do(req, data); err != nil {
+		return "", err
+	}
+
+	return s.publicURL + "/" + key, nil
+}
+
+func (s *s3Storage) Delete(ctx context.Context, key string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodDelete, s.endpoint+"/"+s.bucket+"/"+key, nil)
+	if err != nil {
+		return err
+	}
+	return s.do(req, nil)
+}
+
+// sign and send req, a status other than 2xx is an error with the s3 error document
+func (s *s3Storage) do(req *http.Request, payload []byte) error {
+	sum := sha256.Sum256(payload)
+	signS3Request(req, hex.EncodeToString(sum[:]), s.region, s.accessKeyID, s.secretAccessKey, time.Now())
+
+	resp, err := s3Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("s3 answered %d: %s", resp.StatusCode, bytes.TrimSpace(body))
+	}
+	return nil
+}
+
+// set the aws signature version 4 authorization of req for the s3 service, the host and every header already set on
+// req are signed
+func signS3Request(req *http.Request, payloadHash, region, accessKeyID, secretAccessKey string, now time.Time) {
+	amzDate := now.UTC().Format("20060102T150405Z")
+	date := amzDate[:8]
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+
+	host := req.Host
+	if host == "" {
+		host = req.URL.Host
+	}
+	headers := map[string]string{"host": host}
+	for name, values := range req.Header {
+		headers[strings.ToLower(name)] = strings.TrimSpace(strings.Join(values, ","))
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		req.URL.Query().Encode(),
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+	canonicalHash := sha256.Sum256([]byte(canonicalRequest))
+
+	scope := date + "/" + region + "/s3/aws4_request"
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(canonicalHash[:])
+
+	key := []byte("AWS4" + secretAccessKey)
+	for _, part := range []string{date, region, "s3", "aws4_request"} {
+		key = hmacSHA256(key, part)
+	}
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", "AWS4-HMAC-SHA256 Credential="+accessKeyID+"/"+scope+", SignedHeaders="+signedHeaders+", Signature="+signature)
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
@@ -0,0 +1,607 @@
+package publicapi
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	"apperror"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+)
+
+// subject and body of the notifications of an event over a channel in a locale, kept by the user service. Every save
+// adds a version, the latest version is the one rendered
+type NotificationTemplate struct {
+	Event     string `json:"event"`
+	Channel   string `json:"channel"`
+	Locale    string `json:"locale"`
+	Version   int    `json:"version"`
+	Subject   string `json:"subject"`
+	Body      string `json:"body"`
+	CreatedBy int    `json:"created_by"`
+	CreatedAt int64  `json:"created_at"`
+}
+
+type NotificationTemplatesResponse struct {
+	Result    bool                   `json:"result"`
+	Templates []NotificationTemplate `json:"templates"`
+}
+
+type NotificationTemplateResponse struct {
+	Result   bool                 `json:"result"`
+	Template NotificationTemplate `json:"template"`
+}
+
+// event, channel and locale of a template, from the path
+type notificationTemplateKey struct {
+	Event   string `json:"event" binding:"required"`
+	Channel string `json:"channel" binding:"required,oneof=email push in_app"`
+	Locale  string `json:"locale" binding:"required,bcp47_language_tag"`
+}
+
+// new version of a template, the body is required, the subject is the title of push and in-app notifications
+type NotificationTemplateUpdate struct {
+	Subject string `json:"subject" binding:"max=200"`
+	Body    string `json:"body" binding:"required,max=10000"`
+}
+
+// template rendered against a notification without saving it, the template the event is sent with when Body is empty
+type NotificationTemplatePreview struct {
+	Event   string `json:"event" binding:"required"`
+	Channel string `json:"channel" binding:"omitempty,oneof=email push in_app"`
+	Locale  string `json:"locale" binding:"omitempty,bcp47_language_tag"`
+	Subject string `json:"subject" binding:"max=200"`
+	Body    string `json:"body" binding:"max=10000"`
+	// data rendered, a sample notification of the event when nil
+	Notification *Notification `json:"notification"`
+}
+
+var (
+	ErrNotificationTemplateNotFound = apperror.NotFound("Notification template not found")
+	errNotificationTemplateKey      = apperror.Validation("event must be one of " + strings.Join(notificationEvents, ", ") +
+		", channel one of " + strings.Join(notificationChannels, ", ") + " and locale a BCP 47 language tag")
+)
+
+// NOTIFICATION_LOCALE locale of the templates notifications are rendered with, users carry no locale of their own
+// NOTIFICATION_TEMPLATE_TTL how long templates fetched from the user service are used before fetching them again
+var (
+	notificationLocale      = cfg.String("NOTIFICATION_LOCALE", "en")
+	notificationTemplateTTL = cfg.Duration("NOTIFICATION_TEMPLATE_TTL", time.Minute)
+)
+
+// =========== INTERFACE HANDLER, HANDLING REQUEST RESPONSE API DEPEND INTERFACE ===========
+
+// latest version of every stored template and the built-in ones of the events without one
+func getNotificationTemplatesHandler(c *gin.Context) {
+	res, err := getNotificationTemplatesUsecase(c.Request.Context())
+	if err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"templates": res.Templates, "built_in": builtInNotificationTexts})
+}
+
+func getNotificationTemplateVersionsHandler(c *gin.Context) {
+	key := notificationTemplateKey{Event: c.Param("event"), Channel: c.Param("channel"), Locale: c.Param("locale")}
+	res, err := getNotificationTemplateVersionsUsecase(c.Request.Context(), key)
+	if err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"templates": res.Templates})
+}
+
+// save a new version of a template, rendered from then on
+func saveNotificationTemplateHandler(c *gin.Context) {
+	var body NotificationTemplateUpdate
+	if err := c.ShouldBindJSON(&body); err != nil {
+		slog.ErrorContext(c.Request.Context(), "handler error", "code", "462", "error", err)
+		apperror.RespondBinding(c, err)
+		return
+	}
+
+	key := notificationTemplateKey{Event: c.Param("event"), Channel: c.Param("channel"), Locale: c.Param("locale")}
+	saved, err := saveNotificationTemplateUsecase(c.Request.Context(), authUserID(c), key, body)
+	if err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"template": saved})
+}
+
+// delete every version of a template, the built-in one is rendered again
+func deleteNotificationTemplateHandler(c *gin.Context) {
+	key := notificationTemplateKey{Event: c.Param("event"), Channel: c.Param("channel"), Locale: c.Param("locale")}
+	if err := deleteNotificationTemplateUsecase(c.Request.Context(), key); err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+func previewNotificationTemplateHandler(c *gin.Context) {
+	var body NotificationTemplatePreview
+	if err := c.ShouldBindJSON(&body); err != nil {
+		slog.ErrorContext(c.Request.Context(), "handler error", "code", "463", "error", err)
+		apperror.RespondBinding(c, err)
+		return
+	}
+
+	preview, err := previewNotificationTemplateUsecase(c.Request.Context(), body)
+	if err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, preview)
+}
+
+// =========== USECASE LAYER, SERVES AS AN INTERMEDIARY BETWEEN THE PRESENTATION LAYER AND THE DATA LAYER ===========
+
+func getNotificationTemplatesUsecase(ctx context.Context) (*NotificationTemplatesResponse, error) {
+	res, err := userClient.FindNotificationTemplates(ctx)
+	if err != nil {
+		return nil, apperror.Upstream("Failed to get notification templates", err)
+	}
+
+	return res, nil
+}
+
+func getNotificationTemplateVersionsUsecase(ctx context.Context, key notificationTemplateKey) (*NotificationTemplatesResponse, error) {
+	if err := validateNotificationTemplateKey(key); err != nil {
+		return nil, err
+	}
+
+	res, err := userClient.FindNotificationTemplateVersions(ctx, key.Event, key.Channel, key.Locale)
+	if err != nil {
+		if errors.Is(err, ErrNotificationTemplateNotFound) {
+			return nil, err
+		}
+		return nil, apperror.Upstream("Failed to get notification template versions", err)
+	}
+
+	return res, nil
+}
+
+// template is parsed and rendered against a sample notification of its event before it is saved, so a template the
+// dispatcher could not render is refused with its error
+func saveNotificationTemplateUsecase(ctx context.Context, actorID int, key notificationTemplateKey, body NotificationTemplateUpdate) (*NotificationTemplate, error) {
+	if err := validateNotificationTemplateKey(key); err != nil {
+		return nil, err
+	}
+
+	t, err := parseNotificationTemplate(body.Subject, body.Body)
+	if err == nil {
+		_, _, err = t.render(sampleNotification(key.Event))
+	}
+	if err != nil {
+		return nil, apperror.Validation("Invalid template: " + err.Error())
+	}
+
+	templateJSON, err := json.Marshal(map[string]any{
+		"event": key.Event, "channel": key.Channel, "locale": key.Locale, "subject": body.Subject, "body": body.Body, "created_by": actorID,
+	})
+	if err != nil {
+		slog.ErrorContext(ctx, "usecase error", "code", "464", "error", err)
+		return nil, err
+	}
+
+	res, err := userClient.CreateNotificationTemplate(ctx, templateJSON)
+	if err != nil {
+		return nil, apperror.Upstream("Failed to save notification template", err)
+	}
+
+	notificationTemplates.invalidate()
+	return &res.Template, nil
+}
+
+func deleteNotificationTemplateUsecase(ctx context.Context, key notificationTemplateKey) error {
+	if err := validateNotificationTemplateKey(key); err != nil {
+		return err
+	}
+
+	if err := userClient.DeleteNotificationTemplate(ctx, key.Event, key.Channel, key.Locale); err != nil {
+		if errors.Is(err, ErrNotificationTemplateNotFound) {
+			return err
+		}
+		return apperror.Upstream("Failed to delete notification template", err)
+	}
+
+	notificationTemplates.invalidate()
+	return nil
+}
+
+// subject and body of the template in body, or of the template the event is sent with, and where that one comes from:
+// request, stored or built_in
+func previewNotificationTemplateUsecase(ctx context.Context, body NotificationTemplatePreview) (gin.H, error) {
+	if body.Channel == "" {
+		body.Channel = "push"
+	}
+	if body.Locale == "" {
+		body.Locale = notificationLocale
+	}
+	if !slices.Contains(notificationEvents, body.Event) {
+		return nil, errNotificationTemplateKey
+	}
+
+	n := sampleNotification(body.Event)
+	if body.Notification != nil {
+		n = *body.Notification
+		n.Event = body.Event
+	}
+
+	source, version := "request", 0
+	var t *notificationTemplate
+	if body.Body != "" {
+		var err error
+		if t, err = parseNotificationTemplate(body.Subject, body.Body); err != nil {
+			return nil, apperror.Validation("Invalid template: " + err.Error())
+		}
+	} else if t = notificationTemplates.get(ctx, body.Event, body.Channel, body.Locale); t != nil {
+		source, version = "stored", t.version
+	} else if t = builtInNotificationTemplates[body.Event]; t != nil {
+		source = "built_in"
+	}
+
+	subject, rendered, err := t.render(n)
+	if err != nil {
+		return nil, apperror.Validation("Invalid template: " + err.Error())
+	}
+
+	return gin.H{"subject": subject, "body": rendered, "source": source, "version": version}, nil
+}
+
+func validateNotificationTemplateKey(key notificationTemplateKey) error {
+	if err := binding.Validator.ValidateStruct(key); err != nil || !slices.Contains(notificationEvents, key.Event) {
+		return errNotificationTemplateKey
+	}
+	return nil
+}
+
+// =========== REPOSITORY LAYER, TEMPLATES OF THE NOTIFICATIONS CACHED FROM THE USER SERVICE ===========
+
+// largest subject plus body a template renders, larger renders fail
+const maxRenderedNotification = 16 << 10
+
+// built-in subject and body of each event, rendered when no template is stored for the event, channel and locale
+var builtInNotificationTexts = map[string]struct {
+	Subject string `json:"subject"`
+	Body    string `json:"body"`
+}{
+	notificationOfferReceived:    {"New offer", "{{money .Amount}} offered on your listing"},
+	notificationOfferAccepted:    {"Offer accepted", "Your offer of {{money .Amount}} was accepted"},
+	notificationOfferRejected:    {"Offer rejected", "Your offer of {{money .Amount}} was rejected"},
+	notificationOfferCountered:   {"Counter offer", "You got a counter offer of {{money .Amount}}"},
+	notificationOfferWithdrawn:   {"Offer withdrawn", "The offer of {{money .Amount}} on your listing was withdrawn"},
+	notificationViewingBooked:    {"Viewing booked", "Viewing on {{datetime .StartsAt}}"},
+	notificationViewingCancelled: {"Viewing cancelled", "The viewing on {{datetime .StartsAt}} was cancelled"},
+	notificationViewingReminder:  {"Upcoming viewing", "Your viewing starts on {{datetime .StartsAt}}"},
+	notificationListingDigest:    {"New listings", "{{.Subject}}"},
+	notificationAnnouncement:     {"{{.Subject}}", "{{.Body}}"},
+}
+
+var builtInNotificationTemplates = func() map[string]*notificationTemplate {
+	templates := make(map[string]*notificationTemplate, len(builtInNotificationTexts))
+	for event, text := range builtInNotificationTexts {
+		parsed, err := parseNotificationTemplate(text.Subject, text.Body)
+		if err != nil {
+			panic(err)
+		}
+		templates[event] = parsed
+	}
+	return templates
+}()
+
+// functions templates may call besides the text/template builtins, none of them reaches past the notification
+var notificationTemplateFuncs = template.FuncMap{
+	// amount in the listing currency with thousands separators, SGD 1,250,000
+	"money": func(amount int) string {
+		return listingCurrency + " " + formatThousands(amount)
+	},
+	// unix microseconds as Mon 2 Jan 15:04 UTC
+	"datetime": func(micros int64) string {
+		return time.UnixMicro(micros).UTC().Format("Mon 2 Jan 15:04 UTC")
+	},
+	// unix microseconds as 2 Jan 2006
+	"date": func(micros int64) string {
+		return time.UnixMicro(micros).UTC().Format("2 Jan 2006")
+	},
+	"upper": strings.ToUpper,
+	"lower": strings.ToLower,
+	// s cut to n characters with an ellipsis
+	"truncate": func(n int, s string) string {
+		runes := []rune(s)
+		if n < 1 || len(runes) <= n {
+			return s
+		}
+		return string(runes[:n-1]) + "…"
+	},
+	// s, or def when s is empty
+	"default": func(def, s string) string {
+		if s == "" {
+			return def
+		}
+		return s
+	},
+}
+
+// parsed subject and body of a template, version 0 for a built-in one
+type notificationTemplate struct {
+	subject *template.Template
+	body    *template.Template
+	version int
+}
+
+func parseNotificationTemplate(subject, body string) (*notificationTemplate, error) {
+	subjectTemplate, err := template.New("subject").Funcs(notificationTemplateFuncs).Parse(subject)
+	if err != nil {
+		return nil, err
+	}
+	bodyTemplate, err := template.New("body").Funcs(notificationTemplateFuncs).Parse(body)
+	if err != nil {
+		return nil, err
+	}
+	return &notificationTemplate{subject: subjectTemplate, body: bodyTemplate}, nil
+}
+
+// subject and body of n, the subject on one line
+func (t *notificationTemplate) render(n Notification) (string, string, error) {
+	out := &limitedBuffer{left: maxRenderedNotification}
+	if err := t.subject.Execute(out, n); err != nil {
+		return "", "", err
+	}
+	subject := strings.Join(strings.Fields(out.String()), " ")
+
+	out.Reset()
+	if err := t.body.Execute(out, n); err != nil {
+		return "", "", err
+	}
+	return subject, strings.TrimSpace(out.String()), nil
+}
+
+// buffer failing writes past left bytes, so a template can not render an unbounded message
+type limitedBuffer struct {
+	bytes.Buffer
+	left int
+}
+
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	if len(p) > b.left {
+		return 0, fmt.Errorf("rendered notification longer than %d bytes", maxRenderedNotification)
+	}
+	b.left -= len(p)
+	return b.Buffer.Write(p)
+}
+
+// notification of event with made up data, rendered by previews and by the check of a saved template
+func sampleNotification(event string) Notification {
+	starts := time.Now().Add(24 * time.Hour).Truncate(time.Hour)
+	n := Notification{Event: event, UserID: 1, ListingID: 1, CreatedAt: time.Now().UnixMicro()}
+	switch event {
+	case notificationOfferReceived, notificationOfferAccepted, notificationOfferRejected, notificationOfferCountered, notificationOfferWithdrawn:
+		n.OfferID, n.Amount, n.Status = 1, 1250000, "pending"
+	case notificationViewingBooked, notificationViewingCancelled, notificationViewingReminder:
+		n.ViewingID, n.StartsAt, n.EndsAt, n.Status = 1, starts.UnixMicro(), starts.Add(30*time.Minute).UnixMicro(), "booked"
+	case notificationListingDigest:
+		n.Status, n.Subject, n.Body = "daily", "3 new listings for your saved searches", "Hi, here is what was listed today."
+		n.UnsubscribeURL = shareLinkBaseURL + "/public-api/digests/unsubscribe?token=sample"
+	case notificationAnnouncement:
+		n.BroadcastID, n.Subject, n.Body = 1, "Maintenance tonight", "Listings are read-only from 22:00 to 23:00 SGT"
+	}
+	return n
+}
+
+// subject and body of n over channel, from the template stored for its event, channel and NOTIFICATION_LOCALE or
+// the built-in one. A template failing to render falls back to the built-in one, the event itself when none renders
+func renderNotification(ctx context.Context, n Notification, channel string) (string, string) {
+	if t := notificationTemplates.get(ctx, n.Event, channel, notificationLocale); t != nil {
+		subject, body, err := t.render(n)
+		if err == nil {
+			return subject, body
+		}
+		slog.ErrorContext(ctx, "service error", "code", "465", "error", err, "event", n.Event, "channel", channel, "version", t.version)
+	}
+
+	if t := builtInNotificationTemplates[n.Event]; t != nil {
+		if subject, body, err := t.render(n); err == nil {
+			return subject, body
+		}
+	}
+	return n.Event, ""
+}
+
+// templates of the user service, set by Run, the built-in templates only until then
+var notificationTemplates = newTemplatesTable(nil, 0)
+
+// latest version of the stored templates by event, channel and locale, fetched again once ttl passed. A failed fetch
+// keeps the templates fetched before
+type templatesTable struct {
+	load func(ctx context.Context) ([]NotificationTemplate, error)
+	ttl  time.Duration
+
+	mu        sync.Mutex
+	templates map[string]*notificationTemplate
+	expiresAt time.Time
+}
+
+func newTemplatesTable(load func(ctx context.Context) ([]NotificationTemplate, error), ttl time.Duration) *templatesTable {
+	return &templatesTable{load: load, ttl: ttl}
+}
+
+func newNotificationTemplates() *templatesTable {
+	return newTemplatesTable(func(ctx context.Context) ([]NotificationTemplate, error) {
+		res, err := userClient.FindNotificationTemplates(ctx)
+		if err != nil {
+			return nil, err
+		}
+		return res.Templates, nil
+	}, notificationTemplateTTL)
+}
+
+// stored template of event over channel in locale or its language (en for en-SG), nil when none is stored
+func (t *templatesTable) get(ctx context.Context, event, channel, locale string) *notificationTemplate {
+	if t.load == nil {
+		return nil
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.templates == nil || !time.Now().Before(t.expiresAt) {
+		t.refresh(ctx)
+	}
+
+	language, _, _ := strings.Cut(locale, "-")
+	for _, locale := range []string{locale, language} {
+		if stored, ok := t.templates[event+"/"+channel+"/"+locale]; ok {
+			return stored
+		}
+	}
+	return nil
+}
+
+func (t *templatesTable) refresh(ctx context.Context) {
+	// a failed fetch is tried again after ttl whatever happens, so a user service down is not asked per notification
+	t.expiresAt = time.Now().Add(t.ttl)
+
+	stored, err := t.load(ctx)
+	if err != nil {
+		slog.WarnContext(ctx, "notification templates refresh failed, rendering the last templates fetched", "error", err)
+		return
+	}
+
+	templates := make(map[string]*notificationTemplate, len(stored))
+	for _, s := range stored {
+		parsed, err := parseNotificationTemplate(s.Subject, s.Body)
+		if err != nil {
+			slog.ErrorContext(ctx, "service error", "code", "466", "error", err, "event", s.Event, "channel", s.Channel, "locale", s.Locale, "version", s.Version)
+			continue
+		}
+		parsed.version = s.Version
+		templates[s.Event+"/"+s.Channel+"/"+s.Locale] = parsed
+	}
+	t.templates = templates
+}
+
+// fetch the templates again on the next get, after a template of this instance was saved or deleted
+func (t *templatesTable) invalidate() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.expiresAt = time.Time{}
+}
+
+var (
+	// user service api path
+	apiPathNotificationTemplates = userServiceURL + "/notification-templates"
+	apiPathNotificationTemplate  = userServiceURL + "/notification-templates/%s/%s/%s"
+)
+
+func notificationTemplateURL(event, channel, locale string) string {
+	return fmt.Sprintf(apiPathNotificationTemplate, url.PathEscape(event), url.PathEscape(channel), url.PathEscape(locale))
+}
+
+func (httpUserClient) FindNotificationTemplates(ctx context.Context) (*NotificationTemplatesResponse, error) {
+	resp, err := httpGet(ctx, apiPathNotificationTemplates)
+	if err != nil {
+		slog.ErrorContext(ctx, "service error", "code", "467", "error", err)
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		slog.ErrorContext(ctx, "service error", "code", "468", "error", "error fetching notification templates from user service")
+		return nil, errors.New("error fetching notification templates from user service")
+	}
+
+	var templates NotificationTemplatesResponse
+	if err := decodeJSON(resp.Body, &templates); err != nil {
+		slog.ErrorContext(ctx, "service error", "code", "468", "error", err)
+		return nil, err
+	}
+
+	return &templates, nil
+}
+
+func (httpUserClient) FindNotificationTemplateVersions(ctx context.Context, event, channel, locale string) (*NotificationTemplatesResponse, error) {
+	resp, err := httpGet(ctx, notificationTemplateURL(event, channel, locale))
+	if err != nil {
+		slog.ErrorContext(ctx, "service error", "code", "469", "error", err)
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		return nil, ErrNotificationTemplateNotFound
+	default:
+		slog.ErrorContext(ctx, "service error", "code", "470", "error", "error fetching notification template versions from user service")
+		return nil, errors.New("error fetching notification template versions from user service")
+	}
+
+	var templates NotificationTemplatesResponse
+	if err := decodeJSON(resp.Body, &templates); err != nil {
+		slog.ErrorContext(ctx, "service error", "code", "470", "error", err)
+		return nil, err
+	}
+
+	return &templates, nil
+}
+
+func (httpUserClient) CreateNotificationTemplate(ctx context.Context, templateByte []byte) (*NotificationTemplateResponse, error) {
+	resp, err := httpPost(ctx, apiPathNotificationTemplates, "application/json", bytes.NewBuffer(templateByte))
+	if err != nil {
+		slog.ErrorContext(ctx, "service error", "code", "471", "error", err)
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusCreated {
+		slog.ErrorContext(ctx, "service error", "code", "472", "error", "error creating notification template from user service")
+		return nil, errors.New("error creating notification template from user service")
+	}
+
+	var created NotificationTemplateResponse
+	if err := decodeJSON(resp.Body, &created); err != nil {
+		slog.ErrorContext(ctx, "service error", "code", "472", "error", err)
+		return nil, err
+	}
+
+	return &created, nil
+}
+
+func (httpUserClient) DeleteNotificationTemplate(ctx context.Context, event, channel, locale string) error {
+	resp, err := httpDelete(ctx, notificationTemplateURL(event, channel, locale))
+	if err != nil {
+		slog.ErrorContext(ctx, "service error", "code", "473", "error", err)
+		return err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return nil
+	case http.StatusNotFound:
+		return ErrNotificationTemplateNotFound
+	default:
+		slog.ErrorContext(ctx, "service error", "code", "474", "error", "error deleting notification template from user service")
+		return errors.New("error deleting notification template from user service")
+	}
+}
@@ -0,0 +1,73 @@
+package publicapi
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRenderNotification(t *testing.T) {
+	ctx := context.Background()
+	defer func() { notificationTemplates = newTemplatesTable(nil, 0) }()
+
+	offer := Notification{Event: notificationOfferAccepted, Amount: 1250000}
+	if subject, body := renderNotification(ctx, offer, "push"); subject != "Offer accepted" || body != "Your offer of "+listingCurrency+" 1,250,000 was accepted" {
+		t.Errorf("built-in render %q %q", subject, body)
+	}
+
+	loads := 0
+	notificationTemplates = newTemplatesTable(func(ctx context.Context) ([]NotificationTemplate, error) {
+		loads++
+		return []NotificationTemplate{
+			{Event: notificationOfferAccepted, Channel: "push", Locale: "en", Version: 2, Subject: "{{upper \"deal\"}}", Body: "{{money .Amount}} it is"},
+			// renders fine for the sample, fails for a notification without a subject
+			{Event: notificationAnnouncement, Channel: "push", Locale: "en", Version: 1, Subject: "{{.Subject}}", Body: "{{index .Channels 0}}"},
+		}, nil
+	}, time.Hour)
+
+	notificationLocale = "en-SG"
+	defer func() { notificationLocale = "en" }()
+
+	if subject, body := renderNotification(ctx, offer, "push"); subject != "DEAL" || body != listingCurrency+" 1,250,000 it is" {
+		t.Errorf("stored render %q %q, want the en template for en-SG", subject, body)
+	}
+	if subject, _ := renderNotification(ctx, offer, "in_app"); subject != "Offer accepted" {
+		t.Errorf("in_app render %q, want the built-in template without a stored one", subject)
+	}
+	announcement := Notification{Event: notificationAnnouncement, Subject: "Hello", Body: "World"}
+	if subject, body := renderNotification(ctx, announcement, "push"); subject != "Hello" || body != "World" {
+		t.Errorf("failed render %q %q, want the built-in template", subject, body)
+	}
+	if loads != 1 {
+		t.Errorf("templates loaded %d times, want 1 within the ttl", loads)
+	}
+
+	notificationTemplates.invalidate()
+	renderNotification(ctx, offer, "push")
+	if loads != 2 {
+		t.Errorf("templates loaded %d times after invalidate, want 2", loads)
+	}
+}
+
+func TestSaveNotificationTemplateChecks(t *testing.T) {
+	key := notificationTemplateKey{Event: notificationViewingBooked, Channel: "email", Locale: "en"}
+	tests := []struct {
+		name string
+		key  notificationTemplateKey
+		body string
+		want string
+	}{
+		{"unknown event", notificationTemplateKey{Event: "listing_sold", Channel: "email", Locale: "en"}, "sold", "event must be one of"},
+		{"bad locale", notificationTemplateKey{Event: notificationViewingBooked, Channel: "email", Locale: "not a locale"}, "booked", "event must be one of"},
+		{"unknown function", key, `{{exec "rm"}}`, `function "exec" not defined`},
+		{"unknown field", key, "{{.Password}}", "can't evaluate field Password"},
+		{"too long", key, strings.Repeat("y", maxRenderedNotification+1), "longer than"},
+	}
+	for _, tt := range tests {
+		_, err := saveNotificationTemplateUsecase(context.Background(), 1, tt.key, NotificationTemplateUpdate{Body: tt.body})
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: %v, want an error with %q", tt.name, err, tt.want)
+		}
+	}
+}
@@ -0,0 +1,49 @@
+package publicapi
+
+import (
+	"context"
+	"log"
+	"log/slog"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+// =========== TRACING, OPENTELEMETRY SPANS EXPORTED OVER OTLP ===========
+
+// TRACING_ENABLED export spans over OTLP/HTTP, endpoint and headers are read from the standard OTEL_EXPORTER_OTLP_* vars
+// OTEL_SERVICE_NAME service name set on every span
+// trace context is propagated even when disabled, so a traced caller keeps one trace across services
+func initTracing() (stop func()) {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+
+	if !cfg.Bool("TRACING_ENABLED", false) {
+		return func() {}
+	}
+
+	exporter, err := otlptracehttp.New(context.Background())
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(resource.NewSchemaless(attribute.String("service.name", cfg.String("OTEL_SERVICE_NAME", "public-api")))),
+	)
+	otel.SetTracerProvider(provider)
+
+	// flush buffered spans on shutdown
+	return func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		if err := provider.Shutdown(ctx); err != nil {
+			slog.ErrorContext(ctx, "main error", "code", "135", "error", err)
+		}
+	}
+}
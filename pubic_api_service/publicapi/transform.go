@@ -0,0 +1,228 @@
+package publicapi
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"log/slog"
+	"math"
+	"net/http"
+	"os"
+	"strings"
+
+	"apperror"
+
+	"github.com/gin-gonic/gin"
+)
+
+// =========== TRANSFORMATION LAYER, CONVERT BETWEEN CLIENT REPRESENTATION AND CANONICAL DOWNSTREAM DATA ===========
+
+const (
+	areaUnitsSqm  = "sqm"
+	areaUnitsSqft = "sqft"
+
+	sqftPerSqm = 10.7639104
+)
+
+var errInvalidAreaUnits = apperror.Validation("invalid units param, supported values: sqm, sqft")
+
+// validate units query param, default sqm which is the canonical storage unit
+func parseAreaUnits(units string) (string, error) {
+	switch units {
+	case "", areaUnitsSqm:
+		return areaUnitsSqm, nil
+	case areaUnitsSqft:
+		return areaUnitsSqft, nil
+	default:
+		return "", errInvalidAreaUnits
+	}
+}
+
+// convert area sent by client in units to sqm before forwarding downstream
+func areaToCanonical(area float64, units string) float64 {
+	if units == areaUnitsSqft {
+		return roundArea(area / sqftPerSqm)
+	}
+
+	return area
+}
+
+// convert area stored in sqm to units requested by client
+func areaFromCanonical(area float64, units string) float64 {
+	if units == areaUnitsSqft {
+		return roundArea(area * sqftPerSqm)
+	}
+
+	return area
+}
+
+func roundArea(area float64) float64 {
+	return math.Round(area*100) / 100
+}
+
+// set listing area on requested units before returning to client
+func transformListingArea(area *float64, areaUnits *string, units string) {
+	if *area == 0 {
+		return
+	}
+
+	*area = areaFromCanonical(*area, units)
+	*areaUnits = units
+}
+
+// =========== MIDDLEWARE LAYER, RUN BEFORE INTERFACE HANDLER TO ENRICH OR GUARD THE REQUEST ===========
+
+// one mutation of a json body field, applied in order before the handler binds the body
+type RequestRule struct {
+	Field string `json:"field"`
+	// value set when the field is missing or empty
+	Default interface{} `json:"default,omitempty"`
+	// server side value set when the field is missing or empty: header:<name>, geo:country, geo:region, geo:city or client_ip
+	From string `json:"from,omitempty"`
+	// set Default or From even when the client sent the field, so it can not be spoofed
+	Override bool `json:"override,omitempty"`
+	// normalize a string value: lower, upper or trim
+	Transform string `json:"transform,omitempty"`
+}
+
+// rules per "METHOD /route/template", used when REQUEST_RULES_FILE is not set
+var defaultRequestRules = map[string][]RequestRule{
+	"POST /public-api/v1/listings":    {{Field: "listing_type", Transform: "lower"}},
+	"PUT /public-api/v1/listings/:id": {{Field: "listing_type", Transform: "lower"}},
+}
+
+// REQUEST_RULES_FILE json object of rules per "METHOD /route/template", replace the default rules,
+// templates without version apply to v1
+func loadRequestRules() map[string][]RequestRule {
+	path := cfg.String("REQUEST_RULES_FILE", "")
+	if path == "" {
+		return defaultRequestRules
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// numbers of default values are kept as written
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var rules map[string][]RequestRule
+	if err := decoder.Decode(&rules); err != nil {
+		log.Fatalf("invalid REQUEST_RULES_FILE: %v", err)
+	}
+
+	versioned := make(map[string][]RequestRule, len(rules))
+	for route, routeRules := range rules {
+		for _, rule := range routeRules {
+			if err := rule.validate(); err != nil {
+				log.Fatalf("invalid REQUEST_RULES_FILE rule on %s: %v", route, err)
+			}
+		}
+		versioned[versionedRouteKey(route)] = append(versioned[versionedRouteKey(route)], routeRules...)
+	}
+
+	return versioned
+}
+
+func (r RequestRule) validate() error {
+	if r.Field == "" {
+		return fmt.Errorf("field is required")
+	}
+
+	switch r.Transform {
+	case "", "lower", "upper", "trim":
+	default:
+		return fmt.Errorf("unknown transform %q on %s", r.Transform, r.Field)
+	}
+
+	switch source, _, _ := strings.Cut(r.From, ":"); source {
+	case "", "header", "geo", "client_ip":
+	default:
+		return fmt.Errorf("unknown from %q on %s", r.From, r.Field)
+	}
+
+	return nil
+}
+
+// apply the rules of the matched route to json object bodies, run after clientIPMiddleware so geo values are known
+func requestRulesMiddleware(rules map[string][]RequestRule) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		routeRules := rules[c.Request.Method+" "+c.FullPath()]
+		if len(routeRules) == 0 || c.ContentType() != gin.MIMEJSON {
+			c.Next()
+			return
+		}
+
+		body, err := io.ReadAll(c.Request.Body)
+		if err != nil {
+			slog.ErrorContext(c.Request.Context(), "middleware error", "code", "136", "error", err)
+			apperror.Abort(c, http.StatusBadRequest, "Invalid body request")
+			return
+		}
+
+		decoder := json.NewDecoder(bytes.NewReader(body))
+		decoder.UseNumber()
+		var object map[string]interface{}
+		if err := decoder.Decode(&object); err == nil && object != nil {
+			for _, rule := range routeRules {
+				rule.apply(c, object)
+			}
+			if out, err := json.Marshal(object); err == nil {
+				body = out
+			}
+		}
+
+		// malformed bodies are passed untouched so the handler answers its usual binding error
+		c.Request.Body = io.NopCloser(bytes.NewReader(body))
+		c.Request.ContentLength = int64(len(body))
+		c.Next()
+	}
+}
+
+func (r RequestRule) apply(c *gin.Context, object map[string]interface{}) {
+	current, ok := object[r.Field]
+	missing := !ok || current == nil || current == ""
+
+	if missing || r.Override {
+		if value, ok := requestRuleValue(c, r.From); ok {
+			object[r.Field] = value
+		} else if r.Default != nil {
+			object[r.Field] = r.Default
+		}
+	}
+
+	if text, ok := object[r.Field].(string); ok {
+		switch r.Transform {
+		case "lower":
+			object[r.Field] = strings.ToLower(text)
+		case "upper":
+			object[r.Field] = strings.ToUpper(text)
+		case "trim":
+			object[r.Field] = strings.TrimSpace(text)
+		}
+	}
+}
+
+// server side value of from, false when unknown for this request
+func requestRuleValue(c *gin.Context, from string) (interface{}, bool) {
+	source, name, _ := strings.Cut(from, ":")
+	switch source {
+	case "header":
+		value := c.GetHeader(name)
+		return value, value != ""
+	case "client_ip":
+		return clientIP(c), true
+	case "geo":
+		geo := clientGeo(c)
+		if geo == nil {
+			return nil, false
+		}
+		value := map[string]string{"country": geo.Country, "region": geo.Region, "city": geo.City}[name]
+		return value, value != ""
+	default:
+		return nil, false
+	}
+}
@@ -0,0 +1,693 @@
+package publicapi
+
+import (
+	"context"
+	"errors"
+	"log"
+	"log/slog"
+	"sort"
+	"strings"
+	"time"
+
+	"events"
+)
+
+// =========== REPOSITORY LAYER, TRANSPORTS OF THE USER SERVICE CALLS ===========
+
+// ServiceTransport a way of calling the user service, picked by name with USER_SERVICE_TRANSPORT
+type ServiceTransport interface {
+	UserClient
+	Name() string
+}
+
+// transports by name, http and grpc are always there, the combined binary adds inprocess
+var userTransports = map[string]ServiceTransport{}
+
+func init() {
+	RegisterUserTransport(httpUserClient{})
+	RegisterUserTransport(&grpcUserClient{})
+}
+
+// RegisterUserTransport add transport under its name, replacing the one registered before with it, call before Run
+func RegisterUserTransport(transport ServiceTransport) {
+	userTransports[transport.Name()] = transport
+}
+
+// USER_SERVICE_TRANSPORT name of the transport of the user service calls, inprocess when registered otherwise http
+func newUserClient() UserClient {
+	name := "http"
+	if _, ok := userTransports["inprocess"]; ok {
+		name = "inprocess"
+	}
+	name = cfg.String("USER_SERVICE_TRANSPORT", name)
+
+	transport, ok := userTransports[name]
+	if !ok {
+		names := make([]string, 0, len(userTransports))
+		for name := range userTransports {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		log.Fatalf("unknown USER_SERVICE_TRANSPORT %q, one of: %s", name, strings.Join(names, ", "))
+	}
+
+	policy := newTransportPolicy(transport)
+	slog.Info("user service transport", "transport", name, "timeout", policy.timeout.String(), "retry_max_attempts", policy.maxAttempts)
+	return policy
+}
+
+// transportPolicy apply the timeout and retries of its transport to every call and observe them
+type transportPolicy struct {
+	transport   ServiceTransport
+	timeout     time.Duration
+	maxAttempts int
+	backoff     time.Duration
+	maxBackoff  time.Duration
+}
+
+// USER_SERVICE_<TRANSPORT>_TIMEOUT max duration of one call including retries, 0 leaves it to the transport
+// USER_SERVICE_<TRANSPORT>_RETRY_MAX_ATTEMPTS attempts per read call including the first one, 1 disables retries
+//
+// http calls already go through the DOWNSTREAM_* timeout and retries of the shared client so both default to
+// none, grpc defaults to the DOWNSTREAM_* values and inprocess calls can only time out
+func newTransportPolicy(transport ServiceTransport) *transportPolicy {
+	timeout, maxAttempts := time.Duration(0), 1
+	if transport.Name() == "grpc" {
+		timeout = cfg.Duration("DOWNSTREAM_TIMEOUT", 5*time.Second)
+		maxAttempts = cfg.Int("DOWNSTREAM_RETRY_MAX_ATTEMPTS", 3)
+	}
+
+	prefix := "USER_SERVICE_" + strings.ToUpper(transport.Name()) + "_"
+	return &transportPolicy{
+		transport:   transport,
+		timeout:     cfg.Duration(prefix+"TIMEOUT", timeout),
+		maxAttempts: cfg.Int(prefix+"RETRY_MAX_ATTEMPTS", maxAttempts),
+		backoff:     cfg.Duration("DOWNSTREAM_RETRY_BACKOFF", 100*time.Millisecond),
+		maxBackoff:  cfg.Duration("DOWNSTREAM_RETRY_MAX_BACKOFF", time.Second),
+	}
+}
+
+// answers of the user service the usecases act on, sending the call again gives the same answer
+var finalUserErrors = []error{ErrUserNotFound, ErrUserLegalHold, ErrUserUpdateEmpty, ErrUserEmailTaken, ErrInvalidCredentials, ErrPolicyVersionInvalid, ErrBlockInvalid, ErrPrivacyUpdateEmpty,
+	ErrWebhookInvalid, ErrWebhookNotFound, ErrWebhookLimit, ErrNotificationPreferencesInvalid, ErrFavoriteNotFound, ErrFavoriteLimit,
+	ErrPushDeviceInvalid, ErrPushDeviceNotFound, ErrPushDeviceLimit, ErrBroadcastInvalid, ErrBroadcastNotFound, ErrBroadcastFinished, ErrEmailSuppressionNotFound, ErrAdminActionNotFound,
+	ErrContentRuleNotFound}
+
+// call run fn with the timeout, retrying failed read calls, writes are sent once as they could be applied twice
+func (p *transportPolicy) call(ctx context.Context, operation string, read bool, fn func(ctx context.Context) error) error {
+	start := time.Now()
+	if p.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, p.timeout)
+		defer cancel()
+	}
+
+	var err error
+	for attempt := 1; ; attempt++ {
+		err = fn(ctx)
+		if err == nil || !read || attempt >= p.maxAttempts || ctx.Err() != nil || isFinalUserError(err) {
+			break
+		}
+
+		slog.WarnContext(ctx, "user service attempt failed, retrying", "transport", p.transport.Name(), "operation", operation, "attempt", attempt, "error", err)
+
+		timer := time.NewTimer(retryWait(p.backoff, p.maxBackoff, attempt))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			err = ctx.Err()
+		case <-timer.C:
+			continue
+		}
+		break
+	}
+
+	result := "ok"
+	switch {
+	case errors.Is(err, context.DeadlineExceeded):
+		result = "timeout"
+	case isFinalUserError(err):
+		result = "rejected"
+	case err != nil:
+		result = "error"
+	}
+	userServiceCallDuration.WithLabelValues(p.transport.Name(), operation, result).Observe(time.Since(start).Seconds())
+
+	return err
+}
+
+func isFinalUserError(err error) bool {
+	for _, final := range finalUserErrors {
+		if errors.Is(err, final) {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *transportPolicy) FindUser(ctx context.Context, userID int) (res *UserResponse, err error) {
+	err = p.call(ctx, "FindUser", true, func(ctx context.Context) error {
+		res, err = p.transport.FindUser(ctx, userID)
+		return err
+	})
+	return res, err
+}
+
+func (p *transportPolicy) FindUsers(ctx context.Context, userIDs []int) (res *UsersResponse, err error) {
+	err = p.call(ctx, "FindUsers", true, func(ctx context.Context) error {
+		res, err = p.transport.FindUsers(ctx, userIDs)
+		return err
+	})
+	return res, err
+}
+
+func (p *transportPolicy) ListUsers(ctx context.Context, pageNum, pageSize int) (res *UsersPageResponse, err error) {
+	err = p.call(ctx, "ListUsers", true, func(ctx context.Context) error {
+		res, err = p.transport.ListUsers(ctx, pageNum, pageSize)
+		return err
+	})
+	return res, err
+}
+
+func (p *transportPolicy) CreateUser(ctx context.Context, userByte []byte) (res *UserResponse, err error) {
+	err = p.call(ctx, "CreateUser", false, func(ctx context.Context) error {
+		res, err = p.transport.CreateUser(ctx, userByte)
+		return err
+	})
+	return res, err
+}
+
+func (p *transportPolicy) UpdateUser(ctx context.Context, userID int, userByte []byte) (res *UserResponse, err error) {
+	err = p.call(ctx, "UpdateUser", false, func(ctx context.Context) error {
+		res, err = p.transport.UpdateUser(ctx, userID, userByte)
+		return err
+	})
+	return res, err
+}
+
+func (p *transportPolicy) DeleteUser(ctx context.Context, userID int, hard bool) error {
+	return p.call(ctx, "DeleteUser", false, func(ctx context.Context) error {
+		return p.transport.DeleteUser(ctx, userID, hard)
+	})
+}
+
+// setting the same role again changes nothing, safe to retry
+func (p *transportPolicy) SetUserRole(ctx context.Context, userID int, roleByte []byte) (res *UserResponse, err error) {
+	err = p.call(ctx, "SetUserRole", true, func(ctx context.Context) error {
+		res, err = p.transport.SetUserRole(ctx, userID, roleByte)
+		return err
+	})
+	return res, err
+}
+
+func (p *transportPolicy) SetUserLegalHold(ctx context.Context, userID int, holdByte []byte) error {
+	return p.call(ctx, "SetUserLegalHold", true, func(ctx context.Context) error {
+		return p.transport.SetUserLegalHold(ctx, userID, holdByte)
+	})
+}
+
+func (p *transportPolicy) Login(ctx context.Context, loginByte []byte) (res *LoginResponse, err error) {
+	err = p.call(ctx, "Login", false, func(ctx context.Context) error {
+		res, err = p.transport.Login(ctx, loginByte)
+		return err
+	})
+	return res, err
+}
+
+func (p *transportPolicy) FindPolicies(ctx context.Context) (res *PoliciesResponse, err error) {
+	err = p.call(ctx, "FindPolicies", true, func(ctx context.Context) error {
+		res, err = p.transport.FindPolicies(ctx)
+		return err
+	})
+	return res, err
+}
+
+func (p *transportPolicy) FindUserConsents(ctx context.Context, userID int) (res *ConsentsResponse, err error) {
+	err = p.call(ctx, "FindUserConsents", true, func(ctx context.Context) error {
+		res, err = p.transport.FindUserConsents(ctx, userID)
+		return err
+	})
+	return res, err
+}
+
+func (p *transportPolicy) CreateUserConsent(ctx context.Context, userID int, consentByte []byte) (res *ConsentResponse, err error) {
+	err = p.call(ctx, "CreateUserConsent", false, func(ctx context.Context) error {
+		res, err = p.transport.CreateUserConsent(ctx, userID, consentByte)
+		return err
+	})
+	return res, err
+}
+
+func (p *transportPolicy) FindUserBlocks(ctx context.Context, userID int) (res *BlocksResponse, err error) {
+	err = p.call(ctx, "FindUserBlocks", true, func(ctx context.Context) error {
+		res, err = p.transport.FindUserBlocks(ctx, userID)
+		return err
+	})
+	return res, err
+}
+
+func (p *transportPolicy) CreateUserBlock(ctx context.Context, userID int, blockByte []byte) (res *BlockResponse, err error) {
+	err = p.call(ctx, "CreateUserBlock", false, func(ctx context.Context) error {
+		res, err = p.transport.CreateUserBlock(ctx, userID, blockByte)
+		return err
+	})
+	return res, err
+}
+
+func (p *transportPolicy) DeleteUserBlock(ctx context.Context, userID, blockedUserID int) error {
+	return p.call(ctx, "DeleteUserBlock", false, func(ctx context.Context) error {
+		return p.transport.DeleteUserBlock(ctx, userID, blockedUserID)
+	})
+}
+
+func (p *transportPolicy) FindUserPrivacy(ctx context.Context, userID int) (res *PrivacyResponse, err error) {
+	err = p.call(ctx, "FindUserPrivacy", true, func(ctx context.Context) error {
+		res, err = p.transport.FindUserPrivacy(ctx, userID)
+		return err
+	})
+	return res, err
+}
+
+func (p *transportPolicy) UpdateUserPrivacy(ctx context.Context, userID int, privacyByte []byte) (res *PrivacyResponse, err error) {
+	err = p.call(ctx, "UpdateUserPrivacy", false, func(ctx context.Context) error {
+		res, err = p.transport.UpdateUserPrivacy(ctx, userID, privacyByte)
+		return err
+	})
+	return res, err
+}
+
+func (p *transportPolicy) FindNotificationPreferences(ctx context.Context, userID int) (res *NotificationPreferencesResponse, err error) {
+	err = p.call(ctx, "FindNotificationPreferences", true, func(ctx context.Context) error {
+		res, err = p.transport.FindNotificationPreferences(ctx, userID)
+		return err
+	})
+	return res, err
+}
+
+func (p *transportPolicy) UpdateNotificationPreferences(ctx context.Context, userID int, preferencesByte []byte) (res *NotificationPreferencesResponse, err error) {
+	err = p.call(ctx, "UpdateNotificationPreferences", false, func(ctx context.Context) error {
+		res, err = p.transport.UpdateNotificationPreferences(ctx, userID, preferencesByte)
+		return err
+	})
+	return res, err
+}
+
+func (p *transportPolicy) FindUserFavorites(ctx context.Context, userID, pageNum, pageSize int) (res *FavoritesResponse, err error) {
+	err = p.call(ctx, "FindUserFavorites", true, func(ctx context.Context) error {
+		res, err = p.transport.FindUserFavorites(ctx, userID, pageNum, pageSize)
+		return err
+	})
+	return res, err
+}
+
+func (p *transportPolicy) AddUserFavorite(ctx context.Context, userID, listingID int) (res *FavoriteResponse, err error) {
+	err = p.call(ctx, "AddUserFavorite", false, func(ctx context.Context) error {
+		res, err = p.transport.AddUserFavorite(ctx, userID, listingID)
+		return err
+	})
+	return res, err
+}
+
+func (p *transportPolicy) RemoveUserFavorite(ctx context.Context, userID, listingID int) error {
+	return p.call(ctx, "RemoveUserFavorite", false, func(ctx context.Context) error {
+		return p.transport.RemoveUserFavorite(ctx, userID, listingID)
+	})
+}
+
+func (p *transportPolicy) FindUserDevices(ctx context.Context, userID int) (res *PushDevicesResponse, err error) {
+	err = p.call(ctx, "FindUserDevices", true, func(ctx context.Context) error {
+		res, err = p.transport.FindUserDevices(ctx, userID)
+		return err
+	})
+	return res, err
+}
+
+func (p *transportPolicy) RegisterUserDevice(ctx context.Context, userID int, deviceByte []byte) (res *PushDeviceResponse, err error) {
+	// registering is an upsert of the token, sending it again gives the same device
+	err = p.call(ctx, "RegisterUserDevice", true, func(ctx context.Context) error {
+		res, err = p.transport.RegisterUserDevice(ctx, userID, deviceByte)
+		return err
+	})
+	return res, err
+}
+
+func (p *transportPolicy) DeleteUserDevice(ctx context.Context, userID, deviceID int) error {
+	return p.call(ctx, "DeleteUserDevice", false, func(ctx context.Context) error {
+		return p.transport.DeleteUserDevice(ctx, userID, deviceID)
+	})
+}
+
+func (p *transportPolicy) FindPushReceipts(ctx context.Context, userID, deviceID, limit int) (res *PushReceiptsResponse, err error) {
+	err = p.call(ctx, "FindPushReceipts", true, func(ctx context.Context) error {
+		res, err = p.transport.FindPushReceipts(ctx, userID, deviceID, limit)
+		return err
+	})
+	return res, err
+}
+
+func (p *transportPolicy) RecordPushReceipts(ctx context.Context, receiptsByte []byte) error {
+	return p.call(ctx, "RecordPushReceipts", false, func(ctx context.Context) error {
+		return p.transport.RecordPushReceipts(ctx, receiptsByte)
+	})
+}
+
+func (p *transportPolicy) FindUserInbox(ctx context.Context, userID int, unread bool, pageNum, pageSize int) (res *InboxNotificationsResponse, err error) {
+	err = p.call(ctx, "FindUserInbox", true, func(ctx context.Context) error {
+		res, err = p.transport.FindUserInbox(ctx, userID, unread, pageNum, pageSize)
+		return err
+	})
+	return res, err
+}
+
+func (p *transportPolicy) CreateInboxNotification(ctx context.Context, userID int, notificationByte []byte) (res *InboxNotificationResponse, err error) {
+	err = p.call(ctx, "CreateInboxNotification", false, func(ctx context.Context) error {
+		res, err = p.transport.CreateInboxNotification(ctx, userID, notificationByte)
+		return err
+	})
+	return res, err
+}
+
+func (p *transportPolicy) MarkInboxRead(ctx context.Context, userID int, readByte []byte) (res *InboxReadResponse, err error) {
+	// marking read again changes nothing
+	err = p.call(ctx, "MarkInboxRead", true, func(ctx context.Context) error {
+		res, err = p.transport.MarkInboxRead(ctx, userID, readByte)
+		return err
+	})
+	return res, err
+}
+
+func (p *transportPolicy) FindBroadcasts(ctx context.Context, limit int) (res *BroadcastsResponse, err error) {
+	err = p.call(ctx, "FindBroadcasts", true, func(ctx context.Context) error {
+		res, err = p.transport.FindBroadcasts(ctx, limit)
+		return err
+	})
+	return res, err
+}
+
+func (p *transportPolicy) CreateBroadcast(ctx context.Context, broadcastByte []byte) (res *BroadcastResponse, err error) {
+	err = p.call(ctx, "CreateBroadcast", false, func(ctx context.Context) error {
+		res, err = p.transport.CreateBroadcast(ctx, broadcastByte)
+		return err
+	})
+	return res, err
+}
+
+func (p *transportPolicy) FindBroadcast(ctx context.Context, broadcastID int) (res *BroadcastResponse, err error) {
+	err = p.call(ctx, "FindBroadcast", true, func(ctx context.Context) error {
+		res, err = p.transport.FindBroadcast(ctx, broadcastID)
+		return err
+	})
+	return res, err
+}
+
+func (p *transportPolicy) CancelBroadcast(ctx context.Context, broadcastID int) (res *BroadcastResponse, err error) {
+	err = p.call(ctx, "CancelBroadcast", false, func(ctx context.Context) error {
+		res, err = p.transport.CancelBroadcast(ctx, broadcastID)
+		return err
+	})
+	return res, err
+}
+
+func (p *transportPolicy) CountBroadcastAudience(ctx context.Context, audienceByte []byte) (res *BroadcastAudienceResponse, err error) {
+	err = p.call(ctx, "CountBroadcastAudience", true, func(ctx context.Context) error {
+		res, err = p.transport.CountBroadcastAudience(ctx, audienceByte)
+		return err
+	})
+	return res, err
+}
+
+func (p *transportPolicy) ClaimBroadcastRecipients(ctx context.Context, limit int) (res *BroadcastBatchResponse, err error) {
+	// a retried claim could hand out recipients nobody notifies
+	err = p.call(ctx, "ClaimBroadcastRecipients", false, func(ctx context.Context) error {
+		res, err = p.transport.ClaimBroadcastRecipients(ctx, limit)
+		return err
+	})
+	return res, err
+}
+
+func (p *transportPolicy) RecordBroadcastStats(ctx context.Context, broadcastID int, statsByte []byte) error {
+	return p.call(ctx, "RecordBroadcastStats", false, func(ctx context.Context) error {
+		return p.transport.RecordBroadcastStats(ctx, broadcastID, statsByte)
+	})
+}
+
+func (p *transportPolicy) RecordEmailEvents(ctx context.Context, eventsByte []byte) (res *EmailEventsRecordResponse, err error) {
+	// the provider retries the whole webhook when recording fails
+	err = p.call(ctx, "RecordEmailEvents", false, func(ctx context.Context) error {
+		res, err = p.transport.RecordEmailEvents(ctx, eventsByte)
+		return err
+	})
+	return res, err
+}
+
+func (p *transportPolicy) FindUserEmailEvents(ctx context.Context, userID, limit int) (res *EmailEventsResponse, err error) {
+	err = p.call(ctx, "FindUserEmailEvents", true, func(ctx context.Context) error {
+		res, err = p.transport.FindUserEmailEvents(ctx, userID, limit)
+		return err
+	})
+	return res, err
+}
+
+func (p *transportPolicy) FindEmailSuppressions(ctx context.Context, reason string, limit int) (res *EmailSuppressionsResponse, err error) {
+	err = p.call(ctx, "FindEmailSuppressions", true, func(ctx context.Context) error {
+		res, err = p.transport.FindEmailSuppressions(ctx, reason, limit)
+		return err
+	})
+	return res, err
+}
+
+func (p *transportPolicy) FindUserEmailSuppression(ctx context.Context, userID int) (res *EmailSuppressionResponse, err error) {
+	err = p.call(ctx, "FindUserEmailSuppression", true, func(ctx context.Context) error {
+		res, err = p.transport.FindUserEmailSuppression(ctx, userID)
+		return err
+	})
+	return res, err
+}
+
+func (p *transportPolicy) SuppressUserEmail(ctx context.Context, userID int, suppressionByte []byte) (res *EmailSuppressionResponse, err error) {
+	err = p.call(ctx, "SuppressUserEmail", false, func(ctx context.Context) error {
+		res, err = p.transport.SuppressUserEmail(ctx, userID, suppressionByte)
+		return err
+	})
+	return res, err
+}
+
+func (p *transportPolicy) UnsuppressUserEmail(ctx context.Context, userID int) error {
+	return p.call(ctx, "UnsuppressUserEmail", false, func(ctx context.Context) error {
+		return p.transport.UnsuppressUserEmail(ctx, userID)
+	})
+}
+
+func (p *transportPolicy) RecordAudit(ctx context.Context, entryByte []byte) error {
+	return p.call(ctx, "RecordAudit", false, func(ctx context.Context) error {
+		return p.transport.RecordAudit(ctx, entryByte)
+	})
+}
+
+func (p *transportPolicy) FindAuditLog(ctx context.Context, filter AuditLogFilter, pageNum, pageSize int) (res *AuditLogResponse, err error) {
+	err = p.call(ctx, "FindAuditLog", true, func(ctx context.Context) error {
+		res, err = p.transport.FindAuditLog(ctx, filter, pageNum, pageSize)
+		return err
+	})
+	return res, err
+}
+
+func (p *transportPolicy) FindAuditChain(ctx context.Context, afterID int64, limit int) (res *AuditChainResponse, err error) {
+	err = p.call(ctx, "FindAuditChain", true, func(ctx context.Context) error {
+		res, err = p.transport.FindAuditChain(ctx, afterID, limit)
+		return err
+	})
+	return res, err
+}
+
+func (p *transportPolicy) VerifyAuditChain(ctx context.Context) (res *AuditChainVerificationResponse, err error) {
+	err = p.call(ctx, "VerifyAuditChain", true, func(ctx context.Context) error {
+		res, err = p.transport.VerifyAuditChain(ctx)
+		return err
+	})
+	return res, err
+}
+
+func (p *transportPolicy) FindNotificationTemplates(ctx context.Context) (res *NotificationTemplatesResponse, err error) {
+	err = p.call(ctx, "FindNotificationTemplates", true, func(ctx context.Context) error {
+		res, err = p.transport.FindNotificationTemplates(ctx)
+		return err
+	})
+	return res, err
+}
+
+func (p *transportPolicy) FindNotificationTemplateVersions(ctx context.Context, event, channel, locale string) (res *NotificationTemplatesResponse, err error) {
+	err = p.call(ctx, "FindNotificationTemplateVersions", true, func(ctx context.Context) error {
+		res, err = p.transport.FindNotificationTemplateVersions(ctx, event, channel, locale)
+		return err
+	})
+	return res, err
+}
+
+// a retried save could add the same version twice
+func (p *transportPolicy) CreateNotificationTemplate(ctx context.Context, templateByte []byte) (res *NotificationTemplateResponse, err error) {
+	err = p.call(ctx, "CreateNotificationTemplate", false, func(ctx context.Context) error {
+		res, err = p.transport.CreateNotificationTemplate(ctx, templateByte)
+		return err
+	})
+	return res, err
+}
+
+func (p *transportPolicy) DeleteNotificationTemplate(ctx context.Context, event, channel, locale string) error {
+	return p.call(ctx, "DeleteNotificationTemplate", false, func(ctx context.Context) error {
+		return p.transport.DeleteNotificationTemplate(ctx, event, channel, locale)
+	})
+}
+
+func (p *transportPolicy) FindContentRules(ctx context.Context) (res *ContentRulesResponse, err error) {
+	err = p.call(ctx, "FindContentRules", true, func(ctx context.Context) error {
+		res, err = p.transport.FindContentRules(ctx)
+		return err
+	})
+	return res, err
+}
+
+func (p *transportPolicy) SaveContentRule(ctx context.Context, name string, ruleByte []byte) (res *ContentRuleResponse, err error) {
+	err = p.call(ctx, "SaveContentRule", false, func(ctx context.Context) error {
+		res, err = p.transport.SaveContentRule(ctx, name, ruleByte)
+		return err
+	})
+	return res, err
+}
+
+func (p *transportPolicy) DeleteContentRule(ctx context.Context, name string) error {
+	return p.call(ctx, "DeleteContentRule", false, func(ctx context.Context) error {
+		return p.transport.DeleteContentRule(ctx, name)
+	})
+}
+
+func (p *transportPolicy) FindOutboxEvents(ctx context.Context, filter events.ReplayFilter, afterID int64, limit int) (res *OutboxEventsResponse, err error) {
+	err = p.call(ctx, "FindOutboxEvents", true, func(ctx context.Context) error {
+		res, err = p.transport.FindOutboxEvents(ctx, filter, afterID, limit)
+		return err
+	})
+	return res, err
+}
+
+func (p *transportPolicy) FindDeadLetters(ctx context.Context, source string, pageNum, pageSize int) (res *DeadLettersResponse, err error) {
+	err = p.call(ctx, "FindDeadLetters", true, func(ctx context.Context) error {
+		res, err = p.transport.FindDeadLetters(ctx, source, pageNum, pageSize)
+		return err
+	})
+	return res, err
+}
+
+func (p *transportPolicy) FindDeadLetter(ctx context.Context, id int64) (res *DeadLetterResponse, err error) {
+	err = p.call(ctx, "FindDeadLetter", true, func(ctx context.Context) error {
+		res, err = p.transport.FindDeadLetter(ctx, id)
+		return err
+	})
+	return res, err
+}
+
+func (p *transportPolicy) CreateDeadLetter(ctx context.Context, letterByte []byte) (res *DeadLetterResponse, err error) {
+	err = p.call(ctx, "CreateDeadLetter", false, func(ctx context.Context) error {
+		res, err = p.transport.CreateDeadLetter(ctx, letterByte)
+		return err
+	})
+	return res, err
+}
+
+func (p *transportPolicy) UpdateDeadLetter(ctx context.Context, id int64, updateByte []byte) (res *DeadLetterResponse, err error) {
+	err = p.call(ctx, "UpdateDeadLetter", false, func(ctx context.Context) error {
+		res, err = p.transport.UpdateDeadLetter(ctx, id, updateByte)
+		return err
+	})
+	return res, err
+}
+
+func (p *transportPolicy) RequeueDeadLetter(ctx context.Context, id int64) (res *DeadLetterResponse, err error) {
+	err = p.call(ctx, "RequeueDeadLetter", false, func(ctx context.Context) error {
+		res, err = p.transport.RequeueDeadLetter(ctx, id)
+		return err
+	})
+	return res, err
+}
+
+func (p *transportPolicy) DeleteDeadLetter(ctx context.Context, id int64) error {
+	return p.call(ctx, "DeleteDeadLetter", false, func(ctx context.Context) error {
+		return p.transport.DeleteDeadLetter(ctx, id)
+	})
+}
+
+func (p *transportPolicy) FindAdminActions(ctx context.Context, status string, pageNum, pageSize int) (res *AdminActionsResponse, err error) {
+	err = p.call(ctx, "FindAdminActions", true, func(ctx context.Context) error {
+		res, err = p.transport.FindAdminActions(ctx, status, pageNum, pageSize)
+		return err
+	})
+	return res, err
+}
+
+func (p *transportPolicy) FindAdminAction(ctx context.Context, id int64) (res *AdminActionResponse, err error) {
+	err = p.call(ctx, "FindAdminAction", true, func(ctx context.Context) error {
+		res, err = p.transport.FindAdminAction(ctx, id)
+		return err
+	})
+	return res, err
+}
+
+func (p *transportPolicy) CreateAdminAction(ctx context.Context, actionByte []byte) (res *AdminActionResponse, err error) {
+	err = p.call(ctx, "CreateAdminAction", false, func(ctx context.Context) error {
+		res, err = p.transport.CreateAdminAction(ctx, actionByte)
+		return err
+	})
+	return res, err
+}
+
+func (p *transportPolicy) DecideAdminAction(ctx context.Context, id int64, decisionByte []byte) (res *AdminActionResponse, err error) {
+	err = p.call(ctx, "DecideAdminAction", false, func(ctx context.Context) error {
+		res, err = p.transport.DecideAdminAction(ctx, id, decisionByte)
+		return err
+	})
+	return res, err
+}
+
+func (p *transportPolicy) RecordAdminActionOutcome(ctx context.Context, id int64, outcomeByte []byte) (res *AdminActionResponse, err error) {
+	err = p.call(ctx, "RecordAdminActionOutcome", false, func(ctx context.Context) error {
+		res, err = p.transport.RecordAdminActionOutcome(ctx, id, outcomeByte)
+		return err
+	})
+	return res, err
+}
+
+func (p *transportPolicy) FindUserWebhooks(ctx context.Context, userID int) (res *WebhooksResponse, err error) {
+	err = p.call(ctx, "FindUserWebhooks", true, func(ctx context.Context) error {
+		res, err = p.transport.FindUserWebhooks(ctx, userID)
+		return err
+	})
+	return res, err
+}
+
+func (p *transportPolicy) CreateUserWebhook(ctx context.Context, userID int, webhookByte []byte) (res *WebhookResponse, err error) {
+	err = p.call(ctx, "CreateUserWebhook", false, func(ctx context.Context) error {
+		res, err = p.transport.CreateUserWebhook(ctx, userID, webhookByte)
+		return err
+	})
+	return res, err
+}
+
+func (p *transportPolicy) DeleteUserWebhook(ctx context.Context, userID, webhookID int) error {
+	return p.call(ctx, "DeleteUserWebhook", false, func(ctx context.Context) error {
+		return p.transport.DeleteUserWebhook(ctx, userID, webhookID)
+	})
+}
+
+func (p *transportPolicy) FindWebhookDeliveries(ctx context.Context, userID, webhookID int, status string, limit int) (res *WebhookDeliveriesResponse, err error) {
+	err = p.call(ctx, "FindWebhookDeliveries", true, func(ctx context.Context) error {
+		res, err = p.transport.FindWebhookDeliveries(ctx, userID, webhookID, status, limit)
+		return err
+	})
+	return res, err
+}
+
+// a webhook event queued twice is delivered once, so it is retried like a read
+func (p *transportPolicy) PublishWebhookEvent(ctx context.Context, eventByte []byte) error {
+	return p.call(ctx, "PublishWebhookEvent", true, func(ctx context.Context) error {
+		return p.transport.PublishWebhookEvent(ctx, eventByte)
+	})
+}
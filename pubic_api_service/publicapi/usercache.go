@@ -0,0 +1,190 @@
+package publicapi
+
+import (
+	"container/list"
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// =========== REPOSITORY LAYER, CACHE OF USERS FETCHED FROM USER SERVICE ===========
+
+// USER_CACHE_SIZE users kept, least recently used are evicted first, 0 disables the cache
+// USER_CACHE_TTL how long a cached user is served before it is fetched again
+var cachedUsers = newUserCache(cfg.Int("USER_CACHE_SIZE", 10000), cfg.Duration("USER_CACHE_TTL", time.Minute))
+
+type userCacheEntry struct {
+	user      User
+	expiresAt time.Time
+}
+
+// lru of users by id with a ttl per entry, changes made through another path than the public API show after ttl
+type userCache struct {
+	size int
+	ttl  time.Duration
+
+	mu      sync.Mutex
+	order   *list.List
+	entries map[int]*list.Element
+}
+
+func newUserCache(size int, ttl time.Duration) *userCache {
+	return &userCache{size: size, ttl: ttl, order: list.New(), entries: map[int]*list.Element{}}
+}
+
+func (c *userCache) enabled() bool {
+	return c.size > 0 && c.ttl > 0
+}
+
+// get user of id, false when missing or expired
+func (c *userCache) get(id int) (User, bool) {
+	if !c.enabled() {
+		return User{}, false
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	elem, ok := c.entries[id]
+	if !ok {
+		userCacheRequests.WithLabelValues("miss").Inc()
+		return User{}, false
+	}
+
+	entry := elem.Value.(*userCacheEntry)
+	if !time.Now().Before(entry.expiresAt) {
+		c.order.Remove(elem)
+		delete(c.entries, id)
+		userCacheRequests.WithLabelValues("miss").Inc()
+		return User{}, false
+	}
+
+	c.order.MoveToFront(elem)
+	userCacheRequests.WithLabelValues("hit").Inc()
+	return entry.user, true
+}
+
+// put user with a fresh ttl, evicting the least recently used user when full
+func (c *userCache) put(user User) {
+	if !c.enabled() {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry := &userCacheEntry{user: user, expiresAt: time.Now().Add(c.ttl)}
+	if elem, ok := c.entries[user.ID]; ok {
+		elem.Value = entry
+		c.order.MoveToFront(elem)
+		return
+	}
+
+	c.entries[user.ID] = c.order.PushFront(entry)
+	if c.order.Len() > c.size {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*userCacheEntry).user.ID)
+	}
+}
+
+// invalidate drop user of id, called when the public API changes or deletes it
+func (c *userCache) invalidate(id int) {
+	if !c.enabled() {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if elem, ok := c.entries[id]; ok {
+		c.order.Remove(elem)
+		delete(c.entries, id)
+	}
+}
+
+// user service calls used by the usecases, served from the cache when possible and keeping it up to date.
+// Strong reads are served by the user service and refresh the cache
+
+func findUserByIDService(ctx context.Context, userID int) (*UserResponse, error) {
+	if user, ok := cachedUsers.get(userID); ok && !strongRead(ctx) {
+		recordCacheHit(ctx, http.MethodGet, fmt.Sprintf(apiPathUserGetDetail, userID))
+		return &UserResponse{Result: true, User: user}, nil
+	}
+
+	res, err := userClient.FindUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if res.Result {
+		cachedUsers.put(res.User)
+	}
+
+	return res, nil
+}
+
+// only users missing from the cache are fetched
+func findUsersByIDsService(ctx context.Context, userIDs []int) (*UsersResponse, error) {
+	var cached []User
+	var missing []int
+	var cachedIDs []string
+	for _, id := range userIDs {
+		if user, ok := cachedUsers.get(id); ok && !strongRead(ctx) {
+			cached = append(cached, user)
+			cachedIDs = append(cachedIDs, strconv.Itoa(id))
+			continue
+		}
+		missing = append(missing, id)
+	}
+	if len(cachedIDs) > 0 {
+		recordCacheHit(ctx, http.MethodGet, fmt.Sprintf(apiPathUserGetBatch, strings.Join(cachedIDs, ",")))
+	}
+	if len(missing) == 0 {
+		return &UsersResponse{Result: true, Users: cached}, nil
+	}
+
+	res, err := userClient.FindUsers(ctx, missing)
+	if err != nil {
+		return nil, err
+	}
+	if res.Result {
+		for _, user := range res.Users {
+			cachedUsers.put(user)
+		}
+	}
+	res.Users = append(res.Users, cached...)
+
+	return res, nil
+}
+
+func createUserService(ctx context.Context, userByte []byte) (*UserResponse, error) {
+	res, err := userClient.CreateUser(ctx, userByte)
+	if err != nil {
+		return nil, err
+	}
+	cachedUsers.put(res.User)
+
+	return res, nil
+}
+
+func updateUserService(ctx context.Context, userID int, userByte []byte) (*UserResponse, error) {
+	res, err := userClient.UpdateUser(ctx, userID, userByte)
+	// drop the cached user even when the call failed, the update may have been applied anyway
+	cachedUsers.invalidate(userID)
+	if err != nil {
+		return nil, err
+	}
+	cachedUsers.put(res.User)
+
+	return res, nil
+}
+
+func deleteUserService(ctx context.Context, userID int, hard bool) error {
+	err := userClient.DeleteUser(ctx, userID, hard)
+	cachedUsers.invalidate(userID)
+	return err
+}
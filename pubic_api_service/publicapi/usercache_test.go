@@ -0,0 +1,157 @@
+package publicapi
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+)
+
+func TestUserCache(t *testing.T) {
+	t.Run("least recently used is evicted", func(t *testing.T) {
+		cache := newUserCache(2, time.Minute)
+		cache.put(User{ID: 1})
+		cache.put(User{ID: 2})
+		cache.get(1)
+		cache.put(User{ID: 3})
+
+		if _, ok := cache.get(2); ok {
+			t.Error("user 2 still cached, want it evicted as least recently used")
+		}
+		for _, id := range []int{1, 3} {
+			if _, ok := cache.get(id); !ok {
+				t.Errorf("user %d evicted", id)
+			}
+		}
+	})
+
+	t.Run("put refreshes a cached user", func(t *testing.T) {
+		cache := newUserCache(2, time.Minute)
+		cache.put(User{ID: 1, Name: "old"})
+		cache.put(User{ID: 1, Name: "new"})
+
+		if user, ok := cache.get(1); !ok || user.Name != "new" {
+			t.Errorf("get = %+v, %t, want the new name", user, ok)
+		}
+		if cache.order.Len() != 1 {
+			t.Errorf("%d entries, want 1", cache.order.Len())
+		}
+	})
+
+	t.Run("expired", func(t *testing.T) {
+		cache := newUserCache(2, time.Minute)
+		cache.put(User{ID: 1})
+		cache.entries[1].Value.(*userCacheEntry).expiresAt = time.Now().Add(-time.Second)
+
+		if _, ok := cache.get(1); ok {
+			t.Error("expired user served")
+		}
+		if len(cache.entries) != 0 || cache.order.Len() != 0 {
+			t.Error("expired user kept in the cache")
+		}
+	})
+
+	t.Run("invalidate", func(t *testing.T) {
+		cache := newUserCache(2, time.Minute)
+		cache.put(User{ID: 1})
+		cache.invalidate(1)
+		cache.invalidate(2)
+
+		if _, ok := cache.get(1); ok {
+			t.Error("invalidated user served")
+		}
+	})
+
+	t.Run("disabled", func(t *testing.T) {
+		for _, cache := range []*userCache{newUserCache(0, time.Minute), newUserCache(2, 0)} {
+			cache.put(User{ID: 1})
+			if _, ok := cache.get(1); ok {
+				t.Errorf("size %d ttl %s: user served by a disabled cache", cache.size, cache.ttl)
+			}
+		}
+	})
+}
+
+// user client serving users by id and recording the ids fetched
+type cacheUserClient struct {
+	UserClient
+	users   map[int]User
+	fetched [][]int
+	err     error
+}
+
+func (c *cacheUserClient) FindUser(ctx context.Context, userID int) (*UserResponse, error) {
+	c.fetched = append(c.fetched, []int{userID})
+	if c.err != nil {
+		return nil, c.err
+	}
+	return &UserResponse{Result: true, User: c.users[userID]}, nil
+}
+
+func (c *cacheUserClient) FindUsers(ctx context.Context, userIDs []int) (*UsersResponse, error) {
+	c.fetched = append(c.fetched, userIDs)
+	if c.err != nil {
+		return nil, c.err
+	}
+	res := &UsersResponse{Result: true}
+	for _, id := range userIDs {
+		if user, ok := c.users[id]; ok {
+			res.Users = append(res.Users, user)
+		}
+	}
+	return res, nil
+}
+
+func (c *cacheUserClient) DeleteUser(ctx context.Context, userID int, hard bool) error {
+	return c.err
+}
+
+func TestUserCacheServices(t *testing.T) {
+	client := &cacheUserClient{users: map[int]User{1: {ID: 1, Name: "a"}, 2: {ID: 2, Name: "b"}, 3: {ID: 3, Name: "c"}}}
+
+	previousClient, previousCache := userClient, cachedUsers
+	userClient, cachedUsers = client, newUserCache(10, time.Minute)
+	defer func() { userClient, cachedUsers = previousClient, previousCache }()
+
+	ctx := context.Background()
+
+	if _, err := findUserByIDService(ctx, 1); err != nil {
+		t.Fatal(err)
+	}
+	if res, err := findUserByIDService(ctx, 1); err != nil || res.User.Name != "a" {
+		t.Fatalf("cached user = %+v, %v", res, err)
+	}
+
+	// only 2, 3 and the unknown 4 are fetched, a missing user is not cached
+	res, err := findUsersByIDsService(ctx, []int{1, 2, 3, 4})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ids []int
+	for _, user := range res.Users {
+		ids = append(ids, user.ID)
+	}
+	sort.Ints(ids)
+	if !reflect.DeepEqual(ids, []int{1, 2, 3}) {
+		t.Errorf("users %v, want 1, 2 and 3", ids)
+	}
+	if _, err := findUsersByIDsService(ctx, []int{2, 3, 4}); err != nil {
+		t.Fatal(err)
+	}
+
+	want := [][]int{{1}, {2, 3, 4}, {4}}
+	if !reflect.DeepEqual(client.fetched, want) {
+		t.Errorf("fetched %v, want %v", client.fetched, want)
+	}
+
+	// a failed delete may have been applied, the user is fetched again
+	client.err = errors.New("connection reset")
+	if err := deleteUserService(ctx, 1, false); err == nil {
+		t.Fatal("delete error lost")
+	}
+	if _, ok := cachedUsers.get(1); ok {
+		t.Error("user still cached after delete")
+	}
+}
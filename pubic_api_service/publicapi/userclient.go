@@ -0,0 +1,96 @@
+package publicapi
+
+import (
+	"context"
+
+	"events"
+)
+
+// =========== REPOSITORY LAYER, CLIENT OF THE USER SERVICE ===========
+
+// UserClient calls of the public API to the user service, bodies are the JSON sent to the user service API.
+// Errors the usecases act on are ErrUserNotFound, ErrUserLegalHold, ErrUserUpdateEmpty, ErrUserEmailTaken,
+// ErrInvalidCredentials, ErrPolicyVersionInvalid, ErrBlockInvalid and ErrPrivacyUpdateEmpty, any other error is answered as an upstream failure
+type UserClient interface {
+	FindUser(ctx context.Context, userID int) (*UserResponse, error)
+	FindUsers(ctx context.Context, userIDs []int) (*UsersResponse, error)
+	ListUsers(ctx context.Context, pageNum, pageSize int) (*UsersPageResponse, error)
+	CreateUser(ctx context.Context, userByte []byte) (*UserResponse, error)
+	UpdateUser(ctx context.Context, userID int, userByte []byte) (*UserResponse, error)
+	DeleteUser(ctx context.Context, userID int, hard bool) error
+	SetUserLegalHold(ctx context.Context, userID int, holdByte []byte) error
+	SetUserRole(ctx context.Context, userID int, roleByte []byte) (*UserResponse, error)
+	Login(ctx context.Context, loginByte []byte) (*LoginResponse, error)
+	FindPolicies(ctx context.Context) (*PoliciesResponse, error)
+	FindUserConsents(ctx context.Context, userID int) (*ConsentsResponse, error)
+	CreateUserConsent(ctx context.Context, userID int, consentByte []byte) (*ConsentResponse, error)
+	FindUserBlocks(ctx context.Context, userID int) (*BlocksResponse, error)
+	CreateUserBlock(ctx context.Context, userID int, blockByte []byte) (*BlockResponse, error)
+	DeleteUserBlock(ctx context.Context, userID, blockedUserID int) error
+	FindUserPrivacy(ctx context.Context, userID int) (*PrivacyResponse, error)
+	UpdateUserPrivacy(ctx context.Context, userID int, privacyByte []byte) (*PrivacyResponse, error)
+	FindNotificationPreferences(ctx context.Context, userID int) (*NotificationPreferencesResponse, error)
+	UpdateNotificationPreferences(ctx context.Context, userID int, preferencesByte []byte) (*NotificationPreferencesResponse, error)
+	FindUserFavorites(ctx context.Context, userID, pageNum, pageSize int) (*FavoritesResponse, error)
+	AddUserFavorite(ctx context.Context, userID, listingID int) (*FavoriteResponse, error)
+	RemoveUserFavorite(ctx context.Context, userID, listingID int) error
+	FindUserDevices(ctx context.Context, userID int) (*PushDevicesResponse, error)
+	RegisterUserDevice(ctx context.Context, userID int, deviceByte []byte) (*PushDeviceResponse, error)
+	DeleteUserDevice(ctx context.Context, userID, deviceID int) error
+	FindPushReceipts(ctx context.Context, userID, deviceID, limit int) (*PushReceiptsResponse, error)
+	RecordPushReceipts(ctx context.Context, receiptsByte []byte) error
+	FindUserInbox(ctx context.Context, userID int, unread bool, pageNum, pageSize int) (*InboxNotificationsResponse, error)
+	CreateInboxNotification(ctx context.Context, userID int, notificationByte []byte) (*InboxNotificationResponse, error)
+	MarkInboxRead(ctx context.Context, userID int, readByte []byte) (*InboxReadResponse, error)
+	FindBroadcasts(ctx context.Context, limit int) (*BroadcastsResponse, error)
+	CreateBroadcast(ctx context.Context, broadcastByte []byte) (*BroadcastResponse, error)
+	FindBroadcast(ctx context.Context, broadcastID int) (*BroadcastResponse, error)
+	CancelBroadcast(ctx context.Context, broadcastID int) (*BroadcastResponse, error)
+	CountBroadcastAudience(ctx context.Context, audienceByte []byte) (*BroadcastAudienceResponse, error)
+	ClaimBroadcastRecipients(ctx context.Context, limit int) (*BroadcastBatchResponse, error)
+	RecordBroadcastStats(ctx context.Context, broadcastID int, statsByte []byte) error
+	RecordEmailEvents(ctx context.Context, eventsByte []byte) (*EmailEventsRecordResponse, error)
+	FindUserEmailEvents(ctx context.Context, userID, limit int) (*EmailEventsResponse, error)
+	FindEmailSuppressions(ctx context.Context, reason string, limit int) (*EmailSuppressionsResponse, error)
+	FindUserEmailSuppression(ctx context.Context, userID int) (*EmailSuppressionResponse, error)
+	SuppressUserEmail(ctx context.Context, userID int, suppressionByte []byte) (*EmailSuppressionResponse, error)
+	UnsuppressUserEmail(ctx context.Context, userID int) error
+	RecordAudit(ctx context.Context, entryByte []byte) error
+	FindAuditLog(ctx context.Context, filter AuditLogFilter, pageNum, pageSize int) (*AuditLogResponse, error)
+	FindAuditChain(ctx context.Context, afterID int64, limit int) (*AuditChainResponse, error)
+	VerifyAuditChain(ctx context.Context) (*AuditChainVerificationResponse, error)
+	FindNotificationTemplates(ctx context.Context) (*NotificationTemplatesResponse, error)
+	FindNotificationTemplateVersions(ctx context.Context, event, channel, locale string) (*NotificationTemplatesResponse, error)
+	CreateNotificationTemplate(ctx context.Context, templateByte []byte) (*NotificationTemplateResponse, error)
+	DeleteNotificationTemplate(ctx context.Context, event, channel, locale string) error
+	FindContentRules(ctx context.Context) (*ContentRulesResponse, error)
+	SaveContentRule(ctx context.Context, name string, ruleByte []byte) (*ContentRuleResponse, error)
+	DeleteContentRule(ctx context.Context, name string) error
+	FindUserWebhooks(ctx context.Context, userID int) (*WebhooksResponse, error)
+	CreateUserWebhook(ctx context.Context, userID int, webhookByte []byte) (*WebhookResponse, error)
+	DeleteUserWebhook(ctx context.Context, userID, webhookID int) error
+	FindWebhookDeliveries(ctx context.Context, userID, webhookID int, status string, limit int) (*WebhookDeliveriesResponse, error)
+	PublishWebhookEvent(ctx context.Context, eventByte []byte) error
+	FindOutboxEvents(ctx context.Context, filter events.ReplayFilter, afterID int64, limit int) (*OutboxEventsResponse, error)
+	FindDeadLetters(ctx context.Context, source string, pageNum, pageSize int) (*DeadLettersResponse, error)
+	FindDeadLetter(ctx context.Context, id int64) (*DeadLetterResponse, error)
+	CreateDeadLetter(ctx context.Context, letterByte []byte) (*DeadLetterResponse, error)
+	UpdateDeadLetter(ctx context.Context, id int64, updateByte []byte) (*DeadLetterResponse, error)
+	RequeueDeadLetter(ctx context.Context, id int64) (*DeadLetterResponse, error)
+	DeleteDeadLetter(ctx context.Context, id int64) error
+	FindAdminActions(ctx context.Context, status string, pageNum, pageSize int) (*AdminActionsResponse, error)
+	FindAdminAction(ctx context.Context, id int64) (*AdminActionResponse, error)
+	CreateAdminAction(ctx context.Context, actionByte []byte) (*AdminActionResponse, error)
+	DecideAdminAction(ctx context.Context, id int64, decisionByte []byte) (*AdminActionResponse, error)
+	RecordAdminActionOutcome(ctx context.Context, id int64, outcomeByte []byte) (*AdminActionResponse, error)
+}
+
+// client used by the repository functions, the transport of USER_SERVICE_TRANSPORT once Run started
+var userClient UserClient = httpUserClient{}
+
+// user service over HTTP with the shared client, so retries, breaker, metrics and the api key apply
+type httpUserClient struct{}
+
+func (httpUserClient) Name() string {
+	return "http"
+}
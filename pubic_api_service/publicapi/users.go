@@ -0,0 +1,170 @@
+package publicapi
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"sync"
+
+	"apperror"
+
+	"github.com/gin-gonic/gin"
+)
+
+// user as anyone may read it, the role stays with the admin api
+type PublicUser struct {
+	ID        int    `json:"id"`
+	Name      string `json:"name"`
+	CreatedAt int64  `json:"created_at"`
+	UpdatedAt int64  `json:"updated_at"`
+	// listings not deleted, only with listing_count=true
+	ListingCount *int `json:"listing_count,omitempty"`
+}
+
+// LISTING_COUNT_CONCURRENCY max listing service calls in flight when counting the listings of a page of users
+var listingCountConcurrency = cfg.Int("LISTING_COUNT_CONCURRENCY", 4)
+
+// =========== INTERFACE HANDLER, HANDLING REQUEST RESPONSE API DEPEND INTERFACE ===========
+
+// users newest first
+func getUsersHandler(c *gin.Context) {
+	pageNum, errNum := strconv.Atoi(c.DefaultQuery("page_num", "1"))
+	pageSize, errSize := strconv.Atoi(c.DefaultQuery("page_size", "10"))
+	if errNum != nil || errSize != nil {
+		apperror.Respond(c, errUsersPage)
+		return
+	}
+
+	users, pagination, err := getUsersUsecase(c.Request.Context(), pageNum, pageSize, c.Query("listing_count") == "true")
+	if err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"users": users, "pagination": pagination})
+}
+
+// 404 for deleted users too
+func getUserHandler(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "handler error", "code", "512", "error", err)
+		apperror.JSON(c, http.StatusBadRequest, "Invalid user ID")
+		return
+	}
+
+	res, err := getUserUsecase(c.Request.Context(), id, c.Query("listing_count") == "true")
+	if err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"user": res})
+}
+
+// =========== USECASE LAYER, SERVES AS AN INTERMEDIARY BETWEEN THE PRESENTATION LAYER AND THE DATA LAYER ===========
+
+func getUsersUsecase(ctx context.Context, pageNum, pageSize int, withListingCount bool) ([]PublicUser, *Pagination, error) {
+	if pageNum < 1 || pageSize < 1 || pageSize > 100 {
+		return nil, nil, errUsersPage
+	}
+
+	res, err := userClient.ListUsers(ctx, pageNum, pageSize)
+	if err != nil {
+		return nil, nil, apperror.Upstream("Failed to get users", err)
+	}
+
+	users := make([]PublicUser, len(res.Users))
+	for i, user := range res.Users {
+		users[i] = publicUser(user)
+	}
+
+	if withListingCount {
+		if err := countListings(ctx, users); err != nil {
+			return nil, nil, apperror.Upstream("Failed to get listings", err)
+		}
+	}
+
+	return users, &res.Pagination, nil
+}
+
+func getUserUsecase(ctx context.Context, userID int, withListingCount bool) (*PublicUser, error) {
+	res, err := findUserByIDService(ctx, userID)
+	if err != nil {
+		if errors.Is(err, ErrUserNotFound) {
+			return nil, err
+		}
+		return nil, apperror.Upstream("Failed to get user", err)
+	}
+
+	users := []PublicUser{publicUser(res.User)}
+	if withListingCount {
+		if err := countListings(ctx, users); err != nil {
+			return nil, apperror.Upstream("Failed to get listings", err)
+		}
+	}
+
+	return &users[0], nil
+}
+
+func publicUser(user User) PublicUser {
+	return PublicUser{ID: user.ID, Name: user.Name, CreatedAt: user.CreatedAt, UpdatedAt: user.UpdatedAt}
+}
+
+// set the listing count of every user, one listing page per user is enough as only the total of the pagination is
+// used. The first failed call cancel the rest
+func countListings(ctx context.Context, users []PublicUser) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	workers := min(max(listingCountConcurrency, 1), len(users))
+
+	var (
+		wg       sync.WaitGroup
+		once     sync.Once
+		firstErr error
+		queue    = make(chan *PublicUser)
+	)
+
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for user := range queue {
+				res, err := fetchListingsService(ctx, strconv.Itoa(user.ID), "", 1, 1, "", "")
+				if err != nil {
+					once.Do(func() {
+						firstErr = err
+						cancel()
+					})
+					continue
+				}
+				user.ListingCount = &res.Pagination.TotalItems
+			}
+		}()
+	}
+
+	// stop queueing users once a worker failed
+feed:
+	for i := range users {
+		select {
+		case queue <- &users[i]:
+		case <-ctx.Done():
+			break feed
+		}
+	}
+	close(queue)
+	wg.Wait()
+
+	if firstErr != nil {
+		return firstErr
+	}
+
+	if err := ctx.Err(); err != nil && !errors.Is(err, context.Canceled) {
+		return err
+	}
+
+	return nil
+}
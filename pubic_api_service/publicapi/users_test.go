@@ -0,0 +1,108 @@
+package publicapi
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+type usersUserClient struct {
+	UserClient
+	users []User
+}
+
+func (c usersUserClient) FindUser(ctx context.Context, userID int) (*UserResponse, error) {
+	for _, user := range c.users {
+		if user.ID == userID {
+			return &UserResponse{Result: true, User: user}, nil
+		}
+	}
+	return nil, ErrUserNotFound
+}
+
+func (c usersUserClient) ListUsers(ctx context.Context, pageNum, pageSize int) (*UsersPageResponse, error) {
+	start := min((pageNum-1)*pageSize, len(c.users))
+	end := min(start+pageSize, len(c.users))
+	return &UsersPageResponse{Result: true, Users: c.users[start:end], Pagination: Pagination{PageNum: pageNum, PageSize: pageSize, TotalItems: len(c.users)}}, nil
+}
+
+type countListingClient struct {
+	ListingClient
+	mu     sync.Mutex
+	counts map[string]int
+	calls  []string
+	err    error
+}
+
+func (c *countListingClient) FetchListings(ctx context.Context, userID, region string, pageNum, pageSize int, sortBy, sortDir string) (*ListingsResponse, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.calls = append(c.calls, userID)
+	if c.err != nil {
+		return nil, c.err
+	}
+	return &ListingsResponse{Result: true, Pagination: Pagination{PageNum: pageNum, PageSize: pageSize, TotalItems: c.counts[userID]}}, nil
+}
+
+func TestGetUsersUsecase(t *testing.T) {
+	previousUsers, previousListings, previousCache := userClient, listingClient, cachedUsers
+	defer func() { userClient, listingClient, cachedUsers = previousUsers, previousListings, previousCache }()
+
+	userClient = usersUserClient{users: []User{{ID: 3, Name: "Carol", Role: "admin", Email: "carol@example.com"}, {ID: 2, Name: "Bob"}, {ID: 1, Name: "Alice"}}}
+	listings := &countListingClient{counts: map[string]int{"3": 2, "1": 5}}
+	listingClient = listings
+	cachedUsers = newUserCache(10, time.Minute)
+	ctx := context.Background()
+
+	users, pagination, err := getUsersUsecase(ctx, 1, 2, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(users) != 2 || users[0] != (PublicUser{ID: 3, Name: "Carol"}) || pagination.TotalItems != 3 || len(listings.calls) != 0 {
+		t.Errorf("page 1 = %+v %+v, want Carol and Bob without listing count", users, pagination)
+	}
+	if _, _, err := getUsersUsecase(ctx, 1, 101, false); !errors.Is(err, errUsersPage) {
+		t.Errorf("page size 101: %v, want errUsersPage", err)
+	}
+
+	users, _, err = getUsersUsecase(ctx, 1, 10, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, user := range users {
+		if user.ListingCount == nil || *user.ListingCount != listings.counts[strconv.Itoa(user.ID)] {
+			t.Errorf("user %d listing count %v, want %d", user.ID, user.ListingCount, listings.counts[strconv.Itoa(user.ID)])
+		}
+	}
+
+	user, err := getUserUsecase(ctx, 1, true)
+	if err != nil || user.Name != "Alice" || user.ListingCount == nil || *user.ListingCount != 5 {
+		t.Errorf("user 1 = %+v, %v, want Alice with 5 listings", user, err)
+	}
+	if _, err := getUserUsecase(ctx, 4, false); !errors.Is(err, ErrUserNotFound) {
+		t.Errorf("missing user: %v, want ErrUserNotFound", err)
+	}
+
+	listings.err = errors.New("listing service down")
+	if _, _, err := getUsersUsecase(ctx, 1, 10, true); err == nil {
+		t.Error("listing service down, want upstream error")
+	}
+}
+
+func TestGetAdminUsersUsecase(t *testing.T) {
+	previousUsers := userClient
+	defer func() { userClient = previousUsers }()
+	userClient = usersUserClient{users: []User{{ID: 2, Name: "Bob", Role: "agent", Email: "bob@example.com"}, {ID: 1, Name: "Alice"}}}
+
+	// admins see the role and email public users leave out
+	res, err := getAdminUsersUsecase(context.Background(), 1, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Users) != 2 || res.Users[0].Email != "bob@example.com" || res.Users[0].Role != "agent" || res.Users[1].Email != "" {
+		t.Errorf("admin users = %+v, want Bob with an email and Alice without one", res.Users)
+	}
+}
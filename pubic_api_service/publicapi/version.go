@@ -0,0 +1,166 @@
+package publicapi
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"apperror"
+
+	"github.com/gin-gonic/gin"
+)
+
+// =========== INTERFACE LAYER, API VERSIONS AND VERSION NEGOTIATION ===========
+
+// version of the public API, its routes are served under /public-api/<name> and have their own handlers
+// for their envelopes, usecases and repositories are shared by all versions
+type apiVersion struct {
+	name   string
+	routes func(r *gin.RouterGroup, idempotency gin.HandlerFunc)
+}
+
+const (
+	// header asking for a version on unversioned paths and naming the version of every versioned response
+	apiVersionHeader = "API-Version"
+
+	// version of unversioned paths when the client asks for none, the one of clients from before versioning
+	defaultAPIVersion = "v1"
+
+	apiVersionKey = "api_version"
+)
+
+// versions served, oldest first
+var apiVersions = []apiVersion{
+	{name: "v1", routes: routeV1},
+}
+
+var (
+	apiVersionPattern = regexp.MustCompile(`^v[0-9]+$`)
+	// Accept media type asking for a version, e.g. application/vnd.public-api.v1+json
+	apiVersionMediaType = regexp.MustCompile(`^application/vnd\.public-api\.(v[0-9]+)\+json$`)
+)
+
+// paths under /public-api that belong to no version
+var unversionedPaths = []string{"/public-api/media/", "/public-api/diagnostics/", "/public-api/admin/", "/public-api/email-events/", "/public-api/audit", "/public-api/graphql"}
+
+// set the version of the route group on the context and the response
+func apiVersionMiddleware(version string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Set(apiVersionKey, version)
+		c.Header(apiVersionHeader, version)
+		c.Next()
+	}
+}
+
+// apiVersionOf version of the route serving c
+func apiVersionOf(c *gin.Context) string {
+	return c.GetString(apiVersionKey)
+}
+
+// negotiateAPIVersion serve unversioned /public-api paths with the version asked by the API-Version header
+// or the Accept media type, default v1, by routing them to /public-api/<version>. A version in the path always
+// wins. Requests asking for an unknown version keep their path and are answered 406 by noRouteHandler
+func negotiateAPIVersion(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if rest, ok := unversionedAPIPath(r.URL.Path); ok {
+			version := requestedAPIVersion(r)
+			if version == "" {
+				version = defaultAPIVersion
+			}
+			if isAPIVersion(version) {
+				r.URL.Path = "/public-api/" + version + rest
+				r.URL.RawPath = ""
+			}
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// path after /public-api of a path without version that belongs to a version
+func unversionedAPIPath(path string) (string, bool) {
+	rest, ok := strings.CutPrefix(path, "/public-api")
+	if !ok || !strings.HasPrefix(rest, "/") {
+		return "", false
+	}
+
+	for _, prefix := range unversionedPaths {
+		if strings.HasPrefix(path, prefix) {
+			return "", false
+		}
+	}
+
+	segment, _, _ := strings.Cut(strings.TrimPrefix(rest, "/"), "/")
+	if apiVersionPattern.MatchString(segment) {
+		return "", false
+	}
+
+	return rest, true
+}
+
+// version asked by the API-Version header, 1 and v1 alike, or else by the Accept media type, empty when none
+func requestedAPIVersion(r *http.Request) string {
+	if version := strings.TrimSpace(r.Header.Get(apiVersionHeader)); version != "" {
+		if !strings.HasPrefix(version, "v") {
+			version = "v" + version
+		}
+		return version
+	}
+
+	for _, accept := range strings.Split(r.Header.Get("Accept"), ",") {
+		mediaType, _, _ := strings.Cut(accept, ";")
+		if match := apiVersionMediaType.FindStringSubmatch(strings.TrimSpace(mediaType)); match != nil {
+			return match[1]
+		}
+	}
+
+	return ""
+}
+
+func isAPIVersion(version string) bool {
+	for _, v := range apiVersions {
+		if v.name == version {
+			return true
+		}
+	}
+
+	return false
+}
+
+// answer 406 to requests for an unknown version, in the path or negotiated, false for other missing routes
+func respondUnknownAPIVersion(c *gin.Context) bool {
+	version := ""
+	if _, ok := unversionedAPIPath(c.Request.URL.Path); ok {
+		version = requestedAPIVersion(c.Request)
+	} else if rest, ok := strings.CutPrefix(c.Request.URL.Path, "/public-api/"); ok {
+		if segment, _, _ := strings.Cut(rest, "/"); apiVersionPattern.MatchString(segment) {
+			version = segment
+		}
+	}
+
+	if version == "" || isAPIVersion(version) {
+		return false
+	}
+
+	names := make([]string, len(apiVersions))
+	for i, v := range apiVersions {
+		names[i] = v.name
+	}
+	apperror.JSON(c, http.StatusNotAcceptable, fmt.Sprintf("Unknown API version %s, supported versions: %s", version, strings.Join(names, ", ")))
+	return true
+}
+
+// key of a "METHOD /route/template" rule, routes without version belong to the default version
+func versionedRouteKey(key string) string {
+	method, path, ok := strings.Cut(key, " ")
+	if !ok {
+		return key
+	}
+
+	if rest, ok := unversionedAPIPath(path); ok {
+		return method + " /public-api/" + defaultAPIVersion + rest
+	}
+
+	return key
+}
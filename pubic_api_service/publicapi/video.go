@@ -0,0 +1,503 @@
+package publicapi
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"log/slog"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"apperror"
+
+	"github.com/gin-gonic/gin"
+)
+
+type Video struct {
+	ID          int    `json:"id"`
+	ListingID   int    `json:"listing_id"`
+	Status      string `json:"status"`
+	PlaybackURL string `json:"playback_url,omitempty"`
+	Error       string `json:"error,omitempty"`
+	ScanStatus  string `json:"scan_status,omitempty"`
+	ScanEngine  string `json:"scan_engine,omitempty"`
+	ScannedAt   int64  `json:"scanned_at,omitempty"`
+	CreatedAt   int64  `json:"created_at"`
+	UpdatedAt   int64  `json:"updated_at"`
+}
+
+type VideoResponse struct {
+	Result bool `json:"result"`
+	Video  Video
+}
+
+const (
+	videoStatusProcessing = "processing"
+	videoStatusReady      = "ready"
+	videoStatusFailed     = "failed"
+)
+
+var (
+	// MEDIA_DIR root directory of uploaded and transcoded media
+	mediaDir = cfg.String("MEDIA_DIR", "media")
+	// MEDIA_BASE_URL prefix of playback urls returned to clients
+	mediaBaseURL = strings.TrimRight(cfg.String("MEDIA_BASE_URL", "/public-api/media"), "/")
+	// VIDEO_MAX_BYTES max size of uploaded video
+	videoMaxBytes = int64(cfg.Int("VIDEO_MAX_BYTES", 100<<20))
+	// VIDEO_TRANSCODE_TIMEOUT max duration of one transcode job
+	videoTranscodeTimeout = cfg.Duration("VIDEO_TRANSCODE_TIMEOUT", 10*time.Minute)
+
+	videoSourceDir   = filepath.Join(mediaDir, "videos", "source")
+	videoPlaybackDir = filepath.Join(mediaDir, "videos", "playback")
+)
+
+// stored extension and ffmpeg demuxer of an allowed sniffed video type
+type videoFormat struct {
+	ext     string
+	demuxer string
+}
+
+var videoFormats = map[string]videoFormat{
+	"video/mp4":       {ext: ".mp4", demuxer: "mp4"},
+	"video/quicktime": {ext: ".mov", demuxer: "mov"},
+	"video/webm":      {ext: ".webm", demuxer: "webm"},
+}
+
+var (
+	errVideoNotFound    = apperror.NotFound("Video not found")
+	errVideoInvalid     = errors.New("file must be a mp4, mov or webm video")
+	errVideoQueueIsFull = errors.New("video transcode queue is full")
+)
+
+// =========== INTERFACE HANDLER, HANDLING REQUEST RESPONSE API DEPEND INTERFACE ===========
+
+func uploadListingVideoHandler(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "handler error", "code", "055", "error", err)
+		apperror.JSON(c, http.StatusBadRequest, "Invalid listing ID")
+		return
+	}
+
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, videoMaxBytes)
+	file, err := c.FormFile("file")
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "handler error", "code", "056", "error", err)
+		apperror.JSON(c, http.StatusBadRequest, fmt.Sprintf("file is required, max %d bytes", videoMaxBytes))
+		return
+	}
+
+	res, err := uploadListingVideoUsecase(c.Request.Context(), id, authUserID(c), file)
+	if err != nil {
+		switch {
+		case errors.Is(err, errListingNotOwned):
+			apperror.JSON(c, http.StatusForbidden, "Listing does not belong to user")
+		case errors.Is(err, errVideoInvalid):
+			apperror.JSON(c, http.StatusUnsupportedMediaType, err.Error())
+		case errors.Is(err, errVideoQueueIsFull):
+			apperror.JSON(c, http.StatusServiceUnavailable, "Video processing is busy, try again later")
+		case errors.Is(err, errFileInfected):
+			apperror.JSON(c, http.StatusUnprocessableEntity, "File rejected by malware scan")
+		case errors.Is(err, errFileScanUnavailable):
+			apperror.JSON(c, http.StatusServiceUnavailable, "File scan is unavailable, try again later")
+		default:
+			apperror.Respond(c, err)
+		}
+		return
+	}
+
+	transformVideo(c.Request.Context(), res)
+	c.JSON(http.StatusAccepted, gin.H{"video": res})
+}
+
+func getListingVideoHandler(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "handler error", "code", "057", "error", err)
+		apperror.JSON(c, http.StatusBadRequest, "Invalid listing ID")
+		return
+	}
+
+	videoID, err := strconv.Atoi(c.Param("video_id"))
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "handler error", "code", "058", "error", err)
+		apperror.JSON(c, http.StatusBadRequest, "Invalid video ID")
+		return
+	}
+
+	res, err := getListingVideoUsecase(c.Request.Context(), id, videoID)
+	if err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+
+	transformVideo(c.Request.Context(), res)
+	c.JSON(http.StatusOK, gin.H{"video": res})
+}
+
+// =========== USECASE LAYER, SERVES AS AN INTERMEDIARY BETWEEN THE PRESENTATION LAYER AND THE DATA LAYER ===========
+
+// store uploaded video of own listing and queue it for transcoding
+func uploadListingVideoUsecase(ctx context.Context, listingID, userID int, file *multipart.FileHeader) (*Video, error) {
+	// trust file content over client supplied content type and file name
+	contentType, err := sniffVideoType(file)
+	if err != nil {
+		slog.ErrorContext(ctx, "usecase error", "code", "541", "error", err)
+		return nil, err
+	}
+
+	format, ok := videoFormats[contentType]
+	if !ok {
+		return nil, fmt.Errorf("%w, got %s", errVideoInvalid, contentType)
+	}
+
+	if err := checkListingOwner(ctx, listingID, userID); err != nil {
+		return nil, err
+	}
+
+	scan, err := scanUpload(ctx, listingID, file)
+	if err != nil {
+		return nil, err
+	}
+
+	sourcePath, err := saveVideoSource(listingID, format.ext, file)
+	if err != nil {
+		slog.ErrorContext(ctx, "usecase error", "code", "059", "error", err)
+		return nil, err
+	}
+
+	form := url.Values{
+		"source_path": {sourcePath},
+		"scan_status": {scan.Status},
+		"scan_engine": {scan.Engine},
+		"scanned_at":  {strconv.FormatInt(scan.ScannedAt.UnixMicro(), 10)},
+	}
+	res, err := createListingVideoService(ctx, listingID, form)
+	if err != nil {
+		os.Remove(sourcePath)
+		return nil, apperror.Upstream("Failed to create video", err)
+	}
+
+	job := videoJob{listingID: listingID, videoID: res.Video.ID, sourcePath: sourcePath, demuxer: format.demuxer}
+	select {
+	case videoJobs <- job:
+	default:
+		slog.ErrorContext(ctx, "usecase error", "code", "060", "error", errVideoQueueIsFull)
+		markVideoFailed(job, errVideoQueueIsFull)
+		return nil, errVideoQueueIsFull
+	}
+
+	return &res.Video, nil
+}
+
+func getListingVideoUsecase(ctx context.Context, listingID, videoID int) (*Video, error) {
+	res, err := findListingVideoService(ctx, listingID, videoID)
+	if err != nil {
+		if errors.Is(err, errVideoNotFound) {
+			return nil, err
+		}
+		return nil, apperror.Upstream("Failed to get video", err)
+	}
+
+	return &res.Video, nil
+}
+
+// quicktime files start with an ftyp box of brand "qt  ", which http.DetectContentType does not know
+func sniffVideoType(file *multipart.FileHeader) (string, error) {
+	src, err := file.Open()
+	if err != nil {
+		return "", err
+	}
+	defer src.Close()
+
+	head := make([]byte, 512)
+	n, err := src.Read(head)
+	if err != nil && n == 0 {
+		return "", err
+	}
+	head = head[:n]
+
+	if len(head) >= 12 && string(head[4:8]) == "ftyp" && string(head[8:12]) == "qt  " {
+		return "video/quicktime", nil
+	}
+	return http.DetectContentType(head), nil
+}
+
+// write upload to the source directory with a unique name and the extension of its sniffed type
+func saveVideoSource(listingID int, ext string, file *multipart.FileHeader) (string, error) {
+	if err := os.MkdirAll(videoSourceDir, 0o755); err != nil {
+		return "", err
+	}
+
+	name := fmt.Sprintf("%d-%d%s", listingID, time.Now().UnixNano(), ext)
+	path := filepath.Join(videoSourceDir, name)
+
+	src, err := file.Open()
+	if err != nil {
+		return "", err
+	}
+	defer src.Close()
+
+	dst, err := os.Create(path)
+	if err != nil {
+		return "", err
+	}
+	defer dst.Close()
+
+	if _, err := dst.ReadFrom(src); err != nil {
+		os.Remove(path)
+		return "", err
+	}
+
+	return path, nil
+}
+
+// =========== WORKER, TRANSCODE UPLOADED VIDEOS IN THE BACKGROUND ===========
+
+// convert source video to web playable file, implemented by any transcoding backend. demuxer is the container
+// sniffed from src at upload, one of videoFormats
+type Transcoder interface {
+	Transcode(ctx context.Context, src, demuxer, dst string) error
+}
+
+// transcode with ffmpeg binary to h264/aac mp4 capped at 720p
+type ffmpegTranscoder struct {
+	bin string
+}
+
+// the input is read as the sniffed container from the local file only, so playlists or concat lists in an upload
+// can not make ffmpeg fetch urls or read other files
+func (t ffmpegTranscoder) Transcode(ctx context.Context, src, demuxer, dst string) error {
+	cmd := exec.CommandContext(ctx, t.bin, "-y", "-protocol_whitelist", "file", "-f", demuxer, "-i", src,
+		"-vf", "scale=-2:'min(720,ih)'",
+		"-c:v", "libx264", "-preset", "veryfast", "-crf", "23",
+		"-c:a", "aac", "-b:a", "128k",
+		"-movflags", "+faststart",
+		dst)
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		// last lines of ffmpeg output explain the failure
+		if len(out) > 512 {
+			out = out[len(out)-512:]
+		}
+		return fmt.Errorf("ffmpeg: %w: %s", err, out)
+	}
+
+	return nil
+}
+
+// VIDEO_TRANSCODER select transcoding backend
+func newTranscoder() Transcoder {
+	switch name := cfg.String("VIDEO_TRANSCODER", "ffmpeg"); name {
+	case "ffmpeg":
+		return ffmpegTranscoder{bin: cfg.String("FFMPEG_PATH", "ffmpeg")}
+	default:
+		log.Fatalf("invalid VIDEO_TRANSCODER %q", name)
+		return nil
+	}
+}
+
+type videoJob struct {
+	listingID  int
+	videoID    int
+	sourcePath string
+	demuxer    string
+}
+
+// VIDEO_QUEUE_SIZE pending transcode jobs before uploads are rejected
+var videoJobs = make(chan videoJob, cfg.Int("VIDEO_QUEUE_SIZE", 100))
+
+var (
+	videoWorkers sync.WaitGroup
+	// closed on shutdown so workers stop taking jobs
+	videoWorkersStop = make(chan struct{})
+	// cancel running transcodes when shutdown timeout is reached
+	videoWorkersCtx, cancelVideoWorkers = context.WithCancel(context.Background())
+)
+
+var errVideoShutdown = errors.New("service shutting down, upload the video again")
+
+// VIDEO_TRANSCODE_WORKERS number of transcode jobs running at the same time
+func startVideoWorkers(transcoder Transcoder) {
+	for i := 0; i < cfg.Int("VIDEO_TRANSCODE_WORKERS", 1); i++ {
+		videoWorkers.Add(1)
+		go func() {
+			defer videoWorkers.Done()
+			for {
+				select {
+				case <-videoWorkersStop:
+					return
+				case job := <-videoJobs:
+					processVideoJob(videoWorkersCtx, transcoder, job)
+				}
+			}
+		}()
+	}
+}
+
+// wait for running transcodes until ctx is done then cancel them, queued jobs are marked failed
+func stopVideoWorkers(ctx context.Context) {
+	close(videoWorkersStop)
+
+	done := make(chan struct{})
+	go func() {
+		videoWorkers.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-ctx.Done():
+		slog.ErrorContext(ctx, "worker error", "code", "094", "error", "shutdown timeout, cancel running transcodes")
+		cancelVideoWorkers()
+		<-done
+	}
+
+	for {
+		select {
+		case job := <-videoJobs:
+			markVideoFailed(job, errVideoShutdown)
+		default:
+			return
+		}
+	}
+}
+
+// status updates use a fresh context so they are recorded even when the transcode is cancelled by shutdown
+func processVideoJob(parent context.Context, transcoder Transcoder, job videoJob) {
+	if _, err := updateListingVideoService(context.Background(), job.listingID, job.videoID, url.Values{"status": {videoStatusProcessing}}); err != nil {
+		slog.Error("worker error", "code", "061", "error", err)
+	}
+
+	if err := os.MkdirAll(videoPlaybackDir, 0o755); err != nil {
+		markVideoFailed(job, err)
+		return
+	}
+
+	name := fmt.Sprintf("%d-%d.mp4", job.listingID, job.videoID)
+	ctx, cancel := context.WithTimeout(parent, videoTranscodeTimeout)
+	defer cancel()
+
+	if err := transcoder.Transcode(ctx, job.sourcePath, job.demuxer, filepath.Join(videoPlaybackDir, name)); err != nil {
+		slog.ErrorContext(ctx, "worker error", "code", "062", "error", err)
+		markVideoFailed(job, err)
+		return
+	}
+
+	form := url.Values{
+		"status":       {videoStatusReady},
+		"playback_url": {mediaBaseURL + "/videos/" + name},
+	}
+	if _, err := updateListingVideoService(context.Background(), job.listingID, job.videoID, form); err != nil {
+		slog.ErrorContext(ctx, "worker error", "code", "063", "error", err)
+		return
+	}
+
+	// source is not needed once the playback file is ready
+	os.Remove(job.sourcePath)
+}
+
+func markVideoFailed(job videoJob, cause error) {
+	form := url.Values{"status": {videoStatusFailed}, "error": {cause.Error()}}
+	if _, err := updateListingVideoService(context.Background(), job.listingID, job.videoID, form); err != nil {
+		slog.Error("worker error", "code", "064", "error", err)
+	}
+}
+
+// =========== REPOSITORY LAYER, ABSTRACTION OVER THE DATA PERSISTENCE (databases, file systems, or external APIs) ===========
+
+var (
+	// listing service api path
+	apiPathListingVideoCreate = listingServiceURL + "/listings/%d/videos"
+	apiPathListingVideoDetail = listingServiceURL + "/listings/%d/videos/%d"
+)
+
+func createListingVideoService(ctx context.Context, listingID int, form url.Values) (*VideoResponse, error) {
+	defer listingsCache.invalidate(ctx)
+
+	resp, err := httpPostForm(ctx, fmt.Sprintf(apiPathListingVideoCreate, listingID), form)
+	if err != nil {
+		slog.ErrorContext(ctx, "service error", "code", "065", "error", err)
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusCreated {
+		slog.ErrorContext(ctx, "service error", "code", "066", "error", "error creating video from listing service")
+		return nil, errors.New("error creating video from listing service")
+	}
+
+	var video VideoResponse
+	if err := decodeJSON(resp.Body, &video); err != nil {
+		slog.ErrorContext(ctx, "service error", "code", "067", "error", err)
+		return nil, err
+	}
+
+	return &video, nil
+}
+
+func findListingVideoService(ctx context.Context, listingID, videoID int) (*VideoResponse, error) {
+	resp, err := httpGet(ctx, fmt.Sprintf(apiPathListingVideoDetail, listingID, videoID))
+	if err != nil {
+		slog.ErrorContext(ctx, "service error", "code", "068", "error", err)
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, errVideoNotFound
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		slog.ErrorContext(ctx, "service error", "code", "069", "error", "error fetching video from listing service")
+		return nil, errors.New("error fetching video from listing service")
+	}
+
+	var video VideoResponse
+	if err := decodeJSON(resp.Body, &video); err != nil {
+		slog.ErrorContext(ctx, "service error", "code", "070", "error", err)
+		return nil, err
+	}
+
+	return &video, nil
+}
+
+func updateListingVideoService(ctx context.Context, listingID, videoID int, form url.Values) (*VideoResponse, error) {
+	defer listingsCache.invalidate(ctx)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, fmt.Sprintf(apiPathListingVideoDetail, listingID, videoID), strings.NewReader(form.Encode()))
+	if err != nil {
+		slog.ErrorContext(ctx, "service error", "code", "071", "error", err)
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		slog.ErrorContext(ctx, "service error", "code", "072", "error", err)
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		slog.ErrorContext(ctx, "service error", "code", "073", "error", "error updating video from listing service")
+		return nil, errors.New("error updating video from listing service")
+	}
+
+	var video VideoResponse
+	if err := decodeJSON(resp.Body, &video); err != nil {
+		slog.ErrorContext(ctx, "service error", "code", "074", "error", err)
+		return nil, err
+	}
+
+	return &video, nil
+}
@@ -0,0 +1,83 @@
+package publicapi
+
+import (
+	"bytes"
+	"context"
+	"mime/multipart"
+	"net/http/httptest"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// multipart file of content sent with the client content type and file name
+func videoFileHeader(t *testing.T, name, contentType string, content []byte) *multipart.FileHeader {
+	t.Helper()
+	var body bytes.Buffer
+	w := multipart.NewWriter(&body)
+	part, err := w.CreatePart(textproto.MIMEHeader{
+		"Content-Disposition": {`form-data; name="file"; filename="` + name + `"`},
+		"Content-Type":        {contentType},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	part.Write(content)
+	w.Close()
+
+	req := httptest.NewRequest("POST", "/", &body)
+	req.Header.Set("Content-Type", w.FormDataContentType())
+	_, file, err := req.FormFile("file")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return file
+}
+
+func TestSniffVideoType(t *testing.T) {
+	tests := []struct {
+		name    string
+		content []byte
+		want    string
+	}{
+		{"mp4", append([]byte("\x00\x00\x00\x18ftypmp42\x00\x00\x00\x00mp42isom"), make([]byte, 32)...), "video/mp4"},
+		{"mov", append([]byte("\x00\x00\x00\x14ftypqt  \x00\x00\x00\x00qt  "), make([]byte, 32)...), "video/quicktime"},
+		{"webm", append([]byte("\x1a\x45\xdf\xa3"), make([]byte, 32)...), "video/webm"},
+		{"hls playlist", []byte("#EXTM3U\n#EXT-X-MEDIA-SEQUENCE:0\n#EXTINF:10.0,\nhttp://169.254.169.254/latest\n"), "text/plain; charset=utf-8"},
+	}
+	for _, tt := range tests {
+		// the client type and name are the ones of a video whatever the content
+		got, err := sniffVideoType(videoFileHeader(t, "tour.mp4", "video/mp4", tt.content))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != tt.want {
+			t.Errorf("%s: sniffed %q, want %q", tt.name, got, tt.want)
+		}
+		if _, ok := videoFormats[got]; ok != (tt.name != "hls playlist") {
+			t.Errorf("%s: allowed %v", tt.name, ok)
+		}
+	}
+}
+
+func TestFFmpegTranscoderArgs(t *testing.T) {
+	dir := t.TempDir()
+	args := filepath.Join(dir, "args")
+	bin := filepath.Join(dir, "ffmpeg")
+	if err := os.WriteFile(bin, []byte("#!/bin/sh\necho \"$@\" > "+args+"\n"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := (ffmpegTranscoder{bin: bin}).Transcode(context.Background(), "src.webm", "webm", "dst.mp4"); err != nil {
+		t.Fatal(err)
+	}
+	got, err := os.ReadFile(args)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(string(got), "-y -protocol_whitelist file -f webm -i src.webm ") {
+		t.Errorf("ffmpeg args %q, want the input limited to local files of the sniffed container", got)
+	}
+}
@@ -0,0 +1,737 @@
+package publicapi
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"apperror"
+
+	"github.com/gin-gonic/gin"
+)
+
+// time window the owner of a listing opens for visits, times are unix microseconds
+type ViewingSlot struct {
+	ID        int    `json:"id"`
+	ListingID int    `json:"listing_id"`
+	StartsAt  int64  `json:"starts_at"`
+	EndsAt    int64  `json:"ends_at"`
+	Capacity  int    `json:"capacity"`
+	Status    string `json:"status"`
+	Booked    int    `json:"booked"`
+	Available int    `json:"available"`
+	CreatedAt int64  `json:"created_at"`
+	UpdatedAt int64  `json:"updated_at"`
+}
+
+// booking of a slot by a user, times are copied from the slot
+type Viewing struct {
+	ID         int    `json:"id"`
+	SlotID     int    `json:"slot_id"`
+	ListingID  int    `json:"listing_id"`
+	UserID     int    `json:"user_id"`
+	OwnerID    int    `json:"owner_id"`
+	StartsAt   int64  `json:"starts_at"`
+	EndsAt     int64  `json:"ends_at"`
+	Status     string `json:"status"`
+	RemindedAt *int64 `json:"reminded_at"`
+	CreatedAt  int64  `json:"created_at"`
+	UpdatedAt  int64  `json:"updated_at"`
+}
+
+type ViewingSlotCreate struct {
+	StartsAt int64 `json:"starts_at" binding:"required,gt=0"`
+	EndsAt   int64 `json:"ends_at" binding:"required,gt=0"`
+	Capacity int   `json:"capacity" binding:"omitempty,gte=1,lte=100"`
+}
+
+type ViewingSlotResponse struct {
+	Result bool        `json:"result"`
+	Slot   ViewingSlot `json:"slot"`
+	// confirmed viewings cancelled with the slot
+	CancelledViewings []Viewing `json:"cancelled_viewings"`
+}
+
+type ViewingSlotsResponse struct {
+	Result bool          `json:"result"`
+	Slots  []ViewingSlot `json:"slots"`
+}
+
+type ViewingResponse struct {
+	Result  bool    `json:"result"`
+	Viewing Viewing `json:"viewing"`
+}
+
+type ViewingsResponse struct {
+	Result   bool      `json:"result"`
+	Viewings []Viewing `json:"viewings"`
+}
+
+var (
+	errViewingSlotNotFound = apperror.NotFound("Viewing slot not found")
+	errViewingNotFound     = apperror.NotFound("Viewing not found")
+	errViewingNotOwned     = errors.New("viewing does not belong to user")
+	errViewingStatus       = apperror.Validation("invalid status, supported values: confirmed, cancelled")
+)
+
+// =========== INTERFACE HANDLER, HANDLING REQUEST RESPONSE API DEPEND INTERFACE ===========
+
+func getViewingSlotsHandler(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "handler error", "code", "186", "error", err)
+		apperror.JSON(c, http.StatusBadRequest, "Invalid listing ID")
+		return
+	}
+
+	res, err := getViewingSlotsUsecase(c.Request.Context(), id, c.Query("from"))
+	if err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"slots": res})
+}
+
+func createViewingSlotHandler(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "handler error", "code", "187", "error", err)
+		apperror.JSON(c, http.StatusBadRequest, "Invalid listing ID")
+		return
+	}
+
+	var body ViewingSlotCreate
+	if err := c.ShouldBindJSON(&body); err != nil {
+		slog.ErrorContext(c.Request.Context(), "handler error", "code", "188", "error", "Invalid body request")
+		apperror.RespondBinding(c, err)
+		return
+	}
+
+	res, err := createViewingSlotUsecase(c.Request.Context(), id, authUserID(c), body)
+	if err != nil {
+		respondViewingError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"slot": res})
+}
+
+func cancelViewingSlotHandler(c *gin.Context) {
+	id, slotID, ok := viewingSlotParams(c)
+	if !ok {
+		return
+	}
+
+	res, err := cancelViewingSlotUsecase(c.Request.Context(), id, slotID, authUserID(c))
+	if err != nil {
+		respondViewingError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"slot": res.Slot, "cancelled_viewings": res.CancelledViewings})
+}
+
+func bookViewingHandler(c *gin.Context) {
+	id, slotID, ok := viewingSlotParams(c)
+	if !ok {
+		return
+	}
+
+	res, err := bookViewingUsecase(c.Request.Context(), id, slotID, authUserID(c))
+	if err != nil {
+		respondContactError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"viewing": res})
+}
+
+func getViewingsHandler(c *gin.Context) {
+	res, err := getViewingsUsecase(c.Request.Context(), authUserID(c), c.Query("status"))
+	if err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"viewings": res})
+}
+
+func getListingViewingsHandler(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "handler error", "code", "189", "error", err)
+		apperror.JSON(c, http.StatusBadRequest, "Invalid listing ID")
+		return
+	}
+
+	res, err := getListingViewingsUsecase(c.Request.Context(), id, authUserID(c), c.Query("status"))
+	if err != nil {
+		respondViewingError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"viewings": res})
+}
+
+func cancelViewingHandler(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "handler error", "code", "190", "error", err)
+		apperror.JSON(c, http.StatusBadRequest, "Invalid viewing ID")
+		return
+	}
+
+	res, err := cancelViewingUsecase(c.Request.Context(), id, authUserID(c))
+	if err != nil {
+		respondViewingError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"viewing": res})
+}
+
+// upcoming confirmed viewings of the user, booked by them or on their listings, as an iCalendar file
+func getViewingsCalendarHandler(c *gin.Context) {
+	res, err := getViewingsCalendarUsecase(c.Request.Context(), authUserID(c))
+	if err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+
+	c.Header("Content-Disposition", `attachment; filename="viewings.ics"`)
+	c.Data(http.StatusOK, "text/calendar; charset=utf-8", res)
+}
+
+// listing and slot id of the path, answers 400 when one is invalid
+func viewingSlotParams(c *gin.Context) (int, int, bool) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "handler error", "code", "191", "error", err)
+		apperror.JSON(c, http.StatusBadRequest, "Invalid listing ID")
+		return 0, 0, false
+	}
+
+	slotID, err := strconv.Atoi(c.Param("slot_id"))
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "handler error", "code", "192", "error", err)
+		apperror.JSON(c, http.StatusBadRequest, "Invalid slot ID")
+		return 0, 0, false
+	}
+
+	return id, slotID, true
+}
+
+func respondViewingError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, errListingNotOwned):
+		apperror.JSON(c, http.StatusForbidden, "Listing does not belong to user")
+	case errors.Is(err, errViewingNotOwned):
+		apperror.JSON(c, http.StatusForbidden, "Viewing does not belong to user")
+	default:
+		apperror.Respond(c, err)
+	}
+}
+
+// =========== USECASE LAYER, SERVES AS AN INTERMEDIARY BETWEEN THE PRESENTATION LAYER AND THE DATA LAYER ===========
+
+// open slots of the listing ending after from, default now
+func getViewingSlotsUsecase(ctx context.Context, listingID int, from string) ([]ViewingSlot, error) {
+	res, err := getViewingSlotsService(ctx, listingID, from)
+	if err != nil {
+		return nil, err
+	}
+
+	return res.Slots, nil
+}
+
+// open a slot on a listing of the user, the listing service refuses slots in the past or overlapping another
+func createViewingSlotUsecase(ctx context.Context, listingID, userID int, body ViewingSlotCreate) (*ViewingSlot, error) {
+	if err := checkListingOwner(ctx, listingID, userID); err != nil {
+		return nil, err
+	}
+
+	if body.Capacity == 0 {
+		body.Capacity = 1
+	}
+	form := url.Values{
+		"starts_at": {strconv.FormatInt(body.StartsAt, 10)},
+		"ends_at":   {strconv.FormatInt(body.EndsAt, 10)},
+		"capacity":  {strconv.Itoa(body.Capacity)},
+	}
+	res, err := createViewingSlotService(ctx, listingID, form)
+	if err != nil {
+		return nil, err
+	}
+
+	return &res.Slot, nil
+}
+
+// cancel a slot of a listing of the user and notify the users who booked it
+func cancelViewingSlotUsecase(ctx context.Context, listingID, slotID, userID int) (*ViewingSlotResponse, error) {
+	if err := checkListingOwner(ctx, listingID, userID); err != nil {
+		return nil, err
+	}
+
+	res, err := cancelViewingSlotService(ctx, listingID, slotID)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range res.CancelledViewings {
+		notify(ctx, newViewingNotification(notificationViewingCancelled, res.CancelledViewings[i].UserID, &res.CancelledViewings[i]))
+	}
+
+	return res, nil
+}
+
+// book a slot unless the owner blocked the user and notify the owner of the listing, the listing service answers
+// conflicts of capacity and time
+func bookViewingUsecase(ctx context.Context, listingID, slotID, userID int) (*Viewing, error) {
+	listing, err := findOfferListing(ctx, listingID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := checkNotBlocked(ctx, listing.UserID, userID); err != nil {
+		return nil, err
+	}
+
+	res, err := bookViewingService(ctx, listingID, slotID, url.Values{"user_id": {strconv.Itoa(userID)}})
+	if err != nil {
+		return nil, err
+	}
+
+	notify(ctx, newViewingNotification(notificationViewingBooked, res.Viewing.OwnerID, &res.Viewing))
+
+	return &res.Viewing, nil
+}
+
+// viewings booked by the user
+func getViewingsUsecase(ctx context.Context, userID int, status string) ([]Viewing, error) {
+	query, err := viewingsQuery(status)
+	if err != nil {
+		return nil, err
+	}
+	query.Set("user_id", strconv.Itoa(userID))
+
+	res, err := getViewingsService(ctx, query)
+	if err != nil {
+		return nil, apperror.Upstream("Failed to get viewings", err)
+	}
+
+	return res.Viewings, nil
+}
+
+// viewings booked on a listing of the user
+func getListingViewingsUsecase(ctx context.Context, listingID, userID int, status string) ([]Viewing, error) {
+	query, err := viewingsQuery(status)
+	if err != nil {
+		return nil, err
+	}
+	query.Set("listing_id", strconv.Itoa(listingID))
+
+	if err := checkListingOwner(ctx, listingID, userID); err != nil {
+		return nil, err
+	}
+
+	res, err := getViewingsService(ctx, query)
+	if err != nil {
+		return nil, apperror.Upstream("Failed to get viewings", err)
+	}
+
+	return res.Viewings, nil
+}
+
+// cancel a viewing as its visitor or the owner of the listing and notify the other one
+func cancelViewingUsecase(ctx context.Context, viewingID, userID int) (*Viewing, error) {
+	viewing, err := getViewingService(ctx, viewingID)
+	if err != nil {
+		if errors.Is(err, errViewingNotFound) {
+			return nil, err
+		}
+		return nil, apperror.Upstream("Failed to get viewing", err)
+	}
+
+	if userID != viewing.Viewing.UserID && userID != viewing.Viewing.OwnerID {
+		return nil, errViewingNotOwned
+	}
+
+	res, err := cancelViewingService(ctx, viewingID)
+	if err != nil {
+		return nil, err
+	}
+
+	recipient := res.Viewing.OwnerID
+	if userID == res.Viewing.OwnerID {
+		recipient = res.Viewing.UserID
+	}
+	notify(ctx, newViewingNotification(notificationViewingCancelled, recipient, &res.Viewing))
+
+	return &res.Viewing, nil
+}
+
+// upcoming confirmed viewings of the user as visitor and as owner as a calendar
+func getViewingsCalendarUsecase(ctx context.Context, userID int) ([]byte, error) {
+	events, err := viewingCalendarEvents(ctx, userID, "confirmed")
+	if err != nil {
+		return nil, err
+	}
+
+	return renderCalendar("Viewings", events), nil
+}
+
+// events of the viewings ending after now booked by the user or on their listings, of status when not empty
+func viewingCalendarEvents(ctx context.Context, userID int, status string) ([]calendarEvent, error) {
+	now := strconv.FormatInt(time.Now().UnixNano()/int64(time.Microsecond), 10)
+
+	var events []calendarEvent
+	for _, party := range []string{"user_id", "owner_id"} {
+		query := url.Values{party: {strconv.Itoa(userID)}, "from": {now}}
+		if status != "" {
+			query.Set("status", status)
+		}
+		res, err := getViewingsService(ctx, query)
+		if err != nil {
+			return nil, apperror.Upstream("Failed to get viewings", err)
+		}
+		for i := range res.Viewings {
+			events = append(events, viewingCalendarEvent(&res.Viewings[i], userID))
+		}
+	}
+
+	return events, nil
+}
+
+func viewingCalendarEvent(v *Viewing, userID int) calendarEvent {
+	summary := fmt.Sprintf("Viewing of listing %d", v.ListingID)
+	if v.OwnerID == userID {
+		summary = fmt.Sprintf("Viewing of listing %d by user %d", v.ListingID, v.UserID)
+	}
+
+	event := calendarEvent{
+		UID:       fmt.Sprintf("viewing-%d@public-api", v.ID),
+		StartsAt:  v.StartsAt,
+		EndsAt:    v.EndsAt,
+		UpdatedAt: v.UpdatedAt,
+		Summary:   summary,
+		Status:    calendarStatusConfirmed,
+	}
+	// the times of a viewing never change, its only change is the cancellation
+	if v.Status == "cancelled" {
+		event.Status = calendarStatusCancelled
+		event.Sequence = 1
+	}
+
+	return event
+}
+
+func viewingsQuery(status string) (url.Values, error) {
+	query := url.Values{}
+	switch status {
+	case "":
+	case "confirmed", "cancelled":
+		query.Set("status", status)
+	default:
+		return nil, errViewingStatus
+	}
+
+	return query, nil
+}
+
+// =========== WORKER, SEND VIEWING REMINDERS IN BACKGROUND ===========
+
+// VIEWING_REMINDER_INTERVAL wait between reminder rounds, 0 disable reminders
+// VIEWING_REMINDER_BEFORE how long before its start the visitor and the owner are reminded of a viewing
+var (
+	viewingReminderInterval = cfg.Duration("VIEWING_REMINDER_INTERVAL", time.Minute)
+	viewingReminderBefore   = cfg.Duration("VIEWING_REMINDER_BEFORE", 24*time.Hour)
+
+	viewingRemindersStop = make(chan struct{})
+	viewingRemindersDone = make(chan struct{})
+)
+
+// remind viewings starting within VIEWING_REMINDER_BEFORE every VIEWING_REMINDER_INTERVAL, the listing service
+// hands each viewing out once so several instances never remind twice
+func startViewingReminders() {
+	if viewingReminderInterval <= 0 {
+		close(viewingRemindersDone)
+		return
+	}
+
+	go func() {
+		defer close(viewingRemindersDone)
+
+		ticker := time.NewTicker(viewingReminderInterval)
+		defer ticker.Stop()
+		for {
+			sendViewingReminders()
+
+			select {
+			case <-viewingRemindersStop:
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// wait for the running reminder round
+func stopViewingReminders(ctx context.Context) {
+	close(viewingRemindersStop)
+
+	select {
+	case <-viewingRemindersDone:
+	case <-ctx.Done():
+		slog.ErrorContext(ctx, "worker error", "code", "193", "error", "shutdown timeout, reminder round still running")
+	}
+}
+
+func sendViewingReminders() {
+	ctx := context.Background()
+	before := time.Now().Add(viewingReminderBefore).UnixNano() / int64(time.Microsecond)
+
+	res, err := claimViewingRemindersService(ctx, before)
+	if err != nil {
+		return
+	}
+
+	for i := range res.Viewings {
+		notify(ctx, newViewingNotification(notificationViewingReminder, res.Viewings[i].UserID, &res.Viewings[i]))
+		notify(ctx, newViewingNotification(notificationViewingReminder, res.Viewings[i].OwnerID, &res.Viewings[i]))
+	}
+}
+
+// =========== REPOSITORY LAYER, ABSTRACTION OVER THE DATA PERSISTENCE (databases, file systems, or external APIs) ===========
+
+var (
+	// listing service api path
+	apiPathViewingSlots     = listingServiceURL + "/listings/%d/viewing-slots"
+	apiPathViewingSlot      = listingServiceURL + "/listings/%d/viewing-slots/%d"
+	apiPathViewingBookings  = listingServiceURL + "/listings/%d/viewing-slots/%d/bookings"
+	apiPathViewings         = listingServiceURL + "/viewings"
+	apiPathViewing          = listingServiceURL + "/viewings/%d"
+	apiPathViewingReminders = listingServiceURL + "/viewings/reminders"
+)
+
+// slots of the listing ending after from, now when empty
+func getViewingSlotsService(ctx context.Context, listingID int, from string) (*ViewingSlotsResponse, error) {
+	resp, err := httpGet(ctx, fmt.Sprintf(apiPathViewingSlots, listingID)+"?from="+url.QueryEscape(from))
+	if err != nil {
+		slog.ErrorContext(ctx, "service error", "code", "194", "error", err)
+		return nil, apperror.Upstream("Failed to get viewing slots", err)
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		return nil, errListingNotFound
+	case http.StatusBadRequest:
+		return nil, apperror.Validation(upstreamErrorMessage(resp.Body, "Invalid from"))
+	default:
+		slog.ErrorContext(ctx, "service error", "code", "195", "error", "error fetching viewing slots from listing service")
+		return nil, apperror.Upstream("Failed to get viewing slots", errors.New("error fetching viewing slots from listing service"))
+	}
+
+	var slots ViewingSlotsResponse
+	if err := decodeJSON(resp.Body, &slots); err != nil {
+		slog.ErrorContext(ctx, "service error", "code", "196", "error", err)
+		return nil, apperror.Upstream("Failed to get viewing slots", err)
+	}
+
+	return &slots, nil
+}
+
+func createViewingSlotService(ctx context.Context, listingID int, form url.Values) (*ViewingSlotResponse, error) {
+	resp, err := httpPostForm(ctx, fmt.Sprintf(apiPathViewingSlots, listingID), form)
+	if err != nil {
+		slog.ErrorContext(ctx, "service error", "code", "197", "error", err)
+		return nil, apperror.Upstream("Failed to create viewing slot", err)
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusCreated:
+	case http.StatusNotFound:
+		return nil, errListingNotFound
+	case http.StatusBadRequest:
+		return nil, apperror.Validation(upstreamErrorMessage(resp.Body, "Invalid viewing slot"))
+	case http.StatusConflict:
+		return nil, apperror.Conflict(upstreamErrorMessage(resp.Body, "Viewing slot overlaps another slot"))
+	default:
+		slog.ErrorContext(ctx, "service error", "code", "198", "error", "error creating viewing slot from listing service")
+		return nil, apperror.Upstream("Failed to create viewing slot", errors.New("error creating viewing slot from listing service"))
+	}
+
+	var slot ViewingSlotResponse
+	if err := decodeJSON(resp.Body, &slot); err != nil {
+		slog.ErrorContext(ctx, "service error", "code", "199", "error", err)
+		return nil, apperror.Upstream("Failed to create viewing slot", err)
+	}
+
+	return &slot, nil
+}
+
+func cancelViewingSlotService(ctx context.Context, listingID, slotID int) (*ViewingSlotResponse, error) {
+	resp, err := httpDelete(ctx, fmt.Sprintf(apiPathViewingSlot, listingID, slotID))
+	if err != nil {
+		slog.ErrorContext(ctx, "service error", "code", "200", "error", err)
+		return nil, apperror.Upstream("Failed to cancel viewing slot", err)
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		return nil, errViewingSlotNotFound
+	case http.StatusConflict:
+		return nil, apperror.Conflict(upstreamErrorMessage(resp.Body, "Viewing slot is already cancelled"))
+	default:
+		slog.ErrorContext(ctx, "service error", "code", "201", "error", "error cancelling viewing slot from listing service")
+		return nil, apperror.Upstream("Failed to cancel viewing slot", errors.New("error cancelling viewing slot from listing service"))
+	}
+
+	var slot ViewingSlotResponse
+	if err := decodeJSON(resp.Body, &slot); err != nil {
+		slog.ErrorContext(ctx, "service error", "code", "202", "error", err)
+		return nil, apperror.Upstream("Failed to cancel viewing slot", err)
+	}
+
+	return &slot, nil
+}
+
+func bookViewingService(ctx context.Context, listingID, slotID int, form url.Values) (*ViewingResponse, error) {
+	resp, err := httpPostForm(ctx, fmt.Sprintf(apiPathViewingBookings, listingID, slotID), form)
+	if err != nil {
+		slog.ErrorContext(ctx, "service error", "code", "203", "error", err)
+		return nil, apperror.Upstream("Failed to book viewing", err)
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusCreated:
+	case http.StatusNotFound:
+		return nil, errViewingSlotNotFound
+	case http.StatusBadRequest:
+		return nil, apperror.Validation(upstreamErrorMessage(resp.Body, "Invalid booking"))
+	case http.StatusConflict:
+		return nil, apperror.Conflict(upstreamErrorMessage(resp.Body, "Viewing slot can not be booked"))
+	default:
+		slog.ErrorContext(ctx, "service error", "code", "204", "error", "error booking viewing from listing service")
+		return nil, apperror.Upstream("Failed to book viewing", errors.New("error booking viewing from listing service"))
+	}
+
+	var viewing ViewingResponse
+	if err := decodeJSON(resp.Body, &viewing); err != nil {
+		slog.ErrorContext(ctx, "service error", "code", "205", "error", err)
+		return nil, apperror.Upstream("Failed to book viewing", err)
+	}
+
+	return &viewing, nil
+}
+
+// viewings matching the filters of query, user_id, owner_id, listing_id, status and from
+func getViewingsService(ctx context.Context, query url.Values) (*ViewingsResponse, error) {
+	resp, err := httpGet(ctx, apiPathViewings+"?"+query.Encode())
+	if err != nil {
+		slog.ErrorContext(ctx, "service error", "code", "206", "error", err)
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		slog.ErrorContext(ctx, "service error", "code", "207", "error", "error fetching viewings from listing service")
+		return nil, errors.New("error fetching viewings from listing service")
+	}
+
+	var viewings ViewingsResponse
+	if err := decodeJSON(resp.Body, &viewings); err != nil {
+		slog.ErrorContext(ctx, "service error", "code", "208", "error", err)
+		return nil, err
+	}
+
+	return &viewings, nil
+}
+
+func getViewingService(ctx context.Context, viewingID int) (*ViewingResponse, error) {
+	resp, err := httpGet(ctx, fmt.Sprintf(apiPathViewing, viewingID))
+	if err != nil {
+		slog.ErrorContext(ctx, "service error", "code", "209", "error", err)
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		return nil, errViewingNotFound
+	default:
+		slog.ErrorContext(ctx, "service error", "code", "210", "error", "error fetching viewing from listing service")
+		return nil, errors.New("error fetching viewing from listing service")
+	}
+
+	var viewing ViewingResponse
+	if err := decodeJSON(resp.Body, &viewing); err != nil {
+		slog.ErrorContext(ctx, "service error", "code", "211", "error", err)
+		return nil, err
+	}
+
+	return &viewing, nil
+}
+
+func cancelViewingService(ctx context.Context, viewingID int) (*ViewingResponse, error) {
+	resp, err := httpDelete(ctx, fmt.Sprintf(apiPathViewing, viewingID))
+	if err != nil {
+		slog.ErrorContext(ctx, "service error", "code", "212", "error", err)
+		return nil, apperror.Upstream("Failed to cancel viewing", err)
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		return nil, errViewingNotFound
+	case http.StatusConflict:
+		return nil, apperror.Conflict(upstreamErrorMessage(resp.Body, "Viewing is already cancelled"))
+	default:
+		slog.ErrorContext(ctx, "service error", "code", "213", "error", "error cancelling viewing from listing service")
+		return nil, apperror.Upstream("Failed to cancel viewing", errors.New("error cancelling viewing from listing service"))
+	}
+
+	var viewing ViewingResponse
+	if err := decodeJSON(resp.Body, &viewing); err != nil {
+		slog.ErrorContext(ctx, "service error", "code", "214", "error", err)
+		return nil, apperror.Upstream("Failed to cancel viewing", err)
+	}
+
+	return &viewing, nil
+}
+
+// confirmed viewings starting before before that were not reminded yet, marked reminded by the listing service
+func claimViewingRemindersService(ctx context.Context, before int64) (*ViewingsResponse, error) {
+	resp, err := httpPostForm(ctx, apiPathViewingReminders, url.Values{"before": {strconv.FormatInt(before, 10)}})
+	if err != nil {
+		slog.ErrorContext(ctx, "service error", "code", "215", "error", err)
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		slog.ErrorContext(ctx, "service error", "code", "216", "error", "error claiming viewing reminders from listing service")
+		return nil, errors.New("error claiming viewing reminders from listing service")
+	}
+
+	var viewings ViewingsResponse
+	if err := decodeJSON(resp.Body, &viewings); err != nil {
+		slog.ErrorContext(ctx, "service error", "code", "217", "error", err)
+		return nil, err
+	}
+
+	return &viewings, nil
+}
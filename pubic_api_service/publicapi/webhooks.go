@@ -0,0 +1,350 @@
+package publicapi
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+
+	"apperror"
+	"events"
+
+	"github.com/gin-gonic/gin"
+)
+
+// callback url of a user, the user service posts it the events of its types signed with its secret
+type Webhook struct {
+	ID     int      `json:"id"`
+	UserID int      `json:"user_id"`
+	URL    string   `json:"url"`
+	Events []string `json:"events"`
+	// only returned when the webhook is created
+	Secret    string `json:"secret,omitempty"`
+	CreatedAt int64  `json:"created_at"`
+}
+
+type WebhookCreate struct {
+	URL    string   `json:"url" binding:"required,max=2000"`
+	Events []string `json:"events" binding:"required,min=1"`
+}
+
+// delivery of an event to a webhook, pending until the callback answered 2xx, failed once out of attempts
+type WebhookDelivery struct {
+	ID            int64  `json:"id"`
+	WebhookID     int    `json:"webhook_id"`
+	EventID       string `json:"event_id"`
+	EventType     string `json:"event_type"`
+	Status        string `json:"status"`
+	Attempts      int    `json:"attempts"`
+	NextAttemptAt *int64 `json:"next_attempt_at"`
+	LastError     string `json:"last_error,omitempty"`
+	CreatedAt     int64  `json:"created_at"`
+	DeliveredAt   *int64 `json:"delivered_at"`
+}
+
+type WebhookResponse struct {
+	Result  bool `json:"result"`
+	Webhook Webhook
+}
+
+type WebhooksResponse struct {
+	Result   bool `json:"result"`
+	Webhooks []Webhook
+}
+
+type WebhookDeliveriesResponse struct {
+	Result     bool `json:"result"`
+	Deliveries []WebhookDelivery
+}
+
+var (
+	ErrWebhookInvalid  = apperror.Validation("url must be an absolute http or https url and events one of: " + strings.Join(events.Types, ", "))
+	ErrWebhookNotFound = apperror.NotFound("Webhook not found")
+	ErrWebhookLimit    = apperror.Conflict("webhook limit reached, delete a webhook first")
+
+	errWebhookDeliveriesQuery = apperror.Validation("status must be one of pending, delivered, failed and limit between 1 and 200")
+)
+
+// =========== INTERFACE HANDLER, HANDLING REQUEST RESPONSE API DEPEND INTERFACE ===========
+
+// webhooks of the authenticated user, without their secrets
+func getWebhooksHandler(c *gin.Context) {
+	res, err := getWebhooksUsecase(c.Request.Context(), authUserID(c))
+	if err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"webhooks": res})
+}
+
+// register a webhook, the response carries its secret once
+func createWebhookHandler(c *gin.Context) {
+	var body WebhookCreate
+	if err := c.ShouldBindJSON(&body); err != nil {
+		slog.ErrorContext(c.Request.Context(), "handler error", "code", "276", "error", err)
+		apperror.RespondBinding(c, err)
+		return
+	}
+
+	res, err := createWebhookUsecase(c.Request.Context(), authUserID(c), body)
+	if err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"webhook": res})
+}
+
+// delete a webhook of the authenticated user, its pending deliveries are dropped
+func deleteWebhookHandler(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "handler error", "code", "277", "error", err)
+		apperror.JSON(c, http.StatusBadRequest, "Invalid webhook ID")
+		return
+	}
+
+	if err := deleteWebhookUsecase(c.Request.Context(), authUserID(c), id); err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// latest deliveries of a webhook of the authenticated user, ?status= to keep one status, ?limit= 50 by default
+func getWebhookDeliveriesHandler(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "handler error", "code", "278", "error", err)
+		apperror.JSON(c, http.StatusBadRequest, "Invalid webhook ID")
+		return
+	}
+
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "50"))
+	if err != nil {
+		apperror.Respond(c, errWebhookDeliveriesQuery)
+		return
+	}
+
+	res, err := getWebhookDeliveriesUsecase(c.Request.Context(), authUserID(c), id, c.Query("status"), limit)
+	if err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"deliveries": res})
+}
+
+// =========== USECASE LAYER, SERVES AS AN INTERMEDIARY BETWEEN THE PRESENTATION LAYER AND THE DATA LAYER ===========
+
+func getWebhooksUsecase(ctx context.Context, userID int) ([]Webhook, error) {
+	res, err := userClient.FindUserWebhooks(ctx, userID)
+	if err != nil {
+		return nil, apperror.Upstream("Failed to get webhooks", err)
+	}
+
+	return res.Webhooks, nil
+}
+
+func createWebhookUsecase(ctx context.Context, userID int, webhook WebhookCreate) (*Webhook, error) {
+	target, err := url.Parse(webhook.URL)
+	if err != nil || (target.Scheme != "http" && target.Scheme != "https") || target.Host == "" {
+		return nil, ErrWebhookInvalid
+	}
+	for _, eventType := range webhook.Events {
+		if !slices.Contains(events.Types, eventType) {
+			return nil, ErrWebhookInvalid
+		}
+	}
+
+	webhookJSON, err := json.Marshal(webhook)
+	if err != nil {
+		slog.ErrorContext(ctx, "usecase error", "code", "279", "error", err)
+		return nil, err
+	}
+
+	res, err := userClient.CreateUserWebhook(ctx, userID, webhookJSON)
+	if err != nil {
+		if errors.Is(err, ErrUserNotFound) || errors.Is(err, ErrWebhookInvalid) || errors.Is(err, ErrWebhookLimit) {
+			return nil, err
+		}
+		return nil, apperror.Upstream("Failed to create webhook", err)
+	}
+
+	return &res.Webhook, nil
+}
+
+func deleteWebhookUsecase(ctx context.Context, userID, webhookID int) error {
+	if err := userClient.DeleteUserWebhook(ctx, userID, webhookID); err != nil {
+		if errors.Is(err, ErrWebhookNotFound) {
+			return err
+		}
+		return apperror.Upstream("Failed to delete webhook", err)
+	}
+
+	return nil
+}
+
+func getWebhookDeliveriesUsecase(ctx context.Context, userID, webhookID int, status string, limit int) ([]WebhookDelivery, error) {
+	if (status != "" && status != "pending" && status != "delivered" && status != "failed") || limit < 1 || limit > 200 {
+		return nil, errWebhookDeliveriesQuery
+	}
+
+	res, err := userClient.FindWebhookDeliveries(ctx, userID, webhookID, status, limit)
+	if err != nil {
+		if errors.Is(err, ErrWebhookNotFound) {
+			return nil, err
+		}
+		return nil, apperror.Upstream("Failed to get webhook deliveries", err)
+	}
+
+	return res.Deliveries, nil
+}
+
+// =========== REPOSITORY LAYER, ABSTRACTION OVER THE DATA PERSISTENCE (databases, file systems, or external APIs) ===========
+
+// events.Publisher handing the listing events to the user service, which queues the deliveries of their webhooks
+type webhookEventPublisher struct{}
+
+func (webhookEventPublisher) Publish(ctx context.Context, event events.Event) error {
+	eventJSON, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	return userClient.PublishWebhookEvent(ctx, eventJSON)
+}
+
+func (webhookEventPublisher) Close() error { return nil }
+
+var (
+	// user service api path
+	apiPathUserWebhooks          = userServiceURL + "/users/%d/webhooks"
+	apiPathUserWebhook           = userServiceURL + "/users/%d/webhooks/%d"
+	apiPathUserWebhookDeliveries = userServiceURL + "/users/%d/webhooks/%d/deliveries"
+	apiPathWebhookEvents         = userServiceURL + "/webhook-events"
+)
+
+func (httpUserClient) FindUserWebhooks(ctx context.Context, userID int) (*WebhooksResponse, error) {
+	resp, err := httpGet(ctx, fmt.Sprintf(apiPathUserWebhooks, userID))
+	if err != nil {
+		slog.ErrorContext(ctx, "service error", "code", "280", "error", err)
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		slog.ErrorContext(ctx, "service error", "code", "281", "error", "error fetching webhooks from user service")
+		return nil, errors.New("error fetching webhooks from user service")
+	}
+
+	var webhooks WebhooksResponse
+	if err := decodeJSON(resp.Body, &webhooks); err != nil {
+		slog.ErrorContext(ctx, "service error", "code", "282", "error", err)
+		return nil, err
+	}
+
+	return &webhooks, nil
+}
+
+func (httpUserClient) CreateUserWebhook(ctx context.Context, userID int, webhookByte []byte) (*WebhookResponse, error) {
+	resp, err := httpPost(ctx, fmt.Sprintf(apiPathUserWebhooks, userID), "application/json", bytes.NewBuffer(webhookByte))
+	if err != nil {
+		slog.ErrorContext(ctx, "service error", "code", "283", "error", err)
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusCreated:
+	case http.StatusNotFound:
+		return nil, ErrUserNotFound
+	case http.StatusBadRequest:
+		return nil, ErrWebhookInvalid
+	case http.StatusConflict:
+		return nil, ErrWebhookLimit
+	default:
+		slog.ErrorContext(ctx, "service error", "code", "284", "error", "error creating webhook from user service")
+		return nil, errors.New("error creating webhook from user service")
+	}
+
+	var webhook WebhookResponse
+	if err := decodeJSON(resp.Body, &webhook); err != nil {
+		slog.ErrorContext(ctx, "service error", "code", "285", "error", err)
+		return nil, err
+	}
+
+	return &webhook, nil
+}
+
+func (httpUserClient) DeleteUserWebhook(ctx context.Context, userID, webhookID int) error {
+	resp, err := httpDelete(ctx, fmt.Sprintf(apiPathUserWebhook, userID, webhookID))
+	if err != nil {
+		slog.ErrorContext(ctx, "service error", "code", "286", "error", err)
+		return err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return nil
+	case http.StatusNotFound:
+		return ErrWebhookNotFound
+	default:
+		slog.ErrorContext(ctx, "service error", "code", "287", "error", "error deleting webhook from user service")
+		return errors.New("error deleting webhook from user service")
+	}
+}
+
+func (httpUserClient) FindWebhookDeliveries(ctx context.Context, userID, webhookID int, status string, limit int) (*WebhookDeliveriesResponse, error) {
+	query := url.Values{"limit": {strconv.Itoa(limit)}}
+	if status != "" {
+		query.Set("status", status)
+	}
+
+	resp, err := httpGet(ctx, fmt.Sprintf(apiPathUserWebhookDeliveries, userID, webhookID)+"?"+query.Encode())
+	if err != nil {
+		slog.ErrorContext(ctx, "service error", "code", "288", "error", err)
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		return nil, ErrWebhookNotFound
+	default:
+		slog.ErrorContext(ctx, "service error", "code", "289", "error", "error fetching webhook deliveries from user service")
+		return nil, errors.New("error fetching webhook deliveries from user service")
+	}
+
+	var deliveries WebhookDeliveriesResponse
+	if err := decodeJSON(resp.Body, &deliveries); err != nil {
+		slog.ErrorContext(ctx, "service error", "code", "290", "error", err)
+		return nil, err
+	}
+
+	return &deliveries, nil
+}
+
+func (httpUserClient) PublishWebhookEvent(ctx context.Context, eventByte []byte) error {
+	resp, err := httpPost(ctx, apiPathWebhookEvents, "application/json", bytes.NewBuffer(eventByte))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("user service answered %d to the webhook event", resp.StatusCode)
+	}
+	return nil
+}
@@ -0,0 +1,74 @@
+package publicapi
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"events"
+)
+
+func TestWebhooks(t *testing.T) {
+	var published []events.Event
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == http.MethodPost && r.URL.Path == "/webhook-events":
+			var event events.Event
+			if err := json.NewDecoder(r.Body).Decode(&event); err != nil {
+				t.Error(err)
+			}
+			published = append(published, event)
+			w.Write([]byte(`{"result": true, "deliveries": 1}`))
+		case r.Method == http.MethodPost && r.URL.Path == "/users/1/webhooks":
+			w.WriteHeader(http.StatusConflict)
+			w.Write([]byte(`{"result": false}`))
+		default:
+			t.Errorf("unexpected request %s %s", r.Method, r.URL.Path)
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	previousEvents, previousWebhooks := apiPathWebhookEvents, apiPathUserWebhooks
+	apiPathWebhookEvents, apiPathUserWebhooks = server.URL+"/webhook-events", server.URL+"/users/%d/webhooks"
+	previousClient := userClient
+	userClient = httpUserClient{}
+	defer func() {
+		apiPathWebhookEvents, apiPathUserWebhooks = previousEvents, previousWebhooks
+		userClient = previousClient
+	}()
+
+	ctx := context.Background()
+
+	// the listing relay hands every event to the user service
+	event := events.Event{ID: "e1", Type: events.ListingCreated, OccurredAt: 1, Data: json.RawMessage(`{"id":7}`), Key: "listing:7"}
+	if err := (webhookEventPublisher{}).Publish(ctx, event); err != nil {
+		t.Fatal(err)
+	}
+	if len(published) != 1 || published[0].ID != "e1" || published[0].Type != events.ListingCreated || string(published[0].Data) != `{"id":7}` {
+		t.Fatalf("published %+v, want event e1", published)
+	}
+
+	// urls and events are checked before calling the user service
+	for _, create := range []WebhookCreate{
+		{URL: "ftp://example.com/hook", Events: []string{events.ListingCreated}},
+		{URL: "/hook", Events: []string{events.ListingCreated}},
+		{URL: "https://example.com/hook", Events: []string{"listing.sold"}},
+	} {
+		if _, err := createWebhookUsecase(ctx, 1, create); !errors.Is(err, ErrWebhookInvalid) {
+			t.Errorf("create %+v: %v, want ErrWebhookInvalid", create, err)
+		}
+	}
+
+	_, err := createWebhookUsecase(ctx, 1, WebhookCreate{URL: "https://example.com/hook", Events: []string{events.UserCreated}})
+	if !errors.Is(err, ErrWebhookLimit) {
+		t.Errorf("create over the limit: %v, want ErrWebhookLimit", err)
+	}
+
+	if _, err := getWebhookDeliveriesUsecase(ctx, 1, 2, "sent", 50); !errors.Is(err, errWebhookDeliveriesQuery) {
+		t.Errorf("deliveries of status sent: %v, want errWebhookDeliveriesQuery", err)
+	}
+}
@@ -0,0 +1,378 @@
+package publicapi
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"apperror"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	writeKindListing = "listing"
+	writeKindUser    = "user"
+
+	writeQueued = "queued"
+	writeDone   = "done"
+	writeFailed = "failed"
+)
+
+// create request accepted while its backend was down, replayed once the backend is back
+type QueuedWrite struct {
+	ID        string          `json:"id"`
+	Kind      string          `json:"kind"`
+	Status    string          `json:"status"`
+	UserID    int             `json:"user_id"`
+	Locale    string          `json:"locale,omitempty"`
+	Payload   json.RawMessage `json:"payload"`
+	Attempts  int             `json:"attempts"`
+	Result    json.RawMessage `json:"result,omitempty"`
+	Error     string          `json:"error,omitempty"`
+	CreatedAt int64           `json:"created_at"`
+	UpdatedAt int64           `json:"updated_at"`
+}
+
+var (
+	errBackendUnavailable = errors.New("backend unavailable")
+	errWriteNotFound      = apperror.NotFound("Write not found")
+)
+
+// WRITE_BEHIND accept creates with 202 while the listing or user service is unreachable
+// WRITE_QUEUE_DIR directory keeping one json file per queued write
+// WRITE_QUEUE_RETRY_INTERVAL wait between replay rounds
+// WRITE_QUEUE_RETENTION how long done and failed writes stay readable on the status endpoint
+var (
+	writeBehind         = cfg.Bool("WRITE_BEHIND", false)
+	writeQueueDir       = cfg.String("WRITE_QUEUE_DIR", "write_queue")
+	writeRetryInterval  = cfg.Duration("WRITE_QUEUE_RETRY_INTERVAL", 10*time.Second)
+	writeQueueRetention = cfg.Duration("WRITE_QUEUE_RETENTION", 24*time.Hour)
+
+	// serialize file access between handlers and the replayer
+	writeQueueMu sync.Mutex
+
+	writeReplayerStop = make(chan struct{})
+	writeReplayerDone = make(chan struct{})
+)
+
+// only refused connections and an open breaker are safe to queue, a timed out create may have been stored already
+func isBackendUnavailable(err error) bool {
+	if errors.Is(err, errCircuitOpen) {
+		return true
+	}
+
+	var opErr *net.OpError
+	return errors.As(err, &opErr) && opErr.Op == "dial"
+}
+
+// =========== INTERFACE HANDLER, HANDLING REQUEST RESPONSE API DEPEND INTERFACE ===========
+
+// respond 202 with the tracking id of a create queued because its backend is down
+func queueWriteHandler(c *gin.Context, kind string, payload interface{}, locale string) {
+	write, err := queueWriteUsecase(kind, authUserID(c), payload, locale)
+	if err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+
+	c.Header("Location", "/public-api/"+apiVersionOf(c)+"/writes/"+write.ID)
+	c.JSON(http.StatusAccepted, gin.H{"write": writeView(write)})
+}
+
+// handler request response status of a queued write of the authenticated user
+func getQueuedWriteHandler(c *gin.Context) {
+	write, err := getQueuedWriteUsecase(c.Param("id"), authUserID(c))
+	if err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"write": writeView(write)})
+}
+
+// queued write without the stored request
+func writeView(write *QueuedWrite) gin.H {
+	return gin.H{
+		"id":         write.ID,
+		"kind":       write.Kind,
+		"status":     write.Status,
+		"attempts":   write.Attempts,
+		"result":     write.Result,
+		"error":      write.Error,
+		"created_at": write.CreatedAt,
+		"updated_at": write.UpdatedAt,
+	}
+}
+
+// =========== USECASE LAYER, SERVES AS AN INTERMEDIARY BETWEEN THE PRESENTATION LAYER AND THE DATA LAYER ===========
+
+func queueWriteUsecase(kind string, userID int, payload interface{}, locale string) (*QueuedWrite, error) {
+	payloadJSON, err := json.Marshal(payload)
+	if err != nil {
+		slog.Error("usecase error", "code", "110", "error", err)
+		return nil, err
+	}
+
+	id, err := newTrackingID()
+	if err != nil {
+		slog.Error("usecase error", "code", "111", "error", err)
+		return nil, err
+	}
+
+	now := time.Now().UnixNano() / int64(time.Microsecond)
+	write := &QueuedWrite{ID: id, Kind: kind, Status: writeQueued, UserID: userID, Locale: locale, Payload: payloadJSON, CreatedAt: now, UpdatedAt: now}
+	if err := saveQueuedWrite(write); err != nil {
+		return nil, errors.New("storage error: queue write error")
+	}
+
+	slog.Info("create queued, backend unavailable", "kind", kind, "write_id", id)
+	return write, nil
+}
+
+// writes of other users are reported as not found
+func getQueuedWriteUsecase(id string, userID int) (*QueuedWrite, error) {
+	write, err := findQueuedWrite(id)
+	if err != nil {
+		return nil, err
+	}
+
+	if write.UserID != userID {
+		return nil, errWriteNotFound
+	}
+
+	return write, nil
+}
+
+// send one queued write again, errBackendUnavailable keeps it queued for the next round
+func replayWriteUsecase(ctx context.Context, write *QueuedWrite) error {
+	var result interface{}
+	var err error
+	switch write.Kind {
+	case writeKindListing:
+		var listing Listing
+		if err = json.Unmarshal(write.Payload, &listing); err == nil {
+			result, err = createListingUsecase(ctx, listing)
+		}
+	case writeKindUser:
+		var user UserCreate
+		if err = json.Unmarshal(write.Payload, &user); err == nil {
+			result, err = createUserUsecase(ctx, user, write.Locale)
+		}
+	default:
+		err = errors.New("unknown write kind " + write.Kind)
+	}
+
+	write.Attempts++
+	write.UpdatedAt = time.Now().UnixNano() / int64(time.Microsecond)
+	switch {
+	case errors.Is(err, errBackendUnavailable):
+		write.Error = err.Error()
+	case err != nil:
+		write.Status = writeFailed
+		write.Error = err.Error()
+		slog.Error("usecase error", "code", "112", "error", err, "write_id", write.ID)
+	default:
+		write.Status = writeDone
+		write.Error = ""
+		write.Result, _ = json.Marshal(result)
+		slog.Info("queued create replayed", "kind", write.Kind, "write_id", write.ID)
+	}
+
+	if saveErr := saveQueuedWrite(write); saveErr != nil {
+		return saveErr
+	}
+
+	return err
+}
+
+// =========== REPOSITORY LAYER, ABSTRACTION OVER THE DATA PERSISTENCE (databases, file systems, or external APIs) ===========
+
+func newTrackingID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(b), nil
+}
+
+// write to a temp file then rename so a crash never leaves a half written entry
+func saveQueuedWrite(write *QueuedWrite) error {
+	writeQueueMu.Lock()
+	defer writeQueueMu.Unlock()
+
+	data, err := json.Marshal(write)
+	if err != nil {
+		slog.Error("service error", "code", "113", "error", err)
+		return err
+	}
+
+	if err := os.MkdirAll(writeQueueDir, 0o755); err != nil {
+		slog.Error("service error", "code", "114", "error", err)
+		return err
+	}
+
+	path := filepath.Join(writeQueueDir, write.ID+".json")
+	if err := os.WriteFile(path+".tmp", data, 0o600); err != nil {
+		slog.Error("service error", "code", "115", "error", err)
+		return err
+	}
+
+	if err := os.Rename(path+".tmp", path); err != nil {
+		slog.Error("service error", "code", "116", "error", err)
+		return err
+	}
+
+	return nil
+}
+
+func findQueuedWrite(id string) (*QueuedWrite, error) {
+	// ids are hex, anything else can not name a queue file
+	if _, err := hex.DecodeString(id); err != nil || id == "" {
+		return nil, errWriteNotFound
+	}
+
+	writeQueueMu.Lock()
+	defer writeQueueMu.Unlock()
+
+	data, err := os.ReadFile(filepath.Join(writeQueueDir, id+".json"))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, errWriteNotFound
+		}
+		slog.Error("service error", "code", "117", "error", err)
+		return nil, err
+	}
+
+	var write QueuedWrite
+	if err := json.Unmarshal(data, &write); err != nil {
+		slog.Error("service error", "code", "118", "error", err)
+		return nil, err
+	}
+
+	return &write, nil
+}
+
+// every stored write, oldest first
+func findQueuedWrites() ([]*QueuedWrite, error) {
+	entries, err := os.ReadDir(writeQueueDir)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		slog.Error("service error", "code", "119", "error", err)
+		return nil, err
+	}
+
+	writes := []*QueuedWrite{}
+	for _, entry := range entries {
+		id, ok := strings.CutSuffix(entry.Name(), ".json")
+		if !ok {
+			continue
+		}
+
+		write, err := findQueuedWrite(id)
+		if err != nil {
+			continue
+		}
+		writes = append(writes, write)
+	}
+	sort.Slice(writes, func(i, j int) bool { return writes[i].CreatedAt < writes[j].CreatedAt })
+
+	return writes, nil
+}
+
+func deleteQueuedWrite(id string) error {
+	writeQueueMu.Lock()
+	defer writeQueueMu.Unlock()
+
+	if err := os.Remove(filepath.Join(writeQueueDir, id+".json")); err != nil && !errors.Is(err, os.ErrNotExist) {
+		slog.Error("service error", "code", "120", "error", err)
+		return err
+	}
+
+	return nil
+}
+
+// =========== WORKER, REPLAY QUEUED WRITES IN BACKGROUND ===========
+
+// replay queued writes every WRITE_QUEUE_RETRY_INTERVAL, writes left by a previous run are picked up too
+func startWriteReplayer() {
+	if !writeBehind {
+		close(writeReplayerDone)
+		return
+	}
+
+	go func() {
+		defer close(writeReplayerDone)
+
+		ticker := time.NewTicker(writeRetryInterval)
+		defer ticker.Stop()
+		for {
+			replayWrites()
+
+			select {
+			case <-writeReplayerStop:
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// wait for the running replay round, queued writes stay on disk for the next start
+func stopWriteReplayer(ctx context.Context) {
+	close(writeReplayerStop)
+
+	select {
+	case <-writeReplayerDone:
+	case <-ctx.Done():
+		slog.ErrorContext(ctx, "worker error", "code", "121", "error", "shutdown timeout, replay round still running")
+	}
+}
+
+func replayWrites() {
+	writes, err := findQueuedWrites()
+	if err != nil {
+		return
+	}
+
+	now := time.Now()
+	// kinds whose backend was found down in this round, their remaining writes wait for the next one
+	down := map[string]bool{}
+	for _, write := range writes {
+		if write.Status != writeQueued {
+			updated := time.UnixMicro(write.UpdatedAt)
+			if now.Sub(updated) > writeQueueRetention {
+				deleteQueuedWrite(write.ID)
+			}
+			continue
+		}
+
+		if down[write.Kind] {
+			continue
+		}
+
+		select {
+		case <-writeReplayerStop:
+			return
+		default:
+		}
+
+		if err := replayWriteUsecase(context.Background(), write); errors.Is(err, errBackendUnavailable) {
+			down[write.Kind] = true
+		}
+	}
+}
@@ -0,0 +1,524 @@
+package userservice
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"apperror"
+
+	"github.com/gin-gonic/gin"
+)
+
+// statuses of an admin action, pending until another admin decides or it expires, approved until its run is recorded
+const (
+	AdminActionPending  = "pending"
+	AdminActionApproved = "approved"
+	AdminActionRejected = "rejected"
+	AdminActionExpired  = "expired"
+	AdminActionExecuted = "executed"
+	AdminActionFailed   = "failed"
+)
+
+var adminActionStatuses = []string{AdminActionPending, AdminActionApproved, AdminActionRejected, AdminActionExpired, AdminActionExecuted, AdminActionFailed}
+
+// high risk operation of an admin written before it runs, run by the public API once a second admin approved it.
+// RequestedBy 0 is an operator holding the internal api key
+type AdminAction struct {
+	ID             int64           `json:"id"`
+	Action         string          `json:"action"`
+	Entity         string          `json:"entity"`
+	EntityID       string          `json:"entity_id"`
+	Params         json.RawMessage `json:"params,omitempty"`
+	Reason         string          `json:"reason,omitempty"`
+	Status         string          `json:"status"`
+	RequestedBy    int             `json:"requested_by"`
+	RequestID      string          `json:"request_id,omitempty"`
+	DecidedBy      int             `json:"decided_by,omitempty"`
+	DecisionReason string          `json:"decision_reason,omitempty"`
+	DecidedAt      int64           `json:"decided_at,omitempty"`
+	Result         json.RawMessage `json:"result,omitempty"`
+	Error          string          `json:"error,omitempty"`
+	ExpiresAt      int64           `json:"expires_at"`
+	CreatedAt      int64           `json:"created_at"`
+	UpdatedAt      int64           `json:"updated_at"`
+}
+
+type AdminActionCreate struct {
+	Action      string          `json:"action" binding:"required,max=100"`
+	Entity      string          `json:"entity" binding:"required,max=100"`
+	EntityID    string          `json:"entity_id" binding:"required,max=200"`
+	Params      json.RawMessage `json:"params"`
+	Reason      string          `json:"reason" binding:"max=2000"`
+	RequestedBy int             `json:"requested_by" binding:"min=0"`
+	RequestID   string          `json:"request_id" binding:"max=200"`
+	ExpiresAt   int64           `json:"expires_at" binding:"required,min=1"`
+}
+
+// approval or rejection of a pending action by an admin, the one who requested it may only reject it
+type AdminActionDecision struct {
+	Status    string `json:"status" binding:"required,oneof=approved rejected"`
+	DecidedBy int    `json:"decided_by" binding:"required,min=1"`
+	Reason    string `json:"reason" binding:"max=2000"`
+}
+
+// run of an approved action
+type AdminActionOutcome struct {
+	Status string          `json:"status" binding:"required,oneof=executed failed"`
+	Result json.RawMessage `json:"result"`
+	Error  string          `json:"error" binding:"max=2000"`
+}
+
+var (
+	errAdminActionNotFound = apperror.NotFound("Admin action not found")
+	errAdminActionPage     = apperror.Validation("page_num must be at least 1 and page_size between 1 and 100, status one of " +
+		strings.Join(adminActionStatuses, ", "))
+	errAdminActionParams       = apperror.Validation("params must be a json value and expires_at in the future")
+	errAdminActionDuplicate    = apperror.Conflict("an action of this kind on this entity is already pending")
+	errAdminActionNotPending   = apperror.Conflict("admin action is no longer pending, it was decided or expired")
+	errAdminActionSelfApproval = apperror.Conflict("admin action must be approved by another admin than the one who requested it")
+	errAdminActionNotApproved  = apperror.Conflict("admin action is not approved or its run is already recorded")
+)
+
+// =========== INTERFACE HANDLER, HANDLING REQUEST RESPONSE API DEPEND INTERFACE ===========
+
+// handler request response admin actions newest first, of one status when set
+func getAdminActionsHandler(c *gin.Context) {
+	pageNum, errNum := strconv.Atoi(c.DefaultQuery("page_num", "1"))
+	pageSize, errSize := strconv.Atoi(c.DefaultQuery("page_size", "50"))
+	if errNum != nil || errSize != nil {
+		apperror.Respond(c, errAdminActionPage)
+		return
+	}
+
+	actions, pagination, err := getAdminActionsUsecase(c.Request.Context(), c.Query("status"), pageNum, pageSize)
+	if err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"result": true, "admin_actions": actions, "pagination": pagination})
+}
+
+// handler request response write a pending admin action
+func createAdminActionHandler(c *gin.Context) {
+	var body AdminActionCreate
+	if err := c.ShouldBindJSON(&body); err != nil {
+		slog.ErrorContext(c.Request.Context(), "handler error", "code", "169", "error", err)
+		apperror.RespondBinding(c, err)
+		return
+	}
+
+	action, err := createAdminActionUsecase(c.Request.Context(), body)
+	if err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"result": true, "admin_action": action})
+}
+
+func getAdminActionHandler(c *gin.Context) {
+	id, ok := adminActionID(c)
+	if !ok {
+		return
+	}
+
+	action, err := getAdminActionUsecase(c.Request.Context(), id)
+	if err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"result": true, "admin_action": action})
+}
+
+// handler request response approve or reject a pending admin action
+func decideAdminActionHandler(c *gin.Context) {
+	id, ok := adminActionID(c)
+	if !ok {
+		return
+	}
+
+	var body AdminActionDecision
+	if err := c.ShouldBindJSON(&body); err != nil {
+		slog.ErrorContext(c.Request.Context(), "handler error", "code", "170", "error", err)
+		apperror.RespondBinding(c, err)
+		return
+	}
+
+	action, err := decideAdminActionUsecase(c.Request.Context(), id, body)
+	if err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"result": true, "admin_action": action})
+}
+
+// handler request response record the run of an approved admin action
+func recordAdminActionOutcomeHandler(c *gin.Context) {
+	id, ok := adminActionID(c)
+	if !ok {
+		return
+	}
+
+	var body AdminActionOutcome
+	if err := c.ShouldBindJSON(&body); err != nil {
+		slog.ErrorContext(c.Request.Context(), "handler error", "code", "171", "error", err)
+		apperror.RespondBinding(c, err)
+		return
+	}
+
+	action, err := recordAdminActionOutcomeUsecase(c.Request.Context(), id, body)
+	if err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"result": true, "admin_action": action})
+}
+
+// id param of the admin action, false once the bad request is answered
+func adminActionID(c *gin.Context) (int64, bool) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "handler error", "code", "172", "error", "Invalid admin action ID")
+		apperror.JSON(c, http.StatusBadRequest, "Invalid admin action ID")
+		return 0, false
+	}
+
+	return id, true
+}
+
+// =========== USECASE LAYER, SERVES AS AN INTERMEDIARY BETWEEN THE PRESENTATION LAYER AND THE DATA LAYER ===========
+
+// pending actions past their expiry are expired before any read or decision, so a stale request is never approved
+func expireAdminActions(ctx context.Context) error {
+	expired, err := repo.ExpireAdminActions(ctx, time.Now().UnixMicro())
+	if err != nil {
+		return errors.New("database error: expire admin actions error database")
+	}
+	if expired > 0 {
+		slog.InfoContext(ctx, "admin actions expired", "admin_actions", expired)
+	}
+	return nil
+}
+
+func getAdminActionsUsecase(ctx context.Context, status string, pageNum, pageSize int) ([]AdminAction, *Pagination, error) {
+	if pageNum < 1 || pageSize < 1 || pageSize > 100 || (status != "" && !slices.Contains(adminActionStatuses, status)) {
+		return nil, nil, errAdminActionPage
+	}
+	if err := expireAdminActions(ctx); err != nil {
+		return nil, nil, err
+	}
+
+	actions, err := repo.FindAdminActions(ctx, status, pageNum, pageSize)
+	if err != nil {
+		return nil, nil, errors.New("database error: get admin actions error database")
+	}
+
+	total, err := repo.CountAdminActions(ctx, status)
+	if err != nil {
+		return nil, nil, errors.New("database error: count admin actions error database")
+	}
+
+	pagination := newPagination(pageNum, pageSize, total)
+	return actions, &pagination, nil
+}
+
+func createAdminActionUsecase(ctx context.Context, create AdminActionCreate) (*AdminAction, error) {
+	now := time.Now().UnixMicro()
+	if (len(create.Params) > 0 && !json.Valid(create.Params)) || create.ExpiresAt <= now {
+		return nil, errAdminActionParams
+	}
+	// an expired request no longer holds the entity
+	if err := expireAdminActions(ctx); err != nil {
+		return nil, err
+	}
+
+	action := &AdminAction{
+		Action:      create.Action,
+		Entity:      create.Entity,
+		EntityID:    create.EntityID,
+		Params:      create.Params,
+		Reason:      create.Reason,
+		Status:      AdminActionPending,
+		RequestedBy: create.RequestedBy,
+		RequestID:   create.RequestID,
+		ExpiresAt:   create.ExpiresAt,
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}
+	created, err := repo.CreateAdminAction(ctx, action)
+	if err != nil {
+		return nil, errors.New("database error: create admin action error database")
+	}
+	if !created {
+		return nil, errAdminActionDuplicate
+	}
+
+	slog.InfoContext(ctx, "admin action requested", "admin_action_id", action.ID, "action", action.Action, "entity_id", action.EntityID,
+		"requested_by", action.RequestedBy)
+	return action, nil
+}
+
+func getAdminActionUsecase(ctx context.Context, id int64) (*AdminAction, error) {
+	if err := expireAdminActions(ctx); err != nil {
+		return nil, err
+	}
+
+	action, err := repo.FindAdminActionByID(ctx, id)
+	if err != nil {
+		if errors.Is(err, errAdminActionNotFound) {
+			return nil, err
+		}
+		return nil, errors.New("database error: get admin action error database")
+	}
+
+	return action, nil
+}
+
+// the decision only applies to an action still pending and not expired, and an approval only by another admin
+// than the requester, checked in the update itself so two admins deciding at once can not both win
+func decideAdminActionUsecase(ctx context.Context, id int64, decision AdminActionDecision) (*AdminAction, error) {
+	action, err := getAdminActionUsecase(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if action.Status != AdminActionPending {
+		return nil, errAdminActionNotPending
+	}
+	if decision.Status == AdminActionApproved && decision.DecidedBy == action.RequestedBy {
+		return nil, errAdminActionSelfApproval
+	}
+
+	now := time.Now().UnixMicro()
+	decided, err := repo.DecideAdminAction(ctx, id, decision, now)
+	if err != nil {
+		return nil, errors.New("database error: decide admin action error database")
+	}
+	if !decided {
+		return nil, errAdminActionNotPending
+	}
+
+	action.Status, action.DecidedBy, action.DecisionReason = decision.Status, decision.DecidedBy, decision.Reason
+	action.DecidedAt, action.UpdatedAt = now, now
+	slog.InfoContext(ctx, "admin action decided", "admin_action_id", id, "action", action.Action, "status", decision.Status,
+		"decided_by", decision.DecidedBy)
+	return action, nil
+}
+
+func recordAdminActionOutcomeUsecase(ctx context.Context, id int64, outcome AdminActionOutcome) (*AdminAction, error) {
+	if len(outcome.Result) > 0 && !json.Valid(outcome.Result) {
+		return nil, errAdminActionParams
+	}
+
+	recorded, err := repo.RecordAdminActionOutcome(ctx, id, outcome, time.Now().UnixMicro())
+	if err != nil {
+		return nil, errors.New("database error: record admin action outcome error database")
+	}
+	if !recorded {
+		if _, err := getAdminActionUsecase(ctx, id); err != nil {
+			return nil, err
+		}
+		return nil, errAdminActionNotApproved
+	}
+
+	action, err := getAdminActionUsecase(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	slog.InfoContext(ctx, "admin action run", "admin_action_id", id, "action", action.Action, "status", outcome.Status)
+	return action, nil
+}
+
+// =========== REPOSITORY LAYER, ABSTRACTION OVER THE DATA PERSISTENCE (databases, file systems, or external APIs) ===========
+
+const adminActionColumns = "id, action, entity, entity_id, params, reason, status, requested_by, request_id, decided_by, decision_reason, " +
+	"decided_at, result, error, expires_at, created_at, updated_at"
+
+func scanAdminAction(row interface{ Scan(...any) error }, action *AdminAction) error {
+	var params, reason, requestID, decisionReason, result, runError sql.NullString
+	var decidedBy, decidedAt sql.NullInt64
+	err := row.Scan(&action.ID, &action.Action, &action.Entity, &action.EntityID, &params, &reason, &action.Status, &action.RequestedBy,
+		&requestID, &decidedBy, &decisionReason, &decidedAt, &result, &runError, &action.ExpiresAt, &action.CreatedAt, &action.UpdatedAt)
+	if err != nil {
+		return err
+	}
+
+	if params.Valid {
+		action.Params = json.RawMessage(params.String)
+	}
+	if result.Valid {
+		action.Result = json.RawMessage(result.String)
+	}
+	action.Reason, action.RequestID, action.DecisionReason, action.Error = reason.String, requestID.String, decisionReason.String, runError.String
+	action.DecidedBy, action.DecidedAt = int(decidedBy.Int64), decidedAt.Int64
+	return nil
+}
+
+// where clause of the admin actions of status, all when empty
+func adminActionWhere(status string) (string, []any) {
+	if status == "" {
+		return "1 = 1", nil
+	}
+	return "status = ?", []any{status}
+}
+
+// page of the admin actions of status newest first
+func (r *sqlUserRepository) FindAdminActions(ctx context.Context, status string, pageNum, pageSize int) ([]AdminAction, error) {
+	ctx, done := r.observe(ctx, "findAdminActions")
+	defer done()
+
+	where, args := adminActionWhere(status)
+	rows, err := r.query(ctx, "SELECT "+adminActionColumns+" FROM admin_actions WHERE "+where+" ORDER BY created_at DESC, id DESC LIMIT ? OFFSET ?",
+		append(args, pageSize, (pageNum-1)*pageSize)...)
+	if err != nil {
+		slog.ErrorContext(ctx, "handler error", "code", "173", "error", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	actions := []AdminAction{}
+	for rows.Next() {
+		var action AdminAction
+		if err := scanAdminAction(rows, &action); err != nil {
+			slog.ErrorContext(ctx, "handler error", "code", "173", "error", err)
+			return nil, err
+		}
+		actions = append(actions, action)
+	}
+
+	return actions, rows.Err()
+}
+
+func (r *sqlUserRepository) CountAdminActions(ctx context.Context, status string) (int, error) {
+	ctx, done := r.observe(ctx, "countAdminActions")
+	defer done()
+
+	where, args := adminActionWhere(status)
+	var count int
+	if err := r.queryRow(ctx, "SELECT COUNT(*) FROM admin_actions WHERE "+where, args...).Scan(&count); err != nil {
+		slog.ErrorContext(ctx, "handler error", "code", "174", "error", err)
+		return 0, err
+	}
+
+	return count, nil
+}
+
+func (r *sqlUserRepository) FindAdminActionByID(ctx context.Context, id int64) (*AdminAction, error) {
+	ctx, done := r.observe(ctx, "findAdminActionByID")
+	defer done()
+
+	var action AdminAction
+	err := scanAdminAction(r.queryRow(ctx, "SELECT "+adminActionColumns+" FROM admin_actions WHERE id = ?", id), &action)
+	if err == sql.ErrNoRows {
+		return nil, errAdminActionNotFound
+	}
+	if err != nil {
+		slog.ErrorContext(ctx, "handler error", "code", "175", "error", err)
+		return nil, err
+	}
+
+	return &action, nil
+}
+
+// insert pending admin action setting its id, false when the same action on the entity is already pending
+func (r *sqlUserRepository) CreateAdminAction(ctx context.Context, action *AdminAction) (bool, error) {
+	ctx, done := r.observe(ctx, "createAdminAction")
+	defer done()
+
+	var params sql.NullString
+	if len(action.Params) > 0 {
+		params = sql.NullString{String: string(action.Params), Valid: true}
+	}
+
+	err := r.insertRow(ctx, `INSERT INTO admin_actions (action, entity, entity_id, params, reason, status, requested_by, request_id, expires_at, created_at, updated_at)
+		VALUES (?, ?, ?, ?, NULLIF(?, ''), ?, ?, NULLIF(?, ''), ?, ?, ?)
+		ON CONFLICT DO NOTHING
+		RETURNING id`,
+		action.Action, action.Entity, action.EntityID, params, action.Reason, action.Status, action.RequestedBy, action.RequestID,
+		action.ExpiresAt, action.CreatedAt, action.UpdatedAt).Scan(&action.ID)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		slog.ErrorContext(ctx, "handler error", "code", "176", "error", err)
+		return false, err
+	}
+
+	return true, nil
+}
+
+// expire the pending admin actions whose expiry is at or before now, returns how many
+func (r *sqlUserRepository) ExpireAdminActions(ctx context.Context, now int64) (int64, error) {
+	ctx, done := r.observe(ctx, "expireAdminActions")
+	defer done()
+
+	result, err := r.exec(ctx, "UPDATE admin_actions SET status = ?, updated_at = ? WHERE status = ? AND expires_at <= ?",
+		AdminActionExpired, now, AdminActionPending, now)
+	if err != nil {
+		slog.ErrorContext(ctx, "handler error", "code", "177", "error", err)
+		return 0, err
+	}
+
+	return result.RowsAffected()
+}
+
+// set the decision of a pending admin action not expired at now, an approval only when the decider did not request
+// it. False when no action matched
+func (r *sqlUserRepository) DecideAdminAction(ctx context.Context, id int64, decision AdminActionDecision, now int64) (bool, error) {
+	ctx, done := r.observe(ctx, "decideAdminAction")
+	defer done()
+
+	result, err := r.exec(ctx, `UPDATE admin_actions SET status = ?, decided_by = ?, decision_reason = NULLIF(?, ''), decided_at = ?, updated_at = ?
+		WHERE id = ? AND status = ? AND expires_at > ? AND (CAST(? AS TEXT) = 'rejected' OR requested_by <> ?)`,
+		decision.Status, decision.DecidedBy, decision.Reason, now, now, id, AdminActionPending, now, decision.Status, decision.DecidedBy)
+	if err != nil {
+		slog.ErrorContext(ctx, "handler error", "code", "178", "error", err)
+		return false, err
+	}
+
+	updated, err := result.RowsAffected()
+	if err != nil {
+		slog.ErrorContext(ctx, "handler error", "code", "178", "error", err)
+		return false, err
+	}
+
+	return updated > 0, nil
+}
+
+// set the outcome of an approved admin action, false when it is not approved
+func (r *sqlUserRepository) RecordAdminActionOutcome(ctx context.Context, id int64, outcome AdminActionOutcome, now int64) (bool, error) {
+	ctx, done := r.observe(ctx, "recordAdminActionOutcome")
+	defer done()
+
+	var result sql.NullString
+	if len(outcome.Result) > 0 {
+		result = sql.NullString{String: string(outcome.Result), Valid: true}
+	}
+
+	res, err := r.exec(ctx, "UPDATE admin_actions SET status = ?, result = ?, error = NULLIF(?, ''), updated_at = ? WHERE id = ? AND status = ?",
+		outcome.Status, result, outcome.Error, now, id, AdminActionApproved)
+	if err != nil {
+		slog.ErrorContext(ctx, "handler error", "code", "179", "error", err)
+		return false, err
+	}
+
+	updated, err := res.RowsAffected()
+	if err != nil {
+		slog.ErrorContext(ctx, "handler error", "code", "179", "error", err)
+		return false, err
+	}
+
+	return updated > 0, nil
+}
@@ -0,0 +1,93 @@
+package userservice
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestAdminActionNeedsSecondAdmin(t *testing.T) {
+	ctx := context.Background()
+	r := newTestRepository(t)
+
+	action, err := createAdminActionUsecase(ctx, AdminActionCreate{
+		Action: "listing.hard_delete", Entity: "listing", EntityID: "7", RequestedBy: 1,
+		ExpiresAt: time.Now().Add(time.Hour).UnixMicro(),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := createAdminActionUsecase(ctx, AdminActionCreate{
+		Action: "listing.hard_delete", Entity: "listing", EntityID: "7", RequestedBy: 2,
+		ExpiresAt: time.Now().Add(time.Hour).UnixMicro(),
+	}); !errors.Is(err, errAdminActionDuplicate) {
+		t.Errorf("second request of a pending action: %v, want %v", err, errAdminActionDuplicate)
+	}
+
+	// the requester can not approve, neither through the usecase nor the update itself
+	if _, err := decideAdminActionUsecase(ctx, action.ID, AdminActionDecision{Status: AdminActionApproved, DecidedBy: 1}); !errors.Is(err, errAdminActionSelfApproval) {
+		t.Fatalf("approval by the requester: %v, want %v", err, errAdminActionSelfApproval)
+	}
+	decided, err := r.DecideAdminAction(ctx, action.ID, AdminActionDecision{Status: AdminActionApproved, DecidedBy: 1}, time.Now().UnixMicro())
+	if err != nil || decided {
+		t.Fatalf("update approving as the requester: %v %v, want no row", decided, err)
+	}
+
+	// not run before it is approved
+	if _, err := recordAdminActionOutcomeUsecase(ctx, action.ID, AdminActionOutcome{Status: AdminActionExecuted}); !errors.Is(err, errAdminActionNotApproved) {
+		t.Fatalf("run of a pending action: %v, want %v", err, errAdminActionNotApproved)
+	}
+
+	approved, err := decideAdminActionUsecase(ctx, action.ID, AdminActionDecision{Status: AdminActionApproved, DecidedBy: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if approved.Status != AdminActionApproved || approved.DecidedBy != 2 {
+		t.Errorf("approved action = %+v, want approved by 2", approved)
+	}
+	if _, err := decideAdminActionUsecase(ctx, action.ID, AdminActionDecision{Status: AdminActionRejected, DecidedBy: 3}); !errors.Is(err, errAdminActionNotPending) {
+		t.Errorf("second decision: %v, want %v", err, errAdminActionNotPending)
+	}
+
+	executed, err := recordAdminActionOutcomeUsecase(ctx, action.ID, AdminActionOutcome{Status: AdminActionExecuted})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if executed.Status != AdminActionExecuted {
+		t.Errorf("status = %s, want %s", executed.Status, AdminActionExecuted)
+	}
+}
+
+func TestAdminActionRejectedOrExpired(t *testing.T) {
+	ctx := context.Background()
+	newTestRepository(t)
+
+	// the requester may withdraw its own request
+	action, err := createAdminActionUsecase(ctx, AdminActionCreate{
+		Action: "user.role", Entity: "user", EntityID: "5", RequestedBy: 1, ExpiresAt: time.Now().Add(time.Hour).UnixMicro(),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := decideAdminActionUsecase(ctx, action.ID, AdminActionDecision{Status: AdminActionRejected, DecidedBy: 1}); err != nil {
+		t.Fatalf("rejection by the requester: %v", err)
+	}
+	if _, err := recordAdminActionOutcomeUsecase(ctx, action.ID, AdminActionOutcome{Status: AdminActionExecuted}); !errors.Is(err, errAdminActionNotApproved) {
+		t.Errorf("run of a rejected action: %v, want %v", err, errAdminActionNotApproved)
+	}
+
+	stale, err := createAdminActionUsecase(ctx, AdminActionCreate{
+		Action: "user.role", Entity: "user", EntityID: "6", RequestedBy: 1, ExpiresAt: time.Now().Add(50 * time.Millisecond).UnixMicro(),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(100 * time.Millisecond)
+	if _, err := decideAdminActionUsecase(ctx, stale.ID, AdminActionDecision{Status: AdminActionApproved, DecidedBy: 2}); !errors.Is(err, errAdminActionNotPending) {
+		t.Errorf("approval of an expired action: %v, want %v", err, errAdminActionNotPending)
+	}
+	if got, err := getAdminActionUsecase(ctx, stale.ID); err != nil || got.Status != AdminActionExpired {
+		t.Errorf("stale action = %+v %v, want %s", got, err, AdminActionExpired)
+	}
+}
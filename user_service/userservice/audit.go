@@ -0,0 +1,248 @@
+package userservice
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"apperror"
+
+	"github.com/gin-gonic/gin"
+)
+
+// write done through the public API, actor 0 is an operator holding the internal api key or an anonymous caller
+type AuditEntry struct {
+	ID        int64  `json:"id"`
+	ActorID   int    `json:"actor_id" binding:"min=0"`
+	Action    string `json:"action" binding:"required,max=100"`
+	Entity    string `json:"entity" binding:"required,max=50"`
+	EntityID  string `json:"entity_id,omitempty" binding:"max=100"`
+	Detail    string `json:"detail,omitempty" binding:"max=2000"`
+	RequestID string `json:"request_id,omitempty" binding:"max=128"`
+	// entity before and after the write as json, absent when the public API could not tell
+	Before json.RawMessage `json:"before,omitempty" binding:"max=65536"`
+	After  json.RawMessage `json:"after,omitempty" binding:"max=65536"`
+	// unix microseconds, now when zero
+	CreatedAt int64 `json:"created_at" binding:"min=0"`
+	// hash of the entry before in the chain and of this one, set when the entry is written, see auditEntryHash
+	PrevHash string `json:"prev_hash,omitempty"`
+	Hash     string `json:"hash,omitempty"`
+}
+
+// entries of an entity within [From, To) unix microseconds, zero values match every entry
+type AuditLogFilter struct {
+	Entity string `json:"entity,omitempty"`
+	From   int64  `json:"from,omitempty"`
+	To     int64  `json:"to,omitempty"`
+}
+
+var (
+	errAuditPage   = apperror.Validation("page_num must be at least 1 and page_size between 1 and 100")
+	errAuditFilter = apperror.Validation("from and to must be unix microseconds with from before to")
+)
+
+// =========== INTERFACE HANDLER, HANDLING REQUEST RESPONSE API DEPEND INTERFACE ===========
+
+// handler request response record a write
+func createAuditEntryHandler(c *gin.Context) {
+	var body AuditEntry
+	if err := c.ShouldBindJSON(&body); err != nil {
+		slog.ErrorContext(c.Request.Context(), "handler error", "code", "147", "error", err)
+		apperror.RespondBinding(c, err)
+		return
+	}
+
+	entry, err := createAuditEntryUsecase(c.Request.Context(), body)
+	if err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"result": true, "entry": entry})
+}
+
+// handler request response audit log newest first
+func getAuditLogHandler(c *gin.Context) {
+	pageNum, errNum := strconv.Atoi(c.DefaultQuery("page_num", "1"))
+	pageSize, errSize := strconv.Atoi(c.DefaultQuery("page_size", "50"))
+	if errNum != nil || errSize != nil {
+		apperror.Respond(c, errAuditPage)
+		return
+	}
+
+	from, errFrom := strconv.ParseInt(c.DefaultQuery("from", "0"), 10, 64)
+	to, errTo := strconv.ParseInt(c.DefaultQuery("to", "0"), 10, 64)
+	if errFrom != nil || errTo != nil {
+		apperror.Respond(c, errAuditFilter)
+		return
+	}
+
+	filter := AuditLogFilter{Entity: c.Query("entity"), From: from, To: to}
+	entries, pagination, err := getAuditLogUsecase(c.Request.Context(), filter, pageNum, pageSize)
+	if err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"result": true, "entries": entries, "pagination": pagination})
+}
+
+// =========== USECASE LAYER, SERVES AS AN INTERMEDIARY BETWEEN THE PRESENTATION LAYER AND THE DATA LAYER ===========
+
+func createAuditEntryUsecase(ctx context.Context, entry AuditEntry) (*AuditEntry, error) {
+	if entry.CreatedAt == 0 {
+		entry.CreatedAt = time.Now().UnixMicro()
+	}
+
+	if err := repo.CreateAuditEntry(ctx, &entry); err != nil {
+		return nil, errors.New("database error: create audit entry error database")
+	}
+
+	return &entry, nil
+}
+
+func getAuditLogUsecase(ctx context.Context, filter AuditLogFilter, pageNum, pageSize int) ([]AuditEntry, *Pagination, error) {
+	if pageNum < 1 || pageSize < 1 || pageSize > 100 {
+		return nil, nil, errAuditPage
+	}
+	if filter.From < 0 || filter.To < 0 || (filter.To != 0 && filter.From >= filter.To) {
+		return nil, nil, errAuditFilter
+	}
+
+	entries, err := repo.FindAuditEntries(ctx, filter, pageNum, pageSize)
+	if err != nil {
+		return nil, nil, errors.New("database error: get audit log error database")
+	}
+
+	total, err := repo.CountAuditEntries(ctx, filter)
+	if err != nil {
+		return nil, nil, errors.New("database error: count audit log error database")
+	}
+
+	pagination := newPagination(pageNum, pageSize, total)
+	return entries, &pagination, nil
+}
+
+// =========== REPOSITORY LAYER, ABSTRACTION OVER THE DATA PERSISTENCE (databases, file systems, or external APIs) ===========
+
+// insert entry setting its id, chained to the last entry. Entries are chained one at a time: the single writer
+// connection of sqlite and the table lock on postgres make the next one wait for the commit
+func (r *sqlUserRepository) CreateAuditEntry(ctx context.Context, entry *AuditEntry) error {
+	ctx, done := r.observe(ctx, "createAuditEntry")
+	defer done()
+
+	err := r.withTx(ctx, func(tx *sql.Tx) error {
+		if r.dialect.name == dialectPostgres {
+			if _, err := tx.ExecContext(ctx, "LOCK TABLE audit_log IN SHARE ROW EXCLUSIVE MODE"); err != nil {
+				return err
+			}
+		}
+
+		var prevHash sql.NullString
+		err := tx.QueryRowContext(ctx, "SELECT hash FROM audit_log WHERE hash IS NOT NULL ORDER BY id DESC LIMIT 1").Scan(&prevHash)
+		if err != nil && err != sql.ErrNoRows {
+			return err
+		}
+		entry.PrevHash = prevHash.String
+		entry.Hash = auditEntryHash(*entry)
+
+		return tx.QueryRowContext(ctx, r.rebind(`INSERT INTO audit_log (actor_id, action, entity, entity_id, detail, request_id, before_json, after_json, created_at, prev_hash, hash)
+			VALUES (?, ?, ?, NULLIF(?, ''), NULLIF(?, ''), NULLIF(?, ''), NULLIF(?, ''), NULLIF(?, ''), ?, NULLIF(?, ''), ?) RETURNING id`),
+			entry.ActorID, entry.Action, entry.Entity, entry.EntityID, entry.Detail, entry.RequestID, string(entry.Before), string(entry.After), entry.CreatedAt,
+			entry.PrevHash, entry.Hash).Scan(&entry.ID)
+	})
+	if err != nil {
+		slog.ErrorContext(ctx, "handler error", "code", "148", "error", err)
+		return err
+	}
+
+	return nil
+}
+
+// where clause of the entries matching filter
+func auditLogWhere(filter AuditLogFilter) (string, []any) {
+	where := []string{"1 = 1"}
+	var args []any
+	if filter.Entity != "" {
+		where = append(where, "entity = ?")
+		args = append(args, filter.Entity)
+	}
+	if filter.From > 0 {
+		where = append(where, "created_at >= ?")
+		args = append(args, filter.From)
+	}
+	if filter.To > 0 {
+		where = append(where, "created_at < ?")
+		args = append(args, filter.To)
+	}
+	return strings.Join(where, " AND "), args
+}
+
+const auditEntryColumns = "id, actor_id, action, entity, entity_id, detail, request_id, before_json, after_json, created_at, prev_hash, hash"
+
+// entries of rows of auditEntryColumns
+func scanAuditEntries(rows *sql.Rows) ([]AuditEntry, error) {
+	entries := []AuditEntry{}
+	for rows.Next() {
+		var entry AuditEntry
+		var entityID, detail, requestID, before, after, prevHash, hash sql.NullString
+		if err := rows.Scan(&entry.ID, &entry.ActorID, &entry.Action, &entry.Entity, &entityID, &detail, &requestID, &before, &after, &entry.CreatedAt,
+			&prevHash, &hash); err != nil {
+			return nil, err
+		}
+		entry.EntityID, entry.Detail, entry.RequestID = entityID.String, detail.String, requestID.String
+		entry.PrevHash, entry.Hash = prevHash.String, hash.String
+		if before.Valid {
+			entry.Before = json.RawMessage(before.String)
+		}
+		if after.Valid {
+			entry.After = json.RawMessage(after.String)
+		}
+		entries = append(entries, entry)
+	}
+
+	return entries, rows.Err()
+}
+
+// page of the audit log matching filter newest first
+func (r *sqlUserRepository) FindAuditEntries(ctx context.Context, filter AuditLogFilter, pageNum, pageSize int) ([]AuditEntry, error) {
+	ctx, done := r.observe(ctx, "findAuditEntries")
+	defer done()
+
+	where, args := auditLogWhere(filter)
+	rows, err := r.query(ctx, "SELECT "+auditEntryColumns+" FROM audit_log WHERE "+where+
+		" ORDER BY created_at DESC, id DESC LIMIT ? OFFSET ?", append(args, pageSize, (pageNum-1)*pageSize)...)
+	if err != nil {
+		slog.ErrorContext(ctx, "handler error", "code", "149", "error", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	entries, err := scanAuditEntries(rows)
+	if err != nil {
+		slog.ErrorContext(ctx, "handler error", "code", "149", "error", err)
+		return nil, err
+	}
+
+	return entries, nil
+}
+
+func (r *sqlUserRepository) CountAuditEntries(ctx context.Context, filter AuditLogFilter) (int, error) {
+	ctx, done := r.observe(ctx, "countAuditEntries")
+	defer done()
+
+	where, args := auditLogWhere(filter)
+	var total int
+	if err := r.queryRow(ctx, "SELECT COUNT(*) FROM audit_log WHERE "+where, args...).Scan(&total); err != nil {
+		slog.ErrorContext(ctx, "handler error", "code", "150", "error", err)
+		return 0, err
+	}
+
+	return total, nil
+}
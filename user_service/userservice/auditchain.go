@@ -0,0 +1,449 @@
+package userservice
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"apperror"
+
+	"github.com/gin-gonic/gin"
+)
+
+// hash of the head of the audit chain written to AUDIT_ANCHOR_STORAGE, Location tells where
+type AuditAnchor struct {
+	ID        int64  `json:"id"`
+	EntryID   int64  `json:"entry_id"`
+	Hash      string `json:"hash"`
+	Location  string `json:"location"`
+	CreatedAt int64  `json:"created_at"`
+}
+
+// result of a walk of the whole chain, Valid when every entry links to the one before and hashes to its hash and
+// every anchor has the hash of its entry
+type AuditChainVerification struct {
+	Valid bool `json:"valid"`
+	// chained entries walked, entries written before the chain have no hash and are not covered
+	Entries  int    `json:"entries"`
+	HeadID   int64  `json:"head_id,omitempty"`
+	HeadHash string `json:"head_hash,omitempty"`
+	// first entry that does not link or hash, the chain is not walked further
+	BrokenID int64 `json:"broken_id,omitempty"`
+	Anchors  int   `json:"anchors"`
+	// first anchor whose entry has another hash or is gone
+	BrokenAnchorID int64        `json:"broken_anchor_id,omitempty"`
+	LastAnchor     *AuditAnchor `json:"last_anchor,omitempty"`
+}
+
+var (
+	// AUDIT_ANCHOR_STORAGE none, dir or http, where the hash of the head of the audit chain is written
+	auditAnchorStorage = cfg.String("AUDIT_ANCHOR_STORAGE", "none")
+	// AUDIT_ANCHOR_INTERVAL wait between two anchors, none is written while the chain did not grow
+	auditAnchorInterval = cfg.Duration("AUDIT_ANCHOR_INTERVAL", time.Hour)
+)
+
+var errAuditChainPage = apperror.Validation("after_id must be at least 0 and limit between 1 and 1000")
+
+// =========== INTERFACE HANDLER, HANDLING REQUEST RESPONSE API DEPEND INTERFACE ===========
+
+// handler request response chained entries oldest first after after_id, with their hashes to check them
+func getAuditChainHandler(c *gin.Context) {
+	afterID, errAfter := strconv.ParseInt(c.DefaultQuery("after_id", "0"), 10, 64)
+	limit, errLimit := strconv.Atoi(c.DefaultQuery("limit", "100"))
+	if errAfter != nil || errLimit != nil {
+		apperror.Respond(c, errAuditChainPage)
+		return
+	}
+
+	entries, err := getAuditChainUsecase(c.Request.Context(), afterID, limit)
+	if err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"result": true, "entries": entries})
+}
+
+// handler request response walk of the whole chain and its anchors
+func verifyAuditChainHandler(c *gin.Context) {
+	verification, err := verifyAuditChainUsecase(c.Request.Context())
+	if err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"result": true, "verification": verification})
+}
+
+// =========== USECASE LAYER, SERVES AS AN INTERMEDIARY BETWEEN THE PRESENTATION LAYER AND THE DATA LAYER ===========
+
+// hex sha256 of the json array [prev_hash, actor_id, action, entity, entity_id, detail, request_id, before, after,
+// created_at] without html escaping, before and after compacted and null when absent
+func auditEntryHash(entry AuditEntry) string {
+	before, after := entry.Before, entry.After
+	if len(before) == 0 {
+		before = nil
+	}
+	if len(after) == 0 {
+		after = nil
+	}
+
+	var content bytes.Buffer
+	encoder := json.NewEncoder(&content)
+	encoder.SetEscapeHTML(false)
+	// only fails on invalid before or after, refused when binding the entry
+	_ = encoder.Encode([]any{entry.PrevHash, entry.ActorID, entry.Action, entry.Entity, entry.EntityID, entry.Detail, entry.RequestID,
+		before, after, entry.CreatedAt})
+
+	sum := sha256.Sum256(bytes.TrimSuffix(content.Bytes(), []byte("\n")))
+	return hex.EncodeToString(sum[:])
+}
+
+func getAuditChainUsecase(ctx context.Context, afterID int64, limit int) ([]AuditEntry, error) {
+	if afterID < 0 || limit < 1 || limit > 1000 {
+		return nil, errAuditChainPage
+	}
+
+	entries, err := repo.FindAuditChain(ctx, afterID, limit)
+	if err != nil {
+		return nil, errors.New("database error: get audit chain error database")
+	}
+
+	return entries, nil
+}
+
+// walk the chain from its first entry, checking the anchors on the way
+func verifyAuditChainUsecase(ctx context.Context) (*AuditChainVerification, error) {
+	anchors, err := repo.FindAuditAnchors(ctx)
+	if err != nil {
+		return nil, errors.New("database error: get audit anchors error database")
+	}
+
+	verification := &AuditChainVerification{Valid: true, Anchors: len(anchors)}
+	if len(anchors) > 0 {
+		verification.LastAnchor = &anchors[len(anchors)-1]
+	}
+
+	// anchors are ordered by entry id like the chain
+	next := 0
+	for afterID := int64(0); ; {
+		entries, err := repo.FindAuditChain(ctx, afterID, 500)
+		if err != nil {
+			return nil, errors.New("database error: get audit chain error database")
+		}
+
+		for _, entry := range entries {
+			if entry.PrevHash != verification.HeadHash || auditEntryHash(entry) != entry.Hash {
+				verification.Valid, verification.BrokenID = false, entry.ID
+				slog.ErrorContext(ctx, "usecase error", "code", "181", "error", "audit chain broken", "entry_id", entry.ID)
+				return verification, nil
+			}
+			for ; next < len(anchors) && anchors[next].EntryID < entry.ID; next++ {
+				// the entry of the anchor was removed
+				verification.markAnchorBroken(ctx, anchors[next])
+			}
+			if next < len(anchors) && anchors[next].EntryID == entry.ID {
+				if anchors[next].Hash != entry.Hash {
+					verification.markAnchorBroken(ctx, anchors[next])
+				}
+				next++
+			}
+
+			verification.Entries++
+			verification.HeadID, verification.HeadHash = entry.ID, entry.Hash
+		}
+
+		if len(entries) < 500 {
+			break
+		}
+		afterID = entries[len(entries)-1].ID
+	}
+
+	// anchors past the head, the entries they anchor were removed
+	for ; next < len(anchors); next++ {
+		verification.markAnchorBroken(ctx, anchors[next])
+	}
+
+	return verification, nil
+}
+
+func (v *AuditChainVerification) markAnchorBroken(ctx context.Context, anchor AuditAnchor) {
+	slog.ErrorContext(ctx, "usecase error", "code", "182", "error", "audit anchor does not match the chain", "anchor_id", anchor.ID, "entry_id", anchor.EntryID)
+	v.Valid = false
+	if v.BrokenAnchorID == 0 {
+		v.BrokenAnchorID = anchor.ID
+	}
+}
+
+// write the head of the chain to the anchor storage and keep where, nothing when it is already anchored
+func anchorAuditChainUsecase(ctx context.Context, store auditAnchorStore) error {
+	head, err := repo.FindAuditChainHead(ctx)
+	if err != nil {
+		return err
+	}
+	if head == nil {
+		return nil
+	}
+
+	anchors, err := repo.FindAuditAnchors(ctx)
+	if err != nil {
+		return err
+	}
+	if len(anchors) > 0 && anchors[len(anchors)-1].EntryID == head.ID {
+		return nil
+	}
+
+	anchor := AuditAnchor{EntryID: head.ID, Hash: head.Hash, CreatedAt: time.Now().UnixMicro()}
+	body, err := json.Marshal(struct {
+		EntryID   int64  `json:"entry_id"`
+		Hash      string `json:"hash"`
+		CreatedAt int64  `json:"created_at"`
+	}{anchor.EntryID, anchor.Hash, anchor.CreatedAt})
+	if err != nil {
+		return err
+	}
+
+	// written first so every kept anchor can be found outside, another instance anchoring the same head writes the
+	// same name
+	if anchor.Location, err = store.Put(ctx, fmt.Sprintf("audit-anchor-%d.json", anchor.EntryID), body); err != nil {
+		return err
+	}
+
+	if _, err := repo.CreateAuditAnchor(ctx, &anchor); err != nil {
+		return err
+	}
+	slog.InfoContext(ctx, "audit: chain anchored", "entry_id", anchor.EntryID, "hash", anchor.Hash, "location", anchor.Location)
+
+	return nil
+}
+
+// =========== WORKER, WRITE THE HEAD OF THE AUDIT CHAIN OUT OF THE DATABASE ===========
+
+// auditAnchorStore keep an anchor out of the database under name, returns where
+type auditAnchorStore interface {
+	Put(ctx context.Context, name string, body []byte) (string, error)
+}
+
+// AUDIT_ANCHOR_DIR directory of the dir storage, a mount the database host can not rewrite
+// AUDIT_ANCHOR_URL base url of the http storage, each anchor is PUT under it
+func newAuditAnchorStore() auditAnchorStore {
+	switch auditAnchorStorage {
+	case "none":
+		return nil
+	case "dir":
+		dir := cfg.String("AUDIT_ANCHOR_DIR", "audit-anchors")
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			log.Fatal(err)
+		}
+		return dirAnchorStore{dir: dir}
+	case "http":
+		url := strings.TrimRight(cfg.String("AUDIT_ANCHOR_URL", ""), "/")
+		if !strings.HasPrefix(url, "http://") && !strings.HasPrefix(url, "https://") {
+			log.Fatal("AUDIT_ANCHOR_STORAGE http needs AUDIT_ANCHOR_URL, an http or https url")
+		}
+		return httpAnchorStore{url: url, client: &http.Client{Timeout: 30 * time.Second}}
+	default:
+		log.Fatalf("unknown AUDIT_ANCHOR_STORAGE %q, one of: none, dir, http", auditAnchorStorage)
+		return nil
+	}
+}
+
+// anchors as files of a directory, a file once written is never replaced
+type dirAnchorStore struct {
+	dir string
+}
+
+func (s dirAnchorStore) Put(ctx context.Context, name string, body []byte) (string, error) {
+	path := filepath.Join(s.dir, name)
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o444)
+	if errors.Is(err, os.ErrExist) {
+		return path, nil
+	}
+	if err != nil {
+		return "", err
+	}
+
+	if _, err := file.Write(body); err != nil {
+		file.Close()
+		os.Remove(path)
+		return "", err
+	}
+	return path, file.Close()
+}
+
+// anchors PUT to a url, e.g. a bucket with object lock or a timestamping service
+type httpAnchorStore struct {
+	url    string
+	client *http.Client
+}
+
+func (s httpAnchorStore) Put(ctx context.Context, name string, body []byte) (string, error) {
+	location := s.url + "/" + name
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, location, bytes.NewReader(body))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return "", fmt.Errorf("anchor storage answered %s", resp.Status)
+	}
+	return location, nil
+}
+
+// writer of the anchors every AUDIT_ANCHOR_INTERVAL
+type auditAnchorWorker struct {
+	stop chan struct{}
+	done chan struct{}
+}
+
+// nil with AUDIT_ANCHOR_STORAGE none or AUDIT_ANCHOR_INTERVAL 0
+func startAuditAnchors() *auditAnchorWorker {
+	store := newAuditAnchorStore()
+	if store == nil || auditAnchorInterval <= 0 {
+		return nil
+	}
+
+	w := &auditAnchorWorker{stop: make(chan struct{}), done: make(chan struct{})}
+	go func() {
+		defer close(w.done)
+
+		ticker := time.NewTicker(auditAnchorInterval)
+		defer ticker.Stop()
+		for {
+			ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+			if err := anchorAuditChainUsecase(ctx, store); err != nil {
+				slog.ErrorContext(ctx, "worker error", "code", "183", "error", err)
+			}
+			cancel()
+
+			select {
+			case <-w.stop:
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+
+	return w
+}
+
+// wait for the running anchor
+func (w *auditAnchorWorker) Stop(ctx context.Context) {
+	close(w.stop)
+
+	select {
+	case <-w.done:
+	case <-ctx.Done():
+		slog.ErrorContext(ctx, "worker error", "code", "184", "error", "shutdown timeout, audit anchor still running")
+	}
+}
+
+// =========== REPOSITORY LAYER, ABSTRACTION OVER THE DATA PERSISTENCE (databases, file systems, or external APIs) ===========
+
+// chained entries after afterID oldest first, at most limit
+func (r *sqlUserRepository) FindAuditChain(ctx context.Context, afterID int64, limit int) ([]AuditEntry, error) {
+	ctx, done := r.observe(ctx, "findAuditChain")
+	defer done()
+
+	rows, err := r.query(ctx, "SELECT "+auditEntryColumns+" FROM audit_log WHERE hash IS NOT NULL AND id > ? ORDER BY id LIMIT ?", afterID, limit)
+	if err != nil {
+		slog.ErrorContext(ctx, "handler error", "code", "185", "error", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	entries, err := scanAuditEntries(rows)
+	if err != nil {
+		slog.ErrorContext(ctx, "handler error", "code", "185", "error", err)
+		return nil, err
+	}
+
+	return entries, nil
+}
+
+// last chained entry, nil when the chain is empty
+func (r *sqlUserRepository) FindAuditChainHead(ctx context.Context) (*AuditEntry, error) {
+	ctx, done := r.observe(ctx, "findAuditChainHead")
+	defer done()
+
+	rows, err := r.query(ctx, "SELECT "+auditEntryColumns+" FROM audit_log WHERE hash IS NOT NULL ORDER BY id DESC LIMIT 1")
+	if err != nil {
+		slog.ErrorContext(ctx, "handler error", "code", "186", "error", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	entries, err := scanAuditEntries(rows)
+	if err != nil {
+		slog.ErrorContext(ctx, "handler error", "code", "186", "error", err)
+		return nil, err
+	}
+	if len(entries) == 0 {
+		return nil, nil
+	}
+
+	return &entries[0], nil
+}
+
+// every anchor oldest first
+func (r *sqlUserRepository) FindAuditAnchors(ctx context.Context) ([]AuditAnchor, error) {
+	ctx, done := r.observe(ctx, "findAuditAnchors")
+	defer done()
+
+	rows, err := r.query(ctx, "SELECT id, entry_id, hash, location, created_at FROM audit_anchors ORDER BY entry_id")
+	if err != nil {
+		slog.ErrorContext(ctx, "handler error", "code", "187", "error", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	anchors := []AuditAnchor{}
+	for rows.Next() {
+		var anchor AuditAnchor
+		if err := rows.Scan(&anchor.ID, &anchor.EntryID, &anchor.Hash, &anchor.Location, &anchor.CreatedAt); err != nil {
+			slog.ErrorContext(ctx, "handler error", "code", "187", "error", err)
+			return nil, err
+		}
+		anchors = append(anchors, anchor)
+	}
+
+	return anchors, rows.Err()
+}
+
+// insert anchor setting its id, false when its entry is already anchored
+func (r *sqlUserRepository) CreateAuditAnchor(ctx context.Context, anchor *AuditAnchor) (bool, error) {
+	ctx, done := r.observe(ctx, "createAuditAnchor")
+	defer done()
+
+	err := r.insertRow(ctx, "INSERT INTO audit_anchors (entry_id, hash, location, created_at) VALUES (?, ?, ?, ?) ON CONFLICT DO NOTHING RETURNING id",
+		anchor.EntryID, anchor.Hash, anchor.Location, anchor.CreatedAt).Scan(&anchor.ID)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		slog.ErrorContext(ctx, "handler error", "code", "188", "error", err)
+		return false, err
+	}
+
+	return true, nil
+}
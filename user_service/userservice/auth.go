@@ -0,0 +1,146 @@
+package userservice
+
+import (
+	"context"
+	"crypto/subtle"
+	"database/sql"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"apperror"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"golang.org/x/crypto/bcrypt"
+)
+
+var (
+	// JWT_SECRET shared with public api to validate issued tokens
+	jwtSecret = []byte(cfg.String("JWT_SECRET", ""))
+	// JWT_TTL lifetime of issued tokens
+	jwtTTL = cfg.Duration("JWT_TTL", 24*time.Hour)
+	// INTERNAL_API_KEY shared secret required from callers, empty accept any caller
+	internalAPIKey = cfg.String("INTERNAL_API_KEY", "")
+)
+
+var errInvalidCredentials = errors.New("invalid credentials")
+
+type Login struct {
+	UserID   int    `json:"user_id" form:"user_id" binding:"required"`
+	Password string `json:"password" form:"password" binding:"required"`
+}
+
+// =========== MIDDLEWARE LAYER, RUN BEFORE INTERFACE HANDLER TO ENRICH OR GUARD THE REQUEST ===========
+
+// reject request without the shared api key on X-API-Key header
+func apiKeyMiddleware(key string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if key == "" {
+			c.Next()
+			return
+		}
+
+		if subtle.ConstantTimeCompare([]byte(c.GetHeader("X-API-Key")), []byte(key)) != 1 {
+			slog.ErrorContext(c.Request.Context(), "middleware error", "code", "020", "error", "invalid api key")
+			apperror.Abort(c, http.StatusUnauthorized, "Invalid API key")
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// =========== INTERFACE HANDLER, HANDLING REQUEST RESPONSE API DEPEND INTERFACE ===========
+
+// handler request response login, issue jwt for valid user id and password
+func loginHandler(c *gin.Context) {
+	var body Login
+	if err := c.ShouldBind(&body); err != nil {
+		slog.ErrorContext(c.Request.Context(), "handler error", "code", "015", "error", "Invalid body request")
+		apperror.RespondBinding(c, err)
+		return
+	}
+
+	token, expiresAt, err := loginUsecase(c.Request.Context(), body.UserID, body.Password)
+	if err != nil {
+		if errors.Is(err, errInvalidCredentials) {
+			apperror.JSON(c, http.StatusUnauthorized, "Invalid user ID or password")
+			return
+		}
+		apperror.Respond(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"result": true, "token": token, "expires_at": expiresAt})
+}
+
+// =========== USECASE LAYER, SERVES AS AN INTERMEDIARY BETWEEN THE PRESENTATION LAYER AND THE DATA LAYER ===========
+
+// check password against stored hash and sign token with user id as subject
+func loginUsecase(ctx context.Context, userID int, password string) (string, int64, error) {
+	if len(jwtSecret) == 0 {
+		slog.ErrorContext(ctx, "usecase error", "code", "016", "error", "JWT_SECRET is not set")
+		return "", 0, errors.New("config error: jwt secret not set")
+	}
+
+	hash, err := repo.FindPasswordHashByID(ctx, userID)
+	if err != nil {
+		if errors.Is(err, errUserNotFound) {
+			return "", 0, errInvalidCredentials
+		}
+		return "", 0, errors.New("database error: get user credentials error database")
+	}
+
+	// users created before passwords existed can not login
+	if hash == "" || bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) != nil {
+		return "", 0, errInvalidCredentials
+	}
+
+	now := time.Now()
+	expiresAt := now.Add(jwtTTL)
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.RegisteredClaims{
+		Subject:   strconv.Itoa(userID),
+		IssuedAt:  jwt.NewNumericDate(now),
+		ExpiresAt: jwt.NewNumericDate(expiresAt),
+	}).SignedString(jwtSecret)
+	if err != nil {
+		slog.ErrorContext(ctx, "usecase error", "code", "017", "error", err)
+		return "", 0, err
+	}
+
+	return token, expiresAt.Unix(), nil
+}
+
+// hash password before storing
+func hashPassword(password string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return "", err
+	}
+
+	return string(hash), nil
+}
+
+// =========== REPOSITORY LAYER, ABSTRACTION OVER THE DATA PERSISTENCE (databases, file systems, or external APIs) ===========
+
+// Function to get password hash of user, empty when user has no password
+func (r *sqlUserRepository) FindPasswordHashByID(ctx context.Context, id int) (string, error) {
+	ctx, done := r.observe(ctx, "findPasswordHashByID")
+	defer done()
+
+	var hash sql.NullString
+	err := r.queryRowPrepared(ctx, "SELECT password_hash FROM users WHERE id = ? AND deleted_at IS NULL", id).Scan(&hash)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return "", errUserNotFound
+		}
+
+		slog.ErrorContext(ctx, "handler error", "code", "018", "error", err)
+		return "", err
+	}
+
+	return hash.String, nil
+}
@@ -0,0 +1,241 @@
+package userservice
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"apperror"
+
+	"github.com/gin-gonic/gin"
+)
+
+// user blocked by another user, blocked users can not contact the user who blocked them
+type Block struct {
+	UserID        int   `json:"user_id"`
+	BlockedUserID int   `json:"blocked_user_id"`
+	CreatedAt     int64 `json:"created_at"`
+}
+
+type BlockCreate struct {
+	BlockedUserID int `json:"blocked_user_id" form:"blocked_user_id" binding:"required"`
+}
+
+var errBlockSelf = apperror.Validation("users can not block themselves")
+
+// =========== INTERFACE HANDLER, HANDLING REQUEST RESPONSE API DEPEND INTERFACE ===========
+
+// handler request response users blocked by the user
+func getUserBlocksHandler(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "handler error", "code", "047", "error", "Invalid user ID")
+		apperror.JSON(c, http.StatusBadRequest, "Invalid user ID")
+		return
+	}
+
+	blocks, err := getUserBlocksUsecase(c.Request.Context(), id)
+	if err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"result": true, "blocks": blocks})
+}
+
+// handler request response users who blocked the user, only reachable by operators since the public api does not
+// expose it, for moderation of users blocked by many others
+func getUserBlockedByHandler(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "handler error", "code", "048", "error", "Invalid user ID")
+		apperror.JSON(c, http.StatusBadRequest, "Invalid user ID")
+		return
+	}
+
+	blocks, err := getUserBlockedByUsecase(c.Request.Context(), id)
+	if err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"result": true, "blocked_by": blocks})
+}
+
+// handler request response block user, blocking again keeps the first block
+func blockUserHandler(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "handler error", "code", "049", "error", "Invalid user ID")
+		apperror.JSON(c, http.StatusBadRequest, "Invalid user ID")
+		return
+	}
+
+	var body BlockCreate
+	if err := c.ShouldBind(&body); err != nil {
+		slog.ErrorContext(c.Request.Context(), "handler error", "code", "050", "error", "Invalid body request")
+		apperror.RespondBinding(c, err)
+		return
+	}
+
+	block, err := blockUserUsecase(c.Request.Context(), id, body.BlockedUserID)
+	if err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"result": true, "block": block})
+}
+
+// handler request response unblock user, unblocking a user who is not blocked succeeds
+func unblockUserHandler(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "handler error", "code", "051", "error", "Invalid user ID")
+		apperror.JSON(c, http.StatusBadRequest, "Invalid user ID")
+		return
+	}
+
+	blockedID, err := strconv.Atoi(c.Param("blocked_id"))
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "handler error", "code", "052", "error", "Invalid blocked user ID")
+		apperror.JSON(c, http.StatusBadRequest, "Invalid blocked user ID")
+		return
+	}
+
+	if err := unblockUserUsecase(c.Request.Context(), id, blockedID); err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"result": true})
+}
+
+// =========== USECASE LAYER, SERVES AS AN INTERMEDIARY BETWEEN THE PRESENTATION LAYER AND THE DATA LAYER ===========
+
+func getUserBlocksUsecase(ctx context.Context, userID int) ([]Block, error) {
+	blocks, err := repo.FindBlocksByUserID(ctx, userID)
+	if err != nil {
+		return nil, errors.New("database error: get blocks error database")
+	}
+
+	return blocks, nil
+}
+
+func getUserBlockedByUsecase(ctx context.Context, userID int) ([]Block, error) {
+	blocks, err := repo.FindBlocksByBlockedUserID(ctx, userID)
+	if err != nil {
+		return nil, errors.New("database error: get blocked by error database")
+	}
+
+	return blocks, nil
+}
+
+func blockUserUsecase(ctx context.Context, userID, blockedUserID int) (*Block, error) {
+	if userID == blockedUserID {
+		return nil, errBlockSelf
+	}
+
+	// blocks of deleted users are kept, they only matter while both users exist
+	for _, id := range []int{userID, blockedUserID} {
+		if _, err := repo.FindByID(ctx, id); err != nil {
+			if errors.Is(err, errUserNotFound) {
+				return nil, err
+			}
+			return nil, errors.New("database error: get user error database")
+		}
+	}
+
+	block, err := repo.CreateBlock(ctx, userID, blockedUserID)
+	if err != nil {
+		return nil, errors.New("database error: block user error database")
+	}
+
+	// audit trail for moderation
+	slog.InfoContext(ctx, "audit: user blocked", "user_id", userID, "blocked_user_id", blockedUserID)
+	return block, nil
+}
+
+func unblockUserUsecase(ctx context.Context, userID, blockedUserID int) error {
+	if err := repo.DeleteBlock(ctx, userID, blockedUserID); err != nil {
+		return errors.New("database error: unblock user error database")
+	}
+
+	slog.InfoContext(ctx, "audit: user unblocked", "user_id", userID, "blocked_user_id", blockedUserID)
+	return nil
+}
+
+// =========== REPOSITORY LAYER, ABSTRACTION OVER THE DATA PERSISTENCE (databases, file systems, or external APIs) ===========
+
+func (r *sqlUserRepository) FindBlocksByUserID(ctx context.Context, userID int) ([]Block, error) {
+	ctx, done := r.observe(ctx, "findBlocksByUserID")
+	defer done()
+
+	return r.findBlocks(ctx, "SELECT user_id, blocked_user_id, created_at FROM user_blocks WHERE user_id = ? ORDER BY created_at DESC", userID)
+}
+
+func (r *sqlUserRepository) FindBlocksByBlockedUserID(ctx context.Context, blockedUserID int) ([]Block, error) {
+	ctx, done := r.observe(ctx, "findBlocksByBlockedUserID")
+	defer done()
+
+	return r.findBlocks(ctx, "SELECT user_id, blocked_user_id, created_at FROM user_blocks WHERE blocked_user_id = ? ORDER BY created_at DESC", blockedUserID)
+}
+
+func (r *sqlUserRepository) findBlocks(ctx context.Context, query string, id int) ([]Block, error) {
+	rows, err := r.query(ctx, query, id)
+	if err != nil {
+		slog.ErrorContext(ctx, "handler error", "code", "053", "error", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	blocks := []Block{}
+	for rows.Next() {
+		var block Block
+		if err := rows.Scan(&block.UserID, &block.BlockedUserID, &block.CreatedAt); err != nil {
+			slog.ErrorContext(ctx, "handler error", "code", "054", "error", err)
+			return nil, err
+		}
+		blocks = append(blocks, block)
+	}
+
+	return blocks, rows.Err()
+}
+
+// record block, blocking again keeps the first block time
+func (r *sqlUserRepository) CreateBlock(ctx context.Context, userID, blockedUserID int) (*Block, error) {
+	ctx, done := r.observe(ctx, "createBlock")
+	defer done()
+
+	now := time.Now().UnixNano() / int64(time.Microsecond)
+	_, err := r.exec(ctx, "INSERT INTO user_blocks (user_id, blocked_user_id, created_at) VALUES (?, ?, ?) ON CONFLICT DO NOTHING", userID, blockedUserID, now)
+	if err != nil {
+		slog.ErrorContext(ctx, "handler error", "code", "055", "error", err)
+		return nil, err
+	}
+
+	var block Block
+	err = r.queryRow(ctx, "SELECT user_id, blocked_user_id, created_at FROM user_blocks WHERE user_id = ? AND blocked_user_id = ?", userID, blockedUserID).
+		Scan(&block.UserID, &block.BlockedUserID, &block.CreatedAt)
+	if err != nil {
+		slog.ErrorContext(ctx, "handler error", "code", "056", "error", err)
+		return nil, err
+	}
+
+	return &block, nil
+}
+
+func (r *sqlUserRepository) DeleteBlock(ctx context.Context, userID, blockedUserID int) error {
+	ctx, done := r.observe(ctx, "deleteBlock")
+	defer done()
+
+	if _, err := r.exec(ctx, "DELETE FROM user_blocks WHERE user_id = ? AND blocked_user_id = ?", userID, blockedUserID); err != nil {
+		slog.ErrorContext(ctx, "handler error", "code", "057", "error", err)
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,555 @@
+package userservice
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"apperror"
+
+	"github.com/gin-gonic/gin"
+)
+
+// users an announcement is sent to, every user when no filter is set and users matching all the filters set otherwise
+type BroadcastAudience struct {
+	UserIDs []int `json:"user_ids,omitempty" binding:"max=10000"`
+	// signed up at or after and before, unix microseconds
+	CreatedAfter  int64 `json:"created_after,omitempty" binding:"min=0"`
+	CreatedBefore int64 `json:"created_before,omitempty" binding:"min=0"`
+	// users with a valid push device of the platform
+	Platform string `json:"platform,omitempty" binding:"omitempty,oneof=fcm apns"`
+}
+
+// announcement sent by operators to the users of its audience through their notification channels. status is
+// scheduled until scheduled_at, sending while its recipients are handed out, then sent or cancelled
+type Broadcast struct {
+	ID          int               `json:"id"`
+	Title       string            `json:"title"`
+	Body        string            `json:"body"`
+	Audience    BroadcastAudience `json:"audience"`
+	Status      string            `json:"status"`
+	ScheduledAt int64             `json:"scheduled_at"`
+	// users handed out so far and the outcome reported for them
+	Recipients int    `json:"recipients"`
+	Sent       int    `json:"sent"`
+	Failed     int    `json:"failed"`
+	Muted      int    `json:"muted"`
+	CreatedAt  int64  `json:"created_at"`
+	UpdatedAt  int64  `json:"updated_at"`
+	StartedAt  *int64 `json:"started_at"`
+	FinishedAt *int64 `json:"finished_at"`
+}
+
+type BroadcastCreate struct {
+	Title    string            `json:"title" binding:"required,notblank,max=200"`
+	Body     string            `json:"body" binding:"required,notblank,max=2000"`
+	Audience BroadcastAudience `json:"audience"`
+	// unix microseconds, now when zero or past
+	ScheduledAt int64 `json:"scheduled_at" binding:"min=0"`
+}
+
+// next recipients of the due broadcast, the broadcast is nil when none is due
+type BroadcastBatch struct {
+	Broadcast *Broadcast `json:"broadcast"`
+	UserIDs   []int      `json:"user_ids"`
+}
+
+type BroadcastClaim struct {
+	Limit int `json:"limit" binding:"required,min=1,max=1000"`
+}
+
+// outcome of a batch of recipients, added to the counts of the broadcast
+type BroadcastStats struct {
+	Sent   int `json:"sent" binding:"min=0"`
+	Failed int `json:"failed" binding:"min=0"`
+	Muted  int `json:"muted" binding:"min=0"`
+}
+
+var (
+	errBroadcastNotFound = apperror.NotFound("Broadcast not found")
+	errBroadcastFinished = apperror.Conflict("broadcast already sent or cancelled")
+	errBroadcastAudience = apperror.Validation("created_after must be before created_before")
+	errBroadcastsLimit   = apperror.Validation("limit must be between 1 and 200")
+)
+
+// =========== INTERFACE HANDLER, HANDLING REQUEST RESPONSE API DEPEND INTERFACE ===========
+
+// handler request response broadcasts newest first
+func getBroadcastsHandler(c *gin.Context) {
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "50"))
+	if err != nil {
+		apperror.Respond(c, errBroadcastsLimit)
+		return
+	}
+
+	broadcasts, err := getBroadcastsUsecase(c.Request.Context(), limit)
+	if err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"result": true, "broadcasts": broadcasts})
+}
+
+// handler request response schedule broadcast with the number of users its audience has now
+func createBroadcastHandler(c *gin.Context) {
+	var body BroadcastCreate
+	if err := c.ShouldBindJSON(&body); err != nil {
+		slog.ErrorContext(c.Request.Context(), "handler error", "code", "118", "error", err)
+		apperror.RespondBinding(c, err)
+		return
+	}
+
+	broadcast, audienceCount, err := createBroadcastUsecase(c.Request.Context(), body)
+	if err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"result": true, "broadcast": broadcast, "audience_count": audienceCount})
+}
+
+// handler request response number of users of an audience, to preview it before scheduling
+func countBroadcastAudienceHandler(c *gin.Context) {
+	var body BroadcastAudience
+	if err := c.ShouldBindJSON(&body); err != nil {
+		slog.ErrorContext(c.Request.Context(), "handler error", "code", "119", "error", err)
+		apperror.RespondBinding(c, err)
+		return
+	}
+
+	count, err := countBroadcastAudienceUsecase(c.Request.Context(), body)
+	if err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"result": true, "audience_count": count})
+}
+
+func getBroadcastHandler(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "handler error", "code", "120", "error", "Invalid broadcast ID")
+		apperror.JSON(c, http.StatusBadRequest, "Invalid broadcast ID")
+		return
+	}
+
+	broadcast, err := getBroadcastUsecase(c.Request.Context(), id)
+	if err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"result": true, "broadcast": broadcast})
+}
+
+// handler request response cancel broadcast, recipients already handed out still get it
+func cancelBroadcastHandler(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "handler error", "code", "121", "error", "Invalid broadcast ID")
+		apperror.JSON(c, http.StatusBadRequest, "Invalid broadcast ID")
+		return
+	}
+
+	broadcast, err := cancelBroadcastUsecase(c.Request.Context(), id)
+	if err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"result": true, "broadcast": broadcast})
+}
+
+// handler request response hand out the next recipients of the due broadcast, each once
+func claimBroadcastRecipientsHandler(c *gin.Context) {
+	var body BroadcastClaim
+	if err := c.ShouldBindJSON(&body); err != nil {
+		slog.ErrorContext(c.Request.Context(), "handler error", "code", "122", "error", err)
+		apperror.RespondBinding(c, err)
+		return
+	}
+
+	batch, err := claimBroadcastRecipientsUsecase(c.Request.Context(), body.Limit)
+	if err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"result": true, "broadcast": batch.Broadcast, "user_ids": batch.UserIDs})
+}
+
+// handler request response add the outcome of a batch to the counts of the broadcast
+func recordBroadcastStatsHandler(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "handler error", "code", "123", "error", "Invalid broadcast ID")
+		apperror.JSON(c, http.StatusBadRequest, "Invalid broadcast ID")
+		return
+	}
+
+	var body BroadcastStats
+	if err := c.ShouldBindJSON(&body); err != nil {
+		slog.ErrorContext(c.Request.Context(), "handler error", "code", "124", "error", err)
+		apperror.RespondBinding(c, err)
+		return
+	}
+
+	if err := recordBroadcastStatsUsecase(c.Request.Context(), id, body); err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"result": true})
+}
+
+// =========== USECASE LAYER, SERVES AS AN INTERMEDIARY BETWEEN THE PRESENTATION LAYER AND THE DATA LAYER ===========
+
+func getBroadcastsUsecase(ctx context.Context, limit int) ([]Broadcast, error) {
+	if limit < 1 || limit > 200 {
+		return nil, errBroadcastsLimit
+	}
+
+	broadcasts, err := repo.FindBroadcasts(ctx, limit)
+	if err != nil {
+		return nil, errors.New("database error: get broadcasts error database")
+	}
+
+	return broadcasts, nil
+}
+
+func createBroadcastUsecase(ctx context.Context, body BroadcastCreate) (*Broadcast, int, error) {
+	count, err := countBroadcastAudienceUsecase(ctx, body.Audience)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	now := time.Now().UnixMicro()
+	broadcast := &Broadcast{
+		Title:       body.Title,
+		Body:        body.Body,
+		Audience:    body.Audience,
+		Status:      "scheduled",
+		ScheduledAt: max(body.ScheduledAt, now),
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}
+	if err := repo.CreateBroadcast(ctx, broadcast); err != nil {
+		return nil, 0, errors.New("database error: create broadcast error database")
+	}
+
+	slog.InfoContext(ctx, "broadcast scheduled", "broadcast_id", broadcast.ID, "scheduled_at", broadcast.ScheduledAt, "audience_count", count)
+	return broadcast, count, nil
+}
+
+func countBroadcastAudienceUsecase(ctx context.Context, audience BroadcastAudience) (int, error) {
+	if audience.CreatedAfter > 0 && audience.CreatedBefore > 0 && audience.CreatedAfter >= audience.CreatedBefore {
+		return 0, errBroadcastAudience
+	}
+
+	count, err := repo.CountBroadcastAudience(ctx, audience)
+	if err != nil {
+		return 0, errors.New("database error: count audience error database")
+	}
+
+	return count, nil
+}
+
+func getBroadcastUsecase(ctx context.Context, id int) (*Broadcast, error) {
+	broadcast, err := repo.FindBroadcastByID(ctx, id)
+	if err != nil {
+		if errors.Is(err, errBroadcastNotFound) {
+			return nil, err
+		}
+		return nil, errors.New("database error: get broadcast error database")
+	}
+
+	return broadcast, nil
+}
+
+func cancelBroadcastUsecase(ctx context.Context, id int) (*Broadcast, error) {
+	cancelled, err := repo.CancelBroadcast(ctx, id, time.Now().UnixMicro())
+	if err != nil {
+		return nil, errors.New("database error: cancel broadcast error database")
+	}
+
+	broadcast, err := getBroadcastUsecase(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if !cancelled {
+		return nil, errBroadcastFinished
+	}
+
+	slog.InfoContext(ctx, "broadcast cancelled", "broadcast_id", id, "recipients", broadcast.Recipients)
+	return broadcast, nil
+}
+
+func claimBroadcastRecipientsUsecase(ctx context.Context, limit int) (*BroadcastBatch, error) {
+	batch, err := repo.ClaimBroadcastRecipients(ctx, limit, time.Now().UnixMicro())
+	if err != nil {
+		return nil, errors.New("database error: claim broadcast recipients error database")
+	}
+
+	return batch, nil
+}
+
+func recordBroadcastStatsUsecase(ctx context.Context, id int, stats BroadcastStats) error {
+	if err := repo.AddBroadcastStats(ctx, id, stats, time.Now().UnixMicro()); err != nil {
+		if errors.Is(err, errBroadcastNotFound) {
+			return err
+		}
+		return errors.New("database error: record broadcast stats error database")
+	}
+
+	return nil
+}
+
+// =========== REPOSITORY LAYER, ABSTRACTION OVER THE DATA PERSISTENCE (databases, file systems, or external APIs) ===========
+
+const broadcastColumns = "id, title, body, audience, status, scheduled_at, recipients, sent, failed, muted, created_at, updated_at, started_at, finished_at"
+
+func scanBroadcast(row interface{ Scan(...any) error }, broadcast *Broadcast) error {
+	var audience string
+	var startedAt, finishedAt sql.NullInt64
+	err := row.Scan(&broadcast.ID, &broadcast.Title, &broadcast.Body, &audience, &broadcast.Status, &broadcast.ScheduledAt,
+		&broadcast.Recipients, &broadcast.Sent, &broadcast.Failed, &broadcast.Muted, &broadcast.CreatedAt, &broadcast.UpdatedAt, &startedAt, &finishedAt)
+	if err != nil {
+		return err
+	}
+	if startedAt.Valid {
+		broadcast.StartedAt = &startedAt.Int64
+	}
+	if finishedAt.Valid {
+		broadcast.FinishedAt = &finishedAt.Int64
+	}
+	return json.Unmarshal([]byte(audience), &broadcast.Audience)
+}
+
+// where clause of the users of audience, deleted users are never part of it
+func broadcastAudienceWhere(audience BroadcastAudience) (string, []any) {
+	where := []string{"deleted_at IS NULL"}
+	var args []any
+	if len(audience.UserIDs) > 0 {
+		where = append(where, "id IN (?"+strings.Repeat(", ?", len(audience.UserIDs)-1)+")")
+		for _, id := range audience.UserIDs {
+			args = append(args, id)
+		}
+	}
+	if audience.CreatedAfter > 0 {
+		where = append(where, "created_at >= ?")
+		args = append(args, audience.CreatedAfter)
+	}
+	if audience.CreatedBefore > 0 {
+		where = append(where, "created_at < ?")
+		args = append(args, audience.CreatedBefore)
+	}
+	if audience.Platform != "" {
+		where = append(where, "id IN (SELECT user_id FROM push_devices WHERE platform = ? AND invalidated_at IS NULL)")
+		args = append(args, audience.Platform)
+	}
+	return strings.Join(where, " AND "), args
+}
+
+// latest broadcasts first
+func (r *sqlUserRepository) FindBroadcasts(ctx context.Context, limit int) ([]Broadcast, error) {
+	ctx, done := r.observe(ctx, "findBroadcasts")
+	defer done()
+
+	rows, err := r.query(ctx, "SELECT "+broadcastColumns+" FROM broadcasts ORDER BY id DESC LIMIT ?", limit)
+	if err != nil {
+		slog.ErrorContext(ctx, "handler error", "code", "125", "error", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	broadcasts := []Broadcast{}
+	for rows.Next() {
+		var broadcast Broadcast
+		if err := scanBroadcast(rows, &broadcast); err != nil {
+			slog.ErrorContext(ctx, "handler error", "code", "125", "error", err)
+			return nil, err
+		}
+		broadcasts = append(broadcasts, broadcast)
+	}
+
+	return broadcasts, rows.Err()
+}
+
+func (r *sqlUserRepository) FindBroadcastByID(ctx context.Context, id int) (*Broadcast, error) {
+	ctx, done := r.observe(ctx, "findBroadcastByID")
+	defer done()
+
+	var broadcast Broadcast
+	err := scanBroadcast(r.queryRow(ctx, "SELECT "+broadcastColumns+" FROM broadcasts WHERE id = ?", id), &broadcast)
+	if err == sql.ErrNoRows {
+		return nil, errBroadcastNotFound
+	}
+	if err != nil {
+		slog.ErrorContext(ctx, "handler error", "code", "126", "error", err)
+		return nil, err
+	}
+
+	return &broadcast, nil
+}
+
+// insert broadcast setting its id
+func (r *sqlUserRepository) CreateBroadcast(ctx context.Context, broadcast *Broadcast) error {
+	ctx, done := r.observe(ctx, "createBroadcast")
+	defer done()
+
+	audience, err := json.Marshal(broadcast.Audience)
+	if err != nil {
+		return err
+	}
+
+	err = r.insertRow(ctx, "INSERT INTO broadcasts (title, body, audience, status, scheduled_at, created_at, updated_at) VALUES (?, ?, ?, ?, ?, ?, ?) RETURNING id",
+		broadcast.Title, broadcast.Body, string(audience), broadcast.Status, broadcast.ScheduledAt, broadcast.CreatedAt, broadcast.UpdatedAt).Scan(&broadcast.ID)
+	if err != nil {
+		slog.ErrorContext(ctx, "handler error", "code", "127", "error", err)
+		return err
+	}
+
+	return nil
+}
+
+func (r *sqlUserRepository) CountBroadcastAudience(ctx context.Context, audience BroadcastAudience) (int, error) {
+	ctx, done := r.observe(ctx, "countBroadcastAudience")
+	defer done()
+
+	where, args := broadcastAudienceWhere(audience)
+	var count int
+	if err := r.queryRow(ctx, "SELECT COUNT(*) FROM users WHERE "+where, args...).Scan(&count); err != nil {
+		slog.ErrorContext(ctx, "handler error", "code", "128", "error", err)
+		return 0, err
+	}
+
+	return count, nil
+}
+
+// cancel broadcast still scheduled or sending, false when it does not exist or already finished
+func (r *sqlUserRepository) CancelBroadcast(ctx context.Context, id int, now int64) (bool, error) {
+	ctx, done := r.observe(ctx, "cancelBroadcast")
+	defer done()
+
+	result, err := r.exec(ctx, "UPDATE broadcasts SET status = 'cancelled', finished_at = ?, updated_at = ? WHERE id = ? AND status IN ('scheduled', 'sending')", now, now, id)
+	if err != nil {
+		slog.ErrorContext(ctx, "handler error", "code", "129", "error", err)
+		return false, err
+	}
+
+	cancelled, err := result.RowsAffected()
+	if err != nil {
+		slog.ErrorContext(ctx, "handler error", "code", "129", "error", err)
+		return false, err
+	}
+
+	return cancelled > 0, nil
+}
+
+// hand out the next limit users of the broadcast due first after the last user handed out, a short batch finishes
+// the broadcast. The last user handed out only moves when it was not moved meanwhile, so concurrent claims never get the
+// same users and the loser gets an empty batch
+func (r *sqlUserRepository) ClaimBroadcastRecipients(ctx context.Context, limit int, now int64) (*BroadcastBatch, error) {
+	ctx, done := r.observe(ctx, "claimBroadcastRecipients")
+	defer done()
+
+	batch := &BroadcastBatch{UserIDs: []int{}}
+	err := r.withTx(ctx, func(tx *sql.Tx) error {
+		var id, lastUserID int
+		err := tx.QueryRowContext(ctx, r.rebind("SELECT id, last_user_id FROM broadcasts WHERE status IN ('scheduled', 'sending') AND scheduled_at <= ? ORDER BY scheduled_at, id LIMIT 1"), now).
+			Scan(&id, &lastUserID)
+		if err == sql.ErrNoRows {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		var broadcast Broadcast
+		if err := scanBroadcast(tx.QueryRowContext(ctx, r.rebind("SELECT "+broadcastColumns+" FROM broadcasts WHERE id = ?"), id), &broadcast); err != nil {
+			return err
+		}
+
+		where, args := broadcastAudienceWhere(broadcast.Audience)
+		rows, err := tx.QueryContext(ctx, r.rebind("SELECT id FROM users WHERE "+where+" AND id > ? ORDER BY id LIMIT ?"), append(args, lastUserID, limit)...)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var id int
+			if err := rows.Scan(&id); err != nil {
+				return err
+			}
+			batch.UserIDs = append(batch.UserIDs, id)
+		}
+		if err := rows.Err(); err != nil {
+			return err
+		}
+
+		next := lastUserID
+		if len(batch.UserIDs) > 0 {
+			next = batch.UserIDs[len(batch.UserIDs)-1]
+		}
+		broadcast.Status = "sending"
+		var finishedAt *int64
+		if len(batch.UserIDs) < limit {
+			broadcast.Status, finishedAt = "sent", &now
+		}
+
+		result, err := tx.ExecContext(ctx, r.rebind("UPDATE broadcasts SET last_user_id = ?, recipients = recipients + ?, status = ?, started_at = COALESCE(started_at, ?), finished_at = ?, updated_at = ? WHERE id = ? AND last_user_id = ? AND status IN ('scheduled', 'sending')"),
+			next, len(batch.UserIDs), broadcast.Status, now, finishedAt, now, broadcast.ID, lastUserID)
+		if err != nil {
+			return err
+		}
+		if moved, err := result.RowsAffected(); err != nil || moved == 0 {
+			batch.UserIDs = []int{}
+			return err
+		}
+
+		broadcast.Recipients += len(batch.UserIDs)
+		broadcast.FinishedAt = finishedAt
+		if broadcast.StartedAt == nil {
+			broadcast.StartedAt = &now
+		}
+		batch.Broadcast = &broadcast
+		return nil
+	})
+	if err != nil {
+		slog.ErrorContext(ctx, "handler error", "code", "130", "error", err)
+		return nil, err
+	}
+
+	return batch, nil
+}
+
+func (r *sqlUserRepository) AddBroadcastStats(ctx context.Context, id int, stats BroadcastStats, now int64) error {
+	ctx, done := r.observe(ctx, "addBroadcastStats")
+	defer done()
+
+	result, err := r.exec(ctx, "UPDATE broadcasts SET sent = sent + ?, failed = failed + ?, muted = muted + ?, updated_at = ? WHERE id = ?",
+		stats.Sent, stats.Failed, stats.Muted, now, id)
+	if err != nil {
+		slog.ErrorContext(ctx, "handler error", "code", "131", "error", err)
+		return err
+	}
+
+	updated, err := result.RowsAffected()
+	if err != nil {
+		slog.ErrorContext(ctx, "handler error", "code", "131", "error", err)
+		return err
+	}
+	if updated == 0 {
+		return errBroadcastNotFound
+	}
+
+	return nil
+}
@@ -0,0 +1,144 @@
+package userservice
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"log"
+
+	"events"
+)
+
+// =========== REPOSITORY LAYER, CHANGE DATA CAPTURE OF THE USERS INTO THE OUTBOX ===========
+
+const (
+	eventSourceOutbox = "outbox"
+	eventSourceCDC    = "cdc"
+)
+
+// EVENT_SOURCE outbox writes the events of user writes in their transaction, cdc leaves the writes alone and turns
+// the changes of the users table into the same outbox events, see startChangeCapture
+var eventSource = cfg.String("EVENT_SOURCE", eventSourceOutbox)
+
+// columns of users in the changes, the password hash and the email stay out of them
+var userChangeColumns = []string{"id", "name", "role", "created_at", "updated_at", "deleted_at", "legal_hold"}
+
+// row of users as captured
+type userRow struct {
+	User
+	DeletedAt *int64 `json:"deleted_at"`
+	LegalHold int    `json:"legal_hold"`
+}
+
+// reader of the changes of users into the outbox with EVENT_SOURCE=cdc, nil otherwise. sqlite captures them with
+// triggers, postgres through the logical replication slot CDC_SLOT. See events.NewCDC for its settings
+func startChangeCapture(r *sqlUserRepository) *events.CDC {
+	ctx := context.Background()
+
+	switch eventSource {
+	case eventSourceOutbox:
+		// changes left unread when switching back stay in row_changes without events
+		if r.dialect.name == dialectSQLite {
+			for _, statement := range events.DropSQLiteChangeTriggers("users") {
+				if _, err := r.writer.ExecContext(ctx, statement); err != nil {
+					log.Fatal(err)
+				}
+			}
+		}
+		return nil
+	case eventSourceCDC:
+	default:
+		log.Fatalf("EVENT_SOURCE %q is neither %s nor %s", eventSource, eventSourceOutbox, eventSourceCDC)
+	}
+
+	var source events.ChangeSource
+	if r.dialect.name == dialectPostgres {
+		changes, err := events.NewPostgresChanges(ctx, r.writer, cfg.String("CDC_SLOT", "user_events"))
+		if err != nil {
+			log.Fatal(err)
+		}
+		source = changes
+	} else {
+		for _, statement := range events.SQLiteChangeTriggers("users", userChangeColumns) {
+			if _, err := r.writer.ExecContext(ctx, statement); err != nil {
+				log.Fatal(err)
+			}
+		}
+		source = events.NewSQLiteChanges(r.writer)
+	}
+
+	capture := events.NewCDC(cfg, "CDC", source, userChangeEvent, r.insertChangeEvents)
+	capture.Start()
+
+	return capture
+}
+
+// event of a change of users, the event the write puts in the outbox with EVENT_SOURCE=outbox. Legal holds and
+// writes of deleted users make none
+func userChangeEvent(change events.Change) (events.Event, bool, error) {
+	if change.Table != "users" {
+		return events.Event{}, false, nil
+	}
+
+	var before, after userRow
+	if err := decodeUserRow(change.Old, &before); err != nil {
+		return events.Event{}, false, err
+	}
+	if err := decodeUserRow(change.New, &after); err != nil {
+		return events.Event{}, false, err
+	}
+	// postgres sends every column of the row
+	before.Email, after.Email = "", ""
+
+	var event events.Event
+	var err error
+	switch {
+	case change.Op == events.ChangeInsert:
+		event, err = events.New(events.UserCreated, events.Key("user", after.ID), "", after.User)
+	case change.Op == events.ChangeDelete:
+		event, err = events.New(events.UserDeleted, events.Key("user", before.ID), "", events.Deleted{ID: before.ID})
+	case after.DeletedAt != nil && before.DeletedAt == nil:
+		event, err = events.New(events.UserDeleted, events.Key("user", after.ID), "", events.Deleted{ID: after.ID})
+	case after.DeletedAt != nil || after.LegalHold != before.LegalHold:
+		return events.Event{}, false, nil
+	default:
+		event, err = events.New(events.UserUpdated, events.Key("user", after.ID), "", after.User)
+	}
+	return event, err == nil, err
+}
+
+// columns of a change into row, left zero when the change has no such row
+func decodeUserRow(columns map[string]any, row *userRow) error {
+	if columns == nil {
+		return nil
+	}
+
+	body, err := json.Marshal(columns)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(body, row)
+}
+
+// write the events of the changes to the outbox, the events written by an earlier read of the same changes are skipped
+func (r *sqlUserRepository) insertChangeEvents(ctx context.Context, changeEvents []events.Event) error {
+	ctx, done := r.observe(ctx, "insertChangeEvents")
+	defer done()
+
+	return r.withTx(ctx, func(tx *sql.Tx) error {
+		for _, event := range changeEvents {
+			payload, err := json.Marshal(event)
+			if err != nil {
+				return err
+			}
+
+			_, err = tx.ExecContext(ctx, r.rebind(`INSERT INTO outbox (event_id, event_type, event_key, payload, next_attempt_at, created_at) VALUES (?, ?, ?, ?, ?, ?)
+				ON CONFLICT (event_id) DO NOTHING`),
+				event.ID, event.Type, event.Key, string(payload), event.OccurredAt, event.OccurredAt)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
@@ -0,0 +1,315 @@
+package userservice
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"apperror"
+
+	"github.com/gin-gonic/gin"
+)
+
+// published version of a policy document, the latest one per kind is current
+type PolicyVersion struct {
+	Kind        string `json:"kind"`
+	Version     string `json:"version"`
+	PublishedAt int64  `json:"published_at"`
+}
+
+// policy version published by an operator, or accepted by a user
+type PolicyVersionCreate struct {
+	Kind    string `json:"kind" form:"kind" binding:"required"`
+	Version string `json:"version" form:"version" binding:"required"`
+}
+
+type Consent struct {
+	UserID     int    `json:"user_id"`
+	Kind       string `json:"kind"`
+	Version    string `json:"version"`
+	AcceptedAt int64  `json:"accepted_at"`
+}
+
+// documents users have to accept
+var policyKinds = map[string]bool{"tos": true, "privacy": true}
+
+var (
+	errInvalidPolicyKind     = apperror.Validation("invalid kind, supported values: tos, privacy")
+	errPolicyVersionExists   = apperror.Conflict("policy version already published")
+	errPolicyVersionNotFound = apperror.Validation("policy version not published")
+)
+
+// =========== INTERFACE HANDLER, HANDLING REQUEST RESPONSE API DEPEND INTERFACE ===========
+
+// handler request response current policy versions
+func getCurrentPoliciesHandler(c *gin.Context) {
+	policies, err := getCurrentPoliciesUsecase(c.Request.Context())
+	if err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"result": true, "policies": policies})
+}
+
+// handler request response publish policy version, only reachable by operators since the public api does not expose it
+func publishPolicyHandler(c *gin.Context) {
+	var body PolicyVersionCreate
+	if err := c.ShouldBind(&body); err != nil {
+		slog.ErrorContext(c.Request.Context(), "handler error", "code", "028", "error", "Invalid body request")
+		apperror.RespondBinding(c, err)
+		return
+	}
+
+	policy, err := publishPolicyUsecase(c.Request.Context(), body.Kind, body.Version)
+	if err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"result": true, "policy": policy})
+}
+
+// handler request response accepted policies and current versions still to accept
+func getUserConsentsHandler(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "handler error", "code", "029", "error", "Invalid user ID")
+		apperror.JSON(c, http.StatusBadRequest, "Invalid user ID")
+		return
+	}
+
+	consents, pending, err := getUserConsentsUsecase(c.Request.Context(), id)
+	if err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"result": true, "consents": consents, "pending": pending})
+}
+
+// handler request response accept policy version
+func acceptPolicyHandler(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "handler error", "code", "030", "error", "Invalid user ID")
+		apperror.JSON(c, http.StatusBadRequest, "Invalid user ID")
+		return
+	}
+
+	var body PolicyVersionCreate
+	if err := c.ShouldBind(&body); err != nil {
+		slog.ErrorContext(c.Request.Context(), "handler error", "code", "031", "error", "Invalid body request")
+		apperror.RespondBinding(c, err)
+		return
+	}
+
+	consent, err := acceptPolicyUsecase(c.Request.Context(), id, body.Kind, body.Version)
+	if err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"result": true, "consent": consent})
+}
+
+// =========== USECASE LAYER, SERVES AS AN INTERMEDIARY BETWEEN THE PRESENTATION LAYER AND THE DATA LAYER ===========
+
+func getCurrentPoliciesUsecase(ctx context.Context) ([]PolicyVersion, error) {
+	policies, err := repo.FindCurrentPolicies(ctx)
+	if err != nil {
+		return nil, errors.New("database error: get current policies error database")
+	}
+
+	return policies, nil
+}
+
+// publish new version, users have to accept it before their next write
+func publishPolicyUsecase(ctx context.Context, kind, version string) (*PolicyVersion, error) {
+	if !policyKinds[kind] {
+		return nil, errInvalidPolicyKind
+	}
+
+	policy, err := repo.CreatePolicyVersion(ctx, kind, strings.TrimSpace(version))
+	if err != nil {
+		if errors.Is(err, errPolicyVersionExists) {
+			return nil, err
+		}
+		return nil, errors.New("database error: publish policy error database")
+	}
+
+	slog.InfoContext(ctx, "audit: policy version published", "kind", policy.Kind, "version", policy.Version)
+	return policy, nil
+}
+
+// consents of user and current versions not accepted yet
+func getUserConsentsUsecase(ctx context.Context, userID int) ([]Consent, []PolicyVersion, error) {
+	if _, err := repo.FindByID(ctx, userID); err != nil {
+		if errors.Is(err, errUserNotFound) {
+			return nil, nil, err
+		}
+		return nil, nil, errors.New("database error: get user error database")
+	}
+
+	consents, err := repo.FindConsentsByUserID(ctx, userID)
+	if err != nil {
+		return nil, nil, errors.New("database error: get consents error database")
+	}
+
+	current, err := repo.FindCurrentPolicies(ctx)
+	if err != nil {
+		return nil, nil, errors.New("database error: get current policies error database")
+	}
+
+	accepted := map[string]bool{}
+	for _, consent := range consents {
+		accepted[consent.Kind+"/"+consent.Version] = true
+	}
+
+	pending := []PolicyVersion{}
+	for _, policy := range current {
+		if !accepted[policy.Kind+"/"+policy.Version] {
+			pending = append(pending, policy)
+		}
+	}
+
+	return consents, pending, nil
+}
+
+func acceptPolicyUsecase(ctx context.Context, userID int, kind, version string) (*Consent, error) {
+	if !policyKinds[kind] {
+		return nil, errInvalidPolicyKind
+	}
+
+	if _, err := repo.FindByID(ctx, userID); err != nil {
+		if errors.Is(err, errUserNotFound) {
+			return nil, err
+		}
+		return nil, errors.New("database error: get user error database")
+	}
+
+	consent, err := repo.CreateConsent(ctx, userID, kind, version)
+	if err != nil {
+		if errors.Is(err, errPolicyVersionNotFound) {
+			return nil, err
+		}
+		return nil, errors.New("database error: accept policy error database")
+	}
+
+	return consent, nil
+}
+
+// =========== REPOSITORY LAYER, ABSTRACTION OVER THE DATA PERSISTENCE (databases, file systems, or external APIs) ===========
+
+// latest published version of every kind
+func (r *sqlUserRepository) FindCurrentPolicies(ctx context.Context) ([]PolicyVersion, error) {
+	ctx, done := r.observe(ctx, "findCurrentPolicies")
+	defer done()
+
+	rows, err := r.query(ctx, `SELECT kind, version, published_at FROM policy_versions p
+		WHERE published_at = (SELECT MAX(published_at) FROM policy_versions WHERE kind = p.kind)
+		ORDER BY kind`)
+	if err != nil {
+		slog.ErrorContext(ctx, "handler error", "code", "032", "error", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	policies := []PolicyVersion{}
+	for rows.Next() {
+		var policy PolicyVersion
+		if err := rows.Scan(&policy.Kind, &policy.Version, &policy.PublishedAt); err != nil {
+			slog.ErrorContext(ctx, "handler error", "code", "033", "error", err)
+			return nil, err
+		}
+		policies = append(policies, policy)
+	}
+
+	return policies, rows.Err()
+}
+
+func (r *sqlUserRepository) CreatePolicyVersion(ctx context.Context, kind, version string) (*PolicyVersion, error) {
+	ctx, done := r.observe(ctx, "createPolicyVersion")
+	defer done()
+
+	now := time.Now().UnixNano() / int64(time.Microsecond)
+	result, err := r.exec(ctx, "INSERT INTO policy_versions (kind, version, published_at) VALUES (?, ?, ?) ON CONFLICT DO NOTHING", kind, version, now)
+	if err != nil {
+		slog.ErrorContext(ctx, "handler error", "code", "034", "error", err)
+		return nil, err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		slog.ErrorContext(ctx, "handler error", "code", "035", "error", err)
+		return nil, err
+	}
+
+	if affected == 0 {
+		return nil, errPolicyVersionExists
+	}
+
+	return &PolicyVersion{Kind: kind, Version: version, PublishedAt: now}, nil
+}
+
+func (r *sqlUserRepository) FindConsentsByUserID(ctx context.Context, userID int) ([]Consent, error) {
+	ctx, done := r.observe(ctx, "findConsentsByUserID")
+	defer done()
+
+	rows, err := r.query(ctx, "SELECT user_id, kind, version, accepted_at FROM user_consents WHERE user_id = ? ORDER BY accepted_at DESC", userID)
+	if err != nil {
+		slog.ErrorContext(ctx, "handler error", "code", "036", "error", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	consents := []Consent{}
+	for rows.Next() {
+		var consent Consent
+		if err := rows.Scan(&consent.UserID, &consent.Kind, &consent.Version, &consent.AcceptedAt); err != nil {
+			slog.ErrorContext(ctx, "handler error", "code", "037", "error", err)
+			return nil, err
+		}
+		consents = append(consents, consent)
+	}
+
+	return consents, rows.Err()
+}
+
+// record acceptance of a published version, accepting again keeps the first acceptance time
+func (r *sqlUserRepository) CreateConsent(ctx context.Context, userID int, kind, version string) (*Consent, error) {
+	ctx, done := r.observe(ctx, "createConsent")
+	defer done()
+
+	now := time.Now().UnixNano() / int64(time.Microsecond)
+	result, err := r.exec(ctx, `INSERT INTO user_consents (user_id, kind, version, accepted_at)
+		SELECT CAST(? AS BIGINT), kind, version, CAST(? AS BIGINT) FROM policy_versions WHERE kind = ? AND version = ?
+		ON CONFLICT DO NOTHING`, userID, now, kind, version)
+	if err != nil {
+		slog.ErrorContext(ctx, "handler error", "code", "038", "error", err)
+		return nil, err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		slog.ErrorContext(ctx, "handler error", "code", "039", "error", err)
+		return nil, err
+	}
+
+	if affected == 0 {
+		var consent Consent
+		err := r.queryRow(ctx, "SELECT user_id, kind, version, accepted_at FROM user_consents WHERE user_id = ? AND kind = ? AND version = ?", userID, kind, version).
+			Scan(&consent.UserID, &consent.Kind, &consent.Version, &consent.AcceptedAt)
+		if err != nil {
+			// nothing inserted and no previous acceptance, version is not published
+			return nil, errPolicyVersionNotFound
+		}
+		return &consent, nil
+	}
+
+	return &Consent{UserID: userID, Kind: kind, Version: version, AcceptedAt: now}, nil
+}
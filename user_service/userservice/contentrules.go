@@ -0,0 +1,205 @@
+package userservice
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"regexp"
+	"time"
+
+	"apperror"
+
+	"github.com/gin-gonic/gin"
+)
+
+// spam or scam rule the public API checks listings and offer messages against, it parses and validates Params by
+// Kind. A block rule refuses the content, a flag rule lets it through and logs the hit
+type ContentRule struct {
+	Name    string          `json:"name"`
+	Kind    string          `json:"kind"`
+	Action  string          `json:"action"`
+	Params  json.RawMessage `json:"params"`
+	Enabled bool            `json:"enabled"`
+	// admin who saved the rule last, 0 for an operator holding the internal api key
+	UpdatedBy int   `json:"updated_by"`
+	UpdatedAt int64 `json:"updated_at"`
+}
+
+// rule saved under the name of the path, replacing the rule of that name
+type ContentRuleSave struct {
+	Kind      string          `json:"kind" binding:"required,oneof=keywords url_count repeated_chars price_floor"`
+	Action    string          `json:"action" binding:"required,oneof=flag block"`
+	Params    json.RawMessage `json:"params" binding:"required"`
+	Enabled   *bool           `json:"enabled" binding:"required"`
+	UpdatedBy int             `json:"updated_by" binding:"min=0"`
+}
+
+var (
+	errContentRuleNotFound = apperror.NotFound("Content rule not found")
+	errContentRuleName     = apperror.Validation("name must be 1 to 64 lowercase letters, digits, _ or -")
+)
+
+var contentRuleName = regexp.MustCompile(`^[a-z0-9_-]{1,64}$`)
+
+// =========== INTERFACE HANDLER, HANDLING REQUEST RESPONSE API DEPEND INTERFACE ===========
+
+// handler request response every rule, enabled or not
+func getContentRulesHandler(c *gin.Context) {
+	rules, err := getContentRulesUsecase(c.Request.Context())
+	if err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"result": true, "rules": rules})
+}
+
+// handler request response create or replace a rule
+func saveContentRuleHandler(c *gin.Context) {
+	var body ContentRuleSave
+	if err := c.ShouldBindJSON(&body); err != nil {
+		slog.ErrorContext(c.Request.Context(), "handler error", "code", "189", "error", err)
+		apperror.RespondBinding(c, err)
+		return
+	}
+
+	rule, err := saveContentRuleUsecase(c.Request.Context(), c.Param("name"), body)
+	if err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"result": true, "rule": rule})
+}
+
+// handler request response delete a rule
+func deleteContentRuleHandler(c *gin.Context) {
+	if err := deleteContentRuleUsecase(c.Request.Context(), c.Param("name")); err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"result": true})
+}
+
+// =========== USECASE LAYER, SERVES AS AN INTERMEDIARY BETWEEN THE PRESENTATION LAYER AND THE DATA LAYER ===========
+
+func getContentRulesUsecase(ctx context.Context) ([]ContentRule, error) {
+	rules, err := repo.FindContentRules(ctx)
+	if err != nil {
+		return nil, errors.New("database error: get content rules error database")
+	}
+
+	return rules, nil
+}
+
+func saveContentRuleUsecase(ctx context.Context, name string, body ContentRuleSave) (*ContentRule, error) {
+	if !contentRuleName.MatchString(name) {
+		return nil, errContentRuleName
+	}
+
+	rule := &ContentRule{
+		Name:      name,
+		Kind:      body.Kind,
+		Action:    body.Action,
+		Params:    body.Params,
+		Enabled:   *body.Enabled,
+		UpdatedBy: body.UpdatedBy,
+		UpdatedAt: time.Now().UnixMicro(),
+	}
+	if err := repo.SaveContentRule(ctx, rule); err != nil {
+		return nil, errors.New("database error: save content rule error database")
+	}
+
+	slog.InfoContext(ctx, "content rule saved", "name", rule.Name, "kind", rule.Kind, "action", rule.Action, "enabled", rule.Enabled,
+		"updated_by", rule.UpdatedBy)
+	return rule, nil
+}
+
+func deleteContentRuleUsecase(ctx context.Context, name string) error {
+	if err := repo.DeleteContentRule(ctx, name); err != nil {
+		if errors.Is(err, errContentRuleNotFound) {
+			return err
+		}
+		return errors.New("database error: delete content rule error database")
+	}
+
+	slog.InfoContext(ctx, "content rule deleted", "name", name)
+	return nil
+}
+
+// =========== REPOSITORY LAYER, ABSTRACTION OVER THE DATA PERSISTENCE (databases, file systems, or external APIs) ===========
+
+func (r *sqlUserRepository) FindContentRules(ctx context.Context) ([]ContentRule, error) {
+	ctx, done := r.observe(ctx, "findContentRules")
+	defer done()
+
+	rows, err := r.query(ctx, "SELECT name, kind, action, params, enabled, updated_by, updated_at FROM content_rules ORDER BY name")
+	if err != nil {
+		slog.ErrorContext(ctx, "handler error", "code", "190", "error", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	rules := []ContentRule{}
+	for rows.Next() {
+		var rule ContentRule
+		var params string
+		var enabled int
+		if err := rows.Scan(&rule.Name, &rule.Kind, &rule.Action, &params, &enabled, &rule.UpdatedBy, &rule.UpdatedAt); err != nil {
+			slog.ErrorContext(ctx, "handler error", "code", "190", "error", err)
+			return nil, err
+		}
+		rule.Params, rule.Enabled = json.RawMessage(params), enabled != 0
+		rules = append(rules, rule)
+	}
+
+	return rules, rows.Err()
+}
+
+// insert rule or replace the rule of its name
+func (r *sqlUserRepository) SaveContentRule(ctx context.Context, rule *ContentRule) error {
+	ctx, done := r.observe(ctx, "saveContentRule")
+	defer done()
+
+	// integer column, postgres does not take a bool for it
+	enabled := 0
+	if rule.Enabled {
+		enabled = 1
+	}
+
+	_, err := r.exec(ctx, `INSERT INTO content_rules (name, kind, action, params, enabled, updated_by, updated_at) VALUES (?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT (name) DO UPDATE SET kind = excluded.kind, action = excluded.action, params = excluded.params, enabled = excluded.enabled,
+		updated_by = excluded.updated_by, updated_at = excluded.updated_at`,
+		rule.Name, rule.Kind, rule.Action, string(rule.Params), enabled, rule.UpdatedBy, rule.UpdatedAt)
+	if err != nil {
+		slog.ErrorContext(ctx, "handler error", "code", "191", "error", err)
+		return err
+	}
+
+	return nil
+}
+
+func (r *sqlUserRepository) DeleteContentRule(ctx context.Context, name string) error {
+	ctx, done := r.observe(ctx, "deleteContentRule")
+	defer done()
+
+	result, err := r.exec(ctx, "DELETE FROM content_rules WHERE name = ?", name)
+	if err != nil {
+		slog.ErrorContext(ctx, "handler error", "code", "192", "error", err)
+		return err
+	}
+
+	deleted, err := result.RowsAffected()
+	if err != nil {
+		slog.ErrorContext(ctx, "handler error", "code", "192", "error", err)
+		return err
+	}
+	if deleted == 0 {
+		return errContentRuleNotFound
+	}
+
+	return nil
+}
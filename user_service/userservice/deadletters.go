@@ -0,0 +1,565 @@
+package userservice
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"apperror"
+	"events"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// queues of the dead letters, the outbox of the user events, the webhook deliveries and the outbox of the listing
+// service whose relay runs in the public API
+const (
+	DeadLetterUserEvents        = "user_events"
+	DeadLetterWebhookDeliveries = "webhook_deliveries"
+	DeadLetterListingEvents     = "listing_events"
+)
+
+var deadLetterSources = []string{DeadLetterUserEvents, DeadLetterWebhookDeliveries, DeadLetterListingEvents}
+
+// event or webhook delivery out of attempts, kept until an admin requeues or discards it. SourceID is its id in the
+// queue of Source
+type DeadLetter struct {
+	ID        int64        `json:"id"`
+	Source    string       `json:"source"`
+	SourceID  int64        `json:"source_id"`
+	EventKey  string       `json:"event_key"`
+	Event     events.Event `json:"event"`
+	Attempts  int          `json:"attempts"`
+	LastError string       `json:"last_error"`
+	CreatedAt int64        `json:"created_at"`
+	UpdatedAt int64        `json:"updated_at"`
+}
+
+// dead letter of a queue out of this service, the relays of the user service record theirs themselves
+type DeadLetterCreate struct {
+	Source    string       `json:"source" binding:"required,oneof=listing_events"`
+	SourceID  int64        `json:"source_id" binding:"required,min=1"`
+	EventKey  string       `json:"event_key" binding:"required,max=200"`
+	Event     events.Event `json:"event"`
+	Attempts  int          `json:"attempts" binding:"min=0"`
+	LastError string       `json:"last_error" binding:"max=2000"`
+}
+
+// edited event of a dead letter, published as is once requeued
+type DeadLetterUpdate struct {
+	Event events.Event `json:"event"`
+}
+
+var (
+	errDeadLetterNotFound = apperror.NotFound("Dead letter not found")
+	errDeadLetterPage     = apperror.Validation("page_num must be at least 1 and page_size between 1 and 100, source one of " +
+		strings.Join(deadLetterSources, ", "))
+	errDeadLetterEvent = apperror.Validation("event id must be the id of the dead letter, type one of " + strings.Join(events.Types, ", ") +
+		" and data a json value")
+	// the listing service outbox is requeued by the public API, which then discards the dead letter
+	errDeadLetterExternal = apperror.Conflict("dead letter of the listing service outbox, requeue it through the public API")
+	errDeadLetterGone     = apperror.Conflict("event of the dead letter no longer in its queue")
+)
+
+var (
+	// DEAD_LETTERS_ALERT_THRESHOLD dead letters of a queue from which every new one logs an error, 0 never
+	deadLetterAlertThreshold = cfg.Int("DEAD_LETTERS_ALERT_THRESHOLD", 100)
+
+	deadLettersTotal = metrics.NewCounterVec(prometheus.CounterOpts{
+		Name: "dead_letters_total",
+		Help: "Events and webhook deliveries given up after their last attempt, by source.",
+	}, []string{"source"})
+)
+
+func init() {
+	// counted on scrape so every instance reports the shared table
+	for _, source := range deadLetterSources {
+		metrics.NewGaugeFunc(prometheus.GaugeOpts{
+			Name:        "dead_letters",
+			Help:        "Dead letters waiting to be requeued or discarded, by source.",
+			ConstLabels: prometheus.Labels{"source": source},
+		}, func() float64 {
+			if repo == nil {
+				return 0
+			}
+
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			count, err := repo.CountDeadLetters(ctx, source)
+			if err != nil {
+				return 0
+			}
+			return float64(count)
+		})
+	}
+}
+
+// =========== INTERFACE HANDLER, HANDLING REQUEST RESPONSE API DEPEND INTERFACE ===========
+
+// handler request response dead letters newest first, source empty for all
+func getDeadLettersHandler(c *gin.Context) {
+	pageNum, errNum := strconv.Atoi(c.DefaultQuery("page_num", "1"))
+	pageSize, errSize := strconv.Atoi(c.DefaultQuery("page_size", "50"))
+	if errNum != nil || errSize != nil {
+		apperror.Respond(c, errDeadLetterPage)
+		return
+	}
+
+	letters, pagination, err := getDeadLettersUsecase(c.Request.Context(), c.Query("source"), pageNum, pageSize)
+	if err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"result": true, "dead_letters": letters, "pagination": pagination})
+}
+
+// handler request response record dead letter of the listing service outbox
+func createDeadLetterHandler(c *gin.Context) {
+	var body DeadLetterCreate
+	if err := c.ShouldBindJSON(&body); err != nil {
+		slog.ErrorContext(c.Request.Context(), "handler error", "code", "158", "error", err)
+		apperror.RespondBinding(c, err)
+		return
+	}
+
+	letter, err := createDeadLetterUsecase(c.Request.Context(), body)
+	if err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"result": true, "dead_letter": letter})
+}
+
+func getDeadLetterHandler(c *gin.Context) {
+	id, ok := deadLetterID(c)
+	if !ok {
+		return
+	}
+
+	letter, err := getDeadLetterUsecase(c.Request.Context(), id)
+	if err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"result": true, "dead_letter": letter})
+}
+
+// handler request response replace the event of a dead letter, e.g. to fix the data its consumers rejected
+func updateDeadLetterHandler(c *gin.Context) {
+	id, ok := deadLetterID(c)
+	if !ok {
+		return
+	}
+
+	var body DeadLetterUpdate
+	if err := c.ShouldBindJSON(&body); err != nil {
+		slog.ErrorContext(c.Request.Context(), "handler error", "code", "159", "error", err)
+		apperror.RespondBinding(c, err)
+		return
+	}
+
+	letter, err := updateDeadLetterUsecase(c.Request.Context(), id, body.Event)
+	if err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"result": true, "dead_letter": letter})
+}
+
+// handler request response put the event of a dead letter back in its queue with fresh attempts
+func requeueDeadLetterHandler(c *gin.Context) {
+	id, ok := deadLetterID(c)
+	if !ok {
+		return
+	}
+
+	letter, err := requeueDeadLetterUsecase(c.Request.Context(), id)
+	if err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"result": true, "dead_letter": letter})
+}
+
+// handler request response discard dead letter, its event is never published
+func deleteDeadLetterHandler(c *gin.Context) {
+	id, ok := deadLetterID(c)
+	if !ok {
+		return
+	}
+
+	if err := deleteDeadLetterUsecase(c.Request.Context(), id); err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"result": true})
+}
+
+// id param of the dead letter, false once the bad request is answered
+func deadLetterID(c *gin.Context) (int64, bool) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "handler error", "code", "160", "error", "Invalid dead letter ID")
+		apperror.JSON(c, http.StatusBadRequest, "Invalid dead letter ID")
+		return 0, false
+	}
+
+	return id, true
+}
+
+// =========== USECASE LAYER, SERVES AS AN INTERMEDIARY BETWEEN THE PRESENTATION LAYER AND THE DATA LAYER ===========
+
+func getDeadLettersUsecase(ctx context.Context, source string, pageNum, pageSize int) ([]DeadLetter, *Pagination, error) {
+	if pageNum < 1 || pageSize < 1 || pageSize > 100 || (source != "" && !slices.Contains(deadLetterSources, source)) {
+		return nil, nil, errDeadLetterPage
+	}
+
+	letters, err := repo.FindDeadLetters(ctx, source, pageNum, pageSize)
+	if err != nil {
+		return nil, nil, errors.New("database error: get dead letters error database")
+	}
+
+	total, err := repo.CountDeadLetters(ctx, source)
+	if err != nil {
+		return nil, nil, errors.New("database error: count dead letters error database")
+	}
+
+	pagination := newPagination(pageNum, pageSize, total)
+	return letters, &pagination, nil
+}
+
+func createDeadLetterUsecase(ctx context.Context, create DeadLetterCreate) (*DeadLetter, error) {
+	if !slices.Contains(events.Types, create.Event.Type) || create.Event.ID == "" || !json.Valid(create.Event.Data) {
+		return nil, errDeadLetterEvent
+	}
+
+	now := time.Now().UnixMicro()
+	letter := &DeadLetter{
+		Source:    create.Source,
+		SourceID:  create.SourceID,
+		EventKey:  create.EventKey,
+		Event:     create.Event,
+		Attempts:  create.Attempts,
+		LastError: create.LastError,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	if err := repo.CreateDeadLetter(ctx, letter); err != nil {
+		return nil, errors.New("database error: create dead letter error database")
+	}
+
+	deadLetterAdded(ctx, letter.Source)
+	return letter, nil
+}
+
+// count the new dead letter of source, logging an error while its queue holds DEAD_LETTERS_ALERT_THRESHOLD or more
+func deadLetterAdded(ctx context.Context, source string) {
+	deadLettersTotal.WithLabelValues(source).Inc()
+	if deadLetterAlertThreshold <= 0 {
+		return
+	}
+
+	count, err := repo.CountDeadLetters(ctx, source)
+	if err != nil {
+		slog.ErrorContext(ctx, "usecase error", "code", "161", "error", err)
+		return
+	}
+	if count >= deadLetterAlertThreshold {
+		slog.ErrorContext(ctx, "dead letters above alert threshold", "source", source, "dead_letters", count, "threshold", deadLetterAlertThreshold)
+	}
+}
+
+func getDeadLetterUsecase(ctx context.Context, id int64) (*DeadLetter, error) {
+	letter, err := repo.FindDeadLetterByID(ctx, id)
+	if err != nil {
+		if errors.Is(err, errDeadLetterNotFound) {
+			return nil, err
+		}
+		return nil, errors.New("database error: get dead letter error database")
+	}
+
+	return letter, nil
+}
+
+func updateDeadLetterUsecase(ctx context.Context, id int64, event events.Event) (*DeadLetter, error) {
+	letter, err := getDeadLetterUsecase(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if event.ID != letter.Event.ID || !slices.Contains(events.Types, event.Type) || !json.Valid(event.Data) {
+		return nil, errDeadLetterEvent
+	}
+
+	letter.Event, letter.UpdatedAt = event, time.Now().UnixMicro()
+	if err := repo.UpdateDeadLetter(ctx, letter); err != nil {
+		if errors.Is(err, errDeadLetterNotFound) {
+			return nil, err
+		}
+		return nil, errors.New("database error: update dead letter error database")
+	}
+
+	slog.InfoContext(ctx, "dead letter edited", "dead_letter_id", id, "source", letter.Source, "event_id", event.ID)
+	return letter, nil
+}
+
+func requeueDeadLetterUsecase(ctx context.Context, id int64) (*DeadLetter, error) {
+	letter, err := getDeadLetterUsecase(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if letter.Source == DeadLetterListingEvents {
+		return nil, errDeadLetterExternal
+	}
+
+	requeued, err := repo.RequeueDeadLetter(ctx, letter, time.Now().UnixMicro())
+	if err != nil {
+		return nil, errors.New("database error: requeue dead letter error database")
+	}
+	if !requeued {
+		return nil, errDeadLetterGone
+	}
+
+	slog.InfoContext(ctx, "dead letter requeued", "dead_letter_id", id, "source", letter.Source, "event_id", letter.Event.ID)
+	return letter, nil
+}
+
+func deleteDeadLetterUsecase(ctx context.Context, id int64) error {
+	deleted, err := repo.DeleteDeadLetter(ctx, id)
+	if err != nil {
+		return errors.New("database error: delete dead letter error database")
+	}
+	if !deleted {
+		return errDeadLetterNotFound
+	}
+
+	slog.InfoContext(ctx, "dead letter discarded", "dead_letter_id", id)
+	return nil
+}
+
+// =========== REPOSITORY LAYER, ABSTRACTION OVER THE DATA PERSISTENCE (databases, file systems, or external APIs) ===========
+
+const deadLetterColumns = "id, source, source_id, event_key, payload, attempts, last_error, created_at, updated_at"
+
+func scanDeadLetter(row interface{ Scan(...any) error }, letter *DeadLetter) error {
+	var payload string
+	var lastError sql.NullString
+	err := row.Scan(&letter.ID, &letter.Source, &letter.SourceID, &letter.EventKey, &payload, &letter.Attempts, &lastError, &letter.CreatedAt, &letter.UpdatedAt)
+	if err != nil {
+		return err
+	}
+	letter.LastError = lastError.String
+	return json.Unmarshal([]byte(payload), &letter.Event)
+}
+
+// where clause of the dead letters of source, all when empty
+func deadLetterWhere(source string) (string, []any) {
+	where := []string{"1 = 1"}
+	var args []any
+	if source != "" {
+		where = append(where, "source = ?")
+		args = append(args, source)
+	}
+	return strings.Join(where, " AND "), args
+}
+
+// page of the dead letters of source newest first
+func (r *sqlUserRepository) FindDeadLetters(ctx context.Context, source string, pageNum, pageSize int) ([]DeadLetter, error) {
+	ctx, done := r.observe(ctx, "findDeadLetters")
+	defer done()
+
+	where, args := deadLetterWhere(source)
+	rows, err := r.query(ctx, "SELECT "+deadLetterColumns+" FROM dead_letters WHERE "+where+" ORDER BY created_at DESC, id DESC LIMIT ? OFFSET ?",
+		append(args, pageSize, (pageNum-1)*pageSize)...)
+	if err != nil {
+		slog.ErrorContext(ctx, "handler error", "code", "162", "error", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	letters := []DeadLetter{}
+	for rows.Next() {
+		var letter DeadLetter
+		if err := scanDeadLetter(rows, &letter); err != nil {
+			slog.ErrorContext(ctx, "handler error", "code", "162", "error", err)
+			return nil, err
+		}
+		letters = append(letters, letter)
+	}
+
+	return letters, rows.Err()
+}
+
+func (r *sqlUserRepository) CountDeadLetters(ctx context.Context, source string) (int, error) {
+	ctx, done := r.observe(ctx, "countDeadLetters")
+	defer done()
+
+	where, args := deadLetterWhere(source)
+	var count int
+	if err := r.queryRow(ctx, "SELECT COUNT(*) FROM dead_letters WHERE "+where, args...).Scan(&count); err != nil {
+		slog.ErrorContext(ctx, "handler error", "code", "163", "error", err)
+		return 0, err
+	}
+
+	return count, nil
+}
+
+func (r *sqlUserRepository) FindDeadLetterByID(ctx context.Context, id int64) (*DeadLetter, error) {
+	ctx, done := r.observe(ctx, "findDeadLetterByID")
+	defer done()
+
+	var letter DeadLetter
+	err := scanDeadLetter(r.queryRow(ctx, "SELECT "+deadLetterColumns+" FROM dead_letters WHERE id = ?", id), &letter)
+	if err == sql.ErrNoRows {
+		return nil, errDeadLetterNotFound
+	}
+	if err != nil {
+		slog.ErrorContext(ctx, "handler error", "code", "164", "error", err)
+		return nil, err
+	}
+
+	return &letter, nil
+}
+
+// insert dead letter setting its id, the dead letter of the same event of its queue is replaced
+func (r *sqlUserRepository) CreateDeadLetter(ctx context.Context, letter *DeadLetter) error {
+	ctx, done := r.observe(ctx, "createDeadLetter")
+	defer done()
+
+	payload, err := json.Marshal(letter.Event)
+	if err != nil {
+		return err
+	}
+
+	err = r.insertRow(ctx, `INSERT INTO dead_letters (source, source_id, event_id, event_type, event_key, payload, attempts, last_error, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, NULLIF(?, ''), ?, ?)
+		ON CONFLICT (source, source_id) DO UPDATE SET event_id = excluded.event_id, event_type = excluded.event_type, event_key = excluded.event_key,
+			payload = excluded.payload, attempts = excluded.attempts, last_error = excluded.last_error, updated_at = excluded.updated_at
+		RETURNING id`,
+		letter.Source, letter.SourceID, letter.Event.ID, letter.Event.Type, letter.EventKey, string(payload), letter.Attempts, letter.LastError,
+		letter.CreatedAt, letter.UpdatedAt).Scan(&letter.ID)
+	if err != nil {
+		slog.ErrorContext(ctx, "handler error", "code", "165", "error", err)
+		return err
+	}
+
+	return nil
+}
+
+// replace the event of the dead letter
+func (r *sqlUserRepository) UpdateDeadLetter(ctx context.Context, letter *DeadLetter) error {
+	ctx, done := r.observe(ctx, "updateDeadLetter")
+	defer done()
+
+	payload, err := json.Marshal(letter.Event)
+	if err != nil {
+		return err
+	}
+
+	result, err := r.exec(ctx, "UPDATE dead_letters SET event_type = ?, payload = ?, updated_at = ? WHERE id = ?",
+		letter.Event.Type, string(payload), letter.UpdatedAt, letter.ID)
+	if err != nil {
+		slog.ErrorContext(ctx, "handler error", "code", "166", "error", err)
+		return err
+	}
+	if updated, err := result.RowsAffected(); err != nil || updated == 0 {
+		return errors.Join(err, errDeadLetterNotFound)
+	}
+
+	return nil
+}
+
+// the queue of the dead letters of source kept in this database, nil for the listing service outbox
+func (r *sqlUserRepository) deadLetterQueue(source string) *sqlOutbox {
+	switch source {
+	case DeadLetterUserEvents:
+		return r.outbox()
+	case DeadLetterWebhookDeliveries:
+		return r.webhookDeliveries()
+	}
+	return nil
+}
+
+// put the event of the dead letter back pending in its queue with no attempts made and delete the dead letter,
+// false when its event is no longer dead in the queue or the dead letter was requeued or discarded meanwhile
+func (r *sqlUserRepository) RequeueDeadLetter(ctx context.Context, letter *DeadLetter, now int64) (bool, error) {
+	ctx, done := r.observe(ctx, "requeueDeadLetter")
+	defer done()
+
+	queue := r.deadLetterQueue(letter.Source)
+	if queue == nil {
+		return false, nil
+	}
+
+	payload, err := json.Marshal(letter.Event)
+	if err != nil {
+		return false, err
+	}
+
+	requeued := false
+	err = r.withTx(ctx, func(tx *sql.Tx) error {
+		result, err := tx.ExecContext(ctx, r.rebind("DELETE FROM dead_letters WHERE id = ?"), letter.ID)
+		if err != nil {
+			return err
+		}
+		if deleted, err := result.RowsAffected(); err != nil || deleted == 0 {
+			return err
+		}
+
+		result, err = tx.ExecContext(ctx, r.rebind("UPDATE "+queue.table+` SET status = 'pending', event_type = ?, payload = ?, attempts = 0,
+			next_attempt_at = ?, locked_until = NULL, last_error = NULL WHERE id = ? AND status = ?`),
+			letter.Event.Type, string(payload), now, letter.SourceID, queue.deadStatus)
+		if err != nil {
+			return err
+		}
+		if updated, err := result.RowsAffected(); err != nil || updated == 0 {
+			// keep the dead letter
+			return errors.Join(err, errDeadLetterGone)
+		}
+
+		requeued = true
+		return nil
+	})
+	if errors.Is(err, errDeadLetterGone) {
+		return false, nil
+	}
+	if err != nil {
+		slog.ErrorContext(ctx, "handler error", "code", "167", "error", err)
+		return false, err
+	}
+
+	return requeued, nil
+}
+
+// delete dead letter, false when it does not exist
+func (r *sqlUserRepository) DeleteDeadLetter(ctx context.Context, id int64) (bool, error) {
+	ctx, done := r.observe(ctx, "deleteDeadLetter")
+	defer done()
+
+	result, err := r.exec(ctx, "DELETE FROM dead_letters WHERE id = ?", id)
+	if err != nil {
+		slog.ErrorContext(ctx, "handler error", "code", "168", "error", err)
+		return false, err
+	}
+
+	deleted, err := result.RowsAffected()
+	if err != nil {
+		slog.ErrorContext(ctx, "handler error", "code", "168", "error", err)
+		return false, err
+	}
+
+	return deleted > 0, nil
+}
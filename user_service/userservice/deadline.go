@@ -0,0 +1,40 @@
+package userservice
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// header of the milliseconds left to the caller, the public API sends it on every call
+const headerRequestTimeout = "X-Request-Timeout"
+
+// DB_QUERY_TIMEOUT max duration of one repository function and its statements, 0 disables
+var dbQueryTimeout = cfg.Duration("DB_QUERY_TIMEOUT", 10*time.Second)
+
+// =========== MIDDLEWARE LAYER, RUN BEFORE INTERFACE HANDLER TO ENRICH OR GUARD THE REQUEST ===========
+
+// end the context of the request after timeout or the time left to the caller, whichever comes first, so the
+// handler and its queries stop once nobody waits for the answer. 0 disables timeout
+func deadlineMiddleware(timeout time.Duration) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		limit := timeout
+		if ms, err := strconv.ParseInt(c.GetHeader(headerRequestTimeout), 10, 64); err == nil && ms > 0 {
+			if left := time.Duration(ms) * time.Millisecond; limit <= 0 || left < limit {
+				limit = left
+			}
+		}
+		if limit <= 0 {
+			c.Next()
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(c.Request.Context(), limit)
+		defer cancel()
+		c.Request = c.Request.WithContext(ctx)
+
+		c.Next()
+	}
+}
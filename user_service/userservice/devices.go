@@ -0,0 +1,439 @@
+package userservice
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"apperror"
+
+	"github.com/gin-gonic/gin"
+)
+
+// device of a user receiving push notifications, platform is fcm or apns and token the registration token of the
+// app on the device
+type PushDevice struct {
+	ID        int    `json:"id"`
+	UserID    int    `json:"user_id"`
+	Platform  string `json:"platform"`
+	Token     string `json:"token"`
+	CreatedAt int64  `json:"created_at"`
+	UpdatedAt int64  `json:"updated_at"`
+	// set once the platform rejected the token, the device is no longer pushed to
+	InvalidatedAt *int64 `json:"invalidated_at"`
+	InvalidReason string `json:"invalid_reason,omitempty"`
+}
+
+type PushDeviceCreate struct {
+	Platform string `json:"platform" binding:"required,oneof=fcm apns"`
+	Token    string `json:"token" binding:"required,notblank,max=4096"`
+}
+
+// outcome of a push sent to a device, invalid also invalidates the device
+type PushReceipt struct {
+	ID        int64  `json:"id"`
+	DeviceID  int    `json:"device_id" binding:"required"`
+	Event     string `json:"event" binding:"required"`
+	Status    string `json:"status" binding:"required,oneof=delivered failed invalid"`
+	Error     string `json:"error,omitempty"`
+	CreatedAt int64  `json:"created_at"`
+}
+
+// receipts of the pushes of a notification, sent by the public API
+type PushReceiptsCreate struct {
+	Receipts []PushReceipt `json:"receipts" binding:"required,min=1,max=100,dive"`
+}
+
+var (
+	errPushDeviceNotFound = apperror.NotFound("Device not found")
+	errPushDeviceLimit    = apperror.Conflict("device limit reached, delete a device first")
+	errPushReceiptsLimit  = apperror.Validation("limit must be between 1 and 200")
+)
+
+var (
+	// PUSH_DEVICE_MAX_PER_USER devices a user may register, invalidated devices are not counted
+	pushDeviceMaxPerUser = cfg.Int("PUSH_DEVICE_MAX_PER_USER", 20)
+	// PUSH_RECEIPT_RETENTION how long push receipts are kept
+	pushReceiptRetention = cfg.Duration("PUSH_RECEIPT_RETENTION", 30*24*time.Hour)
+)
+
+// =========== INTERFACE HANDLER, HANDLING REQUEST RESPONSE API DEPEND INTERFACE ===========
+
+// handler request response devices of user, invalidated ones included
+func getUserDevicesHandler(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "handler error", "code", "095", "error", "Invalid user ID")
+		apperror.JSON(c, http.StatusBadRequest, "Invalid user ID")
+		return
+	}
+
+	devices, err := getUserDevicesUsecase(c.Request.Context(), id)
+	if err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"result": true, "devices": devices})
+}
+
+// handler request response register device, registering a token again moves it to the user and validates it again
+func registerUserDeviceHandler(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "handler error", "code", "096", "error", "Invalid user ID")
+		apperror.JSON(c, http.StatusBadRequest, "Invalid user ID")
+		return
+	}
+
+	var body PushDeviceCreate
+	if err := c.ShouldBindJSON(&body); err != nil {
+		slog.ErrorContext(c.Request.Context(), "handler error", "code", "097", "error", err)
+		apperror.RespondBinding(c, err)
+		return
+	}
+
+	device, err := registerUserDeviceUsecase(c.Request.Context(), id, body)
+	if err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"result": true, "device": device})
+}
+
+// handler request response delete device of user with its receipts
+func deleteUserDeviceHandler(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "handler error", "code", "098", "error", "Invalid user ID")
+		apperror.JSON(c, http.StatusBadRequest, "Invalid user ID")
+		return
+	}
+
+	deviceID, err := strconv.Atoi(c.Param("device_id"))
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "handler error", "code", "099", "error", "Invalid device ID")
+		apperror.JSON(c, http.StatusBadRequest, "Invalid device ID")
+		return
+	}
+
+	if err := deleteUserDeviceUsecase(c.Request.Context(), id, deviceID); err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"result": true})
+}
+
+// handler request response latest receipts of a device of user, ?limit= 50 by default
+func getPushReceiptsHandler(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "handler error", "code", "100", "error", "Invalid user ID")
+		apperror.JSON(c, http.StatusBadRequest, "Invalid user ID")
+		return
+	}
+
+	deviceID, err := strconv.Atoi(c.Param("device_id"))
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "handler error", "code", "101", "error", "Invalid device ID")
+		apperror.JSON(c, http.StatusBadRequest, "Invalid device ID")
+		return
+	}
+
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "50"))
+	if err != nil {
+		apperror.Respond(c, errPushReceiptsLimit)
+		return
+	}
+
+	receipts, err := getPushReceiptsUsecase(c.Request.Context(), id, deviceID, limit)
+	if err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"result": true, "receipts": receipts})
+}
+
+// handler request response record receipts of pushes sent by the public API
+func recordPushReceiptsHandler(c *gin.Context) {
+	var body PushReceiptsCreate
+	if err := c.ShouldBindJSON(&body); err != nil {
+		slog.ErrorContext(c.Request.Context(), "handler error", "code", "102", "error", err)
+		apperror.RespondBinding(c, err)
+		return
+	}
+
+	if err := recordPushReceiptsUsecase(c.Request.Context(), body.Receipts); err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"result": true})
+}
+
+// =========== USECASE LAYER, SERVES AS AN INTERMEDIARY BETWEEN THE PRESENTATION LAYER AND THE DATA LAYER ===========
+
+func getUserDevicesUsecase(ctx context.Context, userID int) ([]PushDevice, error) {
+	devices, err := repo.FindPushDevicesByUserID(ctx, userID)
+	if err != nil {
+		return nil, errors.New("database error: get devices error database")
+	}
+
+	return devices, nil
+}
+
+func registerUserDeviceUsecase(ctx context.Context, userID int, body PushDeviceCreate) (*PushDevice, error) {
+	if _, err := repo.FindByID(ctx, userID); err != nil {
+		if errors.Is(err, errUserNotFound) {
+			return nil, err
+		}
+		return nil, errors.New("database error: get user error database")
+	}
+
+	devices, err := repo.FindPushDevicesByUserID(ctx, userID)
+	if err != nil {
+		return nil, errors.New("database error: get devices error database")
+	}
+
+	// the device registered again is not counted, an app refreshes its registration on every start
+	active := 0
+	for _, device := range devices {
+		if device.InvalidatedAt == nil && (device.Platform != body.Platform || device.Token != body.Token) {
+			active++
+		}
+	}
+	if active >= pushDeviceMaxPerUser {
+		return nil, errPushDeviceLimit
+	}
+
+	now := time.Now().UnixMicro()
+	device := &PushDevice{UserID: userID, Platform: body.Platform, Token: body.Token, CreatedAt: now, UpdatedAt: now}
+	if err := repo.SavePushDevice(ctx, device); err != nil {
+		return nil, errors.New("database error: save device error database")
+	}
+
+	return device, nil
+}
+
+func deleteUserDeviceUsecase(ctx context.Context, userID, deviceID int) error {
+	if err := repo.DeletePushDevice(ctx, userID, deviceID); err != nil {
+		if errors.Is(err, errPushDeviceNotFound) {
+			return err
+		}
+		return errors.New("database error: delete device error database")
+	}
+
+	return nil
+}
+
+func getPushReceiptsUsecase(ctx context.Context, userID, deviceID, limit int) ([]PushReceipt, error) {
+	if limit < 1 || limit > 200 {
+		return nil, errPushReceiptsLimit
+	}
+
+	device, err := repo.FindPushDeviceByID(ctx, deviceID)
+	if err != nil {
+		if errors.Is(err, errPushDeviceNotFound) {
+			return nil, err
+		}
+		return nil, errors.New("database error: get device error database")
+	}
+	// devices of other users look missing
+	if device.UserID != userID {
+		return nil, errPushDeviceNotFound
+	}
+
+	receipts, err := repo.FindPushReceipts(ctx, deviceID, limit)
+	if err != nil {
+		return nil, errors.New("database error: get push receipts error database")
+	}
+
+	return receipts, nil
+}
+
+// store receipts, invalidate the devices of invalid ones and drop receipts past PUSH_RECEIPT_RETENTION
+func recordPushReceiptsUsecase(ctx context.Context, receipts []PushReceipt) error {
+	now := time.Now()
+	if err := repo.CreatePushReceipts(ctx, receipts, now.UnixMicro(), now.Add(-pushReceiptRetention).UnixMicro()); err != nil {
+		return errors.New("database error: record push receipts error database")
+	}
+
+	for _, receipt := range receipts {
+		if receipt.Status == "invalid" {
+			slog.InfoContext(ctx, "push device invalidated", "device_id", receipt.DeviceID, "reason", receipt.Error)
+		}
+	}
+
+	return nil
+}
+
+// =========== REPOSITORY LAYER, ABSTRACTION OVER THE DATA PERSISTENCE (databases, file systems, or external APIs) ===========
+
+const pushDeviceColumns = "id, user_id, platform, token, created_at, updated_at, invalidated_at, invalid_reason"
+
+func scanPushDevice(row interface{ Scan(...any) error }, device *PushDevice) error {
+	var invalidatedAt sql.NullInt64
+	var reason sql.NullString
+	if err := row.Scan(&device.ID, &device.UserID, &device.Platform, &device.Token, &device.CreatedAt, &device.UpdatedAt, &invalidatedAt, &reason); err != nil {
+		return err
+	}
+	if invalidatedAt.Valid {
+		device.InvalidatedAt = &invalidatedAt.Int64
+	}
+	device.InvalidReason = reason.String
+	return nil
+}
+
+// devices of user, oldest first
+func (r *sqlUserRepository) FindPushDevicesByUserID(ctx context.Context, userID int) ([]PushDevice, error) {
+	ctx, done := r.observe(ctx, "findPushDevicesByUserID")
+	defer done()
+
+	rows, err := r.query(ctx, "SELECT "+pushDeviceColumns+" FROM push_devices WHERE user_id = ? ORDER BY id", userID)
+	if err != nil {
+		slog.ErrorContext(ctx, "handler error", "code", "103", "error", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	devices := []PushDevice{}
+	for rows.Next() {
+		var device PushDevice
+		if err := scanPushDevice(rows, &device); err != nil {
+			slog.ErrorContext(ctx, "handler error", "code", "103", "error", err)
+			return nil, err
+		}
+		devices = append(devices, device)
+	}
+
+	return devices, rows.Err()
+}
+
+func (r *sqlUserRepository) FindPushDeviceByID(ctx context.Context, id int) (*PushDevice, error) {
+	ctx, done := r.observe(ctx, "findPushDeviceByID")
+	defer done()
+
+	var device PushDevice
+	if err := scanPushDevice(r.queryRow(ctx, "SELECT "+pushDeviceColumns+" FROM push_devices WHERE id = ?", id), &device); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, errPushDeviceNotFound
+		}
+		slog.ErrorContext(ctx, "handler error", "code", "104", "error", err)
+		return nil, err
+	}
+
+	return &device, nil
+}
+
+// insert device or move its token to the user and validate it again, device gets the id and first registration time
+func (r *sqlUserRepository) SavePushDevice(ctx context.Context, device *PushDevice) error {
+	ctx, done := r.observe(ctx, "savePushDevice")
+	defer done()
+
+	err := r.insertRow(ctx, `INSERT INTO push_devices (user_id, platform, token, created_at, updated_at) VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT (platform, token) DO UPDATE SET user_id = excluded.user_id, updated_at = excluded.updated_at, invalidated_at = NULL, invalid_reason = NULL
+		RETURNING id, created_at`,
+		device.UserID, device.Platform, device.Token, device.CreatedAt, device.UpdatedAt).Scan(&device.ID, &device.CreatedAt)
+	if err != nil {
+		slog.ErrorContext(ctx, "handler error", "code", "105", "error", err)
+		return err
+	}
+
+	return nil
+}
+
+// delete device of the user with its receipts, errPushDeviceNotFound when the user has no such device
+func (r *sqlUserRepository) DeletePushDevice(ctx context.Context, userID, deviceID int) error {
+	ctx, done := r.observe(ctx, "deletePushDevice")
+	defer done()
+
+	var affected int64
+	err := r.withTx(ctx, func(tx *sql.Tx) error {
+		result, err := tx.ExecContext(ctx, r.rebind("DELETE FROM push_devices WHERE id = ? AND user_id = ?"), deviceID, userID)
+		if err != nil {
+			return err
+		}
+		if affected, err = result.RowsAffected(); err != nil || affected == 0 {
+			return err
+		}
+
+		_, err = tx.ExecContext(ctx, r.rebind("DELETE FROM push_receipts WHERE device_id = ?"), deviceID)
+		return err
+	})
+	if err != nil {
+		slog.ErrorContext(ctx, "handler error", "code", "106", "error", err)
+		return err
+	}
+
+	if affected == 0 {
+		return errPushDeviceNotFound
+	}
+	return nil
+}
+
+// latest receipts of the device first
+func (r *sqlUserRepository) FindPushReceipts(ctx context.Context, deviceID, limit int) ([]PushReceipt, error) {
+	ctx, done := r.observe(ctx, "findPushReceipts")
+	defer done()
+
+	rows, err := r.query(ctx, "SELECT id, device_id, event, status, error, created_at FROM push_receipts WHERE device_id = ? ORDER BY id DESC LIMIT ?", deviceID, limit)
+	if err != nil {
+		slog.ErrorContext(ctx, "handler error", "code", "107", "error", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	receipts := []PushReceipt{}
+	for rows.Next() {
+		var receipt PushReceipt
+		var pushError sql.NullString
+		if err := rows.Scan(&receipt.ID, &receipt.DeviceID, &receipt.Event, &receipt.Status, &pushError, &receipt.CreatedAt); err != nil {
+			slog.ErrorContext(ctx, "handler error", "code", "107", "error", err)
+			return nil, err
+		}
+		receipt.Error = pushError.String
+		receipts = append(receipts, receipt)
+	}
+
+	return receipts, rows.Err()
+}
+
+// insert receipts at now, invalidate the devices of invalid receipts and delete receipts created before
+func (r *sqlUserRepository) CreatePushReceipts(ctx context.Context, receipts []PushReceipt, now, before int64) error {
+	ctx, done := r.observe(ctx, "createPushReceipts")
+	defer done()
+
+	err := r.withTx(ctx, func(tx *sql.Tx) error {
+		for _, receipt := range receipts {
+			_, err := tx.ExecContext(ctx, r.rebind("INSERT INTO push_receipts (device_id, event, status, error, created_at) VALUES (?, ?, ?, NULLIF(?, ''), ?)"),
+				receipt.DeviceID, receipt.Event, receipt.Status, receipt.Error, now)
+			if err != nil {
+				return err
+			}
+
+			if receipt.Status == "invalid" {
+				_, err := tx.ExecContext(ctx, r.rebind("UPDATE push_devices SET invalidated_at = ?, invalid_reason = NULLIF(?, ''), updated_at = ? WHERE id = ? AND invalidated_at IS NULL"),
+					now, receipt.Error, now, receipt.DeviceID)
+				if err != nil {
+					return err
+				}
+			}
+		}
+
+		_, err := tx.ExecContext(ctx, r.rebind("DELETE FROM push_receipts WHERE created_at < ?"), before)
+		return err
+	})
+	if err != nil {
+		slog.ErrorContext(ctx, "handler error", "code", "108", "error", err)
+		return err
+	}
+
+	return nil
+}
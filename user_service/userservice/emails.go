@@ -0,0 +1,457 @@
+package userservice
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"apperror"
+
+	"github.com/gin-gonic/gin"
+)
+
+// outcome of a notification email reported by the email provider through the public API. A hard bounce or a complaint
+// suppresses the address of the user, soft bounces only once EMAIL_SOFT_BOUNCE_LIMIT of them followed each other
+type EmailEvent struct {
+	ID        int64  `json:"id"`
+	UserID    int    `json:"user_id" binding:"required,min=1"`
+	Type      string `json:"type" binding:"required,oneof=delivered soft_bounce hard_bounce complaint"`
+	Provider  string `json:"provider" binding:"required,max=50"`
+	Address   string `json:"address,omitempty" binding:"max=320"`
+	MessageID string `json:"message_id,omitempty" binding:"max=500"`
+	Detail    string `json:"detail,omitempty" binding:"max=1000"`
+	// unix microseconds the provider saw the event at, now when zero
+	OccurredAt int64 `json:"occurred_at" binding:"min=0"`
+	CreatedAt  int64 `json:"created_at"`
+}
+
+// events of a provider webhook, sent by the public API
+type EmailEventsCreate struct {
+	Events []EmailEvent `json:"events" binding:"required,min=1,max=500,dive"`
+}
+
+// user no longer sent notification emails, reason is hard_bounce, soft_bounce, complaint or manual
+type EmailSuppression struct {
+	UserID    int    `json:"user_id"`
+	Address   string `json:"address,omitempty"`
+	Reason    string `json:"reason"`
+	Detail    string `json:"detail,omitempty"`
+	CreatedAt int64  `json:"created_at"`
+}
+
+// suppression added by an operator, for an address the user asked not to be emailed at
+type EmailSuppressionCreate struct {
+	Address string `json:"address" binding:"max=320"`
+	Detail  string `json:"detail" binding:"max=1000"`
+}
+
+var (
+	errEmailSuppressionNotFound = apperror.NotFound("Email suppression not found")
+	errEmailEventsLimit         = apperror.Validation("limit must be between 1 and 200")
+	errEmailSuppressionReason   = apperror.Validation("reason must be one of hard_bounce, soft_bounce, complaint, manual")
+)
+
+var (
+	// EMAIL_SOFT_BOUNCE_LIMIT soft bounces in a row, without a delivery between them, suppressing the address
+	emailSoftBounceLimit = cfg.Int("EMAIL_SOFT_BOUNCE_LIMIT", 3)
+	// EMAIL_EVENT_RETENTION how long email delivery events are kept, suppressions are kept until removed
+	emailEventRetention = cfg.Duration("EMAIL_EVENT_RETENTION", 90*24*time.Hour)
+)
+
+// =========== INTERFACE HANDLER, HANDLING REQUEST RESPONSE API DEPEND INTERFACE ===========
+
+// handler request response record email events, responds the users suppressed by them
+func recordEmailEventsHandler(c *gin.Context) {
+	var body EmailEventsCreate
+	if err := c.ShouldBindJSON(&body); err != nil {
+		slog.ErrorContext(c.Request.Context(), "handler error", "code", "132", "error", err)
+		apperror.RespondBinding(c, err)
+		return
+	}
+
+	suppressed, err := recordEmailEventsUsecase(c.Request.Context(), body.Events)
+	if err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"result": true, "suppressed": suppressed})
+}
+
+// handler request response latest email events of user, ?limit= 50 by default
+func getUserEmailEventsHandler(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "handler error", "code", "133", "error", "Invalid user ID")
+		apperror.JSON(c, http.StatusBadRequest, "Invalid user ID")
+		return
+	}
+
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "50"))
+	if err != nil {
+		apperror.Respond(c, errEmailEventsLimit)
+		return
+	}
+
+	emailEvents, err := getUserEmailEventsUsecase(c.Request.Context(), id, limit)
+	if err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"result": true, "events": emailEvents})
+}
+
+// handler request response suppressions newest first, ?reason= keeps the ones of a reason
+func getEmailSuppressionsHandler(c *gin.Context) {
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "50"))
+	if err != nil {
+		apperror.Respond(c, errEmailEventsLimit)
+		return
+	}
+
+	suppressions, err := getEmailSuppressionsUsecase(c.Request.Context(), c.Query("reason"), limit)
+	if err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"result": true, "suppressions": suppressions})
+}
+
+func getUserEmailSuppressionHandler(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "handler error", "code", "134", "error", "Invalid user ID")
+		apperror.JSON(c, http.StatusBadRequest, "Invalid user ID")
+		return
+	}
+
+	suppression, err := getUserEmailSuppressionUsecase(c.Request.Context(), id)
+	if err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"result": true, "suppression": suppression})
+}
+
+// handler request response suppress the emails of user by hand, replacing the suppression the user has
+func suppressUserEmailHandler(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "handler error", "code", "135", "error", "Invalid user ID")
+		apperror.JSON(c, http.StatusBadRequest, "Invalid user ID")
+		return
+	}
+
+	var body EmailSuppressionCreate
+	if err := c.ShouldBindJSON(&body); err != nil {
+		slog.ErrorContext(c.Request.Context(), "handler error", "code", "136", "error", err)
+		apperror.RespondBinding(c, err)
+		return
+	}
+
+	suppression, err := suppressUserEmailUsecase(c.Request.Context(), id, body)
+	if err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"result": true, "suppression": suppression})
+}
+
+// handler request response remove the suppression of user, emails are sent again
+func unsuppressUserEmailHandler(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "handler error", "code", "137", "error", "Invalid user ID")
+		apperror.JSON(c, http.StatusBadRequest, "Invalid user ID")
+		return
+	}
+
+	if err := unsuppressUserEmailUsecase(c.Request.Context(), id); err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"result": true})
+}
+
+// =========== USECASE LAYER, SERVES AS AN INTERMEDIARY BETWEEN THE PRESENTATION LAYER AND THE DATA LAYER ===========
+
+// store events, suppress the users they make undeliverable and drop events past EMAIL_EVENT_RETENTION. Returns the ids
+// of the users suppressed by these events
+func recordEmailEventsUsecase(ctx context.Context, emailEvents []EmailEvent) ([]int, error) {
+	now := time.Now()
+	for i := range emailEvents {
+		if emailEvents[i].OccurredAt == 0 {
+			emailEvents[i].OccurredAt = now.UnixMicro()
+		}
+	}
+
+	suppressions, err := repo.CreateEmailEvents(ctx, emailEvents, emailSoftBounceLimit, now.UnixMicro(), now.Add(-emailEventRetention).UnixMicro())
+	if err != nil {
+		return nil, errors.New("database error: record email events error database")
+	}
+
+	suppressed := make([]int, 0, len(suppressions))
+	for _, suppression := range suppressions {
+		slog.InfoContext(ctx, "email suppressed", "user_id", suppression.UserID, "reason", suppression.Reason, "detail", suppression.Detail)
+		suppressed = append(suppressed, suppression.UserID)
+	}
+
+	return suppressed, nil
+}
+
+func getUserEmailEventsUsecase(ctx context.Context, userID, limit int) ([]EmailEvent, error) {
+	if limit < 1 || limit > 200 {
+		return nil, errEmailEventsLimit
+	}
+
+	emailEvents, err := repo.FindEmailEvents(ctx, userID, limit)
+	if err != nil {
+		return nil, errors.New("database error: get email events error database")
+	}
+
+	return emailEvents, nil
+}
+
+func getEmailSuppressionsUsecase(ctx context.Context, reason string, limit int) ([]EmailSuppression, error) {
+	if limit < 1 || limit > 200 {
+		return nil, errEmailEventsLimit
+	}
+	switch reason {
+	case "", "hard_bounce", "soft_bounce", "complaint", "manual":
+	default:
+		return nil, errEmailSuppressionReason
+	}
+
+	suppressions, err := repo.FindEmailSuppressions(ctx, reason, limit)
+	if err != nil {
+		return nil, errors.New("database error: get email suppressions error database")
+	}
+
+	return suppressions, nil
+}
+
+func getUserEmailSuppressionUsecase(ctx context.Context, userID int) (*EmailSuppression, error) {
+	suppression, err := repo.FindEmailSuppression(ctx, userID)
+	if err != nil {
+		if errors.Is(err, errEmailSuppressionNotFound) {
+			return nil, err
+		}
+		return nil, errors.New("database error: get email suppression error database")
+	}
+
+	return suppression, nil
+}
+
+func suppressUserEmailUsecase(ctx context.Context, userID int, body EmailSuppressionCreate) (*EmailSuppression, error) {
+	if _, err := repo.FindByID(ctx, userID); err != nil {
+		if errors.Is(err, errUserNotFound) {
+			return nil, err
+		}
+		return nil, errors.New("database error: get user error database")
+	}
+
+	suppression := &EmailSuppression{UserID: userID, Address: body.Address, Reason: "manual", Detail: body.Detail, CreatedAt: time.Now().UnixMicro()}
+	if err := repo.SaveEmailSuppression(ctx, suppression); err != nil {
+		return nil, errors.New("database error: save email suppression error database")
+	}
+
+	slog.InfoContext(ctx, "email suppressed", "user_id", userID, "reason", suppression.Reason, "detail", suppression.Detail)
+	return suppression, nil
+}
+
+func unsuppressUserEmailUsecase(ctx context.Context, userID int) error {
+	if err := repo.DeleteEmailSuppression(ctx, userID); err != nil {
+		if errors.Is(err, errEmailSuppressionNotFound) {
+			return err
+		}
+		return errors.New("database error: delete email suppression error database")
+	}
+
+	slog.InfoContext(ctx, "email suppression removed", "user_id", userID)
+	return nil
+}
+
+// =========== REPOSITORY LAYER, ABSTRACTION OVER THE DATA PERSISTENCE (databases, file systems, or external APIs) ===========
+
+const emailSuppressionColumns = "user_id, address, reason, detail, created_at"
+
+func scanEmailSuppression(row interface{ Scan(...any) error }, suppression *EmailSuppression) error {
+	var address, detail sql.NullString
+	if err := row.Scan(&suppression.UserID, &address, &suppression.Reason, &detail, &suppression.CreatedAt); err != nil {
+		return err
+	}
+	suppression.Address, suppression.Detail = address.String, detail.String
+	return nil
+}
+
+// latest events of the user first
+func (r *sqlUserRepository) FindEmailEvents(ctx context.Context, userID, limit int) ([]EmailEvent, error) {
+	ctx, done := r.observe(ctx, "findEmailEvents")
+	defer done()
+
+	rows, err := r.query(ctx, "SELECT id, user_id, type, provider, address, message_id, detail, occurred_at, created_at FROM email_events WHERE user_id = ? ORDER BY occurred_at DESC, id DESC LIMIT ?",
+		userID, limit)
+	if err != nil {
+		slog.ErrorContext(ctx, "handler error", "code", "138", "error", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	emailEvents := []EmailEvent{}
+	for rows.Next() {
+		var event EmailEvent
+		var address, messageID, detail sql.NullString
+		if err := rows.Scan(&event.ID, &event.UserID, &event.Type, &event.Provider, &address, &messageID, &detail, &event.OccurredAt, &event.CreatedAt); err != nil {
+			slog.ErrorContext(ctx, "handler error", "code", "138", "error", err)
+			return nil, err
+		}
+		event.Address, event.MessageID, event.Detail = address.String, messageID.String, detail.String
+		emailEvents = append(emailEvents, event)
+	}
+
+	return emailEvents, rows.Err()
+}
+
+// insert events at now, suppress the users of hard bounces, complaints and of softBounceLimit soft bounces since their
+// last delivery, and delete events created before. Users already suppressed keep their suppression, the new ones are
+// returned
+func (r *sqlUserRepository) CreateEmailEvents(ctx context.Context, emailEvents []EmailEvent, softBounceLimit int, now, before int64) ([]EmailSuppression, error) {
+	ctx, done := r.observe(ctx, "createEmailEvents")
+	defer done()
+
+	var suppressions []EmailSuppression
+	err := r.withTx(ctx, func(tx *sql.Tx) error {
+		suppressions = nil
+		for _, event := range emailEvents {
+			_, err := tx.ExecContext(ctx, r.rebind("INSERT INTO email_events (user_id, type, provider, address, message_id, detail, occurred_at, created_at) VALUES (?, ?, ?, NULLIF(?, ''), NULLIF(?, ''), NULLIF(?, ''), ?, ?)"),
+				event.UserID, event.Type, event.Provider, event.Address, event.MessageID, event.Detail, event.OccurredAt, now)
+			if err != nil {
+				return err
+			}
+
+			switch event.Type {
+			case "delivered":
+				continue
+			case "soft_bounce":
+				var bounces int
+				err := tx.QueryRowContext(ctx, r.rebind(`SELECT COUNT(*) FROM email_events WHERE user_id = ? AND type = 'soft_bounce'
+					AND occurred_at > COALESCE((SELECT MAX(occurred_at) FROM email_events WHERE user_id = ? AND type = 'delivered'), 0)`),
+					event.UserID, event.UserID).Scan(&bounces)
+				if err != nil {
+					return err
+				}
+				if bounces < softBounceLimit {
+					continue
+				}
+			}
+
+			result, err := tx.ExecContext(ctx, r.rebind("INSERT INTO email_suppressions (user_id, address, reason, detail, created_at) VALUES (?, NULLIF(?, ''), ?, NULLIF(?, ''), ?) ON CONFLICT (user_id) DO NOTHING"),
+				event.UserID, event.Address, event.Type, event.Detail, now)
+			if err != nil {
+				return err
+			}
+			if inserted, err := result.RowsAffected(); err != nil {
+				return err
+			} else if inserted > 0 {
+				suppressions = append(suppressions, EmailSuppression{UserID: event.UserID, Address: event.Address, Reason: event.Type, Detail: event.Detail, CreatedAt: now})
+			}
+		}
+
+		_, err := tx.ExecContext(ctx, r.rebind("DELETE FROM email_events WHERE created_at < ?"), before)
+		return err
+	})
+	if err != nil {
+		slog.ErrorContext(ctx, "handler error", "code", "139", "error", err)
+		return nil, err
+	}
+
+	return suppressions, nil
+}
+
+// latest suppressions first, every reason when reason is empty
+func (r *sqlUserRepository) FindEmailSuppressions(ctx context.Context, reason string, limit int) ([]EmailSuppression, error) {
+	ctx, done := r.observe(ctx, "findEmailSuppressions")
+	defer done()
+
+	rows, err := r.query(ctx, "SELECT "+emailSuppressionColumns+" FROM email_suppressions WHERE ? IN ('', reason) ORDER BY created_at DESC, user_id DESC LIMIT ?", reason, limit)
+	if err != nil {
+		slog.ErrorContext(ctx, "handler error", "code", "140", "error", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	suppressions := []EmailSuppression{}
+	for rows.Next() {
+		var suppression EmailSuppression
+		if err := scanEmailSuppression(rows, &suppression); err != nil {
+			slog.ErrorContext(ctx, "handler error", "code", "140", "error", err)
+			return nil, err
+		}
+		suppressions = append(suppressions, suppression)
+	}
+
+	return suppressions, rows.Err()
+}
+
+func (r *sqlUserRepository) FindEmailSuppression(ctx context.Context, userID int) (*EmailSuppression, error) {
+	ctx, done := r.observe(ctx, "findEmailSuppression")
+	defer done()
+
+	var suppression EmailSuppression
+	if err := scanEmailSuppression(r.queryRow(ctx, "SELECT "+emailSuppressionColumns+" FROM email_suppressions WHERE user_id = ?", userID), &suppression); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, errEmailSuppressionNotFound
+		}
+		slog.ErrorContext(ctx, "handler error", "code", "141", "error", err)
+		return nil, err
+	}
+
+	return &suppression, nil
+}
+
+// insert suppression or replace the one of its user
+func (r *sqlUserRepository) SaveEmailSuppression(ctx context.Context, suppression *EmailSuppression) error {
+	ctx, done := r.observe(ctx, "saveEmailSuppression")
+	defer done()
+
+	_, err := r.exec(ctx, `INSERT INTO email_suppressions (user_id, address, reason, detail, created_at) VALUES (?, NULLIF(?, ''), ?, NULLIF(?, ''), ?)
+		ON CONFLICT (user_id) DO UPDATE SET address = excluded.address, reason = excluded.reason, detail = excluded.detail, created_at = excluded.created_at`,
+		suppression.UserID, suppression.Address, suppression.Reason, suppression.Detail, suppression.CreatedAt)
+	if err != nil {
+		slog.ErrorContext(ctx, "handler error", "code", "142", "error", err)
+		return err
+	}
+
+	return nil
+}
+
+func (r *sqlUserRepository) DeleteEmailSuppression(ctx context.Context, userID int) error {
+	ctx, done := r.observe(ctx, "deleteEmailSuppression")
+	defer done()
+
+	result, err := r.exec(ctx, "DELETE FROM email_suppressions WHERE user_id = ?", userID)
+	if err != nil {
+		slog.ErrorContext(ctx, "handler error", "code", "143", "error", err)
+		return err
+	}
+
+	deleted, err := result.RowsAffected()
+	if err != nil {
+		slog.ErrorContext(ctx, "handler error", "code", "143", "error", err)
+		return err
+	}
+	if deleted == 0 {
+		return errEmailSuppressionNotFound
+	}
+
+	return nil
+}
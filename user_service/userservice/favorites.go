@@ -0,0 +1,274 @@
+package userservice
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"apperror"
+
+	"github.com/gin-gonic/gin"
+)
+
+// listing saved by a user, the listing itself lives in the listing service
+type Favorite struct {
+	UserID    int   `json:"user_id"`
+	ListingID int   `json:"listing_id"`
+	CreatedAt int64 `json:"created_at"`
+}
+
+var (
+	errFavoriteNotFound = apperror.NotFound("Favorite not found")
+	errFavoriteLimit    = apperror.Conflict("favorite limit reached, remove a favorite first")
+	errFavoritesPage    = apperror.Validation("page_num must be at least 1 and page_size between 1 and 100")
+)
+
+// FAVORITE_MAX_PER_USER listings a user may save
+var favoriteMaxPerUser = cfg.Int("FAVORITE_MAX_PER_USER", 1000)
+
+// =========== INTERFACE HANDLER, HANDLING REQUEST RESPONSE API DEPEND INTERFACE ===========
+
+// handler request response favorites of user, newest first
+func getUserFavoritesHandler(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "handler error", "code", "085", "error", "Invalid user ID")
+		apperror.JSON(c, http.StatusBadRequest, "Invalid user ID")
+		return
+	}
+
+	pageNum, errNum := strconv.Atoi(c.DefaultQuery("page_num", "1"))
+	pageSize, errSize := strconv.Atoi(c.DefaultQuery("page_size", "20"))
+	if errNum != nil || errSize != nil {
+		apperror.Respond(c, errFavoritesPage)
+		return
+	}
+
+	favorites, pagination, err := getUserFavoritesUsecase(c.Request.Context(), id, pageNum, pageSize)
+	if err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"result": true, "favorites": favorites, "pagination": pagination})
+}
+
+// handler request response save listing for user, saving it again keeps the first save time
+func addUserFavoriteHandler(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "handler error", "code", "086", "error", "Invalid user ID")
+		apperror.JSON(c, http.StatusBadRequest, "Invalid user ID")
+		return
+	}
+
+	listingID, err := strconv.Atoi(c.Param("listing_id"))
+	if err != nil || listingID < 1 {
+		slog.ErrorContext(c.Request.Context(), "handler error", "code", "087", "error", "Invalid listing ID")
+		apperror.JSON(c, http.StatusBadRequest, "Invalid listing ID")
+		return
+	}
+
+	favorite, err := addUserFavoriteUsecase(c.Request.Context(), id, listingID)
+	if err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"result": true, "favorite": favorite})
+}
+
+// handler request response remove listing from favorites of user
+func removeUserFavoriteHandler(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "handler error", "code", "088", "error", "Invalid user ID")
+		apperror.JSON(c, http.StatusBadRequest, "Invalid user ID")
+		return
+	}
+
+	listingID, err := strconv.Atoi(c.Param("listing_id"))
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "handler error", "code", "089", "error", "Invalid listing ID")
+		apperror.JSON(c, http.StatusBadRequest, "Invalid listing ID")
+		return
+	}
+
+	if err := removeUserFavoriteUsecase(c.Request.Context(), id, listingID); err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"result": true})
+}
+
+// =========== USECASE LAYER, SERVES AS AN INTERMEDIARY BETWEEN THE PRESENTATION LAYER AND THE DATA LAYER ===========
+
+func getUserFavoritesUsecase(ctx context.Context, userID, pageNum, pageSize int) ([]Favorite, *Pagination, error) {
+	if pageNum < 1 || pageSize < 1 || pageSize > 100 {
+		return nil, nil, errFavoritesPage
+	}
+
+	if _, err := repo.FindByID(ctx, userID); err != nil {
+		if errors.Is(err, errUserNotFound) {
+			return nil, nil, err
+		}
+		return nil, nil, errors.New("database error: get user error database")
+	}
+
+	favorites, err := repo.FindFavoritesByUserID(ctx, userID, pageNum, pageSize)
+	if err != nil {
+		return nil, nil, errors.New("database error: get favorites error database")
+	}
+
+	total, err := repo.CountFavoritesByUserID(ctx, userID)
+	if err != nil {
+		return nil, nil, errors.New("database error: count favorites error database")
+	}
+
+	pagination := newPagination(pageNum, pageSize, total)
+	return favorites, &pagination, nil
+}
+
+func addUserFavoriteUsecase(ctx context.Context, userID, listingID int) (*Favorite, error) {
+	if _, err := repo.FindByID(ctx, userID); err != nil {
+		if errors.Is(err, errUserNotFound) {
+			return nil, err
+		}
+		return nil, errors.New("database error: get user error database")
+	}
+
+	// the limit only holds back new listings, saving a listing again always succeeds
+	favorite, err := repo.FindFavorite(ctx, userID, listingID)
+	if err != nil && !errors.Is(err, errFavoriteNotFound) {
+		return nil, errors.New("database error: get favorite error database")
+	}
+	if favorite != nil {
+		return favorite, nil
+	}
+
+	total, err := repo.CountFavoritesByUserID(ctx, userID)
+	if err != nil {
+		return nil, errors.New("database error: count favorites error database")
+	}
+	if total >= favoriteMaxPerUser {
+		return nil, errFavoriteLimit
+	}
+
+	favorite, err = repo.CreateFavorite(ctx, userID, listingID, time.Now().UnixMicro())
+	if err != nil {
+		return nil, errors.New("database error: create favorite error database")
+	}
+
+	return favorite, nil
+}
+
+func removeUserFavoriteUsecase(ctx context.Context, userID, listingID int) error {
+	removed, err := repo.DeleteFavorite(ctx, userID, listingID)
+	if err != nil {
+		return errors.New("database error: delete favorite error database")
+	}
+	if !removed {
+		return errFavoriteNotFound
+	}
+
+	return nil
+}
+
+// =========== REPOSITORY LAYER, ABSTRACTION OVER THE DATA PERSISTENCE (databases, file systems, or external APIs) ===========
+
+// page of favorites of user, newest first
+func (r *sqlUserRepository) FindFavoritesByUserID(ctx context.Context, userID, pageNum, pageSize int) ([]Favorite, error) {
+	ctx, done := r.observe(ctx, "findFavoritesByUserID")
+	defer done()
+
+	rows, err := r.query(ctx, "SELECT user_id, listing_id, created_at FROM favorites WHERE user_id = ? ORDER BY created_at DESC, listing_id DESC LIMIT ? OFFSET ?",
+		userID, pageSize, (pageNum-1)*pageSize)
+	if err != nil {
+		slog.ErrorContext(ctx, "handler error", "code", "090", "error", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	favorites := []Favorite{}
+	for rows.Next() {
+		var favorite Favorite
+		if err := rows.Scan(&favorite.UserID, &favorite.ListingID, &favorite.CreatedAt); err != nil {
+			slog.ErrorContext(ctx, "handler error", "code", "090", "error", err)
+			return nil, err
+		}
+		favorites = append(favorites, favorite)
+	}
+
+	return favorites, rows.Err()
+}
+
+func (r *sqlUserRepository) CountFavoritesByUserID(ctx context.Context, userID int) (int, error) {
+	ctx, done := r.observe(ctx, "countFavoritesByUserID")
+	defer done()
+
+	var total int
+	if err := r.queryRow(ctx, "SELECT COUNT(*) FROM favorites WHERE user_id = ?", userID).Scan(&total); err != nil {
+		slog.ErrorContext(ctx, "handler error", "code", "091", "error", err)
+		return 0, err
+	}
+
+	return total, nil
+}
+
+// favorite of user, errFavoriteNotFound when the user did not save the listing
+func (r *sqlUserRepository) FindFavorite(ctx context.Context, userID, listingID int) (*Favorite, error) {
+	ctx, done := r.observe(ctx, "findFavorite")
+	defer done()
+
+	var favorite Favorite
+	err := r.queryRow(ctx, "SELECT user_id, listing_id, created_at FROM favorites WHERE user_id = ? AND listing_id = ?", userID, listingID).
+		Scan(&favorite.UserID, &favorite.ListingID, &favorite.CreatedAt)
+	if err == sql.ErrNoRows {
+		return nil, errFavoriteNotFound
+	}
+	if err != nil {
+		slog.ErrorContext(ctx, "handler error", "code", "092", "error", err)
+		return nil, err
+	}
+
+	return &favorite, nil
+}
+
+// record favorite, a concurrent save of the same listing keeps the first save time
+func (r *sqlUserRepository) CreateFavorite(ctx context.Context, userID, listingID int, createdAt int64) (*Favorite, error) {
+	ctx, done := r.observe(ctx, "createFavorite")
+	defer done()
+
+	_, err := r.exec(ctx, "INSERT INTO favorites (user_id, listing_id, created_at) VALUES (?, ?, ?) ON CONFLICT DO NOTHING", userID, listingID, createdAt)
+	if err != nil {
+		slog.ErrorContext(ctx, "handler error", "code", "093", "error", err)
+		return nil, err
+	}
+
+	return r.FindFavorite(ctx, userID, listingID)
+}
+
+// delete favorite, false when the user had not saved the listing
+func (r *sqlUserRepository) DeleteFavorite(ctx context.Context, userID, listingID int) (bool, error) {
+	ctx, done := r.observe(ctx, "deleteFavorite")
+	defer done()
+
+	result, err := r.exec(ctx, "DELETE FROM favorites WHERE user_id = ? AND listing_id = ?", userID, listingID)
+	if err != nil {
+		slog.ErrorContext(ctx, "handler error", "code", "094", "error", err)
+		return false, err
+	}
+
+	removed, err := result.RowsAffected()
+	if err != nil {
+		slog.ErrorContext(ctx, "handler error", "code", "094", "error", err)
+		return false, err
+	}
+
+	return removed > 0, nil
+}
@@ -0,0 +1,618 @@
+package userservice
+
+import (
+	"context"
+	"errors"
+	"log"
+	"log/slog"
+	"net"
+
+	"apperror"
+	"events"
+	"rpc"
+
+	"github.com/gin-gonic/gin/binding"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// =========== INTERFACE HANDLER, GRPC CALLS WITH JSON MESSAGES FROM THE PUBLIC API ===========
+
+// GrpcServiceName full name of the user service in gRPC method paths, /users.UserService/<method>
+const GrpcServiceName = "users.UserService"
+
+// request and reply messages of the gRPC methods not carried by the http structs
+type (
+	UserIDRequest struct {
+		UserID int `json:"user_id"`
+	}
+	UserIDsRequest struct {
+		UserIDs []int `json:"user_ids"`
+	}
+	UpdateUserRequest struct {
+		UserID int        `json:"user_id"`
+		Update UserUpdate `json:"update"`
+	}
+	UsersPageRequest struct {
+		PageNum  int    `json:"page_num"`
+		PageSize int    `json:"page_size"`
+		SortBy   string `json:"sort_by"`
+		SortDir  string `json:"sort_dir"`
+	}
+	SetUserRoleRequest struct {
+		UserID int      `json:"user_id"`
+		Role   UserRole `json:"role"`
+	}
+	SetLegalHoldRequest struct {
+		UserID    int       `json:"user_id"`
+		LegalHold LegalHold `json:"legal_hold"`
+	}
+	DeleteUserRequest struct {
+		UserID int  `json:"user_id"`
+		Hard   bool `json:"hard"`
+	}
+	AcceptPolicyRequest struct {
+		UserID int                 `json:"user_id"`
+		Accept PolicyVersionCreate `json:"accept"`
+	}
+	BlockUserRequest struct {
+		UserID int         `json:"user_id"`
+		Block  BlockCreate `json:"block"`
+	}
+	UnblockUserRequest struct {
+		UserID        int `json:"user_id"`
+		BlockedUserID int `json:"blocked_user_id"`
+	}
+	UpdatePrivacyRequest struct {
+		UserID int           `json:"user_id"`
+		Update PrivacyUpdate `json:"update"`
+	}
+	UpdateNotificationPreferencesRequest struct {
+		UserID int                           `json:"user_id"`
+		Update NotificationPreferencesUpdate `json:"update"`
+	}
+	UserFavoritesRequest struct {
+		UserID   int `json:"user_id"`
+		PageNum  int `json:"page_num"`
+		PageSize int `json:"page_size"`
+	}
+	FavoriteRequest struct {
+		UserID    int `json:"user_id"`
+		ListingID int `json:"listing_id"`
+	}
+	RegisterDeviceRequest struct {
+		UserID int              `json:"user_id"`
+		Device PushDeviceCreate `json:"device"`
+	}
+	DeviceRequest struct {
+		UserID   int `json:"user_id"`
+		DeviceID int `json:"device_id"`
+	}
+	PushReceiptsRequest struct {
+		UserID   int `json:"user_id"`
+		DeviceID int `json:"device_id"`
+		Limit    int `json:"limit"`
+	}
+	UserInboxRequest struct {
+		UserID   int  `json:"user_id"`
+		Unread   bool `json:"unread"`
+		PageNum  int  `json:"page_num"`
+		PageSize int  `json:"page_size"`
+	}
+	CreateInboxNotificationRequest struct {
+		UserID       int                     `json:"user_id"`
+		Notification InboxNotificationCreate `json:"notification"`
+	}
+	MarkInboxReadRequest struct {
+		UserID int       `json:"user_id"`
+		Read   InboxRead `json:"read"`
+	}
+	BroadcastsRequest struct {
+		Limit int `json:"limit"`
+	}
+	BroadcastRequest struct {
+		BroadcastID int `json:"broadcast_id"`
+	}
+	BroadcastStatsRequest struct {
+		BroadcastID int            `json:"broadcast_id"`
+		Stats       BroadcastStats `json:"stats"`
+	}
+	UserEmailEventsRequest struct {
+		UserID int `json:"user_id"`
+		Limit  int `json:"limit"`
+	}
+	EmailSuppressionsRequest struct {
+		Reason string `json:"reason"`
+		Limit  int    `json:"limit"`
+	}
+	SuppressUserEmailRequest struct {
+		UserID      int                    `json:"user_id"`
+		Suppression EmailSuppressionCreate `json:"suppression"`
+	}
+	NotificationTemplateRequest struct {
+		Event   string `json:"event"`
+		Channel string `json:"channel"`
+		Locale  string `json:"locale"`
+	}
+	SaveContentRuleRequest struct {
+		Name string          `json:"name"`
+		Rule ContentRuleSave `json:"rule"`
+	}
+	ContentRuleRequest struct {
+		Name string `json:"name"`
+	}
+	OutboxEventsRequest struct {
+		Filter  events.ReplayFilter `json:"filter"`
+		AfterID int64               `json:"after_id"`
+		Limit   int                 `json:"limit"`
+	}
+	DeadLettersRequest struct {
+		Source   string `json:"source"`
+		PageNum  int    `json:"page_num"`
+		PageSize int    `json:"page_size"`
+	}
+	DeadLetterRequest struct {
+		ID int64 `json:"id"`
+	}
+	UpdateDeadLetterRequest struct {
+		ID     int64            `json:"id"`
+		Update DeadLetterUpdate `json:"update"`
+	}
+	AdminActionsRequest struct {
+		Status   string `json:"status"`
+		PageNum  int    `json:"page_num"`
+		PageSize int    `json:"page_size"`
+	}
+	AdminActionRequest struct {
+		ID int64 `json:"id"`
+	}
+	DecideAdminActionRequest struct {
+		ID       int64               `json:"id"`
+		Decision AdminActionDecision `json:"decision"`
+	}
+	AdminActionOutcomeRequest struct {
+		ID      int64              `json:"id"`
+		Outcome AdminActionOutcome `json:"outcome"`
+	}
+	AuditLogRequest struct {
+		Filter   AuditLogFilter `json:"filter"`
+		PageNum  int            `json:"page_num"`
+		PageSize int            `json:"page_size"`
+	}
+	AuditChainRequest struct {
+		AfterID int64 `json:"after_id"`
+		Limit   int   `json:"limit"`
+	}
+	CreateWebhookRequest struct {
+		UserID  int           `json:"user_id"`
+		Webhook WebhookCreate `json:"webhook"`
+	}
+	WebhookRequest struct {
+		UserID    int `json:"user_id"`
+		WebhookID int `json:"webhook_id"`
+	}
+	WebhookDeliveriesRequest struct {
+		UserID    int    `json:"user_id"`
+		WebhookID int    `json:"webhook_id"`
+		Status    string `json:"status"`
+		Limit     int    `json:"limit"`
+	}
+	UsersReply struct {
+		Users []User `json:"users"`
+	}
+	UsersPageReply struct {
+		Users      []User      `json:"users"`
+		Pagination *Pagination `json:"pagination"`
+	}
+	LoginReply struct {
+		Token     string `json:"token"`
+		ExpiresAt int64  `json:"expires_at"`
+	}
+	PoliciesReply struct {
+		Policies []PolicyVersion `json:"policies"`
+	}
+	ConsentsReply struct {
+		Consents []Consent       `json:"consents"`
+		Pending  []PolicyVersion `json:"pending"`
+	}
+	BlocksReply struct {
+		Blocks []Block `json:"blocks"`
+	}
+	FavoritesReply struct {
+		Favorites  []Favorite  `json:"favorites"`
+		Pagination *Pagination `json:"pagination"`
+	}
+	DevicesReply struct {
+		Devices []PushDevice `json:"devices"`
+	}
+	PushReceiptsReply struct {
+		Receipts []PushReceipt `json:"receipts"`
+	}
+	InboxReply struct {
+		Notifications []InboxNotification `json:"notifications"`
+		UnreadCount   int                 `json:"unread_count"`
+		Pagination    *Pagination         `json:"pagination"`
+	}
+	InboxReadReply struct {
+		Updated     int `json:"updated"`
+		UnreadCount int `json:"unread_count"`
+	}
+	BroadcastsReply struct {
+		Broadcasts []Broadcast `json:"broadcasts"`
+	}
+	CreateBroadcastReply struct {
+		Broadcast     *Broadcast `json:"broadcast"`
+		AudienceCount int        `json:"audience_count"`
+	}
+	AudienceCountReply struct {
+		AudienceCount int `json:"audience_count"`
+	}
+	RecordEmailEventsReply struct {
+		Suppressed []int `json:"suppressed"`
+	}
+	EmailEventsReply struct {
+		Events []EmailEvent `json:"events"`
+	}
+	EmailSuppressionsReply struct {
+		Suppressions []EmailSuppression `json:"suppressions"`
+	}
+	NotificationTemplatesReply struct {
+		Templates []NotificationTemplate `json:"templates"`
+	}
+	ContentRulesReply struct {
+		Rules []ContentRule `json:"rules"`
+	}
+	OutboxEventsReply struct {
+		Events []OutboxEvent `json:"events"`
+	}
+	DeadLettersReply struct {
+		DeadLetters []DeadLetter `json:"dead_letters"`
+		Pagination  *Pagination  `json:"pagination"`
+	}
+	AdminActionsReply struct {
+		AdminActions []AdminAction `json:"admin_actions"`
+		Pagination   *Pagination   `json:"pagination"`
+	}
+	AuditChainReply struct {
+		Entries []AuditEntry `json:"entries"`
+	}
+	AuditLogReply struct {
+		Entries    []AuditEntry `json:"entries"`
+		Pagination *Pagination  `json:"pagination"`
+	}
+	WebhooksReply struct {
+		Webhooks []Webhook `json:"webhooks"`
+	}
+	WebhookDeliveriesReply struct {
+		Deliveries []WebhookDelivery `json:"deliveries"`
+	}
+	PublishWebhookEventReply struct {
+		Deliveries int `json:"deliveries"`
+	}
+	Empty struct{}
+)
+
+var userServiceDesc = grpc.ServiceDesc{
+	ServiceName: GrpcServiceName,
+	HandlerType: (*any)(nil),
+	Methods: []grpc.MethodDesc{
+		unary("FindUser", func(ctx context.Context, req *UserIDRequest) (any, error) {
+			return FindUser(ctx, req.UserID)
+		}),
+		unary("FindUsers", func(ctx context.Context, req *UserIDsRequest) (any, error) {
+			users, err := FindUsers(ctx, req.UserIDs)
+			return &UsersReply{Users: users}, err
+		}),
+		unary("ListUsers", func(ctx context.Context, req *UsersPageRequest) (any, error) {
+			users, pagination, err := ListUsers(ctx, req.PageNum, req.PageSize, req.SortBy, req.SortDir)
+			return &UsersPageReply{Users: users, Pagination: pagination}, err
+		}),
+		unary("CreateUser", func(ctx context.Context, req *UserCreate) (any, error) {
+			return CreateUser(ctx, *req)
+		}),
+		unary("UpdateUser", func(ctx context.Context, req *UpdateUserRequest) (any, error) {
+			return UpdateUser(ctx, req.UserID, req.Update)
+		}),
+		unary("DeleteUser", func(ctx context.Context, req *DeleteUserRequest) (any, error) {
+			return &Empty{}, DeleteUser(ctx, req.UserID, req.Hard)
+		}),
+		unary("SetUserRole", func(ctx context.Context, req *SetUserRoleRequest) (any, error) {
+			return SetUserRole(ctx, req.UserID, req.Role.Role)
+		}),
+		unary("SetLegalHold", func(ctx context.Context, req *SetLegalHoldRequest) (any, error) {
+			return &Empty{}, SetLegalHold(ctx, req.UserID, req.LegalHold, "grpc")
+		}),
+		unary("Login", func(ctx context.Context, req *Login) (any, error) {
+			token, expiresAt, err := LoginUser(ctx, *req)
+			return &LoginReply{Token: token, ExpiresAt: expiresAt}, err
+		}),
+		unary("CurrentPolicies", func(ctx context.Context, req *Empty) (any, error) {
+			policies, err := CurrentPolicies(ctx)
+			return &PoliciesReply{Policies: policies}, err
+		}),
+		unary("UserConsents", func(ctx context.Context, req *UserIDRequest) (any, error) {
+			consents, pending, err := UserConsents(ctx, req.UserID)
+			return &ConsentsReply{Consents: consents, Pending: pending}, err
+		}),
+		unary("AcceptPolicy", func(ctx context.Context, req *AcceptPolicyRequest) (any, error) {
+			return AcceptPolicy(ctx, req.UserID, req.Accept)
+		}),
+		unary("UserBlocks", func(ctx context.Context, req *UserIDRequest) (any, error) {
+			blocks, err := UserBlocks(ctx, req.UserID)
+			return &BlocksReply{Blocks: blocks}, err
+		}),
+		unary("BlockUser", func(ctx context.Context, req *BlockUserRequest) (any, error) {
+			return BlockUser(ctx, req.UserID, req.Block)
+		}),
+		unary("UnblockUser", func(ctx context.Context, req *UnblockUserRequest) (any, error) {
+			return &Empty{}, UnblockUser(ctx, req.UserID, req.BlockedUserID)
+		}),
+		unary("UserPrivacy", func(ctx context.Context, req *UserIDRequest) (any, error) {
+			return UserPrivacy(ctx, req.UserID)
+		}),
+		unary("UpdateUserPrivacy", func(ctx context.Context, req *UpdatePrivacyRequest) (any, error) {
+			return UpdateUserPrivacy(ctx, req.UserID, req.Update)
+		}),
+		unary("NotificationPreferences", func(ctx context.Context, req *UserIDRequest) (any, error) {
+			return UserNotificationPreferences(ctx, req.UserID)
+		}),
+		unary("UpdateNotificationPreferences", func(ctx context.Context, req *UpdateNotificationPreferencesRequest) (any, error) {
+			return UpdateNotificationPreferences(ctx, req.UserID, req.Update)
+		}),
+		unary("UserFavorites", func(ctx context.Context, req *UserFavoritesRequest) (any, error) {
+			favorites, pagination, err := UserFavorites(ctx, req.UserID, req.PageNum, req.PageSize)
+			return &FavoritesReply{Favorites: favorites, Pagination: pagination}, err
+		}),
+		unary("AddFavorite", func(ctx context.Context, req *FavoriteRequest) (any, error) {
+			return AddFavorite(ctx, req.UserID, req.ListingID)
+		}),
+		unary("RemoveFavorite", func(ctx context.Context, req *FavoriteRequest) (any, error) {
+			return &Empty{}, RemoveFavorite(ctx, req.UserID, req.ListingID)
+		}),
+		unary("UserDevices", func(ctx context.Context, req *UserIDRequest) (any, error) {
+			devices, err := UserDevices(ctx, req.UserID)
+			return &DevicesReply{Devices: devices}, err
+		}),
+		unary("RegisterDevice", func(ctx context.Context, req *RegisterDeviceRequest) (any, error) {
+			return RegisterDevice(ctx, req.UserID, req.Device)
+		}),
+		unary("DeleteDevice", func(ctx context.Context, req *DeviceRequest) (any, error) {
+			return &Empty{}, DeleteDevice(ctx, req.UserID, req.DeviceID)
+		}),
+		unary("PushReceipts", func(ctx context.Context, req *PushReceiptsRequest) (any, error) {
+			receipts, err := PushReceipts(ctx, req.UserID, req.DeviceID, req.Limit)
+			return &PushReceiptsReply{Receipts: receipts}, err
+		}),
+		unary("RecordPushReceipts", func(ctx context.Context, req *PushReceiptsCreate) (any, error) {
+			return &Empty{}, RecordPushReceipts(ctx, req.Receipts)
+		}),
+		unary("UserInbox", func(ctx context.Context, req *UserInboxRequest) (any, error) {
+			notifications, unreadCount, pagination, err := UserInbox(ctx, req.UserID, req.Unread, req.PageNum, req.PageSize)
+			return &InboxReply{Notifications: notifications, UnreadCount: unreadCount, Pagination: pagination}, err
+		}),
+		unary("CreateInboxNotification", func(ctx context.Context, req *CreateInboxNotificationRequest) (any, error) {
+			return CreateInboxNotification(ctx, req.UserID, req.Notification)
+		}),
+		unary("MarkInboxRead", func(ctx context.Context, req *MarkInboxReadRequest) (any, error) {
+			updated, unreadCount, err := MarkInboxRead(ctx, req.UserID, req.Read.IDs)
+			return &InboxReadReply{Updated: updated, UnreadCount: unreadCount}, err
+		}),
+		unary("Broadcasts", func(ctx context.Context, req *BroadcastsRequest) (any, error) {
+			broadcasts, err := Broadcasts(ctx, req.Limit)
+			return &BroadcastsReply{Broadcasts: broadcasts}, err
+		}),
+		unary("CreateBroadcast", func(ctx context.Context, req *BroadcastCreate) (any, error) {
+			broadcast, audienceCount, err := CreateBroadcast(ctx, *req)
+			return &CreateBroadcastReply{Broadcast: broadcast, AudienceCount: audienceCount}, err
+		}),
+		unary("BroadcastAudienceCount", func(ctx context.Context, req *BroadcastAudience) (any, error) {
+			count, err := BroadcastAudienceCount(ctx, *req)
+			return &AudienceCountReply{AudienceCount: count}, err
+		}),
+		unary("Broadcast", func(ctx context.Context, req *BroadcastRequest) (any, error) {
+			return GetBroadcast(ctx, req.BroadcastID)
+		}),
+		unary("CancelBroadcast", func(ctx context.Context, req *BroadcastRequest) (any, error) {
+			return CancelBroadcast(ctx, req.BroadcastID)
+		}),
+		unary("ClaimBroadcastRecipients", func(ctx context.Context, req *BroadcastClaim) (any, error) {
+			return ClaimBroadcastRecipients(ctx, req.Limit)
+		}),
+		unary("RecordBroadcastStats", func(ctx context.Context, req *BroadcastStatsRequest) (any, error) {
+			return &Empty{}, RecordBroadcastStats(ctx, req.BroadcastID, req.Stats)
+		}),
+		unary("RecordEmailEvents", func(ctx context.Context, req *EmailEventsCreate) (any, error) {
+			suppressed, err := RecordEmailEvents(ctx, req.Events)
+			return &RecordEmailEventsReply{Suppressed: suppressed}, err
+		}),
+		unary("UserEmailEvents", func(ctx context.Context, req *UserEmailEventsRequest) (any, error) {
+			emailEvents, err := UserEmailEvents(ctx, req.UserID, req.Limit)
+			return &EmailEventsReply{Events: emailEvents}, err
+		}),
+		unary("EmailSuppressions", func(ctx context.Context, req *EmailSuppressionsRequest) (any, error) {
+			suppressions, err := EmailSuppressions(ctx, req.Reason, req.Limit)
+			return &EmailSuppressionsReply{Suppressions: suppressions}, err
+		}),
+		unary("UserEmailSuppression", func(ctx context.Context, req *UserIDRequest) (any, error) {
+			return UserEmailSuppression(ctx, req.UserID)
+		}),
+		unary("SuppressUserEmail", func(ctx context.Context, req *SuppressUserEmailRequest) (any, error) {
+			return SuppressUserEmail(ctx, req.UserID, req.Suppression)
+		}),
+		unary("UnsuppressUserEmail", func(ctx context.Context, req *UserIDRequest) (any, error) {
+			return &Empty{}, UnsuppressUserEmail(ctx, req.UserID)
+		}),
+		unary("RecordAudit", func(ctx context.Context, req *AuditEntry) (any, error) {
+			return RecordAudit(ctx, *req)
+		}),
+		unary("AuditLog", func(ctx context.Context, req *AuditLogRequest) (any, error) {
+			entries, pagination, err := AuditLog(ctx, req.Filter, req.PageNum, req.PageSize)
+			return &AuditLogReply{Entries: entries, Pagination: pagination}, err
+		}),
+		unary("AuditChain", func(ctx context.Context, req *AuditChainRequest) (any, error) {
+			entries, err := AuditChain(ctx, req.AfterID, req.Limit)
+			return &AuditChainReply{Entries: entries}, err
+		}),
+		unary("VerifyAuditChain", func(ctx context.Context, req *Empty) (any, error) {
+			return VerifyAuditChain(ctx)
+		}),
+		unary("NotificationTemplates", func(ctx context.Context, req *Empty) (any, error) {
+			templates, err := NotificationTemplates(ctx)
+			return &NotificationTemplatesReply{Templates: templates}, err
+		}),
+		unary("NotificationTemplateVersions", func(ctx context.Context, req *NotificationTemplateRequest) (any, error) {
+			templates, err := NotificationTemplateVersions(ctx, req.Event, req.Channel, req.Locale)
+			return &NotificationTemplatesReply{Templates: templates}, err
+		}),
+		unary("CreateNotificationTemplate", func(ctx context.Context, req *NotificationTemplateCreate) (any, error) {
+			return CreateNotificationTemplate(ctx, *req)
+		}),
+		unary("DeleteNotificationTemplate", func(ctx context.Context, req *NotificationTemplateRequest) (any, error) {
+			return &Empty{}, DeleteNotificationTemplate(ctx, req.Event, req.Channel, req.Locale)
+		}),
+		unary("ContentRules", func(ctx context.Context, req *Empty) (any, error) {
+			rules, err := ContentRules(ctx)
+			return &ContentRulesReply{Rules: rules}, err
+		}),
+		unary("SaveContentRule", func(ctx context.Context, req *SaveContentRuleRequest) (any, error) {
+			return SaveContentRule(ctx, req.Name, req.Rule)
+		}),
+		unary("DeleteContentRule", func(ctx context.Context, req *ContentRuleRequest) (any, error) {
+			return &Empty{}, DeleteContentRule(ctx, req.Name)
+		}),
+		unary("OutboxEvents", func(ctx context.Context, req *OutboxEventsRequest) (any, error) {
+			outboxEvents, err := OutboxEvents(ctx, req.Filter, req.AfterID, req.Limit)
+			return &OutboxEventsReply{Events: outboxEvents}, err
+		}),
+		unary("DeadLetters", func(ctx context.Context, req *DeadLettersRequest) (any, error) {
+			letters, pagination, err := DeadLetters(ctx, req.Source, req.PageNum, req.PageSize)
+			return &DeadLettersReply{DeadLetters: letters, Pagination: pagination}, err
+		}),
+		unary("DeadLetter", func(ctx context.Context, req *DeadLetterRequest) (any, error) {
+			return GetDeadLetter(ctx, req.ID)
+		}),
+		unary("CreateDeadLetter", func(ctx context.Context, req *DeadLetterCreate) (any, error) {
+			return CreateDeadLetter(ctx, *req)
+		}),
+		unary("UpdateDeadLetter", func(ctx context.Context, req *UpdateDeadLetterRequest) (any, error) {
+			return UpdateDeadLetter(ctx, req.ID, req.Update)
+		}),
+		unary("RequeueDeadLetter", func(ctx context.Context, req *DeadLetterRequest) (any, error) {
+			return RequeueDeadLetter(ctx, req.ID)
+		}),
+		unary("DeleteDeadLetter", func(ctx context.Context, req *DeadLetterRequest) (any, error) {
+			return &Empty{}, DeleteDeadLetter(ctx, req.ID)
+		}),
+		unary("AdminActions", func(ctx context.Context, req *AdminActionsRequest) (any, error) {
+			actions, pagination, err := AdminActions(ctx, req.Status, req.PageNum, req.PageSize)
+			return &AdminActionsReply{AdminActions: actions, Pagination: pagination}, err
+		}),
+		unary("AdminAction", func(ctx context.Context, req *AdminActionRequest) (any, error) {
+			return GetAdminAction(ctx, req.ID)
+		}),
+		unary("CreateAdminAction", func(ctx context.Context, req *AdminActionCreate) (any, error) {
+			return CreateAdminAction(ctx, *req)
+		}),
+		unary("DecideAdminAction", func(ctx context.Context, req *DecideAdminActionRequest) (any, error) {
+			return DecideAdminAction(ctx, req.ID, req.Decision)
+		}),
+		unary("RecordAdminActionOutcome", func(ctx context.Context, req *AdminActionOutcomeRequest) (any, error) {
+			return RecordAdminActionOutcome(ctx, req.ID, req.Outcome)
+		}),
+		unary("UserWebhooks", func(ctx context.Context, req *UserIDRequest) (any, error) {
+			webhooks, err := UserWebhooks(ctx, req.UserID)
+			return &WebhooksReply{Webhooks: webhooks}, err
+		}),
+		unary("CreateWebhook", func(ctx context.Context, req *CreateWebhookRequest) (any, error) {
+			return CreateWebhook(ctx, req.UserID, req.Webhook)
+		}),
+		unary("DeleteWebhook", func(ctx context.Context, req *WebhookRequest) (any, error) {
+			return &Empty{}, DeleteWebhook(ctx, req.UserID, req.WebhookID)
+		}),
+		unary("WebhookDeliveries", func(ctx context.Context, req *WebhookDeliveriesRequest) (any, error) {
+			deliveries, err := WebhookDeliveries(ctx, req.UserID, req.WebhookID, req.Status, req.Limit)
+			return &WebhookDeliveriesReply{Deliveries: deliveries}, err
+		}),
+		unary("PublishWebhookEvent", func(ctx context.Context, req *events.Event) (any, error) {
+			queued, err := PublishWebhookEvent(ctx, *req)
+			return &PublishWebhookEventReply{Deliveries: queued}, err
+		}),
+	},
+}
+
+// method decoding its request into Req, errors of call are answered with the grpc code of their kind
+func unary[Req any](name string, call func(ctx context.Context, req *Req) (any, error)) grpc.MethodDesc {
+	return grpc.MethodDesc{
+		MethodName: name,
+		Handler: func(srv any, ctx context.Context, dec func(any) error, interceptor grpc.UnaryServerInterceptor) (any, error) {
+			req := new(Req)
+			if err := dec(req); err != nil {
+				return nil, status.Error(codes.InvalidArgument, "Invalid body request")
+			}
+			// same binding tags as the http handlers
+			if err := binding.Validator.ValidateStruct(req); err != nil {
+				return nil, status.Error(codes.InvalidArgument, "Validation failed")
+			}
+
+			handler := func(ctx context.Context, req any) (any, error) {
+				resp, err := call(ctx, req.(*Req))
+				if err != nil {
+					return nil, grpcStatus(ctx, err)
+				}
+				return resp, nil
+			}
+			if interceptor == nil {
+				return handler(ctx, req)
+			}
+			return interceptor(ctx, req, &grpc.UnaryServerInfo{Server: srv, FullMethod: "/" + GrpcServiceName + "/" + name}, handler)
+		},
+	}
+}
+
+// grpc code matching the http status of err, internal errors hide their message
+func grpcStatus(ctx context.Context, err error) error {
+	var appErr *apperror.Error
+	switch {
+	case errors.Is(err, errInvalidCredentials):
+		return status.Error(codes.Unauthenticated, "Invalid user ID or password")
+	case errors.Is(err, context.DeadlineExceeded):
+		return status.Error(codes.DeadlineExceeded, "Request timed out")
+	case !errors.As(err, &appErr) || appErr.Kind == nil:
+		slog.ErrorContext(ctx, "grpc error", "code", "046", "error", err)
+		return status.Error(codes.Internal, "Internal Server Error")
+	case errors.Is(err, apperror.ErrNotFound):
+		return status.Error(codes.NotFound, appErr.Message)
+	case errors.Is(err, apperror.ErrValidation):
+		return status.Error(codes.InvalidArgument, appErr.Message)
+	case errors.Is(err, apperror.ErrConflict):
+		return status.Error(codes.FailedPrecondition, appErr.Message)
+	default:
+		return status.Error(codes.Internal, appErr.Message)
+	}
+}
+
+// GRPC_PORT also serve the user service over gRPC on this port of BIND_ADDRESS, empty disables it
+func startGRPC() (stop func()) {
+	port := cfg.String("GRPC_PORT", "")
+	if port == "" {
+		return func() {}
+	}
+
+	addr := net.JoinHostPort(cfg.BindAddress(), port)
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	srv := grpc.NewServer(grpc.ChainUnaryInterceptor(rpc.ServerInterceptor(internalAPIKey)))
+	srv.RegisterService(&userServiceDesc, nil)
+	go func() {
+		if err := srv.Serve(listener); err != nil {
+			log.Fatal(err)
+		}
+	}()
+	slog.Info("starting user service grpc", "addr", addr)
+
+	return srv.GracefulStop
+}
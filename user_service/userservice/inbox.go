@@ -0,0 +1,317 @@
+package userservice
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"apperror"
+
+	"github.com/gin-gonic/gin"
+)
+
+// notification kept in the inbox of a user for the in-app channel, rendered by the public API when it is sent
+type InboxNotification struct {
+	ID     int64  `json:"id"`
+	UserID int    `json:"user_id"`
+	Event  string `json:"event"`
+	Title  string `json:"title"`
+	Body   string `json:"body"`
+	// event and ids of the notification, for the app to open the right screen
+	Data      map[string]string `json:"data"`
+	ReadAt    *int64            `json:"read_at"`
+	CreatedAt int64             `json:"created_at"`
+}
+
+type InboxNotificationCreate struct {
+	Event string            `json:"event" binding:"required,notblank,max=64"`
+	Title string            `json:"title" binding:"required,notblank,max=200"`
+	Body  string            `json:"body" binding:"max=2000"`
+	Data  map[string]string `json:"data" binding:"max=20"`
+}
+
+// notifications to mark read, every unread notification of the user when ids is empty
+type InboxRead struct {
+	IDs []int64 `json:"ids" binding:"max=100"`
+}
+
+var errInboxPage = apperror.Validation("page_num must be at least 1 and page_size between 1 and 100")
+
+// INBOX_RETENTION how long notifications are kept in the inbox, read or not
+var inboxRetention = cfg.Duration("INBOX_RETENTION", 90*24*time.Hour)
+
+// =========== INTERFACE HANDLER, HANDLING REQUEST RESPONSE API DEPEND INTERFACE ===========
+
+// handler request response inbox of user newest first with the count of unread notifications, ?unread=true for the
+// unread ones only
+func getUserInboxHandler(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "handler error", "code", "109", "error", "Invalid user ID")
+		apperror.JSON(c, http.StatusBadRequest, "Invalid user ID")
+		return
+	}
+
+	pageNum, errNum := strconv.Atoi(c.DefaultQuery("page_num", "1"))
+	pageSize, errSize := strconv.Atoi(c.DefaultQuery("page_size", "20"))
+	if errNum != nil || errSize != nil {
+		apperror.Respond(c, errInboxPage)
+		return
+	}
+
+	unread, err := strconv.ParseBool(c.DefaultQuery("unread", "false"))
+	if err != nil {
+		apperror.JSON(c, http.StatusBadRequest, "unread must be true or false")
+		return
+	}
+
+	notifications, unreadCount, pagination, err := getUserInboxUsecase(c.Request.Context(), id, unread, pageNum, pageSize)
+	if err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"result": true, "notifications": notifications, "unread_count": unreadCount, "pagination": pagination})
+}
+
+// handler request response add notification to the inbox of user, sent by the public API
+func createInboxNotificationHandler(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "handler error", "code", "110", "error", "Invalid user ID")
+		apperror.JSON(c, http.StatusBadRequest, "Invalid user ID")
+		return
+	}
+
+	var body InboxNotificationCreate
+	if err := c.ShouldBindJSON(&body); err != nil {
+		slog.ErrorContext(c.Request.Context(), "handler error", "code", "111", "error", err)
+		apperror.RespondBinding(c, err)
+		return
+	}
+
+	notification, err := createInboxNotificationUsecase(c.Request.Context(), id, body)
+	if err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"result": true, "notification": notification})
+}
+
+// handler request response mark notifications of user read, ids of other users are ignored
+func markInboxReadHandler(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "handler error", "code", "112", "error", "Invalid user ID")
+		apperror.JSON(c, http.StatusBadRequest, "Invalid user ID")
+		return
+	}
+
+	var body InboxRead
+	if err := c.ShouldBindJSON(&body); err != nil {
+		slog.ErrorContext(c.Request.Context(), "handler error", "code", "113", "error", err)
+		apperror.RespondBinding(c, err)
+		return
+	}
+
+	updated, unreadCount, err := markInboxReadUsecase(c.Request.Context(), id, body.IDs)
+	if err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"result": true, "updated": updated, "unread_count": unreadCount})
+}
+
+// =========== USECASE LAYER, SERVES AS AN INTERMEDIARY BETWEEN THE PRESENTATION LAYER AND THE DATA LAYER ===========
+
+func getUserInboxUsecase(ctx context.Context, userID int, unread bool, pageNum, pageSize int) ([]InboxNotification, int, *Pagination, error) {
+	if pageNum < 1 || pageSize < 1 || pageSize > 100 {
+		return nil, 0, nil, errInboxPage
+	}
+
+	if _, err := repo.FindByID(ctx, userID); err != nil {
+		if errors.Is(err, errUserNotFound) {
+			return nil, 0, nil, err
+		}
+		return nil, 0, nil, errors.New("database error: get user error database")
+	}
+
+	notifications, err := repo.FindInboxNotifications(ctx, userID, unread, pageNum, pageSize)
+	if err != nil {
+		return nil, 0, nil, errors.New("database error: get inbox error database")
+	}
+
+	unreadCount, err := repo.CountInboxNotifications(ctx, userID, true)
+	if err != nil {
+		return nil, 0, nil, errors.New("database error: count inbox error database")
+	}
+
+	total := unreadCount
+	if !unread {
+		if total, err = repo.CountInboxNotifications(ctx, userID, false); err != nil {
+			return nil, 0, nil, errors.New("database error: count inbox error database")
+		}
+	}
+
+	pagination := newPagination(pageNum, pageSize, total)
+	return notifications, unreadCount, &pagination, nil
+}
+
+// store notification unread and drop notifications of the user past INBOX_RETENTION
+func createInboxNotificationUsecase(ctx context.Context, userID int, body InboxNotificationCreate) (*InboxNotification, error) {
+	if _, err := repo.FindByID(ctx, userID); err != nil {
+		if errors.Is(err, errUserNotFound) {
+			return nil, err
+		}
+		return nil, errors.New("database error: get user error database")
+	}
+
+	now := time.Now()
+	notification := &InboxNotification{UserID: userID, Event: body.Event, Title: body.Title, Body: body.Body, Data: body.Data, CreatedAt: now.UnixMicro()}
+	if notification.Data == nil {
+		notification.Data = map[string]string{}
+	}
+	if err := repo.CreateInboxNotification(ctx, notification, now.Add(-inboxRetention).UnixMicro()); err != nil {
+		return nil, errors.New("database error: create inbox notification error database")
+	}
+
+	return notification, nil
+}
+
+// mark ids read, every unread notification of the user when ids is empty, number marked and unread left
+func markInboxReadUsecase(ctx context.Context, userID int, ids []int64) (int, int, error) {
+	updated, err := repo.MarkInboxRead(ctx, userID, ids, time.Now().UnixMicro())
+	if err != nil {
+		return 0, 0, errors.New("database error: mark inbox read error database")
+	}
+
+	unreadCount, err := repo.CountInboxNotifications(ctx, userID, true)
+	if err != nil {
+		return 0, 0, errors.New("database error: count inbox error database")
+	}
+
+	return updated, unreadCount, nil
+}
+
+// =========== REPOSITORY LAYER, ABSTRACTION OVER THE DATA PERSISTENCE (databases, file systems, or external APIs) ===========
+
+// page of the inbox of user newest first, unread notifications only when unread
+func (r *sqlUserRepository) FindInboxNotifications(ctx context.Context, userID int, unread bool, pageNum, pageSize int) ([]InboxNotification, error) {
+	ctx, done := r.observe(ctx, "findInboxNotifications")
+	defer done()
+
+	query := "SELECT id, user_id, event, title, body, data, read_at, created_at FROM inbox_notifications WHERE user_id = ?"
+	if unread {
+		query += " AND read_at IS NULL"
+	}
+	rows, err := r.query(ctx, query+" ORDER BY id DESC LIMIT ? OFFSET ?", userID, pageSize, (pageNum-1)*pageSize)
+	if err != nil {
+		slog.ErrorContext(ctx, "handler error", "code", "114", "error", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	notifications := []InboxNotification{}
+	for rows.Next() {
+		var notification InboxNotification
+		var data string
+		var readAt sql.NullInt64
+		err := rows.Scan(&notification.ID, &notification.UserID, &notification.Event, &notification.Title, &notification.Body, &data, &readAt, &notification.CreatedAt)
+		if err == nil {
+			err = json.Unmarshal([]byte(data), &notification.Data)
+		}
+		if err != nil {
+			slog.ErrorContext(ctx, "handler error", "code", "114", "error", err)
+			return nil, err
+		}
+		if readAt.Valid {
+			notification.ReadAt = &readAt.Int64
+		}
+		notifications = append(notifications, notification)
+	}
+
+	return notifications, rows.Err()
+}
+
+func (r *sqlUserRepository) CountInboxNotifications(ctx context.Context, userID int, unread bool) (int, error) {
+	ctx, done := r.observe(ctx, "countInboxNotifications")
+	defer done()
+
+	query := "SELECT COUNT(*) FROM inbox_notifications WHERE user_id = ?"
+	if unread {
+		query += " AND read_at IS NULL"
+	}
+
+	var total int
+	if err := r.queryRow(ctx, query, userID).Scan(&total); err != nil {
+		slog.ErrorContext(ctx, "handler error", "code", "115", "error", err)
+		return 0, err
+	}
+
+	return total, nil
+}
+
+// insert notification setting its id and delete notifications of its user created before
+func (r *sqlUserRepository) CreateInboxNotification(ctx context.Context, notification *InboxNotification, before int64) error {
+	ctx, done := r.observe(ctx, "createInboxNotification")
+	defer done()
+
+	data, err := json.Marshal(notification.Data)
+	if err != nil {
+		return err
+	}
+
+	err = r.withTx(ctx, func(tx *sql.Tx) error {
+		err := tx.QueryRowContext(ctx, r.rebind("INSERT INTO inbox_notifications (user_id, event, title, body, data, created_at) VALUES (?, ?, ?, ?, ?, ?) RETURNING id"),
+			notification.UserID, notification.Event, notification.Title, notification.Body, string(data), notification.CreatedAt).Scan(&notification.ID)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.ExecContext(ctx, r.rebind("DELETE FROM inbox_notifications WHERE user_id = ? AND created_at < ?"), notification.UserID, before)
+		return err
+	})
+	if err != nil {
+		slog.ErrorContext(ctx, "handler error", "code", "116", "error", err)
+		return err
+	}
+
+	return nil
+}
+
+// set read_at of the unread notifications ids of user, all of them when ids is empty, number marked
+func (r *sqlUserRepository) MarkInboxRead(ctx context.Context, userID int, ids []int64, readAt int64) (int, error) {
+	ctx, done := r.observe(ctx, "markInboxRead")
+	defer done()
+
+	query := "UPDATE inbox_notifications SET read_at = ? WHERE user_id = ? AND read_at IS NULL"
+	args := []any{readAt, userID}
+	if len(ids) > 0 {
+		query += " AND id IN (?" + strings.Repeat(", ?", len(ids)-1) + ")"
+		for _, id := range ids {
+			args = append(args, id)
+		}
+	}
+
+	result, err := r.exec(ctx, query, args...)
+	if err != nil {
+		slog.ErrorContext(ctx, "handler error", "code", "117", "error", err)
+		return 0, err
+	}
+
+	updated, err := result.RowsAffected()
+	if err != nil {
+		slog.ErrorContext(ctx, "handler error", "code", "117", "error", err)
+		return 0, err
+	}
+
+	return int(updated), nil
+}
@@ -0,0 +1,374 @@
+package userservice
+
+import (
+	"context"
+
+	"events"
+)
+
+// =========== INTERFACE HANDLER, DIRECT CALLS FROM SERVICES RUNNING IN THE SAME PROCESS ===========
+
+// the usecases behind the http handlers, for the combined binary once New opened the database. Errors are
+// apperror kinds mapping to the status the handlers answer, login with a wrong user or password is ErrInvalidCredentials
+var ErrInvalidCredentials = errInvalidCredentials
+
+func FindUser(ctx context.Context, userID int) (*User, error) {
+	return getUserUsecase(ctx, userID)
+}
+
+func FindUsers(ctx context.Context, userIDs []int) ([]User, error) {
+	return getUsersByIDsUsecase(ctx, userIDs)
+}
+
+// page of users newest first, page 1 of 10 when zero
+func ListUsers(ctx context.Context, pageNum, pageSize int, sortBy, sortDir string) ([]User, *Pagination, error) {
+	if pageNum == 0 {
+		pageNum = 1
+	}
+	if pageSize == 0 {
+		pageSize = 10
+	}
+	return getUsersUsecase(ctx, pageNum, pageSize, sortBy, sortDir)
+}
+
+func CreateUser(ctx context.Context, create UserCreate) (*User, error) {
+	return createUserUsecase(ctx, create)
+}
+
+func UpdateUser(ctx context.Context, userID int, update UserUpdate) (*User, error) {
+	return updateUserUsecase(ctx, userID, update)
+}
+
+func DeleteUser(ctx context.Context, userID int, hard bool) error {
+	return deleteUserUsecase(ctx, userID, hard)
+}
+
+// caller names the service holding the user in the log of hold changes
+func SetLegalHold(ctx context.Context, userID int, hold LegalHold, caller string) error {
+	return setLegalHoldUsecase(ctx, userID, *hold.LegalHold, hold.Reason, caller)
+}
+
+func SetUserRole(ctx context.Context, userID int, role string) (*User, error) {
+	return setUserRoleUsecase(ctx, userID, role)
+}
+
+func LoginUser(ctx context.Context, login Login) (token string, expiresAt int64, err error) {
+	return loginUsecase(ctx, login.UserID, login.Password)
+}
+
+func CurrentPolicies(ctx context.Context) ([]PolicyVersion, error) {
+	return getCurrentPoliciesUsecase(ctx)
+}
+
+func UserConsents(ctx context.Context, userID int) (consents []Consent, pending []PolicyVersion, err error) {
+	return getUserConsentsUsecase(ctx, userID)
+}
+
+func AcceptPolicy(ctx context.Context, userID int, accept PolicyVersionCreate) (*Consent, error) {
+	return acceptPolicyUsecase(ctx, userID, accept.Kind, accept.Version)
+}
+
+func UserBlocks(ctx context.Context, userID int) ([]Block, error) {
+	return getUserBlocksUsecase(ctx, userID)
+}
+
+func BlockUser(ctx context.Context, userID int, block BlockCreate) (*Block, error) {
+	return blockUserUsecase(ctx, userID, block.BlockedUserID)
+}
+
+func UnblockUser(ctx context.Context, userID, blockedUserID int) error {
+	return unblockUserUsecase(ctx, userID, blockedUserID)
+}
+
+func UserPrivacy(ctx context.Context, userID int) (*PrivacySettings, error) {
+	return getUserPrivacyUsecase(ctx, userID)
+}
+
+func UpdateUserPrivacy(ctx context.Context, userID int, update PrivacyUpdate) (*PrivacySettings, error) {
+	return updateUserPrivacyUsecase(ctx, userID, update)
+}
+
+// every notification toggle of the user, defaults included
+func UserNotificationPreferences(ctx context.Context, userID int) (*NotificationPreferences, error) {
+	return getNotificationPreferencesUsecase(ctx, userID)
+}
+
+func UpdateNotificationPreferences(ctx context.Context, userID int, update NotificationPreferencesUpdate) (*NotificationPreferences, error) {
+	return updateNotificationPreferencesUsecase(ctx, userID, update)
+}
+
+// page of favorites of the user newest first, page 1 of 20 when zero
+func UserFavorites(ctx context.Context, userID, pageNum, pageSize int) ([]Favorite, *Pagination, error) {
+	if pageNum == 0 {
+		pageNum = 1
+	}
+	if pageSize == 0 {
+		pageSize = 20
+	}
+	return getUserFavoritesUsecase(ctx, userID, pageNum, pageSize)
+}
+
+func AddFavorite(ctx context.Context, userID, listingID int) (*Favorite, error) {
+	return addUserFavoriteUsecase(ctx, userID, listingID)
+}
+
+func RemoveFavorite(ctx context.Context, userID, listingID int) error {
+	return removeUserFavoriteUsecase(ctx, userID, listingID)
+}
+
+func UserDevices(ctx context.Context, userID int) ([]PushDevice, error) {
+	return getUserDevicesUsecase(ctx, userID)
+}
+
+func RegisterDevice(ctx context.Context, userID int, create PushDeviceCreate) (*PushDevice, error) {
+	return registerUserDeviceUsecase(ctx, userID, create)
+}
+
+func DeleteDevice(ctx context.Context, userID, deviceID int) error {
+	return deleteUserDeviceUsecase(ctx, userID, deviceID)
+}
+
+// receipts of a device of the user newest first, limit 50 when zero
+func PushReceipts(ctx context.Context, userID, deviceID, limit int) ([]PushReceipt, error) {
+	if limit == 0 {
+		limit = 50
+	}
+	return getPushReceiptsUsecase(ctx, userID, deviceID, limit)
+}
+
+func RecordPushReceipts(ctx context.Context, receipts []PushReceipt) error {
+	return recordPushReceiptsUsecase(ctx, receipts)
+}
+
+// page of the inbox of the user newest first and its unread count, page 1 of 20 when zero
+func UserInbox(ctx context.Context, userID int, unread bool, pageNum, pageSize int) ([]InboxNotification, int, *Pagination, error) {
+	if pageNum == 0 {
+		pageNum = 1
+	}
+	if pageSize == 0 {
+		pageSize = 20
+	}
+	return getUserInboxUsecase(ctx, userID, unread, pageNum, pageSize)
+}
+
+func CreateInboxNotification(ctx context.Context, userID int, create InboxNotificationCreate) (*InboxNotification, error) {
+	return createInboxNotificationUsecase(ctx, userID, create)
+}
+
+// mark notifications of the user read, all of them when ids is empty
+func MarkInboxRead(ctx context.Context, userID int, ids []int64) (int, int, error) {
+	return markInboxReadUsecase(ctx, userID, ids)
+}
+
+// broadcasts newest first, limit 50 when zero
+func Broadcasts(ctx context.Context, limit int) ([]Broadcast, error) {
+	if limit == 0 {
+		limit = 50
+	}
+	return getBroadcastsUsecase(ctx, limit)
+}
+
+// schedule broadcast, returns it with the number of users its audience has now
+func CreateBroadcast(ctx context.Context, create BroadcastCreate) (*Broadcast, int, error) {
+	return createBroadcastUsecase(ctx, create)
+}
+
+func BroadcastAudienceCount(ctx context.Context, audience BroadcastAudience) (int, error) {
+	return countBroadcastAudienceUsecase(ctx, audience)
+}
+
+func GetBroadcast(ctx context.Context, id int) (*Broadcast, error) {
+	return getBroadcastUsecase(ctx, id)
+}
+
+func CancelBroadcast(ctx context.Context, id int) (*Broadcast, error) {
+	return cancelBroadcastUsecase(ctx, id)
+}
+
+// next recipients of the due broadcast, a nil broadcast when none is due
+func ClaimBroadcastRecipients(ctx context.Context, limit int) (*BroadcastBatch, error) {
+	return claimBroadcastRecipientsUsecase(ctx, limit)
+}
+
+func RecordBroadcastStats(ctx context.Context, id int, stats BroadcastStats) error {
+	return recordBroadcastStatsUsecase(ctx, id, stats)
+}
+
+// record delivery events of notification emails, returns the users suppressed by them
+func RecordEmailEvents(ctx context.Context, emailEvents []EmailEvent) ([]int, error) {
+	return recordEmailEventsUsecase(ctx, emailEvents)
+}
+
+// latest email events of the user first, limit 50 when zero
+func UserEmailEvents(ctx context.Context, userID, limit int) ([]EmailEvent, error) {
+	if limit == 0 {
+		limit = 50
+	}
+	return getUserEmailEventsUsecase(ctx, userID, limit)
+}
+
+// suppressions newest first, of every reason when reason is empty, limit 50 when zero
+func EmailSuppressions(ctx context.Context, reason string, limit int) ([]EmailSuppression, error) {
+	if limit == 0 {
+		limit = 50
+	}
+	return getEmailSuppressionsUsecase(ctx, reason, limit)
+}
+
+func UserEmailSuppression(ctx context.Context, userID int) (*EmailSuppression, error) {
+	return getUserEmailSuppressionUsecase(ctx, userID)
+}
+
+func SuppressUserEmail(ctx context.Context, userID int, create EmailSuppressionCreate) (*EmailSuppression, error) {
+	return suppressUserEmailUsecase(ctx, userID, create)
+}
+
+func UnsuppressUserEmail(ctx context.Context, userID int) error {
+	return unsuppressUserEmailUsecase(ctx, userID)
+}
+
+func RecordAudit(ctx context.Context, entry AuditEntry) (*AuditEntry, error) {
+	return createAuditEntryUsecase(ctx, entry)
+}
+
+// page of the audit log matching filter newest first, page 1 of 50 when zero
+func AuditLog(ctx context.Context, filter AuditLogFilter, pageNum, pageSize int) ([]AuditEntry, *Pagination, error) {
+	if pageNum == 0 {
+		pageNum = 1
+	}
+	if pageSize == 0 {
+		pageSize = 50
+	}
+	return getAuditLogUsecase(ctx, filter, pageNum, pageSize)
+}
+
+// chained entries after afterID oldest first, 100 when limit is zero
+func AuditChain(ctx context.Context, afterID int64, limit int) ([]AuditEntry, error) {
+	if limit == 0 {
+		limit = 100
+	}
+	return getAuditChainUsecase(ctx, afterID, limit)
+}
+
+func VerifyAuditChain(ctx context.Context) (*AuditChainVerification, error) {
+	return verifyAuditChainUsecase(ctx)
+}
+
+func NotificationTemplates(ctx context.Context) ([]NotificationTemplate, error) {
+	return getNotificationTemplatesUsecase(ctx)
+}
+
+func NotificationTemplateVersions(ctx context.Context, event, channel, locale string) ([]NotificationTemplate, error) {
+	return getNotificationTemplateVersionsUsecase(ctx, event, channel, locale)
+}
+
+func CreateNotificationTemplate(ctx context.Context, create NotificationTemplateCreate) (*NotificationTemplate, error) {
+	return createNotificationTemplateUsecase(ctx, create)
+}
+
+func DeleteNotificationTemplate(ctx context.Context, event, channel, locale string) error {
+	return deleteNotificationTemplateUsecase(ctx, event, channel, locale)
+}
+
+func ContentRules(ctx context.Context) ([]ContentRule, error) {
+	return getContentRulesUsecase(ctx)
+}
+
+func SaveContentRule(ctx context.Context, name string, save ContentRuleSave) (*ContentRule, error) {
+	return saveContentRuleUsecase(ctx, name, save)
+}
+
+func DeleteContentRule(ctx context.Context, name string) error {
+	return deleteContentRuleUsecase(ctx, name)
+}
+
+// page of the delivered events of a time range with an outbox id above afterID oldest first, limit 500 when zero
+func OutboxEvents(ctx context.Context, filter events.ReplayFilter, afterID int64, limit int) ([]OutboxEvent, error) {
+	if limit == 0 {
+		limit = 500
+	}
+	return getOutboxEventsUsecase(ctx, filter, afterID, limit)
+}
+
+// page of the dead letters of source newest first, all sources when empty, page 1 of 50 when zero
+func DeadLetters(ctx context.Context, source string, pageNum, pageSize int) ([]DeadLetter, *Pagination, error) {
+	if pageNum == 0 {
+		pageNum = 1
+	}
+	if pageSize == 0 {
+		pageSize = 50
+	}
+	return getDeadLettersUsecase(ctx, source, pageNum, pageSize)
+}
+
+func GetDeadLetter(ctx context.Context, id int64) (*DeadLetter, error) {
+	return getDeadLetterUsecase(ctx, id)
+}
+
+func CreateDeadLetter(ctx context.Context, create DeadLetterCreate) (*DeadLetter, error) {
+	return createDeadLetterUsecase(ctx, create)
+}
+
+func UpdateDeadLetter(ctx context.Context, id int64, update DeadLetterUpdate) (*DeadLetter, error) {
+	return updateDeadLetterUsecase(ctx, id, update.Event)
+}
+
+func RequeueDeadLetter(ctx context.Context, id int64) (*DeadLetter, error) {
+	return requeueDeadLetterUsecase(ctx, id)
+}
+
+func DeleteDeadLetter(ctx context.Context, id int64) error {
+	return deleteDeadLetterUsecase(ctx, id)
+}
+
+// page of the admin actions of status newest first, all statuses when empty, page 1 of 50 when zero
+func AdminActions(ctx context.Context, status string, pageNum, pageSize int) ([]AdminAction, *Pagination, error) {
+	if pageNum == 0 {
+		pageNum = 1
+	}
+	if pageSize == 0 {
+		pageSize = 50
+	}
+	return getAdminActionsUsecase(ctx, status, pageNum, pageSize)
+}
+
+func GetAdminAction(ctx context.Context, id int64) (*AdminAction, error) {
+	return getAdminActionUsecase(ctx, id)
+}
+
+func CreateAdminAction(ctx context.Context, create AdminActionCreate) (*AdminAction, error) {
+	return createAdminActionUsecase(ctx, create)
+}
+
+func DecideAdminAction(ctx context.Context, id int64, decision AdminActionDecision) (*AdminAction, error) {
+	return decideAdminActionUsecase(ctx, id, decision)
+}
+
+func RecordAdminActionOutcome(ctx context.Context, id int64, outcome AdminActionOutcome) (*AdminAction, error) {
+	return recordAdminActionOutcomeUsecase(ctx, id, outcome)
+}
+
+func UserWebhooks(ctx context.Context, userID int) ([]Webhook, error) {
+	return getUserWebhooksUsecase(ctx, userID)
+}
+
+func CreateWebhook(ctx context.Context, userID int, create WebhookCreate) (*Webhook, error) {
+	return createUserWebhookUsecase(ctx, userID, create)
+}
+
+func DeleteWebhook(ctx context.Context, userID, webhookID int) error {
+	return deleteUserWebhookUsecase(ctx, userID, webhookID)
+}
+
+// deliveries of a webhook of the user, status empty for all, limit 50 when zero
+func WebhookDeliveries(ctx context.Context, userID, webhookID int, status string, limit int) ([]WebhookDelivery, error) {
+	if limit == 0 {
+		limit = 50
+	}
+	return getWebhookDeliveriesUsecase(ctx, userID, webhookID, status, limit)
+}
+
+// queue the deliveries of an event of another service, returns the count of webhooks of the event
+func PublishWebhookEvent(ctx context.Context, event events.Event) (int, error) {
+	return publishWebhookEventUsecase(ctx, event)
+}
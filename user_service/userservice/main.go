@@ -0,0 +1,932 @@
+// Package userservice store the users of the system and sign their login tokens, served on its own
+// by the user_service binary or mounted in the combined binary of the app module.
+package userservice
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"apperror"
+	"config"
+	"events"
+	"logging"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"go.opentelemetry.io/contrib/instrumentation/github.com/gin-gonic/gin/otelgin"
+)
+
+// service settings from env vars and optional CONFIG_FILE
+var cfg = config.MustLoad()
+
+type User struct {
+	ID        int    `json:"id"`
+	Name      string `json:"name"`
+	Role      string `json:"role"`
+	Email     string `json:"email,omitempty"`
+	CreatedAt int64  `json:"created_at"`
+	UpdatedAt int64  `json:"updated_at"`
+}
+
+// page position of a list response so clients can render pagers
+type Pagination struct {
+	PageNum    int  `json:"page_num"`
+	PageSize   int  `json:"page_size"`
+	TotalItems int  `json:"total_items"`
+	TotalPages int  `json:"total_pages"`
+	HasNext    bool `json:"has_next"`
+}
+
+func newPagination(pageNum, pageSize, totalItems int) Pagination {
+	totalPages := 0
+	if pageSize > 0 {
+		totalPages = (totalItems + pageSize - 1) / pageSize
+	}
+
+	return Pagination{
+		PageNum:    pageNum,
+		PageSize:   pageSize,
+		TotalItems: totalItems,
+		TotalPages: totalPages,
+		HasNext:    pageNum < totalPages,
+	}
+}
+
+// legal hold change requested by an operator holding the internal api key
+type LegalHold struct {
+	LegalHold *bool  `json:"legal_hold" binding:"required"`
+	Reason    string `json:"reason"`
+}
+
+type UserCreate struct {
+	Name     string `json:"name" form:"name" binding:"required,notblank"`
+	Email    string `json:"email" form:"email" binding:"omitempty,email,max=320"`
+	Password string `json:"password" form:"password"`
+}
+
+// partial update, nil fields keep their current value
+type UserUpdate struct {
+	Name     *string `json:"name" binding:"omitempty,notblank"`
+	Email    *string `json:"email" binding:"omitempty,email,max=320"`
+	Password *string `json:"password" binding:"omitempty,notblank"`
+}
+
+// INTERFACE LAYER, FACILITATING COMMUNICATION BETWEEN DIFFERENT COMPONENTS IN THE SYSTEM
+func routeRest(router *gin.Engine) {
+	router.GET("/users", getUsersHandler)
+	router.GET("/users/:id", getUserHandler)
+	router.POST("/users", createUserHandler)
+	router.PATCH("/users/:id", updateUserHandler)
+	router.DELETE("/users/:id", deleteUserHandler)
+	router.PUT("/users/:id/legal-hold", setLegalHoldHandler)
+	router.PUT("/users/:id/role", setUserRoleHandler)
+	router.GET("/users/:id/consents", getUserConsentsHandler)
+	router.POST("/users/:id/consents", acceptPolicyHandler)
+	router.GET("/users/:id/blocks", getUserBlocksHandler)
+	router.POST("/users/:id/blocks", blockUserHandler)
+	router.DELETE("/users/:id/blocks/:blocked_id", unblockUserHandler)
+	router.GET("/users/:id/blocked-by", getUserBlockedByHandler)
+	router.GET("/users/:id/privacy", getUserPrivacyHandler)
+	router.PATCH("/users/:id/privacy", updateUserPrivacyHandler)
+	router.GET("/users/:id/notification-preferences", getNotificationPreferencesHandler)
+	router.PUT("/users/:id/notification-preferences", updateNotificationPreferencesHandler)
+	router.PUT("/notification-preferences", overrideNotificationPreferencesHandler)
+	router.GET("/users/:id/favorites", getUserFavoritesHandler)
+	router.POST("/users/:id/favorites/:listing_id", addUserFavoriteHandler)
+	router.DELETE("/users/:id/favorites/:listing_id", removeUserFavoriteHandler)
+	router.GET("/users/:id/devices", getUserDevicesHandler)
+	router.POST("/users/:id/devices", registerUserDeviceHandler)
+	router.DELETE("/users/:id/devices/:device_id", deleteUserDeviceHandler)
+	router.GET("/users/:id/devices/:device_id/receipts", getPushReceiptsHandler)
+	router.POST("/push-receipts", recordPushReceiptsHandler)
+	router.GET("/users/:id/inbox", getUserInboxHandler)
+	router.POST("/users/:id/inbox", createInboxNotificationHandler)
+	router.POST("/users/:id/inbox/read", markInboxReadHandler)
+	router.GET("/broadcasts", getBroadcastsHandler)
+	router.POST("/broadcasts", createBroadcastHandler)
+	router.POST("/broadcasts/audience-count", countBroadcastAudienceHandler)
+	router.POST("/broadcasts/claim", claimBroadcastRecipientsHandler)
+	router.GET("/broadcasts/:id", getBroadcastHandler)
+	router.DELETE("/broadcasts/:id", cancelBroadcastHandler)
+	router.POST("/broadcasts/:id/stats", recordBroadcastStatsHandler)
+	router.POST("/email-events", recordEmailEventsHandler)
+	router.GET("/users/:id/email-events", getUserEmailEventsHandler)
+	router.GET("/email-suppressions", getEmailSuppressionsHandler)
+	router.GET("/users/:id/email-suppression", getUserEmailSuppressionHandler)
+	router.PUT("/users/:id/email-suppression", suppressUserEmailHandler)
+	router.DELETE("/users/:id/email-suppression", unsuppressUserEmailHandler)
+	router.POST("/audit-log", createAuditEntryHandler)
+	router.GET("/audit-log", getAuditLogHandler)
+	router.GET("/audit-log/chain", getAuditChainHandler)
+	router.GET("/audit-log/verify", verifyAuditChainHandler)
+	router.GET("/notification-templates", getNotificationTemplatesHandler)
+	router.POST("/notification-templates", createNotificationTemplateHandler)
+	router.GET("/notification-templates/:event/:channel/:locale", getNotificationTemplateVersionsHandler)
+	router.DELETE("/notification-templates/:event/:channel/:locale", deleteNotificationTemplateHandler)
+	router.GET("/content-rules", getContentRulesHandler)
+	router.PUT("/content-rules/:name", saveContentRuleHandler)
+	router.DELETE("/content-rules/:name", deleteContentRuleHandler)
+	router.GET("/users/:id/webhooks", getUserWebhooksHandler)
+	router.POST("/users/:id/webhooks", createUserWebhookHandler)
+	router.DELETE("/users/:id/webhooks/:webhook_id", deleteUserWebhookHandler)
+	router.GET("/users/:id/webhooks/:webhook_id/deliveries", getWebhookDeliveriesHandler)
+	router.POST("/webhook-events", publishWebhookEventHandler)
+	router.GET("/outbox", getOutboxEventsHandler)
+	router.GET("/dead-letters", getDeadLettersHandler)
+	router.POST("/dead-letters", createDeadLetterHandler)
+	router.GET("/dead-letters/:id", getDeadLetterHandler)
+	router.PUT("/dead-letters/:id", updateDeadLetterHandler)
+	router.DELETE("/dead-letters/:id", deleteDeadLetterHandler)
+	router.POST("/dead-letters/:id/requeue", requeueDeadLetterHandler)
+	router.GET("/admin-actions", getAdminActionsHandler)
+	router.POST("/admin-actions", createAdminActionHandler)
+	router.GET("/admin-actions/:id", getAdminActionHandler)
+	router.POST("/admin-actions/:id/decision", decideAdminActionHandler)
+	router.POST("/admin-actions/:id/outcome", recordAdminActionOutcomeHandler)
+	router.GET("/policies", getCurrentPoliciesHandler)
+	router.POST("/policies", publishPolicyHandler)
+	router.POST("/login", loginHandler)
+	router.GET("/metrics", gin.WrapH(promhttp.Handler()))
+}
+
+// Run start the user service on BIND_ADDRESS and HTTP_PORT until SIGINT/SIGTERM
+func Run() {
+	// LOG_LEVEL debug/info/warn/error, default info
+	slog.SetDefault(logging.New(cfg.String("OTEL_SERVICE_NAME", "user-service"), cfg.String("LOG_LEVEL", "info")))
+
+	stopTracing := initTracing()
+	defer stopTracing()
+
+	handler, closeDB := New()
+	defer closeDB()
+
+	stopGRPC := startGRPC()
+	defer stopGRPC()
+
+	addr := cfg.ListenAddr("6001")
+	slog.Info("starting user service", "addr", addr, "container", cfg.InContainer())
+	serve(&http.Server{Addr: addr, Handler: handler})
+}
+
+// New open the database and build the handler of the user service without serving it,
+// so another process can mount it, close the database once the handler is no longer used
+func New() (handler http.Handler, closeDB func()) {
+	r := openUserRepository()
+	r.migrateOnStart()
+	repo = r
+	capture := startChangeCapture(r)
+	relay := startOutboxRelay(r)
+	webhookWorker := startWebhookWorker(r)
+	anchors := startAuditAnchors()
+
+	router := newRouter()
+	router.Use(otelgin.Middleware(cfg.String("OTEL_SERVICE_NAME", "user-service")))
+	router.Use(metricsMiddleware())
+	// REQUEST_TIMEOUT max duration of a request, shortened by the X-Request-Timeout of the caller
+	router.Use(deadlineMiddleware(cfg.Duration("REQUEST_TIMEOUT", 30*time.Second)))
+	router.Use(apiKeyMiddleware(internalAPIKey))
+
+	// set rest route
+	routeRest(router)
+
+	return router, func() {
+		// events claimed by an unfinished round are published again by the next start
+		ctx, cancel := context.WithTimeout(context.Background(), cfg.Duration("SHUTDOWN_TIMEOUT", 10*time.Second))
+		defer cancel()
+		if capture != nil {
+			capture.Stop(ctx)
+		}
+		relay.Stop(ctx)
+		webhookWorker.Stop(ctx)
+		if anchors != nil {
+			anchors.Stop(ctx)
+		}
+		repo.Close()
+	}
+}
+
+// run server until SIGINT/SIGTERM then let in-flight requests finish within SHUTDOWN_TIMEOUT
+func serve(srv *http.Server) {
+	go func() {
+		if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Fatal(err)
+		}
+	}()
+
+	quit := make(chan os.Signal, 1)
+	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
+	<-quit
+	slog.Info("shutting down user service")
+
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.Duration("SHUTDOWN_TIMEOUT", 10*time.Second))
+	defer cancel()
+
+	if err := srv.Shutdown(ctx); err != nil {
+		slog.ErrorContext(ctx, "main error", "code", "022", "error", err)
+	}
+}
+
+// set gin engine with mode, trusted proxies and fallback handlers
+func newRouter() *gin.Engine {
+	// GIN_MODE release/debug/test, default debug, release in a container
+	defaultMode := gin.DebugMode
+	if cfg.InContainer() {
+		defaultMode = gin.ReleaseMode
+	}
+	mode := cfg.String("GIN_MODE", defaultMode)
+	switch mode {
+	case gin.ReleaseMode, gin.DebugMode, gin.TestMode:
+	default:
+		log.Fatalf("invalid GIN_MODE %q", mode)
+	}
+	gin.SetMode(mode)
+
+	// json field names and custom tags in request validation errors
+	apperror.RegisterValidators()
+
+	router := gin.New()
+	// json access log with request id, and panics logged as json too
+	router.Use(logging.Recovery(), logging.Middleware())
+
+	// TRUSTED_PROXIES comma separated ip or cidr, empty trust no proxy so client ip is the remote address
+	if err := router.SetTrustedProxies(cfg.List("TRUSTED_PROXIES")); err != nil {
+		log.Fatal(err)
+	}
+
+	// return standard error envelope instead of gin default
+	router.HandleMethodNotAllowed = true
+	router.NoRoute(noRouteHandler)
+	router.NoMethod(noMethodHandler)
+
+	return router
+}
+
+// =========== INTERFACE HANDLER, HANDLING REQUEST RESPONSE API DEPEND INTERFACE ===========
+
+// handler response unknown route
+func noRouteHandler(c *gin.Context) {
+	apperror.JSON(c, http.StatusNotFound, "Not Found")
+}
+
+// handler response route exist with other method
+func noMethodHandler(c *gin.Context) {
+	apperror.JSON(c, http.StatusMethodNotAllowed, "Method Not Allowed")
+}
+
+// handler request response list users, or batch of users when ids param is set
+func getUsersHandler(c *gin.Context) {
+	if val := c.Query("ids"); val != "" {
+		ids, err := parseIDs(val)
+		if err != nil {
+			slog.ErrorContext(c.Request.Context(), "handler error", "code", "012", "error", err)
+			apperror.JSON(c, http.StatusBadRequest, "Invalid ids param")
+			return
+		}
+
+		users, err := getUsersByIDsUsecase(c.Request.Context(), ids)
+		if err != nil {
+			apperror.Respond(c, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"result": true, "users": users})
+		return
+	}
+
+	pageNum, err := strconv.Atoi(c.DefaultQuery("page_num", "1"))
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "handler error", "code", "008", "error", "Invalid page_num param")
+		apperror.JSON(c, http.StatusBadRequest, "Invalid page_num param")
+		return
+	}
+
+	pageSize, err := strconv.Atoi(c.DefaultQuery("page_size", "10"))
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "handler error", "code", "007", "error", "Invalid page_size param")
+		apperror.JSON(c, http.StatusBadRequest, "Invalid page_size param")
+		return
+	}
+
+	users, pagination, err := getUsersUsecase(c.Request.Context(), pageNum, pageSize, c.Query("sort_by"), c.Query("sort_dir"))
+	if err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"result": true, "users": users, "pagination": pagination})
+}
+
+// max ids on one batch request
+const maxBatchIDs = 100
+
+// parse comma separated ids
+func parseIDs(val string) ([]int, error) {
+	parts := strings.Split(val, ",")
+	if len(parts) > maxBatchIDs {
+		return nil, fmt.Errorf("too many ids, max %d", maxBatchIDs)
+	}
+
+	ids := make([]int, 0, len(parts))
+	for _, part := range parts {
+		id, err := strconv.Atoi(strings.TrimSpace(part))
+		if err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+
+	return ids, nil
+}
+
+// handler request response detail user
+func getUserHandler(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "handler error", "code", "006", "error", "Invalid user ID")
+		apperror.JSON(c, http.StatusBadRequest, "Invalid user ID")
+		return
+	}
+
+	users, err := getUserUsecase(c.Request.Context(), id)
+	if err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"result": true, "user": users})
+}
+
+// handler request response create user
+func createUserHandler(c *gin.Context) {
+	var body UserCreate
+	if err := c.ShouldBind(&body); err != nil {
+		slog.ErrorContext(c.Request.Context(), "handler error", "code", "005", "error", "Invalid body request")
+		apperror.RespondBinding(c, err)
+		return
+	}
+
+	user, err := createUserUsecase(c.Request.Context(), body)
+	if err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"result": true, "user": user})
+}
+
+// handler request response partial update user
+func updateUserHandler(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "handler error", "code", "041", "error", "Invalid user ID")
+		apperror.JSON(c, http.StatusBadRequest, "Invalid user ID")
+		return
+	}
+
+	var body UserUpdate
+	if err := c.ShouldBindJSON(&body); err != nil {
+		slog.ErrorContext(c.Request.Context(), "handler error", "code", "042", "error", err)
+		apperror.RespondBinding(c, err)
+		return
+	}
+
+	user, err := updateUserUsecase(c.Request.Context(), id, body)
+	if err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"result": true, "user": user})
+}
+
+// handler request response delete user, soft delete unless hard=true
+func deleteUserHandler(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "handler error", "code", "009", "error", "Invalid user ID")
+		apperror.JSON(c, http.StatusBadRequest, "Invalid user ID")
+		return
+	}
+
+	hard := c.Query("hard") == "true"
+	if err := deleteUserUsecase(c.Request.Context(), id, hard); err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"result": true})
+}
+
+// handler request response legal hold, called by the admin routes of the public api or by operators
+func setLegalHoldHandler(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "handler error", "code", "023", "error", "Invalid user ID")
+		apperror.JSON(c, http.StatusBadRequest, "Invalid user ID")
+		return
+	}
+
+	var body LegalHold
+	if err := c.ShouldBindJSON(&body); err != nil {
+		slog.ErrorContext(c.Request.Context(), "handler error", "code", "024", "error", "Invalid body request")
+		apperror.RespondBinding(c, err)
+		return
+	}
+
+	if err := setLegalHoldUsecase(c.Request.Context(), id, *body.LegalHold, body.Reason, c.ClientIP()); err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"result": true, "legal_hold": *body.LegalHold})
+}
+
+// =========== USECASE LAYER, SERVES AS AN INTERMEDIARY BETWEEN THE PRESENTATION LAYER AND THE DATA LAYER ===========
+
+// get list data user by params
+func getUsersUsecase(ctx context.Context, pageNum, pageSize int, sortBy, sortDir string) ([]User, *Pagination, error) {
+	// only whitelisted columns reach the query, default newest first
+	if sortBy == "" {
+		sortBy = "created_at"
+	}
+	if sortDir == "" {
+		sortDir = "desc"
+	}
+	if !userSortColumns[sortBy] || (sortDir != "asc" && sortDir != "desc") {
+		return nil, nil, errInvalidSort
+	}
+
+	// call users find repository
+	users, err := repo.Find(ctx, pageNum, pageSize, sortBy, sortDir)
+	if err != nil {
+		return nil, nil, errors.New("database error: get list users error database")
+	}
+
+	total, err := repo.Count(ctx)
+	if err != nil {
+		return nil, nil, errors.New("database error: count users error database")
+	}
+
+	pagination := newPagination(pageNum, pageSize, total)
+	return users, &pagination, nil
+}
+
+// get list data user by ids
+func getUsersByIDsUsecase(ctx context.Context, userIDs []int) ([]User, error) {
+	// call users find by ids repository
+	users, err := repo.FindByIDs(ctx, userIDs)
+	if err != nil {
+		return nil, errors.New("database error: get batch users error database")
+	}
+
+	return users, err
+}
+
+// get detail data user by id
+func getUserUsecase(ctx context.Context, userID int) (*User, error) {
+	// call users find repository
+	user, err := repo.FindByID(ctx, userID)
+	if err != nil {
+		if errors.Is(err, errUserNotFound) {
+			return nil, err
+		}
+		return nil, errors.New("database error: get detail user error database")
+	}
+
+	return user, err
+}
+
+// create user, email and password are optional and the password is stored hashed
+func createUserUsecase(ctx context.Context, create UserCreate) (*User, error) {
+	var passwordHash string
+	if create.Password != "" {
+		var err error
+		passwordHash, err = hashPassword(create.Password)
+		if err != nil {
+			slog.ErrorContext(ctx, "usecase error", "code", "019", "error", err)
+			return nil, errors.New("hash error: create user hash password error")
+		}
+	}
+
+	// call users create repository
+	user, err := repo.Create(ctx, create.Name, normalizeEmail(create.Email), passwordHash)
+	if err != nil {
+		if errors.Is(err, errEmailTaken) {
+			return nil, err
+		}
+		return nil, errors.New("database error: create user error database")
+	}
+
+	return user, err
+}
+
+// update the fields set on update, password is stored hashed
+func updateUserUsecase(ctx context.Context, userID int, update UserUpdate) (*User, error) {
+	if update.Name == nil && update.Email == nil && update.Password == nil {
+		return nil, errEmptyUpdate
+	}
+
+	if update.Email != nil {
+		email := normalizeEmail(*update.Email)
+		update.Email = &email
+	}
+
+	var passwordHash *string
+	if update.Password != nil {
+		hash, err := hashPassword(*update.Password)
+		if err != nil {
+			slog.ErrorContext(ctx, "usecase error", "code", "043", "error", err)
+			return nil, errors.New("hash error: update user hash password error")
+		}
+		passwordHash = &hash
+	}
+
+	// call users update repository
+	if err := repo.UpdateByID(ctx, userID, update.Name, update.Email, passwordHash); err != nil {
+		if errors.Is(err, errUserNotFound) || errors.Is(err, errEmailTaken) {
+			return nil, err
+		}
+		return nil, errors.New("database error: update user error database")
+	}
+
+	user, err := repo.FindByID(ctx, userID)
+	if err != nil {
+		return nil, errors.New("database error: get detail user error database")
+	}
+
+	return user, nil
+}
+
+// emails are compared as lowercase, one user per address whatever its case
+func normalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+// delete user, soft delete keep the row with deleted_at set
+func deleteUserUsecase(ctx context.Context, userID int, hard bool) error {
+	// call users delete repository
+	err := repo.DeleteByID(ctx, userID, hard)
+	if err != nil {
+		if errors.Is(err, errUserNotFound) || errors.Is(err, errLegalHold) {
+			return err
+		}
+		return errors.New("database error: delete user error database")
+	}
+
+	return nil
+}
+
+func setLegalHoldUsecase(ctx context.Context, userID int, hold bool, reason, caller string) error {
+	if err := repo.SetLegalHold(ctx, userID, hold); err != nil {
+		if errors.Is(err, errUserNotFound) {
+			return err
+		}
+		return errors.New("database error: set legal hold error database")
+	}
+
+	// audit trail of hold changes
+	slog.InfoContext(ctx, "audit: legal hold set", "hold", hold, "user_id", userID, "caller", caller, "reason", reason)
+	return nil
+}
+
+// =========== REPOSITORY LAYER, ABSTRACTION OVER THE DATA PERSISTENCE (databases, file systems, or external APIs) ===========
+
+// Function to get list users data
+func (r *sqlUserRepository) Find(ctx context.Context, pageNum, pageSize int, sortBy, sortDir string) ([]User, error) {
+	ctx, done := r.observe(ctx, "find")
+	defer done()
+
+	// set offset position
+	offset := (pageNum - 1) * pageSize
+
+	// sortBy and sortDir are validated against the whitelist by the usecase, id keeps equal values in a stable order
+	query := fmt.Sprintf("SELECT id, name, role, COALESCE(email, ''), created_at, updated_at FROM users WHERE deleted_at IS NULL ORDER BY %s %s, id %s LIMIT ? OFFSET ?", sortBy, sortDir, sortDir)
+	rows, err := r.query(ctx, query, pageSize, offset)
+	if err != nil {
+		slog.ErrorContext(ctx, "handler error", "code", "004", "error", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	users := []User{}
+	for rows.Next() {
+		var user User
+		if err := rows.Scan(&user.ID, &user.Name, &user.Role, &user.Email, &user.CreatedAt, &user.UpdatedAt); err != nil {
+			slog.ErrorContext(ctx, "handler error", "code", "003", "error", err)
+			return nil, err
+		}
+		users = append(users, user)
+	}
+
+	return users, err
+}
+
+// Function to count users, soft-deleted users are not counted
+func (r *sqlUserRepository) Count(ctx context.Context) (int, error) {
+	ctx, done := r.observe(ctx, "count")
+	defer done()
+
+	var total int
+	if err := r.queryRowPrepared(ctx, "SELECT COUNT(*) FROM users WHERE deleted_at IS NULL").Scan(&total); err != nil {
+		slog.ErrorContext(ctx, "handler error", "code", "021", "error", err)
+		return 0, err
+	}
+
+	return total, nil
+}
+
+// Function to get users by ids, missing and soft-deleted users are skipped
+func (r *sqlUserRepository) FindByIDs(ctx context.Context, ids []int) ([]User, error) {
+	ctx, done := r.observe(ctx, "findByIDs")
+	defer done()
+
+	placeholders := make([]string, len(ids))
+	args := make([]interface{}, len(ids))
+	for i, id := range ids {
+		placeholders[i] = "?"
+		args[i] = id
+	}
+
+	query := fmt.Sprintf("SELECT id, name, role, COALESCE(email, ''), created_at, updated_at FROM users WHERE id IN (%s) AND deleted_at IS NULL", strings.Join(placeholders, ", "))
+	rows, err := r.query(ctx, query, args...)
+	if err != nil {
+		slog.ErrorContext(ctx, "handler error", "code", "013", "error", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	users := []User{}
+	for rows.Next() {
+		var user User
+		if err := rows.Scan(&user.ID, &user.Name, &user.Role, &user.Email, &user.CreatedAt, &user.UpdatedAt); err != nil {
+			slog.ErrorContext(ctx, "handler error", "code", "014", "error", err)
+			return nil, err
+		}
+		users = append(users, user)
+	}
+
+	return users, rows.Err()
+}
+
+var errUserNotFound = apperror.NotFound("User not found")
+
+var errLegalHold = apperror.Conflict("User is under legal hold")
+
+var errEmptyUpdate = apperror.Validation("nothing to update, set name, email or password")
+
+var errEmailTaken = apperror.Conflict("Email is already used by another user")
+
+var errInvalidSort = apperror.Validation("invalid sort param, sort_by supported values: created_at, updated_at, name, sort_dir supported values: asc, desc")
+
+// columns users can be sorted by
+var userSortColumns = map[string]bool{"created_at": true, "updated_at": true, "name": true}
+
+// Function to get user by id
+func (r *sqlUserRepository) FindByID(ctx context.Context, id int) (*User, error) {
+	ctx, done := r.observe(ctx, "findByID")
+	defer done()
+
+	var user User
+	err := r.queryRowPrepared(ctx, "SELECT id, name, role, COALESCE(email, ''), created_at, updated_at FROM users WHERE id = ? AND deleted_at IS NULL", id).Scan(&user.ID, &user.Name, &user.Role, &user.Email, &user.CreatedAt, &user.UpdatedAt)
+	if err != nil {
+		slog.ErrorContext(ctx, "handler error", "code", "002", "error", err)
+		if err == sql.ErrNoRows {
+			return nil, errUserNotFound
+		}
+
+		return nil, err
+	}
+
+	return &user, nil
+}
+
+// Function to create user, email is empty for none
+func (r *sqlUserRepository) Create(ctx context.Context, name, email, passwordHash string) (*User, error) {
+	ctx, done := r.observe(ctx, "create")
+	defer done()
+
+	var user User
+	user.Name = name
+	user.Email = email
+	user.Role = RoleUser
+	user.CreatedAt = time.Now().UnixNano() / int64(time.Microsecond)
+	user.UpdatedAt = user.CreatedAt
+
+	// the user.created event is written with the user, so it is published once the user exists and only then
+	err := r.withTx(ctx, func(tx *sql.Tx) error {
+		if err := r.checkEmailFree(ctx, tx, email, 0); err != nil {
+			return err
+		}
+
+		err := tx.QueryRowContext(ctx, r.rebind("INSERT INTO users (name, email, password_hash, created_at, updated_at) VALUES (?, NULLIF(?, ''), NULLIF(?, ''), ?, ?) RETURNING id"),
+			user.Name, user.Email, passwordHash, user.CreatedAt, user.UpdatedAt).Scan(&user.ID)
+		if err != nil {
+			return err
+		}
+		// emails stay out of the events, like password hashes
+		event := user
+		event.Email = ""
+		return r.insertEvent(ctx, tx, events.UserCreated, user.ID, event)
+	})
+	if err != nil {
+		if errors.Is(err, errEmailTaken) {
+			return nil, err
+		}
+		slog.ErrorContext(ctx, "handler error", "code", "001", "error", err)
+		return nil, err
+	}
+
+	return &user, nil
+}
+
+// Function to delete user by id, soft delete only set deleted_at
+// hard delete is refused for users under legal hold
+func (r *sqlUserRepository) DeleteByID(ctx context.Context, id int, hard bool) error {
+	ctx, done := r.observe(ctx, "deleteByID")
+	defer done()
+
+	var err error
+	if hard {
+		var held bool
+		if held, err = r.IsLegalHold(ctx, id); err != nil {
+			return err
+		}
+		if held {
+			return errLegalHold
+		}
+	}
+
+	var affected int64
+	err = r.withTx(ctx, func(tx *sql.Tx) error {
+		var result sql.Result
+		var err error
+		if hard {
+			result, err = tx.ExecContext(ctx, r.rebind("DELETE FROM users WHERE id = ? AND legal_hold = 0"), id)
+		} else {
+			now := time.Now().UnixNano() / int64(time.Microsecond)
+			result, err = tx.ExecContext(ctx, r.rebind("UPDATE users SET deleted_at = ?, updated_at = ? WHERE id = ? AND deleted_at IS NULL"), now, now, id)
+		}
+		if err != nil {
+			slog.ErrorContext(ctx, "handler error", "code", "010", "error", err)
+			return err
+		}
+
+		if affected, err = result.RowsAffected(); err != nil {
+			slog.ErrorContext(ctx, "handler error", "code", "011", "error", err)
+			return err
+		}
+		if affected == 0 {
+			return nil
+		}
+
+		return r.insertEvent(ctx, tx, events.UserDeleted, id, events.Deleted{ID: id})
+	})
+	if err != nil {
+		return err
+	}
+
+	if affected == 0 {
+		return errUserNotFound
+	}
+
+	return nil
+}
+
+func (r *sqlUserRepository) IsLegalHold(ctx context.Context, id int) (bool, error) {
+	ctx, done := r.observe(ctx, "isLegalHold")
+	defer done()
+
+	var held bool
+	if err := r.queryRow(ctx, "SELECT legal_hold FROM users WHERE id = ?", id).Scan(&held); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return false, errUserNotFound
+		}
+		slog.ErrorContext(ctx, "handler error", "code", "025", "error", err)
+		return false, err
+	}
+
+	return held, nil
+}
+
+// Function to update the non nil fields of a user, an empty email removes it
+func (r *sqlUserRepository) UpdateByID(ctx context.Context, id int, name, email, passwordHash *string) error {
+	ctx, done := r.observe(ctx, "updateByID")
+	defer done()
+
+	sets := []string{"updated_at = ?"}
+	args := []interface{}{time.Now().UnixNano() / int64(time.Microsecond)}
+	if name != nil {
+		sets = append(sets, "name = ?")
+		args = append(args, *name)
+	}
+	if email != nil {
+		sets = append(sets, "email = NULLIF(?, '')")
+		args = append(args, *email)
+	}
+	if passwordHash != nil {
+		sets = append(sets, "password_hash = ?")
+		args = append(args, *passwordHash)
+	}
+	args = append(args, id)
+
+	var affected int64
+	err := r.withTx(ctx, func(tx *sql.Tx) error {
+		if email != nil {
+			if err := r.checkEmailFree(ctx, tx, *email, id); err != nil {
+				return err
+			}
+		}
+
+		result, err := tx.ExecContext(ctx, r.rebind(fmt.Sprintf("UPDATE users SET %s WHERE id = ? AND deleted_at IS NULL", strings.Join(sets, ", "))), args...)
+		if err != nil {
+			slog.ErrorContext(ctx, "handler error", "code", "044", "error", err)
+			return err
+		}
+
+		if affected, err = result.RowsAffected(); err != nil {
+			slog.ErrorContext(ctx, "handler error", "code", "045", "error", err)
+			return err
+		}
+		if affected == 0 {
+			return nil
+		}
+
+		// the event carries the user as the update left it, password hashes and emails are never part of it
+		var user User
+		err = tx.QueryRowContext(ctx, r.rebind("SELECT id, name, role, created_at, updated_at FROM users WHERE id = ?"), id).
+			Scan(&user.ID, &user.Name, &user.Role, &user.CreatedAt, &user.UpdatedAt)
+		if err != nil {
+			return err
+		}
+		return r.insertEvent(ctx, tx, events.UserUpdated, id, user)
+	})
+	if err != nil {
+		return err
+	}
+
+	if affected == 0 {
+		return errUserNotFound
+	}
+
+	return nil
+}
+
+// errEmailTaken when another user than id has email, the unique index still guards writes racing the check
+func (r *sqlUserRepository) checkEmailFree(ctx context.Context, tx *sql.Tx, email string, id int) error {
+	if email == "" {
+		return nil
+	}
+
+	var taken bool
+	err := tx.QueryRowContext(ctx, r.rebind("SELECT EXISTS (SELECT 1 FROM users WHERE email = ? AND id <> ?)"), email, id).Scan(&taken)
+	if err != nil {
+		slog.ErrorContext(ctx, "handler error", "code", "180", "error", err)
+		return err
+	}
+	if taken {
+		return errEmailTaken
+	}
+
+	return nil
+}
+
+func (r *sqlUserRepository) SetLegalHold(ctx context.Context, id int, hold bool) error {
+	ctx, done := r.observe(ctx, "setLegalHold")
+	defer done()
+
+	// legal_hold is an integer column, postgres does not take a bool for it
+	held := 0
+	if hold {
+		held = 1
+	}
+
+	now := time.Now().UnixNano() / int64(time.Microsecond)
+	result, err := r.exec(ctx, "UPDATE users SET legal_hold = ?, updated_at = ? WHERE id = ?", held, now, id)
+	if err != nil {
+		slog.ErrorContext(ctx, "handler error", "code", "026", "error", err)
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		slog.ErrorContext(ctx, "handler error", "code", "027", "error", err)
+		return err
+	}
+
+	if affected == 0 {
+		return errUserNotFound
+	}
+
+	return nil
+}
@@ -0,0 +1,124 @@
+package userservice
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"events"
+)
+
+// repo over a migrated sqlite database of its own, closed when the test ends
+func newTestRepository(t *testing.T) *sqlUserRepository {
+	t.Helper()
+	t.Setenv("DB_PATH", filepath.Join(t.TempDir(), "users.db"))
+	t.Setenv("DATABASE_URL", "")
+
+	r := openUserRepository()
+	if err := r.migrate(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	previous := repo
+	repo = r
+	t.Cleanup(func() {
+		repo = previous
+		r.Close()
+	})
+	return r
+}
+
+// event types of the outbox rows of user id, oldest first
+func outboxEventTypes(t *testing.T, r *sqlUserRepository, id int) []string {
+	t.Helper()
+	rows, err := r.writer.Query("SELECT event_type FROM outbox WHERE event_key = ? ORDER BY id", events.Key("user", id))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+
+	var types []string
+	for rows.Next() {
+		var eventType string
+		if err := rows.Scan(&eventType); err != nil {
+			t.Fatal(err)
+		}
+		types = append(types, eventType)
+	}
+	if err := rows.Err(); err != nil {
+		t.Fatal(err)
+	}
+	return types
+}
+
+func TestDeleteUserUnderLegalHold(t *testing.T) {
+	ctx := context.Background()
+	r := newTestRepository(t)
+
+	user, err := r.Create(ctx, "held", "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := setLegalHoldUsecase(ctx, user.ID, true, "litigation", "test"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := deleteUserUsecase(ctx, user.ID, true); !errors.Is(err, errLegalHold) {
+		t.Fatalf("hard delete under legal hold: %v, want %v", err, errLegalHold)
+	}
+	if _, err := r.FindByID(ctx, user.ID); err != nil {
+		t.Fatalf("user is gone after a refused delete: %v", err)
+	}
+	if got := outboxEventTypes(t, r, user.ID); len(got) != 1 || got[0] != events.UserCreated {
+		t.Errorf("outbox = %v, want only %s for a refused delete", got, events.UserCreated)
+	}
+
+	// released, the same delete goes through
+	if err := setLegalHoldUsecase(ctx, user.ID, false, "settled", "test"); err != nil {
+		t.Fatal(err)
+	}
+	if err := deleteUserUsecase(ctx, user.ID, true); err != nil {
+		t.Fatalf("hard delete after the hold was released: %v", err)
+	}
+	if _, err := r.FindByID(ctx, user.ID); !errors.Is(err, errUserNotFound) {
+		t.Errorf("user after hard delete: %v, want %v", err, errUserNotFound)
+	}
+}
+
+func TestUserEventInSameTransaction(t *testing.T) {
+	ctx := context.Background()
+	r := newTestRepository(t)
+
+	user, err := r.Create(ctx, "alice", "alice@example.com", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := outboxEventTypes(t, r, user.ID); len(got) != 1 || got[0] != events.UserCreated {
+		t.Fatalf("outbox = %v, want %s written with the user", got, events.UserCreated)
+	}
+
+	// the change is rolled back with its event, a user never exists without its event
+	if _, err := r.writer.Exec("ALTER TABLE outbox RENAME TO outbox_unavailable"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.Create(ctx, "bob", "bob@example.com", ""); err == nil {
+		t.Fatal("user created while its event could not be written")
+	}
+	if err := r.DeleteByID(ctx, user.ID, false); err == nil {
+		t.Fatal("user deleted while its event could not be written")
+	}
+	if _, err := r.writer.Exec("ALTER TABLE outbox_unavailable RENAME TO outbox"); err != nil {
+		t.Fatal(err)
+	}
+
+	var users int
+	if err := r.writer.QueryRow("SELECT COUNT(*) FROM users WHERE deleted_at IS NULL").Scan(&users); err != nil {
+		t.Fatal(err)
+	}
+	if users != 1 {
+		t.Errorf("%d users, want only the one created with its event", users)
+	}
+	if got := outboxEventTypes(t, r, user.ID); len(got) != 1 {
+		t.Errorf("outbox = %v, want the delete rolled back with its event", got)
+	}
+}
@@ -0,0 +1,76 @@
+package userservice
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// every metric is labelled with the service, so both Go services can register in one process in the combined binary
+var metrics = promauto.With(prometheus.WrapRegistererWith(prometheus.Labels{"service": "user-service"}, prometheus.DefaultRegisterer))
+
+var (
+	httpRequestsTotal = metrics.NewCounterVec(prometheus.CounterOpts{
+		Name: "http_requests_total",
+		Help: "Requests handled, by method, route and status.",
+	}, []string{"method", "route", "status"})
+
+	httpRequestDuration = metrics.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "http_request_duration_seconds",
+		Help:    "Latency of handled requests, by method, route and status.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"method", "route", "status"})
+
+	dbQueryDuration = metrics.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "db_query_duration_seconds",
+		Help:    "Latency of database queries, by repository function.",
+		Buckets: []float64{.0005, .001, .0025, .005, .01, .025, .05, .1, .25, .5, 1},
+	}, []string{"query"})
+)
+
+// =========== MIDDLEWARE LAYER, RUN BEFORE INTERFACE HANDLER TO ENRICH OR GUARD THE REQUEST ===========
+
+// count requests and observe latency per route template, run first so rejected requests are measured too
+func metricsMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+
+		route := c.FullPath()
+		if route == "" {
+			// keep label cardinality bounded on unknown paths
+			route = "unmatched"
+		}
+		status := strconv.Itoa(c.Writer.Status())
+
+		httpRequestsTotal.WithLabelValues(c.Request.Method, route, status).Inc()
+		httpRequestDuration.WithLabelValues(c.Request.Method, route, status).Observe(time.Since(start).Seconds())
+	}
+}
+
+// =========== REPOSITORY LAYER, ABSTRACTION OVER THE DATA PERSISTENCE (databases, file systems, or external APIs) ===========
+
+// observe duration of a repository function as metric and span, its ctx ends after DB_QUERY_TIMEOUT. Use as
+// ctx, done := r.observe(ctx, "find") then defer done()
+func (r *sqlUserRepository) observe(ctx context.Context, query string) (context.Context, func()) {
+	start := time.Now()
+	_, span := tracer.Start(ctx, "db "+query, trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(attribute.String("db.system", r.dialect.system), attribute.String("db.operation", query)))
+
+	cancel := context.CancelFunc(func() {})
+	if dbQueryTimeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, dbQueryTimeout)
+	}
+
+	return ctx, func() {
+		cancel()
+		dbQueryDuration.WithLabelValues(query).Observe(time.Since(start).Seconds())
+		span.End()
+	}
+}
@@ -0,0 +1,291 @@
+package userservice
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"fmt"
+	"io"
+	"log"
+	"log/slog"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"logging"
+)
+
+// =========== REPOSITORY LAYER, VERSIONED SCHEMA MIGRATIONS ===========
+
+// sql files of each dialect named <version>_<name>.sql, applied once per database in version order,
+// a schema change is a new file, applied files are never edited
+//
+//go:embed migrations
+var migrationFiles embed.FS
+
+type migration struct {
+	version int
+	name    string
+	sql     string
+}
+
+// key of the postgres advisory lock held while migrating, so instances starting together migrate one at a time
+const migrationLockKey = 600101
+
+// *sql.DB or *sql.Conn
+type execQuerier interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+func loadMigrations(dialect sqlDialect) ([]migration, error) {
+	entries, err := migrationFiles.ReadDir(dialect.migrationDir)
+	if err != nil {
+		return nil, err
+	}
+
+	var migrations []migration
+	seen := map[int]string{}
+	for _, entry := range entries {
+		file := entry.Name()
+		prefix, name, ok := strings.Cut(strings.TrimSuffix(file, ".sql"), "_")
+		version, err := strconv.Atoi(prefix)
+		if !ok || err != nil || !strings.HasSuffix(file, ".sql") {
+			return nil, fmt.Errorf("migration %s is not named <version>_<name>.sql", file)
+		}
+		if other, ok := seen[version]; ok {
+			return nil, fmt.Errorf("migrations %s and %s have the same version", other, file)
+		}
+		seen[version] = file
+
+		content, err := migrationFiles.ReadFile(path.Join(dialect.migrationDir, file))
+		if err != nil {
+			return nil, err
+		}
+		migrations = append(migrations, migration{version: version, name: name, sql: string(content)})
+	}
+
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].version < migrations[j].version })
+	return migrations, nil
+}
+
+// version to applied_at of the migrations already applied, creating the table keeping them when missing
+func (r *sqlUserRepository) appliedMigrations(ctx context.Context, db execQuerier) (map[int]int64, error) {
+	_, err := db.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS schema_migrations (
+		version BIGINT NOT NULL PRIMARY KEY,
+		name TEXT NOT NULL,
+		applied_at BIGINT NOT NULL
+	)`)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := db.QueryContext(ctx, "SELECT version, applied_at FROM schema_migrations")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	applied := map[int]int64{}
+	for rows.Next() {
+		var version int
+		var appliedAt int64
+		if err := rows.Scan(&version, &appliedAt); err != nil {
+			return nil, err
+		}
+		applied[version] = appliedAt
+	}
+
+	return applied, rows.Err()
+}
+
+// migrate apply the pending migrations, each in its own transaction
+func (r *sqlUserRepository) migrate(ctx context.Context) error {
+	migrations, err := loadMigrations(r.dialect)
+	if err != nil {
+		return err
+	}
+
+	conn, err := r.writer.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if r.dialect.name == dialectPostgres {
+		if _, err := conn.ExecContext(ctx, "SELECT pg_advisory_lock($1)", migrationLockKey); err != nil {
+			return err
+		}
+		defer conn.ExecContext(context.WithoutCancel(ctx), "SELECT pg_advisory_unlock($1)", migrationLockKey)
+	}
+
+	applied, err := r.appliedMigrations(ctx, conn)
+	if err != nil {
+		return err
+	}
+	if len(applied) == 0 {
+		if err := r.adoptLegacySchema(ctx, conn); err != nil {
+			return err
+		}
+	}
+
+	for _, m := range migrations {
+		if _, ok := applied[m.version]; ok {
+			continue
+		}
+
+		tx, err := conn.BeginTx(ctx, nil)
+		if err != nil {
+			return err
+		}
+		if _, err := tx.ExecContext(ctx, m.sql); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("migration %d_%s: %w", m.version, m.name, err)
+		}
+		now := time.Now().UnixNano() / int64(time.Microsecond)
+		if _, err := tx.ExecContext(ctx, r.rebind("INSERT INTO schema_migrations (version, name, applied_at) VALUES (?, ?, ?)"), m.version, m.name, now); err != nil {
+			tx.Rollback()
+			return err
+		}
+		if err := tx.Commit(); err != nil {
+			return err
+		}
+		slog.InfoContext(ctx, "applied migration", "version", m.version, "name", m.name)
+	}
+
+	return nil
+}
+
+// databases created before migrations got their columns one by one on start, bring them to the schema
+// of the first migration so it can be recorded as applied
+func (r *sqlUserRepository) adoptLegacySchema(ctx context.Context, db execQuerier) error {
+	var tables int
+	if err := db.QueryRowContext(ctx, r.rebind(r.dialect.tableExistsQuery), "users").Scan(&tables); err != nil {
+		return err
+	}
+	if tables == 0 {
+		return nil
+	}
+
+	for _, column := range [][2]string{
+		{"deleted_at", "BIGINT"},
+		{"password_hash", "TEXT"},
+		{"legal_hold", "INTEGER NOT NULL DEFAULT 0"},
+	} {
+		if err := r.addColumnIfMissing(ctx, db, "users", column[0], column[1]); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// alter table when column not exist yet on existing db
+func (r *sqlUserRepository) addColumnIfMissing(ctx context.Context, db execQuerier, table, column, definition string) error {
+	if r.dialect.name == dialectPostgres {
+		_, err := db.ExecContext(ctx, fmt.Sprintf("ALTER TABLE %s ADD COLUMN IF NOT EXISTS %s %s", table, column, definition))
+		return err
+	}
+
+	rows, err := db.QueryContext(ctx, "SELECT name FROM pragma_table_info(?)", table)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return err
+		}
+		if name == column {
+			return nil
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	_, err = db.ExecContext(ctx, fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", table, column, definition))
+	return err
+}
+
+// DB_AUTO_MIGRATE apply pending migrations on start, when false the service refuses to start until
+// they are applied with the migrate command
+func (r *sqlUserRepository) migrateOnStart() {
+	ctx := context.Background()
+	if cfg.Bool("DB_AUTO_MIGRATE", true) {
+		if err := r.migrate(ctx); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	migrations, err := loadMigrations(r.dialect)
+	if err != nil {
+		log.Fatal(err)
+	}
+	applied, err := r.appliedMigrations(ctx, r.writer)
+	if err != nil {
+		log.Fatal(err)
+	}
+	for _, m := range migrations {
+		if _, ok := applied[m.version]; !ok {
+			log.Fatalf("migration %d_%s is not applied, run the migrate command first", m.version, m.name)
+		}
+	}
+}
+
+// Migrate run the migrate command on the database of DATABASE_URL or DB_PATH, args are up (default) to apply
+// the pending migrations or status to list them
+func Migrate(args []string) {
+	slog.SetDefault(logging.New(cfg.String("OTEL_SERVICE_NAME", "user-service"), cfg.String("LOG_LEVEL", "info")))
+
+	r := openUserRepository()
+	defer r.Close()
+
+	command := "up"
+	if len(args) > 0 {
+		command = args[0]
+	}
+
+	switch command {
+	case "up":
+		if err := r.migrate(context.Background()); err != nil {
+			log.Fatal(err)
+		}
+	case "status":
+		if err := r.printMigrationStatus(context.Background(), os.Stdout); err != nil {
+			log.Fatal(err)
+		}
+	default:
+		log.Fatalf("unknown migrate command %q, use up or status", command)
+	}
+}
+
+func (r *sqlUserRepository) printMigrationStatus(ctx context.Context, out io.Writer) error {
+	migrations, err := loadMigrations(r.dialect)
+	if err != nil {
+		return err
+	}
+	applied, err := r.appliedMigrations(ctx, r.writer)
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "VERSION\tNAME\tAPPLIED")
+	for _, m := range migrations {
+		status := "pending"
+		if appliedAt, ok := applied[m.version]; ok {
+			status = time.UnixMicro(appliedAt).UTC().Format(time.RFC3339)
+		}
+		fmt.Fprintf(w, "%d\t%s\t%s\n", m.version, m.name, status)
+	}
+	return w.Flush()
+}
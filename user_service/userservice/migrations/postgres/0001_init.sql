@@ -0,0 +1,25 @@
+-- schema before migrations existed, IF NOT EXISTS so databases created by earlier versions are adopted as they are
+CREATE TABLE IF NOT EXISTS users (
+	id BIGSERIAL PRIMARY KEY,
+	name TEXT NOT NULL,
+	created_at BIGINT NOT NULL,
+	updated_at BIGINT NOT NULL,
+	deleted_at BIGINT,
+	password_hash TEXT,
+	legal_hold INTEGER NOT NULL DEFAULT 0
+);
+
+CREATE TABLE IF NOT EXISTS policy_versions (
+	kind TEXT NOT NULL,
+	version TEXT NOT NULL,
+	published_at BIGINT NOT NULL,
+	PRIMARY KEY (kind, version)
+);
+
+CREATE TABLE IF NOT EXISTS user_consents (
+	user_id BIGINT NOT NULL,
+	kind TEXT NOT NULL,
+	version TEXT NOT NULL,
+	accepted_at BIGINT NOT NULL,
+	PRIMARY KEY (user_id, kind, version)
+);
@@ -0,0 +1,8 @@
+-- what the public profile of a user shows, users without a row use the column defaults
+CREATE TABLE user_privacy (
+	user_id BIGINT NOT NULL PRIMARY KEY,
+	profile_visible INTEGER NOT NULL DEFAULT 1,
+	show_member_since INTEGER NOT NULL DEFAULT 1,
+	show_listing_count INTEGER NOT NULL DEFAULT 1,
+	updated_at BIGINT NOT NULL
+);
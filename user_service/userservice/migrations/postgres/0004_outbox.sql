@@ -0,0 +1,22 @@
+-- events of user writes, inserted in the transaction of the write and published by the outbox relay.
+-- status is pending until published, then delivered, or dead once it ran out of attempts
+CREATE TABLE outbox (
+	id BIGSERIAL PRIMARY KEY,
+	event_id TEXT NOT NULL,
+	event_type TEXT NOT NULL,
+	event_key TEXT NOT NULL,
+	payload TEXT NOT NULL,
+	status TEXT NOT NULL DEFAULT 'pending',
+	attempts INTEGER NOT NULL DEFAULT 0,
+	next_attempt_at BIGINT NOT NULL,
+	locked_until BIGINT,
+	last_error TEXT,
+	created_at BIGINT NOT NULL,
+	delivered_at BIGINT
+);
+
+-- events due for the relay
+CREATE INDEX outbox_status ON outbox (status, next_attempt_at);
+
+-- older pending events of a key, which hold back its newer ones
+CREATE INDEX outbox_event_key ON outbox (event_key, status);
@@ -0,0 +1,9 @@
+-- notification toggles a user or an operator changed, toggles without a row use the defaults of the service
+CREATE TABLE notification_preferences (
+	user_id BIGINT NOT NULL,
+	event TEXT NOT NULL,
+	channel TEXT NOT NULL,
+	enabled INTEGER NOT NULL,
+	updated_at BIGINT NOT NULL,
+	PRIMARY KEY (user_id, event, channel)
+);
@@ -0,0 +1,10 @@
+-- listings saved by users, the listings themselves live in the listing service
+CREATE TABLE favorites (
+	user_id BIGINT NOT NULL,
+	listing_id BIGINT NOT NULL,
+	created_at BIGINT NOT NULL,
+	PRIMARY KEY (user_id, listing_id)
+);
+
+-- favorites of a user, newest first
+CREATE INDEX favorites_user_created ON favorites (user_id, created_at);
@@ -0,0 +1,29 @@
+-- delivery outcomes of the notification emails reported by the email provider, type is delivered, soft_bounce,
+-- hard_bounce or complaint and occurred_at the time the provider saw it
+CREATE TABLE email_events (
+	id BIGSERIAL PRIMARY KEY,
+	user_id BIGINT NOT NULL,
+	type TEXT NOT NULL,
+	provider TEXT NOT NULL,
+	address TEXT,
+	message_id TEXT,
+	detail TEXT,
+	occurred_at BIGINT NOT NULL,
+	created_at BIGINT NOT NULL
+);
+
+CREATE INDEX email_events_user_id ON email_events (user_id, occurred_at);
+
+-- events past the retention
+CREATE INDEX email_events_created_at ON email_events (created_at);
+
+-- users whose address no longer gets notification emails, reason is hard_bounce, soft_bounce, complaint or manual
+CREATE TABLE email_suppressions (
+	user_id BIGINT NOT NULL PRIMARY KEY,
+	address TEXT,
+	reason TEXT NOT NULL,
+	detail TEXT,
+	created_at BIGINT NOT NULL
+);
+
+CREATE INDEX email_suppressions_created_at ON email_suppressions (created_at);
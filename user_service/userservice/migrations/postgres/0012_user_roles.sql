@@ -0,0 +1,2 @@
+-- role deciding the admin operations a user may call through the public API, user, agent or admin
+ALTER TABLE users ADD COLUMN role TEXT NOT NULL DEFAULT 'user';
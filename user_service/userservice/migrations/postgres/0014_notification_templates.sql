@@ -0,0 +1,14 @@
+-- subject and body of the notifications of an event over a channel in a locale, every save adds a version and the
+-- latest version is the one rendered
+CREATE TABLE notification_templates (
+	id BIGSERIAL PRIMARY KEY,
+	event TEXT NOT NULL,
+	channel TEXT NOT NULL,
+	locale TEXT NOT NULL,
+	version INTEGER NOT NULL,
+	subject TEXT NOT NULL,
+	body TEXT NOT NULL,
+	created_by BIGINT NOT NULL,
+	created_at BIGINT NOT NULL,
+	UNIQUE (event, channel, locale, version)
+);
@@ -0,0 +1,6 @@
+-- audit of every write done through the public API: the request and the entity before and after as json
+ALTER TABLE audit_log ADD COLUMN request_id TEXT;
+ALTER TABLE audit_log ADD COLUMN before_json TEXT;
+ALTER TABLE audit_log ADD COLUMN after_json TEXT;
+
+CREATE INDEX audit_log_entity_created_at ON audit_log (entity, created_at);
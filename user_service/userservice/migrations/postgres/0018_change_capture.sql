@@ -0,0 +1,6 @@
+-- updates and deletes of users carry the whole old row in the WAL, so EVENT_SOURCE=cdc tells a soft delete or a
+-- legal hold from an update
+ALTER TABLE users REPLICA IDENTITY FULL;
+
+-- the events of changes read again are written once
+CREATE UNIQUE INDEX outbox_event_id ON outbox (event_id);
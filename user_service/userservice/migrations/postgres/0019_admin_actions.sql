@@ -0,0 +1,30 @@
+-- high risk admin operations written before they run and run only once a second admin approved them. action is the
+-- operation, e.g. listing.purge, entity and entity_id what it acts on and params its json input. status goes from
+-- pending to approved, rejected or expired at expires_at, then from approved to executed or failed with the result
+-- or error of the run
+CREATE TABLE admin_actions (
+	id BIGSERIAL PRIMARY KEY,
+	action TEXT NOT NULL,
+	entity TEXT NOT NULL,
+	entity_id TEXT NOT NULL,
+	params TEXT,
+	reason TEXT,
+	status TEXT NOT NULL,
+	requested_by INTEGER NOT NULL,
+	request_id TEXT,
+	decided_by INTEGER,
+	decision_reason TEXT,
+	decided_at BIGINT,
+	result TEXT,
+	error TEXT,
+	expires_at BIGINT NOT NULL,
+	created_at BIGINT NOT NULL,
+	updated_at BIGINT NOT NULL
+);
+
+-- one pending request per operation on an entity
+CREATE UNIQUE INDEX admin_actions_pending ON admin_actions (action, entity_id) WHERE status = 'pending';
+
+CREATE INDEX admin_actions_status ON admin_actions (status, expires_at);
+
+CREATE INDEX admin_actions_created_at ON admin_actions (created_at);
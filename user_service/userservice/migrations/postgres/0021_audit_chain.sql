@@ -0,0 +1,13 @@
+-- hash chain of the audit log, hash covers prev_hash and the entry so an entry changed or removed breaks every hash
+-- after it. Entries written before the chain keep both empty
+ALTER TABLE audit_log ADD COLUMN prev_hash TEXT;
+ALTER TABLE audit_log ADD COLUMN hash TEXT;
+
+-- hashes of the head of the chain also written out of the database, a chain rewritten since differs from them
+CREATE TABLE audit_anchors (
+	id BIGSERIAL PRIMARY KEY,
+	entry_id BIGINT NOT NULL UNIQUE,
+	hash TEXT NOT NULL,
+	location TEXT NOT NULL,
+	created_at BIGINT NOT NULL
+);
@@ -0,0 +1,10 @@
+-- users a user blocked, blocked users can not contact the user
+CREATE TABLE user_blocks (
+	user_id BIGINT NOT NULL,
+	blocked_user_id BIGINT NOT NULL,
+	created_at BIGINT NOT NULL,
+	PRIMARY KEY (user_id, blocked_user_id)
+);
+
+-- users who blocked a user, for moderation
+CREATE INDEX user_blocks_blocked_user_id ON user_blocks (blocked_user_id);
@@ -0,0 +1,34 @@
+-- callback urls of a user notified of events, events is the comma separated list of the event types it receives
+CREATE TABLE webhooks (
+	id INTEGER NOT NULL PRIMARY KEY AUTOINCREMENT,
+	user_id BIGINT NOT NULL,
+	url TEXT NOT NULL,
+	events TEXT NOT NULL,
+	secret TEXT NOT NULL,
+	created_at BIGINT NOT NULL
+);
+
+CREATE INDEX webhooks_user_id ON webhooks (user_id);
+
+-- deliveries of events to webhooks, same columns as the outbox. status is pending until the callback answered 2xx,
+-- then delivered, or failed once it ran out of attempts
+CREATE TABLE webhook_deliveries (
+	id INTEGER NOT NULL PRIMARY KEY AUTOINCREMENT,
+	webhook_id BIGINT NOT NULL,
+	event_id TEXT NOT NULL,
+	event_type TEXT NOT NULL,
+	payload TEXT NOT NULL,
+	status TEXT NOT NULL DEFAULT 'pending',
+	attempts INTEGER NOT NULL DEFAULT 0,
+	next_attempt_at BIGINT NOT NULL,
+	locked_until BIGINT,
+	last_error TEXT,
+	created_at BIGINT NOT NULL,
+	delivered_at BIGINT
+);
+
+-- an event relayed twice is delivered once
+CREATE UNIQUE INDEX webhook_deliveries_event ON webhook_deliveries (webhook_id, event_id);
+
+-- deliveries due for the worker
+CREATE INDEX webhook_deliveries_status ON webhook_deliveries (status, next_attempt_at);
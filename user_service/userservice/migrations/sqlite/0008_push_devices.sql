@@ -0,0 +1,31 @@
+-- devices receiving push notifications of a user through fcm or apns, a token belongs to the user who registered it
+-- last. invalidated_at is set once the platform rejected the token, invalidated devices are no longer pushed to
+CREATE TABLE push_devices (
+	id INTEGER NOT NULL PRIMARY KEY AUTOINCREMENT,
+	user_id BIGINT NOT NULL,
+	platform TEXT NOT NULL,
+	token TEXT NOT NULL,
+	created_at BIGINT NOT NULL,
+	updated_at BIGINT NOT NULL,
+	invalidated_at BIGINT,
+	invalid_reason TEXT
+);
+
+CREATE UNIQUE INDEX push_devices_token ON push_devices (platform, token);
+
+CREATE INDEX push_devices_user_id ON push_devices (user_id);
+
+-- outcome of each push sent to a device, status is delivered, failed or invalid
+CREATE TABLE push_receipts (
+	id INTEGER NOT NULL PRIMARY KEY AUTOINCREMENT,
+	device_id BIGINT NOT NULL,
+	event TEXT NOT NULL,
+	status TEXT NOT NULL,
+	error TEXT,
+	created_at BIGINT NOT NULL
+);
+
+CREATE INDEX push_receipts_device ON push_receipts (device_id, created_at);
+
+-- receipts past the retention
+CREATE INDEX push_receipts_created_at ON push_receipts (created_at);
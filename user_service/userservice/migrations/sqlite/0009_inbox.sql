@@ -0,0 +1,17 @@
+-- notifications of the in-app channel kept for the inbox of a user, read_at is set once the user read them. data is
+-- the json object of the event and ids of the notification
+CREATE TABLE inbox_notifications (
+	id INTEGER NOT NULL PRIMARY KEY AUTOINCREMENT,
+	user_id BIGINT NOT NULL,
+	event TEXT NOT NULL,
+	title TEXT NOT NULL,
+	body TEXT NOT NULL,
+	data TEXT NOT NULL,
+	read_at BIGINT,
+	created_at BIGINT NOT NULL
+);
+
+CREATE INDEX inbox_notifications_user_id ON inbox_notifications (user_id, id);
+
+-- unread count of the bell icon
+CREATE INDEX inbox_notifications_unread ON inbox_notifications (user_id) WHERE read_at IS NULL;
@@ -0,0 +1,22 @@
+-- announcements of operators to the users of their audience, audience is the json object of its filters. Recipients
+-- are handed out in batches by user id, last_user_id is the last one handed out
+CREATE TABLE broadcasts (
+	id INTEGER NOT NULL PRIMARY KEY AUTOINCREMENT,
+	title TEXT NOT NULL,
+	body TEXT NOT NULL,
+	audience TEXT NOT NULL,
+	status TEXT NOT NULL,
+	scheduled_at BIGINT NOT NULL,
+	last_user_id BIGINT NOT NULL DEFAULT 0,
+	recipients BIGINT NOT NULL DEFAULT 0,
+	sent BIGINT NOT NULL DEFAULT 0,
+	failed BIGINT NOT NULL DEFAULT 0,
+	muted BIGINT NOT NULL DEFAULT 0,
+	created_at BIGINT NOT NULL,
+	updated_at BIGINT NOT NULL,
+	started_at BIGINT,
+	finished_at BIGINT
+);
+
+-- broadcasts due
+CREATE INDEX broadcasts_status ON broadcasts (status, scheduled_at);
@@ -0,0 +1,12 @@
+-- admin operations done through the public API, actor_id 0 is an operator holding the internal api key
+CREATE TABLE audit_log (
+	id INTEGER NOT NULL PRIMARY KEY AUTOINCREMENT,
+	actor_id BIGINT NOT NULL,
+	action TEXT NOT NULL,
+	entity TEXT NOT NULL,
+	entity_id TEXT,
+	detail TEXT,
+	created_at BIGINT NOT NULL
+);
+
+CREATE INDEX audit_log_created_at ON audit_log (created_at);
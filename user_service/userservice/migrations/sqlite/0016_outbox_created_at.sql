@@ -0,0 +1,2 @@
+-- delivered events of a time range read by replays
+CREATE INDEX outbox_status_created_at ON outbox (status, created_at);
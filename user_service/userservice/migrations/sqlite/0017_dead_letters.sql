@@ -0,0 +1,21 @@
+-- events and webhook deliveries out of attempts, kept with their payload until requeued or discarded by an admin.
+-- source is the queue of the event, user_events for the outbox, webhook_deliveries or listing_events of the listing
+-- service outbox, source_id its id in that queue
+CREATE TABLE dead_letters (
+	id INTEGER NOT NULL PRIMARY KEY AUTOINCREMENT,
+	source TEXT NOT NULL,
+	source_id BIGINT NOT NULL,
+	event_id TEXT NOT NULL,
+	event_type TEXT NOT NULL,
+	event_key TEXT NOT NULL,
+	payload TEXT NOT NULL,
+	attempts INTEGER NOT NULL,
+	last_error TEXT,
+	created_at BIGINT NOT NULL,
+	updated_at BIGINT NOT NULL
+);
+
+-- an event given up twice is kept once
+CREATE UNIQUE INDEX dead_letters_source ON dead_letters (source, source_id);
+
+CREATE INDEX dead_letters_created_at ON dead_letters (created_at);
@@ -0,0 +1,13 @@
+-- changes of the captured tables written by the triggers of EVENT_SOURCE=cdc, deleted once their events are in the
+-- outbox. The triggers are created on start in that mode and dropped otherwise
+CREATE TABLE row_changes (
+	id INTEGER NOT NULL PRIMARY KEY AUTOINCREMENT,
+	table_name TEXT NOT NULL,
+	op TEXT NOT NULL,
+	old_row TEXT,
+	new_row TEXT,
+	changed_at BIGINT NOT NULL
+);
+
+-- the events of changes read again are written once
+CREATE UNIQUE INDEX outbox_event_id ON outbox (event_id);
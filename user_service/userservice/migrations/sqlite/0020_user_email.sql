@@ -0,0 +1,5 @@
+-- address the user is reached at, shown to admins only and kept out of the events. Unique over every user, deleted
+-- ones included
+ALTER TABLE users ADD COLUMN email TEXT;
+
+CREATE UNIQUE INDEX users_email ON users (email);
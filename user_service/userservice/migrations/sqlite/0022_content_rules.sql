@@ -0,0 +1,10 @@
+-- spam and scam rules the public API checks listings and offer messages against, params is the json of the kind
+CREATE TABLE content_rules (
+	name TEXT NOT NULL PRIMARY KEY,
+	kind TEXT NOT NULL,
+	action TEXT NOT NULL,
+	params TEXT NOT NULL,
+	enabled INTEGER NOT NULL DEFAULT 1,
+	updated_by BIGINT NOT NULL,
+	updated_at BIGINT NOT NULL
+);
@@ -0,0 +1,6 @@
+//go:build !postgres
+
+package userservice
+
+// postgres driver left out to keep the default build free of it, build with -tags postgres to use DATABASE_URL
+const postgresDriver = false
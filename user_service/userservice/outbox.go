@@ -0,0 +1,219 @@
+package userservice
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"events"
+	"logging"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// =========== REPOSITORY LAYER, OUTBOX OF USER EVENTS PUBLISHED BY THE RELAY ===========
+
+var eventsPublished = metrics.NewCounterVec(prometheus.CounterOpts{
+	Name: "events_published_total",
+	Help: "Publish attempts of outbox events, by type and result.",
+}, []string{"type", "result"})
+
+// relay of the outbox to EVENT_PUBLISHER and the webhooks, see events.NewRelay for its settings
+func startOutboxRelay(r *sqlUserRepository) *events.Relay {
+	publisher, err := events.NewPublisher(cfg, cfg.String("OTEL_SERVICE_NAME", "user-service"), http.DefaultTransport)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// the deliveries of the webhooks of the event are queued along with its publish
+	relay := events.NewRelay(cfg, "OUTBOX", r.outbox(), events.Fanout(publisher, webhookQueue{}))
+	relay.Observe = func(eventType, result string) {
+		eventsPublished.WithLabelValues(eventType, result).Inc()
+	}
+	// an event not matching its schema is kept as dead letter instead of breaking consumers
+	relay.Validate = true
+	relay.Start()
+
+	return relay
+}
+
+// run fn in a transaction, committed when fn returns nil
+func (r *sqlUserRepository) withTx(ctx context.Context, fn func(tx *sql.Tx) error) error {
+	tx, err := r.writer.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	if err := fn(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// write event of user id to the outbox in tx, the event is published once tx committed. Nothing with
+// EVENT_SOURCE=cdc, the event is then written from the change of the row
+func (r *sqlUserRepository) insertEvent(ctx context.Context, tx *sql.Tx, eventType string, userID int, data any) error {
+	if eventSource == eventSourceCDC {
+		return nil
+	}
+
+	event, err := events.New(eventType, events.Key("user", userID), logging.RequestID(ctx), data)
+	if err != nil {
+		return err
+	}
+
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, r.rebind("INSERT INTO outbox (event_id, event_type, event_key, payload, next_attempt_at, created_at) VALUES (?, ?, ?, ?, ?, ?)"),
+		event.ID, event.Type, event.Key, string(payload), event.OccurredAt, event.OccurredAt)
+	return err
+}
+
+// events.Outbox over a table of the outbox columns, the events of one value of keyColumn are published in order.
+// Also the queue of the webhook deliveries
+type sqlOutbox struct {
+	r *sqlUserRepository
+	// name in the db query metrics, e.g. claimOutbox
+	name      string
+	table     string
+	keyColumn string
+	// events.Event Key of a row, the prefix and its key column
+	keyPrefix string
+	// status of the events out of attempts, also kept as dead letters of deadLetterSource
+	deadStatus       string
+	deadLetterSource string
+}
+
+func (r *sqlUserRepository) outbox() *sqlOutbox {
+	return &sqlOutbox{r: r, name: "Outbox", table: "outbox", keyColumn: "event_key", deadStatus: "dead", deadLetterSource: DeadLetterUserEvents}
+}
+
+func (o *sqlOutbox) Claim(ctx context.Context, limit int, lease time.Duration) ([]events.Record, error) {
+	ctx, done := o.r.observe(ctx, "claim"+o.name)
+	defer done()
+
+	now := time.Now().UnixMicro()
+	rows, err := o.r.query(ctx, fmt.Sprintf(`SELECT id, attempts, %[2]s, payload FROM %[1]s o
+		WHERE status = 'pending' AND next_attempt_at <= ? AND (locked_until IS NULL OR locked_until < ?)
+		AND NOT EXISTS (SELECT 1 FROM %[1]s p WHERE p.%[2]s = o.%[2]s AND p.status = 'pending' AND p.id < o.id
+			AND (p.next_attempt_at > ? OR p.locked_until >= ?))
+		ORDER BY id LIMIT ?`, o.table, o.keyColumn), now, now, now, now, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	type candidate struct {
+		record  events.Record
+		key     string
+		payload string
+	}
+	var candidates []candidate
+	for rows.Next() {
+		var c candidate
+		if err := rows.Scan(&c.record.ID, &c.record.Attempts, &c.key, &c.payload); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		candidates = append(candidates, c)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	// an event taken meanwhile by another relay updates no row, the newer events of its key are left to it too
+	var claimed []events.Record
+	taken := map[string]bool{}
+	for _, c := range candidates {
+		if taken[c.key] {
+			continue
+		}
+
+		result, err := o.r.exec(ctx, "UPDATE "+o.table+" SET locked_until = ? WHERE id = ? AND (locked_until IS NULL OR locked_until < ?)",
+			time.Now().Add(lease).UnixMicro(), c.record.ID, now)
+		if err != nil {
+			return nil, err
+		}
+		if affected, err := result.RowsAffected(); err != nil || affected == 0 {
+			taken[c.key] = true
+			continue
+		}
+
+		if err := json.Unmarshal([]byte(c.payload), &c.record.Event); err != nil {
+			return nil, err
+		}
+		c.record.Event.Key = o.keyPrefix + c.key
+		claimed = append(claimed, c.record)
+	}
+
+	return claimed, nil
+}
+
+func (o *sqlOutbox) Delivered(ctx context.Context, id int64) error {
+	ctx, done := o.r.observe(ctx, "delivered"+o.name)
+	defer done()
+
+	_, err := o.r.exec(ctx, "UPDATE "+o.table+" SET status = 'delivered', attempts = attempts + 1, delivered_at = ?, locked_until = NULL WHERE id = ?",
+		time.Now().UnixMicro(), id)
+	return err
+}
+
+func (o *sqlOutbox) Retry(ctx context.Context, id int64, attempts int, next time.Time, lastErr string) error {
+	ctx, done := o.r.observe(ctx, "retry"+o.name)
+	defer done()
+
+	_, err := o.r.exec(ctx, "UPDATE "+o.table+" SET attempts = ?, next_attempt_at = ?, last_error = ?, locked_until = NULL WHERE id = ?",
+		attempts, next.UnixMicro(), lastErr, id)
+	return err
+}
+
+// the event stays in the table with the dead status so its key is no longer held back, its dead letter is the copy
+// admins edit and requeue
+func (o *sqlOutbox) Dead(ctx context.Context, record events.Record, attempts int, lastErr string) error {
+	ctx, done := o.r.observe(ctx, "dead"+o.name)
+	defer done()
+
+	now := time.Now().UnixMicro()
+	err := o.r.withTx(ctx, func(tx *sql.Tx) error {
+		_, err := tx.ExecContext(ctx, o.r.rebind("UPDATE "+o.table+" SET status = ?, attempts = ?, last_error = ?, locked_until = NULL WHERE id = ?"),
+			o.deadStatus, attempts, lastErr, record.ID)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.ExecContext(ctx, o.r.rebind(`INSERT INTO dead_letters (source, source_id, event_id, event_type, event_key, payload, attempts, last_error, created_at, updated_at)
+			SELECT ?, id, event_id, event_type, ?, payload, attempts, last_error, ?, ? FROM `+o.table+` WHERE id = ?
+			ON CONFLICT (source, source_id) DO UPDATE SET payload = excluded.payload, attempts = excluded.attempts, last_error = excluded.last_error,
+				updated_at = excluded.updated_at`),
+			o.deadLetterSource, record.Event.Key, now, now, record.ID)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	deadLetterAdded(ctx, o.deadLetterSource)
+	return nil
+}
+
+func (o *sqlOutbox) Purge(ctx context.Context, deliveredBefore time.Time) (int, error) {
+	ctx, done := o.r.observe(ctx, "purge"+o.name)
+	defer done()
+
+	result, err := o.r.exec(ctx, "DELETE FROM "+o.table+" WHERE status = 'delivered' AND delivered_at < ?", deliveredBefore.UnixMicro())
+	if err != nil {
+		return 0, err
+	}
+
+	n, err := result.RowsAffected()
+	return int(n), err
+}
@@ -0,0 +1,118 @@
+package userservice
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"apperror"
+	"events"
+
+	"github.com/gin-gonic/gin"
+)
+
+// delivered event of the outbox, the history the public API replays to a consumer group
+type OutboxEvent struct {
+	ID       int64        `json:"id"`
+	Attempts int          `json:"attempts"`
+	EventKey string       `json:"event_key"`
+	Event    events.Event `json:"event"`
+}
+
+var errOutboxEventsFilter = apperror.Validation("occurred_from must be before occurred_to in unix microseconds, types one of " +
+	strings.Join(events.Types, ", ") + ", after_id at least 0 and limit between 1 and 1000")
+
+// =========== INTERFACE HANDLER, HANDLING REQUEST RESPONSE API DEPEND INTERFACE ===========
+
+// handler request response delivered events of a time range oldest first
+func getOutboxEventsHandler(c *gin.Context) {
+	from, errFrom := strconv.ParseInt(c.Query("occurred_from"), 10, 64)
+	to, errTo := strconv.ParseInt(c.Query("occurred_to"), 10, 64)
+	afterID, errAfter := strconv.ParseInt(c.DefaultQuery("after_id", "0"), 10, 64)
+	limit, errLimit := strconv.Atoi(c.DefaultQuery("limit", "500"))
+	if err := errors.Join(errFrom, errTo, errAfter, errLimit); err != nil {
+		slog.ErrorContext(c.Request.Context(), "handler error", "code", "156", "error", err)
+		apperror.Respond(c, errOutboxEventsFilter)
+		return
+	}
+
+	var types []string
+	if c.Query("types") != "" {
+		types = strings.Split(c.Query("types"), ",")
+	}
+
+	outboxEvents, err := getOutboxEventsUsecase(c.Request.Context(), events.ReplayFilter{Types: types, From: from, To: to}, afterID, limit)
+	if err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"result": true, "events": outboxEvents})
+}
+
+// =========== USECASE LAYER, SERVES AS AN INTERMEDIARY BETWEEN THE PRESENTATION LAYER AND THE DATA LAYER ===========
+
+func getOutboxEventsUsecase(ctx context.Context, filter events.ReplayFilter, afterID int64, limit int) ([]OutboxEvent, error) {
+	if filter.Check() != nil || afterID < 0 || limit < 1 || limit > 1000 {
+		return nil, errOutboxEventsFilter
+	}
+
+	records, err := repo.FindOutboxEvents(ctx, filter, afterID, limit)
+	if err != nil {
+		return nil, errors.New("database error: get outbox events error database")
+	}
+
+	outboxEvents := make([]OutboxEvent, len(records))
+	for i, record := range records {
+		outboxEvents[i] = OutboxEvent{ID: record.ID, Attempts: record.Attempts, EventKey: record.Event.Key, Event: record.Event}
+	}
+	return outboxEvents, nil
+}
+
+// =========== REPOSITORY LAYER, ABSTRACTION OVER THE DATA PERSISTENCE (databases, file systems, or external APIs) ===========
+
+// delivered events of the outbox matching filter after the outbox id afterID, oldest first
+func (r *sqlUserRepository) FindOutboxEvents(ctx context.Context, filter events.ReplayFilter, afterID int64, limit int) ([]events.Record, error) {
+	ctx, done := r.observe(ctx, "findOutboxEvents")
+	defer done()
+
+	query := "SELECT id, attempts, event_key, payload FROM outbox WHERE status = 'delivered' AND created_at >= ? AND created_at < ? AND id > ?"
+	args := []any{filter.From, filter.To, afterID}
+	if len(filter.Types) > 0 {
+		query += " AND event_type IN (?" + strings.Repeat(", ?", len(filter.Types)-1) + ")"
+		for _, eventType := range filter.Types {
+			args = append(args, eventType)
+		}
+	}
+
+	rows, err := r.query(ctx, query+" ORDER BY id LIMIT ?", append(args, limit)...)
+	if err != nil {
+		slog.ErrorContext(ctx, "handler error", "code", "157", "error", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	var records []events.Record
+	for rows.Next() {
+		var record events.Record
+		var payload string
+		if err := rows.Scan(&record.ID, &record.Attempts, &record.Event.Key, &payload); err != nil {
+			slog.ErrorContext(ctx, "handler error", "code", "157", "error", err)
+			return nil, err
+		}
+
+		key := record.Event.Key
+		if err := json.Unmarshal([]byte(payload), &record.Event); err != nil {
+			slog.ErrorContext(ctx, "handler error", "code", "157", "error", err)
+			return nil, err
+		}
+		record.Event.Key = key
+		records = append(records, record)
+	}
+
+	return records, rows.Err()
+}
@@ -0,0 +1,8 @@
+//go:build postgres
+
+package userservice
+
+import _ "github.com/lib/pq"
+
+// postgres driver compiled in, DATABASE_URL can point at postgres
+const postgresDriver = true
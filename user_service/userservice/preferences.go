@@ -0,0 +1,278 @@
+package userservice
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"apperror"
+
+	"github.com/gin-gonic/gin"
+)
+
+// events the public API notifies users of and the channels the notification receiver delivers them over
+var (
+	notificationEvents = []string{
+		"offer_received", "offer_accepted", "offer_rejected", "offer_countered", "offer_withdrawn",
+		"viewing_booked", "viewing_cancelled", "viewing_reminder",
+		"listing_digest", "announcement",
+	}
+	notificationChannels = []string{"email", "push", "in_app"}
+)
+
+// event type to channel to enabled, every event and channel is listed
+type NotificationPreferences struct {
+	UserID      int                        `json:"user_id"`
+	Preferences map[string]map[string]bool `json:"preferences"`
+	// last change of the user or of an override, 0 for users on the defaults
+	UpdatedAt int64 `json:"updated_at"`
+	// the address of the user bounced or complained, emails are not sent whatever the toggles
+	EmailSuppressed bool `json:"email_suppressed"`
+}
+
+// toggles to change, events and channels left out keep their value
+type NotificationPreferencesUpdate struct {
+	Preferences map[string]map[string]bool `json:"preferences" binding:"required"`
+}
+
+// same toggles set for many users at once by an operator holding the internal api key
+type NotificationPreferencesOverride struct {
+	UserIDs     []int                      `json:"user_ids" binding:"required,min=1,max=1000"`
+	Preferences map[string]map[string]bool `json:"preferences" binding:"required"`
+}
+
+var errNotificationPreferencesInvalid = apperror.Validation("preferences must map events of " + strings.Join(notificationEvents, ", ") +
+	" to channels of " + strings.Join(notificationChannels, ", "))
+
+// default of a toggle of users who never changed it, digests are long for a push so they go by email and in-app only
+func defaultNotificationPreference(event, channel string) bool {
+	return event != "listing_digest" || channel != "push"
+}
+
+// =========== INTERFACE HANDLER, HANDLING REQUEST RESPONSE API DEPEND INTERFACE ===========
+
+// handler request response notification preferences, defaults for toggles the user never changed
+func getNotificationPreferencesHandler(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "handler error", "code", "079", "error", "Invalid user ID")
+		apperror.JSON(c, http.StatusBadRequest, "Invalid user ID")
+		return
+	}
+
+	preferences, err := getNotificationPreferencesUsecase(c.Request.Context(), id)
+	if err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"result": true, "preferences": preferences})
+}
+
+// handler request response update notification preferences
+func updateNotificationPreferencesHandler(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "handler error", "code", "080", "error", "Invalid user ID")
+		apperror.JSON(c, http.StatusBadRequest, "Invalid user ID")
+		return
+	}
+
+	var body NotificationPreferencesUpdate
+	if err := c.ShouldBindJSON(&body); err != nil {
+		slog.ErrorContext(c.Request.Context(), "handler error", "code", "081", "error", err)
+		apperror.RespondBinding(c, err)
+		return
+	}
+
+	preferences, err := updateNotificationPreferencesUsecase(c.Request.Context(), id, body)
+	if err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"result": true, "preferences": preferences})
+}
+
+// handler request response override notification preferences of many users, ids of missing users are skipped
+func overrideNotificationPreferencesHandler(c *gin.Context) {
+	var body NotificationPreferencesOverride
+	if err := c.ShouldBindJSON(&body); err != nil {
+		slog.ErrorContext(c.Request.Context(), "handler error", "code", "082", "error", err)
+		apperror.RespondBinding(c, err)
+		return
+	}
+
+	updated, err := overrideNotificationPreferencesUsecase(c.Request.Context(), body)
+	if err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"result": true, "updated": updated})
+}
+
+// =========== USECASE LAYER, SERVES AS AN INTERMEDIARY BETWEEN THE PRESENTATION LAYER AND THE DATA LAYER ===========
+
+func getNotificationPreferencesUsecase(ctx context.Context, userID int) (*NotificationPreferences, error) {
+	if _, err := repo.FindByID(ctx, userID); err != nil {
+		if errors.Is(err, errUserNotFound) {
+			return nil, err
+		}
+		return nil, errors.New("database error: get user error database")
+	}
+
+	preferences, err := repo.FindNotificationPreferences(ctx, userID)
+	if err != nil {
+		return nil, errors.New("database error: get notification preferences error database")
+	}
+
+	if _, err := repo.FindEmailSuppression(ctx, userID); err == nil {
+		preferences.EmailSuppressed = true
+	} else if !errors.Is(err, errEmailSuppressionNotFound) {
+		return nil, errors.New("database error: get email suppression error database")
+	}
+
+	return preferences, nil
+}
+
+func updateNotificationPreferencesUsecase(ctx context.Context, userID int, update NotificationPreferencesUpdate) (*NotificationPreferences, error) {
+	if err := validateNotificationPreferences(update.Preferences); err != nil {
+		return nil, err
+	}
+
+	if _, err := getNotificationPreferencesUsecase(ctx, userID); err != nil {
+		return nil, err
+	}
+
+	if err := repo.SaveNotificationPreferences(ctx, []int{userID}, update.Preferences, time.Now().UnixMicro()); err != nil {
+		return nil, errors.New("database error: update notification preferences error database")
+	}
+
+	return getNotificationPreferencesUsecase(ctx, userID)
+}
+
+// count of the users whose preferences were set
+func overrideNotificationPreferencesUsecase(ctx context.Context, override NotificationPreferencesOverride) (int, error) {
+	if err := validateNotificationPreferences(override.Preferences); err != nil {
+		return 0, err
+	}
+
+	users, err := repo.FindByIDs(ctx, override.UserIDs)
+	if err != nil {
+		return 0, errors.New("database error: get users error database")
+	}
+	if len(users) == 0 {
+		return 0, nil
+	}
+
+	ids := make([]int, len(users))
+	for i, user := range users {
+		ids[i] = user.ID
+	}
+	if err := repo.SaveNotificationPreferences(ctx, ids, override.Preferences, time.Now().UnixMicro()); err != nil {
+		return 0, errors.New("database error: override notification preferences error database")
+	}
+
+	slog.InfoContext(ctx, "notification preferences overridden", "users", len(ids), "preferences", override.Preferences)
+	return len(ids), nil
+}
+
+// at least one toggle, of known events and channels only
+func validateNotificationPreferences(preferences map[string]map[string]bool) error {
+	toggles := 0
+	for event, channels := range preferences {
+		if !slices.Contains(notificationEvents, event) {
+			return errNotificationPreferencesInvalid
+		}
+		for channel := range channels {
+			if !slices.Contains(notificationChannels, channel) {
+				return errNotificationPreferencesInvalid
+			}
+			toggles++
+		}
+	}
+	if toggles == 0 {
+		return errNotificationPreferencesInvalid
+	}
+
+	return nil
+}
+
+// =========== REPOSITORY LAYER, ABSTRACTION OVER THE DATA PERSISTENCE (databases, file systems, or external APIs) ===========
+
+// every toggle of user, the default for toggles without a row
+func (r *sqlUserRepository) FindNotificationPreferences(ctx context.Context, userID int) (*NotificationPreferences, error) {
+	ctx, done := r.observe(ctx, "findNotificationPreferences")
+	defer done()
+
+	preferences := &NotificationPreferences{UserID: userID, Preferences: make(map[string]map[string]bool, len(notificationEvents))}
+	for _, event := range notificationEvents {
+		preferences.Preferences[event] = make(map[string]bool, len(notificationChannels))
+		for _, channel := range notificationChannels {
+			preferences.Preferences[event][channel] = defaultNotificationPreference(event, channel)
+		}
+	}
+
+	rows, err := r.query(ctx, "SELECT event, channel, enabled, updated_at FROM notification_preferences WHERE user_id = ?", userID)
+	if err != nil {
+		slog.ErrorContext(ctx, "handler error", "code", "083", "error", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var event, channel string
+		var enabled int
+		var updatedAt int64
+		if err := rows.Scan(&event, &channel, &enabled, &updatedAt); err != nil {
+			slog.ErrorContext(ctx, "handler error", "code", "083", "error", err)
+			return nil, err
+		}
+		// rows of events or channels no longer notified are ignored
+		if channels, ok := preferences.Preferences[event]; ok && slices.Contains(notificationChannels, channel) {
+			channels[channel] = enabled != 0
+		}
+		preferences.UpdatedAt = max(preferences.UpdatedAt, updatedAt)
+	}
+
+	return preferences, rows.Err()
+}
+
+// set the toggles of preferences for each user in one transaction
+func (r *sqlUserRepository) SaveNotificationPreferences(ctx context.Context, userIDs []int, preferences map[string]map[string]bool, updatedAt int64) error {
+	ctx, done := r.observe(ctx, "saveNotificationPreferences")
+	defer done()
+
+	err := r.withTx(ctx, func(tx *sql.Tx) error {
+		query := r.rebind(`INSERT INTO notification_preferences (user_id, event, channel, enabled, updated_at) VALUES (?, ?, ?, ?, ?)
+			ON CONFLICT (user_id, event, channel) DO UPDATE SET enabled = excluded.enabled, updated_at = excluded.updated_at`)
+		for _, userID := range userIDs {
+			for event, channels := range preferences {
+				for channel, enabled := range channels {
+					// integer column, postgres does not take a bool for it
+					flag := 0
+					if enabled {
+						flag = 1
+					}
+					if _, err := tx.ExecContext(ctx, query, userID, event, channel, flag, updatedAt); err != nil {
+						return err
+					}
+				}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		slog.ErrorContext(ctx, "handler error", "code", "084", "error", err)
+		return err
+	}
+
+	return nil
+}
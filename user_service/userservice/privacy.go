@@ -0,0 +1,175 @@
+package userservice
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"apperror"
+
+	"github.com/gin-gonic/gin"
+)
+
+// what the public profile of a user shows, the name is always public
+type PrivacySettings struct {
+	UserID int `json:"user_id"`
+	// false hides the whole profile
+	ProfileVisible   bool  `json:"profile_visible"`
+	ShowMemberSince  bool  `json:"show_member_since"`
+	ShowListingCount bool  `json:"show_listing_count"`
+	UpdatedAt        int64 `json:"updated_at"`
+}
+
+// unset fields keep their current value
+type PrivacyUpdate struct {
+	ProfileVisible   *bool `json:"profile_visible"`
+	ShowMemberSince  *bool `json:"show_member_since"`
+	ShowListingCount *bool `json:"show_listing_count"`
+}
+
+var errPrivacyUpdateEmpty = apperror.Validation("nothing to update, set profile_visible, show_member_since or show_listing_count")
+
+// =========== INTERFACE HANDLER, HANDLING REQUEST RESPONSE API DEPEND INTERFACE ===========
+
+// handler request response privacy settings, defaults for users who never changed them
+func getUserPrivacyHandler(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "handler error", "code", "058", "error", "Invalid user ID")
+		apperror.JSON(c, http.StatusBadRequest, "Invalid user ID")
+		return
+	}
+
+	privacy, err := getUserPrivacyUsecase(c.Request.Context(), id)
+	if err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"result": true, "privacy": privacy})
+}
+
+// handler request response update privacy settings
+func updateUserPrivacyHandler(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "handler error", "code", "059", "error", "Invalid user ID")
+		apperror.JSON(c, http.StatusBadRequest, "Invalid user ID")
+		return
+	}
+
+	var body PrivacyUpdate
+	if err := c.ShouldBindJSON(&body); err != nil {
+		slog.ErrorContext(c.Request.Context(), "handler error", "code", "060", "error", err)
+		apperror.RespondBinding(c, err)
+		return
+	}
+
+	privacy, err := updateUserPrivacyUsecase(c.Request.Context(), id, body)
+	if err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"result": true, "privacy": privacy})
+}
+
+// =========== USECASE LAYER, SERVES AS AN INTERMEDIARY BETWEEN THE PRESENTATION LAYER AND THE DATA LAYER ===========
+
+func getUserPrivacyUsecase(ctx context.Context, userID int) (*PrivacySettings, error) {
+	if _, err := repo.FindByID(ctx, userID); err != nil {
+		if errors.Is(err, errUserNotFound) {
+			return nil, err
+		}
+		return nil, errors.New("database error: get user error database")
+	}
+
+	privacy, err := repo.FindPrivacyByUserID(ctx, userID)
+	if err != nil {
+		return nil, errors.New("database error: get privacy error database")
+	}
+
+	return privacy, nil
+}
+
+func updateUserPrivacyUsecase(ctx context.Context, userID int, update PrivacyUpdate) (*PrivacySettings, error) {
+	if update.ProfileVisible == nil && update.ShowMemberSince == nil && update.ShowListingCount == nil {
+		return nil, errPrivacyUpdateEmpty
+	}
+
+	privacy, err := getUserPrivacyUsecase(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if update.ProfileVisible != nil {
+		privacy.ProfileVisible = *update.ProfileVisible
+	}
+	if update.ShowMemberSince != nil {
+		privacy.ShowMemberSince = *update.ShowMemberSince
+	}
+	if update.ShowListingCount != nil {
+		privacy.ShowListingCount = *update.ShowListingCount
+	}
+	privacy.UpdatedAt = time.Now().UnixNano() / int64(time.Microsecond)
+
+	if err := repo.SavePrivacy(ctx, privacy); err != nil {
+		return nil, errors.New("database error: update privacy error database")
+	}
+
+	return privacy, nil
+}
+
+// =========== REPOSITORY LAYER, ABSTRACTION OVER THE DATA PERSISTENCE (databases, file systems, or external APIs) ===========
+
+// settings of user, everything shown when the user has no row
+func (r *sqlUserRepository) FindPrivacyByUserID(ctx context.Context, userID int) (*PrivacySettings, error) {
+	ctx, done := r.observe(ctx, "findPrivacyByUserID")
+	defer done()
+
+	privacy := PrivacySettings{UserID: userID, ProfileVisible: true, ShowMemberSince: true, ShowListingCount: true}
+	var visible, memberSince, listingCount int
+	err := r.queryRowPrepared(ctx, "SELECT profile_visible, show_member_since, show_listing_count, updated_at FROM user_privacy WHERE user_id = ?", userID).
+		Scan(&visible, &memberSince, &listingCount, &privacy.UpdatedAt)
+	if err == sql.ErrNoRows {
+		return &privacy, nil
+	}
+	if err != nil {
+		slog.ErrorContext(ctx, "handler error", "code", "061", "error", err)
+		return nil, err
+	}
+
+	privacy.ProfileVisible = visible != 0
+	privacy.ShowMemberSince = memberSince != 0
+	privacy.ShowListingCount = listingCount != 0
+	return &privacy, nil
+}
+
+func (r *sqlUserRepository) SavePrivacy(ctx context.Context, privacy *PrivacySettings) error {
+	ctx, done := r.observe(ctx, "savePrivacy")
+	defer done()
+
+	// integer columns, postgres does not take a bool for them
+	flag := func(b bool) int {
+		if b {
+			return 1
+		}
+		return 0
+	}
+
+	_, err := r.exec(ctx, `INSERT INTO user_privacy (user_id, profile_visible, show_member_since, show_listing_count, updated_at)
+		VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT (user_id) DO UPDATE SET profile_visible = excluded.profile_visible, show_member_since = excluded.show_member_since,
+		show_listing_count = excluded.show_listing_count, updated_at = excluded.updated_at`,
+		privacy.UserID, flag(privacy.ProfileVisible), flag(privacy.ShowMemberSince), flag(privacy.ShowListingCount), privacy.UpdatedAt)
+	if err != nil {
+		slog.ErrorContext(ctx, "handler error", "code", "062", "error", err)
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,114 @@
+package userservice
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"apperror"
+	"events"
+
+	"github.com/gin-gonic/gin"
+)
+
+// roles of a user, the public API lets only admins call its admin operations and only auditors read the audit chain.
+// Users are created with RoleUser, the role is changed by an admin or by an operator holding the internal api key
+const (
+	RoleUser    = "user"
+	RoleAgent   = "agent"
+	RoleAdmin   = "admin"
+	RoleAuditor = "auditor"
+)
+
+type UserRole struct {
+	Role string `json:"role" binding:"required,oneof=user agent admin auditor"`
+}
+
+// =========== INTERFACE HANDLER, HANDLING REQUEST RESPONSE API DEPEND INTERFACE ===========
+
+// handler request response set the role of user, responds the user with the new role
+func setUserRoleHandler(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "handler error", "code", "144", "error", "Invalid user ID")
+		apperror.JSON(c, http.StatusBadRequest, "Invalid user ID")
+		return
+	}
+
+	var body UserRole
+	if err := c.ShouldBindJSON(&body); err != nil {
+		slog.ErrorContext(c.Request.Context(), "handler error", "code", "145", "error", err)
+		apperror.RespondBinding(c, err)
+		return
+	}
+
+	user, err := setUserRoleUsecase(c.Request.Context(), id, body.Role)
+	if err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"result": true, "user": user})
+}
+
+// =========== USECASE LAYER, SERVES AS AN INTERMEDIARY BETWEEN THE PRESENTATION LAYER AND THE DATA LAYER ===========
+
+func setUserRoleUsecase(ctx context.Context, userID int, role string) (*User, error) {
+	if err := repo.SetRole(ctx, userID, role); err != nil {
+		if errors.Is(err, errUserNotFound) {
+			return nil, err
+		}
+		return nil, errors.New("database error: set user role error database")
+	}
+
+	user, err := repo.FindByID(ctx, userID)
+	if err != nil {
+		return nil, errors.New("database error: get detail user error database")
+	}
+
+	slog.InfoContext(ctx, "audit: user role set", "user_id", userID, "role", role)
+	return user, nil
+}
+
+// =========== REPOSITORY LAYER, ABSTRACTION OVER THE DATA PERSISTENCE (databases, file systems, or external APIs) ===========
+
+// set role of a user not deleted, the user.updated event carries the new role
+func (r *sqlUserRepository) SetRole(ctx context.Context, id int, role string) error {
+	ctx, done := r.observe(ctx, "setRole")
+	defer done()
+
+	var affected int64
+	err := r.withTx(ctx, func(tx *sql.Tx) error {
+		now := time.Now().UnixMicro()
+		result, err := tx.ExecContext(ctx, r.rebind("UPDATE users SET role = ?, updated_at = ? WHERE id = ? AND deleted_at IS NULL"), role, now, id)
+		if err != nil {
+			return err
+		}
+
+		if affected, err = result.RowsAffected(); err != nil || affected == 0 {
+			return err
+		}
+
+		var user User
+		err = tx.QueryRowContext(ctx, r.rebind("SELECT id, name, role, created_at, updated_at FROM users WHERE id = ?"), id).
+			Scan(&user.ID, &user.Name, &user.Role, &user.CreatedAt, &user.UpdatedAt)
+		if err != nil {
+			return err
+		}
+		return r.insertEvent(ctx, tx, events.UserUpdated, id, user)
+	})
+	if err != nil {
+		slog.ErrorContext(ctx, "handler error", "code", "146", "error", err)
+		return err
+	}
+
+	if affected == 0 {
+		return errUserNotFound
+	}
+
+	return nil
+}
@@ -0,0 +1,93 @@
+package userservice
+
+import (
+	"context"
+	"embed"
+	"flag"
+	"log"
+	"log/slog"
+	"math/rand"
+	"strings"
+	"time"
+
+	"logging"
+)
+
+// =========== REPOSITORY LAYER, FAKE USERS FOR DEVELOPMENT AND LOAD TESTS ===========
+
+// first and last names the fake users are made of, one per line
+//
+//go:embed seed
+var seedFiles embed.FS
+
+// Seed create fake users through the repository and exit, args are --users, --password and --rand-seed.
+// Users are created like POST /users, with their user.created event
+func Seed(args []string) {
+	slog.SetDefault(logging.New(cfg.String("OTEL_SERVICE_NAME", "user-service"), cfg.String("LOG_LEVEL", "info")))
+
+	flags := flag.NewFlagSet("seed", flag.ExitOnError)
+	count := flags.Int("users", 100, "users to create")
+	password := flags.String("password", "", "password of every user so they can log in, empty leaves them without one")
+	randSeed := flags.Int64("rand-seed", 0, "seed of the generated names, the same seed gives the same users, 0 picks one")
+	flags.Parse(args)
+	if *count < 1 {
+		log.Fatal("--users must be at least 1")
+	}
+	if *randSeed == 0 {
+		*randSeed = time.Now().UnixNano()
+	}
+
+	firstNames, err := readSeedNames("seed/first_names.txt")
+	if err != nil {
+		log.Fatal(err)
+	}
+	lastNames, err := readSeedNames("seed/last_names.txt")
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// one hash for every user, hashing is made slow on purpose
+	var passwordHash string
+	if *password != "" {
+		if passwordHash, err = hashPassword(*password); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	r := openUserRepository()
+	defer r.Close()
+	r.migrateOnStart()
+
+	ctx := context.Background()
+	random := rand.New(rand.NewSource(*randSeed))
+	var first, last int
+	for i := 0; i < *count; i++ {
+		name := firstNames[random.Intn(len(firstNames))] + " " + lastNames[random.Intn(len(lastNames))]
+		user, err := r.Create(ctx, name, "", passwordHash)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if first == 0 {
+			first = user.ID
+		}
+		last = user.ID
+	}
+
+	slog.Info("seeded users", "users", *count, "first_id", first, "last_id", last, "rand_seed", *randSeed)
+}
+
+// non empty lines of the embedded file
+func readSeedNames(file string) ([]string, error) {
+	content, err := seedFiles.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	var names []string
+	for _, line := range strings.Split(string(content), "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			names = append(names, line)
+		}
+	}
+	return names, nil
+}
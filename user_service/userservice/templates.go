@@ -0,0 +1,252 @@
+package userservice
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"apperror"
+
+	"github.com/gin-gonic/gin"
+)
+
+// subject and body of the notifications of an event over a channel in a locale, the public API renders them with
+// text/template. Every save adds a version, the latest version is the one rendered
+type NotificationTemplate struct {
+	Event   string `json:"event"`
+	Channel string `json:"channel"`
+	Locale  string `json:"locale"`
+	Version int    `json:"version"`
+	Subject string `json:"subject"`
+	Body    string `json:"body"`
+	// admin who saved the version, 0 for an operator holding the internal api key
+	CreatedBy int   `json:"created_by"`
+	CreatedAt int64 `json:"created_at"`
+}
+
+// new version of a template, the public API checks it parses before saving it
+type NotificationTemplateCreate struct {
+	Event     string `json:"event" binding:"required"`
+	Channel   string `json:"channel" binding:"required,oneof=email push in_app"`
+	Locale    string `json:"locale" binding:"required,bcp47_language_tag"`
+	Subject   string `json:"subject" binding:"max=200"`
+	Body      string `json:"body" binding:"required,max=10000"`
+	CreatedBy int    `json:"created_by" binding:"min=0"`
+}
+
+var (
+	errNotificationTemplateNotFound = apperror.NotFound("Notification template not found")
+	errNotificationTemplateEvent    = apperror.Validation("event must be one of " + strings.Join(notificationEvents, ", "))
+)
+
+// =========== INTERFACE HANDLER, HANDLING REQUEST RESPONSE API DEPEND INTERFACE ===========
+
+// handler request response latest version of every template
+func getNotificationTemplatesHandler(c *gin.Context) {
+	templates, err := getNotificationTemplatesUsecase(c.Request.Context())
+	if err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"result": true, "templates": templates})
+}
+
+// handler request response versions of a template newest first
+func getNotificationTemplateVersionsHandler(c *gin.Context) {
+	templates, err := getNotificationTemplateVersionsUsecase(c.Request.Context(), c.Param("event"), c.Param("channel"), c.Param("locale"))
+	if err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"result": true, "templates": templates})
+}
+
+// handler request response save a new version of a template
+func createNotificationTemplateHandler(c *gin.Context) {
+	var body NotificationTemplateCreate
+	if err := c.ShouldBindJSON(&body); err != nil {
+		slog.ErrorContext(c.Request.Context(), "handler error", "code", "151", "error", err)
+		apperror.RespondBinding(c, err)
+		return
+	}
+
+	template, err := createNotificationTemplateUsecase(c.Request.Context(), body)
+	if err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"result": true, "template": template})
+}
+
+// handler request response delete every version of a template, the built-in one of the public API is rendered again
+func deleteNotificationTemplateHandler(c *gin.Context) {
+	if err := deleteNotificationTemplateUsecase(c.Request.Context(), c.Param("event"), c.Param("channel"), c.Param("locale")); err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"result": true})
+}
+
+// =========== USECASE LAYER, SERVES AS AN INTERMEDIARY BETWEEN THE PRESENTATION LAYER AND THE DATA LAYER ===========
+
+func getNotificationTemplatesUsecase(ctx context.Context) ([]NotificationTemplate, error) {
+	templates, err := repo.FindNotificationTemplates(ctx)
+	if err != nil {
+		return nil, errors.New("database error: get notification templates error database")
+	}
+
+	return templates, nil
+}
+
+func getNotificationTemplateVersionsUsecase(ctx context.Context, event, channel, locale string) ([]NotificationTemplate, error) {
+	templates, err := repo.FindNotificationTemplateVersions(ctx, event, channel, locale)
+	if err != nil {
+		return nil, errors.New("database error: get notification template versions error database")
+	}
+	if len(templates) == 0 {
+		return nil, errNotificationTemplateNotFound
+	}
+
+	return templates, nil
+}
+
+func createNotificationTemplateUsecase(ctx context.Context, body NotificationTemplateCreate) (*NotificationTemplate, error) {
+	if !slices.Contains(notificationEvents, body.Event) {
+		return nil, errNotificationTemplateEvent
+	}
+
+	template := &NotificationTemplate{
+		Event:     body.Event,
+		Channel:   body.Channel,
+		Locale:    body.Locale,
+		Subject:   body.Subject,
+		Body:      body.Body,
+		CreatedBy: body.CreatedBy,
+		CreatedAt: time.Now().UnixMicro(),
+	}
+	if err := repo.CreateNotificationTemplate(ctx, template); err != nil {
+		return nil, errors.New("database error: create notification template error database")
+	}
+
+	slog.InfoContext(ctx, "notification template saved", "event", template.Event, "channel", template.Channel, "locale", template.Locale,
+		"version", template.Version, "created_by", template.CreatedBy)
+	return template, nil
+}
+
+func deleteNotificationTemplateUsecase(ctx context.Context, event, channel, locale string) error {
+	if err := repo.DeleteNotificationTemplate(ctx, event, channel, locale); err != nil {
+		if errors.Is(err, errNotificationTemplateNotFound) {
+			return err
+		}
+		return errors.New("database error: delete notification template error database")
+	}
+
+	slog.InfoContext(ctx, "notification template deleted", "event", event, "channel", channel, "locale", locale)
+	return nil
+}
+
+// =========== REPOSITORY LAYER, ABSTRACTION OVER THE DATA PERSISTENCE (databases, file systems, or external APIs) ===========
+
+const notificationTemplateColumns = "event, channel, locale, version, subject, body, created_by, created_at"
+
+func scanNotificationTemplates(ctx context.Context, rows *sql.Rows, code string) ([]NotificationTemplate, error) {
+	defer rows.Close()
+
+	templates := []NotificationTemplate{}
+	for rows.Next() {
+		var t NotificationTemplate
+		if err := rows.Scan(&t.Event, &t.Channel, &t.Locale, &t.Version, &t.Subject, &t.Body, &t.CreatedBy, &t.CreatedAt); err != nil {
+			slog.ErrorContext(ctx, "handler error", "code", code, "error", err)
+			return nil, err
+		}
+		templates = append(templates, t)
+	}
+
+	return templates, rows.Err()
+}
+
+// latest version of every event, channel and locale
+func (r *sqlUserRepository) FindNotificationTemplates(ctx context.Context) ([]NotificationTemplate, error) {
+	ctx, done := r.observe(ctx, "findNotificationTemplates")
+	defer done()
+
+	rows, err := r.query(ctx, `SELECT `+notificationTemplateColumns+` FROM notification_templates t
+		WHERE version = (SELECT MAX(version) FROM notification_templates WHERE event = t.event AND channel = t.channel AND locale = t.locale)
+		ORDER BY event, channel, locale`)
+	if err != nil {
+		slog.ErrorContext(ctx, "handler error", "code", "152", "error", err)
+		return nil, err
+	}
+
+	return scanNotificationTemplates(ctx, rows, "152")
+}
+
+// versions of a template newest first
+func (r *sqlUserRepository) FindNotificationTemplateVersions(ctx context.Context, event, channel, locale string) ([]NotificationTemplate, error) {
+	ctx, done := r.observe(ctx, "findNotificationTemplateVersions")
+	defer done()
+
+	rows, err := r.query(ctx, "SELECT "+notificationTemplateColumns+" FROM notification_templates WHERE event = ? AND channel = ? AND locale = ? ORDER BY version DESC",
+		event, channel, locale)
+	if err != nil {
+		slog.ErrorContext(ctx, "handler error", "code", "153", "error", err)
+		return nil, err
+	}
+
+	return scanNotificationTemplates(ctx, rows, "153")
+}
+
+// insert template as the version after the latest one of its event, channel and locale, sets Version
+func (r *sqlUserRepository) CreateNotificationTemplate(ctx context.Context, template *NotificationTemplate) error {
+	ctx, done := r.observe(ctx, "createNotificationTemplate")
+	defer done()
+
+	err := r.withTx(ctx, func(tx *sql.Tx) error {
+		err := tx.QueryRowContext(ctx, r.rebind("SELECT COALESCE(MAX(version), 0) + 1 FROM notification_templates WHERE event = ? AND channel = ? AND locale = ?"),
+			template.Event, template.Channel, template.Locale).Scan(&template.Version)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.ExecContext(ctx, r.rebind("INSERT INTO notification_templates ("+notificationTemplateColumns+") VALUES (?, ?, ?, ?, ?, ?, ?, ?)"),
+			template.Event, template.Channel, template.Locale, template.Version, template.Subject, template.Body, template.CreatedBy, template.CreatedAt)
+		return err
+	})
+	if err != nil {
+		slog.ErrorContext(ctx, "handler error", "code", "154", "error", err)
+		return err
+	}
+
+	return nil
+}
+
+func (r *sqlUserRepository) DeleteNotificationTemplate(ctx context.Context, event, channel, locale string) error {
+	ctx, done := r.observe(ctx, "deleteNotificationTemplate")
+	defer done()
+
+	result, err := r.exec(ctx, "DELETE FROM notification_templates WHERE event = ? AND channel = ? AND locale = ?", event, channel, locale)
+	if err != nil {
+		slog.ErrorContext(ctx, "handler error", "code", "155", "error", err)
+		return err
+	}
+
+	deleted, err := result.RowsAffected()
+	if err != nil {
+		slog.ErrorContext(ctx, "handler error", "code", "155", "error", err)
+		return err
+	}
+	if deleted == 0 {
+		return errNotificationTemplateNotFound
+	}
+
+	return nil
+}
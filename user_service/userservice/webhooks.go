@@ -0,0 +1,660 @@
+package userservice
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"apperror"
+	"events"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// callback url of a user notified of the events of its types
+type Webhook struct {
+	ID     int      `json:"id"`
+	UserID int      `json:"user_id"`
+	URL    string   `json:"url"`
+	Events []string `json:"events"`
+	// key of the signature of the deliveries, only returned when the webhook is created
+	Secret    string `json:"secret,omitempty"`
+	CreatedAt int64  `json:"created_at"`
+}
+
+type WebhookCreate struct {
+	URL    string   `json:"url" form:"url" binding:"required,max=2000"`
+	Events []string `json:"events" form:"events" binding:"required,min=1"`
+}
+
+// delivery of an event to a webhook, pending until the callback answered 2xx, failed once out of attempts
+type WebhookDelivery struct {
+	ID        int64  `json:"id"`
+	WebhookID int    `json:"webhook_id"`
+	EventID   string `json:"event_id"`
+	EventType string `json:"event_type"`
+	Status    string `json:"status"`
+	Attempts  int    `json:"attempts"`
+	// unix micro time of the next attempt of a pending delivery
+	NextAttemptAt *int64 `json:"next_attempt_at"`
+	LastError     string `json:"last_error,omitempty"`
+	CreatedAt     int64  `json:"created_at"`
+	DeliveredAt   *int64 `json:"delivered_at"`
+}
+
+var (
+	// WEBHOOK_MAX_PER_USER webhooks a user may register
+	webhookMaxPerUser = cfg.Int("WEBHOOK_MAX_PER_USER", 10)
+
+	webhookDeliveryStatuses = []string{"pending", "delivered", "failed"}
+
+	errWebhookNotFound        = apperror.NotFound("Webhook not found")
+	errWebhookURLInvalid      = apperror.Validation("url must be an absolute http or https url")
+	errWebhookEventInvalid    = apperror.Validation("invalid events, supported values: " + strings.Join(events.Types, ", "))
+	errWebhookLimit           = apperror.Conflict(fmt.Sprintf("at most %d webhooks per user", webhookMaxPerUser))
+	errWebhookStatusInvalid   = apperror.Validation("invalid status, supported values: " + strings.Join(webhookDeliveryStatuses, ", "))
+	errWebhookLimitInvalid    = apperror.Validation("limit must be between 1 and 200")
+	errWebhookEventIncomplete = apperror.Validation("event must have an id and a supported type")
+
+	webhookAttempts = metrics.NewCounterVec(prometheus.CounterOpts{
+		Name: "webhook_deliveries_total",
+		Help: "Delivery attempts of events to webhooks, by event type and result.",
+	}, []string{"type", "result"})
+)
+
+// =========== INTERFACE HANDLER, HANDLING REQUEST RESPONSE API DEPEND INTERFACE ===========
+
+// handler request response webhooks of the user, without their secrets
+func getUserWebhooksHandler(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "handler error", "code", "063", "error", "Invalid user ID")
+		apperror.JSON(c, http.StatusBadRequest, "Invalid user ID")
+		return
+	}
+
+	webhooks, err := getUserWebhooksUsecase(c.Request.Context(), id)
+	if err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"result": true, "webhooks": webhooks})
+}
+
+// handler request response register webhook, the response is the only one carrying its secret
+func createUserWebhookHandler(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "handler error", "code", "064", "error", "Invalid user ID")
+		apperror.JSON(c, http.StatusBadRequest, "Invalid user ID")
+		return
+	}
+
+	var body WebhookCreate
+	if err := c.ShouldBind(&body); err != nil {
+		slog.ErrorContext(c.Request.Context(), "handler error", "code", "065", "error", "Invalid body request")
+		apperror.RespondBinding(c, err)
+		return
+	}
+
+	webhook, err := createUserWebhookUsecase(c.Request.Context(), id, body)
+	if err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"result": true, "webhook": webhook})
+}
+
+// handler request response delete webhook with its deliveries
+func deleteUserWebhookHandler(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "handler error", "code", "066", "error", "Invalid user ID")
+		apperror.JSON(c, http.StatusBadRequest, "Invalid user ID")
+		return
+	}
+
+	webhookID, err := strconv.Atoi(c.Param("webhook_id"))
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "handler error", "code", "067", "error", "Invalid webhook ID")
+		apperror.JSON(c, http.StatusBadRequest, "Invalid webhook ID")
+		return
+	}
+
+	if err := deleteUserWebhookUsecase(c.Request.Context(), id, webhookID); err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"result": true})
+}
+
+// handler request response latest deliveries of a webhook of the user, optionally of one status
+func getWebhookDeliveriesHandler(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "handler error", "code", "068", "error", "Invalid user ID")
+		apperror.JSON(c, http.StatusBadRequest, "Invalid user ID")
+		return
+	}
+
+	webhookID, err := strconv.Atoi(c.Param("webhook_id"))
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "handler error", "code", "069", "error", "Invalid webhook ID")
+		apperror.JSON(c, http.StatusBadRequest, "Invalid webhook ID")
+		return
+	}
+
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "50"))
+	if err != nil {
+		apperror.Respond(c, errWebhookLimitInvalid)
+		return
+	}
+
+	deliveries, err := getWebhookDeliveriesUsecase(c.Request.Context(), id, webhookID, c.Query("status"), limit)
+	if err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"result": true, "deliveries": deliveries})
+}
+
+// handler request response queue the deliveries of an event of another service, the public API relays the
+// listing events here. Only reachable by the services since the public api does not expose it
+func publishWebhookEventHandler(c *gin.Context) {
+	var event events.Event
+	if err := c.ShouldBindJSON(&event); err != nil {
+		slog.ErrorContext(c.Request.Context(), "handler error", "code", "070", "error", "Invalid body request")
+		apperror.RespondBinding(c, err)
+		return
+	}
+
+	queued, err := publishWebhookEventUsecase(c.Request.Context(), event)
+	if err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"result": true, "deliveries": queued})
+}
+
+// =========== USECASE LAYER, SERVES AS AN INTERMEDIARY BETWEEN THE PRESENTATION LAYER AND THE DATA LAYER ===========
+
+func getUserWebhooksUsecase(ctx context.Context, userID int) ([]Webhook, error) {
+	webhooks, err := repo.FindWebhooksByUserID(ctx, userID)
+	if err != nil {
+		return nil, errors.New("database error: get webhooks error database")
+	}
+
+	return webhooks, nil
+}
+
+func createUserWebhookUsecase(ctx context.Context, userID int, body WebhookCreate) (*Webhook, error) {
+	target, err := url.Parse(body.URL)
+	if err != nil || (target.Scheme != "http" && target.Scheme != "https") || target.Host == "" {
+		return nil, errWebhookURLInvalid
+	}
+
+	var types []string
+	for _, eventType := range body.Events {
+		if !slices.Contains(events.Types, eventType) {
+			return nil, errWebhookEventInvalid
+		}
+		if !slices.Contains(types, eventType) {
+			types = append(types, eventType)
+		}
+	}
+
+	if _, err := repo.FindByID(ctx, userID); err != nil {
+		if errors.Is(err, errUserNotFound) {
+			return nil, err
+		}
+		return nil, errors.New("database error: get user error database")
+	}
+
+	webhooks, err := repo.FindWebhooksByUserID(ctx, userID)
+	if err != nil {
+		return nil, errors.New("database error: get webhooks error database")
+	}
+	if len(webhooks) >= webhookMaxPerUser {
+		return nil, errWebhookLimit
+	}
+
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return nil, err
+	}
+
+	webhook := &Webhook{
+		UserID:    userID,
+		URL:       target.String(),
+		Events:    types,
+		Secret:    "whsec_" + hex.EncodeToString(secret),
+		CreatedAt: time.Now().UnixMicro(),
+	}
+	if err := repo.CreateWebhook(ctx, webhook); err != nil {
+		return nil, errors.New("database error: create webhook error database")
+	}
+
+	slog.InfoContext(ctx, "audit: webhook created", "user_id", userID, "webhook_id", webhook.ID, "events", strings.Join(types, ","))
+	return webhook, nil
+}
+
+func deleteUserWebhookUsecase(ctx context.Context, userID, webhookID int) error {
+	if err := repo.DeleteWebhook(ctx, userID, webhookID); err != nil {
+		if errors.Is(err, errWebhookNotFound) {
+			return err
+		}
+		return errors.New("database error: delete webhook error database")
+	}
+
+	slog.InfoContext(ctx, "audit: webhook deleted", "user_id", userID, "webhook_id", webhookID)
+	return nil
+}
+
+func getWebhookDeliveriesUsecase(ctx context.Context, userID, webhookID int, status string, limit int) ([]WebhookDelivery, error) {
+	if status != "" && !slices.Contains(webhookDeliveryStatuses, status) {
+		return nil, errWebhookStatusInvalid
+	}
+	if limit < 1 || limit > 200 {
+		return nil, errWebhookLimitInvalid
+	}
+
+	webhook, err := repo.FindWebhookByID(ctx, webhookID)
+	if err != nil {
+		if errors.Is(err, errWebhookNotFound) {
+			return nil, err
+		}
+		return nil, errors.New("database error: get webhook error database")
+	}
+	// webhooks of other users are not found, their ids are not revealed
+	if webhook.UserID != userID {
+		return nil, errWebhookNotFound
+	}
+
+	deliveries, err := repo.FindWebhookDeliveries(ctx, webhookID, status, limit)
+	if err != nil {
+		return nil, errors.New("database error: get webhook deliveries error database")
+	}
+
+	return deliveries, nil
+}
+
+// queue a delivery of event to every webhook of its type, an event queued again is delivered once. Returns the
+// count of webhooks of the event
+func publishWebhookEventUsecase(ctx context.Context, event events.Event) (int, error) {
+	if event.ID == "" || !slices.Contains(events.Types, event.Type) {
+		return 0, errWebhookEventIncomplete
+	}
+
+	webhooks, err := repo.FindWebhooksByEvent(ctx, event.Type)
+	if err != nil {
+		return 0, errors.New("database error: get webhooks error database")
+	}
+	if len(webhooks) == 0 {
+		return 0, nil
+	}
+
+	payload, err := webhookPayload(event)
+	if err != nil {
+		return 0, err
+	}
+
+	ids := make([]int, len(webhooks))
+	for i, webhook := range webhooks {
+		ids[i] = webhook.ID
+	}
+	if err := repo.CreateWebhookDeliveries(ctx, ids, event, payload); err != nil {
+		return 0, errors.New("database error: create webhook deliveries error database")
+	}
+
+	return len(webhooks), nil
+}
+
+// body of the deliveries of event, user events only carry the id of the user since users are not public
+func webhookPayload(event events.Event) (string, error) {
+	if strings.HasPrefix(event.Type, "user.") {
+		var user struct {
+			ID int `json:"id"`
+		}
+		if err := json.Unmarshal(event.Data, &user); err != nil {
+			return "", err
+		}
+
+		data, err := json.Marshal(user)
+		if err != nil {
+			return "", err
+		}
+		event.Data = data
+	}
+
+	payload, err := json.Marshal(event)
+	return string(payload), err
+}
+
+// sha256=<hex hmac of "<timestamp>.<body>"> with the secret of the webhook, receivers recompute it to check the
+// delivery comes from us and refuse old timestamps against replays
+func webhookSignature(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// =========== REPOSITORY LAYER, DELIVERY OF THE EVENTS TO THE WEBHOOKS ===========
+
+// events.Publisher queueing the deliveries of every event published by the outbox relay
+type webhookQueue struct{}
+
+func (webhookQueue) Publish(ctx context.Context, event events.Event) error {
+	_, err := publishWebhookEventUsecase(ctx, event)
+	return err
+}
+
+func (webhookQueue) Close() error { return nil }
+
+// worker posting the queued deliveries with the retries and dead letters of an outbox relay, see events.NewRelay
+// for the WEBHOOK_ settings. The deliveries of one webhook are made in order
+func startWebhookWorker(r *sqlUserRepository) *events.Relay {
+	relay := events.NewRelay(cfg, "WEBHOOK", r.webhookDeliveries(), webhookSender{client: newWebhookClient()})
+	relay.Observe = func(eventType, result string) {
+		webhookAttempts.WithLabelValues(eventType, result).Inc()
+	}
+	relay.Start()
+
+	return relay
+}
+
+// WEBHOOK_TIMEOUT max duration of one delivery
+// WEBHOOK_ALLOW_PRIVATE deliver to loopback, private and link-local addresses too, e.g. to test on a laptop. Off, a
+// webhook can not reach the internal network of the services
+func newWebhookClient() *http.Client {
+	dialer := &net.Dialer{Timeout: 5 * time.Second}
+	if !cfg.Bool("WEBHOOK_ALLOW_PRIVATE", false) {
+		// checked on the resolved address, so a public name pointing inside is refused too
+		dialer.Control = func(network, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			addr, err := netip.ParseAddr(host)
+			if err != nil {
+				return err
+			}
+			addr = addr.Unmap()
+			if addr.IsLoopback() || addr.IsPrivate() || addr.IsLinkLocalUnicast() || addr.IsLinkLocalMulticast() ||
+				addr.IsUnspecified() || addr.IsMulticast() {
+				return fmt.Errorf("webhook address %s is not public", addr)
+			}
+			return nil
+		}
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil
+	transport.DialContext = dialer.DialContext
+
+	return &http.Client{
+		Timeout:   cfg.Duration("WEBHOOK_TIMEOUT", 10*time.Second),
+		Transport: transport,
+		// a redirect is an answer of the callback, not followed to an address that was never checked
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
+
+// events.Publisher posting a delivery to its webhook, the key of the event is webhook:<id>
+type webhookSender struct {
+	client *http.Client
+}
+
+func (s webhookSender) Publish(ctx context.Context, event events.Event) error {
+	id, err := strconv.Atoi(strings.TrimPrefix(event.Key, "webhook:"))
+	if err != nil {
+		return err
+	}
+
+	webhook, err := repo.FindWebhookByID(ctx, id)
+	if err != nil {
+		// deleted meanwhile with its deliveries, nothing left to deliver
+		if errors.Is(err, errWebhookNotFound) {
+			return nil
+		}
+		return err
+	}
+
+	body, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, webhook.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "99co-webhooks/1")
+	req.Header.Set("X-Webhook-Id", strconv.Itoa(webhook.ID))
+	req.Header.Set("X-Webhook-Event", event.Type)
+	req.Header.Set("X-Webhook-Event-Id", event.ID)
+	req.Header.Set("X-Webhook-Timestamp", timestamp)
+	req.Header.Set("X-Webhook-Signature", webhookSignature(webhook.Secret, timestamp, body))
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	// read a little of the answer so the connection is reused
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("callback answered %d", resp.StatusCode)
+	}
+	return nil
+}
+
+func (webhookSender) Close() error { return nil }
+
+func (r *sqlUserRepository) webhookDeliveries() *sqlOutbox {
+	return &sqlOutbox{r: r, name: "WebhookDeliveries", table: "webhook_deliveries", keyColumn: "webhook_id", keyPrefix: "webhook:", deadStatus: "failed",
+		deadLetterSource: DeadLetterWebhookDeliveries}
+}
+
+func (r *sqlUserRepository) FindWebhooksByUserID(ctx context.Context, userID int) ([]Webhook, error) {
+	ctx, done := r.observe(ctx, "findWebhooksByUserID")
+	defer done()
+
+	return r.findWebhooks(ctx, "SELECT id, user_id, url, events, created_at FROM webhooks WHERE user_id = ? ORDER BY id", userID)
+}
+
+// webhooks of the event type, of all users
+func (r *sqlUserRepository) FindWebhooksByEvent(ctx context.Context, eventType string) ([]Webhook, error) {
+	ctx, done := r.observe(ctx, "findWebhooksByEvent")
+	defer done()
+
+	webhooks, err := r.findWebhooks(ctx, "SELECT id, user_id, url, events, created_at FROM webhooks ORDER BY id")
+	if err != nil {
+		return nil, err
+	}
+
+	return slices.DeleteFunc(webhooks, func(webhook Webhook) bool {
+		return !slices.Contains(webhook.Events, eventType)
+	}), nil
+}
+
+func (r *sqlUserRepository) findWebhooks(ctx context.Context, query string, args ...any) ([]Webhook, error) {
+	rows, err := r.query(ctx, query, args...)
+	if err != nil {
+		slog.ErrorContext(ctx, "handler error", "code", "071", "error", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	webhooks := []Webhook{}
+	for rows.Next() {
+		var webhook Webhook
+		var types string
+		if err := rows.Scan(&webhook.ID, &webhook.UserID, &webhook.URL, &types, &webhook.CreatedAt); err != nil {
+			slog.ErrorContext(ctx, "handler error", "code", "072", "error", err)
+			return nil, err
+		}
+		webhook.Events = strings.Split(types, ",")
+		webhooks = append(webhooks, webhook)
+	}
+
+	return webhooks, rows.Err()
+}
+
+// webhook with its secret
+func (r *sqlUserRepository) FindWebhookByID(ctx context.Context, id int) (*Webhook, error) {
+	ctx, done := r.observe(ctx, "findWebhookByID")
+	defer done()
+
+	var webhook Webhook
+	var types string
+	err := r.queryRow(ctx, "SELECT id, user_id, url, events, secret, created_at FROM webhooks WHERE id = ?", id).
+		Scan(&webhook.ID, &webhook.UserID, &webhook.URL, &types, &webhook.Secret, &webhook.CreatedAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, errWebhookNotFound
+		}
+		slog.ErrorContext(ctx, "handler error", "code", "073", "error", err)
+		return nil, err
+	}
+	webhook.Events = strings.Split(types, ",")
+
+	return &webhook, nil
+}
+
+func (r *sqlUserRepository) CreateWebhook(ctx context.Context, webhook *Webhook) error {
+	ctx, done := r.observe(ctx, "createWebhook")
+	defer done()
+
+	err := r.insertRow(ctx, "INSERT INTO webhooks (user_id, url, events, secret, created_at) VALUES (?, ?, ?, ?, ?) RETURNING id",
+		webhook.UserID, webhook.URL, strings.Join(webhook.Events, ","), webhook.Secret, webhook.CreatedAt).Scan(&webhook.ID)
+	if err != nil {
+		slog.ErrorContext(ctx, "handler error", "code", "074", "error", err)
+		return err
+	}
+
+	return nil
+}
+
+// delete webhook of the user with its deliveries, errWebhookNotFound when the user has no such webhook
+func (r *sqlUserRepository) DeleteWebhook(ctx context.Context, userID, webhookID int) error {
+	ctx, done := r.observe(ctx, "deleteWebhook")
+	defer done()
+
+	var affected int64
+	err := r.withTx(ctx, func(tx *sql.Tx) error {
+		result, err := tx.ExecContext(ctx, r.rebind("DELETE FROM webhooks WHERE id = ? AND user_id = ?"), webhookID, userID)
+		if err != nil {
+			return err
+		}
+		if affected, err = result.RowsAffected(); err != nil || affected == 0 {
+			return err
+		}
+
+		_, err = tx.ExecContext(ctx, r.rebind("DELETE FROM webhook_deliveries WHERE webhook_id = ?"), webhookID)
+		return err
+	})
+	if err != nil {
+		slog.ErrorContext(ctx, "handler error", "code", "075", "error", err)
+		return err
+	}
+
+	if affected == 0 {
+		return errWebhookNotFound
+	}
+	return nil
+}
+
+// latest deliveries of the webhook first, of status unless empty
+func (r *sqlUserRepository) FindWebhookDeliveries(ctx context.Context, webhookID int, status string, limit int) ([]WebhookDelivery, error) {
+	ctx, done := r.observe(ctx, "findWebhookDeliveries")
+	defer done()
+
+	query := "SELECT id, webhook_id, event_id, event_type, status, attempts, next_attempt_at, last_error, created_at, delivered_at FROM webhook_deliveries WHERE webhook_id = ?"
+	args := []any{webhookID}
+	if status != "" {
+		query += " AND status = ?"
+		args = append(args, status)
+	}
+	query += " ORDER BY id DESC LIMIT ?"
+	args = append(args, limit)
+
+	rows, err := r.query(ctx, query, args...)
+	if err != nil {
+		slog.ErrorContext(ctx, "handler error", "code", "076", "error", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	deliveries := []WebhookDelivery{}
+	for rows.Next() {
+		var delivery WebhookDelivery
+		var nextAttemptAt int64
+		var lastError sql.NullString
+		if err := rows.Scan(&delivery.ID, &delivery.WebhookID, &delivery.EventID, &delivery.EventType, &delivery.Status,
+			&delivery.Attempts, &nextAttemptAt, &lastError, &delivery.CreatedAt, &delivery.DeliveredAt); err != nil {
+			slog.ErrorContext(ctx, "handler error", "code", "077", "error", err)
+			return nil, err
+		}
+		if delivery.Status == "pending" {
+			delivery.NextAttemptAt = &nextAttemptAt
+		}
+		delivery.LastError = lastError.String
+		deliveries = append(deliveries, delivery)
+	}
+
+	return deliveries, rows.Err()
+}
+
+// queue a pending delivery of event to each webhook, a delivery queued before is kept as it is
+func (r *sqlUserRepository) CreateWebhookDeliveries(ctx context.Context, webhookIDs []int, event events.Event, payload string) error {
+	ctx, done := r.observe(ctx, "createWebhookDeliveries")
+	defer done()
+
+	now := time.Now().UnixMicro()
+	err := r.withTx(ctx, func(tx *sql.Tx) error {
+		for _, id := range webhookIDs {
+			_, err := tx.ExecContext(ctx, r.rebind("INSERT INTO webhook_deliveries (webhook_id, event_id, event_type, payload, next_attempt_at, created_at) VALUES (?, ?, ?, ?, ?, ?) ON CONFLICT DO NOTHING"),
+				id, event.ID, event.Type, payload, now, now)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		slog.ErrorContext(ctx, "handler error", "code", "078", "error", err)
+		return err
+	}
+
+	return nil
+}